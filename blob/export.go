@@ -0,0 +1,75 @@
+package blob
+
+import (
+	"context"
+	"fmt"
+	"path"
+
+	"encore.dev/rlog"
+	"github.com/brinestone/scholaris/dto"
+	"github.com/brinestone/scholaris/helpers"
+	"github.com/brinestone/scholaris/util"
+	"github.com/lib/pq"
+)
+
+var uploadColumns = []string{"key", "name", "mime_type", "size", "uploaded_by", "uploaded_at", "owner", "owner_type"}
+
+// Exports the metadata of the files uploaded on behalf of the given owners. The files themselves are listed as
+// objects to be copied from the uploads bucket, under files/<key>_<name>, and are left in place once archived.
+//
+//encore:api private method=POST path=/blob/owned/export
+func ExportOwnedUploads(ctx context.Context, req dto.ExportOwnedRequest) (ans *dto.ExportResponse, err error) {
+	rows, err := db.Query(ctx, helpers.JsonRowsQuery(`
+		SELECT
+			key, name, mime_type, size, uploaded_by, uploaded_at, owner, owner_type
+		FROM
+			uploads
+		WHERE
+			owner_type = $1 AND owner = ANY($2)
+		ORDER BY
+			uploaded_at`), req.OwnerType, pq.Array(req.Owners))
+	if err == nil {
+		err = helpers.StageCsvRows(ctx, UploadsBucket, req.StagingKey("uploads.csv"), rows, uploadColumns...)
+	}
+	if err != nil {
+		rlog.Error("could not export uploads", "ownerType", req.OwnerType, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = new(dto.ExportResponse)
+	ans.Stage(req.StagingKey("uploads.csv"), "uploads.csv")
+
+	keys, err := findOwnedUploadKeys(ctx, req.OwnerType, req.Owners...)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		ans, err = nil, &util.ErrUnknown
+		return
+	}
+	for key, name := range keys {
+		ans.Objects = append(ans.Objects, dto.ExportedObject{
+			Key:  key,
+			Path: path.Join("files", fmt.Sprintf("%s_%s", key, path.Base(name))),
+		})
+	}
+	return
+}
+
+func findOwnedUploadKeys(ctx context.Context, ownerType dto.PermissionType, owners ...uint64) (ans map[string]string, err error) {
+	rows, err := db.Query(ctx, "SELECT key, name FROM uploads WHERE owner_type = $1 AND owner = ANY($2);", ownerType, pq.Array(owners))
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	ans = make(map[string]string)
+	for rows.Next() {
+		var key, name string
+		if err = rows.Scan(&key, &name); err != nil {
+			return
+		}
+		ans[key] = name
+	}
+	err = rows.Err()
+	return
+}
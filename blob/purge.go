@@ -0,0 +1,96 @@
+package blob
+
+import (
+	"context"
+	"errors"
+
+	"encore.dev/rlog"
+	"encore.dev/storage/objects"
+	"github.com/brinestone/scholaris/core/permissions"
+	"github.com/brinestone/scholaris/dto"
+	"github.com/brinestone/scholaris/helpers"
+	"github.com/brinestone/scholaris/util"
+	"github.com/lib/pq"
+)
+
+// Deletes the files uploaded on behalf of the given owners
+//
+//encore:api private method=POST path=/blob/owned/purge
+func PurgeOwnedUploads(ctx context.Context, req dto.PurgeOwnedRequest) (ans *dto.PurgeResponse, err error) {
+	deleted, err := purgeOwnedUploads(ctx, req.OwnerType, req.Owners...)
+	if err != nil {
+		rlog.Error("could not purge uploads", "ownerType", req.OwnerType, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = &dto.PurgeResponse{Deleted: deleted}
+	return
+}
+
+// Deletes shared files stored on behalf of institutions or tenants
+//
+//encore:api private method=POST path=/blob/shared/internal/delete
+func DeleteSharedFilesInternal(ctx context.Context, req dto.DeleteUploadsRequest) (ans *dto.PurgeResponse, err error) {
+	deleted, err := deleteUploads(ctx, "DELETE FROM uploads WHERE key = ANY($1) AND owner_type IN ($2, $3) RETURNING key;", pq.Array(req.Keys), dto.PTInstitution, dto.PTTenant)
+	if err != nil {
+		rlog.Error("could not delete shared files", "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = &dto.PurgeResponse{Deleted: deleted}
+	return
+}
+
+func purgeOwnedUploads(ctx context.Context, ownerType dto.PermissionType, owners ...uint64) (deleted uint, err error) {
+	return deleteUploads(ctx, "DELETE FROM uploads WHERE owner_type = $1 AND owner = ANY($2) RETURNING key;", ownerType, pq.Array(owners))
+}
+
+// Deletes the uploads returned by a query along with their objects and permissions. Objects and tuples are only
+// removed once the rows are gone, so that a failed commit leaves the uploads intact.
+func deleteUploads(ctx context.Context, query string, args ...any) (deleted uint, err error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(ctx, query, args...)
+	if err != nil {
+		return
+	}
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err = rows.Scan(&key); err != nil {
+			rows.Close()
+			return
+		}
+		keys = append(keys, key)
+	}
+	rows.Close()
+
+	if len(keys) == 0 {
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		return
+	}
+	deleted = uint(len(keys))
+
+	for _, key := range keys {
+		if err = UploadsBucket.Remove(ctx, key); err != nil && !errors.Is(err, objects.ErrObjectNotFound) {
+			return
+		}
+	}
+
+	_, err = permissions.PurgeObjectTuples(ctx, dto.PurgeObjectTuplesRequest{
+		Objects: helpers.SliceMap(keys, func(key string) string {
+			return dto.IdentifierString(dto.PTSharedFile, key)
+		}),
+	})
+	return
+}
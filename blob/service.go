@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"encore.dev"
 	"encore.dev/beta/auth"
@@ -20,6 +21,7 @@ import (
 	"github.com/brinestone/scholaris/dto"
 	"github.com/brinestone/scholaris/helpers"
 	"github.com/brinestone/scholaris/util"
+	"github.com/lib/pq"
 )
 
 const (
@@ -245,3 +247,112 @@ func registerDownload(ctx context.Context, tx *sqldb.Tx, key string, user *uint6
 	_, err = tx.Exec(ctx, query, user, key)
 	return
 }
+
+// Finds the metadata of uploaded files
+//
+//encore:api private method=POST path=/blob/uploads/internal
+func FindUploadsInternal(ctx context.Context, req dto.FindUploadsRequest) (ans *dto.FindUploadsResponse, err error) {
+	rows, err := db.Query(ctx, "SELECT key, name, mime_type, size, uploaded_by, uploaded_at, owner, owner_type FROM uploads WHERE key = ANY($1);", pq.Array(req.Keys))
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+	defer rows.Close()
+
+	ans = &dto.FindUploadsResponse{
+		Uploads: make([]dto.UploadInfo, 0),
+	}
+	for rows.Next() {
+		var u dto.UploadInfo
+		if err = rows.Scan(&u.Key, &u.Name, &u.MimeType, &u.Size, &u.UploadedBy, &u.UploadedAt, &u.Owner, &u.OwnerType); err != nil {
+			rlog.Error(util.MsgDbAccessError, "err", err)
+			ans, err = nil, &util.ErrUnknown
+			return
+		}
+		ans.Uploads = append(ans.Uploads, u)
+	}
+	return
+}
+
+// Stores a file generated on behalf of an institution or a tenant as a shared file. Who else may view it is left to
+// the caller.
+//
+//encore:api private method=POST path=/blob/shared/internal
+func StoreSharedFileInternal(ctx context.Context, req dto.StoreSharedFileRequest) (ans *dto.UploadInfo, err error) {
+	key := fmt.Sprintf("%s_%s", FTShared, helpers.NewUlid())
+	writer := UploadsBucket.Upload(ctx, key, objects.WithUploadAttrs(objects.UploadAttrs{ContentType: req.MimeType}))
+	if _, err = writer.Write(req.Content); err != nil {
+		writer.Abort(err)
+		rlog.Error("upload error", "err", err)
+		err = &util.ErrUnknown
+		return
+	} else if err = writer.Close(); err != nil {
+		rlog.Error("upload error", "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	defer func() {
+		if err == nil {
+			return
+		}
+		if err := UploadsBucket.Remove(ctx, key); err != nil {
+			rlog.Error("bucket error", "key", key, "err", err)
+		}
+	}()
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+	defer tx.Rollback()
+
+	if err = registerUpload(ctx, tx, req.UploadedBy, req.Owner, uint64(len(req.Content)), string(req.OwnerType), req.Name, req.MimeType, key); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if err = permissions.SetPermissions(ctx, dto.UpdatePermissionsRequest{
+		Updates: []dto.PermissionUpdate{
+			{
+				Actor:    dto.IdentifierString(req.OwnerType, req.Owner),
+				Relation: dto.PNOwner,
+				Target:   dto.IdentifierString(dto.PTSharedFile, key),
+			},
+		},
+	}); err != nil {
+		rlog.Error(util.MsgCallError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	var uploadedAt time.Time
+	if err = tx.QueryRow(ctx, "SELECT uploaded_at FROM uploads WHERE key = $1;", key).Scan(&uploadedAt); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ownerType := string(req.OwnerType)
+	ans = &dto.UploadInfo{
+		Key:        key,
+		Name:       req.Name,
+		MimeType:   req.MimeType,
+		Size:       int64(len(req.Content)),
+		UploadedBy: req.UploadedBy,
+		UploadedAt: uploadedAt,
+		Owner:      &req.Owner,
+		OwnerType:  &ownerType,
+	}
+	return
+}
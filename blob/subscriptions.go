@@ -0,0 +1,36 @@
+package blob
+
+import (
+	"context"
+
+	"encore.dev/pubsub"
+	"github.com/brinestone/scholaris/core/pkg"
+	"github.com/brinestone/scholaris/dto"
+	"github.com/brinestone/scholaris/tenants"
+)
+
+var _ = pubsub.NewSubscription(tenants.DeletedTenants, "purge-tenant-uploads", pubsub.SubscriptionConfig[*tenants.TenantDeleted]{
+	Handler: purgeUploadsOnTenantDeleted,
+})
+
+var _ = pubsub.NewSubscription(tenants.RetriedDeletionSteps, "retry-purge-tenant-uploads", pubsub.SubscriptionConfig[*tenants.TenantDeleted]{
+	Handler: purgeUploadsOnTenantDeleted,
+})
+
+func purgeUploadsOnTenantDeleted(ctx context.Context, msg *tenants.TenantDeleted) error {
+	if !msg.Includes(tenants.DeletionStepUploads) {
+		return nil
+	}
+
+	_, err := purgeOwnedUploads(ctx, dto.PTTenant, msg.Id)
+	return msg.Acknowledge(ctx, tenants.DeletionStepUploads, err)
+}
+
+var _ = pubsub.NewSubscription(pkg.DeletedInstitutions, "purge-institution-uploads", pubsub.SubscriptionConfig[*pkg.InstitutionDeleted]{
+	Handler: purgeUploadsOnInstitutionDeleted,
+})
+
+func purgeUploadsOnInstitutionDeleted(ctx context.Context, msg *pkg.InstitutionDeleted) error {
+	_, err := purgeOwnedUploads(ctx, dto.PTInstitution, msg.Id)
+	return err
+}
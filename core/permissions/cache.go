@@ -1,22 +1,295 @@
 package permissions
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
-	"encore.dev/beta/auth"
+	"encore.dev/rlog"
 	"encore.dev/storage/cache"
 	"github.com/brinestone/scholaris/core/pkg"
 	"github.com/brinestone/scholaris/dto"
+	"github.com/brinestone/scholaris/helpers"
 	"github.com/brinestone/scholaris/util"
+	openfga "github.com/openfga/go-sdk"
 )
 
-var relationsCache = cache.NewStructKeyspace[string, dto.ListRelationsResponse](pkg.CacheCluster, cache.KeyspaceConfig{
-	KeyPattern:    "relations/:key",
-	DefaultExpiry: cache.ExpireIn(time.Hour * 2),
+// The tag bumped by changes that may affect any check, such as tuple migrations.
+const globalCheckTag = "*"
+
+// Cached check results. Entries only live briefly as access gained through a parent is not tracked by tags.
+var checkCache = cache.NewStructKeyspace[string, dto.RelationCheckResponse](pkg.CacheCluster, cache.KeyspaceConfig{
+	KeyPattern:    "checks/:key",
+	DefaultExpiry: cache.ExpireIn(time.Minute),
+})
+
+// Generation counters of invalidation tags. Bumping a tag's generation orphans every cached check keyed on it.
+var checkTagGenerations = cache.NewIntKeyspace[string](pkg.CacheCluster, cache.KeyspaceConfig{
+	KeyPattern:    "check-tags/:key",
+	DefaultExpiry: cache.ExpireIn(time.Hour * 24),
+})
+
+// Derives the cache key of a single check of an actor on a target.
+func checkCacheKey(ctx context.Context, actor, relation, target string) (ans string, err error) {
+	keys, err := checkCacheKeys(ctx, actor, target, relation)
+	if err != nil {
+		return
+	}
+	ans = keys[0]
+	return
+}
+
+// Derives the cache keys of several checks of an actor on the same target, reading the tag generations once.
+func checkCacheKeys(ctx context.Context, actor, target string, relations ...string) (ans []string, err error) {
+	global, err := tagGeneration(ctx, globalCheckTag)
+	if err != nil {
+		return
+	}
+	actorGeneration, err := tagGeneration(ctx, actor)
+	if err != nil {
+		return
+	}
+	targetGeneration, err := tagGeneration(ctx, target)
+	if err != nil {
+		return
+	}
+
+	ans = helpers.SliceMap(relations, func(relation string) string {
+		return checkCacheKeyOf(actor, relation, target, global, actorGeneration, targetGeneration)
+	})
+	return
+}
+
+// Reads the current generation of an invalidation tag. Tags which were never bumped are at generation 0.
+func tagGeneration(ctx context.Context, tag string) (ans int64, err error) {
+	if ans, err = checkTagGenerations.Get(ctx, tag); errors.Is(err, cache.Miss) {
+		err = nil
+	}
+	return
+}
+
+// Looks up the cached checks of an actor on several targets. The global and actor generations are shared by every
+// target so they are read once, while each target's generation and cached result are read concurrently as the cache
+// has no multi-key reads. Targets without a cached result are reported as misses.
+func cachedChecks(ctx context.Context, actor, relation string, targets []string) (keys map[string]string, results map[string]dto.RelationCheckResponse, err error) {
+	global, err := tagGeneration(ctx, globalCheckTag)
+	if err != nil {
+		return
+	}
+	actorGeneration, err := tagGeneration(ctx, actor)
+	if err != nil {
+		return
+	}
+
+	type lookup struct {
+		key    string
+		result *dto.RelationCheckResponse
+		err    error
+	}
+	lookups := make([]lookup, len(targets))
+
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			targetGeneration, err := tagGeneration(ctx, target)
+			if err != nil {
+				lookups[i].err = err
+				return
+			}
+
+			lookups[i].key = checkCacheKeyOf(actor, relation, target, global, actorGeneration, targetGeneration)
+			if cached, err := checkCache.Get(ctx, lookups[i].key); err == nil {
+				lookups[i].result = &cached
+			} else if !errors.Is(err, cache.Miss) {
+				lookups[i].err = err
+			}
+		}()
+	}
+	wg.Wait()
+
+	keys = make(map[string]string, len(targets))
+	results = make(map[string]dto.RelationCheckResponse, len(targets))
+	for i, l := range lookups {
+		if l.err != nil {
+			err = l.err
+			return
+		}
+		keys[targets[i]] = l.key
+		if l.result != nil {
+			results[targets[i]] = *l.result
+		}
+	}
+	return
+}
+
+// Derives the cache key of a check from its tuple and the generations of its tags, so that bumping any of them
+// orphans the entry.
+func checkCacheKeyOf(actor, relation, target string, generations ...int64) string {
+	args := []string{actor, relation, target}
+	for _, g := range generations {
+		args = append(args, strconv.FormatInt(g, 10))
+	}
+	return util.HashThese(args...)
+}
+
+// The tags to invalidate when tuples change. Grants to a concrete user only affect that user's checks, while
+// structural tuples (usersets, wildcards, parents) affect every check on their target, which are also returned apart
+// so that the checks of the objects inheriting from them can be invalidated as well.
+func checkTagsOf(updates []dto.PermissionUpdate) (tags, structural []string) {
+	for _, u := range updates {
+		userType, id, _ := strings.Cut(u.Actor, ":")
+		if userType == string(dto.PTUser) && id != "*" && !strings.Contains(id, "#") {
+			tags = append(tags, u.Actor)
+			continue
+		}
+
+		tags = append(tags, u.Target)
+		structural = append(structural, u.Target)
+	}
+	return
+}
+
+// Invalidates the cached checks affected by tuples that were just written or deleted. Invalidation happens before the
+// write returns so callers never observe a stale result afterwards. Removing a structural tuple also invalidates the
+// objects inheriting from its target so that inherited access does not outlive it; when they cannot all be found,
+// every cached check is invalidated instead. Adding one only widens access, which those checks pick up on expiry.
+// A failure is only logged as the tuples are already written; the affected entries then expire on their own.
+func (s *Service) invalidateChangedTuples(ctx context.Context, updates []dto.PermissionUpdate, deleted bool) {
+	tags, structural := checkTagsOf(updates)
+	if deleted && len(structural) > 0 {
+		if inheriting, err := inheritingObjects(ctx, s.readTuples, structural); err != nil {
+			rlog.Error("could not find the objects inheriting from changed tuples", "err", err)
+			tags = append(tags, globalCheckTag)
+		} else {
+			tags = append(tags, inheriting...)
+		}
+	}
+
+	if err := invalidateCheckTags(ctx, tags...); err != nil {
+		rlog.Error(util.MsgCacheAccessError, "err", err)
+	}
+}
+
+// The most objects invalidated below structural tuples before falling back to invalidating every check.
+const maxInheritingObjects = 1000
+
+var errTooManyInheritingObjects = errors.New("too many objects inherit from the changed tuples")
+
+// Finds the objects inheriting checks from the given ones, directly or through other objects, by following the
+// relations of the embedded model which reference them.
+func inheritingObjects(ctx context.Context, read tupleReader, objects []string) (ans []string, err error) {
+	relations := inheritingRelations()
+	seen := make(map[string]bool)
+	for _, o := range objects {
+		seen[o] = true
+	}
+
+	for queue := slices.Clone(objects); len(queue) > 0; queue = queue[1:] {
+		object := queue[0]
+		objectType, _, _ := strings.Cut(object, ":")
+		for _, r := range relations[objectType] {
+			user := object
+			if len(r.userRelation) > 0 {
+				user += "#" + r.userRelation
+			}
+
+			var tuples []openfga.Tuple
+			if tuples, err = read(ctx, user, r.relation, r.objectType+":"); err != nil {
+				return
+			}
+
+			for _, t := range tuples {
+				if seen[t.Key.Object] {
+					continue
+				}
+				if len(ans) == maxInheritingObjects {
+					err = errTooManyInheritingObjects
+					return
+				}
+				seen[t.Key.Object] = true
+				ans = append(ans, t.Key.Object)
+				queue = append(queue, t.Key.Object)
+			}
+		}
+	}
+	return
+}
+
+// A relation through which objects of a type inherit checks from objects of another type, either as the tupleset of
+// a tuple-to-userset or through usersets of the other type.
+type inheritance struct {
+	objectType   string
+	relation     string
+	userRelation string
+}
+
+// The relations through which objects inherit checks from other objects in the embedded model, keyed by the type of
+// the objects inherited from.
+var inheritingRelations = sync.OnceValue(func() map[string][]inheritance {
+	ans := make(map[string][]inheritance)
+
+	var model openfga.WriteAuthorizationModelRequest
+	if err := json.Unmarshal(authorizationModel, &model); err != nil {
+		rlog.Error("could not read the relations of the authorization model", "err", err)
+		return ans
+	}
+
+	for _, td := range model.TypeDefinitions {
+		tuplesets := make(map[string]bool)
+		for _, u := range td.GetRelations() {
+			collectTuplesets(u, tuplesets)
+		}
+
+		for relation, metadata := range td.Metadata.GetRelations() {
+			for _, ref := range metadata.GetDirectlyRelatedUserTypes() {
+				switch {
+				case ref.Wildcard != nil:
+				case ref.Relation != nil:
+					ans[ref.Type] = append(ans[ref.Type], inheritance{td.Type, relation, *ref.Relation})
+				case tuplesets[relation]:
+					ans[ref.Type] = append(ans[ref.Type], inheritance{td.Type, relation, ""})
+				}
+			}
+		}
+	}
+	return ans
 })
 
-func relationsCacheKey(uid auth.UID, target string, relations ...string) (ans string) {
-	args := append(relations, target, string(uid))
-	ans = util.HashThese(args...)
+func collectTuplesets(u openfga.Userset, ans map[string]bool) {
+	switch {
+	case u.TupleToUserset != nil:
+		ans[u.TupleToUserset.Tupleset.GetRelation()] = true
+	case u.Union != nil:
+		for _, c := range u.Union.Child {
+			collectTuplesets(c, ans)
+		}
+	case u.Intersection != nil:
+		for _, c := range u.Intersection.Child {
+			collectTuplesets(c, ans)
+		}
+	case u.Difference != nil:
+		collectTuplesets(u.Difference.Base, ans)
+		collectTuplesets(u.Difference.Subtract, ans)
+	}
+}
+
+func invalidateCheckTags(ctx context.Context, tags ...string) (err error) {
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		if seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		if _, err = checkTagGenerations.Increment(ctx, tag, 1); err != nil {
+			return
+		}
+	}
 	return
 }
@@ -0,0 +1,118 @@
+package permissions
+
+import (
+	"context"
+	"testing"
+
+	"github.com/brinestone/scholaris/dto"
+	openfga "github.com/openfga/go-sdk"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckCacheKeyChangesWithEveryGeneration(t *testing.T) {
+	base := checkCacheKeyOf("user:1", "can_view", "form:2", 0, 0, 0)
+	assert.Equal(t, base, checkCacheKeyOf("user:1", "can_view", "form:2", 0, 0, 0))
+
+	for i := range 3 {
+		generations := []int64{0, 0, 0}
+		generations[i] = 1
+		assert.NotEqual(t, base, checkCacheKeyOf("user:1", "can_view", "form:2", generations...))
+	}
+}
+
+func TestCheckCacheKeyDoesNotCollideAcrossGenerationBoundaries(t *testing.T) {
+	assert.NotEqual(t,
+		checkCacheKeyOf("user:1", "can_view", "form:2", 1, 23, 0),
+		checkCacheKeyOf("user:1", "can_view", "form:2", 12, 3, 0),
+	)
+	assert.NotEqual(t,
+		checkCacheKeyOf("user:1", "can_view", "form:2"),
+		checkCacheKeyOf("user:1", "can_vie", "wform:2"),
+	)
+}
+
+func TestCachedChecksMatchSingleCheckKeys(t *testing.T) {
+	ctx := context.Background()
+	_, err := checkTagGenerations.Increment(ctx, "form:31", 1)
+	assert.NoError(t, err)
+
+	hit, err := checkCacheKey(ctx, "user:30", "can_view", "form:31")
+	assert.NoError(t, err)
+	assert.NoError(t, checkCache.Set(ctx, hit, dto.RelationCheckResponse{Allowed: true}))
+
+	keys, cached, err := cachedChecks(ctx, "user:30", "can_view", []string{"form:31", "form:32"})
+	assert.NoError(t, err)
+	assert.Equal(t, hit, keys["form:31"])
+	assert.Equal(t, map[string]dto.RelationCheckResponse{"form:31": {Allowed: true}}, cached)
+
+	miss, err := checkCacheKey(ctx, "user:30", "can_view", "form:32")
+	assert.NoError(t, err)
+	assert.Equal(t, miss, keys["form:32"])
+}
+
+func TestCheckTagsOfUserGrants(t *testing.T) {
+	updates := []dto.PermissionUpdate{
+		dto.NewPermissionUpdate[string]("user:1", dto.PNMember, "institution:4"),
+		dto.NewPermissionUpdate[string]("user:2", dto.PNAdmin, "tenant:9"),
+	}
+
+	tags, structural := checkTagsOf(updates)
+	assert.Equal(t, []string{"user:1", "user:2"}, tags)
+	assert.Empty(t, structural)
+}
+
+func TestCheckTagsOfStructuralTuples(t *testing.T) {
+	updates := []dto.PermissionUpdate{
+		dto.NewPermissionUpdate[string]("user:1", dto.PNMember, "institution:4"),
+		dto.NewPermissionUpdate[string]("institution:4", dto.PNParent, "form:7"),
+		dto.NewPermissionUpdate[string]("user:*", dto.PNCanView, "form:8"),
+		dto.NewPermissionUpdate[string]("institution:4#member", dto.PNCanView, "form:9"),
+	}
+
+	tags, structural := checkTagsOf(updates)
+	assert.Equal(t, []string{"user:1", "form:7", "form:8", "form:9"}, tags)
+	assert.Equal(t, []string{"form:7", "form:8", "form:9"}, structural)
+}
+
+func TestInheritingRelationsFollowTuplesetsAndUsersets(t *testing.T) {
+	relations := inheritingRelations()
+	assert.Contains(t, relations["tenant"], inheritance{"institution", "parent", ""})
+	assert.Contains(t, relations["institution"], inheritance{"class", "owner", ""})
+	assert.Contains(t, relations["institution"], inheritance{"shared_file", "can_view", "member"})
+	assert.Empty(t, relations["user"])
+}
+
+// Reads tuples from a fixed set keyed by "user relation object".
+func fakeTupleReader(tuples map[string][]string) tupleReader {
+	return func(ctx context.Context, user, relation, object string) (ans []openfga.Tuple, err error) {
+		for _, o := range tuples[user+" "+relation+" "+object] {
+			ans = append(ans, openfga.Tuple{Key: openfga.TupleKey{User: user, Relation: relation, Object: o}})
+		}
+		return
+	}
+}
+
+func TestInheritingObjectsWalksDescendants(t *testing.T) {
+	read := fakeTupleReader(map[string][]string{
+		"tenant:1 parent institution:":               {"institution:2"},
+		"institution:2 owner class:":                 {"class:3"},
+		"class:3 owner course:":                      {"course:4"},
+		"institution:2#member can_view shared_file:": {"shared_file:5"},
+		"tenant:9 parent institution:":               {"institution:10"},
+	})
+
+	ans, err := inheritingObjects(context.Background(), read, []string{"tenant:1"})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"institution:2", "class:3", "course:4", "shared_file:5"}, ans)
+}
+
+func TestInheritingObjectsGivesUpPastTheLimit(t *testing.T) {
+	institutions := make([]string, maxInheritingObjects+1)
+	for i := range institutions {
+		institutions[i] = dto.IdentifierString(dto.PTInstitution, uint64(i+1))
+	}
+	read := fakeTupleReader(map[string][]string{"tenant:1 parent institution:": institutions})
+
+	_, err := inheritingObjects(context.Background(), read, []string{"tenant:1"})
+	assert.ErrorIs(t, err, errTooManyInheritingObjects)
+}
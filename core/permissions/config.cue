@@ -0,0 +1,9 @@
+// Comma-separated IDs of the users administering the platform, e.g. "12,34".
+// Optional: when empty, the platform's admins are left as they are.
+PlatformAdmins: string | *""
+
+// Set the admins of an environment by matching its name, e.g.
+//
+// if #Meta.Environment.Name == "prod" {
+// 	PlatformAdmins: "1"
+// }
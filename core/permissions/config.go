@@ -0,0 +1,10 @@
+package permissions
+
+import "encore.dev/config"
+
+type Config struct {
+	// Comma-separated IDs of the users administering the platform. Empty leaves the platform's admins as they are.
+	PlatformAdmins string
+}
+
+var cfg = config.Load[*Config]()
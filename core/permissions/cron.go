@@ -0,0 +1,9 @@
+package permissions
+
+import "encore.dev/cron"
+
+var _ = cron.NewJob("grant-cleanup", cron.JobConfig{
+	Title:    "Remove expired access grants",
+	Schedule: "0 * * * *", // ! Every hour
+	Endpoint: PurgeExpiredGrants,
+})
@@ -0,0 +1,7 @@
+package permissions
+
+import "encore.dev/storage/sqldb"
+
+var permissionsDb = sqldb.NewDatabase("permissions_db", sqldb.DatabaseConfig{
+	Migrations: "./migrations",
+})
@@ -0,0 +1,388 @@
+package permissions
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"encore.dev/rlog"
+	"github.com/brinestone/scholaris/dto"
+	"github.com/brinestone/scholaris/helpers"
+	"github.com/brinestone/scholaris/util"
+	openfga "github.com/openfga/go-sdk"
+	"github.com/openfga/go-sdk/client"
+)
+
+const defaultExplanationDepth = 8
+
+// Explains how a permission check is resolved
+//
+//encore:api auth method=POST path=/permissions/explain tag:can_explain_permissions
+func (s *Service) ExplainPermission(ctx context.Context, req dto.ExplainPermissionRequest) (ans *dto.ExplainPermissionResponse, err error) {
+	var condition *dto.RelationCondition
+	if len(req.Context) > 0 {
+		tmp := dto.WithCondition("", req.Context...)
+		condition = &tmp
+	}
+
+	check, err := s.doPermissionCheck(ctx, req.Actor, req.Relation, req.Target, condition)
+	if err != nil {
+		rlog.Error(util.MsgCallError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	maxDepth := int(req.MaxDepth)
+	if maxDepth == 0 {
+		maxDepth = defaultExplanationDepth
+	}
+
+	e := s.newExplainer(req.Actor, req.Context, maxDepth)
+
+	tree, err := e.expand(ctx, req.Target, string(req.Relation), dto.ENKComputed, 0)
+	if err != nil {
+		rlog.Error(util.MsgCallError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = &dto.ExplainPermissionResponse{
+		Allowed: check.Allowed,
+		Tree:    tree,
+	}
+	return
+}
+
+// The store operations the explainer relies on. They are injected so that resolution can be exercised without a store.
+type (
+	treeExpander    func(ctx context.Context, object, relation string) (*openfga.UsersetTree, error)
+	tupleReader     func(ctx context.Context, user, relation, object string) ([]openfga.Tuple, error)
+	conditionTester func(ctx context.Context, tuple openfga.TupleKey, entries []dto.ContextEntry) (bool, error)
+)
+
+type explainer struct {
+	expandTree    treeExpander
+	readTuples    tupleReader
+	testCondition conditionTester
+	// The types of the parameters of each condition
+	parameterTypes map[string]map[string]dto.ContextEntryType
+	actor          string
+	context        []dto.ContextEntry
+	maxDepth       int
+	visited        map[string]bool
+}
+
+func (s *Service) newExplainer(actor string, context []dto.ContextEntry, maxDepth int) *explainer {
+	return &explainer{
+		expandTree:     s.expandTree,
+		readTuples:     s.readTuples,
+		testCondition:  s.testTupleCondition,
+		parameterTypes: conditionParameterTypes(),
+		actor:          actor,
+		context:        context,
+		maxDepth:       maxDepth,
+		visited:        make(map[string]bool),
+	}
+}
+
+// Expands a userset (object#relation) and resolves whether it grants access to the actor.
+func (e *explainer) expand(ctx context.Context, object, relation, kind string, depth int) (ans dto.ExplanationNode, err error) {
+	ans.Name = fmt.Sprintf("%s#%s", object, relation)
+	ans.Kind = kind
+
+	if depth >= e.maxDepth || e.visited[ans.Name] {
+		ans.Truncated = true
+		return
+	}
+	e.visited[ans.Name] = true
+	defer delete(e.visited, ans.Name)
+
+	tree, err := e.expandTree(ctx, object, relation)
+	if err != nil {
+		return
+	}
+
+	if tree == nil || tree.Root == nil {
+		return
+	}
+
+	child, err := e.resolveNode(ctx, *tree.Root, depth)
+	if err != nil {
+		return
+	}
+
+	ans.Granted = child.Granted
+	ans.Children = []dto.ExplanationNode{child}
+	return
+}
+
+func (e *explainer) resolveNode(ctx context.Context, node openfga.Node, depth int) (ans dto.ExplanationNode, err error) {
+	ans.Name = node.Name
+
+	switch {
+	case node.Union != nil:
+		ans.Kind = dto.ENKUnion
+		for _, n := range node.Union.Nodes {
+			var child dto.ExplanationNode
+			if child, err = e.resolveNode(ctx, n, depth); err != nil {
+				return
+			}
+			ans.Granted = ans.Granted || child.Granted
+			ans.Children = append(ans.Children, child)
+		}
+	case node.Intersection != nil:
+		ans.Kind = dto.ENKIntersection
+		ans.Granted = len(node.Intersection.Nodes) > 0
+		for _, n := range node.Intersection.Nodes {
+			var child dto.ExplanationNode
+			if child, err = e.resolveNode(ctx, n, depth); err != nil {
+				return
+			}
+			ans.Granted = ans.Granted && child.Granted
+			ans.Children = append(ans.Children, child)
+		}
+	case node.Difference != nil:
+		ans.Kind = dto.ENKDifference
+		var base, subtract dto.ExplanationNode
+		if base, err = e.resolveNode(ctx, node.Difference.Base, depth); err != nil {
+			return
+		}
+		if subtract, err = e.resolveNode(ctx, node.Difference.Subtract, depth); err != nil {
+			return
+		}
+		ans.Granted = base.Granted && !subtract.Granted
+		ans.Children = []dto.ExplanationNode{base, subtract}
+	case node.Leaf != nil:
+		ans, err = e.resolveLeaf(ctx, node.Name, *node.Leaf, depth)
+	}
+	return
+}
+
+func (e *explainer) resolveLeaf(ctx context.Context, name string, leaf openfga.Leaf, depth int) (ans dto.ExplanationNode, err error) {
+	ans.Name = name
+
+	switch {
+	case leaf.Users != nil:
+		ans.Kind = dto.ENKDirect
+		ans.Users = leaf.Users.Users
+		object, relation := splitUserset(name)
+		for _, u := range leaf.Users.Users {
+			if usersetObject, usersetRelation, isUserset := strings.Cut(u, "#"); isUserset {
+				var child dto.ExplanationNode
+				if child, err = e.expand(ctx, usersetObject, usersetRelation, dto.ENKComputed, depth+1); err != nil {
+					return
+				}
+				ans.Granted = ans.Granted || child.Granted
+				ans.Children = append(ans.Children, child)
+				continue
+			}
+
+			if !e.matchesActor(u) {
+				continue
+			}
+
+			var granted bool
+			var evaluations []dto.ConditionEvaluation
+			if granted, evaluations, err = e.evaluateTuples(ctx, u, relation, object); err != nil {
+				return
+			}
+			ans.Granted = ans.Granted || granted
+			ans.Conditions = append(ans.Conditions, evaluations...)
+		}
+	case leaf.Computed != nil:
+		ans.Kind = dto.ENKComputed
+		object, relation := splitUserset(leaf.Computed.Userset)
+		var child dto.ExplanationNode
+		if child, err = e.expand(ctx, object, relation, dto.ENKComputed, depth+1); err != nil {
+			return
+		}
+		ans.Granted = child.Granted
+		ans.Children = []dto.ExplanationNode{child}
+	case leaf.TupleToUserset != nil:
+		ans.Kind = dto.ENKTupleToUserset
+		for _, c := range leaf.TupleToUserset.Computed {
+			object, relation := splitUserset(c.Userset)
+			var child dto.ExplanationNode
+			if child, err = e.expand(ctx, object, relation, dto.ENKComputed, depth+1); err != nil {
+				return
+			}
+			ans.Granted = ans.Granted || child.Granted
+			ans.Children = append(ans.Children, child)
+		}
+	}
+	return
+}
+
+// Whether a directly assigned user refers to the actor, either explicitly or through a type wildcard.
+func (e *explainer) matchesActor(user string) bool {
+	if user == e.actor {
+		return true
+	}
+
+	userType, id, _ := strings.Cut(user, ":")
+	actorType, _, _ := strings.Cut(e.actor, ":")
+	return id == "*" && userType == actorType
+}
+
+// Reads the tuples assigning a user to a relation and evaluates each tuple's own condition against its stored context
+// and the request's context. A tuple without a condition grants the relation unconditionally.
+func (e *explainer) evaluateTuples(ctx context.Context, user, relation, object string) (granted bool, ans []dto.ConditionEvaluation, err error) {
+	tuples, err := e.readTuples(ctx, user, relation, object)
+	if err != nil {
+		return
+	}
+
+	for _, t := range tuples {
+		if t.Key.Condition == nil {
+			granted = true
+			continue
+		}
+
+		evaluation := dto.ConditionEvaluation{
+			User: t.Key.User,
+			Name: t.Key.Condition.Name,
+		}
+		if t.Key.Condition.Context != nil {
+			for k, v := range *t.Key.Condition.Context {
+				evaluation.TupleContext = append(evaluation.TupleContext, dto.HavingEntry(k, e.parameterType(evaluation.Name, k), v))
+			}
+			slices.SortFunc(evaluation.TupleContext, func(a, b dto.ContextEntry) int {
+				return strings.Compare(a.Name, b.Name)
+			})
+		}
+
+		if evaluation.Satisfied, err = e.testCondition(ctx, t.Key, e.context); err != nil {
+			return
+		}
+		granted = granted || evaluation.Satisfied
+		ans = append(ans, evaluation)
+	}
+	return
+}
+
+// The type of a parameter of a condition, string when the model does not define it
+func (e *explainer) parameterType(condition, parameter string) dto.ContextEntryType {
+	if t, ok := e.parameterTypes[condition][parameter]; ok {
+		return t
+	}
+	return dto.CETString
+}
+
+// Reads the types of the parameters of the conditions of the embedded model, keyed by condition then parameter
+var conditionParameterTypes = sync.OnceValue(func() map[string]map[string]dto.ContextEntryType {
+	ans := make(map[string]map[string]dto.ContextEntryType)
+
+	var model openfga.WriteAuthorizationModelRequest
+	if err := json.Unmarshal(authorizationModel, &model); err != nil {
+		rlog.Error("could not read the conditions of the authorization model", "err", err)
+		return ans
+	}
+
+	for name, condition := range model.GetConditions() {
+		ans[name] = make(map[string]dto.ContextEntryType)
+		for parameter, ref := range condition.GetParameters() {
+			ans[name][parameter] = contextEntryTypeOf(ref.TypeName)
+		}
+	}
+	return ans
+})
+
+func contextEntryTypeOf(t openfga.TypeName) dto.ContextEntryType {
+	switch t {
+	case openfga.TYPENAME_TIMESTAMP:
+		return dto.CETTimestamp
+	case openfga.TYPENAME_BOOL:
+		return dto.CETBool
+	case openfga.TYPENAME_DURATION:
+		return dto.CETDuration
+	case openfga.TYPENAME_INT:
+		return dto.CETInt
+	case openfga.TYPENAME_UINT:
+		return dto.CETUint
+	case openfga.TYPENAME_DOUBLE:
+		return dto.CETDouble
+	default:
+		return dto.CETString
+	}
+}
+
+func (s *Service) expandTree(ctx context.Context, object, relation string) (ans *openfga.UsersetTree, err error) {
+	res, err := s.fgaClient.Expand(ctx).
+		Body(client.ClientExpandRequest{
+			Relation: relation,
+			Object:   object,
+		}).
+		Execute()
+	if err != nil {
+		return
+	}
+	ans = res.Tree
+	return
+}
+
+// Reads every tuple matching the filter, following the pages of the store.
+func (s *Service) readTuples(ctx context.Context, user, relation, object string) (ans []openfga.Tuple, err error) {
+	var continuationToken string
+	for {
+		options := client.ClientReadOptions{}
+		if len(continuationToken) > 0 {
+			options.ContinuationToken = &continuationToken
+		}
+
+		var res *client.ClientReadResponse
+		if res, err = s.fgaClient.Read(ctx).
+			Body(client.ClientReadRequest{
+				User:     &user,
+				Relation: &relation,
+				Object:   &object,
+			}).
+			Options(options).
+			Execute(); err != nil {
+			return
+		}
+		ans = append(ans, res.Tuples...)
+
+		if continuationToken = res.ContinuationToken; len(continuationToken) == 0 {
+			return
+		}
+	}
+}
+
+// Evaluates a single tuple's condition in isolation. The tuple is replayed as a contextual tuple on an object of the
+// same type that holds no stored tuples, so no other path (parents, usersets, wildcards) can satisfy the check.
+func (s *Service) testTupleCondition(ctx context.Context, tuple openfga.TupleKey, entries []dto.ContextEntry) (ans bool, err error) {
+	object := isolatedObject(tuple.Object)
+	res, err := s.fgaClient.Check(ctx).
+		Body(client.ClientCheckRequest{
+			User:     tuple.User,
+			Relation: tuple.Relation,
+			Object:   object,
+			Context:  checkContext(entries...),
+			ContextualTuples: []client.ClientContextualTupleKey{{
+				User:      tuple.User,
+				Relation:  tuple.Relation,
+				Object:    object,
+				Condition: tuple.Condition,
+			}},
+		}).
+		Execute()
+	if err != nil {
+		return
+	}
+	ans = res.GetAllowed()
+	return
+}
+
+// An object of the same type as the given one which is never written to the store.
+func isolatedObject(object string) string {
+	objectType, _, _ := strings.Cut(object, ":")
+	return objectType + ":explain-" + helpers.NewUlid()
+}
+
+func splitUserset(userset string) (object, relation string) {
+	object, relation, _ = strings.Cut(userset, "#")
+	return
+}
@@ -0,0 +1,168 @@
+package permissions
+
+import (
+	"context"
+	"testing"
+
+	"github.com/brinestone/scholaris/dto"
+	openfga "github.com/openfga/go-sdk"
+	"github.com/stretchr/testify/assert"
+)
+
+const explainedActor = "user:1"
+
+func leafNode(name string, leaf openfga.Leaf) openfga.Node {
+	return openfga.Node{Name: name, Leaf: &leaf}
+}
+
+func conditionalTuple(user, relation, object, condition string, context map[string]any) openfga.Tuple {
+	return openfga.Tuple{Key: openfga.TupleKey{
+		User:      user,
+		Relation:  relation,
+		Object:    object,
+		Condition: &openfga.RelationshipCondition{Name: condition, Context: &context},
+	}}
+}
+
+// Builds an explainer over an in-memory store. Conditions are satisfied when their name is listed in satisfied.
+func fakeExplainer(trees map[string]openfga.Node, tuples map[string][]openfga.Tuple, satisfied ...string) (*explainer, *[]openfga.TupleKey) {
+	tested := make([]openfga.TupleKey, 0)
+	return &explainer{
+		expandTree: func(ctx context.Context, object, relation string) (*openfga.UsersetTree, error) {
+			root, ok := trees[object+"#"+relation]
+			if !ok {
+				return nil, nil
+			}
+			return &openfga.UsersetTree{Root: &root}, nil
+		},
+		readTuples: func(ctx context.Context, user, relation, object string) ([]openfga.Tuple, error) {
+			return tuples[user+" "+relation+" "+object], nil
+		},
+		testCondition: func(ctx context.Context, tuple openfga.TupleKey, entries []dto.ContextEntry) (bool, error) {
+			tested = append(tested, tuple)
+			for _, name := range satisfied {
+				if tuple.Condition.Name == name {
+					return true, nil
+				}
+			}
+			return false, nil
+		},
+		parameterTypes: conditionParameterTypes(),
+		actor:          explainedActor,
+		maxDepth:       defaultExplanationDepth,
+		visited:        make(map[string]bool),
+	}, &tested
+}
+
+func TestExplainReportsUnsatisfiedConditionWhenAnotherPathGrants(t *testing.T) {
+	trees := map[string]openfga.Node{
+		"doc:1#can_view": {Name: "doc:1#can_view", Union: &openfga.Nodes{Nodes: []openfga.Node{
+			leafNode("doc:1#can_view", openfga.Leaf{Users: &openfga.Users{Users: []string{explainedActor}}}),
+			leafNode("doc:1#can_view", openfga.Leaf{Computed: &openfga.Computed{Userset: "doc:1#owner"}}),
+		}}},
+		"doc:1#owner": leafNode("doc:1#owner", openfga.Leaf{Users: &openfga.Users{Users: []string{explainedActor}}}),
+	}
+	tuples := map[string][]openfga.Tuple{
+		explainedActor + " can_view doc:1": {conditionalTuple(explainedActor, "can_view", "doc:1", "not_expired", map[string]any{"expires_at": "2020-01-01T00:00:00Z"})},
+		explainedActor + " owner doc:1":    {{Key: openfga.TupleKey{User: explainedActor, Relation: "owner", Object: "doc:1"}}},
+	}
+
+	e, _ := fakeExplainer(trees, tuples)
+	tree, err := e.expand(context.TODO(), "doc:1", "can_view", dto.ENKComputed, 0)
+
+	assert.Nil(t, err)
+	assert.True(t, tree.Granted)
+
+	union := tree.Children[0]
+	direct, computed := union.Children[0], union.Children[1]
+	assert.False(t, direct.Granted)
+	if assert.Len(t, direct.Conditions, 1) {
+		assert.Equal(t, "not_expired", direct.Conditions[0].Name)
+		assert.Equal(t, explainedActor, direct.Conditions[0].User)
+		assert.False(t, direct.Conditions[0].Satisfied)
+		assert.Equal(t, []dto.ContextEntry{dto.HavingEntry("expires_at", dto.CETTimestamp, "2020-01-01T00:00:00Z")}, direct.Conditions[0].TupleContext)
+	}
+	assert.True(t, computed.Granted)
+}
+
+func TestExplainEvaluatesEveryConditionalTupleOfTheActor(t *testing.T) {
+	trees := map[string]openfga.Node{
+		"doc:1#can_view": leafNode("doc:1#can_view", openfga.Leaf{Users: &openfga.Users{Users: []string{explainedActor, "user:*", "user:2"}}}),
+	}
+	tuples := map[string][]openfga.Tuple{
+		explainedActor + " can_view doc:1": {conditionalTuple(explainedActor, "can_view", "doc:1", "not_expired", nil)},
+		"user:* can_view doc:1":            {conditionalTuple("user:*", "can_view", "doc:1", "when_visible", map[string]any{"visible_to": "member"})},
+		"user:2 can_view doc:1":            {conditionalTuple("user:2", "can_view", "doc:1", "when_visible", nil)},
+	}
+
+	e, tested := fakeExplainer(trees, tuples, "when_visible")
+	tree, err := e.expand(context.TODO(), "doc:1", "can_view", dto.ENKComputed, 0)
+
+	assert.Nil(t, err)
+	assert.True(t, tree.Granted)
+
+	direct := tree.Children[0]
+	if assert.Len(t, direct.Conditions, 2) {
+		assert.Equal(t, explainedActor, direct.Conditions[0].User)
+		assert.False(t, direct.Conditions[0].Satisfied)
+		assert.Equal(t, "user:*", direct.Conditions[1].User)
+		assert.True(t, direct.Conditions[1].Satisfied)
+	}
+	// Tuples of other users are never evaluated.
+	assert.Len(t, *tested, 2)
+}
+
+func TestExplainGrantsUnconditionalTuples(t *testing.T) {
+	trees := map[string]openfga.Node{
+		"doc:1#can_view": leafNode("doc:1#can_view", openfga.Leaf{Users: &openfga.Users{Users: []string{explainedActor}}}),
+	}
+	tuples := map[string][]openfga.Tuple{
+		explainedActor + " can_view doc:1": {{Key: openfga.TupleKey{User: explainedActor, Relation: "can_view", Object: "doc:1"}}},
+	}
+
+	e, tested := fakeExplainer(trees, tuples)
+	tree, err := e.expand(context.TODO(), "doc:1", "can_view", dto.ENKComputed, 0)
+
+	assert.Nil(t, err)
+	assert.True(t, tree.Granted)
+	assert.Empty(t, tree.Children[0].Conditions)
+	assert.Empty(t, *tested)
+}
+
+func TestExplainTruncatesCycles(t *testing.T) {
+	trees := map[string]openfga.Node{
+		"doc:1#can_view": leafNode("doc:1#can_view", openfga.Leaf{Computed: &openfga.Computed{Userset: "doc:1#can_view"}}),
+	}
+
+	e, _ := fakeExplainer(trees, nil)
+	tree, err := e.expand(context.TODO(), "doc:1", "can_view", dto.ENKComputed, 0)
+
+	assert.Nil(t, err)
+	assert.False(t, tree.Granted)
+	assert.True(t, tree.Children[0].Children[0].Truncated)
+}
+
+func TestIsolatedObjectKeepsType(t *testing.T) {
+	object := isolatedObject("institution:12")
+	assert.Regexp(t, `^institution:explain-[0-9A-Z]{26}$`, object)
+	assert.NotEqual(t, object, isolatedObject("institution:12"))
+}
+
+func TestPlatformAdminChanges(t *testing.T) {
+	writes, deletes := platformAdminChanges([]string{"user:1", "user:3"}, " 1, 2,invalid,2")
+	assert.Equal(t, []string{"user:2"}, writes)
+	assert.Equal(t, []string{"user:3"}, deletes)
+
+	writes, deletes = platformAdminChanges([]string{"user:1"}, "1")
+	assert.Empty(t, writes)
+	assert.Empty(t, deletes)
+}
+
+func TestConditionParameterTypes(t *testing.T) {
+	types := conditionParameterTypes()
+
+	assert.Equal(t, dto.CETTimestamp, types["not_expired"]["expires_at"])
+	assert.Equal(t, dto.CETBool, types["institution_visible"]["visibility"])
+	assert.Equal(t, dto.CETTimestamp, types["enrollment_available"]["deadline"])
+	assert.Equal(t, dto.CETString, types["when_visible"]["visible_to"])
+}
@@ -0,0 +1,501 @@
+package permissions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"encore.dev/beta/auth"
+	"encore.dev/beta/errs"
+	"encore.dev/rlog"
+	"encore.dev/storage/sqldb"
+	"github.com/brinestone/scholaris/dto"
+	"github.com/brinestone/scholaris/helpers"
+	"github.com/brinestone/scholaris/models"
+	"github.com/brinestone/scholaris/util"
+	openfga "github.com/openfga/go-sdk"
+	"github.com/openfga/go-sdk/client"
+)
+
+const grantCondition = "not_expired"
+
+// Grants a user temporary access to an object
+//
+//encore:api auth method=POST path=/permissions/grants
+func (s *Service) NewGrant(ctx context.Context, req dto.NewGrantRequest) (ans *dto.Grant, err error) {
+	uid, _ := auth.UserID()
+	if err = s.assertCanGrantAccess(ctx, uid, req.Target); err != nil {
+		return
+	}
+
+	grants, err := s.createGrants(ctx, uid, req.User, req.Target, req.Reason, false, grantRequest{req.Relation, req.ExpiresAt})
+	if err != nil {
+		return
+	}
+
+	ans = &grants[0]
+	return
+}
+
+// Hands a subset of the caller's relations on an object to another user until the given date
+//
+//encore:api auth method=POST path=/permissions/delegations
+func (s *Service) DelegateRelations(ctx context.Context, req dto.DelegateRelationsRequest) (ans *dto.FindGrantsResponse, err error) {
+	uid, _ := auth.UserID()
+	actor := dto.IdentifierString(dto.PTUser, uid)
+
+	requests := make([]grantRequest, 0, len(req.Relations))
+	for _, r := range req.Relations {
+		var res *dto.RelationCheckResponse
+		if res, err = s.doPermissionCheck(ctx, actor, r, req.Target, nil); err != nil {
+			rlog.Error(util.MsgCallError, "err", err)
+			err = &util.ErrUnknown
+			return
+		} else if !res.Allowed {
+			err = &errs.Error{
+				Code:    errs.PermissionDenied,
+				Message: fmt.Sprintf("You cannot delegate the %q relation as you do not hold it", r),
+			}
+			return
+		}
+
+		var expiresAt time.Time
+		if expiresAt, err = s.delegationExpiry(ctx, uid, r, req.Target, req.ExpiresAt); err != nil {
+			return
+		}
+		requests = append(requests, grantRequest{r, expiresAt})
+	}
+
+	grants, err := s.createGrants(ctx, uid, req.User, req.Target, req.Reason, true, requests...)
+	if err != nil {
+		return
+	}
+
+	ans = &dto.FindGrantsResponse{Grants: grants}
+	return
+}
+
+// Lists the temporary grants on an object
+//
+//encore:api auth method=GET path=/permissions/grants
+func (s *Service) FindGrants(ctx context.Context, req dto.FindGrantsRequest) (ans *dto.FindGrantsResponse, err error) {
+	uid, _ := auth.UserID()
+	if err = s.assertCanGrantAccess(ctx, uid, req.Target); err != nil {
+		return
+	}
+
+	grants, err := findGrantsByTarget(ctx, req.Target, req.IncludeInactive)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = &dto.FindGrantsResponse{
+		Grants: grantsToDto(grants...),
+	}
+	return
+}
+
+// Revokes a temporary grant before it expires
+//
+//encore:api auth method=DELETE path=/permissions/grants/:id
+func (s *Service) RevokeGrant(ctx context.Context, id uint64) (err error) {
+	uid, _ := auth.UserID()
+	grant, err := findGrantById(ctx, id)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		err = &util.ErrNotFound
+		return
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if strconv.FormatUint(grant.GrantedBy, 10) != string(uid) {
+		if err = s.assertCanGrantAccess(ctx, uid, grant.Target); err != nil {
+			return
+		}
+	}
+
+	if grant.RevokedAt.Valid {
+		return
+	}
+
+	if err = s.revokeGrants(ctx, grant); err != nil {
+		rlog.Error(util.MsgCallError, "err", err)
+		err = &util.ErrUnknown
+	}
+	return
+}
+
+// Removes expired grants and delegations whose delegator no longer holds the delegated relation
+//
+//encore:api private method=POST path=/permissions/grants/purge
+func (s *Service) PurgeExpiredGrants(ctx context.Context) (err error) {
+	expired, err := findExpiredGrants(ctx)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return
+	}
+
+	delegations, err := findActiveDelegations(ctx)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return
+	}
+
+	for _, d := range delegations {
+		var res *dto.RelationCheckResponse
+		if res, err = s.doUncachedPermissionCheck(ctx, dto.IdentifierString(dto.PTUser, d.GrantedBy), dto.PermissionName(d.Relation), d.Target, nil); err != nil {
+			rlog.Error(util.MsgCallError, "err", err)
+			return
+		} else if !res.Allowed {
+			expired = append(expired, d)
+		}
+	}
+
+	if len(expired) == 0 {
+		return
+	}
+
+	if err = s.revokeGrants(ctx, expired...); err != nil {
+		rlog.Error(util.MsgCallError, "err", err)
+		return
+	}
+
+	rlog.Info("grants purged", "count", len(expired))
+	return
+}
+
+func (s *Service) assertCanGrantAccess(ctx context.Context, uid auth.UID, target string) error {
+	res, err := s.doPermissionCheck(ctx, dto.IdentifierString(dto.PTUser, uid), dto.PNCanGrantAccess, target, nil)
+	if err != nil {
+		rlog.Error(util.MsgCallError, "err", err)
+		return &util.ErrUnknown
+	} else if !res.Allowed {
+		return &util.ErrForbidden
+	}
+	return nil
+}
+
+type grantRequest struct {
+	relation  dto.PermissionName
+	expiresAt time.Time
+}
+
+// Caps a delegation's expiry so that it never outlives the delegator's own access to the relation. Delegators who
+// still hold the relation at the requested expiry, e.g. through a role, are not limited.
+func (s *Service) delegationExpiry(ctx context.Context, delegator auth.UID, relation dto.PermissionName, target string, requested time.Time) (ans time.Time, err error) {
+	actor := dto.IdentifierString(dto.PTUser, delegator)
+	condition := dto.WithCondition(grantCondition, dto.HavingEntry("current_time", dto.CETTimestamp, requested.UTC().Format(time.RFC3339)))
+	res, err := s.doUncachedPermissionCheck(ctx, actor, relation, target, &condition)
+	if err != nil {
+		rlog.Error(util.MsgCallError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	granter, _ := strconv.ParseUint(string(delegator), 10, 64)
+	grants, err := findActiveGrantsOf(ctx, granter, relation, target)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans, ok := capDelegationExpiry(requested, res.Allowed, helpers.SliceMap(grants, func(g *models.Grant) time.Time {
+		return g.ExpiresAt
+	})...)
+	if !ok {
+		err = &errs.Error{
+			Code:    errs.FailedPrecondition,
+			Message: fmt.Sprintf("Your access to the %q relation ends before the requested expiry and cannot be delegated", relation),
+		}
+	}
+	return
+}
+
+// The expiry of a delegation given whether the delegator still holds the relation at the requested expiry and the
+// expiries of the grants the delegator holds it through. The delegation is refused when neither bounds it.
+func capDelegationExpiry(requested time.Time, heldAtExpiry bool, grantExpiries ...time.Time) (ans time.Time, ok bool) {
+	if heldAtExpiry {
+		return requested, true
+	}
+
+	for _, e := range grantExpiries {
+		if e.After(ans) {
+			ans = e
+		}
+	}
+	if ans.IsZero() {
+		return
+	}
+
+	if requested.Before(ans) {
+		ans = requested
+	}
+	ok = true
+	return
+}
+
+func (s *Service) createGrants(ctx context.Context, grantedBy auth.UID, user uint64, target string, reason *string, delegated bool, requests ...grantRequest) (ans []dto.Grant, err error) {
+	granter, _ := strconv.ParseUint(string(grantedBy), 10, 64)
+	actor := dto.IdentifierString(dto.PTUser, user)
+
+	// A tuple can only exist once, so relations already held without expiry cannot be granted again. Tuples of
+	// expired grants which were not purged yet are replaced.
+	var replaced []dto.PermissionUpdate
+	for _, r := range requests {
+		var tuple *openfga.TupleKey
+		if tuple, err = s.readTuple(ctx, actor, r.relation, target); err != nil {
+			rlog.Error(util.MsgCallError, "err", err)
+			err = &util.ErrUnknown
+			return
+		} else if tuple == nil {
+			continue
+		} else if !tupleExpired(*tuple, time.Now()) {
+			err = &errs.Error{
+				Code:    errs.AlreadyExists,
+				Message: fmt.Sprintf("The user already holds the %q relation on this object", r.relation),
+			}
+			return
+		}
+		replaced = append(replaced, dto.NewPermissionUpdate[string](actor, r.relation, target))
+	}
+
+	tx, err := permissionsDb.Begin(ctx)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+	defer tx.Rollback()
+
+	var updates []dto.PermissionUpdate
+	for _, r := range requests {
+		expiresAt := r.expiresAt.UTC()
+		condition := dto.WithCondition(grantCondition, dto.HavingEntry("expires_at", dto.CETTimestamp, expiresAt.Format(time.RFC3339)))
+
+		// Retires the expired grants whose tuples are replaced so the cleanup job does not remove the new tuple.
+		if _, err = tx.Exec(ctx, "UPDATE grants SET revoked_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND relation = $2 AND target = $3 AND revoked_at IS NULL AND expires_at <= CURRENT_TIMESTAMP;", user, r.relation, target); err != nil {
+			rlog.Error(util.MsgDbAccessError, "err", err)
+			err = &util.ErrUnknown
+			return
+		}
+
+		var grant *models.Grant
+		if grant, err = createGrant(ctx, tx, user, r.relation, target, expiresAt, granter, reason, delegated); err != nil {
+			rlog.Error(util.MsgDbAccessError, "err", err)
+			err = &util.ErrUnknown
+			return
+		}
+		ans = append(ans, grantsToDto(grant)...)
+		updates = append(updates, dto.NewPermissionUpdateWithCondition[string](actor, r.relation, target, &condition))
+	}
+
+	// A single write cannot delete and write the same tuple. Losing an expired tuple is harmless if the write fails.
+	if len(replaced) > 0 {
+		if err = s.DeletePermissions(ctx, dto.UpdatePermissionsRequest{Updates: replaced}); err != nil {
+			rlog.Error(util.MsgCallError, "err", err)
+			err = &util.ErrUnknown
+			return
+		}
+	}
+
+	if err = s.SetPermissions(ctx, dto.UpdatePermissionsRequest{Updates: updates}); err != nil {
+		rlog.Error(util.MsgCallError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+	}
+	return
+}
+
+// Reads the tuple relating a user to an object, regardless of its condition. Nil when there is none.
+func (s *Service) readTuple(ctx context.Context, actor string, relation dto.PermissionName, target string) (ans *openfga.TupleKey, err error) {
+	rel := string(relation)
+	res, err := s.fgaClient.Read(ctx).
+		Body(client.ClientReadRequest{
+			User:     &actor,
+			Relation: &rel,
+			Object:   &target,
+		}).
+		Execute()
+	if err != nil {
+		return
+	}
+
+	if len(res.Tuples) > 0 {
+		ans = &res.Tuples[0].Key
+	}
+	return
+}
+
+// Whether a tuple exists, regardless of its condition.
+func (s *Service) tupleExists(ctx context.Context, actor string, relation dto.PermissionName, target string) (ans bool, err error) {
+	tuple, err := s.readTuple(ctx, actor, relation, target)
+	ans = tuple != nil
+	return
+}
+
+// Whether a tuple was written by a grant which has expired by the given time.
+func tupleExpired(tuple openfga.TupleKey, now time.Time) bool {
+	if tuple.Condition == nil || tuple.Condition.Name != grantCondition || tuple.Condition.Context == nil {
+		return false
+	}
+
+	raw, ok := (*tuple.Condition.Context)["expires_at"].(string)
+	if !ok {
+		return false
+	}
+
+	expiresAt, err := time.Parse(time.RFC3339, raw)
+	return err == nil && !expiresAt.After(now)
+}
+
+// Revokes grants in batches, skipping tuples which were already removed elsewhere.
+func (s *Service) revokeGrants(ctx context.Context, grants ...*models.Grant) (err error) {
+	for i := 0; i < len(grants); i += tupleMigrationBatchSize {
+		if err = s.revokeGrantBatch(ctx, grants[i:min(i+tupleMigrationBatchSize, len(grants))]); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (s *Service) revokeGrantBatch(ctx context.Context, grants []*models.Grant) (err error) {
+	tx, err := permissionsDb.Begin(ctx)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	var updates []dto.PermissionUpdate
+	for _, g := range grants {
+		if _, err = tx.Exec(ctx, "UPDATE grants SET revoked_at = CURRENT_TIMESTAMP WHERE id = $1;", g.Id); err != nil {
+			return
+		}
+
+		actor := dto.IdentifierString(dto.PTUser, g.UserId)
+		var exists bool
+		if exists, err = s.tupleExists(ctx, actor, dto.PermissionName(g.Relation), g.Target); err != nil {
+			return
+		} else if exists {
+			updates = append(updates, dto.NewPermissionUpdate[string](actor, dto.PermissionName(g.Relation), g.Target))
+		}
+	}
+
+	if len(updates) > 0 {
+		if err = s.DeletePermissions(ctx, dto.UpdatePermissionsRequest{Updates: updates}); err != nil {
+			return
+		}
+	}
+
+	err = tx.Commit()
+	return
+}
+
+const grantFields = "id,user_id,relation,target,expires_at,granted_by,delegated,reason,created_at,revoked_at"
+
+func createGrant(ctx context.Context, tx *sqldb.Tx, user uint64, relation dto.PermissionName, target string, expiresAt time.Time, grantedBy uint64, reason *string, delegated bool) (*models.Grant, error) {
+	query := fmt.Sprintf(`
+		INSERT INTO grants(user_id, relation, target, expires_at, granted_by, reason, delegated)
+		VALUES ($1,$2,$3,$4,$5,$6,$7)
+		RETURNING %s;
+	`, grantFields)
+	return scanGrant(tx.QueryRow(ctx, query, user, relation, target, expiresAt, grantedBy, reason, delegated))
+}
+
+func findGrantById(ctx context.Context, id uint64) (*models.Grant, error) {
+	return scanGrant(permissionsDb.QueryRow(ctx, fmt.Sprintf("SELECT %s FROM grants WHERE id = $1;", grantFields), id))
+}
+
+func findGrantsByTarget(ctx context.Context, target string, includeInactive bool) ([]*models.Grant, error) {
+	query := fmt.Sprintf(`
+		SELECT
+			%s
+		FROM
+			grants
+		WHERE
+			target = $1 AND ($2 OR (revoked_at IS NULL AND expires_at > CURRENT_TIMESTAMP))
+		ORDER BY
+			created_at DESC;
+	`, grantFields)
+	return queryGrants(ctx, query, target, includeInactive)
+}
+
+func findExpiredGrants(ctx context.Context) ([]*models.Grant, error) {
+	query := fmt.Sprintf("SELECT %s FROM grants WHERE revoked_at IS NULL AND expires_at <= CURRENT_TIMESTAMP;", grantFields)
+	return queryGrants(ctx, query)
+}
+
+func findActiveGrantsOf(ctx context.Context, user uint64, relation dto.PermissionName, target string) ([]*models.Grant, error) {
+	query := fmt.Sprintf("SELECT %s FROM grants WHERE user_id = $1 AND relation = $2 AND target = $3 AND revoked_at IS NULL AND expires_at > CURRENT_TIMESTAMP;", grantFields)
+	return queryGrants(ctx, query, user, relation, target)
+}
+
+func findActiveDelegations(ctx context.Context) ([]*models.Grant, error) {
+	query := fmt.Sprintf("SELECT %s FROM grants WHERE revoked_at IS NULL AND delegated = true AND expires_at > CURRENT_TIMESTAMP;", grantFields)
+	return queryGrants(ctx, query)
+}
+
+func queryGrants(ctx context.Context, query string, args ...any) (ans []*models.Grant, err error) {
+	rows, err := permissionsDb.Query(ctx, query, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var g *models.Grant
+		if g, err = scanGrant(rows); err != nil {
+			return
+		}
+		ans = append(ans, g)
+	}
+	err = rows.Err()
+	return
+}
+
+type grantScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanGrant(row grantScanner) (*models.Grant, error) {
+	g := new(models.Grant)
+	if err := row.Scan(&g.Id, &g.UserId, &g.Relation, &g.Target, &g.ExpiresAt, &g.GrantedBy, &g.Delegated, &g.Reason, &g.CreatedAt, &g.RevokedAt); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+func grantsToDto(grants ...*models.Grant) (ans []dto.Grant) {
+	ans = make([]dto.Grant, 0, len(grants))
+	for _, g := range grants {
+		tmp := dto.Grant{
+			Id:        g.Id,
+			User:      g.UserId,
+			Relation:  dto.PermissionName(g.Relation),
+			Target:    g.Target,
+			ExpiresAt: g.ExpiresAt,
+			GrantedBy: g.GrantedBy,
+			Delegated: g.Delegated,
+			CreatedAt: g.CreatedAt,
+		}
+		if g.Reason.Valid {
+			tmp.Reason = &g.Reason.String
+		}
+		if g.RevokedAt.Valid {
+			tmp.RevokedAt = &g.RevokedAt.Time
+		}
+		ans = append(ans, tmp)
+	}
+	return
+}
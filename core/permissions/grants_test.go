@@ -0,0 +1,58 @@
+package permissions
+
+import (
+	"testing"
+	"time"
+
+	openfga "github.com/openfga/go-sdk"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCapDelegationExpiry(t *testing.T) {
+	now := time.Now()
+	requested := now.Add(48 * time.Hour)
+
+	// Delegators holding the relation past the requested expiry are not limited.
+	ans, ok := capDelegationExpiry(requested, true)
+	assert.True(t, ok)
+	assert.Equal(t, requested, ans)
+
+	// Delegators holding the relation through grants are limited to their latest grant.
+	ans, ok = capDelegationExpiry(requested, false, now.Add(time.Hour), now.Add(24*time.Hour))
+	assert.True(t, ok)
+	assert.Equal(t, now.Add(24*time.Hour), ans)
+
+	// Grants outliving the requested expiry leave it untouched.
+	ans, ok = capDelegationExpiry(requested, false, now.Add(72*time.Hour))
+	assert.True(t, ok)
+	assert.Equal(t, requested, ans)
+
+	// Access ending before the expiry through some other means cannot be delegated.
+	_, ok = capDelegationExpiry(requested, false)
+	assert.False(t, ok)
+}
+
+func grantTuple(expiresAt string) openfga.TupleKey {
+	context := map[string]any{"expires_at": expiresAt}
+	return openfga.TupleKey{
+		User:      "user:1",
+		Relation:  "medical_viewer",
+		Object:    "studentRecord:2",
+		Condition: &openfga.RelationshipCondition{Name: grantCondition, Context: &context},
+	}
+}
+
+func TestTupleExpired(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+	assert.True(t, tupleExpired(grantTuple("2026-10-19T11:00:00Z"), now))
+	assert.True(t, tupleExpired(grantTuple("2026-10-19T12:00:00Z"), now))
+	assert.False(t, tupleExpired(grantTuple("2026-10-19T13:00:00Z"), now))
+	assert.False(t, tupleExpired(grantTuple("not a date"), now))
+
+	// Tuples not written by grants never expire.
+	assert.False(t, tupleExpired(openfga.TupleKey{User: "user:1", Relation: "member", Object: "institution:1"}, now))
+	other := grantTuple("2026-10-19T11:00:00Z")
+	other.Condition.Name = "when_visible"
+	assert.False(t, tupleExpired(other, now))
+}
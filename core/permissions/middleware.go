@@ -0,0 +1,48 @@
+package permissions
+
+import (
+	"encore.dev/beta/auth"
+	"encore.dev/middleware"
+	"encore.dev/rlog"
+	"github.com/brinestone/scholaris/dto"
+	"github.com/brinestone/scholaris/util"
+)
+
+// Verifies whether the user is allowed to explain permission checks.
+//
+//encore:middleware target=tag:can_explain_permissions
+func (s *Service) CanExplainPermissions(req middleware.Request, next middleware.Next) middleware.Response {
+	return s.checkPlatformPermission(req, next, dto.PNCanExplainPermissions)
+}
+
+// Verifies whether the user is allowed to manage authorization models.
+//
+//encore:middleware target=tag:can_manage_authorization_models
+func (s *Service) CanManageAuthorizationModels(req middleware.Request, next middleware.Next) middleware.Response {
+	return s.checkPlatformPermission(req, next, dto.PNCanManageAuthorizationModels)
+}
+
+func (s *Service) checkPlatformPermission(req middleware.Request, next middleware.Next, permission dto.PermissionName) middleware.Response {
+	uid, authed := auth.UserID()
+	if !authed {
+		return middleware.Response{
+			Err: &util.ErrUnauthorized,
+		}
+	}
+
+	res, err := s.doPermissionCheck(req.Context(), dto.IdentifierString(dto.PTUser, uid), permission, dto.IdentifierString(dto.PTPlatform, dto.PlatformId), nil)
+	if err != nil {
+		rlog.Error(util.MsgCallError, "err", err)
+		return middleware.Response{
+			Err: &util.ErrUnknown,
+		}
+	}
+
+	if !res.Allowed {
+		return middleware.Response{
+			Err: &util.ErrForbidden,
+		}
+	}
+
+	return next(req)
+}
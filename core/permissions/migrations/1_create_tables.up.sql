@@ -0,0 +1,20 @@
+CREATE TABLE
+    authorization_models (
+        id BIGSERIAL PRIMARY KEY,
+        model_id TEXT NOT NULL,
+        hash VARCHAR(64) NOT NULL,
+        environment TEXT NOT NULL,
+        active BOOLEAN DEFAULT false,
+        created_at TIMESTAMP WITHOUT TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+        activated_at TIMESTAMP WITHOUT TIME ZONE,
+        UNIQUE (environment, hash)
+    );
+
+CREATE TABLE
+    tuple_migrations (
+        id TEXT NOT NULL,
+        environment TEXT NOT NULL,
+        rewritten INT DEFAULT 0,
+        applied_at TIMESTAMP WITHOUT TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+        PRIMARY KEY (id, environment)
+    );
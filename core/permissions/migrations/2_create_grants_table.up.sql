@@ -0,0 +1,17 @@
+CREATE TABLE
+    grants (
+        id BIGSERIAL PRIMARY KEY,
+        user_id BIGINT NOT NULL,
+        relation TEXT NOT NULL,
+        target TEXT NOT NULL,
+        expires_at TIMESTAMP WITHOUT TIME ZONE NOT NULL,
+        granted_by BIGINT NOT NULL,
+        delegated BOOLEAN DEFAULT false,
+        reason TEXT,
+        created_at TIMESTAMP WITHOUT TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+        revoked_at TIMESTAMP WITHOUT TIME ZONE
+    );
+
+CREATE INDEX idx_grants_target ON grants (target);
+
+CREATE INDEX idx_grants_active_expiry ON grants (expires_at) WHERE revoked_at IS NULL;
@@ -0,0 +1,104 @@
+package permissions
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"strings"
+
+	"encore.dev/rlog"
+	"github.com/brinestone/scholaris/dto"
+	"github.com/brinestone/scholaris/helpers"
+	"github.com/openfga/go-sdk/client"
+)
+
+// Reconciles the platform's admins with the user IDs of the optional PlatformAdmins config. Nothing else grants
+// platform:scholaris#admin, so this is how the first admins are bootstrapped. An empty config leaves the admins as is.
+func (s *Service) syncPlatformAdmins(ctx context.Context) (err error) {
+	if len(strings.TrimSpace(cfg.PlatformAdmins)) == 0 {
+		return
+	}
+
+	current, err := s.readPlatformAdmins(ctx)
+	if err != nil {
+		return
+	}
+
+	writes, deletes := platformAdminChanges(current, cfg.PlatformAdmins)
+	if len(writes) == 0 && len(deletes) == 0 {
+		return
+	}
+
+	platform := dto.IdentifierString(dto.PTPlatform, dto.PlatformId)
+	toUpdates := func(users []string) []dto.PermissionUpdate {
+		return helpers.SliceMap(users, func(u string) dto.PermissionUpdate {
+			return dto.PermissionUpdate{Actor: u, Relation: dto.PNAdmin, Target: platform}
+		})
+	}
+
+	if err = s.ReplacePermissions(ctx, dto.ReplacePermissionsRequest{
+		Writes:  toUpdates(writes),
+		Deletes: toUpdates(deletes),
+	}); err != nil {
+		return
+	}
+	rlog.Info("platform admins synced", "granted", writes, "revoked", deletes)
+	return
+}
+
+func (s *Service) readPlatformAdmins(ctx context.Context) (ans []string, err error) {
+	relation := string(dto.PNAdmin)
+	object := dto.IdentifierString(dto.PTPlatform, dto.PlatformId)
+	var continuationToken string
+
+	for {
+		options := client.ClientReadOptions{}
+		if len(continuationToken) > 0 {
+			options.ContinuationToken = &continuationToken
+		}
+
+		var res *client.ClientReadResponse
+		if res, err = s.fgaClient.Read(ctx).
+			Body(client.ClientReadRequest{Relation: &relation, Object: &object}).
+			Options(options).
+			Execute(); err != nil {
+			return
+		}
+
+		for _, t := range res.Tuples {
+			ans = append(ans, t.Key.User)
+		}
+
+		if continuationToken = res.ContinuationToken; len(continuationToken) == 0 {
+			return
+		}
+	}
+}
+
+// Computes the admin tuples to write and delete so that the admins match the configured comma-separated user IDs.
+// Invalid IDs are ignored.
+func platformAdminChanges(current []string, configured string) (writes, deletes []string) {
+	desired := make([]string, 0)
+	for _, raw := range strings.Split(configured, ",") {
+		id, err := strconv.ParseUint(strings.TrimSpace(raw), 10, 64)
+		if err != nil {
+			continue
+		}
+		user := dto.IdentifierString(dto.PTUser, id)
+		if !slices.Contains(desired, user) {
+			desired = append(desired, user)
+		}
+	}
+
+	for _, u := range desired {
+		if !slices.Contains(current, u) {
+			writes = append(writes, u)
+		}
+	}
+	for _, u := range current {
+		if !slices.Contains(desired, u) {
+			deletes = append(deletes, u)
+		}
+	}
+	return
+}
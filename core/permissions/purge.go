@@ -0,0 +1,69 @@
+package permissions
+
+import (
+	"context"
+
+	"encore.dev/rlog"
+	"github.com/brinestone/scholaris/dto"
+	"github.com/brinestone/scholaris/helpers"
+	"github.com/brinestone/scholaris/util"
+	openfga "github.com/openfga/go-sdk"
+	"github.com/openfga/go-sdk/client"
+)
+
+// Deletes every tuple relating to the given objects. Used when the objects themselves are deleted.
+//
+//encore:api private method=POST path=/permissions/objects/purge
+func (s *Service) PurgeObjectTuples(ctx context.Context, req dto.PurgeObjectTuplesRequest) (ans *dto.PurgeResponse, err error) {
+	ans = new(dto.PurgeResponse)
+
+	for _, object := range req.Objects {
+		var updates []dto.PermissionUpdate
+		if updates, err = s.readObjectTuples(ctx, object); err != nil {
+			rlog.Error(util.MsgCallError, "err", err)
+			err = &util.ErrUnknown
+			return
+		}
+
+		for i := 0; i < len(updates); i += tupleMigrationBatchSize {
+			batch := updates[i:min(i+tupleMigrationBatchSize, len(updates))]
+			if err = s.DeletePermissions(ctx, dto.UpdatePermissionsRequest{Updates: batch}); err != nil {
+				rlog.Error(util.MsgCallError, "err", err)
+				err = &util.ErrUnknown
+				return
+			}
+			ans.Deleted += uint(len(batch))
+		}
+	}
+	return
+}
+
+func (s *Service) readObjectTuples(ctx context.Context, object string) (ans []dto.PermissionUpdate, err error) {
+	var continuationToken string
+	pageSize := int32(100)
+
+	for {
+		options := client.ClientReadOptions{PageSize: &pageSize}
+		if len(continuationToken) > 0 {
+			options.ContinuationToken = &continuationToken
+		}
+
+		var res *client.ClientReadResponse
+		res, err = s.fgaClient.Read(ctx).
+			Body(client.ClientReadRequest{Object: &object}).
+			Options(options).
+			Execute()
+		if err != nil {
+			return
+		}
+
+		ans = append(ans, helpers.SliceMap(res.Tuples, func(t openfga.Tuple) dto.PermissionUpdate {
+			return dto.NewPermissionUpdate[string](t.Key.User, dto.PermissionName(t.Key.Relation), t.Key.Object)
+		})...)
+
+		if continuationToken = res.ContinuationToken; len(continuationToken) == 0 {
+			break
+		}
+	}
+	return
+}
@@ -0,0 +1,353 @@
+package permissions
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"encore.dev"
+	"encore.dev/rlog"
+	"encore.dev/storage/sqldb"
+	"github.com/brinestone/scholaris/dto"
+	"github.com/brinestone/scholaris/util"
+	openfga "github.com/openfga/go-sdk"
+	"github.com/openfga/go-sdk/client"
+	"gopkg.in/yaml.v3"
+)
+
+// The compiled form of the modules listed in fga.mod. Regenerate it with `make fga_model`.
+//
+//go:embed authorization-model.json
+var authorizationModel []byte
+
+//go:embed tuple-migrations.yml
+var tupleMigrationsSpec []byte
+
+const tupleMigrationBatchSize = 50
+
+type TupleMigration struct {
+	Id   string `yaml:"id"`
+	Type string `yaml:"type"`
+	From string `yaml:"from"`
+	To   string `yaml:"to"`
+}
+
+type TupleMigrations struct {
+	Migrations []TupleMigration `yaml:"migrations"`
+}
+
+// Lists the authorization models deployed to the current environment and the tuple migrations applied to it
+//
+//encore:api auth method=GET path=/permissions/models tag:can_manage_authorization_models
+func (s *Service) ListAuthorizationModels(ctx context.Context) (ans *dto.AuthorizationModelsResponse, err error) {
+	environment := encore.Meta().Environment.Name
+	ans = &dto.AuthorizationModelsResponse{
+		Models:     make([]dto.AuthorizationModelEntry, 0),
+		Migrations: make([]dto.TupleMigrationEntry, 0),
+	}
+
+	rows, err := permissionsDb.Query(ctx, `
+		SELECT
+			model_id, hash, environment, active, created_at, activated_at
+		FROM
+			authorization_models
+		WHERE
+			environment = $1
+		ORDER BY
+			created_at DESC;
+	`, environment)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry dto.AuthorizationModelEntry
+		var activatedAt sql.NullTime
+		if err = rows.Scan(&entry.ModelId, &entry.Hash, &entry.Environment, &entry.Active, &entry.CreatedAt, &activatedAt); err != nil {
+			rlog.Error(util.MsgDbAccessError, "err", err)
+			err = &util.ErrUnknown
+			return
+		}
+		if activatedAt.Valid {
+			entry.ActivatedAt = &activatedAt.Time
+		}
+		ans.Models = append(ans.Models, entry)
+	}
+
+	migrationRows, err := permissionsDb.Query(ctx, "SELECT id, rewritten, applied_at FROM tuple_migrations WHERE environment = $1 ORDER BY applied_at DESC;", environment)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+	defer migrationRows.Close()
+
+	for migrationRows.Next() {
+		var entry dto.TupleMigrationEntry
+		if err = migrationRows.Scan(&entry.Id, &entry.Rewritten, &entry.AppliedAt); err != nil {
+			rlog.Error(util.MsgDbAccessError, "err", err)
+			err = &util.ErrUnknown
+			return
+		}
+		ans.Migrations = append(ans.Migrations, entry)
+	}
+	return
+}
+
+// Deploys the embedded authorization model if it changed, applies pending tuple migrations and pins the client to the
+// model once everything is committed. A failure leaves the previously active model in place.
+func (s *Service) syncAuthorizationModel(ctx context.Context) (err error) {
+	environment := encore.Meta().Environment.Name
+	sum := sha256.Sum256(authorizationModel)
+	hash := hex.EncodeToString(sum[:])
+
+	modelId, err := s.deployAuthorizationModel(ctx, environment, hash)
+	if err != nil {
+		return
+	}
+
+	tx, err := permissionsDb.Begin(ctx)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	// Serializes deployments when several instances start at once.
+	if _, err = tx.Exec(ctx, "SELECT pg_advisory_xact_lock(hashtext('authorization_models'));"); err != nil {
+		return
+	}
+
+	if err = s.applyTupleMigrations(ctx, tx, environment, modelId); err != nil {
+		return
+	}
+
+	if err = activateAuthorizationModel(ctx, tx, environment, hash); err != nil {
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		return
+	}
+
+	err = s.fgaClient.SetAuthorizationModelId(modelId)
+	return
+}
+
+// Writes the embedded model to the store unless a model with the same hash was already written, and records it
+// before anything else can fail so that a later start reuses it instead of writing a duplicate.
+func (s *Service) deployAuthorizationModel(ctx context.Context, environment, hash string) (ans string, err error) {
+	tx, err := permissionsDb.Begin(ctx)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.Exec(ctx, "SELECT pg_advisory_xact_lock(hashtext('authorization_models'));"); err != nil {
+		return
+	}
+
+	ans, err = findAuthorizationModelId(ctx, tx, environment, hash)
+	if err == nil || !errors.Is(err, sqldb.ErrNoRows) {
+		return
+	}
+
+	if ans, err = s.writeAuthorizationModel(ctx); err != nil {
+		return
+	}
+	if _, err = tx.Exec(ctx, "INSERT INTO authorization_models(model_id, hash, environment) VALUES ($1,$2,$3);", ans, hash, environment); err != nil {
+		return
+	}
+	if err = tx.Commit(); err != nil {
+		return
+	}
+	rlog.Info("authorization model deployed", "modelId", ans, "hash", hash)
+	return
+}
+
+func (s *Service) writeAuthorizationModel(ctx context.Context) (ans string, err error) {
+	var body openfga.WriteAuthorizationModelRequest
+	if err = json.Unmarshal(authorizationModel, &body); err != nil {
+		return
+	}
+
+	res, err := s.fgaClient.WriteAuthorizationModel(ctx).
+		Body(body).
+		Execute()
+	if err != nil {
+		return
+	}
+
+	ans = res.AuthorizationModelId
+	return
+}
+
+func findAuthorizationModelId(ctx context.Context, tx *sqldb.Tx, environment, hash string) (ans string, err error) {
+	err = tx.QueryRow(ctx, "SELECT model_id FROM authorization_models WHERE environment = $1 AND hash = $2;", environment, hash).Scan(&ans)
+	return
+}
+
+func activateAuthorizationModel(ctx context.Context, tx *sqldb.Tx, environment, hash string) (err error) {
+	query := `
+		UPDATE authorization_models
+		SET
+			active = hash = $2,
+			activated_at = CASE
+				WHEN hash = $2 AND NOT active THEN CURRENT_TIMESTAMP
+				ELSE activated_at
+			END
+		WHERE
+			environment = $1;
+	`
+	_, err = tx.Exec(ctx, query, environment, hash)
+	return
+}
+
+func (s *Service) applyTupleMigrations(ctx context.Context, tx *sqldb.Tx, environment, modelId string) (err error) {
+	var spec TupleMigrations
+	if err = yaml.Unmarshal(tupleMigrationsSpec, &spec); err != nil {
+		return
+	}
+
+	var model openfga.WriteAuthorizationModelRequest
+	if err = json.Unmarshal(authorizationModel, &model); err != nil {
+		return
+	}
+
+	if err = validateTupleMigrations(spec, model); err != nil {
+		return
+	}
+
+	for _, m := range spec.Migrations {
+		var applied bool
+		if err = tx.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM tuple_migrations WHERE id = $1 AND environment = $2);", m.Id, environment).Scan(&applied); err != nil {
+			return
+		} else if applied {
+			continue
+		}
+
+		var rewritten uint
+		if rewritten, err = s.rewriteTuples(ctx, m, modelId); err != nil {
+			err = fmt.Errorf("tuple migration %s: %w", m.Id, err)
+			return
+		}
+
+		if _, err = tx.Exec(ctx, "INSERT INTO tuple_migrations(id, environment, rewritten) VALUES ($1,$2,$3);", m.Id, environment, rewritten); err != nil {
+			return
+		}
+		rlog.Info("tuple migration applied", "id", m.Id, "rewritten", rewritten)
+
+		if rewritten > 0 {
+			if err := invalidateCheckTags(ctx, globalCheckTag); err != nil {
+				rlog.Error(util.MsgCacheAccessError, "err", err)
+			}
+		}
+	}
+	return
+}
+
+// Rejects migrations that could not be applied to the model, before any tuple is touched.
+func validateTupleMigrations(spec TupleMigrations, model openfga.WriteAuthorizationModelRequest) error {
+	seen := make(map[string]bool)
+	for _, m := range spec.Migrations {
+		if len(m.Id) == 0 || seen[m.Id] {
+			return fmt.Errorf("tuple migration %q: missing or duplicate id", m.Id)
+		}
+		seen[m.Id] = true
+
+		if len(m.From) == 0 || m.From == m.To {
+			return fmt.Errorf("tuple migration %s: invalid source relation %q", m.Id, m.From)
+		}
+
+		idx := slices.IndexFunc(model.TypeDefinitions, func(t openfga.TypeDefinition) bool { return t.Type == m.Type })
+		if idx < 0 {
+			return fmt.Errorf("tuple migration %s: unknown type %q", m.Id, m.Type)
+		}
+
+		relations := model.TypeDefinitions[idx].GetRelations()
+		if _, ok := relations[m.To]; !ok {
+			return fmt.Errorf("tuple migration %s: relation %q is not defined on %q", m.Id, m.To, m.Type)
+		}
+	}
+	return nil
+}
+
+// Moves every tuple of the migration's type from the old relation to the new one, keeping its condition. The store is
+// read one page at a time and each page's matches are rewritten before the next page is read. A rewrite interrupted
+// midway is resumed by the next run as the moved tuples no longer match.
+func (s *Service) rewriteTuples(ctx context.Context, m TupleMigration, modelId string) (ans uint, err error) {
+	var continuationToken string
+	pageSize := int32(100)
+
+	for {
+		options := client.ClientReadOptions{PageSize: &pageSize}
+		if len(continuationToken) > 0 {
+			options.ContinuationToken = &continuationToken
+		}
+
+		var res *client.ClientReadResponse
+		res, err = s.fgaClient.Read(ctx).
+			Body(client.ClientReadRequest{}).
+			Options(options).
+			Execute()
+		if err != nil {
+			return
+		}
+
+		matches := make([]openfga.TupleKey, 0)
+		for _, t := range res.Tuples {
+			if t.Key.Relation == m.From && strings.HasPrefix(t.Key.Object, m.Type+":") {
+				matches = append(matches, t.Key)
+			}
+		}
+
+		var rewritten uint
+		if rewritten, err = s.writeTupleMigrationBatches(ctx, m, modelId, matches); err != nil {
+			return
+		}
+		ans += rewritten
+
+		if continuationToken = res.ContinuationToken; len(continuationToken) == 0 {
+			return
+		}
+	}
+}
+
+func (s *Service) writeTupleMigrationBatches(ctx context.Context, m TupleMigration, modelId string, matches []openfga.TupleKey) (ans uint, err error) {
+	for i := 0; i < len(matches); i += tupleMigrationBatchSize {
+		batch := matches[i:min(i+tupleMigrationBatchSize, len(matches))]
+		body := client.ClientWriteRequest{}
+		for _, t := range batch {
+			body.Writes = append(body.Writes, client.ClientTupleKey{
+				User:      t.User,
+				Relation:  m.To,
+				Object:    t.Object,
+				Condition: t.Condition,
+			})
+			body.Deletes = append(body.Deletes, client.ClientTupleKeyWithoutCondition{
+				User:     t.User,
+				Relation: t.Relation,
+				Object:   t.Object,
+			})
+		}
+
+		// The new relation only exists in the model being deployed, which is not pinned yet.
+		if _, err = s.fgaClient.Write(ctx).
+			Body(body).
+			Options(client.ClientWriteOptions{AuthorizationModelId: &modelId}).
+			Execute(); err != nil {
+			return
+		}
+		ans += uint(len(batch))
+	}
+	return
+}
@@ -0,0 +1,75 @@
+package permissions
+
+import (
+	"encoding/json"
+	"testing"
+
+	openfga "github.com/openfga/go-sdk"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func embeddedModel(t *testing.T) (ans openfga.WriteAuthorizationModelRequest) {
+	if err := json.Unmarshal(authorizationModel, &ans); err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+// Every userset of the embedded model must survive decoding, otherwise the deployed model silently loses relations.
+func TestEmbeddedModelDecodesEveryUserset(t *testing.T) {
+	var walk func(path string, u openfga.Userset)
+	walk = func(path string, u openfga.Userset) {
+		switch {
+		case u.This != nil, u.ComputedUserset != nil, u.TupleToUserset != nil:
+		case u.Union != nil:
+			for _, c := range u.Union.Child {
+				walk(path, c)
+			}
+		case u.Intersection != nil:
+			for _, c := range u.Intersection.Child {
+				walk(path, c)
+			}
+		case u.Difference != nil:
+			walk(path, u.Difference.Base)
+			walk(path, u.Difference.Subtract)
+		default:
+			t.Errorf("%s decodes to an empty userset", path)
+		}
+	}
+
+	for _, td := range embeddedModel(t).TypeDefinitions {
+		for relation, u := range td.GetRelations() {
+			walk(td.Type+"#"+relation, u)
+		}
+	}
+}
+
+func TestEmbeddedTupleMigrationsAreValid(t *testing.T) {
+	var spec TupleMigrations
+	if err := yaml.Unmarshal(tupleMigrationsSpec, &spec); err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, validateTupleMigrations(spec, embeddedModel(t)))
+}
+
+func TestValidateTupleMigrations(t *testing.T) {
+	model := embeddedModel(t)
+
+	cases := map[string]TupleMigration{
+		"unknown type":       {Id: "a", Type: "spaceship", From: "pilot", To: "captain"},
+		"unknown relation":   {Id: "a", Type: "institution", From: "viewer", To: "spectator"},
+		"missing source":     {Id: "a", Type: "institution", To: "member"},
+		"identical relation": {Id: "a", Type: "institution", From: "member", To: "member"},
+		"missing id":         {Type: "institution", From: "viewer", To: "member"},
+	}
+	for name, m := range cases {
+		t.Run(name, func(t *testing.T) {
+			assert.NotNil(t, validateTupleMigrations(TupleMigrations{Migrations: []TupleMigration{m}}, model))
+		})
+	}
+
+	valid := TupleMigration{Id: "a", Type: "institution", From: "viewer", To: "member"}
+	assert.Nil(t, validateTupleMigrations(TupleMigrations{Migrations: []TupleMigration{valid}}, model))
+	assert.NotNil(t, validateTupleMigrations(TupleMigrations{Migrations: []TupleMigration{valid, valid}}, model))
+}
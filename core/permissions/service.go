@@ -3,6 +3,8 @@ package permissions
 import (
 	"context"
 	"errors"
+	"fmt"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -57,9 +59,21 @@ func initService() (*Service, error) {
 		return nil, err
 	}
 
-	return &Service{
+	s := &Service{
 		fgaClient: fgaClient,
-	}, nil
+	}
+
+	// Serving checks against an unknown model could grant or deny access unexpectedly, so the service refuses to start.
+	if err = s.syncAuthorizationModel(context.Background()); err != nil {
+		rlog.Error("could not sync the authorization model", "err", err)
+		return nil, fmt.Errorf("sync authorization model: %w", err)
+	}
+
+	if err = s.syncPlatformAdmins(context.Background()); err != nil {
+		rlog.Error("could not sync the platform admins", "err", err)
+	}
+
+	return s, nil
 }
 
 // List Objects with valid relations
@@ -67,36 +81,63 @@ func initService() (*Service, error) {
 // encore:api auth method=POST path=/permissions/related
 func (s *Service) ListRelations(ctx context.Context, req dto.ListRelationsRequest) (ans dto.ListRelationsResponse, err error) {
 	uid, _ := auth.UserID()
-	cacheKey := relationsCacheKey(uid, req.Target, req.Permissions...)
-	ans, err = relationsCache.Get(ctx, cacheKey)
-	if errors.Is(err, cache.Miss) {
-		body := client.ClientListRelationsRequest{
-			User:      dto.IdentifierString(dto.PTUser, uid),
-			Relations: req.Permissions,
-			Object:    req.Target,
-		}
+	actor := dto.IdentifierString(dto.PTUser, uid)
+	ans.Relations = make([]string, 0)
+
+	keys, err := checkCacheKeys(ctx, actor, req.Target, req.Permissions...)
+	if err != nil {
+		rlog.Error(util.MsgCacheAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
 
-		var res *client.ClientListRelationsResponse
-		res, err = s.fgaClient.ListRelations(ctx).
-			Body(body).
-			Execute()
-		if err != nil {
-			rlog.Error(util.MsgCallError, "err", err)
+	cacheKeys := make(map[string]string)
+	misses := make([]string, 0)
+	for i, relation := range req.Permissions {
+		key := keys[i]
+		cacheKeys[relation] = key
+
+		var cached dto.RelationCheckResponse
+		if cached, err = checkCache.Get(ctx, key); errors.Is(err, cache.Miss) {
+			misses = append(misses, relation)
+			continue
+		} else if err != nil {
+			rlog.Error(util.MsgCacheAccessError, "err", err)
 			err = &util.ErrUnknown
 			return
 		}
 
-		ans.Relations = res.Relations
-		defer func() {
-			if err := relationsCache.Set(ctx, cacheKey, ans); err != nil {
-				rlog.Error(util.MsgCacheAccessError, "err", err, "value", ans)
-			}
-		}()
-	} else if err != nil {
-		rlog.Error(util.MsgCacheAccessError, "err", err)
+		if cached.Allowed {
+			ans.Relations = append(ans.Relations, relation)
+		}
+	}
+	err = nil
+
+	if len(misses) == 0 {
+		return
+	}
+
+	res, err := s.fgaClient.ListRelations(ctx).
+		Body(client.ClientListRelationsRequest{
+			User:      actor,
+			Relations: misses,
+			Object:    req.Target,
+			Context:   checkContext(),
+		}).
+		Execute()
+	if err != nil {
+		rlog.Error(util.MsgCallError, "err", err)
 		err = &util.ErrUnknown
 		return
 	}
+
+	ans.Relations = append(ans.Relations, res.Relations...)
+	for _, relation := range misses {
+		allowed := slices.Contains(res.Relations, relation)
+		if err := checkCache.Set(ctx, cacheKeys[relation], dto.RelationCheckResponse{Allowed: allowed}); err != nil {
+			rlog.Error(util.MsgCacheAccessError, "err", err)
+		}
+	}
 	return
 }
 
@@ -108,10 +149,7 @@ func (s *Service) ListObjectsInternal(ctx context.Context, req dto.ListObjectsRe
 		User:     req.Actor,
 		Relation: string(req.Relation),
 		Type:     string(req.Type),
-	}
-
-	if len(req.Context) > 0 {
-		reqBody.Context = contextEntriesToMap(req.Context...)
+		Context:  checkContext(req.Context...),
 	}
 
 	data, err := s.fgaClient.ListObjects(ctx).
@@ -135,6 +173,94 @@ func (s *Service) ListObjectsInternal(ctx context.Context, req dto.ListObjectsRe
 	}, nil
 }
 
+// Lists the users with a relation to an object (Internal API)
+//
+//encore:api private method=POST path=/permissions/users/internal
+func (s *Service) ListUsersInternal(ctx context.Context, req dto.ListUsersRequest) (ans *dto.ListUsersResponse, err error) {
+	objectType, objectId, _ := strings.Cut(req.Target, ":")
+	data, err := s.fgaClient.ListUsers(ctx).
+		Body(client.ClientListUsersRequest{
+			Object:      openfga.FgaObject{Type: objectType, Id: objectId},
+			Relation:    string(req.Relation),
+			UserFilters: []openfga.UserTypeFilter{{Type: string(dto.PTUser)}},
+			Context:     checkContext(req.Context...),
+		}).
+		Execute()
+	if err != nil {
+		return
+	}
+
+	ans = &dto.ListUsersResponse{
+		Users: make([]uint64, 0),
+	}
+	for _, u := range data.GetUsers() {
+		if u.Object == nil {
+			continue
+		}
+		if id, err := strconv.ParseUint(u.Object.Id, 10, 64); err == nil {
+			ans.Users = append(ans.Users, id)
+		}
+	}
+	return
+}
+
+// Filters candidate objects down to those the actor is related to (Internal API)
+//
+//encore:api private method=POST path=/permissions/filter/internal
+func (s *Service) FilterObjectsInternal(ctx context.Context, req dto.FilterObjectsRequest) (ans *dto.FilterObjectsResponse, err error) {
+	allowed := make(map[uint64]bool)
+	targets := helpers.SliceMap(req.Ids, func(id uint64) string { return dto.IdentifierString(req.Type, id) })
+	cacheKeys, cached, err := cachedChecks(ctx, req.Actor, string(req.Relation), targets)
+	if err != nil {
+		return
+	}
+
+	misses := make([]client.ClientCheckRequest, 0)
+	for i, id := range req.Ids {
+		if c, ok := cached[targets[i]]; ok {
+			allowed[id] = c.Allowed
+			continue
+		}
+		misses = append(misses, client.ClientCheckRequest{
+			User:     req.Actor,
+			Relation: string(req.Relation),
+			Object:   targets[i],
+			Context:  checkContext(),
+		})
+	}
+
+	if len(misses) > 0 {
+		var res *client.ClientBatchCheckResponse
+		if res, err = s.fgaClient.BatchCheck(ctx).Body(misses).Execute(); err != nil {
+			return
+		}
+
+		for _, r := range *res {
+			if r.Error != nil {
+				err = r.Error
+				return
+			}
+
+			_, rawId, _ := strings.Cut(r.Request.Object, ":")
+			id, _ := strconv.ParseUint(rawId, 10, 64)
+			allowed[id] = r.GetAllowed()
+			if err := checkCache.Set(ctx, cacheKeys[r.Request.Object], dto.RelationCheckResponse{Allowed: allowed[id]}); err != nil {
+				rlog.Error(util.MsgCacheAccessError, "err", err)
+			}
+		}
+	}
+
+	ans = &dto.FilterObjectsResponse{
+		Allowed: make([]uint64, 0),
+	}
+	for _, id := range req.Ids {
+		if allowed[id] {
+			ans.Allowed = append(ans.Allowed, id)
+		}
+	}
+	return
+}
+
 // Checks whether a permission is valid or not
 //
 //encore:api auth method=POST path=/permissions/check
@@ -150,6 +276,7 @@ func (s *Service) CheckPermission(ctx context.Context, req dto.BatchRelationChec
 				User:     actor,
 				Relation: c.Relation,
 				Object:   c.Target,
+				Context:  checkContext(),
 			}
 		})).
 		Execute()
@@ -187,6 +314,7 @@ func (s *Service) DeletePermissions(ctx context.Context, req dto.UpdatePermissio
 	}).Execute(); err != nil {
 		return err
 	}
+	s.invalidateChangedTuples(ctx, req.Updates, true)
 	return nil
 }
 
@@ -199,9 +327,66 @@ func (s *Service) SetPermissions(ctx context.Context, req dto.UpdatePermissionsR
 	}).Execute(); err != nil {
 		return err
 	}
+	s.invalidateChangedTuples(ctx, req.Updates, false)
 	return nil
 }
 
+// Writes and deletes permission Tuples in a single atomic write
+//
+//encore:api private method=POST path=/permissions/replace
+func (s *Service) ReplacePermissions(ctx context.Context, req dto.ReplacePermissionsRequest) error {
+	req, err := s.pendingReplacement(ctx, req)
+	if err != nil {
+		return err
+	}
+	if len(req.Writes) == 0 && len(req.Deletes) == 0 {
+		return nil
+	}
+
+	if _, err := s.fgaClient.Write(ctx).Body(client.ClientWriteRequest{
+		Writes:  toOpenFgaWrites(req.Writes),
+		Deletes: toOpenFgaDeletes(req.Deletes),
+	}).Execute(); err != nil {
+		return err
+	}
+	if len(req.Writes) > 0 {
+		s.invalidateChangedTuples(ctx, req.Writes, false)
+	}
+	if len(req.Deletes) > 0 {
+		s.invalidateChangedTuples(ctx, req.Deletes, true)
+	}
+	return nil
+}
+
+// Drops the deletes of tuples which do not exist and the writes of tuples which already exist, as either makes the
+// whole write fail. Existing tuples are matched regardless of their condition.
+func (s *Service) pendingReplacement(ctx context.Context, req dto.ReplacePermissionsRequest) (ans dto.ReplacePermissionsRequest, err error) {
+	exists := func(u dto.PermissionUpdate) (bool, error) {
+		return s.tupleExists(ctx, u.Actor, u.Relation, u.Target)
+	}
+
+	if ans.Writes, err = filterUpdates(req.Writes, exists, false); err != nil {
+		return
+	}
+	ans.Deletes, err = filterUpdates(req.Deletes, exists, true)
+	return
+}
+
+// Keeps the updates whose tuples exist when existing is true, or do not exist otherwise.
+func filterUpdates(updates []dto.PermissionUpdate, exists func(dto.PermissionUpdate) (bool, error), existing bool) (ans []dto.PermissionUpdate, err error) {
+	ans = make([]dto.PermissionUpdate, 0, len(updates))
+	for _, u := range updates {
+		var found bool
+		if found, err = exists(u); err != nil {
+			return
+		}
+		if found == existing {
+			ans = append(ans, u)
+		}
+	}
+	return
+}
+
 func toOpenFgaDeletes(updates []dto.PermissionUpdate) []openfga.TupleKeyWithoutCondition {
 	ans := make([]client.ClientTupleKeyWithoutCondition, 0)
 
@@ -244,6 +429,15 @@ func toOpenFgaWrites(updates []dto.PermissionUpdate) []openfga.TupleKey {
 	return ans
 }
 
+// Builds the context sent along checks. The current time is always provided as time-bound grants are conditioned on it.
+func checkContext(entries ...dto.ContextEntry) (ans *map[string]any) {
+	ans = contextEntriesToMap(entries...)
+	if _, ok := (*ans)["current_time"]; !ok {
+		(*ans)["current_time"] = time.Now().UTC().Format(time.RFC3339)
+	}
+	return
+}
+
 func contextEntriesToMap(entries ...dto.ContextEntry) (ans *map[string]any) {
 	ans = &map[string]any{}
 	c := *ans
@@ -259,6 +453,12 @@ func contextEntriesToMap(entries ...dto.ContextEntry) (ans *map[string]any) {
 				continue
 			}
 			c[v.Name] = t.String()
+		case dto.CETInt:
+			c[v.Name], _ = strconv.ParseInt(v.Value, 10, 64)
+		case dto.CETUint:
+			c[v.Name], _ = strconv.ParseUint(v.Value, 10, 64)
+		case dto.CETDouble:
+			c[v.Name], _ = strconv.ParseFloat(v.Value, 64)
 		default:
 			c[v.Name] = v.Value
 		}
@@ -267,6 +467,36 @@ func contextEntriesToMap(entries ...dto.ContextEntry) (ans *map[string]any) {
 }
 
 func (s *Service) doPermissionCheck(ctx context.Context, actor string, relation dto.PermissionName, target string, condition *dto.RelationCondition) (ans *dto.RelationCheckResponse, err error) {
+	// Conditional checks depend on request-specific context (e.g. the current time) and are not worth caching.
+	if condition != nil {
+		return s.doUncachedPermissionCheck(ctx, actor, relation, target, condition)
+	}
+
+	cacheKey, err := checkCacheKey(ctx, actor, string(relation), target)
+	if err != nil {
+		rlog.Error(util.MsgCacheAccessError, "err", err)
+		return s.doUncachedPermissionCheck(ctx, actor, relation, target, nil)
+	}
+
+	cached, err := checkCache.Get(ctx, cacheKey)
+	if err == nil {
+		ans = &cached
+		return
+	} else if !errors.Is(err, cache.Miss) {
+		rlog.Error(util.MsgCacheAccessError, "err", err)
+	}
+
+	if ans, err = s.doUncachedPermissionCheck(ctx, actor, relation, target, nil); err != nil {
+		return
+	}
+
+	if err := checkCache.Set(ctx, cacheKey, *ans); err != nil {
+		rlog.Error(util.MsgCacheAccessError, "err", err)
+	}
+	return
+}
+
+func (s *Service) doUncachedPermissionCheck(ctx context.Context, actor string, relation dto.PermissionName, target string, condition *dto.RelationCondition) (ans *dto.RelationCheckResponse, err error) {
 	request := client.ClientCheckRequest{
 		User:     actor,
 		Relation: string(relation),
@@ -274,7 +504,9 @@ func (s *Service) doPermissionCheck(ctx context.Context, actor string, relation
 	}
 
 	if condition != nil {
-		request.Context = contextEntriesToMap(condition.Context...)
+		request.Context = checkContext(condition.Context...)
+	} else {
+		request.Context = checkContext()
 	}
 
 	res, err := s.fgaClient.
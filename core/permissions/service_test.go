@@ -0,0 +1,24 @@
+package permissions
+
+import (
+	"testing"
+
+	"github.com/brinestone/scholaris/dto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilterUpdates(t *testing.T) {
+	present := dto.PermissionUpdate{Actor: "user:1", Relation: dto.PNAdmin, Target: "tenant:1"}
+	missing := dto.PermissionUpdate{Actor: "user:2", Relation: dto.PNAdmin, Target: "tenant:1"}
+	exists := func(u dto.PermissionUpdate) (bool, error) {
+		return u == present, nil
+	}
+
+	deletes, err := filterUpdates([]dto.PermissionUpdate{present, missing}, exists, true)
+	assert.Nil(t, err)
+	assert.Equal(t, []dto.PermissionUpdate{present}, deletes)
+
+	writes, err := filterUpdates([]dto.PermissionUpdate{present, missing}, exists, false)
+	assert.Nil(t, err)
+	assert.Equal(t, []dto.PermissionUpdate{missing}, writes)
+}
@@ -0,0 +1,22 @@
+package pkg
+
+import (
+	"time"
+
+	"encore.dev/beta/auth"
+	"encore.dev/pubsub"
+)
+
+// Published once an institution and its records are gone, so that the services owning data on its behalf can clean
+// it up. It lives here rather than in the institutions service, which depends on those services.
+type InstitutionDeleted struct {
+	Id        uint64
+	Tenant    uint64
+	Slug      string
+	DeletedBy auth.UID
+	Timestamp time.Time
+}
+
+var DeletedInstitutions = pubsub.NewTopic[*InstitutionDeleted]("institution-deleted", pubsub.TopicConfig{
+	DeliveryGuarantee: pubsub.AtLeastOnce,
+})
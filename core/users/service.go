@@ -68,9 +68,17 @@ func DeleteInternal(ctx context.Context, id uint64) (err error) {
 		err = &util.ErrUnknown
 		return
 	}
-	tx.Commit()
+	defer tx.Rollback()
 
 	if err = deleteUserAccount(ctx, tx, id); err != nil {
+		rlog.Error(util.MsgDbAccessError, "msg", err.Error())
+		err = &util.ErrUnknown
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		rlog.Error(util.MsgDbAccessError, "msg", err.Error())
+		err = &util.ErrUnknown
 		return
 	}
 
@@ -229,6 +237,17 @@ func FindUserById(ctx context.Context, id uint64) (*models.User, error) {
 	return user, err
 }
 
+// Find a user by one of their email addresses (internal API)
+//
+//encore:api private method=GET path=/users/email/:email
+func FindUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	user, err := findUserByEmailFromDb(ctx, email)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		return nil, &util.ErrNotFound
+	}
+	return user, err
+}
+
 type FindUserByExternalIdResponse struct {
 	AccountIndex int
 	User         models.User
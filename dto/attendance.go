@@ -0,0 +1,164 @@
+package dto
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"encore.dev/beta/errs"
+)
+
+type AttendanceStatus string
+
+const (
+	ASPresent AttendanceStatus = "present"
+	ASAbsent  AttendanceStatus = "absent"
+	ASLate    AttendanceStatus = "late"
+	ASExcused AttendanceStatus = "excused"
+)
+
+var attendanceStatuses = []AttendanceStatus{ASPresent, ASAbsent, ASLate, ASExcused}
+
+type AttendanceEntry struct {
+	// The student record
+	Student uint64           `json:"student"`
+	Status  AttendanceStatus `json:"status"`
+	Note    *string          `json:"note,omitempty" encore:"optional"`
+}
+
+// Records the attendance of a class for a day, or for one of the day's periods. Recording the same day and period again
+// updates the records of the students it mentions.
+type RecordAttendanceRequest struct {
+	Date time.Time `json:"date"`
+	// The period of the day, starting at 1. The attendance is taken for the whole day when absent.
+	Period *int `json:"period,omitempty" encore:"optional"`
+	// The course taught during the period
+	Course  *uint64           `json:"course,omitempty" encore:"optional"`
+	Records []AttendanceEntry `json:"records"`
+}
+
+func (r RecordAttendanceRequest) Validate() error {
+	msgs := make([]string, 0)
+
+	if r.Date.IsZero() {
+		msgs = append(msgs, "The date field is required")
+	}
+
+	if r.Period != nil && *r.Period <= 0 {
+		msgs = append(msgs, "The period field must be greater than 0")
+	}
+
+	if r.Course != nil && r.Period == nil {
+		msgs = append(msgs, "The course field is only allowed along with the period field")
+	}
+
+	if len(r.Records) == 0 {
+		msgs = append(msgs, "At least one record is required")
+	}
+
+	seen := make(map[uint64]bool)
+	for i, rec := range r.Records {
+		if rec.Student == 0 {
+			msgs = append(msgs, fmt.Sprintf("The student field of record %d is required", i+1))
+		} else if seen[rec.Student] {
+			msgs = append(msgs, fmt.Sprintf("The student of record %d appears more than once", i+1))
+		}
+		seen[rec.Student] = true
+
+		if !slices.Contains(attendanceStatuses, rec.Status) {
+			msgs = append(msgs, fmt.Sprintf("Invalid value for the status field of record %d", i+1))
+		}
+
+		if rec.Note != nil && len(*rec.Note) > 255 {
+			msgs = append(msgs, fmt.Sprintf("The note field of record %d cannot be longer than 255 characters", i+1))
+		}
+	}
+
+	if len(msgs) > 0 {
+		return &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: strings.Join(msgs, "\n"),
+		}
+	}
+	return nil
+}
+
+type AttendanceRecord struct {
+	Student    uint64           `json:"student"`
+	Status     AttendanceStatus `json:"status"`
+	Note       *string          `json:"note,omitempty" encore:"optional"`
+	RecordedBy uint64           `json:"recordedBy"`
+	RecordedAt time.Time        `json:"recordedAt"`
+}
+
+type AttendanceSession struct {
+	Id           uint64    `json:"id"`
+	Class        uint64    `json:"class"`
+	AcademicTerm uint64    `json:"academicTerm"`
+	Date         time.Time `json:"date"`
+	// Absent for the attendance of the whole day
+	Period    *int               `json:"period,omitempty" encore:"optional"`
+	Course    *uint64            `json:"course,omitempty" encore:"optional"`
+	TakenBy   uint64             `json:"takenBy"`
+	Records   []AttendanceRecord `json:"records"`
+	CreatedAt time.Time          `json:"createdAt"`
+	UpdatedAt time.Time          `json:"updatedAt"`
+}
+
+type FindClassAttendanceRequest struct {
+	// The day to list the attendance of, today when absent
+	Date time.Time `query:"date"`
+}
+
+type ClassAttendanceResponse struct {
+	Sessions []AttendanceSession `json:"sessions"`
+}
+
+type FindTermAttendanceRequest struct {
+	AcademicTerm uint64 `query:"term"`
+}
+
+func (f FindTermAttendanceRequest) Validate() error {
+	if f.AcademicTerm == 0 {
+		return &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: "The term parameter is required",
+		}
+	}
+	return nil
+}
+
+// The attendance of a student over a term
+type AttendanceSummary struct {
+	Student      uint64 `json:"student"`
+	AcademicTerm uint64 `json:"academicTerm"`
+	// The number of records of each status
+	Present uint `json:"present"`
+	Absent  uint `json:"absent"`
+	Late    uint `json:"late"`
+	Excused uint `json:"excused"`
+	// The number of days the student was absent without an excuse, at least once
+	DaysAbsent uint `json:"daysAbsent"`
+}
+
+type AttendanceSummariesResponse struct {
+	Summaries []AttendanceSummary `json:"summaries"`
+}
+
+type StudentAttendance struct {
+	Session    uint64           `json:"session"`
+	Class      uint64           `json:"class"`
+	Date       time.Time        `json:"date"`
+	Period     *int             `json:"period,omitempty" encore:"optional"`
+	Course     *uint64          `json:"course,omitempty" encore:"optional"`
+	Status     AttendanceStatus `json:"status"`
+	Note       *string          `json:"note,omitempty" encore:"optional"`
+	RecordedBy uint64           `json:"recordedBy"`
+	RecordedAt time.Time        `json:"recordedAt"`
+}
+
+type StudentAttendanceResponse struct {
+	Summary AttendanceSummary   `json:"summary"`
+	Records []StudentAttendance `json:"records"`
+}
@@ -5,6 +5,9 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
+
+	"encore.dev/beta/errs"
 )
 
 type UploadRequest struct {
@@ -64,3 +67,61 @@ func (u UploadRequest) Validate() (err error) {
 	}
 	return
 }
+
+type FindUploadsRequest struct {
+	Keys []string `json:"keys"`
+}
+
+type UploadInfo struct {
+	Key        string    `json:"key"`
+	Name       string    `json:"name"`
+	MimeType   string    `json:"mimeType"`
+	Size       int64     `json:"size"`
+	UploadedBy uint64    `json:"uploadedBy"`
+	UploadedAt time.Time `json:"uploadedAt"`
+	Owner      *uint64   `json:"owner,omitempty" encore:"optional"`
+	OwnerType  *string   `json:"ownerType,omitempty" encore:"optional"`
+}
+
+type FindUploadsResponse struct {
+	Uploads []UploadInfo `json:"uploads"`
+}
+
+// A file generated by a service on behalf of an institution or a tenant, to be stored as a shared file
+type StoreSharedFileRequest struct {
+	Owner     uint64         `json:"owner"`
+	OwnerType PermissionType `json:"ownerType"`
+	Name      string         `json:"name"`
+	MimeType  string         `json:"mimeType"`
+	Content   []byte         `json:"content"`
+	// The user on whose behalf the file is stored
+	UploadedBy uint64 `json:"uploadedBy"`
+}
+
+func (s StoreSharedFileRequest) Validate() error {
+	var msgs []string
+	if s.Owner == 0 || (s.OwnerType != PTInstitution && s.OwnerType != PTTenant) {
+		msgs = append(msgs, "Invalid owner")
+	}
+	if len(strings.TrimSpace(s.Name)) == 0 {
+		msgs = append(msgs, "The name field is required")
+	}
+	if len(s.MimeType) == 0 {
+		msgs = append(msgs, "The mimeType field is required")
+	}
+	if len(s.Content) == 0 {
+		msgs = append(msgs, "The file is empty")
+	}
+
+	if len(msgs) > 0 {
+		return &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: strings.Join(msgs, "\n"),
+		}
+	}
+	return nil
+}
+
+type DeleteUploadsRequest struct {
+	Keys []string `json:"keys"`
+}
@@ -0,0 +1,218 @@
+package dto
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"encore.dev/beta/errs"
+)
+
+type CalendarEventCategory string
+
+const (
+	CECExam     CalendarEventCategory = "exam"
+	CECHoliday  CalendarEventCategory = "holiday"
+	CECBreak    CalendarEventCategory = "break"
+	CECMeeting  CalendarEventCategory = "meeting"
+	CECActivity CalendarEventCategory = "activity"
+	CECOther    CalendarEventCategory = "other"
+)
+
+var calendarEventCategories = []CalendarEventCategory{CECExam, CECHoliday, CECBreak, CECMeeting, CECActivity, CECOther}
+
+// Who an event is meant for
+type CalendarAudience string
+
+const (
+	CAAll   CalendarAudience = "all"
+	CAStaff CalendarAudience = "staff"
+	CALevel CalendarAudience = "level"
+	CAClass CalendarAudience = "class"
+)
+
+// Who can see an event besides its audience
+type CalendarVisibility string
+
+const (
+	// Anyone, including visitors who are not members of the institution
+	CVPublic CalendarVisibility = "public"
+	// The members of the institution in the event's audience
+	CVMembers CalendarVisibility = "members"
+)
+
+type RecurrenceFrequency string
+
+const (
+	RFDaily   RecurrenceFrequency = "daily"
+	RFWeekly  RecurrenceFrequency = "weekly"
+	RFMonthly RecurrenceFrequency = "monthly"
+	RFYearly  RecurrenceFrequency = "yearly"
+)
+
+type Recurrence struct {
+	Frequency RecurrenceFrequency `json:"frequency"`
+	// The number of frequency units between occurrences, 1 when absent
+	Interval int `json:"interval,omitempty" encore:"optional"`
+	// The total number of occurrences
+	Count *int `json:"count,omitempty" encore:"optional"`
+	// The time after which the event no longer occurs
+	Until *time.Time `json:"until,omitempty" encore:"optional"`
+}
+
+type CalendarOccurrence struct {
+	StartsAt time.Time `json:"startsAt"`
+	EndsAt   time.Time `json:"endsAt"`
+}
+
+type CalendarEvent struct {
+	Id           uint64                `json:"id"`
+	Institution  uint64                `json:"institution"`
+	AcademicYear *uint64               `json:"academicYear,omitempty" encore:"optional"`
+	AcademicTerm *uint64               `json:"academicTerm,omitempty" encore:"optional"`
+	Title        string                `json:"title"`
+	Description  *string               `json:"description,omitempty" encore:"optional"`
+	Location     *string               `json:"location,omitempty" encore:"optional"`
+	Category     CalendarEventCategory `json:"category"`
+	StartsAt     time.Time             `json:"startsAt"`
+	EndsAt       time.Time             `json:"endsAt"`
+	AllDay       bool                  `json:"allDay"`
+	Recurrence   *Recurrence           `json:"recurrence,omitempty" encore:"optional"`
+	Audience     CalendarAudience      `json:"audience"`
+	// The level or class the event is meant for
+	AudienceRef *uint64            `json:"audienceRef,omitempty" encore:"optional"`
+	Visibility  CalendarVisibility `json:"visibility"`
+	CreatedBy   uint64             `json:"createdBy"`
+	CreatedAt   time.Time          `json:"createdAt"`
+	UpdatedAt   time.Time          `json:"updatedAt"`
+	// The occurrences of the event within the requested range
+	Occurrences []CalendarOccurrence `json:"occurrences,omitempty" encore:"optional"`
+}
+
+type CalendarEventRequest struct {
+	AcademicYear *uint64               `json:"academicYear,omitempty" encore:"optional"`
+	AcademicTerm *uint64               `json:"academicTerm,omitempty" encore:"optional"`
+	Title        string                `json:"title"`
+	Description  *string               `json:"description,omitempty" encore:"optional"`
+	Location     *string               `json:"location,omitempty" encore:"optional"`
+	Category     CalendarEventCategory `json:"category"`
+	StartsAt     time.Time             `json:"startsAt"`
+	EndsAt       time.Time             `json:"endsAt"`
+	AllDay       bool                  `json:"allDay"`
+	Recurrence   *Recurrence           `json:"recurrence,omitempty" encore:"optional"`
+	Audience     CalendarAudience      `json:"audience"`
+	AudienceRef  *uint64               `json:"audienceRef,omitempty" encore:"optional"`
+	Visibility   CalendarVisibility    `json:"visibility"`
+}
+
+func (c CalendarEventRequest) Validate() error {
+	msgs := make([]string, 0)
+
+	if len(strings.TrimSpace(c.Title)) == 0 {
+		msgs = append(msgs, "The title field is required")
+	} else if len(c.Title) > 255 {
+		msgs = append(msgs, "The title field cannot be longer than 255 characters")
+	}
+
+	if c.Description != nil && len(*c.Description) > 2000 {
+		msgs = append(msgs, "The description field cannot be longer than 2000 characters")
+	}
+
+	if c.Location != nil && len(*c.Location) > 255 {
+		msgs = append(msgs, "The location field cannot be longer than 255 characters")
+	}
+
+	if !slices.Contains(calendarEventCategories, c.Category) {
+		msgs = append(msgs, "Invalid value for the category field")
+	}
+
+	if c.StartsAt.IsZero() || c.EndsAt.IsZero() {
+		msgs = append(msgs, "The startsAt and endsAt fields are required")
+	} else if c.EndsAt.Before(c.StartsAt) {
+		msgs = append(msgs, "The event cannot end before it starts")
+	}
+
+	if c.AcademicTerm != nil && c.AcademicYear == nil {
+		msgs = append(msgs, "The academicYear field is required when academicTerm is set")
+	}
+
+	switch c.Audience {
+	case CAAll, CAStaff:
+		if c.AudienceRef != nil {
+			msgs = append(msgs, "The audienceRef field is only allowed for level and class audiences")
+		}
+	case CALevel, CAClass:
+		if c.AudienceRef == nil || *c.AudienceRef == 0 {
+			msgs = append(msgs, "The audienceRef field is required for level and class audiences")
+		}
+	default:
+		msgs = append(msgs, "Invalid value for the audience field")
+	}
+
+	if c.Visibility != CVPublic && c.Visibility != CVMembers {
+		msgs = append(msgs, "Invalid value for the visibility field")
+	}
+
+	if r := c.Recurrence; r != nil {
+		switch r.Frequency {
+		case RFDaily, RFWeekly, RFMonthly, RFYearly:
+		default:
+			msgs = append(msgs, "Invalid value for the recurrence frequency")
+		}
+
+		if r.Interval < 0 {
+			msgs = append(msgs, "The recurrence interval cannot be negative")
+		}
+
+		if r.Count != nil && *r.Count < 1 {
+			msgs = append(msgs, "The recurrence count must be at least 1")
+		}
+
+		if r.Until != nil && r.Until.Before(c.StartsAt) {
+			msgs = append(msgs, "The recurrence cannot end before the event starts")
+		}
+	}
+
+	if len(msgs) > 0 {
+		return &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: strings.Join(msgs, "\n"),
+		}
+	}
+	return nil
+}
+
+type FindCalendarEventsRequest struct {
+	// The start of the range, a month ago when absent
+	From time.Time `query:"from"`
+	// The end of the range, a year after its start when absent
+	To           time.Time `query:"to"`
+	AcademicYear uint64    `query:"year"`
+	AcademicTerm uint64    `query:"term"`
+}
+
+func (f FindCalendarEventsRequest) Validate() error {
+	if !f.From.IsZero() && !f.To.IsZero() {
+		if f.To.Before(f.From) {
+			return &errs.Error{
+				Code:    errs.InvalidArgument,
+				Message: "The range cannot end before it starts",
+			}
+		} else if f.To.Sub(f.From) > 2*366*24*time.Hour {
+			return &errs.Error{
+				Code:    errs.InvalidArgument,
+				Message: "The range cannot be longer than two years",
+			}
+		}
+	}
+	return nil
+}
+
+type CalendarEventsResponse struct {
+	Events []CalendarEvent `json:"events"`
+}
+
+type CalendarFeed struct {
+	// The iCalendar subscription URL. Anyone holding it can read the feed until it is rotated.
+	Url string `json:"url"`
+}
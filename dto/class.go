@@ -0,0 +1,198 @@
+package dto
+
+import (
+	"strings"
+	"time"
+
+	"encore.dev/beta/errs"
+)
+
+// The reasons a student leaves a class
+type PlacementRemovalReason string
+
+const (
+	PRRTransferred PlacementRemovalReason = "transferred"
+	PRRWithdrawn   PlacementRemovalReason = "withdrawn"
+	PRRGraduated   PlacementRemovalReason = "graduated"
+)
+
+type Class struct {
+	Id           uint64  `json:"id"`
+	Institution  uint64  `json:"institution"`
+	Level        uint64  `json:"level"`
+	AcademicYear uint64  `json:"academicYear"`
+	Name         string  `json:"name"`
+	Stream       *string `json:"stream,omitempty" encore:"optional"`
+	// The number of students the class can take, unlimited when absent
+	Capacity        *int      `json:"capacity,omitempty" encore:"optional"`
+	HomeroomTeacher *uint64   `json:"homeroomTeacher,omitempty" encore:"optional"`
+	Students        uint      `json:"students"`
+	CreatedAt       time.Time `json:"createdAt"`
+	UpdatedAt       time.Time `json:"updatedAt"`
+}
+
+type NewClassRequest struct {
+	Level           uint64  `json:"level"`
+	AcademicYear    uint64  `json:"academicYear"`
+	Name            string  `json:"name"`
+	Stream          *string `json:"stream,omitempty" encore:"optional"`
+	Capacity        *int    `json:"capacity,omitempty" encore:"optional"`
+	HomeroomTeacher *uint64 `json:"homeroomTeacher,omitempty" encore:"optional"`
+}
+
+func (n NewClassRequest) Validate() error {
+	msgs := validateClassFields(&n.Name, n.Stream, n.Capacity)
+
+	if n.Level == 0 {
+		msgs = append(msgs, "The level field is required")
+	}
+
+	if n.AcademicYear == 0 {
+		msgs = append(msgs, "The academicYear field is required")
+	}
+
+	if len(msgs) > 0 {
+		return &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: strings.Join(msgs, "\n"),
+		}
+	}
+	return nil
+}
+
+type UpdateClassRequest struct {
+	Name   *string `json:"name,omitempty" encore:"optional"`
+	Stream *string `json:"stream,omitempty" encore:"optional"`
+	// Set to 0 to remove the capacity limit
+	Capacity *int `json:"capacity,omitempty" encore:"optional"`
+	// Set to 0 to remove the homeroom teacher
+	HomeroomTeacher *uint64 `json:"homeroomTeacher,omitempty" encore:"optional"`
+}
+
+func (u UpdateClassRequest) Validate() error {
+	msgs := make([]string, 0)
+
+	if u.Name == nil && u.Stream == nil && u.Capacity == nil && u.HomeroomTeacher == nil {
+		msgs = append(msgs, "At least one field must be provided")
+	}
+
+	msgs = append(msgs, validateClassFields(u.Name, u.Stream, u.Capacity)...)
+
+	if len(msgs) > 0 {
+		return &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: strings.Join(msgs, "\n"),
+		}
+	}
+	return nil
+}
+
+type FindClassesRequest struct {
+	AcademicYear uint64 `query:"year"`
+	Level        uint64 `query:"level"`
+}
+
+type ClassesResponse struct {
+	Classes []Class `json:"classes"`
+}
+
+type ClassTeacherRequest struct {
+	Teacher uint64 `json:"teacher"`
+}
+
+func (c ClassTeacherRequest) Validate() error {
+	if c.Teacher == 0 {
+		return &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: "The teacher field is required",
+		}
+	}
+	return nil
+}
+
+type ClassTeachersResponse struct {
+	HomeroomTeacher *uint64  `json:"homeroomTeacher,omitempty" encore:"optional"`
+	Teachers        []uint64 `json:"teachers"`
+}
+
+type PlaceStudentRequest struct {
+	// The student record placed in the class
+	Student uint64 `json:"student"`
+}
+
+func (p PlaceStudentRequest) Validate() error {
+	if p.Student == 0 {
+		return &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: "The student field is required",
+		}
+	}
+	return nil
+}
+
+type TransferStudentRequest struct {
+	// The class the student is moved to. It must belong to the same academic year.
+	To     uint64  `json:"to"`
+	Reason *string `json:"reason,omitempty" encore:"optional"`
+}
+
+func (t TransferStudentRequest) Validate() error {
+	msgs := make([]string, 0)
+
+	if t.To == 0 {
+		msgs = append(msgs, "The to field is required")
+	}
+
+	if t.Reason != nil && len(*t.Reason) > 255 {
+		msgs = append(msgs, "The reason field cannot be longer than 255 characters")
+	}
+
+	if len(msgs) > 0 {
+		return &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: strings.Join(msgs, "\n"),
+		}
+	}
+	return nil
+}
+
+type ClassPlacement struct {
+	Id           uint64 `json:"id"`
+	Class        uint64 `json:"class"`
+	AcademicYear uint64 `json:"academicYear"`
+	// The student record placed in the class
+	Student       uint64                  `json:"student"`
+	PlacedBy      uint64                  `json:"placedBy"`
+	PlacedAt      time.Time               `json:"placedAt"`
+	RemovedAt     *time.Time              `json:"removedAt,omitempty" encore:"optional"`
+	RemovedBy     *uint64                 `json:"removedBy,omitempty" encore:"optional"`
+	RemovalReason *PlacementRemovalReason `json:"removalReason,omitempty" encore:"optional"`
+	RemovalNote   *string                 `json:"removalNote,omitempty" encore:"optional"`
+	TransferredTo *uint64                 `json:"transferredTo,omitempty" encore:"optional"`
+}
+
+type FindClassStudentsRequest struct {
+	// Includes the students who left the class
+	IncludeRemoved bool `query:"removed"`
+}
+
+type ClassPlacementsResponse struct {
+	Placements []ClassPlacement `json:"placements"`
+}
+
+func validateClassFields(name, stream *string, capacity *int) (msgs []string) {
+	if name != nil && len(strings.TrimSpace(*name)) == 0 {
+		msgs = append(msgs, "The name field is required")
+	} else if name != nil && len(*name) > 50 {
+		msgs = append(msgs, "The name field cannot be longer than 50 characters")
+	}
+
+	if stream != nil && len(*stream) > 50 {
+		msgs = append(msgs, "The stream field cannot be longer than 50 characters")
+	}
+
+	if capacity != nil && *capacity < 0 {
+		msgs = append(msgs, "The capacity field cannot be negative")
+	}
+	return
+}
@@ -3,6 +3,7 @@ package dto
 import (
 	"errors"
 	"strings"
+	"time"
 )
 
 type NewEnrollmentFormRequest struct {
@@ -85,3 +86,40 @@ func (ne NewEnrollmentRequest) Validate() error {
 	}
 	return nil
 }
+
+type EnrollmentStatus string
+
+const (
+	ESPending  EnrollmentStatus = "pending"
+	ESAccepted EnrollmentStatus = "accepted"
+	ESRejected EnrollmentStatus = "rejected"
+)
+
+type Enrollment struct {
+	Id          uint64           `json:"id"`
+	Institution uint64           `json:"institution"`
+	Responder   uint64           `json:"responder"`
+	Status      EnrollmentStatus `json:"status"`
+	// The user who accepted or rejected the enrollment
+	DecidedBy      *uint64    `json:"decidedBy,omitempty" encore:"optional"`
+	DecisionReason *string    `json:"decisionReason,omitempty" encore:"optional"`
+	DecidedAt      *time.Time `json:"decidedAt,omitempty" encore:"optional"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	UpdatedAt      time.Time  `json:"updatedAt"`
+}
+
+type EnrollmentDecisionRequest struct {
+	Reason *string `json:"reason,omitempty" encore:"optional"`
+}
+
+// Requires a reason for the rejection of an enrollment
+type EnrollmentRejectionRequest struct {
+	Reason string `json:"reason"`
+}
+
+func (e EnrollmentRejectionRequest) Validate() error {
+	if len(strings.TrimSpace(e.Reason)) == 0 {
+		return errors.New("The reason field is required")
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package dto
+
+import (
+	"path"
+	"time"
+
+	"encore.dev/beta/errs"
+)
+
+// Identifies the data owned by a set of owners of the same type, for bulk export
+type ExportOwnedRequest struct {
+	OwnerType PermissionType
+	Owners    []uint64
+	// The prefix of the uploads bucket under which the exported files are staged
+	Prefix string
+}
+
+// Builds the key under which an exported file is staged
+func (e ExportOwnedRequest) StagingKey(file string) string {
+	return path.Join(e.Prefix, file)
+}
+
+// A small file returned inline and written into an export archive as is
+type ExportedFile struct {
+	Path    string
+	Content []byte
+}
+
+// An object copied into an export archive
+type ExportedObject struct {
+	// The object's key in the uploads bucket
+	Key  string
+	Path string
+}
+
+// The exported data of a service. Records which grow with the tenant are staged in the uploads bucket rather than
+// returned, so that large tenants are never held in memory. Only bounded records, such as a tenant's profile, are
+// returned as files.
+type ExportResponse struct {
+	Files   []ExportedFile
+	Objects []ExportedObject
+}
+
+// Records a file staged for the export
+func (e *ExportResponse) Stage(key, file string) {
+	e.Objects = append(e.Objects, ExportedObject{Key: key, Path: file})
+}
+
+// Adds the files and objects of another response under the given directory
+func (e *ExportResponse) Include(dir string, other *ExportResponse) {
+	if other == nil {
+		return
+	}
+	for _, f := range other.Files {
+		e.Files = append(e.Files, ExportedFile{Path: path.Join(dir, f.Path), Content: f.Content})
+	}
+	for _, o := range other.Objects {
+		e.Objects = append(e.Objects, ExportedObject{Key: o.Key, Path: path.Join(dir, o.Path)})
+	}
+}
+
+type TenantExportStatus string
+
+const (
+	TESPending    TenantExportStatus = "pending"
+	TESInProgress TenantExportStatus = "in_progress"
+	TESCompleted  TenantExportStatus = "completed"
+	TESFailed     TenantExportStatus = "failed"
+	TESExpired    TenantExportStatus = "expired"
+)
+
+type NewTenantExportRequest struct {
+	Tenant uint64 `json:"tenant"`
+}
+
+func (n NewTenantExportRequest) Validate() error {
+	if n.Tenant == 0 {
+		return &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: "The tenant field is required",
+		}
+	}
+	return nil
+}
+
+type TenantExport struct {
+	Id          uint64             `json:"id"`
+	Tenant      uint64             `json:"tenant"`
+	Status      TenantExportStatus `json:"status"`
+	RequestedBy uint64             `json:"requestedBy"`
+	// The percentage of the export's steps which are complete
+	Progress    uint       `json:"progress"`
+	CurrentStep *string    `json:"currentStep,omitempty" encore:"optional"`
+	Error       *string    `json:"error,omitempty" encore:"optional"`
+	Size        *int64     `json:"size,omitempty" encore:"optional"`
+	DownloadUrl *string    `json:"downloadUrl,omitempty" encore:"optional"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	StartedAt   *time.Time `json:"startedAt,omitempty" encore:"optional"`
+	CompletedAt *time.Time `json:"completedAt,omitempty" encore:"optional"`
+	// The archive can be downloaded until this moment
+	ExpiresAt *time.Time `json:"expiresAt,omitempty" encore:"optional"`
+}
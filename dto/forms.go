@@ -322,6 +322,12 @@ type FormQuestionGroup struct {
 
 type GetFormsResponse struct {
 	Forms []FormConfig `json:"forms"`
+	// The total number of viewable forms
+	Total uint `json:"total"`
+	// Whether another page follows this one
+	HasMore bool `json:"hasMore"`
+	// The cursor of the next page, absent on the last page
+	Next uint64 `json:"next,omitempty" encore:"optional"`
 }
 
 type GetFormQuestionsResponse struct {
@@ -330,8 +336,10 @@ type GetFormQuestionsResponse struct {
 }
 
 type FindFormsRequest struct {
-	Page      int    `query:"page"`
-	Size      int    `query:"size"`
+	// The zero-based page to return, used when no cursor is given
+	Page      uint   `query:"page" encore:"optional"`
+	After     uint64 `query:"after" encore:"optional"`
+	Size      uint   `query:"size" encore:"optional"`
 	Owner     uint64 `header:"x-owner"`
 	OwnerType string `header:"x-owner-type"`
 }
@@ -380,6 +388,14 @@ func (n NewFormInput) GetCaptchaToken() string {
 	return n.CaptchaToken
 }
 
+func (n NewFormInput) GetOwner() uint64 {
+	return n.Owner
+}
+
+func (n NewFormInput) GetOwnerType() string {
+	return n.OwnerType
+}
+
 func (n NewFormInput) Validate() error {
 	var msgs = make([]string, 0)
 
@@ -0,0 +1,452 @@
+package dto
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"encore.dev/beta/errs"
+)
+
+type GradingScale struct {
+	// Absent for the default scale
+	Id           *uint64 `json:"id,omitempty" encore:"optional"`
+	Name         string  `json:"name"`
+	MinScore     float64 `json:"minScore"`
+	MaxScore     float64 `json:"maxScore"`
+	PassingScore float64 `json:"passingScore"`
+	// The number of decimals averages are rounded to
+	Decimals  int        `json:"decimals"`
+	Default   bool       `json:"default"`
+	CreatedAt *time.Time `json:"createdAt,omitempty" encore:"optional"`
+	UpdatedAt *time.Time `json:"updatedAt,omitempty" encore:"optional"`
+}
+
+// The scale of the levels which have none
+var DefaultGradingScale = GradingScale{
+	Name:         "0-20",
+	MinScore:     0,
+	MaxScore:     20,
+	PassingScore: 10,
+	Decimals:     2,
+	Default:      true,
+}
+
+// Converts a fraction of the full marks, between 0 and 1, to a mark on the scale
+func (g GradingScale) Mark(ratio float64) float64 {
+	return g.Round(g.MinScore + ratio*(g.MaxScore-g.MinScore))
+}
+
+func (g GradingScale) Round(v float64) float64 {
+	p := math.Pow10(g.Decimals)
+	return math.Round(v*p) / p
+}
+
+func (g GradingScale) Passed(mark float64) bool {
+	return mark >= g.PassingScore
+}
+
+type NewGradingScaleRequest struct {
+	Name         string  `json:"name"`
+	MinScore     float64 `json:"minScore"`
+	MaxScore     float64 `json:"maxScore"`
+	PassingScore float64 `json:"passingScore"`
+	// Defaults to 2
+	Decimals *int `json:"decimals,omitempty" encore:"optional"`
+}
+
+func (n NewGradingScaleRequest) Validate() error {
+	msgs := make([]string, 0)
+
+	if len(strings.TrimSpace(n.Name)) == 0 {
+		msgs = append(msgs, "The name field is required")
+	} else if len(n.Name) > 50 {
+		msgs = append(msgs, "The name field cannot be longer than 50 characters")
+	}
+
+	if n.MinScore < 0 {
+		msgs = append(msgs, "The minScore field cannot be negative")
+	}
+
+	if n.MaxScore <= n.MinScore {
+		msgs = append(msgs, "The maxScore field must be greater than the minScore field")
+	} else if n.MaxScore > 10000 {
+		msgs = append(msgs, "The maxScore field cannot be greater than 10000")
+	}
+
+	if n.PassingScore < n.MinScore || n.PassingScore > n.MaxScore {
+		msgs = append(msgs, "The passingScore field must be between the minScore and maxScore fields")
+	}
+
+	if n.Decimals != nil && (*n.Decimals < 0 || *n.Decimals > 2) {
+		msgs = append(msgs, "The decimals field must be between 0 and 2")
+	}
+
+	if len(msgs) > 0 {
+		return &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: strings.Join(msgs, "\n"),
+		}
+	}
+	return nil
+}
+
+type GradingScalesResponse struct {
+	Scales []GradingScale `json:"scales"`
+}
+
+type Subject struct {
+	Id          uint64  `json:"id"`
+	Institution uint64  `json:"institution"`
+	Level       uint64  `json:"level"`
+	Name        string  `json:"name"`
+	Code        *string `json:"code,omitempty" encore:"optional"`
+	// The weight of the subject in the general average
+	Coefficient float64 `json:"coefficient"`
+	// The number of periods the subject is taught each week, which timetables are proposed from
+	WeeklyPeriods uint      `json:"weeklyPeriods"`
+	CreatedAt     time.Time `json:"createdAt"`
+	UpdatedAt     time.Time `json:"updatedAt"`
+}
+
+type NewSubjectRequest struct {
+	Name string  `json:"name"`
+	Code *string `json:"code,omitempty" encore:"optional"`
+	// Defaults to 1
+	Coefficient *float64 `json:"coefficient,omitempty" encore:"optional"`
+	// Defaults to 0, leaving the subject out of proposed timetables
+	WeeklyPeriods *uint `json:"weeklyPeriods,omitempty" encore:"optional"`
+}
+
+func (n NewSubjectRequest) Validate() error {
+	msgs := validateSubjectFields(&n.Name, n.Code, n.Coefficient, n.WeeklyPeriods)
+
+	if len(msgs) > 0 {
+		return &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: strings.Join(msgs, "\n"),
+		}
+	}
+	return nil
+}
+
+type UpdateSubjectRequest struct {
+	Name          *string  `json:"name,omitempty" encore:"optional"`
+	Code          *string  `json:"code,omitempty" encore:"optional"`
+	Coefficient   *float64 `json:"coefficient,omitempty" encore:"optional"`
+	WeeklyPeriods *uint    `json:"weeklyPeriods,omitempty" encore:"optional"`
+}
+
+func (u UpdateSubjectRequest) Validate() error {
+	msgs := make([]string, 0)
+
+	if u.Name == nil && u.Code == nil && u.Coefficient == nil && u.WeeklyPeriods == nil {
+		msgs = append(msgs, "At least one field must be provided")
+	}
+
+	msgs = append(msgs, validateSubjectFields(u.Name, u.Code, u.Coefficient, u.WeeklyPeriods)...)
+
+	if len(msgs) > 0 {
+		return &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: strings.Join(msgs, "\n"),
+		}
+	}
+	return nil
+}
+
+type SubjectsResponse struct {
+	Subjects []Subject `json:"subjects"`
+}
+
+type Course struct {
+	Id          uint64    `json:"id"`
+	Class       uint64    `json:"class"`
+	Subject     uint64    `json:"subject"`
+	SubjectName string    `json:"subjectName"`
+	Coefficient float64   `json:"coefficient"`
+	Teacher     *uint64   `json:"teacher,omitempty" encore:"optional"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+type NewCourseRequest struct {
+	Subject uint64  `json:"subject"`
+	Teacher *uint64 `json:"teacher,omitempty" encore:"optional"`
+}
+
+func (n NewCourseRequest) Validate() error {
+	if n.Subject == 0 {
+		return &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: "The subject field is required",
+		}
+	}
+	return nil
+}
+
+type CourseTeacherRequest struct {
+	// Set to 0 to remove the teacher
+	Teacher uint64 `json:"teacher"`
+}
+
+type CoursesResponse struct {
+	Courses []Course `json:"courses"`
+}
+
+type AssessmentKind string
+
+const (
+	AKTest       AssessmentKind = "test"
+	AKExam       AssessmentKind = "exam"
+	AKAssignment AssessmentKind = "assignment"
+	AKOther      AssessmentKind = "other"
+)
+
+var assessmentKinds = []AssessmentKind{AKTest, AKExam, AKAssignment, AKOther}
+
+type Assessment struct {
+	Id           uint64         `json:"id"`
+	Course       uint64         `json:"course"`
+	AcademicTerm uint64         `json:"academicTerm"`
+	Title        string         `json:"title"`
+	Kind         AssessmentKind `json:"kind"`
+	MaxScore     float64        `json:"maxScore"`
+	// The weight of the assessment in the subject's term average
+	Weight float64    `json:"weight"`
+	HeldOn *time.Time `json:"heldOn,omitempty" encore:"optional"`
+	// The number of recorded scores
+	Scores    uint      `json:"scores"`
+	CreatedBy uint64    `json:"createdBy"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type NewAssessmentRequest struct {
+	AcademicTerm uint64          `json:"academicTerm"`
+	Title        string          `json:"title"`
+	Kind         *AssessmentKind `json:"kind,omitempty" encore:"optional"`
+	MaxScore     float64         `json:"maxScore"`
+	// Defaults to 1
+	Weight *float64   `json:"weight,omitempty" encore:"optional"`
+	HeldOn *time.Time `json:"heldOn,omitempty" encore:"optional"`
+}
+
+func (n NewAssessmentRequest) Validate() error {
+	msgs := validateAssessmentFields(&n.Title, n.Kind, &n.MaxScore, n.Weight)
+
+	if n.AcademicTerm == 0 {
+		msgs = append(msgs, "The academicTerm field is required")
+	}
+
+	if len(msgs) > 0 {
+		return &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: strings.Join(msgs, "\n"),
+		}
+	}
+	return nil
+}
+
+type UpdateAssessmentRequest struct {
+	Title *string         `json:"title,omitempty" encore:"optional"`
+	Kind  *AssessmentKind `json:"kind,omitempty" encore:"optional"`
+	// Cannot go below the highest recorded score
+	MaxScore *float64   `json:"maxScore,omitempty" encore:"optional"`
+	Weight   *float64   `json:"weight,omitempty" encore:"optional"`
+	HeldOn   *time.Time `json:"heldOn,omitempty" encore:"optional"`
+}
+
+func (u UpdateAssessmentRequest) Validate() error {
+	msgs := make([]string, 0)
+
+	if u.Title == nil && u.Kind == nil && u.MaxScore == nil && u.Weight == nil && u.HeldOn == nil {
+		msgs = append(msgs, "At least one field must be provided")
+	}
+
+	msgs = append(msgs, validateAssessmentFields(u.Title, u.Kind, u.MaxScore, u.Weight)...)
+
+	if len(msgs) > 0 {
+		return &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: strings.Join(msgs, "\n"),
+		}
+	}
+	return nil
+}
+
+type FindAssessmentsRequest struct {
+	AcademicTerm uint64 `query:"term"`
+}
+
+type AssessmentsResponse struct {
+	Assessments []Assessment `json:"assessments"`
+}
+
+type Score struct {
+	Assessment uint64   `json:"assessment"`
+	Student    uint64   `json:"student"`
+	Score      *float64 `json:"score,omitempty" encore:"optional"`
+	// Absent students without a score are left out of the averages
+	Absent     bool      `json:"absent"`
+	Comment    *string   `json:"comment,omitempty" encore:"optional"`
+	RecordedBy uint64    `json:"recordedBy"`
+	RecordedAt time.Time `json:"recordedAt"`
+}
+
+type ScoreEntry struct {
+	// The student record
+	Student uint64   `json:"student"`
+	Score   *float64 `json:"score,omitempty" encore:"optional"`
+	Absent  bool     `json:"absent"`
+	Comment *string  `json:"comment,omitempty" encore:"optional"`
+}
+
+// Records the scores of an assessment. Entries without a score which are not marked absent clear the student's score.
+type RecordScoresRequest struct {
+	Scores []ScoreEntry `json:"scores"`
+}
+
+func (r RecordScoresRequest) Validate() error {
+	msgs := make([]string, 0)
+
+	if len(r.Scores) == 0 {
+		msgs = append(msgs, "At least one score is required")
+	}
+
+	seen := make(map[uint64]bool)
+	for i, s := range r.Scores {
+		if s.Student == 0 {
+			msgs = append(msgs, fmt.Sprintf("The student field of score %d is required", i+1))
+		} else if seen[s.Student] {
+			msgs = append(msgs, fmt.Sprintf("The student of score %d appears more than once", i+1))
+		}
+		seen[s.Student] = true
+
+		if s.Score != nil && *s.Score < 0 {
+			msgs = append(msgs, fmt.Sprintf("The score field of score %d cannot be negative", i+1))
+		}
+
+		if s.Comment != nil && len(*s.Comment) > 255 {
+			msgs = append(msgs, fmt.Sprintf("The comment field of score %d cannot be longer than 255 characters", i+1))
+		}
+	}
+
+	if len(msgs) > 0 {
+		return &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: strings.Join(msgs, "\n"),
+		}
+	}
+	return nil
+}
+
+type ScoresResponse struct {
+	Scores []Score `json:"scores"`
+}
+
+type SubjectResult struct {
+	Subject     uint64  `json:"subject"`
+	Name        string  `json:"name"`
+	Coefficient float64 `json:"coefficient"`
+	// Absent when the student has no score in the subject
+	Average *float64 `json:"average,omitempty" encore:"optional"`
+	Rank    *int     `json:"rank,omitempty" encore:"optional"`
+}
+
+type StudentResult struct {
+	Student   uint64 `json:"student"`
+	Matricule string `json:"matricule"`
+	FirstName string `json:"firstName"`
+	LastName  string `json:"lastName"`
+	// The average of the subject averages weighted by their coefficients, absent when the student has no score
+	Average  *float64        `json:"average,omitempty" encore:"optional"`
+	Rank     *int            `json:"rank,omitempty" encore:"optional"`
+	Passed   bool            `json:"passed"`
+	Subjects []SubjectResult `json:"subjects"`
+}
+
+// Narrows results down to a term. Results cover the whole academic year otherwise.
+type ClassResultsRequest struct {
+	AcademicTerm uint64 `query:"term"`
+}
+
+type ClassResultsResponse struct {
+	Class        uint64          `json:"class"`
+	AcademicYear uint64          `json:"academicYear"`
+	AcademicTerm *uint64         `json:"academicTerm,omitempty" encore:"optional"`
+	Scale        GradingScale    `json:"scale"`
+	Average      *float64        `json:"average,omitempty" encore:"optional"`
+	Results      []StudentResult `json:"results"`
+}
+
+type StudentResultsRequest struct {
+	AcademicYear uint64 `query:"year"`
+	// Narrows results down to a term. Results cover the whole academic year otherwise.
+	AcademicTerm uint64 `query:"term"`
+}
+
+func (s StudentResultsRequest) Validate() error {
+	if s.AcademicYear == 0 {
+		return &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: "The year parameter is required",
+		}
+	}
+	return nil
+}
+
+type StudentResultsResponse struct {
+	Class        uint64       `json:"class"`
+	AcademicYear uint64       `json:"academicYear"`
+	AcademicTerm *uint64      `json:"academicTerm,omitempty" encore:"optional"`
+	Scale        GradingScale `json:"scale"`
+	// The number of ranked students in the class
+	ClassSize    uint          `json:"classSize"`
+	ClassAverage *float64      `json:"classAverage,omitempty" encore:"optional"`
+	Result       StudentResult `json:"result"`
+}
+
+func validateSubjectFields(name, code *string, coefficient *float64, weeklyPeriods *uint) (msgs []string) {
+	if name != nil && len(strings.TrimSpace(*name)) == 0 {
+		msgs = append(msgs, "The name field is required")
+	} else if name != nil && len(*name) > 100 {
+		msgs = append(msgs, "The name field cannot be longer than 100 characters")
+	}
+
+	if code != nil && len(*code) > 20 {
+		msgs = append(msgs, "The code field cannot be longer than 20 characters")
+	}
+
+	if coefficient != nil && (*coefficient <= 0 || *coefficient > 100) {
+		msgs = append(msgs, "The coefficient field must be greater than 0 and at most 100")
+	}
+
+	if weeklyPeriods != nil && *weeklyPeriods > 60 {
+		msgs = append(msgs, "The weeklyPeriods field cannot be greater than 60")
+	}
+	return
+}
+
+func validateAssessmentFields(title *string, kind *AssessmentKind, maxScore, weight *float64) (msgs []string) {
+	if title != nil && len(strings.TrimSpace(*title)) == 0 {
+		msgs = append(msgs, "The title field is required")
+	} else if title != nil && len(*title) > 100 {
+		msgs = append(msgs, "The title field cannot be longer than 100 characters")
+	}
+
+	if kind != nil && !slices.Contains(assessmentKinds, *kind) {
+		msgs = append(msgs, "Invalid value for the kind field")
+	}
+
+	if maxScore != nil && (*maxScore <= 0 || *maxScore > 10000) {
+		msgs = append(msgs, "The maxScore field must be greater than 0 and at most 10000")
+	}
+
+	if weight != nil && (*weight <= 0 || *weight > 100) {
+		msgs = append(msgs, "The weight field must be greater than 0 and at most 100")
+	}
+	return
+}
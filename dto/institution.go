@@ -19,6 +19,7 @@ const (
 	SKVacationDurations               = "vacationDurations"
 	SKAcademicYearAutoCreation        = "academicYearAutoCreation"
 	SKAcademicYearAutoCreationOffset  = "academicYearAutoCreationOffset"
+	SKAbsenceNotificationThresholds   = "absenceNotificationThresholds"
 )
 
 type AcademicTerm struct {
@@ -100,6 +101,136 @@ func (n NewAcademicYearRequest) Validate() error {
 	return nil
 }
 
+// Where an institution stands in its academic calendar at a point in time
+type AcademicContext struct {
+	Institution uint64 `json:"institution"`
+	// The point in time the context was resolved for
+	Date time.Time     `json:"date"`
+	Year *AcademicYear `json:"academicYear,omitempty" encore:"optional"`
+	Term *AcademicTerm `json:"academicTerm,omitempty" encore:"optional"`
+	// The week of the term the date falls in, starting at 1. 0 outside of terms.
+	Week int `json:"week"`
+	// Whether the date falls between two terms of an academic year
+	Vacation     bool          `json:"vacation"`
+	PreviousTerm *AcademicTerm `json:"previousTerm,omitempty" encore:"optional"`
+	NextTerm     *AcademicTerm `json:"nextTerm,omitempty" encore:"optional"`
+}
+
+type FindAcademicContextRequest struct {
+	// The point in time to resolve the context for, now when absent
+	Date time.Time `query:"date"`
+}
+
+// The kinds of changes made to an academic year
+type AcademicYearChange string
+
+const (
+	AYCTermCreated AcademicYearChange = "term_created"
+	AYCTermUpdated AcademicYearChange = "term_updated"
+	AYCTermDeleted AcademicYearChange = "term_deleted"
+	AYCYearDeleted AcademicYearChange = "year_deleted"
+)
+
+// Data for inserting a term into an existing academic year
+type NewAcademicTermRequest struct {
+	Label     string        `json:"label"`
+	StartDate time.Time     `json:"startDate"`
+	Duration  time.Duration `json:"duration"`
+}
+
+func (n NewAcademicTermRequest) Validate() error {
+	msgs := make([]string, 0)
+
+	if len(strings.TrimSpace(n.Label)) == 0 {
+		msgs = append(msgs, "The label field is required")
+	} else if len(n.Label) > 100 {
+		msgs = append(msgs, "The label field cannot be longer than 100 characters")
+	}
+
+	if n.StartDate.IsZero() {
+		msgs = append(msgs, "The startDate field is required")
+	}
+
+	if n.Duration < time.Hour {
+		msgs = append(msgs, "The duration field must be at least an hour")
+	}
+
+	if len(msgs) > 0 {
+		return &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: strings.Join(msgs, "\n"),
+		}
+	}
+	return nil
+}
+
+// Renames, shifts or resizes an academic term. Absent fields are left unchanged.
+type UpdateAcademicTermRequest struct {
+	Label     *string        `json:"label,omitempty" encore:"optional"`
+	StartDate *time.Time     `json:"startDate,omitempty" encore:"optional"`
+	Duration  *time.Duration `json:"duration,omitempty" encore:"optional"`
+}
+
+func (u UpdateAcademicTermRequest) Validate() error {
+	msgs := make([]string, 0)
+
+	if u.Label == nil && u.StartDate == nil && u.Duration == nil {
+		msgs = append(msgs, "At least one of the label, startDate and duration fields is required")
+	}
+
+	if u.Label != nil {
+		if len(strings.TrimSpace(*u.Label)) == 0 {
+			msgs = append(msgs, "The label field cannot be empty")
+		} else if len(*u.Label) > 100 {
+			msgs = append(msgs, "The label field cannot be longer than 100 characters")
+		}
+	}
+
+	if u.StartDate != nil && u.StartDate.IsZero() {
+		msgs = append(msgs, "The startDate field cannot be empty")
+	}
+
+	if u.Duration != nil && *u.Duration < time.Hour {
+		msgs = append(msgs, "The duration field must be at least an hour")
+	}
+
+	if len(msgs) > 0 {
+		return &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: strings.Join(msgs, "\n"),
+		}
+	}
+	return nil
+}
+
+// The outcome of an automatic academic year creation run
+type AcademicYearCreationStatus string
+
+const (
+	AYCSCreated AcademicYearCreationStatus = "created"
+	AYCSSkipped AcademicYearCreationStatus = "skipped"
+	AYCSFailed  AcademicYearCreationStatus = "failed"
+)
+
+type AcademicYearCreationRun struct {
+	Id     uint64                     `json:"id"`
+	Status AcademicYearCreationStatus `json:"status"`
+	// Why the run was skipped or failed
+	Reason *string `json:"reason,omitempty" encore:"optional"`
+	// The academic year created by the run
+	AcademicYear *uint64   `json:"academicYear,omitempty" encore:"optional"`
+	RanAt        time.Time `json:"ranAt"`
+}
+
+// The automatic academic year creation schedule of an institution along with its latest runs
+type AcademicYearCreation struct {
+	Enabled   bool                      `json:"enabled"`
+	NextRunAt *time.Time                `json:"nextRunAt,omitempty" encore:"optional"`
+	Runs      []AcademicYearCreationRun `json:"runs"`
+	// The cursor of the next page of runs, 0 once there are no more
+	Next uint64 `json:"next"`
+}
+
 type Institution struct {
 	Name        string    `json:"name"`
 	Description *string   `json:"description,omitempty" encore:"optional"`
@@ -114,16 +245,27 @@ type Institution struct {
 	Members     int       `json:"members"`
 	CurrentYear *uint64   `json:"currentYear" encore:"optional"`
 	CurrentTerm *uint64   `json:"currentTerm" encore:"optional"`
+	// Archived institutions are read-only and hidden from lookups
+	Archived   bool       `json:"archived"`
+	ArchivedAt *time.Time `json:"archivedAt,omitempty" encore:"optional"`
 }
 
 type LookupInstitutionsRequest struct {
-	Page           uint `query:"page" encore:"optional"`
-	Size           uint `query:"size" encore:"optional"`
-	SubscribedOnly bool `query:"subscribedOnly" encore:"optional"`
+	// The zero-based page to return, used when no cursor is given
+	Page           uint   `query:"page" encore:"optional"`
+	After          uint64 `query:"after" encore:"optional"`
+	Size           uint   `query:"size" encore:"optional"`
+	SubscribedOnly bool   `query:"subscribedOnly" encore:"optional"`
 }
 
 type LookupInstitutionsResponse struct {
 	Institutions []InstitutionLookup `json:"institutions"`
+	// The total number of viewable institutions
+	Total uint `json:"total"`
+	// Whether another page follows this one
+	HasMore bool `json:"hasMore"`
+	// The cursor of the next page, absent on the last page
+	Next uint64 `json:"next,omitempty" encore:"optional"`
 }
 
 type InstitutionLookup struct {
@@ -185,3 +327,122 @@ func (n NewInstitutionRequest) Validate() error {
 
 	return nil
 }
+
+// Changes to an institution. Omitted fields are left as they are, while an empty description or logo removes it.
+type UpdateInstitutionRequest struct {
+	Name        *string `json:"name,omitempty" encore:"optional"`
+	Description *string `json:"description,omitempty" encore:"optional"`
+	Logo        *string `json:"logo,omitempty" encore:"optional"`
+	Visible     *bool   `json:"visible,omitempty" encore:"optional"`
+}
+
+func (u UpdateInstitutionRequest) Validate() error {
+	msgs := make([]string, 0)
+
+	if u.Name == nil && u.Description == nil && u.Logo == nil && u.Visible == nil {
+		msgs = append(msgs, "At least one field must be provided")
+	}
+
+	if u.Name != nil && len(strings.TrimSpace(*u.Name)) == 0 {
+		msgs = append(msgs, "The name field cannot be empty")
+	} else if u.Name != nil && len(*u.Name) > 255 {
+		msgs = append(msgs, "The name field cannot be longer than 255 characters")
+	}
+
+	if u.Description != nil && len(*u.Description) > 255 {
+		msgs = append(msgs, "The description field cannot be longer than 255 characters")
+	}
+
+	if u.Logo != nil && len(*u.Logo) > 255 {
+		msgs = append(msgs, "The logo field cannot be longer than 255 characters")
+	}
+
+	if len(msgs) > 0 {
+		return &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: strings.Join(msgs, "\n"),
+		}
+	}
+
+	return nil
+}
+
+type VerificationRequestStatus string
+
+const (
+	VRSPending  VerificationRequestStatus = "pending"
+	VRSApproved VerificationRequestStatus = "approved"
+	VRSRejected VerificationRequestStatus = "rejected"
+	VRSRevoked  VerificationRequestStatus = "revoked"
+)
+
+// Asks the platform to verify an institution
+type NewVerificationRequest struct {
+	// The keys of the supporting documents, uploaded on behalf of the institution
+	Documents []string `json:"documents"`
+	Notes     *string  `json:"notes,omitempty" encore:"optional"`
+}
+
+func (n NewVerificationRequest) Validate() error {
+	msgs := make([]string, 0)
+
+	if len(n.Documents) == 0 {
+		msgs = append(msgs, "At least one document is required")
+	} else if len(n.Documents) > 20 {
+		msgs = append(msgs, "No more than 20 documents can be submitted")
+	}
+
+	if n.Notes != nil && len(*n.Notes) > 2000 {
+		msgs = append(msgs, "The notes field cannot be longer than 2000 characters")
+	}
+
+	if len(msgs) > 0 {
+		return &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: strings.Join(msgs, "\n"),
+		}
+	}
+	return nil
+}
+
+// A reviewer's decision on a verification request, or the revocation of a verification
+type VerificationDecisionRequest struct {
+	Reason *string `json:"reason,omitempty" encore:"optional"`
+}
+
+// Requires a reason for the decision
+type VerificationReasonRequest struct {
+	Reason string `json:"reason"`
+}
+
+func (v VerificationReasonRequest) Validate() error {
+	if len(strings.TrimSpace(v.Reason)) == 0 {
+		return &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: "The reason field is required",
+		}
+	}
+	return nil
+}
+
+type VerificationRequest struct {
+	Id           uint64                    `json:"id"`
+	Institution  uint64                    `json:"institution"`
+	SubmittedBy  uint64                    `json:"submittedBy"`
+	Documents    []string                  `json:"documents"`
+	Notes        *string                   `json:"notes,omitempty" encore:"optional"`
+	Status       VerificationRequestStatus `json:"status"`
+	ReviewedBy   *uint64                   `json:"reviewedBy,omitempty" encore:"optional"`
+	ReviewReason *string                   `json:"reviewReason,omitempty" encore:"optional"`
+	ReviewedAt   *time.Time                `json:"reviewedAt,omitempty" encore:"optional"`
+	RevokedBy    *uint64                   `json:"revokedBy,omitempty" encore:"optional"`
+	RevokeReason *string                   `json:"revokeReason,omitempty" encore:"optional"`
+	RevokedAt    *time.Time                `json:"revokedAt,omitempty" encore:"optional"`
+	CreatedAt    time.Time                 `json:"createdAt"`
+}
+
+type VerificationRequestsResponse struct {
+	Requests []VerificationRequest `json:"requests"`
+	// The cursor of the next page, 0 once there are no more
+	Next uint64 `json:"next"`
+}
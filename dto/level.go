@@ -0,0 +1,147 @@
+package dto
+
+import (
+	"strings"
+	"time"
+
+	"encore.dev/beta/errs"
+)
+
+type Level struct {
+	Id          uint64  `json:"id"`
+	Institution uint64  `json:"institution"`
+	Name        string  `json:"name"`
+	Code        *string `json:"code,omitempty" encore:"optional"`
+	Description *string `json:"description,omitempty" encore:"optional"`
+	// The rank of the level within its institution, starting at 1 for the lowest level
+	Position int `json:"position"`
+	// The number of students the level can take, unlimited when absent
+	Capacity *int `json:"capacity,omitempty" encore:"optional"`
+	// The level which has to be completed before this one
+	Prerequisite *uint64 `json:"prerequisite,omitempty" encore:"optional"`
+	// The scale the level is graded on, the default 0-20 scale when absent
+	GradingScale *uint64    `json:"gradingScale,omitempty" encore:"optional"`
+	Archived     bool       `json:"archived"`
+	ArchivedAt   *time.Time `json:"archivedAt,omitempty" encore:"optional"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	UpdatedAt    time.Time  `json:"updatedAt"`
+}
+
+type NewLevelRequest struct {
+	Name         string  `json:"name"`
+	Code         *string `json:"code,omitempty" encore:"optional"`
+	Description  *string `json:"description,omitempty" encore:"optional"`
+	Capacity     *int    `json:"capacity,omitempty" encore:"optional"`
+	Prerequisite *uint64 `json:"prerequisite,omitempty" encore:"optional"`
+	GradingScale *uint64 `json:"gradingScale,omitempty" encore:"optional"`
+	// Where to place the level. The level is placed after the existing levels when absent.
+	Position *int `json:"position,omitempty" encore:"optional"`
+}
+
+func (n NewLevelRequest) Validate() error {
+	msgs := validateLevelFields(&n.Name, n.Code, n.Description, n.Capacity, n.Position)
+
+	if len(msgs) > 0 {
+		return &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: strings.Join(msgs, "\n"),
+		}
+	}
+	return nil
+}
+
+type UpdateLevelRequest struct {
+	Name        *string `json:"name,omitempty" encore:"optional"`
+	Code        *string `json:"code,omitempty" encore:"optional"`
+	Description *string `json:"description,omitempty" encore:"optional"`
+	// Set to 0 to remove the capacity limit
+	Capacity *int `json:"capacity,omitempty" encore:"optional"`
+	// Set to 0 to remove the prerequisite
+	Prerequisite *uint64 `json:"prerequisite,omitempty" encore:"optional"`
+	// Set to 0 to grade the level on the default 0-20 scale
+	GradingScale *uint64 `json:"gradingScale,omitempty" encore:"optional"`
+	// Archives or restores the level
+	Archived *bool `json:"archived,omitempty" encore:"optional"`
+}
+
+func (u UpdateLevelRequest) Validate() error {
+	msgs := make([]string, 0)
+
+	if u.Name == nil && u.Code == nil && u.Description == nil && u.Capacity == nil && u.Prerequisite == nil && u.GradingScale == nil && u.Archived == nil {
+		msgs = append(msgs, "At least one field must be provided")
+	}
+
+	msgs = append(msgs, validateLevelFields(u.Name, u.Code, u.Description, u.Capacity, nil)...)
+
+	if len(msgs) > 0 {
+		return &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: strings.Join(msgs, "\n"),
+		}
+	}
+	return nil
+}
+
+// Orders the levels of an institution, from the lowest to the highest
+type ReorderLevelsRequest struct {
+	Levels []uint64 `json:"levels"`
+}
+
+func (r ReorderLevelsRequest) Validate() error {
+	if len(r.Levels) == 0 {
+		return &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: "At least one level is required",
+		}
+	}
+
+	seen := make(map[uint64]bool)
+	for _, id := range r.Levels {
+		if seen[id] {
+			return &errs.Error{
+				Code:    errs.InvalidArgument,
+				Message: "A level cannot appear more than once",
+			}
+		}
+		seen[id] = true
+	}
+	return nil
+}
+
+type FindLevelsRequest struct {
+	IncludeArchived bool `query:"archived"`
+}
+
+type LevelsResponse struct {
+	Levels []Level `json:"levels"`
+}
+
+type DeleteLevelResponse struct {
+	// Whether the level was archived instead of deleted because it is in use
+	Archived bool `json:"archived"`
+}
+
+func validateLevelFields(name, code, description *string, capacity, position *int) (msgs []string) {
+	if name != nil && len(strings.TrimSpace(*name)) == 0 {
+		msgs = append(msgs, "The name field is required")
+	} else if name != nil && len(*name) > 100 {
+		msgs = append(msgs, "The name field cannot be longer than 100 characters")
+	}
+
+	if code != nil && len(*code) > 20 {
+		msgs = append(msgs, "The code field cannot be longer than 20 characters")
+	}
+
+	if description != nil && len(*description) > 255 {
+		msgs = append(msgs, "The description field cannot be longer than 255 characters")
+	}
+
+	if capacity != nil && *capacity < 0 {
+		msgs = append(msgs, "The capacity field cannot be negative")
+	}
+
+	if position != nil && *position < 1 {
+		msgs = append(msgs, "The position field must be at least 1")
+	}
+	return
+}
@@ -4,7 +4,9 @@ import (
 	"errors"
 	"fmt"
 	"regexp"
+	"slices"
 	"strings"
+	"time"
 
 	"encore.dev/beta/auth"
 )
@@ -40,24 +42,36 @@ func ParsePermissionType(s string) (PermissionType, bool) {
 		return PTUserFile, true
 	case string(PTSharedFile):
 		return PTSharedFile, true
+	case string(PTPlatform):
+		return PTPlatform, true
+	case string(PTClass):
+		return PTClass, true
+	case string(PTStudentRecord):
+		return PTStudentRecord, true
+	case string(PTCourse):
+		return PTCourse, true
 	default:
 		return unknown, false
 	}
 }
 
 const (
-	PTInstitution  PermissionType = "institution"
-	PTUser         PermissionType = "user"
-	PTTenant       PermissionType = "tenant"
-	PTForm         PermissionType = "form"
-	PTEnrollment   PermissionType = "enrollment"
-	PTSubscription PermissionType = "subscription"
-	PTSetting      PermissionType = "setting"
-	PTAcademicYear PermissionType = "academicYear"
-	PTAcademicTerm PermissionType = "academicTerm"
-	PTUserFile     PermissionType = "file"
-	PTSharedFile   PermissionType = "shared_file"
-	unknown        PermissionType = ""
+	PTInstitution   PermissionType = "institution"
+	PTUser          PermissionType = "user"
+	PTTenant        PermissionType = "tenant"
+	PTForm          PermissionType = "form"
+	PTEnrollment    PermissionType = "enrollment"
+	PTSubscription  PermissionType = "subscription"
+	PTSetting       PermissionType = "setting"
+	PTAcademicYear  PermissionType = "academicYear"
+	PTAcademicTerm  PermissionType = "academicTerm"
+	PTUserFile      PermissionType = "file"
+	PTSharedFile    PermissionType = "shared_file"
+	PTPlatform      PermissionType = "platform"
+	PTClass         PermissionType = "class"
+	PTStudentRecord PermissionType = "studentRecord"
+	PTCourse        PermissionType = "course"
+	unknown         PermissionType = ""
 )
 
 func ParsePermissionName(p string) (PermissionName, bool) {
@@ -112,6 +126,58 @@ func ParsePermissionName(p string) (PermissionName, bool) {
 		return PNCanUpdateSubscription, true
 	case string(PNCanCreateSettings):
 		return PNCanCreateSettings, true
+	case string(PNCanExplainPermissions):
+		return PNCanExplainPermissions, true
+	case string(PNCanManageAuthorizationModels):
+		return PNCanManageAuthorizationModels, true
+	case string(PNCanGrantAccess):
+		return PNCanGrantAccess, true
+	case string(PNCanViewResponses):
+		return PNCanViewResponses, true
+	case string(PNCanReviewInstitutions):
+		return PNCanReviewInstitutions, true
+	case string(PNMaintainer):
+		return PNMaintainer, true
+	case string(PNAdmin):
+		return PNAdmin, true
+	case string(PNStaff):
+		return PNStaff, true
+	case string(PNTeacher):
+		return PNTeacher, true
+	case string(PNHomeroomTeacher):
+		return PNHomeroomTeacher, true
+	case string(PNStudent):
+		return PNStudent, true
+	case string(PNReviewer):
+		return PNReviewer, true
+	case string(PNAccount):
+		return PNAccount, true
+	case string(PNMedicalViewer):
+		return PNMedicalViewer, true
+	case string(PNCanViewMedical):
+		return PNCanViewMedical, true
+	case string(PNCanEditMedical):
+		return PNCanEditMedical, true
+	case string(PNCanManageStudents):
+		return PNCanManageStudents, true
+	case string(PNGuardian):
+		return PNGuardian, true
+	case string(PNCanGrade):
+		return PNCanGrade, true
+	case string(PNCanManageGrades):
+		return PNCanManageGrades, true
+	case string(PNCanViewResults):
+		return PNCanViewResults, true
+	case string(PNCanWriteRemarks):
+		return PNCanWriteRemarks, true
+	case string(PNSubject):
+		return PNSubject, true
+	case string(PNCanTakeAttendance):
+		return PNCanTakeAttendance, true
+	case string(PNCanManageTimetables):
+		return PNCanManageTimetables, true
+	case string(PNArchived):
+		return PNArchived, true
 	default:
 		return pnUnknown, false
 	}
@@ -119,32 +185,58 @@ func ParsePermissionName(p string) (PermissionName, bool) {
 
 // Permission name
 const (
-	PNOwner                 PermissionName = "owner"
-	PNParent                PermissionName = "parent"
-	PNMember                PermissionName = "member"
-	PNDestination           PermissionName = "destination"
-	PNCanCreateAcademicYear PermissionName = "can_create_academic_year"
-	PNCanCreateInstitution  PermissionName = "can_create_institution"
-	PNCanCreateForms        PermissionName = "can_create_forms"
-	PNFormResponder         PermissionName = "responder"
-	PNCanView               PermissionName = "can_view"
-	PNCanViewSettings       PermissionName = "can_view_settings"
-	PNCanUploadFile         PermissionName = "can_upload_file"
-	PNCanSetSettingValue    PermissionName = "can_set_setting_value"
-	PNCanEditSettings       PermissionName = "can_edit_settings"
-	PNEditor                PermissionName = "editor"
-	PNCanEdit               PermissionName = "can_edit"
-	PNCanEnroll             PermissionName = "can_enroll"
-	PNCanModifyMembers      PermissionName = "can_modify_members"
-	PNCanViewMembers        PermissionName = "can_view_members"
-	PNCanChangeOwner        PermissionName = "can_change_owner"
-	PNCanChangeSettings     PermissionName = "can_change_settings"
-	PNCanDelete             PermissionName = "can_delete"
-	PNCanUpdate             PermissionName = "can_update"
-	PNCanUpdateSubscription PermissionName = "can_update_subscription"
-	PNCanCreateSettings     PermissionName = "can_create_settings"
-	PNCanViewInstitutions   PermissionName = "can_view_institutions"
-	pnUnknown               PermissionName = ""
+	PNOwner                        PermissionName = "owner"
+	PNParent                       PermissionName = "parent"
+	PNMember                       PermissionName = "member"
+	PNDestination                  PermissionName = "destination"
+	PNCanCreateAcademicYear        PermissionName = "can_create_academic_year"
+	PNCanCreateInstitution         PermissionName = "can_create_institution"
+	PNCanCreateForms               PermissionName = "can_create_forms"
+	PNFormResponder                PermissionName = "responder"
+	PNCanView                      PermissionName = "can_view"
+	PNCanViewSettings              PermissionName = "can_view_settings"
+	PNCanUploadFile                PermissionName = "can_upload_file"
+	PNCanSetSettingValue           PermissionName = "can_set_setting_value"
+	PNCanEditSettings              PermissionName = "can_edit_settings"
+	PNEditor                       PermissionName = "editor"
+	PNCanEdit                      PermissionName = "can_edit"
+	PNCanEnroll                    PermissionName = "can_enroll"
+	PNCanModifyMembers             PermissionName = "can_modify_members"
+	PNCanViewMembers               PermissionName = "can_view_members"
+	PNCanChangeOwner               PermissionName = "can_change_owner"
+	PNCanChangeSettings            PermissionName = "can_change_settings"
+	PNCanDelete                    PermissionName = "can_delete"
+	PNCanUpdate                    PermissionName = "can_update"
+	PNCanUpdateSubscription        PermissionName = "can_update_subscription"
+	PNCanCreateSettings            PermissionName = "can_create_settings"
+	PNCanViewInstitutions          PermissionName = "can_view_institutions"
+	PNCanExplainPermissions        PermissionName = "can_explain_permissions"
+	PNCanManageAuthorizationModels PermissionName = "can_manage_authorization_models"
+	PNCanGrantAccess               PermissionName = "can_grant_access"
+	PNCanViewResponses             PermissionName = "can_view_responses"
+	PNCanReviewInstitutions        PermissionName = "can_review_institutions"
+	PNMaintainer                   PermissionName = "maintainer"
+	PNAdmin                        PermissionName = "admin"
+	PNStaff                        PermissionName = "staff"
+	PNTeacher                      PermissionName = "teacher"
+	PNHomeroomTeacher              PermissionName = "homeroom_teacher"
+	PNStudent                      PermissionName = "student"
+	PNReviewer                     PermissionName = "reviewer"
+	PNAccount                      PermissionName = "account"
+	PNMedicalViewer                PermissionName = "medical_viewer"
+	PNCanViewMedical               PermissionName = "can_view_medical"
+	PNCanEditMedical               PermissionName = "can_edit_medical"
+	PNCanManageStudents            PermissionName = "can_manage_students"
+	PNGuardian                     PermissionName = "guardian"
+	PNCanGrade                     PermissionName = "can_grade"
+	PNCanManageGrades              PermissionName = "can_manage_grades"
+	PNCanViewResults               PermissionName = "can_view_results"
+	PNCanWriteRemarks              PermissionName = "can_write_remarks"
+	PNSubject                      PermissionName = "subject"
+	PNCanTakeAttendance            PermissionName = "can_take_attendance"
+	PNCanManageTimetables          PermissionName = "can_manage_timetables"
+	PNArchived                     PermissionName = "archived"
+	pnUnknown                      PermissionName = ""
 )
 
 type ListObjectsResponse struct {
@@ -192,6 +284,35 @@ type ListObjectsRequest struct {
 	Context []ContextEntry `json:"context,omitempty" encore:"optional"`
 }
 
+type FilterObjectsRequest struct {
+	// The actor whose access is being checked
+	Actor string `json:"actor"`
+	// The relation specifier
+	Relation PermissionName `json:"relation"`
+	// The type of the candidate objects
+	Type PermissionType `json:"type"`
+	// The ids of the candidate objects
+	Ids []uint64 `json:"ids"`
+}
+
+type FilterObjectsResponse struct {
+	// The ids of the candidates the actor is related to, in their original order
+	Allowed []uint64 `json:"allowed"`
+}
+
+type ListUsersRequest struct {
+	// The object the users are related to
+	Target string `json:"target"`
+	// The relation specifier
+	Relation PermissionName `json:"relation"`
+	Context  []ContextEntry `json:"context,omitempty" encore:"optional"`
+}
+
+type ListUsersResponse struct {
+	// The ids of the related users
+	Users []uint64 `json:"users"`
+}
+
 type BatchRelationCheckResponse struct {
 	Results map[string]bool `json:"results"`
 }
@@ -280,6 +401,9 @@ const (
 	CETBool      ContextEntryType = "bool"
 	CETString    ContextEntryType = "string"
 	CETDuration  ContextEntryType = "duration"
+	CETInt       ContextEntryType = "int"
+	CETUint      ContextEntryType = "uint"
+	CETDouble    ContextEntryType = "double"
 )
 
 func HavingEntry(name string, _type ContextEntryType, value any) ContextEntry {
@@ -332,3 +456,253 @@ func NewPermissionUpdateWithCondition[T string | uint64 | auth.UID](actor string
 type UpdatePermissionsRequest struct {
 	Updates []PermissionUpdate
 }
+
+type PurgeObjectTuplesRequest struct {
+	// The objects whose tuples are removed, e.g. "form:12"
+	Objects []string
+}
+
+type ReplacePermissionsRequest struct {
+	// The tuples to write
+	Writes []PermissionUpdate
+	// The tuples to delete
+	Deletes []PermissionUpdate
+}
+
+// The identifier of the platform object holding platform-wide roles.
+const PlatformId = "scholaris"
+
+// Kinds of nodes in a permission explanation tree
+const (
+	ENKUnion          = "union"
+	ENKIntersection   = "intersection"
+	ENKDifference     = "difference"
+	ENKDirect         = "direct"
+	ENKComputed       = "computed"
+	ENKTupleToUserset = "tupleToUserset"
+)
+
+type ExplainPermissionRequest struct {
+	// The actor whose access is being explained
+	Actor string `json:"actor"`
+	// The relation specifier
+	Relation PermissionName `json:"relation"`
+	// The target resource identifier
+	Target string `json:"target"`
+	// The context used when evaluating conditions
+	Context []ContextEntry `json:"context,omitempty" encore:"optional"`
+	// The maximum depth of the resolution tree
+	MaxDepth uint `json:"maxDepth,omitempty" encore:"optional"`
+}
+
+func (e ExplainPermissionRequest) Validate() error {
+	msgs := make([]string, 0)
+
+	pattern := regexp.MustCompile(`^[a-zA-Z_\-0-9]+:[a-zA-Z_\-0-9*]+$`)
+	if !pattern.MatchString(e.Actor) {
+		msgs = append(msgs, "Invalid value for \"actor\"")
+	}
+
+	if len(e.Relation) == 0 {
+		msgs = append(msgs, "The relation field is required")
+	}
+
+	if !pattern.MatchString(e.Target) {
+		msgs = append(msgs, "Invalid value for \"target\"")
+	} else if _, valid := ParsePermissionType(strings.Split(e.Target, ":")[0]); !valid {
+		msgs = append(msgs, "Invalid value for \"target\"")
+	}
+
+	if len(msgs) > 0 {
+		return errors.New(strings.Join(msgs, "\n"))
+	}
+	return nil
+}
+
+type ConditionEvaluation struct {
+	// The user assigned by the conditional tuple
+	User string `json:"user"`
+	// The condition's name
+	Name string `json:"name"`
+	// The context values stored on the tuple
+	TupleContext []ContextEntry `json:"tupleContext,omitempty" encore:"optional"`
+	// Whether the tuple's condition was satisfied using its stored context and the request's context
+	Satisfied bool `json:"satisfied"`
+}
+
+type ExplanationNode struct {
+	// The userset being resolved (object#relation)
+	Name string `json:"name"`
+	// The kind of rewrite this node represents
+	Kind string `json:"kind"`
+	// Whether this node grants access to the actor
+	Granted bool `json:"granted"`
+	// The users directly assigned on a direct node
+	Users []string `json:"users,omitempty" encore:"optional"`
+	// The condition evaluations of the actor's conditional tuples, if any
+	Conditions []ConditionEvaluation `json:"conditions,omitempty" encore:"optional"`
+	// Whether resolution stopped at this node because of the depth limit or a cycle
+	Truncated bool              `json:"truncated,omitempty" encore:"optional"`
+	Children  []ExplanationNode `json:"children,omitempty" encore:"optional"`
+}
+
+type ExplainPermissionResponse struct {
+	// The final result of the check
+	Allowed bool `json:"allowed"`
+	// The resolution tree
+	Tree ExplanationNode `json:"tree"`
+}
+
+type AuthorizationModelEntry struct {
+	// The model's id in the authorization store
+	ModelId string `json:"modelId"`
+	// The hash of the compiled model
+	Hash string `json:"hash"`
+	// The environment the model was deployed to
+	Environment string `json:"environment"`
+	// Whether the model is the one the service is pinned to
+	Active      bool       `json:"active"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	ActivatedAt *time.Time `json:"activatedAt,omitempty" encore:"optional"`
+}
+
+type TupleMigrationEntry struct {
+	// The migration's identifier
+	Id string `json:"id"`
+	// The number of tuples rewritten by the migration
+	Rewritten uint      `json:"rewritten"`
+	AppliedAt time.Time `json:"appliedAt"`
+}
+
+type AuthorizationModelsResponse struct {
+	Models     []AuthorizationModelEntry `json:"models"`
+	Migrations []TupleMigrationEntry     `json:"migrations"`
+}
+
+// The relations which can be granted temporarily, per object type. These are the ones accepting the not_expired condition.
+var GrantableRelations = map[PermissionType][]PermissionName{
+	PTInstitution:   {PNMaintainer, PNStaff, PNTeacher},
+	PTForm:          {PNEditor, PNReviewer},
+	PTStudentRecord: {PNMedicalViewer},
+}
+
+func isGrantable(target string, relation PermissionName) bool {
+	pt, _, _ := strings.Cut(target, ":")
+	return slices.Contains(GrantableRelations[PermissionType(pt)], relation)
+}
+
+func validateGrantTarget(target string) (msgs []string) {
+	pattern := regexp.MustCompile(`^[a-zA-Z_\-0-9]+:[0-9]+$`)
+	if !pattern.MatchString(target) {
+		msgs = append(msgs, "Invalid value for \"target\"")
+	} else if _, ok := GrantableRelations[PermissionType(strings.Split(target, ":")[0])]; !ok {
+		msgs = append(msgs, "Access to this type of object cannot be granted")
+	}
+	return
+}
+
+type NewGrantRequest struct {
+	// The user receiving access
+	User uint64 `json:"user"`
+	// The relation being granted
+	Relation PermissionName `json:"relation"`
+	// The target resource identifier
+	Target string `json:"target"`
+	// When the access ends
+	ExpiresAt time.Time `json:"expiresAt"`
+	// Why the access is granted
+	Reason *string `json:"reason,omitempty" encore:"optional"`
+}
+
+func (n NewGrantRequest) Validate() error {
+	msgs := validateGrantTarget(n.Target)
+
+	if n.User == 0 {
+		msgs = append(msgs, "The user field is required")
+	}
+
+	if len(msgs) == 0 && !isGrantable(n.Target, n.Relation) {
+		msgs = append(msgs, fmt.Sprintf("The %q relation cannot be granted on this object", n.Relation))
+	}
+
+	if !n.ExpiresAt.After(time.Now()) {
+		msgs = append(msgs, "The expiry date must be in the future")
+	}
+
+	if len(msgs) > 0 {
+		return errors.New(strings.Join(msgs, "\n"))
+	}
+	return nil
+}
+
+type DelegateRelationsRequest struct {
+	// The user receiving the relations
+	User uint64 `json:"user"`
+	// The relations handed over, all of which the caller must hold
+	Relations []PermissionName `json:"relations"`
+	// The target resource identifier
+	Target string `json:"target"`
+	// When the delegation ends
+	ExpiresAt time.Time `json:"expiresAt"`
+	// Why the relations are delegated
+	Reason *string `json:"reason,omitempty" encore:"optional"`
+}
+
+func (d DelegateRelationsRequest) Validate() error {
+	msgs := validateGrantTarget(d.Target)
+
+	if d.User == 0 {
+		msgs = append(msgs, "The user field is required")
+	}
+
+	if len(d.Relations) == 0 {
+		msgs = append(msgs, "At least one relation is required")
+	} else if len(msgs) == 0 {
+		for _, r := range d.Relations {
+			if !isGrantable(d.Target, r) {
+				msgs = append(msgs, fmt.Sprintf("The %q relation cannot be delegated on this object", r))
+			}
+		}
+	}
+
+	if !d.ExpiresAt.After(time.Now()) {
+		msgs = append(msgs, "The expiry date must be in the future")
+	}
+
+	if len(msgs) > 0 {
+		return errors.New(strings.Join(msgs, "\n"))
+	}
+	return nil
+}
+
+type FindGrantsRequest struct {
+	// The target resource identifier
+	Target string `query:"target"`
+	// Whether to include expired and revoked grants
+	IncludeInactive bool `query:"includeInactive" encore:"optional"`
+}
+
+func (f FindGrantsRequest) Validate() error {
+	if msgs := validateGrantTarget(f.Target); len(msgs) > 0 {
+		return errors.New(strings.Join(msgs, "\n"))
+	}
+	return nil
+}
+
+type Grant struct {
+	Id        uint64         `json:"id"`
+	User      uint64         `json:"user"`
+	Relation  PermissionName `json:"relation"`
+	Target    string         `json:"target"`
+	ExpiresAt time.Time      `json:"expiresAt"`
+	GrantedBy uint64         `json:"grantedBy"`
+	// Whether the grant hands over relations held by the granter
+	Delegated bool       `json:"delegated"`
+	Reason    *string    `json:"reason,omitempty" encore:"optional"`
+	CreatedAt time.Time  `json:"createdAt"`
+	RevokedAt *time.Time `json:"revokedAt,omitempty" encore:"optional"`
+}
+
+type FindGrantsResponse struct {
+	Grants []Grant `json:"grants"`
+}
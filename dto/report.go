@@ -0,0 +1,167 @@
+package dto
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"encore.dev/beta/errs"
+)
+
+type Remark struct {
+	Id           uint64 `json:"id"`
+	Class        uint64 `json:"class"`
+	AcademicTerm uint64 `json:"academicTerm"`
+	Student      uint64 `json:"student"`
+	// Absent for remarks on the whole class
+	Course    *uint64   `json:"course,omitempty" encore:"optional"`
+	Remark    string    `json:"remark"`
+	WrittenBy uint64    `json:"writtenBy"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type RemarkEntry struct {
+	// The student record
+	Student uint64 `json:"student"`
+	Remark  string `json:"remark"`
+}
+
+// Records the remarks on students' terms. Entries with an empty remark clear the student's remark.
+type RecordRemarksRequest struct {
+	AcademicTerm uint64        `json:"academicTerm"`
+	Remarks      []RemarkEntry `json:"remarks"`
+}
+
+func (r RecordRemarksRequest) Validate() error {
+	msgs := make([]string, 0)
+
+	if r.AcademicTerm == 0 {
+		msgs = append(msgs, "The academicTerm field is required")
+	}
+
+	if len(r.Remarks) == 0 {
+		msgs = append(msgs, "At least one remark is required")
+	}
+
+	seen := make(map[uint64]bool)
+	for i, rm := range r.Remarks {
+		if rm.Student == 0 {
+			msgs = append(msgs, fmt.Sprintf("The student field of remark %d is required", i+1))
+		} else if seen[rm.Student] {
+			msgs = append(msgs, fmt.Sprintf("The student of remark %d appears more than once", i+1))
+		}
+		seen[rm.Student] = true
+
+		if len(rm.Remark) > 500 {
+			msgs = append(msgs, fmt.Sprintf("The remark field of remark %d cannot be longer than 500 characters", i+1))
+		}
+	}
+
+	if len(msgs) > 0 {
+		return &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: strings.Join(msgs, "\n"),
+		}
+	}
+	return nil
+}
+
+type FindRemarksRequest struct {
+	AcademicTerm uint64 `query:"term"`
+}
+
+func (f FindRemarksRequest) Validate() error {
+	if f.AcademicTerm == 0 {
+		return &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: "The term parameter is required",
+		}
+	}
+	return nil
+}
+
+type RemarksResponse struct {
+	Remarks []Remark `json:"remarks"`
+}
+
+type ReportCardJobStatus string
+
+const (
+	RJSPending    ReportCardJobStatus = "pending"
+	RJSInProgress ReportCardJobStatus = "in_progress"
+	RJSCompleted  ReportCardJobStatus = "completed"
+	RJSFailed     ReportCardJobStatus = "failed"
+)
+
+type NewReportCardJobRequest struct {
+	AcademicTerm uint64 `json:"academicTerm"`
+	// The student records whose report cards are generated. The whole class is covered when omitted.
+	Students []uint64 `json:"students,omitempty" encore:"optional"`
+}
+
+func (n NewReportCardJobRequest) Validate() error {
+	msgs := make([]string, 0)
+
+	if n.AcademicTerm == 0 {
+		msgs = append(msgs, "The academicTerm field is required")
+	}
+
+	seen := make(map[uint64]bool)
+	for i, s := range n.Students {
+		if s == 0 {
+			msgs = append(msgs, fmt.Sprintf("Invalid value for student %d", i+1))
+		} else if seen[s] {
+			msgs = append(msgs, fmt.Sprintf("Student %d appears more than once", i+1))
+		}
+		seen[s] = true
+	}
+
+	if len(msgs) > 0 {
+		return &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: strings.Join(msgs, "\n"),
+		}
+	}
+	return nil
+}
+
+type ReportCardJob struct {
+	Id           uint64              `json:"id"`
+	Class        uint64              `json:"class"`
+	AcademicTerm uint64              `json:"academicTerm"`
+	Students     []uint64            `json:"students,omitempty" encore:"optional"`
+	Status       ReportCardJobStatus `json:"status"`
+	// The number of report cards to generate, known once the job has started
+	Total     uint    `json:"total"`
+	Generated uint    `json:"generated"`
+	Failed    uint    `json:"failed"`
+	Error     *string `json:"error,omitempty" encore:"optional"`
+	// The percentage of the report cards which were processed
+	Progress    uint       `json:"progress"`
+	RequestedBy uint64     `json:"requestedBy"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	StartedAt   *time.Time `json:"startedAt,omitempty" encore:"optional"`
+	CompletedAt *time.Time `json:"completedAt,omitempty" encore:"optional"`
+}
+
+type ReportCard struct {
+	Id           uint64 `json:"id"`
+	Class        uint64 `json:"class"`
+	AcademicTerm uint64 `json:"academicTerm"`
+	Student      uint64 `json:"student"`
+	// The key of the document in the blob service
+	File        string    `json:"file"`
+	DownloadUrl string    `json:"downloadUrl"`
+	Average     *float64  `json:"average,omitempty" encore:"optional"`
+	Rank        *int      `json:"rank,omitempty" encore:"optional"`
+	GeneratedBy uint64    `json:"generatedBy"`
+	GeneratedAt time.Time `json:"generatedAt"`
+}
+
+type FindReportCardsRequest struct {
+	AcademicTerm uint64 `query:"term"`
+}
+
+type ReportCardsResponse struct {
+	ReportCards []ReportCard `json:"reportCards"`
+}
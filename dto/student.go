@@ -0,0 +1,420 @@
+package dto
+
+import (
+	"net/mail"
+	"slices"
+	"strings"
+	"time"
+
+	"encore.dev/beta/errs"
+)
+
+type StudentStatus string
+
+const (
+	SSActive    StudentStatus = "active"
+	SSSuspended StudentStatus = "suspended"
+	SSGraduated StudentStatus = "graduated"
+	SSWithdrawn StudentStatus = "withdrawn"
+)
+
+var studentStatuses = []StudentStatus{SSActive, SSSuspended, SSGraduated, SSWithdrawn}
+
+// Whether students with the status still attend the institution
+func (s StudentStatus) Attending() bool {
+	return s == SSActive || s == SSSuspended
+}
+
+type MedicalNoteCategory string
+
+const (
+	MNCAllergy    MedicalNoteCategory = "allergy"
+	MNCCondition  MedicalNoteCategory = "condition"
+	MNCMedication MedicalNoteCategory = "medication"
+	MNCOther      MedicalNoteCategory = "other"
+)
+
+var medicalNoteCategories = []MedicalNoteCategory{MNCAllergy, MNCCondition, MNCMedication, MNCOther}
+
+// How a guardian is related to a student
+type GuardianRelationship string
+
+const (
+	GRMother        GuardianRelationship = "mother"
+	GRFather        GuardianRelationship = "father"
+	GRLegalGuardian GuardianRelationship = "legal_guardian"
+	GROther         GuardianRelationship = "other"
+)
+
+var guardianRelationships = []GuardianRelationship{GRMother, GRFather, GRLegalGuardian, GROther}
+
+type Student struct {
+	Id          uint64 `json:"id"`
+	Institution uint64 `json:"institution"`
+	// The registration number of the student, unique within the institution
+	Matricule string `json:"matricule"`
+	// The enrollment the record was created from
+	Enrollment *uint64 `json:"enrollment,omitempty" encore:"optional"`
+	// The user account of the student
+	Account      *uint64       `json:"account,omitempty" encore:"optional"`
+	FirstName    string        `json:"firstName"`
+	LastName     string        `json:"lastName"`
+	Gender       *Gender       `json:"gender,omitempty" encore:"optional"`
+	DateOfBirth  *time.Time    `json:"dateOfBirth,omitempty" encore:"optional"`
+	PlaceOfBirth *string       `json:"placeOfBirth,omitempty" encore:"optional"`
+	Nationality  *string       `json:"nationality,omitempty" encore:"optional"`
+	Address      *string       `json:"address,omitempty" encore:"optional"`
+	Phone        *string       `json:"phone,omitempty" encore:"optional"`
+	Email        *string       `json:"email,omitempty" encore:"optional"`
+	Status       StudentStatus `json:"status"`
+	CreatedBy    *uint64       `json:"createdBy,omitempty" encore:"optional"`
+	CreatedAt    time.Time     `json:"createdAt"`
+	UpdatedAt    time.Time     `json:"updatedAt"`
+}
+
+type NewStudentRequest struct {
+	FirstName    string     `json:"firstName"`
+	LastName     string     `json:"lastName"`
+	Gender       *Gender    `json:"gender,omitempty" encore:"optional"`
+	DateOfBirth  *time.Time `json:"dateOfBirth,omitempty" encore:"optional"`
+	PlaceOfBirth *string    `json:"placeOfBirth,omitempty" encore:"optional"`
+	Nationality  *string    `json:"nationality,omitempty" encore:"optional"`
+	Address      *string    `json:"address,omitempty" encore:"optional"`
+	Phone        *string    `json:"phone,omitempty" encore:"optional"`
+	Email        *string    `json:"email,omitempty" encore:"optional"`
+	// The user account of the student, if they have one
+	Account *uint64 `json:"account,omitempty" encore:"optional"`
+}
+
+func (n NewStudentRequest) Validate() error {
+	msgs := validateStudentFields(&n.FirstName, &n.LastName, n.Gender, n.DateOfBirth, n.PlaceOfBirth, n.Nationality, n.Address, n.Phone, n.Email)
+
+	if n.Account != nil && *n.Account == 0 {
+		msgs = append(msgs, "Invalid value for the account field")
+	}
+
+	if len(msgs) > 0 {
+		return &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: strings.Join(msgs, "\n"),
+		}
+	}
+	return nil
+}
+
+// Changes the personal details of a student. Optional details are cleared by setting them to an empty string.
+type UpdateStudentRequest struct {
+	FirstName    *string    `json:"firstName,omitempty" encore:"optional"`
+	LastName     *string    `json:"lastName,omitempty" encore:"optional"`
+	Gender       *Gender    `json:"gender,omitempty" encore:"optional"`
+	DateOfBirth  *time.Time `json:"dateOfBirth,omitempty" encore:"optional"`
+	PlaceOfBirth *string    `json:"placeOfBirth,omitempty" encore:"optional"`
+	Nationality  *string    `json:"nationality,omitempty" encore:"optional"`
+	Address      *string    `json:"address,omitempty" encore:"optional"`
+	Phone        *string    `json:"phone,omitempty" encore:"optional"`
+	Email        *string    `json:"email,omitempty" encore:"optional"`
+}
+
+func (u UpdateStudentRequest) Validate() error {
+	msgs := make([]string, 0)
+
+	if u.FirstName == nil && u.LastName == nil && u.Gender == nil && u.DateOfBirth == nil && u.PlaceOfBirth == nil &&
+		u.Nationality == nil && u.Address == nil && u.Phone == nil && u.Email == nil {
+		msgs = append(msgs, "At least one field must be provided")
+	}
+
+	gender := u.Gender
+	if gender != nil && len(*gender) == 0 {
+		gender = nil
+	}
+	email := u.Email
+	if email != nil && len(*email) == 0 {
+		email = nil
+	}
+	msgs = append(msgs, validateStudentFields(u.FirstName, u.LastName, gender, u.DateOfBirth, u.PlaceOfBirth, u.Nationality, u.Address, u.Phone, email)...)
+
+	if len(msgs) > 0 {
+		return &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: strings.Join(msgs, "\n"),
+		}
+	}
+	return nil
+}
+
+type FindStudentsRequest struct {
+	After  uint64        `query:"after"`
+	Size   uint          `query:"size"`
+	Status StudentStatus `query:"status"`
+	// Matches the beginning of the names or the matricule of students
+	Search string `query:"q"`
+}
+
+func (f FindStudentsRequest) PageSize() uint {
+	if f.Size == 0 {
+		return DefaultPageSize
+	}
+	return f.Size
+}
+
+func (f FindStudentsRequest) Validate() error {
+	if len(f.Status) > 0 && !slices.Contains(studentStatuses, f.Status) {
+		return &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: "Invalid value for the status parameter",
+		}
+	}
+	return nil
+}
+
+type StudentsResponse struct {
+	Students []Student `json:"students"`
+	// The cursor of the next page, 0 once there are no more
+	Next uint64 `json:"next"`
+}
+
+type StudentStatusRequest struct {
+	Status StudentStatus `json:"status"`
+	Reason *string       `json:"reason,omitempty" encore:"optional"`
+}
+
+func (s StudentStatusRequest) Validate() error {
+	msgs := make([]string, 0)
+
+	if !slices.Contains(studentStatuses, s.Status) {
+		msgs = append(msgs, "Invalid value for the status field")
+	}
+
+	if s.Reason != nil && len(*s.Reason) > 500 {
+		msgs = append(msgs, "The reason field cannot be longer than 500 characters")
+	}
+
+	if len(msgs) > 0 {
+		return &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: strings.Join(msgs, "\n"),
+		}
+	}
+	return nil
+}
+
+type StudentStatusChange struct {
+	Id             uint64         `json:"id"`
+	Student        uint64         `json:"student"`
+	Status         StudentStatus  `json:"status"`
+	PreviousStatus *StudentStatus `json:"previousStatus,omitempty" encore:"optional"`
+	Reason         *string        `json:"reason,omitempty" encore:"optional"`
+	ChangedBy      *uint64        `json:"changedBy,omitempty" encore:"optional"`
+	ChangedAt      time.Time      `json:"changedAt"`
+}
+
+type StudentStatusHistoryResponse struct {
+	Changes []StudentStatusChange `json:"changes"`
+}
+
+type StudentAccountRequest struct {
+	User uint64 `json:"user"`
+}
+
+func (s StudentAccountRequest) Validate() error {
+	if s.User == 0 {
+		return &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: "The user field is required",
+		}
+	}
+	return nil
+}
+
+type StudentGuardian struct {
+	Id           uint64               `json:"id"`
+	Student      uint64               `json:"student"`
+	Name         string               `json:"name"`
+	Relationship GuardianRelationship `json:"relationship"`
+	Phone        *string              `json:"phone,omitempty" encore:"optional"`
+	Email        *string              `json:"email,omitempty" encore:"optional"`
+	Address      *string              `json:"address,omitempty" encore:"optional"`
+	IsPrimary    bool                 `json:"isPrimary"`
+	// The user account of the guardian, which can view the student's records
+	Account   *uint64    `json:"account,omitempty" encore:"optional"`
+	LinkedAt  *time.Time `json:"linkedAt,omitempty" encore:"optional"`
+	CreatedAt time.Time  `json:"createdAt"`
+	UpdatedAt time.Time  `json:"updatedAt"`
+}
+
+type NewStudentGuardianRequest struct {
+	Name         string               `json:"name"`
+	Relationship GuardianRelationship `json:"relationship"`
+	Phone        *string              `json:"phone,omitempty" encore:"optional"`
+	Email        *string              `json:"email,omitempty" encore:"optional"`
+	Address      *string              `json:"address,omitempty" encore:"optional"`
+	// The primary guardian is contacted first. Setting it demotes the current primary guardian.
+	IsPrimary bool `json:"isPrimary"`
+}
+
+func (n NewStudentGuardianRequest) Validate() error {
+	msgs := make([]string, 0)
+
+	if len(strings.TrimSpace(n.Name)) == 0 {
+		msgs = append(msgs, "The name field is required")
+	} else if len(n.Name) > 255 {
+		msgs = append(msgs, "The name field cannot be longer than 255 characters")
+	}
+
+	if !slices.Contains(guardianRelationships, n.Relationship) {
+		msgs = append(msgs, "Invalid value for the relationship field")
+	}
+
+	if n.Phone == nil && n.Email == nil {
+		msgs = append(msgs, "At least one of the phone and email fields is required")
+	}
+
+	msgs = append(msgs, validateContactFields(n.Address, n.Phone, n.Email)...)
+
+	if len(msgs) > 0 {
+		return &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: strings.Join(msgs, "\n"),
+		}
+	}
+	return nil
+}
+
+type StudentGuardiansResponse struct {
+	Guardians []StudentGuardian `json:"guardians"`
+}
+
+type GuardianInvitation struct {
+	Id       uint64 `json:"id"`
+	Guardian uint64 `json:"guardian"`
+	Student  uint64 `json:"student"`
+	// The address the invitation was sent to
+	Email     string    `json:"email"`
+	InvitedBy uint64    `json:"invitedBy"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type NewGuardianInvitationRequest struct {
+	// The address the invitation is sent to, the guardian's email address when absent
+	Email *string `json:"email,omitempty" encore:"optional"`
+}
+
+func (n NewGuardianInvitationRequest) Validate() error {
+	if n.Email != nil {
+		if _, err := mail.ParseAddress(*n.Email); err != nil {
+			return &errs.Error{
+				Code:    errs.InvalidArgument,
+				Message: "Invalid value for the email field",
+			}
+		}
+	}
+	return nil
+}
+
+type AcceptGuardianInvitationRequest struct {
+	// The token received in the invitation email
+	Token string `json:"token"`
+}
+
+func (a AcceptGuardianInvitationRequest) Validate() error {
+	if len(a.Token) == 0 {
+		return &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: "The token field is required",
+		}
+	}
+	return nil
+}
+
+type StudentMedicalNote struct {
+	Id         uint64              `json:"id"`
+	Student    uint64              `json:"student"`
+	Category   MedicalNoteCategory `json:"category"`
+	Note       string              `json:"note"`
+	RecordedBy uint64              `json:"recordedBy"`
+	RecordedAt time.Time           `json:"recordedAt"`
+}
+
+type NewStudentMedicalNoteRequest struct {
+	Category MedicalNoteCategory `json:"category"`
+	Note     string              `json:"note"`
+}
+
+func (n NewStudentMedicalNoteRequest) Validate() error {
+	msgs := make([]string, 0)
+
+	if !slices.Contains(medicalNoteCategories, n.Category) {
+		msgs = append(msgs, "Invalid value for the category field")
+	}
+
+	if len(strings.TrimSpace(n.Note)) == 0 {
+		msgs = append(msgs, "The note field is required")
+	} else if len(n.Note) > 2000 {
+		msgs = append(msgs, "The note field cannot be longer than 2000 characters")
+	}
+
+	if len(msgs) > 0 {
+		return &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: strings.Join(msgs, "\n"),
+		}
+	}
+	return nil
+}
+
+type StudentMedicalNotesResponse struct {
+	Notes []StudentMedicalNote `json:"notes"`
+}
+
+func validateStudentFields(firstName, lastName *string, gender *Gender, dateOfBirth *time.Time, placeOfBirth, nationality, address, phone, email *string) (msgs []string) {
+	if firstName != nil && len(strings.TrimSpace(*firstName)) == 0 {
+		msgs = append(msgs, "The firstName field is required")
+	} else if firstName != nil && len(*firstName) > 100 {
+		msgs = append(msgs, "The firstName field cannot be longer than 100 characters")
+	}
+
+	if lastName != nil && len(strings.TrimSpace(*lastName)) == 0 {
+		msgs = append(msgs, "The lastName field is required")
+	} else if lastName != nil && len(*lastName) > 100 {
+		msgs = append(msgs, "The lastName field cannot be longer than 100 characters")
+	}
+
+	if gender != nil {
+		if err := gender.Validate(); err != nil {
+			msgs = append(msgs, "Invalid value for the gender field")
+		}
+	}
+
+	if dateOfBirth != nil && dateOfBirth.After(time.Now()) {
+		msgs = append(msgs, "The date of birth cannot be in the future")
+	}
+
+	if placeOfBirth != nil && len(*placeOfBirth) > 255 {
+		msgs = append(msgs, "The placeOfBirth field cannot be longer than 255 characters")
+	}
+
+	if nationality != nil && len(*nationality) > 100 {
+		msgs = append(msgs, "The nationality field cannot be longer than 100 characters")
+	}
+
+	msgs = append(msgs, validateContactFields(address, phone, email)...)
+	return
+}
+
+func validateContactFields(address, phone, email *string) (msgs []string) {
+	if address != nil && len(*address) > 500 {
+		msgs = append(msgs, "The address field cannot be longer than 500 characters")
+	}
+
+	if phone != nil && len(*phone) > 30 {
+		msgs = append(msgs, "The phone field cannot be longer than 30 characters")
+	}
+
+	if email != nil {
+		if _, err := mail.ParseAddress(*email); err != nil {
+			msgs = append(msgs, "Invalid value for the email field")
+		}
+	}
+	return
+}
@@ -2,6 +2,10 @@ package dto
 
 import (
 	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
 	"strings"
 	"time"
 
@@ -53,6 +57,12 @@ type FindTenantsRequest struct {
 
 type FindTenantResponse struct {
 	Tenants []TenantLookup `json:"tenants"`
+	// The total number of viewable tenants
+	Total uint `json:"total"`
+	// Whether another page follows this one
+	HasMore bool `json:"hasMore"`
+	// The cursor of the next page, absent on the last page
+	Next uint64 `json:"next,omitempty" encore:"optional"`
 }
 
 type TenantLookup struct {
@@ -61,6 +71,129 @@ type TenantLookup struct {
 	CreatedAt        time.Time `json:"createdAt"`
 	UpdatedAt        time.Time `json:"updatedAt"`
 	SubscriptionPlan string    `json:"subscriptionPlan"`
+	// The tenant's branding and contact details. Only set when a single tenant is looked up
+	Profile *TenantProfile `json:"profile,omitempty" encore:"optional"`
+}
+
+type TenantAddress struct {
+	Street     string `json:"street,omitempty" encore:"optional"`
+	City       string `json:"city,omitempty" encore:"optional"`
+	Region     string `json:"region,omitempty" encore:"optional"`
+	PostalCode string `json:"postalCode,omitempty" encore:"optional"`
+	// ISO 3166-1 alpha-2 country code
+	Country string `json:"country,omitempty" encore:"optional"`
+}
+
+type TenantProfile struct {
+	// The URL of the tenant's logo
+	Logo *string `json:"logo,omitempty" encore:"optional"`
+	// Hex color code, e.g. #1a2b3c
+	PrimaryColor *string `json:"primaryColor,omitempty" encore:"optional"`
+	// Hex color code, e.g. #1a2b3c
+	SecondaryColor *string        `json:"secondaryColor,omitempty" encore:"optional"`
+	ContactEmail   *string        `json:"contactEmail,omitempty" encore:"optional"`
+	ContactPhone   *string        `json:"contactPhone,omitempty" encore:"optional"`
+	Website        *string        `json:"website,omitempty" encore:"optional"`
+	Address        *TenantAddress `json:"address,omitempty" encore:"optional"`
+}
+
+var hexColorRegex = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+var countryCodeRegex = regexp.MustCompile(`^[A-Z]{2}$`)
+
+func (p TenantProfile) validate() (msgs []string) {
+	if p.PrimaryColor != nil && !hexColorRegex.MatchString(*p.PrimaryColor) {
+		msgs = append(msgs, "Invalid value for primaryColor")
+	}
+
+	if p.SecondaryColor != nil && !hexColorRegex.MatchString(*p.SecondaryColor) {
+		msgs = append(msgs, "Invalid value for secondaryColor")
+	}
+
+	if p.ContactEmail != nil && !emailRegex.MatchString(*p.ContactEmail) {
+		msgs = append(msgs, "Invalid value for contactEmail")
+	}
+
+	for field, value := range map[string]*string{"logo": p.Logo, "website": p.Website} {
+		if value == nil {
+			continue
+		}
+		if u, err := url.Parse(*value); err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+			msgs = append(msgs, fmt.Sprintf("Invalid value for %s", field))
+		}
+	}
+
+	if p.Address != nil && len(p.Address.Country) > 0 && !countryCodeRegex.MatchString(p.Address.Country) {
+		msgs = append(msgs, "Invalid value for address.country")
+	}
+	return
+}
+
+type UpdateTenantRequest struct {
+	Name    string        `json:"name"`
+	Profile TenantProfile `json:"profile"`
+}
+
+func (u UpdateTenantRequest) Validate() error {
+	var msgs = make([]string, 0)
+
+	if len(strings.TrimSpace(u.Name)) == 0 {
+		msgs = append(msgs, "The name field is required")
+	}
+
+	msgs = append(msgs, u.Profile.validate()...)
+
+	if len(msgs) > 0 {
+		return &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: strings.Join(msgs, "\n"),
+		}
+	}
+	return nil
+}
+
+type NewTenantDomainRequest struct {
+	// A domain or subdomain, e.g. school.example.com
+	Hostname string `json:"hostname"`
+}
+
+var hostnameRegex = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z]{2,63}$`)
+
+func (n NewTenantDomainRequest) Validate() error {
+	if !hostnameRegex.MatchString(strings.ToLower(strings.TrimSuffix(n.Hostname, "."))) {
+		return &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: "Invalid hostname",
+		}
+	}
+	return nil
+}
+
+// The DNS record proving control of a domain
+type DomainVerificationRecord struct {
+	Type  string `json:"type"`
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type TenantDomain struct {
+	Id            uint64     `json:"id"`
+	Hostname      string     `json:"hostname"`
+	Verified      bool       `json:"verified"`
+	VerifiedAt    *time.Time `json:"verifiedAt,omitempty" encore:"optional"`
+	LastCheckedAt *time.Time `json:"lastCheckedAt,omitempty" encore:"optional"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	// The record to create before requesting verification. Absent once verified
+	Record *DomainVerificationRecord `json:"record,omitempty" encore:"optional"`
+}
+
+type TenantDomainsResponse struct {
+	Domains []TenantDomain `json:"domains"`
+}
+
+type ResolveHostnameResponse struct {
+	Tenant   uint64 `json:"tenant"`
+	Name     string `json:"name"`
+	Hostname string `json:"hostname"`
 }
 
 type NewSubscriptionPlan struct {
@@ -97,3 +230,186 @@ func (n NewTenantRequest) Validate() error {
 	}
 	return nil
 }
+
+// The roles a user can be invited to in a tenant
+var InvitableTenantRoles = []PermissionName{PNAdmin, PNMaintainer}
+
+type NewTenantInvitationRequest struct {
+	// The invitee's email address
+	Email string `json:"email"`
+	// The role given to the invitee once they accept
+	Role PermissionName `json:"role"`
+}
+
+func (n NewTenantInvitationRequest) Validate() error {
+	var msgs = make([]string, 0)
+
+	if !emailRegex.MatchString(n.Email) {
+		msgs = append(msgs, "Invalid email address")
+	}
+
+	if !slices.Contains(InvitableTenantRoles, n.Role) {
+		msgs = append(msgs, "Invalid value for role")
+	}
+
+	if len(msgs) > 0 {
+		return &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: strings.Join(msgs, "\n"),
+		}
+	}
+	return nil
+}
+
+type TenantInvitation struct {
+	Id        uint64         `json:"id"`
+	Tenant    uint64         `json:"tenant"`
+	Email     string         `json:"email"`
+	Role      PermissionName `json:"role"`
+	InvitedBy uint64         `json:"invitedBy"`
+	ExpiresAt time.Time      `json:"expiresAt"`
+	CreatedAt time.Time      `json:"createdAt"`
+}
+
+type TenantInvitationsResponse struct {
+	Invitations []TenantInvitation `json:"invitations"`
+}
+
+type InvitedAccount struct {
+	// The user's first name
+	FirstName string `json:"firstName"`
+	// The user's last name (optional)
+	LastName string `json:"lastName,omitempty" encore:"optional"`
+	// The user's date of birth (YYYY/MM/DD)
+	Dob string `json:"dob"`
+	// The user's plaintext password
+	Password string `json:"password" encore:"sensitive"`
+	// Password verification
+	ConfirmPassword string `json:"confirmPassword" encore:"sensitive"`
+	// The user's phone number in IE64 format
+	Phone string `json:"phone,omitempty" encore:"optional"`
+	// The user's gender
+	Gender Gender `json:"gender,omitempty" encore:"optional"`
+}
+
+type AcceptTenantInvitationRequest struct {
+	// The token received in the invitation email
+	Token string `json:"token" encore:"sensitive"`
+	// The account to create when the invited email address has none
+	Account      *InvitedAccount `json:"account,omitempty" encore:"optional"`
+	CaptchaToken string          `json:"captchaToken"`
+}
+
+func (a AcceptTenantInvitationRequest) GetCaptchaToken() string {
+	return a.CaptchaToken
+}
+
+func (a AcceptTenantInvitationRequest) Validate() error {
+	var msgs = make([]string, 0)
+
+	if len(a.CaptchaToken) == 0 {
+		msgs = append(msgs, "The captchaToken field is required")
+	}
+
+	if len(a.Token) == 0 {
+		msgs = append(msgs, "The token field is required")
+	}
+
+	if len(msgs) > 0 {
+		return &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: strings.Join(msgs, "\n"),
+		}
+	}
+	return nil
+}
+
+type AcceptTenantInvitationResponse struct {
+	Tenant uint64         `json:"tenant"`
+	Role   PermissionName `json:"role"`
+	// Whether an account was created for the invitee
+	AccountCreated bool `json:"accountCreated"`
+}
+
+type NewOwnershipTransferRequest struct {
+	// The ID of the user who will become the new owner
+	NewOwner uint64 `json:"newOwner"`
+	// Whether the current owner keeps admin access after the transfer
+	DemoteToAdmin bool `json:"demoteToAdmin,omitempty" encore:"optional"`
+}
+
+func (n NewOwnershipTransferRequest) Validate() error {
+	if n.NewOwner == 0 {
+		return &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: "The newOwner field is required",
+		}
+	}
+	return nil
+}
+
+type OwnershipTransfer struct {
+	Id            uint64    `json:"id"`
+	Tenant        uint64    `json:"tenant"`
+	FromUser      uint64    `json:"fromUser"`
+	ToUser        uint64    `json:"toUser"`
+	DemoteToAdmin bool      `json:"demoteToAdmin"`
+	ExpiresAt     time.Time `json:"expiresAt"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+type ConfirmOwnershipTransferRequest struct {
+	// The token received in the transfer email
+	Token string `json:"token" encore:"sensitive"`
+}
+
+func (c ConfirmOwnershipTransferRequest) Validate() error {
+	if len(c.Token) == 0 {
+		return &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: "The token field is required",
+		}
+	}
+	return nil
+}
+
+type TenantDeletionStatus string
+
+const (
+	TDSScheduled  TenantDeletionStatus = "scheduled"
+	TDSInProgress TenantDeletionStatus = "in_progress"
+	TDSCompleted  TenantDeletionStatus = "completed"
+	TDSRestored   TenantDeletionStatus = "restored"
+	// A step kept failing after every retry. The tenant stays hidden until the deletion is looked into.
+	TDSFailed TenantDeletionStatus = "failed"
+)
+
+type TenantDeletionStepStatus string
+
+const (
+	TDSSPending TenantDeletionStepStatus = "pending"
+	TDSSDone    TenantDeletionStepStatus = "done"
+	TDSSFailed  TenantDeletionStepStatus = "failed"
+)
+
+type TenantDeletionStep struct {
+	Step      string                   `json:"step"`
+	Status    TenantDeletionStepStatus `json:"status"`
+	Attempts  uint                     `json:"attempts"`
+	LastError *string                  `json:"lastError,omitempty" encore:"optional"`
+	UpdatedAt time.Time                `json:"updatedAt"`
+}
+
+type TenantDeletion struct {
+	Id          uint64               `json:"id"`
+	Tenant      uint64               `json:"tenant"`
+	Status      TenantDeletionStatus `json:"status"`
+	Reason      string               `json:"reason"`
+	RequestedBy uint64               `json:"requestedBy"`
+	// The tenant can be restored until this moment
+	RestoreUntil time.Time            `json:"restoreUntil"`
+	CreatedAt    time.Time            `json:"createdAt"`
+	StartedAt    *time.Time           `json:"startedAt,omitempty" encore:"optional"`
+	CompletedAt  *time.Time           `json:"completedAt,omitempty" encore:"optional"`
+	Steps        []TenantDeletionStep `json:"steps"`
+}
@@ -0,0 +1,357 @@
+package dto
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"encore.dev/beta/errs"
+)
+
+// The days of the week timetables cover when none are given, Monday to Friday
+var DefaultTimetableDays = []int{1, 2, 3, 4, 5}
+
+type Room struct {
+	Id          uint64    `json:"id"`
+	Institution uint64    `json:"institution"`
+	Name        string    `json:"name"`
+	Capacity    *uint     `json:"capacity,omitempty" encore:"optional"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+type NewRoomRequest struct {
+	Name string `json:"name"`
+	// The number of students the room seats
+	Capacity *uint `json:"capacity,omitempty" encore:"optional"`
+}
+
+func (n NewRoomRequest) Validate() error {
+	msgs := validateRoomFields(&n.Name, n.Capacity)
+
+	if len(msgs) > 0 {
+		return &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: strings.Join(msgs, "\n"),
+		}
+	}
+	return nil
+}
+
+type UpdateRoomRequest struct {
+	Name *string `json:"name,omitempty" encore:"optional"`
+	// Set to 0 to remove the capacity
+	Capacity *uint `json:"capacity,omitempty" encore:"optional"`
+}
+
+func (u UpdateRoomRequest) Validate() error {
+	msgs := make([]string, 0)
+
+	if u.Name == nil && u.Capacity == nil {
+		msgs = append(msgs, "At least one field must be provided")
+	}
+
+	if u.Capacity != nil && *u.Capacity == 0 {
+		msgs = append(msgs, validateRoomFields(u.Name, nil)...)
+	} else {
+		msgs = append(msgs, validateRoomFields(u.Name, u.Capacity)...)
+	}
+
+	if len(msgs) > 0 {
+		return &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: strings.Join(msgs, "\n"),
+		}
+	}
+	return nil
+}
+
+type RoomsResponse struct {
+	Rooms []Room `json:"rooms"`
+}
+
+type TimetablePeriod struct {
+	// The position of the period in the day, starting at 1
+	Number int     `json:"number"`
+	Label  *string `json:"label,omitempty" encore:"optional"`
+	// The time of day the period starts at, as HH:MM
+	StartsAt string `json:"startsAt"`
+	// The time of day the period ends at, as HH:MM
+	EndsAt string `json:"endsAt"`
+}
+
+type TimetablePeriodEntry struct {
+	Label    *string `json:"label,omitempty" encore:"optional"`
+	StartsAt string  `json:"startsAt"`
+	EndsAt   string  `json:"endsAt"`
+}
+
+type Timetable struct {
+	Id           uint64 `json:"id"`
+	Institution  uint64 `json:"institution"`
+	AcademicTerm uint64 `json:"academicTerm"`
+	// The ISO days of the week classes are held on, 1 being Monday
+	Days      []int             `json:"days"`
+	Periods   []TimetablePeriod `json:"periods"`
+	CreatedBy uint64            `json:"createdBy"`
+	CreatedAt time.Time         `json:"createdAt"`
+	UpdatedAt time.Time         `json:"updatedAt"`
+}
+
+// Creates the weekly timetable of a term
+type NewTimetableRequest struct {
+	AcademicTerm uint64 `json:"academicTerm"`
+	// The ISO days of the week classes are held on, 1 being Monday. Defaults to Monday to Friday.
+	Days []int `json:"days,omitempty" encore:"optional"`
+	// The periods of each day, in chronological order. They are numbered from 1 in the same order.
+	Periods []TimetablePeriodEntry `json:"periods"`
+}
+
+func (n NewTimetableRequest) Validate() error {
+	msgs := make([]string, 0)
+
+	if n.AcademicTerm == 0 {
+		msgs = append(msgs, "The academicTerm field is required")
+	}
+
+	if len(n.Periods) == 0 {
+		msgs = append(msgs, "At least one period is required")
+	}
+
+	msgs = append(msgs, validateTimetableFields(n.Days, n.Periods)...)
+
+	if len(msgs) > 0 {
+		return &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: strings.Join(msgs, "\n"),
+		}
+	}
+	return nil
+}
+
+// Changes the days and periods of a timetable. The slots on the days and periods which are removed are deleted.
+type UpdateTimetableRequest struct {
+	Days    []int                  `json:"days,omitempty" encore:"optional"`
+	Periods []TimetablePeriodEntry `json:"periods,omitempty" encore:"optional"`
+}
+
+func (u UpdateTimetableRequest) Validate() error {
+	msgs := make([]string, 0)
+
+	if len(u.Days) == 0 && len(u.Periods) == 0 {
+		msgs = append(msgs, "At least one field must be provided")
+	}
+
+	msgs = append(msgs, validateTimetableFields(u.Days, u.Periods)...)
+
+	if len(msgs) > 0 {
+		return &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: strings.Join(msgs, "\n"),
+		}
+	}
+	return nil
+}
+
+type FindTimetablesRequest struct {
+	// Only lists the timetable of this term when set
+	AcademicTerm uint64 `query:"term"`
+}
+
+type TimetablesResponse struct {
+	Timetables []Timetable `json:"timetables"`
+}
+
+type TimetableSlot struct {
+	// 0 for the slots of proposals which were not applied
+	Id          uint64  `json:"id"`
+	Timetable   uint64  `json:"timetable"`
+	Class       uint64  `json:"class"`
+	ClassName   string  `json:"className"`
+	Day         int     `json:"day"`
+	Period      int     `json:"period"`
+	Course      uint64  `json:"course"`
+	Subject     uint64  `json:"subject"`
+	SubjectName string  `json:"subjectName"`
+	Teacher     *uint64 `json:"teacher,omitempty" encore:"optional"`
+	Room        *uint64 `json:"room,omitempty" encore:"optional"`
+	RoomName    *string `json:"roomName,omitempty" encore:"optional"`
+	StartsAt    string  `json:"startsAt"`
+	EndsAt      string  `json:"endsAt"`
+}
+
+type NewTimetableSlotRequest struct {
+	Class  uint64 `json:"class"`
+	Day    int    `json:"day"`
+	Period int    `json:"period"`
+	Course uint64 `json:"course"`
+	// Defaults to the teacher of the course
+	Teacher *uint64 `json:"teacher,omitempty" encore:"optional"`
+	Room    *uint64 `json:"room,omitempty" encore:"optional"`
+}
+
+func (n NewTimetableSlotRequest) Validate() error {
+	msgs := make([]string, 0)
+
+	if n.Class == 0 {
+		msgs = append(msgs, "The class field is required")
+	}
+
+	if n.Course == 0 {
+		msgs = append(msgs, "The course field is required")
+	}
+
+	msgs = append(msgs, validateTimetableSlotFields(&n.Day, &n.Period)...)
+
+	if len(msgs) > 0 {
+		return &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: strings.Join(msgs, "\n"),
+		}
+	}
+	return nil
+}
+
+type UpdateTimetableSlotRequest struct {
+	Day    *int    `json:"day,omitempty" encore:"optional"`
+	Period *int    `json:"period,omitempty" encore:"optional"`
+	Course *uint64 `json:"course,omitempty" encore:"optional"`
+	// Set to 0 to remove the teacher
+	Teacher *uint64 `json:"teacher,omitempty" encore:"optional"`
+	// Set to 0 to remove the room
+	Room *uint64 `json:"room,omitempty" encore:"optional"`
+}
+
+func (u UpdateTimetableSlotRequest) Validate() error {
+	msgs := make([]string, 0)
+
+	if u.Day == nil && u.Period == nil && u.Course == nil && u.Teacher == nil && u.Room == nil {
+		msgs = append(msgs, "At least one field must be provided")
+	}
+
+	if u.Course != nil && *u.Course == 0 {
+		msgs = append(msgs, "The course field cannot be empty")
+	}
+
+	msgs = append(msgs, validateTimetableSlotFields(u.Day, u.Period)...)
+
+	if len(msgs) > 0 {
+		return &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: strings.Join(msgs, "\n"),
+		}
+	}
+	return nil
+}
+
+// The slots of a timetable seen from a class, a teacher or a room
+type TimetableViewResponse struct {
+	Timetable Timetable       `json:"timetable"`
+	Slots     []TimetableSlot `json:"slots"`
+}
+
+// Proposes the slots of classes from the weekly periods of their subjects, keeping the slots of the other classes
+type ProposeTimetableRequest struct {
+	// The classes to schedule, every class of the term's academic year when absent
+	Classes []uint64 `json:"classes,omitempty" encore:"optional"`
+	// Replaces the slots of the classes with the proposal
+	Apply bool `json:"apply"`
+}
+
+func (p ProposeTimetableRequest) Validate() error {
+	msgs := make([]string, 0)
+
+	seen := make(map[uint64]bool)
+	for i, c := range p.Classes {
+		if c == 0 {
+			msgs = append(msgs, fmt.Sprintf("Invalid value for class %d", i+1))
+		} else if seen[c] {
+			msgs = append(msgs, fmt.Sprintf("Class %d appears more than once", i+1))
+		}
+		seen[c] = true
+	}
+
+	if len(msgs) > 0 {
+		return &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: strings.Join(msgs, "\n"),
+		}
+	}
+	return nil
+}
+
+// The periods of a course which could not be scheduled
+type UnscheduledLesson struct {
+	Class       uint64 `json:"class"`
+	Course      uint64 `json:"course"`
+	SubjectName string `json:"subjectName"`
+	Periods     uint   `json:"periods"`
+	Reason      string `json:"reason"`
+}
+
+type TimetableProposal struct {
+	Slots       []TimetableSlot     `json:"slots"`
+	Unscheduled []UnscheduledLesson `json:"unscheduled"`
+	Applied     bool                `json:"applied"`
+}
+
+func validateRoomFields(name *string, capacity *uint) (msgs []string) {
+	if name != nil && len(strings.TrimSpace(*name)) == 0 {
+		msgs = append(msgs, "The name field is required")
+	} else if name != nil && len(*name) > 100 {
+		msgs = append(msgs, "The name field cannot be longer than 100 characters")
+	}
+
+	if capacity != nil && (*capacity == 0 || *capacity > 10000) {
+		msgs = append(msgs, "The capacity field must be greater than 0 and at most 10000")
+	}
+	return
+}
+
+func validateTimetableFields(days []int, periods []TimetablePeriodEntry) (msgs []string) {
+	for i, d := range days {
+		if d < 1 || d > 7 {
+			msgs = append(msgs, fmt.Sprintf("Invalid value for day %d", i+1))
+		} else if slices.Index(days, d) != i {
+			msgs = append(msgs, fmt.Sprintf("Day %d appears more than once", i+1))
+		}
+	}
+
+	var previous time.Time
+	for i, p := range periods {
+		if p.Label != nil && len(*p.Label) > 50 {
+			msgs = append(msgs, fmt.Sprintf("The label field of period %d cannot be longer than 50 characters", i+1))
+		}
+
+		start, err := time.Parse("15:04", p.StartsAt)
+		if err != nil {
+			msgs = append(msgs, fmt.Sprintf("The startsAt field of period %d must be a time of day such as 08:00", i+1))
+			continue
+		}
+		end, err := time.Parse("15:04", p.EndsAt)
+		if err != nil {
+			msgs = append(msgs, fmt.Sprintf("The endsAt field of period %d must be a time of day such as 08:55", i+1))
+			continue
+		}
+
+		if !start.Before(end) {
+			msgs = append(msgs, fmt.Sprintf("Period %d must start before it ends", i+1))
+		} else if i > 0 && start.Before(previous) {
+			msgs = append(msgs, fmt.Sprintf("Period %d starts before the previous one ends", i+1))
+		}
+		previous = end
+	}
+	return
+}
+
+func validateTimetableSlotFields(day, period *int) (msgs []string) {
+	if day != nil && (*day < 1 || *day > 7) {
+		msgs = append(msgs, "The day field must be an ISO day of the week, from 1 for Monday to 7 for Sunday")
+	}
+
+	if period != nil && *period < 1 {
+		msgs = append(msgs, "The period field must be greater than 0")
+	}
+	return
+}
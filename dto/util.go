@@ -1,10 +1,20 @@
 package dto
 
+// The page size used when a request does not specify one
+const DefaultPageSize uint = 10
+
 type CursorBasedPaginationParams struct {
 	After uint64 `query:"after"`
 	Size  uint   `query:"size"`
 }
 
+func (p CursorBasedPaginationParams) PageSize() uint {
+	if p.Size == 0 {
+		return DefaultPageSize
+	}
+	return p.Size
+}
+
 type PageBasedPaginationParams struct {
 	Page uint `query:"page" json:"page"`
 	Size uint `query:"size" json:"size"`
@@ -12,7 +22,7 @@ type PageBasedPaginationParams struct {
 
 func (p *PageBasedPaginationParams) Validate() error {
 	if p.Size == 0 {
-		p.Size = 10
+		p.Size = DefaultPageSize
 	}
 	return nil
 }
@@ -25,3 +35,14 @@ type PaginatedResponse[T any] struct {
 	Data []*T                  `json:"data"`
 	Meta PaginatedResponseMeta `json:"meta"`
 }
+
+// Identifies the data owned by a set of owners of the same type, for bulk removal
+type PurgeOwnedRequest struct {
+	OwnerType PermissionType
+	Owners    []uint64
+}
+
+type PurgeResponse struct {
+	// The number of records removed
+	Deleted uint
+}
@@ -0,0 +1,14 @@
+package exports
+
+import (
+	"encore.dev/storage/objects"
+	"github.com/brinestone/scholaris/blob"
+)
+
+// Export archives are written to the uploads bucket, next to the files they include and the files staged for them
+var uploads = objects.BucketRef[interface {
+	objects.Uploader
+	objects.Downloader
+	objects.Remover
+	objects.Lister
+}](blob.UploadsBucket)
@@ -0,0 +1,15 @@
+package exports
+
+import "encore.dev/cron"
+
+var _ = cron.NewJob("expire-tenant-exports", cron.JobConfig{
+	Title:    "Remove the archives of expired tenant exports",
+	Schedule: "0 * * * *", // ! Every hour
+	Endpoint: ExpireTenantExports,
+})
+
+var _ = cron.NewJob("fail-stalled-tenant-exports", cron.JobConfig{
+	Title:    "Fail the tenant exports which stopped making progress",
+	Schedule: "*/15 * * * *", // ! Every 15 minutes
+	Endpoint: FailStalledTenantExports,
+})
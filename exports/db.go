@@ -0,0 +1,7 @@
+package exports
+
+import "encore.dev/storage/sqldb"
+
+var db = sqldb.NewDatabase("exports_db", sqldb.DatabaseConfig{
+	Migrations: "./migrations",
+})
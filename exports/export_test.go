@@ -0,0 +1,8 @@
+package exports
+
+import "context"
+
+// BuildTenantExport runs the job building the archive of an export.
+func BuildTenantExport(ctx context.Context, export uint64) error {
+	return onTenantExportRequested(ctx, &TenantExportRequested{Export: export})
+}
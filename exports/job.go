@@ -0,0 +1,252 @@
+package exports
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"time"
+
+	"encore.dev/rlog"
+	"encore.dev/storage/objects"
+	"github.com/brinestone/scholaris/blob"
+	"github.com/brinestone/scholaris/dto"
+	"github.com/brinestone/scholaris/forms"
+	"github.com/brinestone/scholaris/institutions"
+	"github.com/brinestone/scholaris/models"
+	"github.com/brinestone/scholaris/settings"
+	"github.com/brinestone/scholaris/tenants"
+)
+
+// The steps of an export, each collecting the tenant's data held by one service into a directory of the archive.
+// Services stage the files they export under the given prefix of the uploads bucket.
+var exportSteps = []struct {
+	name    string
+	dir     string
+	collect func(ctx context.Context, tenant uint64, prefix string) (*dto.ExportResponse, error)
+}{
+	{"tenant", "tenant", func(ctx context.Context, tenant uint64, prefix string) (*dto.ExportResponse, error) {
+		return tenants.ExportTenantData(ctx, tenant)
+	}},
+	{"institutions", "institutions", func(ctx context.Context, tenant uint64, prefix string) (*dto.ExportResponse, error) {
+		return institutions.ExportOwnedInstitutions(ctx, tenantOwned(tenant, prefix))
+	}},
+	{"forms", "tenant/forms", func(ctx context.Context, tenant uint64, prefix string) (*dto.ExportResponse, error) {
+		return forms.ExportOwnedForms(ctx, tenantOwned(tenant, prefix))
+	}},
+	{"settings", "tenant/settings", func(ctx context.Context, tenant uint64, prefix string) (*dto.ExportResponse, error) {
+		return settings.ExportOwnedSettings(ctx, tenantOwned(tenant, prefix))
+	}},
+	{"uploads", "tenant/uploads", func(ctx context.Context, tenant uint64, prefix string) (*dto.ExportResponse, error) {
+		return blob.ExportOwnedUploads(ctx, tenantOwned(tenant, prefix))
+	}},
+	{"archive", "", nil},
+}
+
+func tenantOwned(tenant uint64, prefix string) dto.ExportOwnedRequest {
+	return dto.ExportOwnedRequest{OwnerType: dto.PTTenant, Owners: []uint64{tenant}, Prefix: prefix}
+}
+
+// Describes the contents of an archive
+type exportManifest struct {
+	Export      uint64    `json:"export"`
+	Tenant      uint64    `json:"tenant"`
+	GeneratedAt time.Time `json:"generatedAt"`
+	Files       []string  `json:"files"`
+	// Uploaded files which could not be found in the bucket
+	MissingFiles []string `json:"missingFiles"`
+}
+
+// Builds an export's archive. Any failure marks the export as failed rather than leaving it in progress; a new
+// export can then be requested.
+func onTenantExportRequested(ctx context.Context, msg *TenantExportRequested) (err error) {
+	export, err := findTenantExportById(ctx, msg.Export)
+	if err != nil {
+		return
+	}
+
+	// A redelivered message restarts an interrupted export but leaves finished ones alone
+	if export.Status != string(dto.TESPending) && export.Status != string(dto.TESInProgress) {
+		return nil
+	}
+
+	defer removeStagedObjects(ctx, stagingPrefix(export))
+
+	step, err := buildTenantExport(ctx, export)
+	if err != nil {
+		rlog.Error("tenant export failed", "export", export.Id, "step", step, "err", err)
+		return failTenantExport(ctx, export.Id, step)
+	}
+	return
+}
+
+func buildTenantExport(ctx context.Context, export *models.TenantExport) (step string, err error) {
+	step = exportSteps[0].name
+	if _, err = db.Exec(ctx, "UPDATE tenant_exports SET status = $1, started_at = CURRENT_TIMESTAMP, completed_steps = 0, error = NULL WHERE id = $2;", dto.TESInProgress, export.Id); err != nil {
+		return
+	}
+
+	var data dto.ExportResponse
+	prefix := stagingPrefix(export)
+	for i, s := range exportSteps {
+		step = s.name
+		if _, err = db.Exec(ctx, "UPDATE tenant_exports SET current_step = $1, completed_steps = $2 WHERE id = $3;", s.name, i, export.Id); err != nil {
+			return
+		}
+
+		if s.collect == nil {
+			continue
+		}
+
+		var part *dto.ExportResponse
+		if part, err = s.collect(ctx, export.Tenant, path.Join(prefix, s.dir)); err != nil {
+			return
+		}
+		data.Include(s.dir, part)
+	}
+
+	key := fmt.Sprintf("exports/tenant-%d/%d.zip", export.Tenant, export.Id)
+	size, err := writeArchive(ctx, key, exportManifest{
+		Export:      export.Id,
+		Tenant:      export.Tenant,
+		GeneratedAt: time.Now(),
+	}, &data)
+	if err != nil {
+		return
+	}
+
+	expiresAt := time.Now().Add(exportValidity)
+	if _, err = db.Exec(ctx, `
+		UPDATE tenant_exports SET
+			status = $1, current_step = NULL, completed_steps = total_steps, object_key = $2, size = $3,
+			completed_at = CURRENT_TIMESTAMP, expires_at = $4
+		WHERE
+			id = $5;
+	`, dto.TESCompleted, key, size, expiresAt, export.Id); err != nil {
+		return
+	}
+
+	if _, err = CompletedTenantExports.Publish(ctx, &TenantExportCompleted{
+		Export:    export.Id,
+		Tenant:    export.Tenant,
+		Size:      size,
+		ExpiresAt: expiresAt,
+		Timestamp: time.Now(),
+	}); err != nil {
+		// The archive is ready, so the export is not failed for want of a notification
+		rlog.Error("could not announce a completed tenant export", "export", export.Id, "err", err)
+		err = nil
+	}
+	return
+}
+
+// Marks an export as failed. The error is not returned so that the export is not retried; a new one can be requested.
+func failTenantExport(ctx context.Context, id uint64, step string) (err error) {
+	_, err = db.Exec(ctx, "UPDATE tenant_exports SET status = $1, current_step = NULL, error = $2 WHERE id = $3 AND status IN ($4, $5);", dto.TESFailed, fmt.Sprintf("The %s step could not be completed", step), id, dto.TESPending, dto.TESInProgress)
+	return
+}
+
+// The prefix under which services stage the files of an export
+func stagingPrefix(export *models.TenantExport) string {
+	return fmt.Sprintf("exports/tenant-%d/%d/staging/", export.Tenant, export.Id)
+}
+
+// Removes the files staged for an archive once it has been written, or has failed
+func removeStagedObjects(ctx context.Context, prefix string) {
+	for entry, err := range uploads.List(ctx, &objects.Query{Prefix: prefix}) {
+		if err != nil {
+			rlog.Warn("could not list staged export files", "prefix", prefix, "err", err)
+			return
+		}
+		if err = uploads.Remove(ctx, entry.Name); err != nil && !errors.Is(err, objects.ErrObjectNotFound) {
+			rlog.Warn("could not remove a staged export file", "key", entry.Name, "err", err)
+		}
+	}
+}
+
+// Streams the collected files and objects into a zip archive in the uploads bucket, returning the archive's size
+func writeArchive(ctx context.Context, key string, manifest exportManifest, data *dto.ExportResponse) (size int64, err error) {
+	writer := uploads.Upload(ctx, key, objects.WithUploadAttrs(objects.UploadAttrs{ContentType: "application/zip"}))
+	counter := &countingWriter{w: writer}
+	archive := zip.NewWriter(counter)
+	defer func() {
+		if err != nil {
+			writer.Abort(err)
+		}
+	}()
+
+	for _, f := range data.Files {
+		var entry io.Writer
+		if entry, err = archive.Create(f.Path); err != nil {
+			return
+		}
+		if _, err = entry.Write(f.Content); err != nil {
+			return
+		}
+		manifest.Files = append(manifest.Files, f.Path)
+	}
+
+	for _, o := range data.Objects {
+		var copied bool
+		if copied, err = copyObject(ctx, archive, o); err != nil {
+			return
+		} else if !copied {
+			manifest.MissingFiles = append(manifest.MissingFiles, o.Path)
+			continue
+		}
+		manifest.Files = append(manifest.Files, o.Path)
+	}
+
+	entry, err := archive.Create("manifest.json")
+	if err != nil {
+		return
+	}
+	encoder := json.NewEncoder(entry)
+	encoder.SetIndent("", "  ")
+	if err = encoder.Encode(manifest); err != nil {
+		return
+	}
+
+	if err = archive.Close(); err != nil {
+		return
+	}
+	if err = writer.Close(); err != nil {
+		return
+	}
+
+	size = counter.n
+	return
+}
+
+func copyObject(ctx context.Context, archive *zip.Writer, o dto.ExportedObject) (copied bool, err error) {
+	reader := uploads.Download(ctx, o.Key)
+	if errors.Is(reader.Err(), objects.ErrObjectNotFound) {
+		return false, nil
+	} else if err = reader.Err(); err != nil {
+		return
+	}
+	defer reader.Close()
+
+	entry, err := archive.Create(o.Path)
+	if err != nil {
+		return
+	}
+	if _, err = io.Copy(entry, reader); err != nil {
+		return
+	}
+	return true, nil
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (n int, err error) {
+	n, err = c.w.Write(p)
+	c.n += int64(n)
+	return
+}
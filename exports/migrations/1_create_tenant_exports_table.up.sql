@@ -0,0 +1,21 @@
+CREATE TABLE
+    tenant_exports (
+        id BIGSERIAL PRIMARY KEY,
+        tenant BIGINT NOT NULL,
+        requested_by BIGINT NOT NULL,
+        status TEXT NOT NULL DEFAULT 'pending',
+        current_step TEXT,
+        completed_steps INT NOT NULL DEFAULT 0,
+        total_steps INT NOT NULL,
+        object_key TEXT,
+        size BIGINT,
+        error TEXT,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        started_at TIMESTAMP,
+        completed_at TIMESTAMP,
+        expires_at TIMESTAMP
+    );
+
+CREATE UNIQUE INDEX IDX_UQ_tenant_exports_active ON tenant_exports (tenant)
+WHERE
+    status IN ('pending', 'in_progress');
@@ -0,0 +1,293 @@
+// Asynchronous exports of a tenant's data
+package exports
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"encore.dev"
+	"encore.dev/beta/auth"
+	"encore.dev/beta/errs"
+	"encore.dev/rlog"
+	"encore.dev/storage/objects"
+	"encore.dev/storage/sqldb"
+	"github.com/brinestone/scholaris/core/permissions"
+	"github.com/brinestone/scholaris/dto"
+	"github.com/brinestone/scholaris/models"
+	"github.com/brinestone/scholaris/util"
+)
+
+const (
+	// How long a completed archive can be downloaded
+	exportValidity = time.Hour * 24 * 7
+	// How long an export may run before it is considered stalled. Longer than the build subscription's ack deadline.
+	exportStallTimeout = time.Hour
+)
+
+// Starts exporting a tenant's data in the background. The export's progress can be followed until its archive is ready.
+//
+//encore:api auth method=POST path=/exports
+func NewTenantExport(ctx context.Context, req dto.NewTenantExportRequest) (ans *dto.TenantExport, err error) {
+	uid, _ := auth.UserID()
+	userId, _ := strconv.ParseUint(string(uid), 10, 64)
+
+	if err = checkTenantAccess(ctx, req.Tenant); err != nil {
+		return
+	}
+
+	export, err := createTenantExport(ctx, req.Tenant, userId)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		err = &errs.Error{
+			Code:    errs.AlreadyExists,
+			Message: "An export of this tenant is already in progress",
+		}
+		return
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if _, err = RequestedTenantExports.Publish(ctx, &TenantExportRequested{
+		Export:    export.Id,
+		Tenant:    export.Tenant,
+		Timestamp: time.Now(),
+	}); err != nil {
+		rlog.Error("could not request tenant export", "export", export.Id, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = tenantExportToDto(export)
+	return
+}
+
+// Finds an export along with its progress
+//
+//encore:api auth method=GET path=/exports/:id
+func FindTenantExport(ctx context.Context, id uint64) (ans *dto.TenantExport, err error) {
+	export, err := findTenantExportById(ctx, id)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		err = &util.ErrNotFound
+		return
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if err = checkTenantAccess(ctx, export.Tenant); err != nil {
+		return
+	}
+
+	ans = tenantExportToDto(export)
+	return
+}
+
+// Downloads the archive of a completed export until it expires
+//
+//encore:api raw auth method=GET path=/exports/:id/download
+func DownloadTenantExport(w http.ResponseWriter, req *http.Request) {
+	id, err := strconv.ParseUint(encore.CurrentRequest().PathParams.Get("id"), 10, 64)
+	if err != nil {
+		errs.HTTPError(w, &util.ErrNotFound)
+		return
+	}
+
+	export, err := findTenantExportById(req.Context(), id)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		errs.HTTPError(w, &util.ErrNotFound)
+		return
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		errs.HTTPError(w, &util.ErrUnknown)
+		return
+	}
+
+	if err = checkTenantAccess(req.Context(), export.Tenant); err != nil {
+		errs.HTTPError(w, err)
+		return
+	}
+
+	if !downloadable(export) {
+		errs.HTTPError(w, &errs.Error{
+			Code:    errs.FailedPrecondition,
+			Message: "This export is not available for download",
+		})
+		return
+	}
+
+	reader := uploads.Download(req.Context(), export.ObjectKey.String)
+	if errors.Is(reader.Err(), objects.ErrObjectNotFound) {
+		errs.HTTPError(w, &util.ErrNotFound)
+		return
+	} else if reader.Err() != nil {
+		rlog.Error("bucket error", "err", reader.Err())
+		errs.HTTPError(w, &util.ErrUnknown)
+		return
+	}
+	defer reader.Close()
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="tenant-%d-export-%d.zip"`, export.Tenant, export.Id))
+	if export.Size.Valid {
+		w.Header().Set("Content-Length", strconv.FormatInt(export.Size.Int64, 10))
+	}
+	// The status has been sent by now, so a failed copy can only be logged; the client sees a truncated archive
+	if _, err = io.Copy(w, reader); err != nil {
+		rlog.Error("could not stream tenant export archive", "export", export.Id, "err", err)
+	}
+}
+
+// Fails the exports which stopped making progress, such as when the worker building them crashed, so that new exports
+// of their tenants can be requested
+//
+//encore:api private method=POST path=/exports/stalled/fail
+func FailStalledTenantExports(ctx context.Context) (err error) {
+	if _, err = db.Exec(ctx, `
+		UPDATE tenant_exports SET
+			status = $1, current_step = NULL, error = 'The export stopped making progress'
+		WHERE
+			status IN ($2, $3) AND COALESCE(started_at, created_at) < $4;
+	`, dto.TESFailed, dto.TESPending, dto.TESInProgress, time.Now().Add(-exportStallTimeout)); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return &util.ErrUnknown
+	}
+	return
+}
+
+// Removes the archives of expired exports
+//
+//encore:api private method=POST path=/exports/expire
+func ExpireTenantExports(ctx context.Context) (err error) {
+	expired, err := findExpiredTenantExports(ctx)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return &util.ErrUnknown
+	}
+
+	for _, export := range expired {
+		if err = uploads.Remove(ctx, export.ObjectKey.String); err != nil && !errors.Is(err, objects.ErrObjectNotFound) {
+			rlog.Error("could not remove expired export archive", "export", export.Id, "err", err)
+			continue
+		}
+
+		if _, err = db.Exec(ctx, "UPDATE tenant_exports SET status = $1, object_key = NULL WHERE id = $2;", dto.TESExpired, export.Id); err != nil {
+			rlog.Error(util.MsgDbAccessError, "err", err)
+			return &util.ErrUnknown
+		}
+	}
+	return nil
+}
+
+// Verifies that the current user may view the tenant whose data is being exported
+func checkTenantAccess(ctx context.Context, tenant uint64) error {
+	uid, _ := auth.UserID()
+	perm, err := permissions.CheckPermissionInternal(ctx, dto.InternalRelationCheckRequest{
+		Actor:    dto.IdentifierString(dto.PTUser, uid),
+		Relation: dto.PNCanView,
+		Target:   dto.IdentifierString(dto.PTTenant, tenant),
+	})
+	if err != nil {
+		rlog.Error(util.MsgCallError, "err", err)
+		return &util.ErrUnknown
+	} else if !perm.Allowed {
+		return &util.ErrForbidden
+	}
+	return nil
+}
+
+func downloadable(export *models.TenantExport) bool {
+	return export.Status == string(dto.TESCompleted) &&
+		export.ObjectKey.Valid &&
+		export.ExpiresAt.Valid && export.ExpiresAt.Time.After(time.Now())
+}
+
+const exportFields = "id,tenant,requested_by,status,current_step,completed_steps,total_steps,object_key,size,error,created_at,started_at,completed_at,expires_at"
+
+func createTenantExport(ctx context.Context, tenant, requestedBy uint64) (*models.TenantExport, error) {
+	query := fmt.Sprintf(`
+		INSERT INTO tenant_exports(tenant, requested_by, total_steps)
+		VALUES ($1,$2,$3)
+		ON CONFLICT (tenant) WHERE status IN ('pending', 'in_progress') DO NOTHING
+		RETURNING %s;
+	`, exportFields)
+	return scanTenantExport(db.QueryRow(ctx, query, tenant, requestedBy, len(exportSteps)))
+}
+
+func findTenantExportById(ctx context.Context, id uint64) (*models.TenantExport, error) {
+	query := fmt.Sprintf("SELECT %s FROM tenant_exports WHERE id = $1;", exportFields)
+	return scanTenantExport(db.QueryRow(ctx, query, id))
+}
+
+func findExpiredTenantExports(ctx context.Context) (ans []*models.TenantExport, err error) {
+	query := fmt.Sprintf("SELECT %s FROM tenant_exports WHERE status = $1 AND expires_at <= CURRENT_TIMESTAMP;", exportFields)
+	rows, err := db.Query(ctx, query, dto.TESCompleted)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var export *models.TenantExport
+		if export, err = scanTenantExport(rows); err != nil {
+			return
+		}
+		ans = append(ans, export)
+	}
+	err = rows.Err()
+	return
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanTenantExport(row rowScanner) (*models.TenantExport, error) {
+	e := new(models.TenantExport)
+	if err := row.Scan(&e.Id, &e.Tenant, &e.RequestedBy, &e.Status, &e.CurrentStep, &e.CompletedSteps, &e.TotalSteps, &e.ObjectKey, &e.Size, &e.Error, &e.CreatedAt, &e.StartedAt, &e.CompletedAt, &e.ExpiresAt); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func tenantExportToDto(e *models.TenantExport) *dto.TenantExport {
+	ans := &dto.TenantExport{
+		Id:          e.Id,
+		Tenant:      e.Tenant,
+		Status:      dto.TenantExportStatus(e.Status),
+		RequestedBy: e.RequestedBy,
+		CreatedAt:   e.CreatedAt,
+	}
+	if e.TotalSteps > 0 {
+		ans.Progress = e.CompletedSteps * 100 / e.TotalSteps
+	}
+	if e.CurrentStep.Valid {
+		ans.CurrentStep = &e.CurrentStep.String
+	}
+	if e.Error.Valid {
+		ans.Error = &e.Error.String
+	}
+	if e.Size.Valid {
+		ans.Size = &e.Size.Int64
+	}
+	if e.StartedAt.Valid {
+		ans.StartedAt = &e.StartedAt.Time
+	}
+	if e.CompletedAt.Valid {
+		ans.CompletedAt = &e.CompletedAt.Time
+	}
+	if e.ExpiresAt.Valid {
+		ans.ExpiresAt = &e.ExpiresAt.Time
+	}
+	if downloadable(e) {
+		url := encore.Meta().APIBaseURL.JoinPath("exports", strconv.FormatUint(e.Id, 10), "download").String()
+		ans.DownloadUrl = &url
+	}
+	return ans
+}
@@ -0,0 +1,87 @@
+package exports_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"encore.dev/beta/auth"
+	"encore.dev/et"
+	"github.com/brinestone/scholaris/core/permissions"
+	"github.com/brinestone/scholaris/dto"
+	"github.com/brinestone/scholaris/exports"
+	"github.com/brinestone/scholaris/tenants"
+	"github.com/stretchr/testify/assert"
+)
+
+var mainContext context.Context
+
+func mockEndpoints(allowed bool) {
+	et.MockEndpoint(permissions.CheckPermissionInternal, func(ctx context.Context, req dto.InternalRelationCheckRequest) (*dto.RelationCheckResponse, error) {
+		return &dto.RelationCheckResponse{
+			Allowed: allowed,
+		}, nil
+	})
+}
+
+func TestMain(m *testing.M) {
+	mockEndpoints(true)
+	mainContext = auth.WithContext(context.TODO(), auth.UID("1"), &dto.AuthClaims{Sub: 1})
+	m.Run()
+}
+
+func TestNewTenantExport(t *testing.T) {
+	export, err := exports.NewTenantExport(mainContext, dto.NewTenantExportRequest{Tenant: 1})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	assert.Equal(t, dto.TESPending, export.Status)
+	assert.Equal(t, uint(0), export.Progress)
+	assert.Nil(t, export.DownloadUrl)
+
+	_, err = exports.NewTenantExport(mainContext, dto.NewTenantExportRequest{Tenant: 1})
+	assert.NotNil(t, err)
+}
+
+func TestFindTenantExportForbidden(t *testing.T) {
+	export, err := exports.NewTenantExport(mainContext, dto.NewTenantExportRequest{Tenant: 2})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	t.Cleanup(func() { mockEndpoints(true) })
+	mockEndpoints(false)
+
+	_, err = exports.FindTenantExport(mainContext, export.Id)
+	assert.NotNil(t, err)
+}
+
+func TestBuildTenantExportFailsOnStepErrors(t *testing.T) {
+	export, err := exports.NewTenantExport(mainContext, dto.NewTenantExportRequest{Tenant: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	et.MockEndpoint(tenants.ExportTenantData, func(ctx context.Context, id uint64) (*dto.ExportResponse, error) {
+		return nil, errors.New("connection refused")
+	})
+
+	// The error is not returned, so that the message is not redelivered
+	assert.Nil(t, exports.BuildTenantExport(context.TODO(), export.Id))
+
+	res, err := exports.FindTenantExport(mainContext, export.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, dto.TESFailed, res.Status)
+	if assert.NotNil(t, res.Error) {
+		assert.Contains(t, *res.Error, "tenant")
+	}
+
+	// A new export can be requested once the previous one failed
+	_, err = exports.NewTenantExport(mainContext, dto.NewTenantExportRequest{Tenant: 3})
+	assert.Nil(t, err)
+}
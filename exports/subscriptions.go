@@ -0,0 +1,13 @@
+package exports
+
+import (
+	"time"
+
+	"encore.dev/pubsub"
+)
+
+var _ = pubsub.NewSubscription(RequestedTenantExports, "build-tenant-export", pubsub.SubscriptionConfig[*TenantExportRequested]{
+	Handler:        onTenantExportRequested,
+	AckDeadline:    30 * time.Minute,
+	MaxConcurrency: 2,
+})
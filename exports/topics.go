@@ -0,0 +1,29 @@
+package exports
+
+import (
+	"time"
+
+	"encore.dev/pubsub"
+)
+
+type TenantExportRequested struct {
+	Export    uint64
+	Tenant    uint64
+	Timestamp time.Time
+}
+
+var RequestedTenantExports = pubsub.NewTopic[*TenantExportRequested]("tenant-export-requested", pubsub.TopicConfig{
+	DeliveryGuarantee: pubsub.ExactlyOnce,
+})
+
+type TenantExportCompleted struct {
+	Export    uint64
+	Tenant    uint64
+	Size      int64
+	ExpiresAt time.Time
+	Timestamp time.Time
+}
+
+var CompletedTenantExports = pubsub.NewTopic[*TenantExportCompleted]("tenant-export-completed", pubsub.TopicConfig{
+	DeliveryGuarantee: pubsub.ExactlyOnce,
+})
@@ -0,0 +1,105 @@
+package forms
+
+import (
+	"context"
+
+	"encore.dev/rlog"
+	"encore.dev/storage/objects"
+	"encore.dev/storage/sqldb"
+	"github.com/brinestone/scholaris/blob"
+	"github.com/brinestone/scholaris/dto"
+	"github.com/brinestone/scholaris/helpers"
+	"github.com/brinestone/scholaris/util"
+	"github.com/lib/pq"
+)
+
+// Exported forms are staged in the uploads bucket, where the export archive is assembled
+var exportBucket = objects.BucketRef[objects.Uploader](blob.UploadsBucket)
+
+// The columns of the flattened responses sheet
+var responseColumns = []string{"response", "form", "responder", "created_at", "submitted_at", "question", "prompt", "value"}
+
+// Exports the forms of the given owners along with their questions and responses
+//
+//encore:api private method=POST path=/forms/owned/export
+func ExportOwnedForms(ctx context.Context, req dto.ExportOwnedRequest) (ans *dto.ExportResponse, err error) {
+	ans, err = exportOwnedForms(ctx, req)
+	if err != nil {
+		rlog.Error("could not export forms", "ownerType", req.OwnerType, "err", err)
+		ans, err = nil, &util.ErrUnknown
+	}
+	return
+}
+
+func exportOwnedForms(ctx context.Context, req dto.ExportOwnedRequest) (ans *dto.ExportResponse, err error) {
+	ans = new(dto.ExportResponse)
+	queries := []struct{ path, query string }{
+		{"forms.json", `
+			SELECT
+				f.id, f.title, f.description, f.status, f.tags, f.owner, f.owner_type, f.multi_response,
+				f.response_resubmission, f.max_responses, f.max_submissions, f.response_start, f.response_window,
+				f.meta_background, f.meta_bg_img, f.meta_img, f.created_at, f.updated_at
+			FROM
+				forms f
+			WHERE
+				f.owner_type = $1 AND f.owner = ANY($2)
+			ORDER BY
+				f.id`},
+		{"question-groups.json", `
+			SELECT
+				g.id, g.form, g.label, g.description, g.image
+			FROM
+				form_question_groups g
+				JOIN forms f ON f.id = g.form
+			WHERE
+				f.owner_type = $1 AND f.owner = ANY($2)
+			ORDER BY
+				g.id`},
+		{"questions.json", `
+			SELECT
+				q.id, q.form, q.form_group, q.prompt, q.type, q.is_required, q.layout_variant,
+				COALESCE((
+					SELECT JSON_AGG(JSON_BUILD_OBJECT('id', o.id, 'caption', o.caption, 'value', o.value, 'image', o.image, 'isDefault', o.is_default) ORDER BY o.id)
+					FROM form_question_options o WHERE o.question = q.id
+				), '[]'::JSON) AS options
+			FROM
+				form_questions q
+				JOIN forms f ON f.id = q.form
+			WHERE
+				f.owner_type = $1 AND f.owner = ANY($2)
+			ORDER BY
+				q.id`},
+	}
+
+	for _, q := range queries {
+		var rows *sqldb.Rows
+		if rows, err = formsDb.Query(ctx, helpers.JsonRowsQuery(q.query), req.OwnerType, pq.Array(req.Owners)); err != nil {
+			return
+		}
+		if err = helpers.StageJsonRows(ctx, exportBucket, req.StagingKey(q.path), rows); err != nil {
+			return
+		}
+		ans.Stage(req.StagingKey(q.path), q.path)
+	}
+
+	rows, err := formsDb.Query(ctx, helpers.JsonRowsQuery(`
+		SELECT
+			r.id AS response, r.form, r.responder, r.created_at, r.submitted_at, q.id AS question, q.prompt, a.value
+		FROM
+			form_responses r
+			JOIN forms f ON f.id = r.form
+			LEFT JOIN response_answers a ON a.response = r.id
+			LEFT JOIN form_questions q ON q.id = a.question
+		WHERE
+			f.owner_type = $1 AND f.owner = ANY($2)
+		ORDER BY
+			r.id, q.id`), req.OwnerType, pq.Array(req.Owners))
+	if err != nil {
+		return
+	}
+	if err = helpers.StageCsvRows(ctx, exportBucket, req.StagingKey("responses.csv"), rows, responseColumns...); err != nil {
+		return
+	}
+	ans.Stage(req.StagingKey("responses.csv"), "responses.csv")
+	return
+}
@@ -25,7 +25,7 @@ import (
 func mockEndpoints() {
 	et.MockEndpoint(permissions.CheckPermissionInternal, func(ctx context.Context, req dto.InternalRelationCheckRequest) (*dto.RelationCheckResponse, error) {
 		return &dto.RelationCheckResponse{
-			Allowed: true,
+			Allowed: req.Relation != dto.PNArchived,
 		}, nil
 	})
 	et.MockEndpoint(permissions.SetPermissions, func(ctx context.Context, req dto.UpdatePermissionsRequest) error {
@@ -41,6 +41,11 @@ func mockEndpoints() {
 			},
 		}, nil
 	})
+	et.MockEndpoint(permissions.FilterObjectsInternal, func(ctx context.Context, req dto.FilterObjectsRequest) (*dto.FilterObjectsResponse, error) {
+		return &dto.FilterObjectsResponse{
+			Allowed: []uint64{},
+		}, nil
+	})
 }
 
 func TestMain(t *testing.M) {
@@ -218,10 +223,10 @@ func TestForms(t *testing.T) {
 	})
 
 	t.Run("TestFindForms_Owned", func(t *testing.T) {
-		et.MockEndpoint(permissions.ListObjectsInternal, func(ctx context.Context, p dto.ListObjectsRequest) (ans *dto.ListObjectsResponse, err error) {
-			ans = new(dto.ListObjectsResponse)
-			ans.Relations = make(map[dto.PermissionType][]uint64)
-			ans.Relations[dto.PermissionType(p.Type)] = []uint64{form.Id}
+		et.MockEndpoint(permissions.FilterObjectsInternal, func(ctx context.Context, p dto.FilterObjectsRequest) (ans *dto.FilterObjectsResponse, err error) {
+			ans = &dto.FilterObjectsResponse{
+				Allowed: p.Ids,
+			}
 			return
 		})
 		testFindOwnedForms(t, ownerId, ctx, dto.PTInstitution)
@@ -477,7 +482,6 @@ func testCreateQuestions(t *testing.T, ctx context.Context, refId, group uint64)
 
 func testFindUnOwnedForms(t *testing.T, owner uint64, ctx context.Context, ownerType dto.PermissionType, refId uint64) {
 	res, err := forms.FindForms(ctx, dto.FindFormsRequest{
-		Page:      0,
 		Size:      10,
 		Owner:     owner + 1,
 		OwnerType: string(ownerType),
@@ -495,7 +499,6 @@ func testFindUnOwnedForms(t *testing.T, owner uint64, ctx context.Context, owner
 
 func testFindOwnedForms(t *testing.T, owner uint64, ctx context.Context, ownerType dto.PermissionType) {
 	res, err := forms.FindForms(ctx, dto.FindFormsRequest{
-		Page:      0,
 		Size:      10,
 		Owner:     owner,
 		OwnerType: string(ownerType),
@@ -146,6 +146,63 @@ func VerifyFormEditor(req middleware.Request, next middleware.Next) middleware.R
 	return next(req)
 }
 
+// Rejects changes to the forms of archived institutions, and responses to them. The owner is taken from the payload
+// when it carries one, or from the form in the path otherwise.
+//
+//encore:middleware target=tag:institution_writable
+func InstitutionWritable(req middleware.Request, next middleware.Next) middleware.Response {
+	ctx := req.Context()
+	ownerInfo, ok := req.Data().Payload.(models.OwnerInfo)
+	if !ok {
+		formId := req.Data().PathParams.Get("form")
+		if formId == "" {
+			formId = req.Data().PathParams.Get("id")
+		}
+		id, _ := strconv.ParseUint(formId, 10, 64)
+
+		form, err := findFormFromDb(ctx, id)
+		if errors.Is(err, sqldb.ErrNoRows) {
+			return middleware.Response{
+				Err: &util.ErrNotFound,
+			}
+		} else if err != nil {
+			rlog.Error(util.MsgDbAccessError, "msg", err.Error())
+			return middleware.Response{
+				Err: &util.ErrUnknown,
+			}
+		}
+		ownerInfo = *form
+	}
+
+	if ownerInfo.GetOwnerType() != string(dto.PTInstitution) {
+		return next(req)
+	}
+
+	uid, _ := encoreAuth.UserID()
+	res, err := permissions.CheckPermissionInternal(ctx, dto.InternalRelationCheckRequest{
+		Actor:    dto.IdentifierString(dto.PTUser, uid),
+		Relation: dto.PNArchived,
+		Target:   dto.IdentifierString(dto.PTInstitution, ownerInfo.GetOwner()),
+	})
+	if err != nil {
+		rlog.Error(util.MsgCallError, "msg", err.Error())
+		return middleware.Response{
+			Err: &util.ErrUnknown,
+		}
+	}
+
+	if res.Allowed {
+		return middleware.Response{
+			Err: &errs.Error{
+				Code:    errs.FailedPrecondition,
+				Message: "This institution is archived and cannot be changed",
+			},
+		}
+	}
+
+	return next(req)
+}
+
 //encore:middleware target=tag:needs_captcha_ver
 func VerifyCaptcha(req middleware.Request, next middleware.Next) middleware.Response {
 	p, ok := req.Data().Payload.(models.CaptchaVerifiable)
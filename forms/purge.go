@@ -0,0 +1,85 @@
+package forms
+
+import (
+	"context"
+
+	"encore.dev/rlog"
+	"github.com/brinestone/scholaris/core/permissions"
+	"github.com/brinestone/scholaris/dto"
+	"github.com/brinestone/scholaris/helpers"
+	"github.com/brinestone/scholaris/util"
+	"github.com/lib/pq"
+)
+
+// Deletes the forms of the given owners along with their responses
+//
+//encore:api private method=POST path=/forms/owned/purge
+func PurgeOwnedForms(ctx context.Context, req dto.PurgeOwnedRequest) (ans *dto.PurgeResponse, err error) {
+	deleted, err := purgeOwnedForms(ctx, req.OwnerType, req.Owners...)
+	if err != nil {
+		rlog.Error("could not purge forms", "ownerType", req.OwnerType, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = &dto.PurgeResponse{Deleted: deleted}
+	return
+}
+
+func purgeOwnedForms(ctx context.Context, ownerType dto.PermissionType, owners ...uint64) (deleted uint, err error) {
+	tx, err := formsDb.Begin(ctx)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(ctx, "SELECT id FROM forms WHERE owner_type = $1 AND owner = ANY($2) FOR UPDATE;", ownerType, pq.Array(owners))
+	if err != nil {
+		return
+	}
+
+	var ids []uint64
+	for rows.Next() {
+		var id uint64
+		if err = rows.Scan(&id); err != nil {
+			rows.Close()
+			return
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	if len(ids) == 0 {
+		return
+	}
+
+	// Responses and their answers do not cascade with their form
+	if _, err = tx.Exec(ctx, "DELETE FROM response_answers WHERE response IN (SELECT id FROM form_responses WHERE form = ANY($1));", pq.Array(ids)); err != nil {
+		return
+	}
+
+	if _, err = tx.Exec(ctx, "DELETE FROM form_responses WHERE form = ANY($1);", pq.Array(ids)); err != nil {
+		return
+	}
+
+	if _, err = tx.Exec(ctx, "DELETE FROM forms WHERE id = ANY($1);", pq.Array(ids)); err != nil {
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		return
+	}
+
+	for _, id := range ids {
+		_, _ = formCache.Delete(ctx, id)
+	}
+	deleted = uint(len(ids))
+
+	// The tuples only go once the forms are gone, so that a failed commit leaves the forms accessible
+	_, err = permissions.PurgeObjectTuples(ctx, dto.PurgeObjectTuplesRequest{
+		Objects: helpers.SliceMap(ids, func(id uint64) string {
+			return dto.IdentifierString(dto.PTForm, id)
+		}),
+	})
+	return
+}
@@ -19,6 +19,7 @@ import (
 	"encore.dev/storage/sqldb"
 	"github.com/brinestone/scholaris/core/permissions"
 	"github.com/brinestone/scholaris/dto"
+	"github.com/brinestone/scholaris/helpers"
 	"github.com/brinestone/scholaris/models"
 	"github.com/brinestone/scholaris/util"
 	"github.com/lib/pq"
@@ -26,7 +27,7 @@ import (
 
 // Submits a user's response
 //
-//encore:api auth method=PATCH path=/forms/:form/responses/:response/submit tag:user_owns_response tag:user_can_submit_response
+//encore:api auth method=PATCH path=/forms/:form/responses/:response/submit tag:user_owns_response tag:user_can_submit_response tag:institution_writable
 func SubmitResponse(ctx context.Context, form, response uint64) (*dto.UserFormResponse, error) {
 	sub, _ := auth.UserID()
 	uid, _ := strconv.ParseUint(string(sub), 10, 64)
@@ -72,7 +73,7 @@ func SubmitResponse(ctx context.Context, form, response uint64) (*dto.UserFormRe
 
 // Updates a user's answers
 //
-//encore:api auth method=PATCH path=/forms/:form/responses/:response/answers tag:user tag:user_owns_response
+//encore:api auth method=PATCH path=/forms/:form/responses/:response/answers tag:user tag:user_owns_response tag:institution_writable
 func UpdateResponseAnswers(ctx context.Context, form, response uint64, req *dto.UpdateUserAnswersRequest) (*dto.UserFormResponse, error) {
 	sub, _ := auth.UserID()
 	uid, _ := strconv.ParseUint(string(sub), 10, 64)
@@ -178,7 +179,7 @@ func CreateFormResponseInternal(ctx context.Context, form uint64) (*models.FormR
 
 // Creates a response for a form
 //
-//encore:api auth method=POST path=/forms/:form/responses/new tag:user_can_respond_to_form
+//encore:api auth method=POST path=/forms/:form/responses/new tag:user_can_respond_to_form tag:institution_writable
 func CreateFormResponse(ctx context.Context, form uint64) (*dto.UserFormResponses, error) {
 	sub, _ := auth.UserID()
 	uid, _ := strconv.ParseUint(string(sub), 10, 64)
@@ -208,7 +209,7 @@ func CreateFormResponse(ctx context.Context, form uint64) (*dto.UserFormResponse
 
 // Deletes a form's question group
 //
-//encore:api auth method=DELETE path=/forms/:form/groups tag:user_is_form_editor
+//encore:api auth method=DELETE path=/forms/:form/groups tag:user_is_form_editor tag:institution_writable
 func DeleteQuestionGroup(ctx context.Context, form uint64, req dto.DeleteFormQuestionGroupsRequest) (*dto.GetFormQuestionsResponse, error) {
 
 	tx, err := formsDb.Begin(ctx)
@@ -239,7 +240,7 @@ func DeleteQuestionGroup(ctx context.Context, form uint64, req dto.DeleteFormQue
 
 // Updates a form's question group
 //
-//encore:api auth method=PATCH path=/forms/:form/groups/:group tag:user_is_form_editor
+//encore:api auth method=PATCH path=/forms/:form/groups/:group tag:user_is_form_editor tag:institution_writable
 func UpdateQuestionGroup(ctx context.Context, form, group uint64, req dto.UpdateFormQuestionGroupRequest) (*dto.GetFormQuestionsResponse, error) {
 	tx, err := formsDb.Begin(ctx)
 	if err != nil {
@@ -269,7 +270,7 @@ func UpdateQuestionGroup(ctx context.Context, form, group uint64, req dto.Update
 
 // Creates a form's question group
 //
-//encore:api auth method=POST path=/forms/:form/groups tag:user_is_form_editor
+//encore:api auth method=POST path=/forms/:form/groups tag:user_is_form_editor tag:institution_writable
 func CreateQuestionGroup(ctx context.Context, form uint64, req dto.UpdateFormQuestionGroupRequest) (*dto.GetFormQuestionsResponse, error) {
 	tx, err := formsDb.Begin(ctx)
 	if err != nil {
@@ -359,7 +360,7 @@ func GetFormInfo(ctx context.Context, form uint64) (*dto.FormConfig, error) {
 
 // Toggles a form's status
 //
-//encore:api auth method=PUT path=/forms/:form/toggle tag:user_is_form_editor
+//encore:api auth method=PUT path=/forms/:form/toggle tag:user_is_form_editor tag:institution_writable
 func ToggleFormStatus(ctx context.Context, form uint64) (*dto.FormConfig, error) {
 	tx, err := formsDb.Begin(ctx)
 	if err != nil {
@@ -402,7 +403,7 @@ func ToggleFormStatus(ctx context.Context, form uint64) (*dto.FormConfig, error)
 
 // Deletes a form
 //
-//encore:api auth method=DELETE path=/forms/:form tag:user_is_form_editor
+//encore:api auth method=DELETE path=/forms/:form tag:user_is_form_editor tag:institution_writable
 func DeleteForm(ctx context.Context, form uint64) error {
 	tx, err := formsDb.Begin(ctx)
 	if err != nil {
@@ -440,7 +441,7 @@ func DeleteForm(ctx context.Context, form uint64) error {
 
 // Deletes a form's questions
 //
-//encore:api auth method=DELETE path=/forms/:form/questions tag:user_is_form_editor
+//encore:api auth method=DELETE path=/forms/:form/questions tag:user_is_form_editor tag:institution_writable
 func DeleteFormQuestions(ctx context.Context, form uint64, req dto.DeleteQuestionsRequest) (*dto.GetFormQuestionsResponse, error) {
 	tx, err := formsDb.Begin(ctx)
 	if err != nil {
@@ -470,7 +471,7 @@ func DeleteFormQuestions(ctx context.Context, form uint64, req dto.DeleteQuestio
 
 // Updates a form question's options
 //
-//encore:api auth method=PATCH path=/forms/:form/questions/:question/options tag:user_is_form_editor
+//encore:api auth method=PATCH path=/forms/:form/questions/:question/options tag:user_is_form_editor tag:institution_writable
 func UpdateFormQuestionOptions(ctx context.Context, form uint64, question uint64, req dto.UpdateFormQuestionOptionsRequest) (*dto.GetFormQuestionsResponse, error) {
 	tx, err := formsDb.Begin(ctx)
 	if err != nil {
@@ -518,7 +519,7 @@ func UpdateFormQuestionOptions(ctx context.Context, form uint64, question uint64
 
 // Updates a form question
 //
-//encore:api auth method=PATCH path=/forms/:form/questions/:question tag:user_is_form_editor
+//encore:api auth method=PATCH path=/forms/:form/questions/:question tag:user_is_form_editor tag:institution_writable
 func UpdateQuestion(ctx context.Context, form uint64, question uint64, req dto.UpdateFormQuestionRequest) (*dto.GetFormQuestionsResponse, error) {
 	tx, err := formsDb.Begin(ctx)
 	if err != nil {
@@ -551,7 +552,7 @@ func UpdateQuestion(ctx context.Context, form uint64, question uint64, req dto.U
 
 // Add a question to a form
 //
-//encore:api auth method=POST path=/forms/:form/question tag:user_is_form_editor
+//encore:api auth method=POST path=/forms/:form/question tag:user_is_form_editor tag:institution_writable
 func CreateQuestion(ctx context.Context, form uint64, req dto.UpdateFormQuestionRequest) (*dto.GetFormQuestionsResponse, error) {
 	tx, err := formsDb.Begin(ctx)
 	if err != nil {
@@ -585,7 +586,7 @@ func CreateQuestion(ctx context.Context, form uint64, req dto.UpdateFormQuestion
 
 // Update a form
 //
-//encore:api auth method=PUT path=/forms/:id tag:user_is_form_editor
+//encore:api auth method=PUT path=/forms/:id tag:user_is_form_editor tag:institution_writable
 func UpdateForm(ctx context.Context, id uint64, req dto.UpdateFormRequest) (*dto.FormConfig, error) {
 	tx, err := formsDb.Begin(ctx)
 	if err != nil {
@@ -645,36 +646,94 @@ func FindFormQuestions(ctx context.Context, id uint64) (*dto.GetFormQuestionsRes
 //encore:api public method=GET path=/forms
 func FindForms(ctx context.Context, params dto.FindFormsRequest) (*dto.GetFormsResponse, error) {
 	ownerType, _ := dto.ParsePermissionType(params.OwnerType)
-	var overrides []uint64
-	uid, authed := auth.UserID()
-	if authed {
-		res, err := permissions.ListObjectsInternal(ctx, dto.ListObjectsRequest{
-			Actor:    dto.IdentifierString(dto.PTUser, uid),
-			Relation: dto.PNEditor,
-			Type:     string(dto.PTForm),
-		})
+	size := params.Size
+	if size == 0 {
+		size = dto.DefaultPageSize
+	}
+
+	res, err := findFormsFromCache(ctx, params.Page, params.After, size, ownerType, params.Owner)
+	if errors.Is(err, cache.Miss) {
+		uid, authed := auth.UserID()
+		actor := dto.IdentifierString(dto.PTUser, uid)
+
+		// Published forms are visible to anyone while drafts are only visible to their editors.
+		filter := func(ctx context.Context, rows []*models.Form) (ans []*models.Form, err error) {
+			var drafts []uint64
+			for _, f := range rows {
+				if f.Status == dto.FSDraft {
+					drafts = append(drafts, f.Id)
+				}
+			}
+
+			allowed := make(map[uint64]bool)
+			if authed && len(drafts) > 0 {
+				var res *dto.FilterObjectsResponse
+				if res, err = permissions.FilterObjectsInternal(ctx, dto.FilterObjectsRequest{
+					Actor:    actor,
+					Relation: dto.PNEditor,
+					Type:     dto.PTForm,
+					Ids:      drafts,
+				}); err != nil {
+					return
+				}
+				for _, id := range res.Allowed {
+					allowed[id] = true
+				}
+			}
+
+			for _, f := range rows {
+				if f.Status != dto.FSDraft || allowed[f.Id] {
+					ans = append(ans, f)
+				}
+			}
+			return
+		}
+		cursorOf := func(f *models.Form) uint64 { return f.Id }
+
+		fetch := formsAfter(params.Owner, params.OwnerType, false)
+
+		// A page given without a cursor is resolved into one by skipping the viewable forms before it.
+		after := params.After
+		if after == 0 && params.Page > 0 {
+			if after, err = helpers.AuthorizedOffset(ctx, params.Page*size, helpers.ScanBatchSize, fetch, filter, cursorOf); err != nil {
+				rlog.Error(util.MsgDbAccessError, "msg", err.Error())
+				return nil, &util.ErrUnknown
+			}
+		}
+
+		formsFromDb, next, err := helpers.AuthorizedPage(ctx, after, size, fetch, filter, cursorOf)
 		if err != nil {
-			rlog.Error(util.MsgCallError, "msg", err.Error())
+			rlog.Error(util.MsgDbAccessError, "msg", err.Error())
 			return nil, &util.ErrUnknown
 		}
-		overrides = res.Relations[dto.PTForm]
-	}
 
-	res, err := findFormsFromCache(ctx, int(params.Page), int(params.Size), ownerType, params.Owner)
-	if errors.Is(err, cache.Miss) {
-		formsFromDb, err := findFormsFromDb(ctx, params.Page, params.Size, params.Owner, params.OwnerType, overrides)
+		// Published forms are counted directly, while only drafts go through the permission filter to be counted.
+		total, err := countPublishedForms(ctx, params.Owner, params.OwnerType)
 		if err != nil {
-			return nil, err
+			rlog.Error(util.MsgDbAccessError, "msg", err.Error())
+			return nil, &util.ErrUnknown
+		}
+
+		if authed {
+			drafts, err := helpers.CountAuthorized(ctx, helpers.ScanBatchSize, formsAfter(params.Owner, params.OwnerType, true), filter, cursorOf)
+			if err != nil {
+				rlog.Error(util.MsgDbAccessError, "msg", err.Error())
+				return nil, &util.ErrUnknown
+			}
+			total += drafts
 		}
 
 		var forms = formsToDto(formsFromDb...)
 
 		response := &dto.GetFormsResponse{
-			Forms: forms,
+			Forms:   forms,
+			Total:   total,
+			HasMore: next != 0,
+			Next:    next,
 		}
 
 		if len(formsFromDb) > 0 {
-			key := formsCacheKey(int(params.Page), int(params.Size), ownerType, params.Owner)
+			key := formsCacheKey(params.Page, params.After, size, ownerType, params.Owner)
 			if err := formsCache.Set(ctx, key, *response); err != nil {
 				rlog.Error(util.MsgCacheAccessError, "msg", err.Error())
 			}
@@ -689,7 +748,7 @@ func FindForms(ctx context.Context, params dto.FindFormsRequest) (*dto.GetFormsR
 
 // Creates a new form
 //
-//encore:api auth method=POST path=/forms tag:needs_captcha_ver
+//encore:api auth method=POST path=/forms tag:needs_captcha_ver tag:institution_writable
 func NewForm(ctx context.Context, req dto.NewFormInput) (response dto.NewFormResponse, err error) {
 	uid, _ := auth.UserID()
 	pt, _ := dto.ParsePermissionType(req.OwnerType)
@@ -900,37 +959,52 @@ func findFormFromDb(ctx context.Context, id uint64) (form *models.Form, err erro
 	return
 }
 
-func findFormsFromDb(ctx context.Context, page, size int, owner uint64, ownerType string, overrides []uint64) (ans []*models.Form, err error) {
-	query := `SELECT * FROM func_find_forms($1,$2,$3,$4,$5);`
-	rows, err := formsDb.Query(ctx, query, owner, ownerType, pq.Array(overrides), page, size)
-	if err != nil {
-		return
-	}
-	defer rows.Close()
-
-	var cnt = 0
-	for rows.Next() {
-		cnt++
-		var form = new(models.Form)
-		var questionIdsJson, groupIdsJson, tagsJson string
-		if err = formsDb.QueryRow(ctx, query, owner, ownerType, pq.Array(overrides), page, size).Scan(&form.Id, &form.Title, &form.Description, &form.BackgroundColor, &form.BackgroundImage, &form.Image, &form.CreatedAt, &form.UpdatedAt, &form.Owner, &form.OwnerType, &form.MultiResponse, &form.Resubmission, &form.Status, &form.Deadline, &questionIdsJson, &groupIdsJson, &form.ResponseCount, &form.SubmissionCount, &tagsJson, &form.MaxResponses, &form.ResponseStart, &form.ResponseWindow); err != nil {
-			form = nil
+func formsAfter(owner uint64, ownerType string, draftsOnly bool) helpers.CursorFetcher[*models.Form] {
+	return func(ctx context.Context, after uint64, limit uint) (ans []*models.Form, err error) {
+		query := `
+			SELECT
+				*
+			FROM
+				vw_AllForms
+			WHERE
+				owner = $1 AND owner_type = $2 AND ($3 = 0 OR id < $3) AND ($4 = false OR status = 'draft')
+			ORDER BY
+				id DESC
+			LIMIT $5;
+		`
+		rows, err := formsDb.Query(ctx, query, owner, ownerType, after, draftsOnly, limit)
+		if err != nil {
 			return
 		}
+		defer rows.Close()
 
-		if err = json.Unmarshal([]byte(questionIdsJson), &form.QuestionIds); err != nil {
-			return
-		}
+		for rows.Next() {
+			var form = new(models.Form)
+			var questionIdsJson, groupIdsJson, tagsJson string
+			if err = rows.Scan(&form.Id, &form.Title, &form.Description, &form.BackgroundColor, &form.BackgroundImage, &form.Image, &form.CreatedAt, &form.UpdatedAt, &form.Owner, &form.OwnerType, &form.MultiResponse, &form.Resubmission, &form.Status, &form.Deadline, &questionIdsJson, &groupIdsJson, &form.ResponseCount, &form.SubmissionCount, &tagsJson, &form.MaxResponses, &form.ResponseStart, &form.ResponseWindow); err != nil {
+				return
+			}
 
-		if err = json.Unmarshal([]byte(groupIdsJson), &form.GroupIds); err != nil {
-			return
-		}
+			if err = json.Unmarshal([]byte(questionIdsJson), &form.QuestionIds); err != nil {
+				return
+			}
 
-		if err = json.Unmarshal([]byte(tagsJson), &form.Tags); err != nil {
-			return
+			if err = json.Unmarshal([]byte(groupIdsJson), &form.GroupIds); err != nil {
+				return
+			}
+
+			if err = json.Unmarshal([]byte(tagsJson), &form.Tags); err != nil {
+				return
+			}
+			ans = append(ans, form)
 		}
-		ans = append(ans, form)
+		err = rows.Err()
+		return
 	}
+}
+
+func countPublishedForms(ctx context.Context, owner uint64, ownerType string) (ans uint, err error) {
+	err = formsDb.QueryRow(ctx, "SELECT COUNT(id) FROM vw_AllForms WHERE owner = $1 AND owner_type = $2 AND status != 'draft';", owner, ownerType).Scan(&ans)
 	return
 }
 
@@ -941,15 +1015,15 @@ func questionsCacheKey(form uint64) string {
 	return hex.EncodeToString(sum[:])
 }
 
-func formsCacheKey(page, size int, ownerType dto.PermissionType, owner uint64) string {
+func formsCacheKey(page uint, after uint64, size uint, ownerType dto.PermissionType, owner uint64) string {
 	uid, _ := auth.UserID()
-	temp := fmt.Sprintf("%d%d%s%d%s", page, size, ownerType, owner, uid)
+	temp := fmt.Sprintf("%d-%d-%d%s%d%s", page, after, size, ownerType, owner, uid)
 	sum := md5.Sum([]byte(temp))
 	return hex.EncodeToString(sum[:])
 }
 
-func findFormsFromCache(ctx context.Context, page, size int, ownerType dto.PermissionType, owner uint64) (*dto.GetFormsResponse, error) {
-	key := formsCacheKey(page, size, ownerType, owner)
+func findFormsFromCache(ctx context.Context, page uint, after uint64, size uint, ownerType dto.PermissionType, owner uint64) (*dto.GetFormsResponse, error) {
+	key := formsCacheKey(page, after, size, ownerType, owner)
 	ans, err := formsCache.Get(ctx, key)
 	return &ans, err
 }
@@ -0,0 +1,36 @@
+package forms
+
+import (
+	"context"
+
+	"encore.dev/pubsub"
+	"github.com/brinestone/scholaris/core/pkg"
+	"github.com/brinestone/scholaris/dto"
+	"github.com/brinestone/scholaris/tenants"
+)
+
+var _ = pubsub.NewSubscription(tenants.DeletedTenants, "purge-tenant-forms", pubsub.SubscriptionConfig[*tenants.TenantDeleted]{
+	Handler: purgeFormsOnTenantDeleted,
+})
+
+var _ = pubsub.NewSubscription(tenants.RetriedDeletionSteps, "retry-purge-tenant-forms", pubsub.SubscriptionConfig[*tenants.TenantDeleted]{
+	Handler: purgeFormsOnTenantDeleted,
+})
+
+func purgeFormsOnTenantDeleted(ctx context.Context, msg *tenants.TenantDeleted) error {
+	if !msg.Includes(tenants.DeletionStepForms) {
+		return nil
+	}
+
+	_, err := purgeOwnedForms(ctx, dto.PTTenant, msg.Id)
+	return msg.Acknowledge(ctx, tenants.DeletionStepForms, err)
+}
+
+var _ = pubsub.NewSubscription(pkg.DeletedInstitutions, "purge-institution-forms", pubsub.SubscriptionConfig[*pkg.InstitutionDeleted]{
+	Handler: purgeFormsOnInstitutionDeleted,
+})
+
+func purgeFormsOnInstitutionDeleted(ctx context.Context, msg *pkg.InstitutionDeleted) error {
+	_, err := purgeOwnedForms(ctx, dto.PTInstitution, msg.Id)
+	return err
+}
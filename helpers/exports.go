@@ -0,0 +1,136 @@
+package helpers
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"encore.dev/storage/objects"
+)
+
+// The rows of a query, as returned by sqldb
+type Rows interface {
+	Next() bool
+	Scan(dest ...any) error
+	Err() error
+	Close()
+}
+
+// Wraps a query so that its whole result set is returned as a single JSON array. Only suited to bounded results.
+func JsonArrayQuery(query string) string {
+	return fmt.Sprintf("SELECT COALESCE(JSON_AGG(r), '[]'::JSON) FROM (%s) r;", query)
+}
+
+// Wraps a query so that each of its rows is returned as a single JSON object
+func JsonRowsQuery(query string) string {
+	return fmt.Sprintf("SELECT ROW_TO_JSON(r)::TEXT FROM (%s) r;", query)
+}
+
+// Streams the rows of a JSON rows query into w as a single JSON array
+func WriteJsonArray(w io.Writer, rows Rows) (err error) {
+	if _, err = io.WriteString(w, "["); err != nil {
+		return
+	}
+
+	for first := true; rows.Next(); first = false {
+		var row []byte
+		if err = rows.Scan(&row); err != nil {
+			return
+		}
+		if !first {
+			if _, err = io.WriteString(w, ","); err != nil {
+				return
+			}
+		}
+		if _, err = w.Write(row); err != nil {
+			return
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return
+	}
+
+	_, err = io.WriteString(w, "]")
+	return
+}
+
+// Streams the rows of a JSON rows query into w as CSV, using the given fields as columns
+func WriteCsv(w io.Writer, rows Rows, columns ...string) (err error) {
+	out := csv.NewWriter(w)
+	if err = out.Write(columns); err != nil {
+		return
+	}
+
+	record := make([]string, len(columns))
+	for rows.Next() {
+		var raw []byte
+		if err = rows.Scan(&raw); err != nil {
+			return
+		}
+
+		var row map[string]any
+		decoder := json.NewDecoder(bytes.NewReader(raw))
+		decoder.UseNumber()
+		if err = decoder.Decode(&row); err != nil {
+			return
+		}
+
+		for i, column := range columns {
+			if record[i], err = csvValue(row[column]); err != nil {
+				return
+			}
+		}
+		if err = out.Write(record); err != nil {
+			return
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return
+	}
+
+	out.Flush()
+	return out.Error()
+}
+
+func csvValue(v any) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case json.Number, bool:
+		return fmt.Sprint(v), nil
+	default:
+		b, err := json.Marshal(v)
+		return string(b), err
+	}
+}
+
+// Streams content into an object of a bucket. The upload is aborted when write fails.
+func UploadObject(ctx context.Context, bucket objects.Uploader, key string, write func(w io.Writer) error) (err error) {
+	writer := bucket.Upload(ctx, key)
+	if err = write(writer); err != nil {
+		writer.Abort(err)
+		return
+	}
+	return writer.Close()
+}
+
+// Streams the rows of a JSON rows query into an object of a bucket as a JSON array
+func StageJsonRows(ctx context.Context, bucket objects.Uploader, key string, rows Rows) error {
+	defer rows.Close()
+	return UploadObject(ctx, bucket, key, func(w io.Writer) error {
+		return WriteJsonArray(w, rows)
+	})
+}
+
+// Streams the rows of a JSON rows query into an object of a bucket as CSV
+func StageCsvRows(ctx context.Context, bucket objects.Uploader, key string, rows Rows, columns ...string) error {
+	defer rows.Close()
+	return UploadObject(ctx, bucket, key, func(w io.Writer) error {
+		return WriteCsv(w, rows, columns...)
+	})
+}
@@ -0,0 +1,62 @@
+package helpers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Serves JSON rows the way a JSON rows query does
+type jsonRows struct {
+	rows []string
+	next int
+	err  error
+}
+
+func (r *jsonRows) Next() bool {
+	r.next++
+	return r.next <= len(r.rows)
+}
+
+func (r *jsonRows) Scan(dest ...any) error {
+	*dest[0].(*[]byte) = []byte(r.rows[r.next-1])
+	return nil
+}
+
+func (r *jsonRows) Err() error { return r.err }
+func (r *jsonRows) Close()     {}
+
+func TestWriteJsonArray(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteJsonArray(&buf, &jsonRows{rows: []string{`{"id":1}`, `{"id":2,"name":"Ébène"}`}})
+
+	assert.Nil(t, err)
+	assert.True(t, json.Valid(buf.Bytes()))
+	assert.Equal(t, `[{"id":1},{"id":2,"name":"Ébène"}]`, buf.String())
+}
+
+func TestWriteJsonArrayWithoutRows(t *testing.T) {
+	var buf bytes.Buffer
+	assert.Nil(t, WriteJsonArray(&buf, &jsonRows{}))
+	assert.Equal(t, "[]", buf.String())
+}
+
+func TestWriteJsonArrayReportsRowErrors(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteJsonArray(&buf, &jsonRows{rows: []string{`{"id":1}`}, err: errors.New("connection reset")})
+	assert.EqualError(t, err, "connection reset")
+}
+
+func TestWriteCsv(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteCsv(&buf, &jsonRows{rows: []string{
+		`{"key":"a","size":12345678901,"tags":["x"],"name":"report, final.pdf"}`,
+		`{"key":"b","size":null,"secret":"ignored"}`,
+	}}, "key", "name", "size", "tags")
+
+	assert.Nil(t, err)
+	assert.Equal(t, "key,name,size,tags\na,\"report, final.pdf\",12345678901,\"[\"\"x\"\"]\"\nb,,,\n", buf.String())
+}
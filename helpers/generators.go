@@ -1,14 +1,14 @@
 package helpers
 
 import (
-	"math/rand"
+	"crypto/rand"
 	"time"
 
 	"github.com/oklog/ulid"
 )
 
+// Generates a ULID from the current time and cryptographic entropy. IDs are unique across calls, as they are used as
+// object keys.
 func NewUlid() string {
-	t := time.Unix(1000000, 0)
-	entropy := ulid.Monotonic(rand.New(rand.NewSource(t.UnixNano())), 0)
-	return ulid.MustNew(ulid.Timestamp(t), entropy).String()
+	return ulid.MustNew(ulid.Timestamp(time.Now()), rand.Reader).String()
 }
@@ -0,0 +1,19 @@
+package helpers
+
+import (
+	"testing"
+
+	"github.com/oklog/ulid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewUlid(t *testing.T) {
+	seen := make(map[string]bool)
+	for range 1000 {
+		id := NewUlid()
+		_, err := ulid.Parse(id)
+		assert.Nil(t, err)
+		assert.False(t, seen[id], "%s was generated twice", id)
+		seen[id] = true
+	}
+}
@@ -0,0 +1,108 @@
+package helpers
+
+import "context"
+
+// The number of candidate batches scanned for a single page before returning it partially filled.
+const maxScannedBatches = 10
+
+// The number of candidates fetched per batch by full scans, such as counts and offsets.
+const ScanBatchSize = 100
+
+// Fetches at most limit candidate rows ordered by their cursor, starting after the given cursor (0 starts from the beginning).
+type CursorFetcher[T any] func(ctx context.Context, after uint64, limit uint) ([]T, error)
+
+// Keeps the candidate rows the caller may see, preserving their order.
+type RowFilter[T any] func(ctx context.Context, rows []T) ([]T, error)
+
+// Builds a page of at most size authorized rows by scanning candidates in batches, so that only a bounded number of
+// rows is held in memory. The returned cursor resumes the scan and is 0 only when no authorized row remains after the
+// page. A page may hold fewer than size rows while a cursor is still returned if too many candidates were filtered out.
+func AuthorizedPage[T any](ctx context.Context, after uint64, size uint, fetch CursorFetcher[T], filter RowFilter[T], cursorOf func(T) uint64) (ans []T, next uint64, err error) {
+	ans = make([]T, 0, size)
+	if size == 0 {
+		return
+	}
+	batchSize := max(size*2, 20)
+
+	for i := 0; i < maxScannedBatches; i++ {
+		var rows, allowed []T
+		if rows, err = fetch(ctx, after, batchSize); err != nil {
+			return
+		}
+
+		if allowed, err = filter(ctx, rows); err != nil {
+			return
+		}
+
+		for _, v := range allowed {
+			// An authorized row beyond the page proves that another page exists.
+			if uint(len(ans)) == size {
+				next = cursorOf(ans[len(ans)-1])
+				return
+			}
+			ans = append(ans, v)
+		}
+
+		if uint(len(rows)) < batchSize {
+			return
+		}
+		after = cursorOf(rows[len(rows)-1])
+	}
+
+	// The scan budget ran out with candidates left, which may or may not be authorized.
+	next = after
+	if uint(len(ans)) == size {
+		next = cursorOf(ans[len(ans)-1])
+	}
+	return
+}
+
+// Counts every authorized candidate by scanning them in batches.
+func CountAuthorized[T any](ctx context.Context, batchSize uint, fetch CursorFetcher[T], filter RowFilter[T], cursorOf func(T) uint64) (ans uint, err error) {
+	var after uint64
+	for {
+		var rows, allowed []T
+		if rows, err = fetch(ctx, after, batchSize); err != nil {
+			return
+		}
+
+		if allowed, err = filter(ctx, rows); err != nil {
+			return
+		}
+		ans += uint(len(allowed))
+
+		if uint(len(rows)) < batchSize {
+			return
+		}
+		after = cursorOf(rows[len(rows)-1])
+	}
+}
+
+// Finds the cursor following the first skip authorized candidates, so that offset-based pages resume as cursor scans.
+// When fewer candidates are authorized, the cursor follows every candidate and so resumes to an empty page.
+func AuthorizedOffset[T any](ctx context.Context, skip, batchSize uint, fetch CursorFetcher[T], filter RowFilter[T], cursorOf func(T) uint64) (after uint64, err error) {
+	for skip > 0 {
+		var rows, allowed []T
+		if rows, err = fetch(ctx, after, batchSize); err != nil {
+			return
+		}
+
+		if allowed, err = filter(ctx, rows); err != nil {
+			return
+		}
+
+		if uint(len(allowed)) >= skip {
+			after = cursorOf(allowed[skip-1])
+			return
+		}
+		skip -= uint(len(allowed))
+
+		if len(rows) > 0 {
+			after = cursorOf(rows[len(rows)-1])
+		}
+		if uint(len(rows)) < batchSize {
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,150 @@
+package helpers
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Candidates are their own cursors, served in descending order like the listings that use them.
+func descendingFetcher(count uint64, fetched *int) CursorFetcher[uint64] {
+	return func(ctx context.Context, after uint64, limit uint) (ans []uint64, err error) {
+		*fetched++
+		start := count
+		if after > 0 {
+			start = after - 1
+		}
+		for id := start; id > 0 && uint(len(ans)) < limit; id-- {
+			ans = append(ans, id)
+		}
+		return
+	}
+}
+
+func keepIf(predicate func(uint64) bool) RowFilter[uint64] {
+	return func(ctx context.Context, rows []uint64) (ans []uint64, err error) {
+		for _, v := range rows {
+			if predicate(v) {
+				ans = append(ans, v)
+			}
+		}
+		return
+	}
+}
+
+func identity(v uint64) uint64 { return v }
+
+func everything(uint64) bool { return true }
+
+func TestAuthorizedPageWalksEveryRowOnce(t *testing.T) {
+	var fetched int
+	even := keepIf(func(v uint64) bool { return v%2 == 0 })
+
+	var seen []uint64
+	var after uint64
+	for {
+		page, next, err := AuthorizedPage(context.TODO(), after, 7, descendingFetcher(100, &fetched), even, identity)
+		assert.Nil(t, err)
+		seen = append(seen, page...)
+		if next == 0 {
+			break
+		}
+		assert.Len(t, page, 7)
+		after = next
+	}
+
+	assert.Len(t, seen, 50)
+	assert.Equal(t, uint64(100), seen[0])
+	assert.Equal(t, uint64(2), seen[len(seen)-1])
+}
+
+func TestAuthorizedPageReturnsNoCursorWhenNothingFollows(t *testing.T) {
+	var fetched int
+
+	// Exactly one page of candidates, all authorized.
+	page, next, err := AuthorizedPage(context.TODO(), 0, 5, descendingFetcher(5, &fetched), keepIf(everything), identity)
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{5, 4, 3, 2, 1}, page)
+	assert.Zero(t, next)
+
+	// More candidates than the page holds, none of which is authorized after the page.
+	page, next, err = AuthorizedPage(context.TODO(), 0, 2, descendingFetcher(40, &fetched), keepIf(func(v uint64) bool { return v > 38 }), identity)
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{40, 39}, page)
+	assert.Zero(t, next)
+}
+
+func TestAuthorizedPageReturnsCursorWhenMoreRowsFollow(t *testing.T) {
+	var fetched int
+
+	page, next, err := AuthorizedPage(context.TODO(), 0, 5, descendingFetcher(6, &fetched), keepIf(everything), identity)
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{6, 5, 4, 3, 2}, page)
+	assert.Equal(t, uint64(2), next)
+
+	page, next, err = AuthorizedPage(context.TODO(), next, 5, descendingFetcher(6, &fetched), keepIf(everything), identity)
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{1}, page)
+	assert.Zero(t, next)
+}
+
+func TestAuthorizedPageBoundsTheScan(t *testing.T) {
+	var fetched int
+
+	page, next, err := AuthorizedPage(context.TODO(), 0, 5, descendingFetcher(100_000, &fetched), keepIf(func(uint64) bool { return false }), identity)
+	assert.Nil(t, err)
+	assert.Empty(t, page)
+	assert.Equal(t, maxScannedBatches, fetched)
+	// The scan resumes after the last candidate seen.
+	assert.Equal(t, uint64(100_000-maxScannedBatches*20+1), next)
+}
+
+func TestAuthorizedPagePropagatesErrors(t *testing.T) {
+	failure := errors.New("boom")
+	fetch := func(ctx context.Context, after uint64, limit uint) ([]uint64, error) { return nil, failure }
+
+	_, _, err := AuthorizedPage(context.TODO(), 0, 5, fetch, keepIf(everything), identity)
+	assert.ErrorIs(t, err, failure)
+
+	var fetched int
+	filter := func(ctx context.Context, rows []uint64) ([]uint64, error) { return nil, failure }
+	_, _, err = AuthorizedPage(context.TODO(), 0, 5, descendingFetcher(10, &fetched), filter, identity)
+	assert.ErrorIs(t, err, failure)
+}
+
+func TestCountAuthorizedCountsAcrossBatches(t *testing.T) {
+	var fetched int
+	count, err := CountAuthorized(context.TODO(), 20, descendingFetcher(95, &fetched), keepIf(func(v uint64) bool { return v%3 == 0 }), identity)
+	assert.Nil(t, err)
+	assert.Equal(t, uint(31), count)
+	assert.Equal(t, 5, fetched)
+}
+
+func TestAuthorizedOffsetResumesAfterSkippedRows(t *testing.T) {
+	var fetched int
+	even := keepIf(func(v uint64) bool { return v%2 == 0 })
+
+	after, err := AuthorizedOffset(context.TODO(), 14, 20, descendingFetcher(100, &fetched), even, identity)
+	assert.Nil(t, err)
+	page, _, err := AuthorizedPage(context.TODO(), after, 7, descendingFetcher(100, &fetched), even, identity)
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{72, 70, 68, 66, 64, 62, 60}, page)
+
+	after, err = AuthorizedOffset(context.TODO(), 0, 20, descendingFetcher(100, &fetched), even, identity)
+	assert.Nil(t, err)
+	assert.Zero(t, after)
+}
+
+func TestAuthorizedOffsetPastTheEndResumesToAnEmptyPage(t *testing.T) {
+	var fetched int
+	even := keepIf(func(v uint64) bool { return v%2 == 0 })
+
+	after, err := AuthorizedOffset(context.TODO(), 60, 20, descendingFetcher(100, &fetched), even, identity)
+	assert.Nil(t, err)
+	page, next, err := AuthorizedPage(context.TODO(), after, 7, descendingFetcher(100, &fetched), even, identity)
+	assert.Nil(t, err)
+	assert.Empty(t, page)
+	assert.Zero(t, next)
+}
@@ -0,0 +1,315 @@
+package helpers
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/color"
+	"strconv"
+	"strings"
+)
+
+// The size of the pages of generated documents (A4), in points
+const (
+	PdfPageWidth  = 595.28
+	PdfPageHeight = 841.89
+)
+
+type PdfFont int
+
+// The standard fonts every PDF reader provides, which spares embedding font files in the documents
+const (
+	PdfRegular PdfFont = iota
+	PdfBold
+)
+
+type PdfColor struct {
+	R, G, B uint8
+}
+
+var (
+	PdfBlack = PdfColor{0, 0, 0}
+	PdfWhite = PdfColor{255, 255, 255}
+)
+
+// Parses a hex color code, e.g. #1a2b3c
+func ParsePdfColor(hex string) (ans PdfColor, ok bool) {
+	hex = strings.TrimPrefix(hex, "#")
+	if len(hex) != 6 {
+		return
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return
+	}
+	return PdfColor{uint8(v >> 16), uint8(v >> 8), uint8(v)}, true
+}
+
+// Mixes a color with white, a ratio of 1 leaving the color as it is
+func (c PdfColor) Tint(ratio float64) PdfColor {
+	mix := func(v uint8) uint8 {
+		return uint8(float64(v)*ratio + 255*(1-ratio))
+	}
+	return PdfColor{mix(c.R), mix(c.G), mix(c.B)}
+}
+
+func (c PdfColor) operands() string {
+	return fmt.Sprintf("%.3f %.3f %.3f", float64(c.R)/255, float64(c.G)/255, float64(c.B)/255)
+}
+
+// A minimal PDF writer laying out text, lines, rectangles and images on A4 pages. Positions are given in points from
+// the top-left corner of the page, text being positioned by its baseline.
+type PdfDocument struct {
+	title  string
+	pages  []*bytes.Buffer
+	images []pdfImage
+}
+
+type pdfImage struct {
+	width, height int
+	// Uncompressed RGB samples
+	samples []byte
+}
+
+func NewPdfDocument(title string) *PdfDocument {
+	return &PdfDocument{title: title}
+}
+
+// Starts a new page, on which everything is drawn until the next one is added
+func (d *PdfDocument) AddPage() {
+	d.pages = append(d.pages, new(bytes.Buffer))
+}
+
+func (d *PdfDocument) page() *bytes.Buffer {
+	if len(d.pages) == 0 {
+		d.AddPage()
+	}
+	return d.pages[len(d.pages)-1]
+}
+
+func (d *PdfDocument) Text(x, y float64, font PdfFont, size float64, c PdfColor, text string) {
+	fmt.Fprintf(d.page(), "BT /F%d %.2f Tf %s rg %.2f %.2f Td (%s) Tj ET\n", font+1, size, c.operands(), x, PdfPageHeight-y, pdfEscape(pdfEncode(text)))
+}
+
+// Writes text so that it ends at x
+func (d *PdfDocument) TextRight(x, y float64, font PdfFont, size float64, c PdfColor, text string) {
+	d.Text(x-PdfTextWidth(text, font, size), y, font, size, c, text)
+}
+
+// Writes text centered on x
+func (d *PdfDocument) TextCenter(x, y float64, font PdfFont, size float64, c PdfColor, text string) {
+	d.Text(x-PdfTextWidth(text, font, size)/2, y, font, size, c, text)
+}
+
+func (d *PdfDocument) Rect(x, y, w, h float64, fill PdfColor) {
+	fmt.Fprintf(d.page(), "%s rg %.2f %.2f %.2f %.2f re f\n", fill.operands(), x, PdfPageHeight-y-h, w, h)
+}
+
+func (d *PdfDocument) Line(x1, y1, x2, y2, width float64, c PdfColor) {
+	fmt.Fprintf(d.page(), "%s RG %.2f w %.2f %.2f m %.2f %.2f l S\n", c.operands(), width, x1, PdfPageHeight-y1, x2, PdfPageHeight-y2)
+}
+
+// The most pixels kept on the longest side of images, larger ones being downsampled
+const pdfMaxImageSize = 300
+
+// Draws an image in the given box. Transparent areas are rendered white.
+func (d *PdfDocument) Image(img image.Image, x, y, w, h float64) {
+	bounds := img.Bounds()
+	step := 1 + (max(bounds.Dx(), bounds.Dy())-1)/pdfMaxImageSize
+	width, height := (bounds.Dx()+step-1)/step, (bounds.Dy()+step-1)/step
+
+	samples := make([]byte, 0, width*height*3)
+	for py := bounds.Min.Y; py < bounds.Max.Y; py += step {
+		for px := bounds.Min.X; px < bounds.Max.X; px += step {
+			c := color.NRGBAModel.Convert(img.At(px, py)).(color.NRGBA)
+			for _, v := range []uint8{c.R, c.G, c.B} {
+				samples = append(samples, uint8((uint(v)*uint(c.A)+255*(255-uint(c.A)))/255))
+			}
+		}
+	}
+
+	d.images = append(d.images, pdfImage{width: width, height: height, samples: samples})
+	fmt.Fprintf(d.page(), "q %.2f 0 0 %.2f %.2f %.2f cm /Im%d Do Q\n", w, h, x, PdfPageHeight-y-h, len(d.images))
+}
+
+// Renders the document
+func (d *PdfDocument) Bytes() ([]byte, error) {
+	var out bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+	stream := func(dict string, content []byte) error {
+		var compressed bytes.Buffer
+		w := zlib.NewWriter(&compressed)
+		if _, err := w.Write(content); err != nil {
+			return err
+		}
+		if err := w.Close(); err != nil {
+			return err
+		}
+		object(fmt.Sprintf("<< %s /Filter /FlateDecode /Length %d >>\nstream\n%s\nendstream", dict, compressed.Len(), compressed.Bytes()))
+		return nil
+	}
+
+	if len(d.pages) == 0 {
+		d.AddPage()
+	}
+
+	// Objects 1 to 5 are the catalog, the page tree, both fonts and the document information, followed by the
+	// images and each page along with its content
+	const firstImage = 6
+	firstPage := firstImage + len(d.images)
+	var kids []string
+	for i := range d.pages {
+		kids = append(kids, fmt.Sprintf("%d 0 R", firstPage+2*i))
+	}
+	var xObjects []string
+	for i := range d.images {
+		xObjects = append(xObjects, fmt.Sprintf("/Im%d %d 0 R", i+1, firstImage+i))
+	}
+
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	object(fmt.Sprintf("<< /Title (%s) /Producer (Scholaris) >>", pdfEscape(pdfEncode(d.title))))
+	for _, img := range d.images {
+		if err := stream(fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceRGB /BitsPerComponent 8", img.width, img.height), img.samples); err != nil {
+			return nil, err
+		}
+	}
+	for i, page := range d.pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> /XObject << %s >> >> /Contents %d 0 R >>", PdfPageWidth, PdfPageHeight, strings.Join(xObjects, " "), firstPage+2*i+1))
+		if err := stream("", page.Bytes()); err != nil {
+			return nil, err
+		}
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R /Info 5 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return out.Bytes(), nil
+}
+
+// Measures text written with one of the standard fonts
+func PdfTextWidth(text string, font PdfFont, size float64) float64 {
+	widths := helveticaWidths
+	if font == PdfBold {
+		widths = helveticaBoldWidths
+	}
+
+	var total int
+	for _, b := range pdfEncode(text) {
+		if b >= 32 && int(b-32) < len(widths) {
+			total += widths[b-32]
+		} else {
+			total += 556
+		}
+	}
+	return float64(total) * size / 1000
+}
+
+// Shortens text with an ellipsis so that it fits in the given width
+func PdfFitText(text string, font PdfFont, size, width float64) string {
+	if PdfTextWidth(text, font, size) <= width {
+		return text
+	}
+
+	runes := []rune(text)
+	for len(runes) > 0 {
+		runes = runes[:len(runes)-1]
+		candidate := strings.TrimSpace(string(runes)) + "..."
+		if PdfTextWidth(candidate, font, size) <= width {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// Splits text into lines fitting in the given width, breaking between words
+func PdfWrapText(text string, font PdfFont, size, width float64) (lines []string) {
+	var line string
+	for _, word := range strings.Fields(text) {
+		candidate := word
+		if line != "" {
+			candidate = line + " " + word
+		}
+		if line != "" && PdfTextWidth(candidate, font, size) > width {
+			lines = append(lines, line)
+			candidate = word
+		}
+		line = candidate
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return
+}
+
+// The characters of the Windows-1252 code page which differ from Latin-1
+var winAnsiCharacters = map[rune]byte{
+	'€': 0x80, '‚': 0x82, '„': 0x84, '…': 0x85, '‘': 0x91, '’': 0x92, '“': 0x93, '”': 0x94, '•': 0x95, '–': 0x96,
+	'—': 0x97, 'Œ': 0x8c, 'œ': 0x9c, 'Š': 0x8a, 'š': 0x9a, 'Ž': 0x8e, 'ž': 0x9e, 'Ÿ': 0x9f,
+}
+
+// Encodes text for the standard fonts, replacing the characters they cannot render
+func pdfEncode(text string) []byte {
+	ans := make([]byte, 0, len(text))
+	for _, r := range text {
+		switch {
+		case r < 32:
+			ans = append(ans, ' ')
+		case r < 127 || (r >= 0xa0 && r <= 0xff):
+			ans = append(ans, byte(r))
+		default:
+			if b, ok := winAnsiCharacters[r]; ok {
+				ans = append(ans, b)
+			} else {
+				ans = append(ans, '?')
+			}
+		}
+	}
+	return ans
+}
+
+func pdfEscape(text []byte) string {
+	var sb strings.Builder
+	for _, b := range text {
+		switch {
+		case b == '(' || b == ')' || b == '\\':
+			sb.WriteByte('\\')
+			sb.WriteByte(b)
+		case b >= 0x80:
+			fmt.Fprintf(&sb, "\\%03o", b)
+		default:
+			sb.WriteByte(b)
+		}
+	}
+	return sb.String()
+}
+
+// The widths of the printable ASCII characters, from the space onwards, in thousandths of the font size
+var helveticaWidths = []int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+var helveticaBoldWidths = []int{
+	278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+	975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+	333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+	611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+}
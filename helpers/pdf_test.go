@@ -0,0 +1,145 @@
+package helpers
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Reads the objects of a rendered document through its cross-reference table, failing when an offset is wrong
+func parsePdf(t *testing.T, data []byte) map[int]string {
+	t.Helper()
+	assert.True(t, bytes.HasPrefix(data, []byte("%PDF-1.4\n")))
+
+	match := regexp.MustCompile(`startxref\n(\d+)\n%%EOF\n$`).FindSubmatch(data)
+	if match == nil {
+		t.Fatal("the document does not end with startxref")
+	}
+	xref, _ := strconv.Atoi(string(match[1]))
+
+	var count int
+	if _, err := fmt.Sscanf(string(data[xref:]), "xref\n0 %d\n", &count); err != nil {
+		t.Fatalf("no cross-reference table at %d: %v", xref, err)
+	}
+	entries := data[bytes.IndexByte(data[xref+5:], '\n')+xref+6:]
+
+	objects := make(map[int]string)
+	for i := 1; i < count; i++ {
+		offset, err := strconv.Atoi(string(entries[i*20 : i*20+10]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		header := fmt.Sprintf("%d 0 obj\n", i)
+		if !bytes.HasPrefix(data[offset:], []byte(header)) {
+			t.Fatalf("object %d is not at offset %d", i, offset)
+		}
+		body := data[offset+len(header):]
+		objects[i] = string(body[:bytes.Index(body, []byte("\nendobj\n"))])
+	}
+	assert.Contains(t, string(data[xref:]), fmt.Sprintf("/Size %d ", count))
+	return objects
+}
+
+// Inflates the content of a stream object, checking its length
+func pdfStream(t *testing.T, object string) string {
+	t.Helper()
+	match := regexp.MustCompile(`(?s)/Length (\d+) >>\nstream\n(.*)\nendstream$`).FindStringSubmatch(object)
+	if match == nil {
+		t.Fatalf("not a stream: %q", object)
+	}
+	length, _ := strconv.Atoi(match[1])
+	assert.Equal(t, length, len(match[2]))
+
+	r, err := zlib.NewReader(strings.NewReader(match[2]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+// Decodes the string literals shown by the text operators of a content stream
+func pdfTexts(content string) (ans []string) {
+	for _, m := range regexp.MustCompile(`\(((?:[^\\()]|\\.)*)\) Tj`).FindAllStringSubmatch(content, -1) {
+		ans = append(ans, pdfDecode(m[1]))
+	}
+	return
+}
+
+func pdfDecode(literal string) string {
+	var raw []byte
+	for i := 0; i < len(literal); i++ {
+		if literal[i] != '\\' {
+			raw = append(raw, literal[i])
+			continue
+		}
+		if v, err := strconv.ParseUint(literal[i+1:min(i+4, len(literal))], 8, 8); err == nil {
+			raw = append(raw, byte(v))
+			i += 3
+		} else {
+			raw = append(raw, literal[i+1])
+			i++
+		}
+	}
+
+	var sb strings.Builder
+	for _, b := range raw {
+		r := rune(b)
+		for c, v := range winAnsiCharacters {
+			if v == b {
+				r = c
+			}
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+func TestPdfDocumentBytes(t *testing.T) {
+	doc := NewPdfDocument("Report (final)")
+	doc.Text(10, 20, PdfRegular, 12, PdfBlack, "First page")
+	doc.AddPage()
+	doc.Text(10, 20, PdfBold, 12, PdfBlack, "Second page")
+
+	data, err := doc.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	objects := parsePdf(t, data)
+	assert.Contains(t, objects[2], "/Count 2")
+	assert.Contains(t, objects[5], `/Title (Report \(final\))`)
+	assert.Equal(t, []string{"First page"}, pdfTexts(pdfStream(t, objects[7])))
+	assert.Equal(t, []string{"Second page"}, pdfTexts(pdfStream(t, objects[9])))
+}
+
+func TestPdfTextEncoding(t *testing.T) {
+	cases := map[string]string{
+		`Grade (A) \ 50%`:   `Grade (A) \ 50%`,
+		"Élodie Nguéma-Ôkà": "Élodie Nguéma-Ôkà",
+		"Œuvre — 15 €":      "Œuvre — 15 €",
+		"Nguyễn 李\tAn":      "Nguy?n ? An",
+	}
+	for text, expected := range cases {
+		doc := NewPdfDocument("Report card")
+		doc.Text(10, 20, PdfRegular, 12, PdfBlack, text)
+
+		data, err := doc.Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		objects := parsePdf(t, data)
+		assert.Equal(t, []string{expected}, pdfTexts(pdfStream(t, objects[7])), text)
+	}
+}
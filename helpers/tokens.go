@@ -0,0 +1,60 @@
+package helpers
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Signs a single-use token for the record with the given ID. Only the token's hash is stored so that leaked rows
+// cannot be redeemed. The purpose is part of the signature so tokens cannot be replayed against another flow.
+func SignToken(key, purpose string, id uint64) (token, hash string) {
+	nonce := make([]byte, 16)
+	_, _ = rand.Read(nonce)
+
+	payload := fmt.Sprintf("%d.%s", id, base64.RawURLEncoding.EncodeToString(nonce))
+	token = fmt.Sprintf("%s.%s", payload, base64.RawURLEncoding.EncodeToString(Sign(key, purpose+":"+payload)))
+	hash = HashToken(token)
+	return
+}
+
+// Checks the signature of a token signed with SignToken, returning the ID of its record and its hash
+func ParseToken(key, purpose, token string) (id uint64, hash string, ok bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return
+	}
+
+	if !hmac.Equal(signature, Sign(key, purpose+":"+parts[0]+"."+parts[1])) {
+		return
+	}
+
+	if id, err = strconv.ParseUint(parts[0], 10, 64); err != nil {
+		return
+	}
+
+	hash, ok = HashToken(token), true
+	return
+}
+
+// Computes the HMAC-SHA256 of a payload
+func Sign(key, payload string) []byte {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,33 @@
+package helpers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseToken(t *testing.T) {
+	token, hash := SignToken("key", "invitation", 42)
+
+	id, parsed, ok := ParseToken("key", "invitation", token)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(42), id)
+	assert.Equal(t, hash, parsed)
+}
+
+func TestParseTokenRejectsForeignTokens(t *testing.T) {
+	token, _ := SignToken("key", "invitation", 42)
+
+	_, _, ok := ParseToken("key", "ownership-transfer", token)
+	assert.False(t, ok, "tokens are bound to their purpose")
+
+	_, _, ok = ParseToken("other", "invitation", token)
+	assert.False(t, ok, "tokens are bound to their key")
+
+	_, _, ok = ParseToken("key", "invitation", strings.Replace(token, "42.", "43.", 1))
+	assert.False(t, ok, "the ID is signed")
+
+	_, _, ok = ParseToken("key", "invitation", "42.nonce")
+	assert.False(t, ok)
+}
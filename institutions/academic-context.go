@@ -0,0 +1,97 @@
+package institutions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"encore.dev/rlog"
+	"encore.dev/storage/cache"
+	"github.com/brinestone/scholaris/dto"
+	"github.com/brinestone/scholaris/util"
+)
+
+// The most academic years of an institution considered when resolving its academic context
+const maxContextAcademicYears = 100
+
+// Resolves the academic year, term and week an institution is in at a point in time, now by default.
+//
+//encore:api public method=GET path=/institutions/:id/academic-context
+func FindAcademicContext(ctx context.Context, id uint64, req dto.FindAcademicContextRequest) (*dto.AcademicContext, error) {
+	if _, err := findInstitutionByGenericIdentifier(ctx, fmt.Sprintf("%d", id)); err != nil {
+		return nil, err
+	}
+
+	years, err := findCachedAcademicYears(ctx, id)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return nil, &util.ErrUnknown
+	}
+
+	date := req.Date
+	if date.IsZero() {
+		date = time.Now()
+	}
+	return resolveAcademicContext(id, years, date.UTC()), nil
+}
+
+// Private section
+
+func findCachedAcademicYears(ctx context.Context, institution uint64) ([]dto.AcademicYear, error) {
+	cached, err := academicYearsCache.Get(ctx, institution)
+	if err == nil {
+		return cached.AcademicYears, nil
+	} else if !errors.Is(err, cache.Miss) {
+		rlog.Error(util.MsgCacheAccessError, "err", err)
+	}
+
+	years, err := findAcademicYears(ctx, institution, 0, maxContextAcademicYears)
+	if err != nil {
+		return nil, err
+	}
+
+	ans := academicYearsToDto(years...)
+	_ = academicYearsCache.Set(ctx, institution, dto.GetAcademicYearsResponse{AcademicYears: ans})
+	return ans, nil
+}
+
+// Drops the cached academic years of an institution. Must be called whenever its years or terms change.
+func evictCachedAcademicYears(ctx context.Context, institution uint64) {
+	_, _ = academicYearsCache.Delete(ctx, institution)
+}
+
+func resolveAcademicContext(institution uint64, years []dto.AcademicYear, date time.Time) *dto.AcademicContext {
+	ans := &dto.AcademicContext{
+		Institution: institution,
+		Date:        date,
+	}
+
+	var terms []dto.AcademicTerm
+	for i, y := range years {
+		if !date.Before(y.StartDate) && date.Before(y.EndDate) {
+			ans.Year = &years[i]
+		}
+		terms = append(terms, y.Terms...)
+	}
+
+	slices.SortFunc(terms, func(a, b dto.AcademicTerm) int {
+		return a.StartDate.Compare(b.StartDate)
+	})
+
+	for i, t := range terms {
+		if date.Before(t.StartDate) {
+			ans.NextTerm = &terms[i]
+			break
+		} else if date.Before(t.EndDate) {
+			ans.Term = &terms[i]
+			ans.Week = int(date.Sub(t.StartDate)/(7*24*time.Hour)) + 1
+		} else {
+			ans.PreviousTerm = &terms[i]
+		}
+	}
+
+	ans.Vacation = ans.Year != nil && ans.Term == nil
+	return ans
+}
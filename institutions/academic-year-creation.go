@@ -0,0 +1,469 @@
+package institutions
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"html"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"encore.dev/rlog"
+	"encore.dev/storage/sqldb"
+	"github.com/brinestone/scholaris/core/permissions"
+	"github.com/brinestone/scholaris/dto"
+	"github.com/brinestone/scholaris/models"
+	"github.com/brinestone/scholaris/settings"
+	"github.com/brinestone/scholaris/util"
+)
+
+const (
+	// The most institutions evaluated or run per invocation of the creation job
+	academicYearCreationBatchSize = 500
+	// How long to wait before running a failed or postponed creation again
+	academicYearCreationRetryInterval = 24 * time.Hour
+)
+
+// The settings taken into account by the automatic academic year creation
+var academicYearCreationSettingKeys = []string{
+	dto.SKAcademicYearAutoCreation,
+	dto.SKAcademicYearAutoCreationOffset,
+	dto.SKAcademicYearStartDateOffset,
+	dto.SKAcademicTermDurations,
+	dto.SKVacationDurations,
+}
+
+// Finds the automatic academic year creation schedule of an institution along with its latest runs
+//
+//encore:api auth method=GET path=/institutions/:id/academic-year-creation tag:can_update_institution
+func FindAcademicYearCreation(ctx context.Context, id uint64, params dto.CursorBasedPaginationParams) (*dto.AcademicYearCreation, error) {
+	ans := &dto.AcademicYearCreation{}
+
+	var schedule models.AcademicYearCreationSchedule
+	err := db.QueryRow(ctx, "SELECT enabled, next_run_at FROM academic_year_creation_schedules WHERE institution = $1;", id).Scan(&schedule.Enabled, &schedule.NextRunAt)
+	if err != nil && !errors.Is(err, sqldb.ErrNoRows) {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return nil, &util.ErrUnknown
+	}
+
+	ans.Enabled = schedule.Enabled
+	if schedule.Enabled && schedule.NextRunAt.Valid {
+		ans.NextRunAt = &schedule.NextRunAt.Time
+	}
+
+	size := params.PageSize()
+	query := fmt.Sprintf("SELECT %s FROM academic_year_creation_runs WHERE institution = $1 AND ($2 = 0 OR id < $2) ORDER BY id DESC LIMIT $3;", academicYearCreationRunFields)
+	runs, err := queryAcademicYearCreationRuns(ctx, query, id, params.After, size+1)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return nil, &util.ErrUnknown
+	}
+
+	if uint(len(runs)) > size {
+		runs = runs[:size]
+		ans.Next = runs[size-1].Id
+	}
+	ans.Runs = academicYearCreationRunsToDto(runs...)
+	return ans, nil
+}
+
+// Creates the academic years of the institutions whose automatic creation is due. Institutions which were never
+// scheduled are first scheduled according to their settings.
+//
+//encore:api private method=POST path=/academic-years/new/auto
+func AutoCreateAcademicYears(ctx context.Context) error {
+	unscheduled, err := findInstitutionIds(ctx, `
+		SELECT
+			i.id
+		FROM
+			institutions i
+		WHERE
+			NOT EXISTS (SELECT 1 FROM academic_year_creation_schedules s WHERE s.institution = i.id)
+		ORDER BY
+			i.id
+		LIMIT $1;
+	`, academicYearCreationBatchSize)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return &util.ErrUnknown
+	}
+
+	for _, id := range unscheduled {
+		if _, err = scheduleAcademicYearCreation(ctx, id); err != nil {
+			rlog.Error("could not schedule academic year creation", "institution", id, "err", err)
+		}
+	}
+
+	due, err := findInstitutionIds(ctx, `
+		SELECT
+			institution
+		FROM
+			academic_year_creation_schedules
+		WHERE
+			enabled AND next_run_at <= LOCALTIMESTAMP
+		ORDER BY
+			next_run_at
+		LIMIT $1;
+	`, academicYearCreationBatchSize)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return &util.ErrUnknown
+	}
+
+	for _, id := range due {
+		run, err := runAcademicYearCreation(ctx, id)
+		if err != nil {
+			rlog.Error("could not record academic year creation run", "institution", id, "err", err)
+		} else if run != nil {
+			rlog.Info("academic year creation ran", "institution", id, "status", run.Status)
+		}
+	}
+	return nil
+}
+
+// Private section
+
+type academicYearCreationSettings struct {
+	enabled bool
+	// The time between the end of the last academic year and the creation of the next one
+	creationOffset string
+	// The time between the creation and the start of an academic year
+	startOffset       string
+	termDurations     []string
+	vacationDurations []string
+}
+
+// Enables or disables the automatic academic year creation of an institution according to its settings. Enabled
+// creations are due immediately.
+func scheduleAcademicYearCreation(ctx context.Context, institution uint64) (enabled bool, err error) {
+	c, err := findAcademicYearCreationSettings(ctx, institution)
+	if err != nil {
+		return
+	}
+
+	_, err = db.Exec(ctx, `
+		INSERT INTO academic_year_creation_schedules(institution, enabled, next_run_at)
+		VALUES ($1,$2,CASE WHEN $2 THEN LOCALTIMESTAMP END)
+		ON CONFLICT (institution) DO UPDATE SET
+			enabled = EXCLUDED.enabled,
+			next_run_at = EXCLUDED.next_run_at,
+			updated_at = CURRENT_TIMESTAMP;
+	`, institution, c.enabled)
+	return c.enabled, err
+}
+
+// Runs the automatic academic year creation of an institution and records its outcome. Nothing is recorded when
+// the creation is disabled.
+func runAcademicYearCreation(ctx context.Context, institution uint64) (*models.AcademicYearCreationRun, error) {
+	run, err := createScheduledAcademicYear(ctx, institution)
+	if err != nil {
+		rlog.Error("automatic academic year creation failed", "institution", institution, "err", err)
+		return recordAcademicYearCreationFailure(ctx, institution, "The academic year could not be created because of an internal error", false)
+	}
+	return run, nil
+}
+
+func createScheduledAcademicYear(ctx context.Context, institution uint64) (*models.AcademicYearCreationRun, error) {
+	c, err := findAcademicYearCreationSettings(ctx, institution)
+	if err != nil {
+		return nil, err
+	}
+
+	if !c.enabled {
+		_, err = db.Exec(ctx, "UPDATE academic_year_creation_schedules SET enabled = false, next_run_at = NULL, updated_at = CURRENT_TIMESTAMP WHERE institution = $1;", institution)
+		return nil, err
+	}
+
+	if reason := checkAcademicYearCreationSettings(ctx, c); len(reason) > 0 {
+		return recordAcademicYearCreationFailure(ctx, institution, reason, true)
+	}
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Locking the schedule keeps concurrent runs from creating the same academic year twice
+	var verified, archived bool
+	err = tx.QueryRow(ctx, `
+		SELECT
+			i.verified,
+			i.archived_at IS NOT NULL
+		FROM
+			academic_year_creation_schedules s
+			JOIN institutions i ON i.id = s.institution
+		WHERE
+			s.institution = $1
+		FOR UPDATE OF s;
+	`, institution).Scan(&verified, &archived)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	retryAt := time.Now().UTC().Add(academicYearCreationRetryInterval)
+	if !verified {
+		return finishAcademicYearCreation(ctx, tx, institution, dto.AYCSSkipped, "The institution is not verified", 0, retryAt)
+	} else if archived {
+		return finishAcademicYearCreation(ctx, tx, institution, dto.AYCSSkipped, "The institution is archived", 0, retryAt)
+	}
+
+	// Institutions without academic years are due right away
+	var dueAt time.Time
+	var due, inProgress bool
+	if err = tx.QueryRow(ctx, `
+		SELECT
+			d.due_at,
+			LOCALTIMESTAMP >= d.due_at,
+			d.in_progress
+		FROM
+			(
+				SELECT
+					COALESCE(MAX(end_date) + $2::INTERVAL, LOCALTIMESTAMP) AS due_at,
+					COALESCE(bool_or(LOCALTIMESTAMP BETWEEN start_date AND end_date), false) AS in_progress
+				FROM
+					vw_AllAcademicYears
+				WHERE
+					institution_id = $1
+			) d;
+	`, institution, c.creationOffset).Scan(&dueAt, &due, &inProgress); err != nil {
+		return nil, err
+	}
+
+	if !due {
+		return finishAcademicYearCreation(ctx, tx, institution, dto.AYCSSkipped, fmt.Sprintf("The next academic year is due on %s", dueAt.Format(time.DateOnly)), 0, dueAt)
+	} else if inProgress {
+		return finishAcademicYearCreation(ctx, tx, institution, dto.AYCSSkipped, "An academic year is in progress", 0, retryAt)
+	}
+
+	yearId, termIds, err := insertAcademicYear(ctx, tx, institution, c.startOffset, c.termDurations, c.vacationDurations)
+	if err != nil {
+		return nil, err
+	}
+
+	var nextRunAt time.Time
+	if err = tx.QueryRow(ctx, "SELECT end_date + $2::INTERVAL FROM vw_AllAcademicYears WHERE year_id = $1;", yearId, c.creationOffset).Scan(&nextRunAt); err != nil {
+		return nil, err
+	}
+
+	if err = permissions.SetPermissions(ctx, academicYearPermissions(institution, yearId, termIds)); err != nil {
+		return nil, err
+	}
+
+	run, err := finishAcademicYearCreation(ctx, tx, institution, dto.AYCSCreated, "", yearId, nextRunAt)
+	if err == nil {
+		evictCachedAcademicYears(ctx, institution)
+	}
+	return run, err
+}
+
+// Records the outcome of a run and schedules the next one, then commits the run's transaction
+func finishAcademicYearCreation(ctx context.Context, tx *sqldb.Tx, institution uint64, status dto.AcademicYearCreationStatus, reason string, year uint64, nextRunAt time.Time) (*models.AcademicYearCreationRun, error) {
+	if _, err := tx.Exec(ctx, "UPDATE academic_year_creation_schedules SET next_run_at = $2, updated_at = CURRENT_TIMESTAMP WHERE institution = $1;", institution, nextRunAt.UTC()); err != nil {
+		return nil, err
+	}
+
+	run, err := insertAcademicYearCreationRun(ctx, tx, institution, status, reason, year)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+// Records a failed run and postpones the next one. Failures caused by the settings of the institution are reported
+// to its maintainers, once until a run succeeds or is skipped.
+func recordAcademicYearCreationFailure(ctx context.Context, institution uint64, reason string, misconfigured bool) (*models.AcademicYearCreationRun, error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var previousStatus sql.NullString
+	if err = tx.QueryRow(ctx, "SELECT (SELECT status FROM academic_year_creation_runs WHERE institution = $1 ORDER BY id DESC LIMIT 1);", institution).Scan(&previousStatus); err != nil {
+		return nil, err
+	}
+
+	run, err := finishAcademicYearCreation(ctx, tx, institution, dto.AYCSFailed, reason, 0, time.Now().Add(academicYearCreationRetryInterval))
+	if err != nil {
+		return nil, err
+	}
+
+	if misconfigured && previousStatus.String != string(dto.AYCSFailed) {
+		if _, err := AcademicYearCreationFailures.Publish(ctx, &AcademicYearCreationFailed{
+			Institution: institution,
+			Run:         run.Id,
+			Reason:      reason,
+			Timestamp:   time.Now(),
+		}); err != nil {
+			rlog.Error("could not publish academic year creation failure", "institution", institution, "err", err)
+		}
+	}
+	return run, nil
+}
+
+func insertAcademicYearCreationRun(ctx context.Context, tx *sqldb.Tx, institution uint64, status dto.AcademicYearCreationStatus, reason string, year uint64) (*models.AcademicYearCreationRun, error) {
+	query := fmt.Sprintf(`
+		INSERT INTO academic_year_creation_runs(institution, status, reason, academic_year)
+		VALUES ($1,$2,NULLIF($3,''),NULLIF($4,0))
+		RETURNING %s;
+	`, academicYearCreationRunFields)
+	return scanAcademicYearCreationRun(tx.QueryRow(ctx, query, institution, status, reason, year))
+}
+
+func findAcademicYearCreationSettings(ctx context.Context, institution uint64) (*academicYearCreationSettings, error) {
+	res, err := settings.FindSettingsInternal(ctx, dto.GetSettingsInternalRequest{
+		Owner:     institution,
+		OwnerType: string(dto.PTInstitution),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string][]string)
+	for _, s := range res.Settings {
+		for _, v := range s.Values {
+			if v.Value != nil && len(strings.TrimSpace(*v.Value)) > 0 {
+				values[s.Key] = append(values[s.Key], strings.TrimSpace(*v.Value))
+			}
+		}
+	}
+
+	ans := &academicYearCreationSettings{
+		termDurations:     values[dto.SKAcademicTermDurations],
+		vacationDurations: values[dto.SKVacationDurations],
+	}
+	if v := values[dto.SKAcademicYearAutoCreation]; len(v) > 0 {
+		ans.enabled, _ = strconv.ParseBool(v[0])
+	}
+	if v := values[dto.SKAcademicYearAutoCreationOffset]; len(v) > 0 {
+		ans.creationOffset = v[0]
+	}
+	if v := values[dto.SKAcademicYearStartDateOffset]; len(v) > 0 {
+		ans.startOffset = v[0]
+	}
+	return ans, nil
+}
+
+// Explains what is wrong with the automatic creation settings of an institution, if anything
+func checkAcademicYearCreationSettings(ctx context.Context, c *academicYearCreationSettings) string {
+	if len(c.creationOffset) == 0 {
+		return fmt.Sprintf("The %s setting is not set", dto.SKAcademicYearAutoCreationOffset)
+	} else if len(c.startOffset) == 0 {
+		return fmt.Sprintf("The %s setting is not set", dto.SKAcademicYearStartDateOffset)
+	} else if len(c.termDurations) == 0 {
+		return fmt.Sprintf("The %s setting is not set", dto.SKAcademicTermDurations)
+	} else if len(c.vacationDurations) > 0 && len(c.vacationDurations) != len(c.termDurations)-1 {
+		return fmt.Sprintf("The %s setting should have %d values, one less than the %s setting", dto.SKVacationDurations, len(c.termDurations)-1, dto.SKAcademicTermDurations)
+	}
+
+	durations := map[string][]string{
+		dto.SKAcademicYearAutoCreationOffset: {c.creationOffset},
+		dto.SKAcademicYearStartDateOffset:    {c.startOffset},
+		dto.SKAcademicTermDurations:          c.termDurations,
+		dto.SKVacationDurations:              c.vacationDurations,
+	}
+	for _, key := range academicYearCreationSettingKeys {
+		for _, value := range durations[key] {
+			// Durations are parsed the way they will be used, by PostgreSQL
+			var negative bool
+			if err := db.QueryRow(ctx, "SELECT $1::INTERVAL < '0'::INTERVAL;", value).Scan(&negative); err != nil {
+				return fmt.Sprintf("The %s setting has an invalid duration: %s", key, value)
+			} else if negative {
+				return fmt.Sprintf("The %s setting has a negative duration: %s", key, value)
+			}
+		}
+	}
+	return ""
+}
+
+func notifyMaintainersOfAcademicYearCreationFailure(ctx context.Context, msg *AcademicYearCreationFailed) error {
+	institution, err := findInstitutionByIdFromDb(ctx, msg.Institution)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	subject := fmt.Sprintf("Academic years of %s cannot be created automatically", institution.Name)
+	body := fmt.Sprintf("<p>The next academic year of <strong>%s</strong> could not be created automatically.</p><p>Reason: %s</p><p>Please review the academic year settings of the institution.</p>", institution.Name, html.EscapeString(msg.Reason))
+	return emailInstitutionMaintainers(ctx, fmt.Sprintf("academic-year-creation-failed:%d", msg.Run), institution.Id, subject, body)
+}
+
+func findInstitutionIds(ctx context.Context, query string, args ...any) (ans []uint64, err error) {
+	rows, err := db.Query(ctx, query, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id uint64
+		if err = rows.Scan(&id); err != nil {
+			return
+		}
+		ans = append(ans, id)
+	}
+	err = rows.Err()
+	return
+}
+
+const academicYearCreationRunFields = "id,institution,status,reason,academic_year,ran_at"
+
+func queryAcademicYearCreationRuns(ctx context.Context, query string, args ...any) (ans []*models.AcademicYearCreationRun, err error) {
+	rows, err := db.Query(ctx, query, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var run *models.AcademicYearCreationRun
+		if run, err = scanAcademicYearCreationRun(rows); err != nil {
+			return
+		}
+		ans = append(ans, run)
+	}
+	err = rows.Err()
+	return
+}
+
+func scanAcademicYearCreationRun(row rowScanner) (*models.AcademicYearCreationRun, error) {
+	run := new(models.AcademicYearCreationRun)
+	if err := row.Scan(&run.Id, &run.Institution, &run.Status, &run.Reason, &run.AcademicYear, &run.RanAt); err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+func academicYearCreationRunsToDto(runs ...*models.AcademicYearCreationRun) (ans []dto.AcademicYearCreationRun) {
+	ans = make([]dto.AcademicYearCreationRun, len(runs))
+	for i, v := range runs {
+		ans[i] = dto.AcademicYearCreationRun{
+			Id:     v.Id,
+			Status: dto.AcademicYearCreationStatus(v.Status),
+			RanAt:  v.RanAt,
+		}
+		if v.Reason.Valid {
+			ans[i].Reason = &v.Reason.String
+		}
+		if v.AcademicYear.Valid {
+			year := uint64(v.AcademicYear.Int64)
+			ans[i].AcademicYear = &year
+		}
+	}
+	return
+}
+
+func isAcademicYearCreationSetting(key string) bool {
+	return slices.Contains(academicYearCreationSettingKeys, key)
+}
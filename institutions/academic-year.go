@@ -4,16 +4,16 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"strconv"
-	"sync"
+	"strings"
 	"time"
 
+	"encore.dev/beta/auth"
+	"encore.dev/beta/errs"
 	"encore.dev/rlog"
 	"encore.dev/storage/sqldb"
 	"github.com/brinestone/scholaris/core/permissions"
 	"github.com/brinestone/scholaris/dto"
 	"github.com/brinestone/scholaris/models"
-	"github.com/brinestone/scholaris/settings"
 	"github.com/brinestone/scholaris/util"
 	"github.com/lib/pq"
 )
@@ -32,7 +32,7 @@ func GetAcademicYears(ctx context.Context, req dto.GetAcademicYearsRequest) (*dt
 
 // Manually creates an academic year
 //
-//encore:api auth method=POST path=/academic-years/new tag:can_create_academic_year
+//encore:api auth method=POST path=/academic-years/new tag:can_create_academic_year tag:institution_writable
 func CreateAcademicYear(ctx context.Context, req dto.NewAcademicYearRequest) error {
 	tx, err := db.Begin(ctx)
 	if err != nil {
@@ -47,21 +47,7 @@ func CreateAcademicYear(ctx context.Context, req dto.NewAcademicYearRequest) err
 		return &util.ErrUnknown
 	}
 
-	r := dto.UpdatePermissionsRequest{
-		Updates: []dto.PermissionUpdate{
-			{
-				Actor:    dto.IdentifierString(dto.PTInstitution, req.GetOwner()),
-				Relation: dto.PNOwner,
-				Target:   dto.IdentifierString(dto.PTAcademicYear, yearId),
-			},
-		},
-	}
-
-	for _, termId := range termIds {
-		r.Updates = append(r.Updates, dto.NewPermissionUpdate[uint64](dto.IdentifierString(dto.PTAcademicYear, yearId), dto.PNOwner, dto.IdentifierString(dto.PTAcademicTerm, termId)))
-	}
-
-	if err := permissions.SetPermissions(ctx, r); err != nil {
+	if err := permissions.SetPermissions(ctx, academicYearPermissions(req.GetOwner(), yearId, termIds)); err != nil {
 		tx.Rollback()
 		rlog.Error(util.MsgCallError, "err", err)
 		return &util.ErrUnknown
@@ -71,191 +57,226 @@ func CreateAcademicYear(ctx context.Context, req dto.NewAcademicYearRequest) err
 		rlog.Error(util.MsgDbAccessError, "err", err)
 		return &util.ErrUnknown
 	}
+
+	evictCachedAcademicYears(ctx, req.Institution)
 	return nil
 }
 
-// Automatically creates academic years
+// Inserts a term into an academic year. The year is stretched to cover its terms.
 //
-//encore:api private method=POST path=/academic-years/new/auto
-func AutoCreateAcademicYears(ctx context.Context) error {
-	stats, err := getInstitutionStats(ctx)
+//encore:api auth method=POST path=/institutions/:id/academic-years/:year/terms tag:can_edit_academic_year tag:institution_writable
+func CreateAcademicTerm(ctx context.Context, id, year uint64, req dto.NewAcademicTermRequest) (*dto.AcademicYear, error) {
+	tx, err := db.Begin(ctx)
 	if err != nil {
-		return err
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return nil, &util.ErrUnknown
 	}
+	defer tx.Rollback()
 
-	var size int = 1000
-	var wg sync.WaitGroup
-	for page := 0; page*size < int(stats.TotalVerified); page++ {
-		wg.Add(1)
-		go doAutocreateAcademicYears(ctx, &wg, page, size)
+	if err = lockAcademicYear(ctx, tx, id, year); errors.Is(err, sqldb.ErrNoRows) {
+		return nil, &util.ErrNotFound
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return nil, &util.ErrUnknown
 	}
 
-	wg.Wait()
-	return nil
+	// Terms are positioned relative to their creation time
+	var term uint64
+	if err = tx.QueryRow(ctx, "SELECT func_create_new_academic_term($1,$2,$3,$4::INTERVAL,$5::TIMESTAMP - LOCALTIMESTAMP);", year, id, req.Label, intervalString(req.Duration), req.StartDate.UTC()).Scan(&term); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return nil, &util.ErrUnknown
+	}
+
+	if err = fitAcademicYearToTerms(ctx, tx, year); err != nil {
+		return nil, err
+	}
+
+	if err = permissions.SetPermissions(ctx, dto.UpdatePermissionsRequest{
+		Updates: []dto.PermissionUpdate{
+			dto.NewPermissionUpdate[uint64](dto.IdentifierString(dto.PTAcademicYear, year), dto.PNOwner, dto.IdentifierString(dto.PTAcademicTerm, term)),
+		},
+	}); err != nil {
+		rlog.Error(util.MsgCallError, "err", err)
+		return nil, &util.ErrUnknown
+	}
+
+	if err = tx.Commit(); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return nil, &util.ErrUnknown
+	}
+
+	return academicYearChanged(ctx, id, year, term, dto.AYCTermCreated)
 }
 
-func doAutocreateAcademicYears(ctx context.Context, wg *sync.WaitGroup, page, size int) {
-	defer wg.Done()
+// Renames, shifts or resizes an academic term. The year is stretched or shrunk to cover its terms.
+//
+//encore:api auth method=PATCH path=/institutions/:id/academic-years/:year/terms/:term tag:can_edit_academic_term tag:institution_writable
+func UpdateAcademicTerm(ctx context.Context, id, year, term uint64, req dto.UpdateAcademicTermRequest) (*dto.AcademicYear, error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return nil, &util.ErrUnknown
+	}
+	defer tx.Rollback()
 
-	query := `
-		SELECT
-			id
-		FROM
-			institutions
+	if err = lockAcademicYear(ctx, tx, id, year); errors.Is(err, sqldb.ErrNoRows) {
+		return nil, &util.ErrNotFound
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return nil, &util.ErrUnknown
+	}
+
+	var startDate *time.Time
+	if req.StartDate != nil {
+		t := req.StartDate.UTC()
+		startDate = &t
+	}
+
+	var duration *string
+	if req.Duration != nil {
+		d := intervalString(*req.Duration)
+		duration = &d
+	}
+
+	res, err := tx.Exec(ctx, `
+		UPDATE academic_terms
+		SET
+			label = COALESCE($3, label),
+			start_offset = COALESCE($4::TIMESTAMP - created_at, start_offset),
+			duration = COALESCE($5::INTERVAL, duration),
+			updated_at = CURRENT_TIMESTAMP
 		WHERE
-			verified=true
-		OFFSET $1
-		LIMIT $2
-		;
-	`
-	rows, err := db.Query(ctx, query, page*size, size)
+			id = $1 AND year_id = $2;
+	`, term, year, req.Label, startDate, duration)
 	if err != nil {
-		return
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return nil, &util.ErrUnknown
+	} else if res.RowsAffected() == 0 {
+		return nil, &util.ErrNotFound
 	}
-	defer rows.Close()
 
-	for rows.Next() {
-		tx, err := db.Begin(ctx)
-		if err != nil {
-			rlog.Error(util.MsgDbAccessError, "err", err)
-			return
-		}
+	if err = fitAcademicYearToTerms(ctx, tx, year); err != nil {
+		return nil, err
+	}
 
-		var institution uint64
-		if err := rows.Scan(&institution); err != nil {
-			tx.Rollback()
-			rlog.Error(util.MsgDbAccessError, "err", err)
-			return
-		}
+	if err = tx.Commit(); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return nil, &util.ErrUnknown
+	}
 
-		yearAndTermsMap, err := autoCreateAcademicYear(ctx, tx, institution)
-		if err != nil {
-			tx.Rollback()
-			rlog.Error("error while auto-creating academic year", "institution", institution, "err", err)
-			return
-		}
+	return academicYearChanged(ctx, id, year, term, dto.AYCTermUpdated)
+}
 
-		if len(yearAndTermsMap) == 0 {
-			rlog.Warn("skipped academic year auto-creation", "institution", institution)
+// Removes a term from an academic year. The last term of a year and terms holding academic records cannot be
+// removed.
+//
+//encore:api auth method=DELETE path=/institutions/:id/academic-years/:year/terms/:term tag:can_delete_academic_term tag:institution_writable
+func DeleteAcademicTerm(ctx context.Context, id, year, term uint64) (*dto.AcademicYear, error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return nil, &util.ErrUnknown
+	}
+	defer tx.Rollback()
+
+	if err = lockAcademicYear(ctx, tx, id, year); errors.Is(err, sqldb.ErrNoRows) {
+		return nil, &util.ErrNotFound
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return nil, &util.ErrUnknown
+	}
+
+	var found bool
+	var termCount uint
+	if err = tx.QueryRow(ctx, "SELECT bool_or(id = $2), COUNT(*) FROM academic_terms WHERE year_id = $1;", year, term).Scan(&found, &termCount); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return nil, &util.ErrUnknown
+	}
+
+	if !found {
+		return nil, &util.ErrNotFound
+	} else if termCount <= 1 {
+		return nil, &errs.Error{
+			Code:    errs.FailedPrecondition,
+			Message: "An academic year must keep at least one term",
 		}
+	}
 
-		for yearId, termIds := range yearAndTermsMap {
-			req := dto.UpdatePermissionsRequest{
-				Updates: []dto.PermissionUpdate{
-					{
-						Actor:    dto.IdentifierString(dto.PTInstitution, institution),
-						Relation: dto.PNOwner,
-						Target:   dto.IdentifierString(dto.PTAcademicYear, yearId),
-					},
-				},
-			}
+	if err = assertNoAcademicRecords(ctx, tx, "academic term", year, term); err != nil {
+		return nil, err
+	}
 
-			for _, termId := range termIds {
-				req.Updates = append(req.Updates, dto.NewPermissionUpdate[uint64](dto.IdentifierString(dto.PTAcademicYear, yearId), dto.PNOwner, dto.IdentifierString(dto.PTAcademicTerm, termId)))
-			}
+	if _, err = tx.Exec(ctx, "DELETE FROM academic_terms WHERE id = $1;", term); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return nil, &util.ErrUnknown
+	}
 
-			if err := permissions.SetPermissions(ctx, req); err != nil {
-				tx.Rollback()
-				rlog.Error(util.MsgCallError, "err", err)
-				return
-			}
+	if err = fitAcademicYearToTerms(ctx, tx, year); err != nil {
+		return nil, err
+	}
 
-			if err := tx.Commit(); err != nil {
-				rlog.Error(util.MsgDbAccessError, "err", err)
-				return
-			}
-		}
+	if _, err = permissions.PurgeObjectTuples(ctx, dto.PurgeObjectTuplesRequest{
+		Objects: []string{dto.IdentifierString(dto.PTAcademicTerm, term)},
+	}); err != nil {
+		rlog.Error(util.MsgCallError, "err", err)
+		return nil, &util.ErrUnknown
 	}
+
+	if err = tx.Commit(); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return nil, &util.ErrUnknown
+	}
+
+	return academicYearChanged(ctx, id, year, term, dto.AYCTermDeleted)
 }
 
-// Creates an institution's academic year.
-func autoCreateAcademicYear(ctx context.Context, tx *sqldb.Tx, institution uint64) (ans map[uint64][]uint64, err error) {
-	ans = make(map[uint64][]uint64)
-	res, err := settings.FindSettingsInternal(ctx, dto.GetSettingsInternalRequest{
-		Owner: institution,
-	})
+// Deletes an academic year along with its terms. Years which have enrollment sessions, classes or other academic
+// records cannot be deleted.
+//
+//encore:api auth method=DELETE path=/institutions/:id/academic-years/:year tag:can_delete_academic_year tag:institution_writable
+func DeleteAcademicYear(ctx context.Context, id, year uint64) error {
+	tx, err := db.Begin(ctx)
 	if err != nil {
-		return
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return &util.ErrUnknown
 	}
+	defer tx.Rollback()
 
-	for _, s := range res.Settings {
-		switch s.Key {
-		case dto.SKAcademicYearAutoCreation:
-			valPtr := s.Values[0].Value
-			if valPtr == nil {
-				break
-			}
-			autoAcademicYearCreationEnabled, err := strconv.ParseBool(*valPtr)
-			if err != nil {
-				rlog.Error("parse error", "err", err)
-			}
+	if err = lockAcademicYear(ctx, tx, id, year); errors.Is(err, sqldb.ErrNoRows) {
+		return &util.ErrNotFound
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return &util.ErrUnknown
+	}
 
-			if err != nil || !autoAcademicYearCreationEnabled {
-				break
-			}
+	if err = assertNoAcademicRecords(ctx, tx, "academic year", year, 0); err != nil {
+		return err
+	}
 
-			var creationOffset, startOffset string
-			var academicYearDuration string
-			var academicTermDurations, vacationDurations []string
-
-			for _, ss := range res.Settings {
-				switch ss.Key {
-				case dto.SKAcademicYearAutoCreationOffset:
-					if len(ss.Values) > 0 && ss.Values[0].Value != nil {
-						creationOffset = *ss.Values[0].Value
-					} else {
-						return nil, fmt.Errorf("required setting not set - [%s]", ss.Key)
-					}
-				case dto.SKAcademicYearStartDateOffset:
-					if len(ss.Values) > 0 && ss.Values[0].Value != nil {
-						startOffset = *ss.Values[0].Value
-					} else {
-						return nil, fmt.Errorf("required setting not set - [%s]", ss.Key)
-					}
-				case dto.SKAcademicYearDuration:
-					if len(ss.Values) > 0 && ss.Values[0].Value != nil {
-						academicYearDuration = *ss.Values[0].Value
-					} else {
-						rlog.Error("required setting not set", "key", ss.Key)
-					}
-				case dto.SKAcademicTermDurations:
-					if len(ss.Values) > 0 {
-						for _, ssv := range ss.Values {
-							if ssv.Value == nil || len(*ssv.Value) == 0 {
-								continue
-							}
-							academicTermDurations = append(academicTermDurations, *ssv.Value)
-						}
-					} else {
-						rlog.Error("required setting not set", "key", ss.Key)
-					}
-				case dto.SKVacationDurations:
-					if len(ss.Values) > 0 {
-						for _, ssv := range ss.Values {
-							if ssv.Value == nil || len(*ssv.Value) == 0 {
-								continue
-							}
-							vacationDurations = append(vacationDurations, *ssv.Value)
-						}
-					} else {
-						rlog.Error("required setting not set", "key", ss.Key)
-					}
-				}
-			}
+	objects, err := academicYearObjects(ctx, tx, year)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return &util.ErrUnknown
+	}
 
-			if len(creationOffset) == 0 || len(startOffset) == 0 || len(academicYearDuration) == 0 || len(academicTermDurations) == 0 {
-				return nil, errors.New("insuficient parameters for auto academic year creation")
-			}
+	if _, err = tx.Exec(ctx, "DELETE FROM academic_years WHERE id = $1;", year); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return &util.ErrUnknown
+	}
 
-			var yearId uint64
-			var termIds []uint64
-			if err := tx.QueryRow(ctx, "SELECT year_id, term_ids FROM func_auto_create_academic_year($1,$2,$3,$4,$5,$6);", creationOffset, startOffset, institution, academicYearDuration, pq.Array(academicTermDurations), pq.Array(vacationDurations)).Scan(&yearId, pq.Array(&termIds)); err != nil {
-				return nil, err
-			}
-			ans[yearId] = termIds
-		}
+	if _, err = permissions.PurgeObjectTuples(ctx, dto.PurgeObjectTuplesRequest{Objects: objects}); err != nil {
+		rlog.Error(util.MsgCallError, "err", err)
+		return &util.ErrUnknown
 	}
-	return ans, nil
+
+	if err = tx.Commit(); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return &util.ErrUnknown
+	}
+
+	evictCachedAcademicYears(ctx, id)
+	publishAcademicYearChange(ctx, &models.AcademicYear{Id: year, Institution: id}, 0, dto.AYCYearDeleted)
+	return nil
 }
 
 func createAcademicYear(ctx context.Context, tx *sqldb.Tx, institution uint64, startOffset time.Duration, academicTermDurations, vacationDurations []time.Duration) (yearId uint64, termIds []uint64, err error) {
@@ -271,12 +292,33 @@ func createAcademicYear(ctx context.Context, tx *sqldb.Tx, institution uint64, s
 		termDurationStrings[i] = fmt.Sprintf("%.0f hours", v.Abs().Hours())
 	}
 
-	if err = tx.QueryRow(ctx, "SELECT year_id FROM func_create_academic_year($1,$2,$3,$4);", institution, startOffsetString, pq.Array(termDurationStrings), pq.Array(vacationDurationStrings)).Scan(&yearId); err != nil {
-		return
-	}
+	return insertAcademicYear(ctx, tx, institution, startOffsetString, termDurationStrings, vacationDurationStrings)
+}
+
+// Inserts an academic year along with its terms. The offset and durations are PostgreSQL intervals.
+func insertAcademicYear(ctx context.Context, tx *sqldb.Tx, institution uint64, startOffset string, termDurations, vacationDurations []string) (yearId uint64, termIds []uint64, err error) {
+	err = tx.QueryRow(ctx, "SELECT year_id, term_ids FROM func_create_academic_year($1,$2,$3,$4);", institution, startOffset, pq.Array(termDurations), pq.Array(vacationDurations)).Scan(&yearId, pq.Array(&termIds))
 	return
 }
 
+// Makes an institution the owner of an academic year, and the year the owner of its terms
+func academicYearPermissions(institution, year uint64, terms []uint64) dto.UpdatePermissionsRequest {
+	ans := dto.UpdatePermissionsRequest{
+		Updates: []dto.PermissionUpdate{
+			{
+				Actor:    dto.IdentifierString(dto.PTInstitution, institution),
+				Relation: dto.PNOwner,
+				Target:   dto.IdentifierString(dto.PTAcademicYear, year),
+			},
+		},
+	}
+
+	for _, term := range terms {
+		ans.Updates = append(ans.Updates, dto.NewPermissionUpdate[uint64](dto.IdentifierString(dto.PTAcademicYear, year), dto.PNOwner, dto.IdentifierString(dto.PTAcademicTerm, term)))
+	}
+	return ans
+}
+
 func findAcademicYears(ctx context.Context, institution uint64, page, size uint) (ans []*models.AcademicYear, err error) {
 	query := `
 		SELECT 
@@ -299,8 +341,6 @@ func findAcademicYears(ctx context.Context, institution uint64, page, size uint)
 	}
 	defer rows.Close()
 
-	yearMaps := make(map[uint64]*[]models.AcademicTerm)
-	var yearIds []uint64
 	for rows.Next() {
 		ay := new(models.AcademicYear)
 		if err = rows.Scan(&ay.Id, &ay.Institution, &ay.StartDate, &ay.Duration, &ay.EndDate, &ay.Label, &ay.CreatedAt, &ay.UpdatedAt); err != nil {
@@ -308,11 +348,35 @@ func findAcademicYears(ctx context.Context, institution uint64, page, size uint)
 		}
 
 		ans = append(ans, ay)
+	}
+
+	err = findAcademicTerms(ctx, institution, ans...)
+	return
+}
+
+// Finds an academic year of an institution along with its terms
+func findAcademicYear(ctx context.Context, institution, year uint64) (*models.AcademicYear, error) {
+	ay := new(models.AcademicYear)
+	if err := db.QueryRow(ctx, "SELECT * FROM vw_AllAcademicYears WHERE year_id = $1 AND institution_id = $2;", year, institution).Scan(&ay.Id, &ay.Institution, &ay.StartDate, &ay.Duration, &ay.EndDate, &ay.Label, &ay.CreatedAt, &ay.UpdatedAt); err != nil {
+		return nil, err
+	}
+
+	if err := findAcademicTerms(ctx, institution, ay); err != nil {
+		return nil, err
+	}
+	return ay, nil
+}
+
+// Loads the terms of academic years
+func findAcademicTerms(ctx context.Context, institution uint64, years ...*models.AcademicYear) (err error) {
+	yearMaps := make(map[uint64]*[]models.AcademicTerm)
+	var yearIds []uint64
+	for _, ay := range years {
 		yearMaps[ay.Id] = &ay.Terms
 		yearIds = append(yearIds, ay.Id)
 	}
 
-	query = `
+	query := `
 			SELECT
 				*
 			FROM
@@ -329,8 +393,8 @@ func findAcademicYears(ctx context.Context, institution uint64, page, size uint)
 
 	for rows2.Next() {
 		var at models.AcademicTerm
-		if err := rows2.Scan(&at.Id, &at.Year, &at.Institution, &at.StartDate, &at.Duration, &at.EndDate, &at.Label, &at.CreatedAt, &at.UpdatedAt); err != nil {
-			return nil, err
+		if err = rows2.Scan(&at.Id, &at.Year, &at.Institution, &at.StartDate, &at.Duration, &at.EndDate, &at.Label, &at.CreatedAt, &at.UpdatedAt); err != nil {
+			return
 		}
 		termsRef := *yearMaps[at.Year]
 		*yearMaps[at.Year] = append(termsRef, at)
@@ -373,3 +437,179 @@ func academicYearsToDto(year ...*models.AcademicYear) []dto.AcademicYear {
 
 	return ans
 }
+
+// Locks an academic year of an institution against concurrent changes to its terms
+func lockAcademicYear(ctx context.Context, tx *sqldb.Tx, institution, year uint64) error {
+	var id uint64
+	return tx.QueryRow(ctx, "SELECT id FROM academic_years WHERE id = $1 AND institution = $2 FOR UPDATE;", year, institution).Scan(&id)
+}
+
+// Makes an academic year span from the start of its first term to the end of its last one, rejecting terms which
+// overlap each other and years which would overlap another year of their institution
+func fitAcademicYearToTerms(ctx context.Context, tx *sqldb.Tx, year uint64) error {
+	var overlapping bool
+	if err := tx.QueryRow(ctx, `
+		SELECT EXISTS(
+			SELECT 1
+			FROM
+				academic_terms a
+				JOIN academic_terms b ON b.year_id = a.year_id AND b.id > a.id
+			WHERE
+				a.year_id = $1
+				AND a.created_at + a.start_offset < b.created_at + b.start_offset + b.duration
+				AND b.created_at + b.start_offset < a.created_at + a.start_offset + a.duration
+		);
+	`, year).Scan(&overlapping); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return &util.ErrUnknown
+	}
+
+	if overlapping {
+		return &errs.Error{
+			Code:    errs.FailedPrecondition,
+			Message: "The terms of an academic year cannot overlap",
+		}
+	}
+
+	if _, err := tx.Exec(ctx, `
+		UPDATE academic_years y
+		SET
+			start_offset = s.start_date - y.created_at,
+			duration = s.end_date - s.start_date,
+			updated_at = CURRENT_TIMESTAMP
+		FROM
+			(
+				SELECT
+					MIN(created_at + start_offset) AS start_date,
+					MAX(created_at + start_offset + duration) AS end_date
+				FROM
+					academic_terms
+				WHERE
+					year_id = $1
+			) s
+		WHERE
+			y.id = $1;
+	`, year); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return &util.ErrUnknown
+	}
+
+	if err := tx.QueryRow(ctx, `
+		SELECT EXISTS(
+			SELECT 1
+			FROM
+				academic_years y
+				JOIN academic_years o ON o.institution = y.institution AND o.id <> y.id
+			WHERE
+				y.id = $1
+				AND y.created_at + y.start_offset < o.created_at + o.start_offset + o.duration
+				AND o.created_at + o.start_offset < y.created_at + y.start_offset + y.duration
+		);
+	`, year).Scan(&overlapping); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return &util.ErrUnknown
+	}
+
+	if overlapping {
+		return &errs.Error{
+			Code:    errs.FailedPrecondition,
+			Message: "The academic year would overlap another academic year of the institution",
+		}
+	}
+	return nil
+}
+
+// Lists the authorization objects belonging to an academic year
+// Refuses to delete an academic year, or one of its terms when term is set, while records still depend on it
+func assertNoAcademicRecords(ctx context.Context, tx *sqldb.Tx, subject string, year, term uint64) error {
+	var records []string
+	err := tx.QueryRow(ctx, `
+		WITH
+			terms AS (
+				SELECT id FROM academic_terms WHERE year_id = $1 AND ($2 = 0 OR id = $2)
+			)
+		SELECT
+			ARRAY_REMOVE(
+				ARRAY[
+					CASE WHEN $2 = 0 AND EXISTS(SELECT 1 FROM enrollment_sessions WHERE year_id = $1) THEN 'enrollment sessions' END,
+					CASE WHEN $2 = 0 AND EXISTS(SELECT 1 FROM classes WHERE academic_year = $1) THEN 'classes' END,
+					CASE WHEN EXISTS(SELECT 1 FROM calendar_events WHERE academic_term IN (SELECT id FROM terms) OR ($2 = 0 AND academic_year = $1)) THEN 'calendar events' END,
+					CASE WHEN EXISTS(SELECT 1 FROM assessments WHERE academic_term IN (SELECT id FROM terms)) THEN 'assessments' END,
+					CASE WHEN EXISTS(SELECT 1 FROM report_card_jobs WHERE academic_term IN (SELECT id FROM terms))
+						OR EXISTS(SELECT 1 FROM report_cards WHERE academic_term IN (SELECT id FROM terms)) THEN 'report cards' END,
+					CASE WHEN EXISTS(SELECT 1 FROM attendance_sessions WHERE academic_term IN (SELECT id FROM terms))
+						OR EXISTS(SELECT 1 FROM attendance_alerts WHERE academic_term IN (SELECT id FROM terms)) THEN 'attendance records' END,
+					CASE WHEN EXISTS(SELECT 1 FROM timetables WHERE academic_term IN (SELECT id FROM terms)) THEN 'timetables' END
+				],
+				NULL
+			);
+	`, year, term).Scan(pq.Array(&records))
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return &util.ErrUnknown
+	}
+
+	if len(records) > 0 {
+		return &errs.Error{
+			Code:    errs.FailedPrecondition,
+			Message: fmt.Sprintf("The %s cannot be deleted while it has %s", subject, strings.Join(records, ", ")),
+		}
+	}
+	return nil
+}
+
+func academicYearObjects(ctx context.Context, tx *sqldb.Tx, year uint64) (ans []string, err error) {
+	rows, err := tx.Query(ctx, `
+		SELECT 'academicYear', $1::BIGINT
+		UNION ALL
+		SELECT 'academicTerm', id FROM academic_terms WHERE year_id = $1;
+	`, year)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var objectType string
+		var id uint64
+		if err = rows.Scan(&objectType, &id); err != nil {
+			return
+		}
+		ans = append(ans, dto.IdentifierString(dto.PermissionType(objectType), id))
+	}
+	err = rows.Err()
+	return
+}
+
+// Reloads an academic year after a change to its terms and lets the dependent schedules know about it
+func academicYearChanged(ctx context.Context, institution, year, term uint64, change dto.AcademicYearChange) (*dto.AcademicYear, error) {
+	evictCachedAcademicYears(ctx, institution)
+	ay, err := findAcademicYear(ctx, institution, year)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return nil, &util.ErrUnknown
+	}
+
+	publishAcademicYearChange(ctx, ay, term, change)
+	return &academicYearsToDto(ay)[0], nil
+}
+
+func publishAcademicYearChange(ctx context.Context, year *models.AcademicYear, term uint64, change dto.AcademicYearChange) {
+	uid, _ := auth.UserID()
+	if _, err := AcademicYearChanges.Publish(ctx, &AcademicYearChanged{
+		Institution: year.Institution,
+		Year:        year.Id,
+		Term:        term,
+		Change:      string(change),
+		StartDate:   year.StartDate,
+		EndDate:     year.EndDate,
+		ChangedBy:   uid,
+		Timestamp:   time.Now(),
+	}); err != nil {
+		rlog.Error("could not publish academic year change", "year", year.Id, "err", err)
+	}
+}
+
+func intervalString(d time.Duration) string {
+	return fmt.Sprintf("%.0f seconds", d.Abs().Seconds())
+}
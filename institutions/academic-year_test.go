@@ -36,6 +36,9 @@ func mockEndpoints() {
 	et.MockEndpoint(permissions.SetPermissions, func(ctx context.Context, req dto.UpdatePermissionsRequest) error {
 		return nil
 	})
+	et.MockEndpoint(permissions.ReplacePermissions, func(ctx context.Context, req dto.ReplacePermissionsRequest) error {
+		return nil
+	})
 	et.MockEndpoint(sAuth.VerifyCaptchaToken, func(ctx context.Context, req sAuth.VerifyCaptchaRequest) error {
 		return nil
 	})
@@ -46,6 +49,11 @@ func mockEndpoints() {
 			},
 		}, nil
 	})
+	et.MockEndpoint(permissions.FilterObjectsInternal, func(ctx context.Context, req dto.FilterObjectsRequest) (*dto.FilterObjectsResponse, error) {
+		return &dto.FilterObjectsResponse{
+			Allowed: req.Ids,
+		}, nil
+	})
 	et.MockEndpoint(tenants.FindTenant, func(ctx context.Context, id uint64) (*dto.TenantLookup, error) {
 		date := gofakeit.PastDate()
 		return &dto.TenantLookup{
@@ -165,3 +173,116 @@ func TestGetAcademicYears(t *testing.T) {
 		assert.NotEmpty(t, v.Terms)
 	}
 }
+
+func TestEditAcademicYear(t *testing.T) {
+	t.Cleanup(mockEndpoints)
+	et.MockEndpoint(permissions.PurgeObjectTuples, func(ctx context.Context, req dto.PurgeObjectTuplesRequest) (*dto.PurgeResponse, error) {
+		return &dto.PurgeResponse{Deleted: uint(len(req.Objects))}, nil
+	})
+
+	institution, err := makeInstitution()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	year, err := makeAcademicYear(institution.Id)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	// Terms are listed from the latest to the earliest
+	first, last := year.Terms[len(year.Terms)-1], year.Terms[0]
+
+	label := "First Term"
+	res, err := institutions.UpdateAcademicTerm(mainContext, institution.Id, year.Id, first.Id, dto.UpdateAcademicTermRequest{Label: &label})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.Equal(t, label, res.Terms[len(res.Terms)-1].Label)
+
+	overlapping := last.EndDate.Sub(first.StartDate)
+	_, err = institutions.UpdateAcademicTerm(mainContext, institution.Id, year.Id, first.Id, dto.UpdateAcademicTermRequest{Duration: &overlapping})
+	assert.NotNil(t, err, "the term would overlap the others")
+
+	res, err = institutions.CreateAcademicTerm(mainContext, institution.Id, year.Id, dto.NewAcademicTermRequest{
+		Label:     "Summer Term",
+		StartDate: last.EndDate.Add(time.Hour * 168),
+		Duration:  time.Hour * 720,
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.Len(t, res.Terms, len(year.Terms)+1)
+	assert.True(t, res.EndDate.After(year.EndDate))
+
+	res, err = institutions.DeleteAcademicTerm(mainContext, institution.Id, year.Id, res.Terms[0].Id)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.Len(t, res.Terms, len(year.Terms))
+
+	err = institutions.DeleteAcademicYear(mainContext, institution.Id, year.Id)
+	assert.Nil(t, err)
+}
+
+func TestFindAcademicContext(t *testing.T) {
+	institution, err := makeInstitution()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	year, err := makeAcademicYear(institution.Id)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	// Terms are listed from the latest to the earliest
+	first, second := year.Terms[len(year.Terms)-1], year.Terms[len(year.Terms)-2]
+
+	res, err := institutions.FindAcademicContext(mainContext, institution.Id, dto.FindAcademicContextRequest{Date: first.StartDate.Add(time.Hour * 24 * 8)})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if assert.NotNil(t, res.Term) {
+		assert.Equal(t, first.Id, res.Term.Id)
+	}
+	assert.Equal(t, 2, res.Week)
+	assert.False(t, res.Vacation)
+
+	res, err = institutions.FindAcademicContext(mainContext, institution.Id, dto.FindAcademicContextRequest{Date: first.EndDate.Add(time.Hour * 24)})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.Nil(t, res.Term)
+	assert.True(t, res.Vacation)
+	if assert.NotNil(t, res.NextTerm) {
+		assert.Equal(t, second.Id, res.NextTerm.Id)
+	}
+}
+
+func TestFindAcademicYearCreation(t *testing.T) {
+	institution, err := makeInstitution()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	res, err := institutions.FindAcademicYearCreation(mainContext, institution.Id, dto.CursorBasedPaginationParams{})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	assert.False(t, res.Enabled)
+	assert.Nil(t, res.NextRunAt)
+	assert.Empty(t, res.Runs)
+}
@@ -0,0 +1,731 @@
+package institutions
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"html"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"encore.dev/beta/auth"
+	"encore.dev/beta/errs"
+	"encore.dev/rlog"
+	"encore.dev/storage/sqldb"
+	"github.com/brinestone/scholaris/core/users"
+	"github.com/brinestone/scholaris/dto"
+	"github.com/brinestone/scholaris/helpers"
+	"github.com/brinestone/scholaris/models"
+	"github.com/brinestone/scholaris/settings"
+	"github.com/brinestone/scholaris/util"
+	"github.com/lib/pq"
+)
+
+// Records the attendance of the students of a class for a day or one of its periods in a single call. The guardians of
+// the students reaching an absence threshold of the institution are notified.
+//
+//encore:api auth method=PUT path=/institutions/:id/classes/:class/attendance tag:can_take_attendance tag:institution_writable
+func RecordClassAttendance(ctx context.Context, id, class uint64, req dto.RecordAttendanceRequest) (ans *dto.AttendanceSession, err error) {
+	uid, _ := auth.UserID()
+	takenBy, _ := strconv.ParseUint(string(uid), 10, 64)
+
+	// The thresholds are looked up before the transaction starts, and only when they may be reached
+	var thresholds []int
+	if slices.ContainsFunc(req.Records, func(r dto.AttendanceEntry) bool { return r.Status == dto.ASAbsent }) {
+		if thresholds, err = findAbsenceThresholds(ctx, id); err != nil {
+			rlog.Warn("could not find absence thresholds", "institution", id, "err", err)
+			thresholds, err = nil, nil
+		}
+	}
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err = findClass(ctx, tx, id, class); errors.Is(err, sqldb.ErrNoRows) {
+		err = &util.ErrNotFound
+		return
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if req.Course != nil {
+		if _, err = findCourse(ctx, tx, id, class, *req.Course); errors.Is(err, sqldb.ErrNoRows) {
+			err = &errs.Error{
+				Code:    errs.InvalidArgument,
+				Message: "The course is not taught in the class",
+			}
+			return
+		} else if err != nil {
+			rlog.Error(util.MsgDbAccessError, "err", err)
+			err = &util.ErrUnknown
+			return
+		}
+	}
+
+	date := req.Date.Format(time.DateOnly)
+	term, err := findClassTermByDate(ctx, tx, class, date)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		err = &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: "The date does not fall within a term of the class's academic year",
+		}
+		return
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	students := helpers.SliceMap(req.Records, func(r dto.AttendanceEntry) int64 { return int64(r.Student) })
+	placed, err := findPlacedStudents(ctx, tx, class, students)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	msgs := make([]string, 0)
+	for i, r := range req.Records {
+		if !placed[r.Student] {
+			msgs = append(msgs, fmt.Sprintf("The student of record %d is not in the class", i+1))
+		}
+	}
+
+	if len(msgs) > 0 {
+		err = &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: strings.Join(msgs, "\n"),
+		}
+		return
+	}
+
+	query := fmt.Sprintf(`
+		INSERT INTO attendance_sessions AS a(class, academic_term, date, period, course, taken_by)
+		VALUES ($1,$2,$3::DATE,$4,$5,$6)
+		ON CONFLICT (class, date, COALESCE(period, 0)) DO UPDATE SET
+			course = EXCLUDED.course,
+			taken_by = EXCLUDED.taken_by,
+			updated_at = CURRENT_TIMESTAMP
+		RETURNING %s;
+	`, attendanceSessionFields)
+	session, err := scanAttendanceSession(tx.QueryRow(ctx, query, class, term, date, req.Period, req.Course, takenBy))
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	for _, r := range req.Records {
+		var note *string
+		if r.Note != nil && len(strings.TrimSpace(*r.Note)) > 0 {
+			v := strings.TrimSpace(*r.Note)
+			note = &v
+		}
+
+		if _, err = tx.Exec(ctx, `
+			INSERT INTO attendance_records(session, student, status, note, recorded_by)
+			VALUES ($1,$2,$3,$4,$5)
+			ON CONFLICT (session, student) DO UPDATE SET
+				status = EXCLUDED.status,
+				note = EXCLUDED.note,
+				recorded_by = EXCLUDED.recorded_by,
+				recorded_at = CURRENT_TIMESTAMP;
+		`, session.Id, r.Student, r.Status, note, takenBy); err != nil {
+			rlog.Error(util.MsgDbAccessError, "err", err)
+			err = &util.ErrUnknown
+			return
+		}
+	}
+
+	absentees := make([]int64, 0)
+	for _, r := range req.Records {
+		if r.Status == dto.ASAbsent {
+			absentees = append(absentees, int64(r.Student))
+		}
+	}
+
+	var alerts []*absenceAlert
+	if len(thresholds) > 0 && len(absentees) > 0 {
+		if alerts, err = raiseAbsenceAlerts(ctx, tx, term, absentees, thresholds); err != nil {
+			rlog.Error(util.MsgDbAccessError, "err", err)
+			err = &util.ErrUnknown
+			return
+		}
+	}
+
+	records, err := queryAttendanceRecords(ctx, tx, session.Id)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	// The attendance is recorded even when the guardians cannot be notified
+	for _, a := range alerts {
+		if _, err := ReachedAbsenceThresholds.Publish(ctx, &AbsenceThresholdReached{
+			Alert:       a.id,
+			Institution: id,
+			Student:     a.student,
+			Timestamp:   time.Now(),
+		}); err != nil {
+			rlog.Error("could not request absence notification", "alert", a.id, "err", err)
+		}
+	}
+
+	ans = attendanceSessionToDto(session, records)
+	return
+}
+
+// Lists the attendance taken in a class on a day
+//
+//encore:api auth method=GET path=/institutions/:id/classes/:class/attendance tag:can_take_attendance
+func FindClassAttendance(ctx context.Context, id, class uint64, req dto.FindClassAttendanceRequest) (ans *dto.ClassAttendanceResponse, err error) {
+	date := req.Date
+	if date.IsZero() {
+		date = time.Now()
+	}
+
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM
+			attendance_sessions a
+			JOIN classes c ON c.id = a.class
+		WHERE
+			a.class = $1 AND c.institution = $2 AND a.date = $3::DATE
+		ORDER BY
+			a.period NULLS FIRST;
+	`, attendanceSessionFields)
+	rows, err := db.Query(ctx, query, class, id, date.Format(time.DateOnly))
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+	defer rows.Close()
+
+	sessions := make([]*models.AttendanceSession, 0)
+	for rows.Next() {
+		var s *models.AttendanceSession
+		if s, err = scanAttendanceSession(rows); err != nil {
+			rlog.Error(util.MsgDbAccessError, "err", err)
+			err = &util.ErrUnknown
+			return
+		}
+		sessions = append(sessions, s)
+	}
+	if err = rows.Err(); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = &dto.ClassAttendanceResponse{
+		Sessions: make([]dto.AttendanceSession, 0, len(sessions)),
+	}
+	for _, s := range sessions {
+		var records []*models.AttendanceRecord
+		if records, err = queryAttendanceRecords(ctx, nil, s.Id); err != nil {
+			rlog.Error(util.MsgDbAccessError, "err", err)
+			ans, err = nil, &util.ErrUnknown
+			return
+		}
+		ans.Sessions = append(ans.Sessions, *attendanceSessionToDto(s, records))
+	}
+	return
+}
+
+// Sums up the attendance of the students of a class over a term
+//
+//encore:api auth method=GET path=/institutions/:id/classes/:class/attendance/summaries tag:can_take_attendance
+func FindClassAttendanceSummaries(ctx context.Context, id, class uint64, req dto.FindTermAttendanceRequest) (ans *dto.AttendanceSummariesResponse, err error) {
+	if _, err = findClass(ctx, nil, id, class); errors.Is(err, sqldb.ErrNoRows) {
+		err = &util.ErrNotFound
+		return
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	summaries, err := findAttendanceSummaries(ctx, nil, req.AcademicTerm, class, nil)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = &dto.AttendanceSummariesResponse{
+		Summaries: summaries,
+	}
+	return
+}
+
+// Lists the attendance records of a student over a term along with their summary. Students and their guardians can
+// view their own records.
+//
+//encore:api auth method=GET path=/institutions/:id/students/:student/attendance tag:can_view_student
+func FindStudentAttendance(ctx context.Context, id, student uint64, req dto.FindTermAttendanceRequest) (ans *dto.StudentAttendanceResponse, err error) {
+	if _, err = findStudent(ctx, nil, id, student); errors.Is(err, sqldb.ErrNoRows) {
+		err = &util.ErrNotFound
+		return
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	rows, err := db.Query(ctx, `
+		SELECT
+			a.id, a.class, a.date, a.period, a.course, r.status, r.note, r.recorded_by, r.recorded_at
+		FROM
+			attendance_records r
+			JOIN attendance_sessions a ON a.id = r.session
+		WHERE
+			r.student = $1 AND a.academic_term = $2
+		ORDER BY
+			a.date DESC, a.period NULLS FIRST;
+	`, student, req.AcademicTerm)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+	defer rows.Close()
+
+	ans = &dto.StudentAttendanceResponse{
+		Summary: dto.AttendanceSummary{Student: student, AcademicTerm: req.AcademicTerm},
+		Records: make([]dto.StudentAttendance, 0),
+	}
+	for rows.Next() {
+		s, r := new(models.AttendanceSession), new(models.AttendanceRecord)
+		if err = rows.Scan(&s.Id, &s.Class, &s.Date, &s.Period, &s.Course, &r.Status, &r.Note, &r.RecordedBy, &r.RecordedAt); err != nil {
+			rlog.Error(util.MsgDbAccessError, "err", err)
+			ans, err = nil, &util.ErrUnknown
+			return
+		}
+
+		v := dto.StudentAttendance{
+			Session:    s.Id,
+			Class:      s.Class,
+			Date:       s.Date,
+			Status:     dto.AttendanceStatus(r.Status),
+			RecordedBy: r.RecordedBy,
+			RecordedAt: r.RecordedAt,
+		}
+		if s.Period.Valid {
+			period := int(s.Period.Int32)
+			v.Period = &period
+		}
+		if s.Course.Valid {
+			course := uint64(s.Course.Int64)
+			v.Course = &course
+		}
+		if r.Note.Valid {
+			v.Note = &r.Note.String
+		}
+		ans.Records = append(ans.Records, v)
+	}
+	if err = rows.Err(); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		ans, err = nil, &util.ErrUnknown
+		return
+	}
+
+	summaries, err := findAttendanceSummaries(ctx, nil, req.AcademicTerm, 0, []int64{int64(student)})
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		ans, err = nil, &util.ErrUnknown
+		return
+	}
+	if len(summaries) > 0 {
+		ans.Summary = summaries[0]
+	}
+	return
+}
+
+// Private section
+
+// An absence threshold reached by a student
+type absenceAlert struct {
+	id      uint64
+	student uint64
+}
+
+// Emails the guardians of a student who reached an absence threshold. Alerts which were already notified are left
+// alone.
+func notifyGuardiansOfAbsences(ctx context.Context, msg *AbsenceThresholdReached) error {
+	var term string
+	var threshold, absences int
+	var notifiedAt sql.NullTime
+	err := db.QueryRow(ctx, `
+		SELECT
+			t.label, a.threshold, a.absences, a.notified_at
+		FROM
+			attendance_alerts a
+			JOIN academic_terms t ON t.id = a.academic_term
+		WHERE
+			a.id = $1;
+	`, msg.Alert).Scan(&term, &threshold, &absences, &notifiedAt)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		// The student or the term was deleted in the meantime
+		return nil
+	} else if err != nil {
+		return err
+	} else if notifiedAt.Valid {
+		return nil
+	}
+
+	institution, err := findInstitutionByIdFromDb(ctx, msg.Institution)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	student, err := findStudent(ctx, nil, msg.Institution, msg.Student)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM student_guardians g WHERE g.student = $1 ORDER BY g.is_primary DESC, g.id;", guardianFields)
+	guardians, err := queryGuardians(ctx, query, student.Id)
+	if err != nil {
+		return err
+	}
+
+	// Guardians sharing an email address get a single email
+	recipients := make(map[string]uint64, len(guardians))
+	var order []string
+	for _, g := range guardians {
+		email := g.Email.String
+		if len(email) == 0 && g.Account.Valid {
+			user, err := users.FindUserById(ctx, uint64(g.Account.Int64))
+			if err != nil {
+				rlog.Warn("could not find guardian account to notify", "guardian", g.Id, "err", err)
+				continue
+			}
+			email, _ = primaryEmailOf(user)
+		}
+		if _, ok := recipients[email]; len(email) > 0 && !ok {
+			recipients[email] = g.Id
+			order = append(order, email)
+		}
+	}
+
+	name := strings.TrimSpace(student.FirstName + " " + student.LastName)
+	subject := fmt.Sprintf("%s has been absent %d days this term", name, absences)
+	body := fmt.Sprintf(
+		"<p><strong>%s</strong> has been absent from <strong>%s</strong> without an excuse on %d days during %s.</p><p>Please get in touch with the institution about these absences.</p>",
+		html.EscapeString(name), html.EscapeString(institution.Name), absences, html.EscapeString(term),
+	)
+
+	// Deliveries are recorded per guardian so that a retry only emails those who were missed
+	notification := fmt.Sprintf("absence-alert:%d", msg.Alert)
+	var failed []error
+	for _, to := range order {
+		if err = sendNotificationEmail(ctx, notification, recipients[to], dto.SendEmailRequest{
+			To:            to,
+			Subject:       subject,
+			Body:          body,
+			IsContentHtml: true,
+		}); err != nil {
+			rlog.Error("could not notify guardian", "alert", msg.Alert, "guardian", recipients[to], "err", err)
+			failed = append(failed, err)
+		}
+	}
+	if len(failed) > 0 {
+		return errors.Join(failed...)
+	}
+
+	// The lower thresholds reached along with this one are covered by its notification
+	_, err = db.Exec(ctx, `
+		UPDATE attendance_alerts a SET
+			notified_at = CURRENT_TIMESTAMP
+		FROM
+			attendance_alerts n
+		WHERE
+			n.id = $1 AND a.student = n.student AND a.academic_term = n.academic_term AND a.threshold <= n.threshold
+			AND a.notified_at IS NULL;
+	`, msg.Alert)
+	return err
+}
+
+// How long alerts are left to their notification message before being swept
+const absenceAlertGracePeriod = 15 * time.Minute
+
+const absenceAlertSweepBatchSize = 100
+
+// Notifies the guardians of the alerts whose notification was never requested or did not go through. Only the
+// highest threshold reached by each student in a term is notified.
+//
+//encore:api private method=POST path=/institutions/attendance-alerts/notify
+func NotifyPendingAbsenceAlerts(ctx context.Context) error {
+	rows, err := db.Query(ctx, `
+		SELECT
+			a.id, s.institution, a.student
+		FROM
+			attendance_alerts a
+			JOIN students s ON s.id = a.student
+		WHERE
+			a.notified_at IS NULL
+			AND a.created_at < CURRENT_TIMESTAMP - $1 * INTERVAL '1 second'
+			AND NOT EXISTS (
+				SELECT 1 FROM attendance_alerts h
+				WHERE h.student = a.student AND h.academic_term = a.academic_term AND h.threshold > a.threshold
+			)
+		ORDER BY a.id
+		LIMIT $2;
+	`, absenceAlertGracePeriod.Seconds(), absenceAlertSweepBatchSize)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return err
+	}
+	defer rows.Close()
+
+	var alerts []*AbsenceThresholdReached
+	for rows.Next() {
+		alert := &AbsenceThresholdReached{Timestamp: time.Now()}
+		if err = rows.Scan(&alert.Alert, &alert.Institution, &alert.Student); err != nil {
+			rlog.Error(util.MsgDbAccessError, "err", err)
+			return err
+		}
+		alerts = append(alerts, alert)
+	}
+	if err = rows.Err(); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return err
+	}
+	rows.Close()
+
+	for _, alert := range alerts {
+		if err := notifyGuardiansOfAbsences(ctx, alert); err != nil {
+			rlog.Error("could not notify absence alert", "alert", alert.Alert, "err", err)
+		}
+	}
+	return nil
+}
+
+// Reads the absence notification thresholds of an institution, in ascending order. Institutions created before the
+// setting existed use its default thresholds.
+func findAbsenceThresholds(ctx context.Context, institution uint64) ([]int, error) {
+	res, err := settings.FindSettingsInternal(ctx, dto.GetSettingsInternalRequest{
+		Owner:     institution,
+		OwnerType: string(dto.PTInstitution),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var values []string
+	setting, defined := res.Settings[dto.SKAbsenceNotificationThresholds]
+	if defined {
+		for _, v := range setting.Values {
+			if v.Value != nil {
+				values = append(values, *v.Value)
+			}
+		}
+	} else if values, err = defaultSettingValue(dto.SKAbsenceNotificationThresholds); err != nil {
+		return nil, err
+	}
+
+	ans := make([]int, 0, len(values))
+	for _, v := range values {
+		if threshold, err := strconv.Atoi(strings.TrimSpace(v)); err == nil && threshold > 0 && !slices.Contains(ans, threshold) {
+			ans = append(ans, threshold)
+		}
+	}
+	slices.Sort(ans)
+	return ans, nil
+}
+
+// Records the absence thresholds the students reached in a term. Only the highest threshold newly reached by each
+// student is returned, so that their guardians are notified once.
+func raiseAbsenceAlerts(ctx context.Context, tx *sqldb.Tx, term uint64, students []int64, thresholds []int) (ans []*absenceAlert, err error) {
+	summaries, err := findAttendanceSummaries(ctx, tx, term, 0, students)
+	if err != nil {
+		return
+	}
+
+	for _, s := range summaries {
+		var alert *absenceAlert
+		for _, threshold := range thresholds {
+			if int(s.DaysAbsent) < threshold {
+				break
+			}
+
+			var id uint64
+			err = tx.QueryRow(ctx, `
+				INSERT INTO attendance_alerts(student, academic_term, threshold, absences)
+				VALUES ($1,$2,$3,$4)
+				ON CONFLICT (student, academic_term, threshold) DO NOTHING
+				RETURNING id;
+			`, s.Student, term, threshold, s.DaysAbsent).Scan(&id)
+			if errors.Is(err, sqldb.ErrNoRows) {
+				err = nil
+				continue
+			} else if err != nil {
+				return
+			}
+			alert = &absenceAlert{id: id, student: s.Student}
+		}
+		if alert != nil {
+			ans = append(ans, alert)
+		}
+	}
+	return
+}
+
+// Finds the term of a class's academic year a date falls in, within the transaction when one is given
+func findClassTermByDate(ctx context.Context, tx *sqldb.Tx, class uint64, date string) (ans uint64, err error) {
+	query := `
+		SELECT
+			t.id
+		FROM
+			vw_AllAcademicTerms t
+			JOIN classes c ON c.academic_year = t.year_id
+		WHERE
+			c.id = $1 AND $2::DATE BETWEEN t.start_date::DATE AND t.end_date::DATE
+		ORDER BY
+			t.start_date DESC
+		LIMIT 1;
+	`
+	if tx != nil {
+		err = tx.QueryRow(ctx, query, class, date).Scan(&ans)
+	} else {
+		err = db.QueryRow(ctx, query, class, date).Scan(&ans)
+	}
+	return
+}
+
+// Sums up the attendance of students over a term, in a single class unless class is 0 and for the given students
+// only unless students is nil. Students without records are left out.
+func findAttendanceSummaries(ctx context.Context, tx *sqldb.Tx, term, class uint64, students []int64) (ans []dto.AttendanceSummary, err error) {
+	query := `
+		SELECT
+			r.student,
+			COUNT(*) FILTER (WHERE r.status = 'present'),
+			COUNT(*) FILTER (WHERE r.status = 'absent'),
+			COUNT(*) FILTER (WHERE r.status = 'late'),
+			COUNT(*) FILTER (WHERE r.status = 'excused'),
+			COUNT(DISTINCT a.date) FILTER (WHERE r.status = 'absent')
+		FROM
+			attendance_records r
+			JOIN attendance_sessions a ON a.id = r.session
+		WHERE
+			a.academic_term = $1 AND ($2 = 0 OR a.class = $2) AND ($3::BIGINT[] IS NULL OR r.student = ANY($3))
+		GROUP BY
+			r.student
+		ORDER BY
+			r.student;
+	`
+
+	var rows *sqldb.Rows
+	if tx != nil {
+		rows, err = tx.Query(ctx, query, term, class, pq.Array(students))
+	} else {
+		rows, err = db.Query(ctx, query, term, class, pq.Array(students))
+	}
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	ans = make([]dto.AttendanceSummary, 0)
+	for rows.Next() {
+		s := dto.AttendanceSummary{AcademicTerm: term}
+		if err = rows.Scan(&s.Student, &s.Present, &s.Absent, &s.Late, &s.Excused, &s.DaysAbsent); err != nil {
+			return
+		}
+		ans = append(ans, s)
+	}
+	err = rows.Err()
+	return
+}
+
+const attendanceSessionFields = "a.id,a.class,a.academic_term,a.date,a.period,a.course,a.taken_by,a.created_at,a.updated_at"
+
+func scanAttendanceSession(row rowScanner) (*models.AttendanceSession, error) {
+	s := new(models.AttendanceSession)
+	if err := row.Scan(&s.Id, &s.Class, &s.AcademicTerm, &s.Date, &s.Period, &s.Course, &s.TakenBy, &s.CreatedAt, &s.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Lists the records of an attendance session, within the transaction when one is given
+func queryAttendanceRecords(ctx context.Context, tx *sqldb.Tx, session uint64) (ans []*models.AttendanceRecord, err error) {
+	query := "SELECT r.session,r.student,r.status,r.note,r.recorded_by,r.recorded_at FROM attendance_records r WHERE r.session = $1 ORDER BY r.student;"
+
+	var rows *sqldb.Rows
+	if tx != nil {
+		rows, err = tx.Query(ctx, query, session)
+	} else {
+		rows, err = db.Query(ctx, query, session)
+	}
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		r := new(models.AttendanceRecord)
+		if err = rows.Scan(&r.Session, &r.Student, &r.Status, &r.Note, &r.RecordedBy, &r.RecordedAt); err != nil {
+			return
+		}
+		ans = append(ans, r)
+	}
+	err = rows.Err()
+	return
+}
+
+func attendanceSessionToDto(s *models.AttendanceSession, records []*models.AttendanceRecord) *dto.AttendanceSession {
+	ans := &dto.AttendanceSession{
+		Id:           s.Id,
+		Class:        s.Class,
+		AcademicTerm: s.AcademicTerm,
+		Date:         s.Date,
+		TakenBy:      s.TakenBy,
+		Records:      make([]dto.AttendanceRecord, 0, len(records)),
+		CreatedAt:    s.CreatedAt,
+		UpdatedAt:    s.UpdatedAt,
+	}
+	if s.Period.Valid {
+		period := int(s.Period.Int32)
+		ans.Period = &period
+	}
+	if s.Course.Valid {
+		course := uint64(s.Course.Int64)
+		ans.Course = &course
+	}
+	for _, r := range records {
+		v := dto.AttendanceRecord{
+			Student:    r.Student,
+			Status:     dto.AttendanceStatus(r.Status),
+			RecordedBy: r.RecordedBy,
+			RecordedAt: r.RecordedAt,
+		}
+		if r.Note.Valid {
+			v.Note = &r.Note.String
+		}
+		ans.Records = append(ans.Records, v)
+	}
+	return ans
+}
@@ -0,0 +1,260 @@
+package institutions_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"encore.dev/et"
+	"github.com/brinestone/scholaris/core/notifier"
+	"github.com/brinestone/scholaris/core/users"
+	"github.com/brinestone/scholaris/dto"
+	"github.com/brinestone/scholaris/institutions"
+	"github.com/brinestone/scholaris/models"
+	"github.com/brinestone/scholaris/settings"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAttendance(t *testing.T) {
+	et.MockEndpoint(users.FindUserById, func(ctx context.Context, id uint64) (*models.User, error) {
+		return &models.User{Id: id}, nil
+	})
+	et.MockEndpoint(settings.FindSettingsInternal, func(ctx context.Context, req dto.GetSettingsInternalRequest) (*dto.GetSettingsResponse, error) {
+		threshold := "1"
+		return &dto.GetSettingsResponse{
+			Settings: map[string]dto.Setting{
+				dto.SKAbsenceNotificationThresholds: {
+					Key:    dto.SKAbsenceNotificationThresholds,
+					Values: []dto.SettingValue{{Value: &threshold}},
+				},
+			},
+		}, nil
+	})
+
+	i, err := makeInstitution()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	year, err := makeAcademicYear(i.Id)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	term := year.Terms[0]
+	date := term.StartDate.AddDate(0, 0, 1)
+
+	level, err := institutions.CreateLevel(mainContext, i.Id, dto.NewLevelRequest{Name: "Form 3"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	class, err := institutions.CreateClass(mainContext, i.Id, dto.NewClassRequest{Level: level.Id, AcademicYear: year.Id, Name: "C"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	student, err := institutions.CreateStudent(mainContext, i.Id, dto.NewStudentRequest{FirstName: "Jane", LastName: "Doe"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	outsider, err := institutions.CreateStudent(mainContext, i.Id, dto.NewStudentRequest{FirstName: "John", LastName: "Doe"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if _, err = institutions.LinkStudentAccount(mainContext, i.Id, student.Id, dto.StudentAccountRequest{User: 4}); err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err = institutions.PlaceStudent(mainContext, i.Id, class.Id, dto.PlaceStudentRequest{Student: student.Id}); err != nil {
+		t.Error(err)
+		return
+	}
+
+	assert.NotNil(t, dto.RecordAttendanceRequest{Date: date, Records: []dto.AttendanceEntry{{Student: student.Id, Status: "sick"}}}.Validate(), "unknown statuses are rejected")
+
+	_, err = institutions.RecordClassAttendance(mainContext, i.Id, class.Id, dto.RecordAttendanceRequest{
+		Date:    date,
+		Records: []dto.AttendanceEntry{{Student: outsider.Id, Status: dto.ASPresent}},
+	})
+	assert.NotNil(t, err, "the student is not in the class")
+
+	_, err = institutions.RecordClassAttendance(mainContext, i.Id, class.Id, dto.RecordAttendanceRequest{
+		Date:    year.EndDate.AddDate(1, 0, 0),
+		Records: []dto.AttendanceEntry{{Student: student.Id, Status: dto.ASPresent}},
+	})
+	assert.NotNil(t, err, "the date is outside of the academic year")
+
+	session, err := institutions.RecordClassAttendance(mainContext, i.Id, class.Id, dto.RecordAttendanceRequest{
+		Date:    date,
+		Records: []dto.AttendanceEntry{{Student: student.Id, Status: dto.ASAbsent}},
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.Equal(t, term.Id, session.AcademicTerm)
+	assert.Nil(t, session.Period)
+	assert.Len(t, session.Records, 1)
+	assert.Len(t, et.Topic(institutions.ReachedAbsenceThresholds).PublishedMessages(), 1, "the guardians are notified once the threshold is reached")
+
+	period := 2
+	if _, err = institutions.RecordClassAttendance(mainContext, i.Id, class.Id, dto.RecordAttendanceRequest{
+		Date:    date,
+		Period:  &period,
+		Records: []dto.AttendanceEntry{{Student: student.Id, Status: dto.ASAbsent}},
+	}); err != nil {
+		t.Error(err)
+		return
+	}
+	assert.Len(t, et.Topic(institutions.ReachedAbsenceThresholds).PublishedMessages(), 1, "a threshold is only notified once")
+
+	summaries, err := institutions.FindClassAttendanceSummaries(mainContext, i.Id, class.Id, dto.FindTermAttendanceRequest{AcademicTerm: term.Id})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.Len(t, summaries.Summaries, 1)
+	assert.Equal(t, uint(2), summaries.Summaries[0].Absent)
+	assert.Equal(t, uint(1), summaries.Summaries[0].DaysAbsent, "absences on the same day count as one day")
+
+	session, err = institutions.RecordClassAttendance(mainContext, i.Id, class.Id, dto.RecordAttendanceRequest{
+		Date:    date,
+		Records: []dto.AttendanceEntry{{Student: student.Id, Status: dto.ASExcused}},
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.Equal(t, dto.ASExcused, session.Records[0].Status, "recording a day again updates its records")
+
+	day, err := institutions.FindClassAttendance(mainContext, i.Id, class.Id, dto.FindClassAttendanceRequest{Date: date})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.Len(t, day.Sessions, 2)
+
+	own, err := institutions.FindStudentAttendance(mainContext, i.Id, student.Id, dto.FindTermAttendanceRequest{AcademicTerm: term.Id})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.Len(t, own.Records, 2)
+	assert.Equal(t, uint(1), own.Summary.Excused)
+	assert.Equal(t, uint(1), own.Summary.Absent)
+}
+
+func TestFindAbsenceThresholdsDefaults(t *testing.T) {
+	t.Cleanup(mockEndpoints)
+	et.MockEndpoint(settings.FindSettingsInternal, func(ctx context.Context, req dto.GetSettingsInternalRequest) (*dto.GetSettingsResponse, error) {
+		return &dto.GetSettingsResponse{Settings: map[string]dto.Setting{}}, nil
+	})
+
+	thresholds, err := institutions.FindAbsenceThresholds(context.TODO(), 1)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.Equal(t, []int{3, 5, 10}, thresholds, "institutions without the setting use its defaults")
+}
+
+func TestNotifyPendingAbsenceAlerts(t *testing.T) {
+	t.Cleanup(mockEndpoints)
+	et.MockEndpoint(users.FindUserById, func(ctx context.Context, id uint64) (*models.User, error) {
+		return &models.User{Id: id}, nil
+	})
+	et.MockEndpoint(settings.FindSettingsInternal, func(ctx context.Context, req dto.GetSettingsInternalRequest) (*dto.GetSettingsResponse, error) {
+		threshold := "1"
+		return &dto.GetSettingsResponse{
+			Settings: map[string]dto.Setting{
+				dto.SKAbsenceNotificationThresholds: {
+					Key:    dto.SKAbsenceNotificationThresholds,
+					Values: []dto.SettingValue{{Value: &threshold}},
+				},
+			},
+		}, nil
+	})
+
+	mother, father := randomString(6)+"@example.com", randomString(6)+"@example.com"
+	failing := father
+	sent := make(map[string]int)
+	et.MockEndpoint(notifier.SendEmail, func(ctx context.Context, req dto.SendEmailRequest) error {
+		if req.To == failing {
+			return errors.New("mailbox unavailable")
+		}
+		sent[req.To]++
+		return nil
+	})
+
+	i, err := makeInstitution()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	year, err := makeAcademicYear(i.Id)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	level, err := institutions.CreateLevel(mainContext, i.Id, dto.NewLevelRequest{Name: "Form 1"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	class, err := institutions.CreateClass(mainContext, i.Id, dto.NewClassRequest{Level: level.Id, AcademicYear: year.Id, Name: "A"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	student, err := institutions.CreateStudent(mainContext, i.Id, dto.NewStudentRequest{FirstName: "Jane", LastName: "Doe"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err = institutions.LinkStudentAccount(mainContext, i.Id, student.Id, dto.StudentAccountRequest{User: 5}); err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err = institutions.PlaceStudent(mainContext, i.Id, class.Id, dto.PlaceStudentRequest{Student: student.Id}); err != nil {
+		t.Error(err)
+		return
+	}
+	for name, email := range map[string]string{"Mary Doe": mother, "Paul Doe": father} {
+		if _, err = institutions.AddStudentGuardian(mainContext, i.Id, student.Id, dto.NewStudentGuardianRequest{Name: name, Relationship: dto.GRMother, Email: &email}); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	if _, err = institutions.RecordClassAttendance(mainContext, i.Id, class.Id, dto.RecordAttendanceRequest{
+		Date:    year.Terms[0].StartDate.AddDate(0, 0, 1),
+		Records: []dto.AttendanceEntry{{Student: student.Id, Status: dto.ASAbsent}},
+	}); err != nil {
+		t.Error(err)
+		return
+	}
+	if err = institutions.AgeAbsenceAlerts(context.TODO(), student.Id, time.Hour); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// Each sweep only emails the guardians who were missed, until the alert is notified
+	for range 3 {
+		if err = institutions.NotifyPendingAbsenceAlerts(context.TODO()); err != nil {
+			t.Error(err)
+			return
+		}
+		failing = ""
+	}
+	assert.Equal(t, 1, sent[mother])
+	assert.Equal(t, 1, sent[father])
+}
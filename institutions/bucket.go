@@ -0,0 +1,12 @@
+package institutions
+
+import (
+	"encore.dev/storage/objects"
+	"github.com/brinestone/scholaris/blob"
+)
+
+// Logos uploaded to the blob service are read from its bucket to brand generated documents
+var uploads = objects.BucketRef[objects.Downloader](blob.UploadsBucket)
+
+// Exported institution records are staged in the uploads bucket, where the export archive is assembled
+var exportBucket = objects.BucketRef[objects.Uploader](blob.UploadsBucket)
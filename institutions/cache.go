@@ -17,3 +17,9 @@ var institutionCache = cache.NewStructKeyspace[string, dto.Institution](pkg.Cach
 //// 	KeyPattern:    "enrollments/:key",
 //// 	DefaultExpiry: cache.ExpireIn(20 * time.Minute),
 //// })
+
+// The academic years of institutions along with their terms
+var academicYearsCache = cache.NewStructKeyspace[uint64, dto.GetAcademicYearsResponse](pkg.CacheCluster, cache.KeyspaceConfig{
+	KeyPattern:    "academic-years/:key",
+	DefaultExpiry: cache.ExpireIn(1 * time.Hour),
+})
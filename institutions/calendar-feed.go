@@ -0,0 +1,326 @@
+package institutions
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"encore.dev"
+	"encore.dev/beta/auth"
+	"encore.dev/beta/errs"
+	"encore.dev/rlog"
+	"github.com/brinestone/scholaris/core/permissions"
+	"github.com/brinestone/scholaris/dto"
+	"github.com/brinestone/scholaris/helpers"
+	"github.com/brinestone/scholaris/models"
+	"github.com/brinestone/scholaris/util"
+)
+
+var secrets struct {
+	TokenSigningKey string `encore:"sensitive"`
+	FrontendUrl     string
+}
+
+type calendarFeedKind string
+
+const (
+	calendarFeedInstitution calendarFeedKind = "institution"
+	calendarFeedUser        calendarFeedKind = "user"
+)
+
+// How far back past events are kept in feeds
+const calendarFeedHistory = 90 * 24 * time.Hour
+
+// Returns the signed iCalendar feed URL of an institution. The feed holds the events meant for all of its members.
+//
+//encore:api auth method=GET path=/institutions/:id/calendar/feed tag:institution_member
+func FindInstitutionCalendarFeed(ctx context.Context, id uint64) (*dto.CalendarFeed, error) {
+	return calendarFeed(ctx, calendarFeedInstitution, id)
+}
+
+// Invalidates the URL of an institution's iCalendar feed and returns a new one
+//
+//encore:api auth method=POST path=/institutions/:id/calendar/feed/rotate tag:can_update_institution
+func RotateInstitutionCalendarFeed(ctx context.Context, id uint64) (*dto.CalendarFeed, error) {
+	return rotateCalendarFeed(ctx, calendarFeedInstitution, id)
+}
+
+// Returns the signed iCalendar feed URL of the current user. The feed holds the events meant for the user in every
+// institution they are a member of.
+//
+//encore:api auth method=GET path=/calendar/feed
+func FindUserCalendarFeed(ctx context.Context) (*dto.CalendarFeed, error) {
+	uid, _ := auth.UserID()
+	id, _ := strconv.ParseUint(string(uid), 10, 64)
+	return calendarFeed(ctx, calendarFeedUser, id)
+}
+
+// Invalidates the URL of the current user's iCalendar feed and returns a new one
+//
+//encore:api auth method=POST path=/calendar/feed/rotate
+func RotateUserCalendarFeed(ctx context.Context) (*dto.CalendarFeed, error) {
+	uid, _ := auth.UserID()
+	id, _ := strconv.ParseUint(string(uid), 10, 64)
+	return rotateCalendarFeed(ctx, calendarFeedUser, id)
+}
+
+// Serves an iCalendar feed to calendar clients. The signature in the URL stands in for authentication.
+//
+//encore:api raw public method=GET path=/calendar-feeds/:kind/:owner/:signature
+func ServeCalendarFeed(w http.ResponseWriter, req *http.Request) {
+	params := encore.CurrentRequest().PathParams
+	kind := calendarFeedKind(params.Get("kind"))
+	owner, err := strconv.ParseUint(params.Get("owner"), 10, 64)
+	if err != nil || (kind != calendarFeedInstitution && kind != calendarFeedUser) {
+		errs.HTTPError(w, &util.ErrNotFound)
+		return
+	}
+
+	version, err := findCalendarFeedVersion(req.Context(), kind, owner)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		errs.HTTPError(w, &util.ErrUnknown)
+		return
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(strings.TrimSuffix(params.Get("signature"), ".ics"))
+	if err != nil || !hmac.Equal(signature, calendarFeedSignature(kind, owner, version)) {
+		errs.HTTPError(w, &util.ErrNotFound)
+		return
+	}
+
+	var name string
+	var events []*models.CalendarEvent
+	if kind == calendarFeedInstitution {
+		name, events, err = institutionFeedEvents(req.Context(), owner)
+	} else {
+		name, events, err = userFeedEvents(req.Context(), owner)
+	}
+	if err != nil {
+		rlog.Error("could not build calendar feed", "kind", kind, "owner", owner, "err", err)
+		errs.HTTPError(w, &util.ErrUnknown)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="%s-%d.ics"`, kind, owner))
+	writeICS(w, name, events)
+}
+
+// Private section
+
+func calendarFeed(ctx context.Context, kind calendarFeedKind, owner uint64) (*dto.CalendarFeed, error) {
+	version, err := findCalendarFeedVersion(ctx, kind, owner)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return nil, &util.ErrUnknown
+	}
+	return &dto.CalendarFeed{Url: calendarFeedUrl(kind, owner, version)}, nil
+}
+
+func rotateCalendarFeed(ctx context.Context, kind calendarFeedKind, owner uint64) (*dto.CalendarFeed, error) {
+	var version int
+	if err := db.QueryRow(ctx, `
+		INSERT INTO calendar_feeds(owner_type, owner, version)
+		VALUES ($1,$2,2)
+		ON CONFLICT (owner_type, owner) DO UPDATE SET
+			version = calendar_feeds.version + 1,
+			rotated_at = CURRENT_TIMESTAMP
+		RETURNING version;
+	`, kind, owner).Scan(&version); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return nil, &util.ErrUnknown
+	}
+	return &dto.CalendarFeed{Url: calendarFeedUrl(kind, owner, version)}, nil
+}
+
+// Feeds which were never rotated are at their first version
+func findCalendarFeedVersion(ctx context.Context, kind calendarFeedKind, owner uint64) (version int, err error) {
+	err = db.QueryRow(ctx, "SELECT COALESCE((SELECT version FROM calendar_feeds WHERE owner_type = $1 AND owner = $2), 1);", kind, owner).Scan(&version)
+	return
+}
+
+func calendarFeedUrl(kind calendarFeedKind, owner uint64, version int) string {
+	signature := base64.RawURLEncoding.EncodeToString(calendarFeedSignature(kind, owner, version))
+	return encore.Meta().APIBaseURL.JoinPath("calendar-feeds", string(kind), strconv.FormatUint(owner, 10), signature+".ics").String()
+}
+
+func calendarFeedSignature(kind calendarFeedKind, owner uint64, version int) []byte {
+	return helpers.Sign(secrets.TokenSigningKey, fmt.Sprintf("calendar-feed:%s:%d:%d", kind, owner, version))
+}
+
+func institutionFeedEvents(ctx context.Context, institution uint64) (name string, events []*models.CalendarEvent, err error) {
+	i, err := findInstitutionByIdFromDb(ctx, institution)
+	if err != nil {
+		return
+	}
+
+	name = i.Name
+	events, err = findFeedEvents(ctx, institution, &calendarViewer{member: true})
+	return
+}
+
+func userFeedEvents(ctx context.Context, user uint64) (name string, events []*models.CalendarEvent, err error) {
+	name = "Scholaris"
+	res, err := permissions.ListObjectsInternal(ctx, dto.ListObjectsRequest{
+		Actor:    dto.IdentifierString(dto.PTUser, user),
+		Relation: dto.PNMember,
+		Type:     string(dto.PTInstitution),
+	})
+	if err != nil {
+		return
+	}
+
+	uid := auth.UID(strconv.FormatUint(user, 10))
+	for _, institution := range res.Relations[dto.PTInstitution] {
+		var viewer *calendarViewer
+		if viewer, err = findCalendarViewer(ctx, institution, uid, true); err != nil {
+			return
+		}
+
+		var found []*models.CalendarEvent
+		if found, err = findFeedEvents(ctx, institution, viewer); err != nil {
+			return
+		}
+		events = append(events, found...)
+	}
+	return
+}
+
+func findFeedEvents(ctx context.Context, institution uint64, viewer *calendarViewer) ([]*models.CalendarEvent, error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM
+			calendar_events
+		WHERE
+			institution = $1
+			AND (ends_at >= $2 OR recurrence_frequency IS NOT NULL)
+			AND %s
+		ORDER BY
+			starts_at;
+	`, calendarEventFields, calendarViewerCondition(3))
+	args := append([]any{institution, time.Now().UTC().Add(-calendarFeedHistory)}, viewer.args()...)
+	return queryCalendarEvents(ctx, query, args...)
+}
+
+// Writes events as an iCalendar (RFC 5545) document
+func writeICS(w io.Writer, name string, events []*models.CalendarEvent) {
+	host := encore.Meta().APIBaseURL.Hostname()
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//Scholaris//Calendar//EN",
+		"CALSCALE:GREGORIAN",
+		"METHOD:PUBLISH",
+		"X-WR-CALNAME:" + icsText(name),
+	}
+
+	for _, e := range events {
+		lines = append(lines,
+			"BEGIN:VEVENT",
+			fmt.Sprintf("UID:calendar-event-%d@%s", e.Id, host),
+			"DTSTAMP:"+icsTime(e.UpdatedAt),
+			"SUMMARY:"+icsText(e.Title),
+			"CATEGORIES:"+strings.ToUpper(e.Category),
+		)
+		if e.AllDay {
+			// All-day events end on the day after their last day
+			lines = append(lines,
+				"DTSTART;VALUE=DATE:"+e.StartsAt.Format("20060102"),
+				"DTEND;VALUE=DATE:"+e.EndsAt.AddDate(0, 0, 1).Format("20060102"),
+			)
+		} else {
+			lines = append(lines, "DTSTART:"+icsTime(e.StartsAt), "DTEND:"+icsTime(e.EndsAt))
+		}
+		if e.Description.Valid {
+			lines = append(lines, "DESCRIPTION:"+icsText(e.Description.String))
+		}
+		if e.Location.Valid {
+			lines = append(lines, "LOCATION:"+icsText(e.Location.String))
+		}
+		if rule := icsRecurrenceRule(e); len(rule) > 0 {
+			lines = append(lines, "RRULE:"+rule)
+		}
+		lines = append(lines, "END:VEVENT")
+	}
+	lines = append(lines, "END:VCALENDAR")
+
+	for _, line := range lines {
+		io.WriteString(w, foldICSLine(line))
+	}
+}
+
+func icsRecurrenceRule(e *models.CalendarEvent) string {
+	if !e.RecurrenceFrequency.Valid {
+		return ""
+	}
+
+	parts := []string{"FREQ=" + strings.ToUpper(e.RecurrenceFrequency.String)}
+	if e.RecurrenceInterval > 1 {
+		parts = append(parts, fmt.Sprintf("INTERVAL=%d", e.RecurrenceInterval))
+	}
+	parts = append(parts, icsMonthEndRule(e)...)
+	if e.RecurrenceCount.Valid {
+		parts = append(parts, fmt.Sprintf("COUNT=%d", e.RecurrenceCount.Int32))
+	} else if e.RecurrenceUntil.Valid && e.AllDay {
+		// UNTIL must have the same value type as DTSTART
+		parts = append(parts, "UNTIL="+e.RecurrenceUntil.Time.Format("20060102"))
+	} else if e.RecurrenceUntil.Valid {
+		parts = append(parts, "UNTIL="+icsTime(e.RecurrenceUntil.Time))
+	}
+	return strings.Join(parts, ";")
+}
+
+// Occurrences falling on a day some months do not have are moved to the last day of those months, whereas RFC 5545
+// skips them. Picking the last of the candidate days of each period keeps calendar clients in line with the API.
+func icsMonthEndRule(e *models.CalendarEvent) []string {
+	day := e.StartsAt.Day()
+	if day <= 28 {
+		return nil
+	}
+
+	days := make([]string, 0, day-27)
+	for d := 28; d <= day; d++ {
+		days = append(days, strconv.Itoa(d))
+	}
+	switch dto.RecurrenceFrequency(e.RecurrenceFrequency.String) {
+	case dto.RFMonthly:
+		return []string{"BYMONTHDAY=" + strings.Join(days, ","), "BYSETPOS=-1"}
+	case dto.RFYearly:
+		if e.StartsAt.Month() == time.February {
+			return []string{"BYMONTH=2", "BYMONTHDAY=" + strings.Join(days, ","), "BYSETPOS=-1"}
+		}
+	}
+	return nil
+}
+
+func icsTime(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+func icsText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+// Folds a content line into chunks of at most 75 octets, as required by RFC 5545
+func foldICSLine(line string) string {
+	var b strings.Builder
+	width := 0
+	for _, r := range line {
+		size := len(string(r))
+		if width+size > 75 {
+			b.WriteString("\r\n ")
+			width = 1
+		}
+		b.WriteRune(r)
+		width += size
+	}
+	b.WriteString("\r\n")
+	return b.String()
+}
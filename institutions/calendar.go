@@ -0,0 +1,453 @@
+package institutions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"encore.dev/beta/auth"
+	"encore.dev/beta/errs"
+	"encore.dev/rlog"
+	"encore.dev/storage/sqldb"
+	"github.com/brinestone/scholaris/core/permissions"
+	"github.com/brinestone/scholaris/dto"
+	"github.com/brinestone/scholaris/models"
+	"github.com/brinestone/scholaris/util"
+	"github.com/lib/pq"
+)
+
+// The most occurrences a recurring event is expanded to within a range
+const maxOccurrences = 500
+
+// Adds an event to an institution's calendar
+//
+//encore:api auth method=POST path=/institutions/:id/calendar/events tag:can_update_institution tag:institution_writable
+func CreateCalendarEvent(ctx context.Context, id uint64, req dto.CalendarEventRequest) (ans *dto.CalendarEvent, err error) {
+	if err = assertCalendarEventRefs(ctx, id, req); err != nil {
+		return
+	}
+
+	uid, _ := auth.UserID()
+	createdBy, _ := strconv.ParseUint(string(uid), 10, 64)
+	r := recurrenceColumns(req.Recurrence)
+
+	query := fmt.Sprintf(`
+		INSERT INTO calendar_events(institution, academic_year, academic_term, title, description, location, category, starts_at, ends_at, all_day, recurrence_frequency, recurrence_interval, recurrence_count, recurrence_until, audience, audience_ref, visibility, created_by)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16,$17,$18)
+		RETURNING %s;
+	`, calendarEventFields)
+	event, err := scanCalendarEvent(db.QueryRow(ctx, query, id, req.AcademicYear, req.AcademicTerm, req.Title, req.Description, req.Location, req.Category, req.StartsAt.UTC(), req.EndsAt.UTC(), req.AllDay, r.frequency, r.interval, r.count, r.until, req.Audience, req.AudienceRef, req.Visibility, createdBy))
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = &calendarEventsToDto(event)[0]
+	return
+}
+
+// Lists the events of an institution's calendar within a range. Visitors only see public events meant for everyone,
+// members see the events meant for them.
+//
+//encore:api public method=GET path=/institutions/:id/calendar/events
+func FindCalendarEvents(ctx context.Context, id uint64, req dto.FindCalendarEventsRequest) (ans *dto.CalendarEventsResponse, err error) {
+	from, to := req.From, req.To
+	if from.IsZero() {
+		from = time.Now().UTC().AddDate(0, -1, 0)
+	}
+	if to.IsZero() {
+		to = from.AddDate(1, 0, 0)
+	}
+
+	uid, authed := auth.UserID()
+	viewer, err := findCalendarViewer(ctx, id, uid, authed)
+	if err != nil {
+		rlog.Error(util.MsgCallError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM
+			calendar_events
+		WHERE
+			institution = $1
+			AND starts_at <= $3 AND (ends_at >= $2 OR recurrence_frequency IS NOT NULL)
+			AND ($4 = 0 OR academic_year = $4)
+			AND ($5 = 0 OR academic_term = $5)
+			AND %s
+		ORDER BY
+			starts_at;
+	`, calendarEventFields, calendarViewerCondition(6))
+	args := append([]any{id, from.UTC(), to.UTC(), req.AcademicYear, req.AcademicTerm}, viewer.args()...)
+	events, err := queryCalendarEvents(ctx, query, args...)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = &dto.CalendarEventsResponse{
+		Events: make([]dto.CalendarEvent, 0, len(events)),
+	}
+	for i, v := range calendarEventsToDto(events...) {
+		if v.Occurrences = expandOccurrences(events[i], from, to); len(v.Occurrences) > 0 {
+			ans.Events = append(ans.Events, v)
+		}
+	}
+	return
+}
+
+// Replaces the details of a calendar event
+//
+//encore:api auth method=PUT path=/institutions/:id/calendar/events/:event tag:can_update_institution tag:institution_writable
+func UpdateCalendarEvent(ctx context.Context, id, event uint64, req dto.CalendarEventRequest) (ans *dto.CalendarEvent, err error) {
+	if err = assertCalendarEventRefs(ctx, id, req); err != nil {
+		return
+	}
+
+	r := recurrenceColumns(req.Recurrence)
+	query := fmt.Sprintf(`
+		UPDATE calendar_events SET
+			academic_year = $3,
+			academic_term = $4,
+			title = $5,
+			description = $6,
+			location = $7,
+			category = $8,
+			starts_at = $9,
+			ends_at = $10,
+			all_day = $11,
+			recurrence_frequency = $12,
+			recurrence_interval = $13,
+			recurrence_count = $14,
+			recurrence_until = $15,
+			audience = $16,
+			audience_ref = $17,
+			visibility = $18,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE
+			id = $1 AND institution = $2
+		RETURNING %s;
+	`, calendarEventFields)
+	updated, err := scanCalendarEvent(db.QueryRow(ctx, query, event, id, req.AcademicYear, req.AcademicTerm, req.Title, req.Description, req.Location, req.Category, req.StartsAt.UTC(), req.EndsAt.UTC(), req.AllDay, r.frequency, r.interval, r.count, r.until, req.Audience, req.AudienceRef, req.Visibility))
+	if errors.Is(err, sqldb.ErrNoRows) {
+		err = &util.ErrNotFound
+		return
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = &calendarEventsToDto(updated)[0]
+	return
+}
+
+// Removes an event from an institution's calendar
+//
+//encore:api auth method=DELETE path=/institutions/:id/calendar/events/:event tag:can_update_institution tag:institution_writable
+func DeleteCalendarEvent(ctx context.Context, id, event uint64) error {
+	res, err := db.Exec(ctx, "DELETE FROM calendar_events WHERE id = $1 AND institution = $2;", event, id)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return &util.ErrUnknown
+	}
+
+	if res.RowsAffected() == 0 {
+		return &util.ErrNotFound
+	}
+	return nil
+}
+
+// Private section
+
+// What a user may see of an institution's calendar
+type calendarViewer struct {
+	// Sees every event
+	manager bool
+	member  bool
+	staff   bool
+	levels  []uint64
+	classes []uint64
+}
+
+func (v *calendarViewer) args() []any {
+	return []any{v.manager, v.member, v.staff, pq.Array(v.levels), pq.Array(v.classes)}
+}
+
+// The condition filtering events down to those a viewer may see, using the viewer's arguments from the given
+// placeholder onwards
+func calendarViewerCondition(first int) string {
+	return fmt.Sprintf(`(
+		$%[1]d
+		OR (visibility = 'public' AND audience = 'all')
+		OR ($%[2]d AND (
+			audience = 'all'
+			OR (audience = 'staff' AND $%[3]d)
+			OR (audience = 'level' AND audience_ref = ANY($%[4]d))
+			OR (audience = 'class' AND audience_ref = ANY($%[5]d))
+		))
+	)`, first, first+1, first+2, first+3, first+4)
+}
+
+func findCalendarViewer(ctx context.Context, institution uint64, uid auth.UID, authed bool) (ans *calendarViewer, err error) {
+	ans = new(calendarViewer)
+	if !authed {
+		return
+	}
+
+	actor := dto.IdentifierString(dto.PTUser, uid)
+	target := dto.IdentifierString(dto.PTInstitution, institution)
+	check := func(relation dto.PermissionName) (bool, error) {
+		res, err := permissions.CheckPermissionInternal(ctx, dto.InternalRelationCheckRequest{
+			Actor:    actor,
+			Relation: relation,
+			Target:   target,
+		})
+		if err != nil {
+			return false, err
+		}
+		return res.Allowed, nil
+	}
+
+	if ans.manager, err = check(dto.PNCanUpdate); err != nil || ans.manager {
+		return
+	}
+	if ans.member, err = check(dto.PNMember); err != nil || !ans.member {
+		return
+	}
+	if ans.staff, err = check(dto.PNStaff); err != nil {
+		return
+	}
+	if !ans.staff {
+		if ans.staff, err = check(dto.PNTeacher); err != nil {
+			return
+		}
+	}
+
+	classLevels := make(map[uint64]uint64)
+	rows, err := db.Query(ctx, "SELECT id, level FROM classes WHERE institution = $1;", institution)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	ids := make([]uint64, 0)
+	for rows.Next() {
+		var class, level uint64
+		if err = rows.Scan(&class, &level); err != nil {
+			return
+		}
+		classLevels[class] = level
+		ids = append(ids, class)
+	}
+	if len(ids) == 0 {
+		return
+	}
+
+	res, err := permissions.FilterObjectsInternal(ctx, dto.FilterObjectsRequest{
+		Actor:    actor,
+		Relation: dto.PNCanView,
+		Type:     dto.PTClass,
+		Ids:      ids,
+	})
+	if err != nil {
+		return
+	}
+
+	ans.classes = res.Allowed
+	for _, class := range res.Allowed {
+		ans.levels = append(ans.levels, classLevels[class])
+	}
+	return
+}
+
+// Ensures the academic year, term and audience of an event belong to the institution
+func assertCalendarEventRefs(ctx context.Context, institution uint64, req dto.CalendarEventRequest) error {
+	var yearOk, termOk, audienceOk bool
+	err := db.QueryRow(ctx, `
+		SELECT
+			$2::BIGINT IS NULL OR EXISTS(SELECT 1 FROM academic_years WHERE id = $2 AND institution = $1),
+			$3::BIGINT IS NULL OR EXISTS(SELECT 1 FROM academic_terms WHERE id = $3 AND year_id = $2 AND institution = $1),
+			CASE $4
+				WHEN 'level' THEN EXISTS(SELECT 1 FROM levels WHERE id = $5 AND institution = $1)
+				WHEN 'class' THEN EXISTS(SELECT 1 FROM classes WHERE id = $5 AND institution = $1)
+				ELSE TRUE
+			END;
+	`, institution, req.AcademicYear, req.AcademicTerm, req.Audience, req.AudienceRef).Scan(&yearOk, &termOk, &audienceOk)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return &util.ErrUnknown
+	}
+
+	if !yearOk {
+		return &errs.Error{Code: errs.InvalidArgument, Message: "The academic year does not exist"}
+	}
+	if !termOk {
+		return &errs.Error{Code: errs.InvalidArgument, Message: "The academic term does not belong to the academic year"}
+	}
+	if !audienceOk {
+		return &errs.Error{Code: errs.InvalidArgument, Message: fmt.Sprintf("The %s the event is meant for does not exist", req.Audience)}
+	}
+	return nil
+}
+
+type recurrenceValues struct {
+	frequency *string
+	interval  int
+	count     *int
+	until     *time.Time
+}
+
+func recurrenceColumns(r *dto.Recurrence) (ans recurrenceValues) {
+	ans.interval = 1
+	if r == nil {
+		return
+	}
+
+	frequency := string(r.Frequency)
+	ans.frequency = &frequency
+	if r.Interval > 0 {
+		ans.interval = r.Interval
+	}
+	ans.count = r.Count
+	if r.Until != nil {
+		until := r.Until.UTC()
+		ans.until = &until
+	}
+	return
+}
+
+// Lists the occurrences of an event overlapping a range
+func expandOccurrences(e *models.CalendarEvent, from, to time.Time) (ans []dto.CalendarOccurrence) {
+	duration := e.EndsAt.Sub(e.StartsAt)
+	if !e.RecurrenceFrequency.Valid {
+		if !e.StartsAt.After(to) && !e.EndsAt.Before(from) {
+			ans = append(ans, dto.CalendarOccurrence{StartsAt: e.StartsAt, EndsAt: e.EndsAt})
+		}
+		return
+	}
+
+	interval := max(e.RecurrenceInterval, 1)
+	for n := 0; len(ans) < maxOccurrences; n++ {
+		if e.RecurrenceCount.Valid && n >= int(e.RecurrenceCount.Int32) {
+			break
+		}
+
+		var start time.Time
+		switch dto.RecurrenceFrequency(e.RecurrenceFrequency.String) {
+		case dto.RFDaily:
+			start = e.StartsAt.AddDate(0, 0, n*interval)
+		case dto.RFWeekly:
+			start = e.StartsAt.AddDate(0, 0, 7*n*interval)
+		case dto.RFMonthly:
+			start = addMonthsClamped(e.StartsAt, n*interval)
+		case dto.RFYearly:
+			start = addMonthsClamped(e.StartsAt, 12*n*interval)
+		default:
+			return
+		}
+
+		if start.After(to) || (e.RecurrenceUntil.Valid && start.After(e.RecurrenceUntil.Time)) {
+			break
+		}
+		if end := start.Add(duration); !end.Before(from) {
+			ans = append(ans, dto.CalendarOccurrence{StartsAt: start, EndsAt: end})
+		}
+	}
+	return
+}
+
+// Adds months to a time, keeping to the last day of the resulting month rather than overflowing into the next one,
+// e.g. a month after January 31st is the last day of February
+func addMonthsClamped(t time.Time, months int) time.Time {
+	first := time.Date(t.Year(), t.Month()+time.Month(months), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	last := first.AddDate(0, 1, -1).Day()
+	return first.AddDate(0, 0, min(t.Day(), last)-1)
+}
+
+const calendarEventFields = "id,institution,academic_year,academic_term,title,description,location,category,starts_at,ends_at,all_day,recurrence_frequency,recurrence_interval,recurrence_count,recurrence_until,audience,audience_ref,visibility,created_by,created_at,updated_at"
+
+func queryCalendarEvents(ctx context.Context, query string, args ...any) (ans []*models.CalendarEvent, err error) {
+	rows, err := db.Query(ctx, query, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e *models.CalendarEvent
+		if e, err = scanCalendarEvent(rows); err != nil {
+			return
+		}
+		ans = append(ans, e)
+	}
+	err = rows.Err()
+	return
+}
+
+func scanCalendarEvent(row rowScanner) (*models.CalendarEvent, error) {
+	e := new(models.CalendarEvent)
+	if err := row.Scan(&e.Id, &e.Institution, &e.AcademicYear, &e.AcademicTerm, &e.Title, &e.Description, &e.Location, &e.Category, &e.StartsAt, &e.EndsAt, &e.AllDay, &e.RecurrenceFrequency, &e.RecurrenceInterval, &e.RecurrenceCount, &e.RecurrenceUntil, &e.Audience, &e.AudienceRef, &e.Visibility, &e.CreatedBy, &e.CreatedAt, &e.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func calendarEventsToDto(events ...*models.CalendarEvent) (ans []dto.CalendarEvent) {
+	ans = make([]dto.CalendarEvent, 0, len(events))
+	for _, e := range events {
+		v := dto.CalendarEvent{
+			Id:          e.Id,
+			Institution: e.Institution,
+			Title:       e.Title,
+			Category:    dto.CalendarEventCategory(e.Category),
+			StartsAt:    e.StartsAt,
+			EndsAt:      e.EndsAt,
+			AllDay:      e.AllDay,
+			Audience:    dto.CalendarAudience(e.Audience),
+			Visibility:  dto.CalendarVisibility(e.Visibility),
+			CreatedBy:   e.CreatedBy,
+			CreatedAt:   e.CreatedAt,
+			UpdatedAt:   e.UpdatedAt,
+		}
+		if e.AcademicYear.Valid {
+			year := uint64(e.AcademicYear.Int64)
+			v.AcademicYear = &year
+		}
+		if e.AcademicTerm.Valid {
+			term := uint64(e.AcademicTerm.Int64)
+			v.AcademicTerm = &term
+		}
+		if e.Description.Valid {
+			v.Description = &e.Description.String
+		}
+		if e.Location.Valid {
+			v.Location = &e.Location.String
+		}
+		if e.AudienceRef.Valid {
+			ref := uint64(e.AudienceRef.Int64)
+			v.AudienceRef = &ref
+		}
+		if e.RecurrenceFrequency.Valid {
+			v.Recurrence = &dto.Recurrence{
+				Frequency: dto.RecurrenceFrequency(e.RecurrenceFrequency.String),
+				Interval:  e.RecurrenceInterval,
+			}
+			if e.RecurrenceCount.Valid {
+				count := int(e.RecurrenceCount.Int32)
+				v.Recurrence.Count = &count
+			}
+			if e.RecurrenceUntil.Valid {
+				v.Recurrence.Until = &e.RecurrenceUntil.Time
+			}
+		}
+		ans = append(ans, v)
+	}
+	return
+}
@@ -0,0 +1,128 @@
+package institutions_test
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"encore.dev/beta/errs"
+	"github.com/brinestone/scholaris/dto"
+	"github.com/brinestone/scholaris/institutions"
+	"github.com/brinestone/scholaris/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCalendarEvents(t *testing.T) {
+	i, err := makeInstitution()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	start := time.Now().UTC().Truncate(time.Hour).Add(24 * time.Hour)
+	count := 3
+	event, err := institutions.CreateCalendarEvent(mainContext, i.Id, dto.CalendarEventRequest{
+		Title:      "Staff meeting",
+		Category:   dto.CECMeeting,
+		StartsAt:   start,
+		EndsAt:     start.Add(time.Hour),
+		Recurrence: &dto.Recurrence{Frequency: dto.RFWeekly, Count: &count},
+		Audience:   dto.CAAll,
+		Visibility: dto.CVPublic,
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	res, err := institutions.FindCalendarEvents(mainContext, i.Id, dto.FindCalendarEventsRequest{From: start.Add(-time.Hour), To: start.AddDate(0, 2, 0)})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if assert.Len(t, res.Events, 1) {
+		assert.Equal(t, event.Id, res.Events[0].Id)
+		if assert.Len(t, res.Events[0].Occurrences, count) {
+			assert.Equal(t, start.AddDate(0, 0, 14), res.Events[0].Occurrences[2].StartsAt.UTC())
+		}
+	}
+
+	feed, err := institutions.RotateInstitutionCalendarFeed(mainContext, i.Id)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.Contains(t, feed.Url, "/calendar-feeds/institution/")
+
+	err = institutions.DeleteCalendarEvent(mainContext, i.Id, event.Id)
+	assert.Nil(t, err)
+}
+
+func TestMonthlyOccurrencesKeepToTheEndOfShortMonths(t *testing.T) {
+	start := time.Date(2025, time.January, 31, 8, 0, 0, 0, time.UTC)
+	event := &models.CalendarEvent{
+		StartsAt:            start,
+		EndsAt:              start.Add(time.Hour),
+		RecurrenceFrequency: sql.NullString{String: string(dto.RFMonthly), Valid: true},
+		RecurrenceInterval:  1,
+		RecurrenceCount:     sql.NullInt32{Int32: 4, Valid: true},
+	}
+
+	occurrences := institutions.ExpandOccurrences(event, start, start.AddDate(1, 0, 0))
+	days := make([]string, 0, len(occurrences))
+	for _, o := range occurrences {
+		days = append(days, o.StartsAt.Format("2006-01-02"))
+	}
+	assert.Equal(t, []string{"2025-01-31", "2025-02-28", "2025-03-31", "2025-04-30"}, days)
+	assert.Equal(t, "FREQ=MONTHLY;BYMONTHDAY=28,29,30,31;BYSETPOS=-1;COUNT=4", institutions.IcsRecurrenceRule(event))
+}
+
+func TestAllDayRecurrenceEndsOnADate(t *testing.T) {
+	start := time.Date(2025, time.March, 3, 0, 0, 0, 0, time.UTC)
+	event := &models.CalendarEvent{
+		StartsAt:            start,
+		EndsAt:              start,
+		AllDay:              true,
+		RecurrenceFrequency: sql.NullString{String: string(dto.RFWeekly), Valid: true},
+		RecurrenceInterval:  2,
+		RecurrenceUntil:     sql.NullTime{Time: start.AddDate(0, 2, 0), Valid: true},
+	}
+
+	assert.Equal(t, "FREQ=WEEKLY;INTERVAL=2;UNTIL=20250503", institutions.IcsRecurrenceRule(event))
+}
+
+func TestDeleteAcademicTermWithEvents(t *testing.T) {
+	i, err := makeInstitution()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	year, err := makeAcademicYear(i.Id)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	term := year.Terms[0]
+
+	if _, err = institutions.CreateCalendarEvent(mainContext, i.Id, dto.CalendarEventRequest{
+		Title:        "Exams",
+		Category:     dto.CECMeeting,
+		StartsAt:     term.StartDate,
+		EndsAt:       term.StartDate.Add(time.Hour),
+		AcademicYear: &year.Id,
+		AcademicTerm: &term.Id,
+		Audience:     dto.CAAll,
+		Visibility:   dto.CVPublic,
+	}); err != nil {
+		t.Error(err)
+		return
+	}
+
+	_, err = institutions.DeleteAcademicTerm(mainContext, i.Id, year.Id, term.Id)
+	assert.Equal(t, errs.FailedPrecondition, errs.Code(err))
+
+	err = institutions.DeleteAcademicYear(mainContext, i.Id, year.Id)
+	assert.Equal(t, errs.FailedPrecondition, errs.Code(err))
+}
@@ -0,0 +1,809 @@
+package institutions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"encore.dev/beta/auth"
+	"encore.dev/beta/errs"
+	"encore.dev/rlog"
+	"encore.dev/storage/sqldb"
+	"github.com/brinestone/scholaris/core/permissions"
+	"github.com/brinestone/scholaris/dto"
+	"github.com/brinestone/scholaris/models"
+	"github.com/brinestone/scholaris/util"
+)
+
+// Creates a class within a level for an academic year
+//
+//encore:api auth method=POST path=/institutions/:id/classes tag:can_update_institution tag:institution_writable
+func CreateClass(ctx context.Context, id uint64, req dto.NewClassRequest) (ans *dto.Class, err error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+	defer tx.Rollback()
+
+	if err = assertClassPlacement(ctx, tx, id, req.Level, req.AcademicYear); err != nil {
+		return
+	}
+
+	if err = assertClassName(ctx, tx, 0, req.AcademicYear, req.Level, req.Name); err != nil {
+		return
+	}
+
+	if req.HomeroomTeacher != nil {
+		if err = assertInstitutionRole(ctx, id, *req.HomeroomTeacher, dto.PNTeacher); err != nil {
+			return
+		}
+	}
+
+	var class uint64
+	if err = tx.QueryRow(ctx, `
+		INSERT INTO classes(institution, level, academic_year, name, stream, capacity, homeroom_teacher)
+		VALUES ($1,$2,$3,$4,$5,$6,$7)
+		RETURNING id;
+	`, id, req.Level, req.AcademicYear, req.Name, req.Stream, req.Capacity, req.HomeroomTeacher).Scan(&class); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	target := dto.IdentifierString(dto.PTClass, class)
+	updates := []dto.PermissionUpdate{
+		{Actor: dto.IdentifierString(dto.PTInstitution, id), Relation: dto.PNOwner, Target: target},
+	}
+	if req.HomeroomTeacher != nil {
+		updates = append(updates, dto.PermissionUpdate{Actor: dto.IdentifierString(dto.PTUser, *req.HomeroomTeacher), Relation: dto.PNHomeroomTeacher, Target: target})
+	}
+	if err = permissions.SetPermissions(ctx, dto.UpdatePermissionsRequest{Updates: updates}); err != nil {
+		rlog.Error(util.MsgCallError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	created, err := findClass(ctx, tx, id, class)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = &classesToDto(created)[0]
+	return
+}
+
+// Lists the classes of an institution, optionally narrowed down to an academic year and a level
+//
+//encore:api auth method=GET path=/institutions/:id/classes tag:institution_member
+func FindClasses(ctx context.Context, id uint64, req dto.FindClassesRequest) (ans *dto.ClassesResponse, err error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM
+			classes c
+			JOIN levels l ON l.id = c.level
+		WHERE
+			c.institution = $1 AND ($2 = 0 OR c.academic_year = $2) AND ($3 = 0 OR c.level = $3)
+		ORDER BY
+			c.academic_year DESC, l.position, c.name;
+	`, classFields)
+	classes, err := queryClasses(ctx, query, id, req.AcademicYear, req.Level)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = &dto.ClassesResponse{
+		Classes: classesToDto(classes...),
+	}
+	return
+}
+
+// Updates a class
+//
+//encore:api auth method=PATCH path=/institutions/:id/classes/:class tag:can_update_institution tag:institution_writable
+func UpdateClass(ctx context.Context, id, class uint64, req dto.UpdateClassRequest) (ans *dto.Class, err error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+	defer tx.Rollback()
+
+	current, err := findClass(ctx, tx, id, class)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		err = &util.ErrNotFound
+		return
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if req.Name != nil {
+		if err = assertClassName(ctx, tx, class, current.AcademicYear, current.Level, *req.Name); err != nil {
+			return
+		}
+	}
+
+	if req.Capacity != nil && *req.Capacity > 0 && uint(*req.Capacity) < current.Students {
+		err = &errs.Error{
+			Code:    errs.FailedPrecondition,
+			Message: fmt.Sprintf("The class already has %d students", current.Students),
+		}
+		return
+	}
+
+	if req.HomeroomTeacher != nil && *req.HomeroomTeacher != 0 {
+		if err = assertInstitutionRole(ctx, id, *req.HomeroomTeacher, dto.PNTeacher); err != nil {
+			return
+		}
+	}
+
+	if _, err = tx.Exec(ctx, `
+		UPDATE classes SET
+			name = COALESCE($3, name),
+			stream = CASE WHEN $4::TEXT IS NULL THEN stream ELSE NULLIF($4, '') END,
+			capacity = CASE WHEN $5::INT IS NULL THEN capacity ELSE NULLIF($5, 0) END,
+			homeroom_teacher = CASE WHEN $6::BIGINT IS NULL THEN homeroom_teacher ELSE NULLIF($6, 0) END,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE
+			id = $1 AND institution = $2;
+	`, class, id, req.Name, req.Stream, req.Capacity, req.HomeroomTeacher); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if req.HomeroomTeacher != nil && (!current.HomeroomTeacher.Valid || uint64(current.HomeroomTeacher.Int64) != *req.HomeroomTeacher) {
+		target := dto.IdentifierString(dto.PTClass, class)
+		change := dto.ReplacePermissionsRequest{}
+		// The previous teacher's tuple may already be gone, ReplacePermissions skips deletes of missing tuples
+		if current.HomeroomTeacher.Valid {
+			change.Deletes = append(change.Deletes, dto.PermissionUpdate{Actor: dto.IdentifierString(dto.PTUser, uint64(current.HomeroomTeacher.Int64)), Relation: dto.PNHomeroomTeacher, Target: target})
+		}
+		if *req.HomeroomTeacher != 0 {
+			change.Writes = append(change.Writes, dto.PermissionUpdate{Actor: dto.IdentifierString(dto.PTUser, *req.HomeroomTeacher), Relation: dto.PNHomeroomTeacher, Target: target})
+		}
+		if len(change.Writes) > 0 || len(change.Deletes) > 0 {
+			if err = permissions.ReplacePermissions(ctx, change); err != nil {
+				rlog.Error(util.MsgCallError, "err", err)
+				err = &util.ErrUnknown
+				return
+			}
+		}
+	}
+
+	updated, err := findClass(ctx, tx, id, class)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = &classesToDto(updated)[0]
+	return
+}
+
+// Deletes a class. Classes which ever had students are kept for their history.
+//
+//encore:api auth method=DELETE path=/institutions/:id/classes/:class tag:can_update_institution tag:institution_writable
+func DeleteClass(ctx context.Context, id, class uint64) (err error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return &util.ErrUnknown
+	}
+	defer tx.Rollback()
+
+	var hasHistory bool
+	err = tx.QueryRow(ctx, `
+		SELECT
+			EXISTS(SELECT 1 FROM class_placements WHERE class = c.id OR transferred_to = c.id)
+		FROM
+			classes c
+		WHERE
+			c.id = $1 AND c.institution = $2
+		FOR UPDATE;
+	`, class, id).Scan(&hasHistory)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		return &util.ErrNotFound
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return &util.ErrUnknown
+	}
+
+	if hasHistory {
+		return &errs.Error{
+			Code:    errs.FailedPrecondition,
+			Message: "Classes which have had students cannot be deleted",
+		}
+	}
+
+	objects := []string{dto.IdentifierString(dto.PTClass, class)}
+	rows, err := tx.Query(ctx, "DELETE FROM courses WHERE class = $1 RETURNING id;", class)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return &util.ErrUnknown
+	}
+	for rows.Next() {
+		var course uint64
+		if err = rows.Scan(&course); err != nil {
+			rows.Close()
+			rlog.Error(util.MsgDbAccessError, "err", err)
+			return &util.ErrUnknown
+		}
+		objects = append(objects, dto.IdentifierString(dto.PTCourse, course))
+	}
+	rows.Close()
+
+	if _, err = tx.Exec(ctx, "DELETE FROM classes WHERE id = $1;", class); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return &util.ErrUnknown
+	}
+
+	if _, err = permissions.PurgeObjectTuples(ctx, dto.PurgeObjectTuplesRequest{
+		Objects: objects,
+	}); err != nil {
+		rlog.Error(util.MsgCallError, "err", err)
+		return &util.ErrUnknown
+	}
+
+	if err = tx.Commit(); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return &util.ErrUnknown
+	}
+	return
+}
+
+// Assigns a teacher of the institution to a class
+//
+//encore:api auth method=POST path=/institutions/:id/classes/:class/teachers tag:can_update_institution tag:institution_writable
+func AssignClassTeacher(ctx context.Context, id, class uint64, req dto.ClassTeacherRequest) (err error) {
+	if _, err = findClass(ctx, nil, id, class); errors.Is(err, sqldb.ErrNoRows) {
+		return &util.ErrNotFound
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return &util.ErrUnknown
+	}
+
+	if err = assertInstitutionRole(ctx, id, req.Teacher, dto.PNTeacher); err != nil {
+		return
+	}
+
+	if err = permissions.SetPermissions(ctx, dto.UpdatePermissionsRequest{
+		Updates: []dto.PermissionUpdate{
+			{Actor: dto.IdentifierString(dto.PTUser, req.Teacher), Relation: dto.PNTeacher, Target: dto.IdentifierString(dto.PTClass, class)},
+		},
+	}); err != nil {
+		rlog.Error(util.MsgCallError, "err", err)
+		return &util.ErrUnknown
+	}
+	return
+}
+
+// Lists the teachers of a class
+//
+//encore:api auth method=GET path=/institutions/:id/classes/:class/teachers tag:can_view_class
+func FindClassTeachers(ctx context.Context, id, class uint64) (ans *dto.ClassTeachersResponse, err error) {
+	c, err := findClass(ctx, nil, id, class)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		err = &util.ErrNotFound
+		return
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	res, err := permissions.ListUsersInternal(ctx, dto.ListUsersRequest{
+		Target:   dto.IdentifierString(dto.PTClass, class),
+		Relation: dto.PNTeacher,
+	})
+	if err != nil {
+		rlog.Error(util.MsgCallError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = &dto.ClassTeachersResponse{
+		Teachers: res.Users,
+	}
+	if c.HomeroomTeacher.Valid {
+		teacher := uint64(c.HomeroomTeacher.Int64)
+		ans.HomeroomTeacher = &teacher
+	}
+	return
+}
+
+// Removes a teacher from a class. Homeroom teachers are changed by updating the class.
+//
+//encore:api auth method=DELETE path=/institutions/:id/classes/:class/teachers/:teacher tag:can_update_institution tag:institution_writable
+func RemoveClassTeacher(ctx context.Context, id, class, teacher uint64) (err error) {
+	if _, err = findClass(ctx, nil, id, class); errors.Is(err, sqldb.ErrNoRows) {
+		return &util.ErrNotFound
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return &util.ErrUnknown
+	}
+
+	if err = permissions.DeletePermissions(ctx, dto.UpdatePermissionsRequest{
+		Updates: []dto.PermissionUpdate{
+			{Actor: dto.IdentifierString(dto.PTUser, teacher), Relation: dto.PNTeacher, Target: dto.IdentifierString(dto.PTClass, class)},
+		},
+	}); err != nil {
+		rlog.Error(util.MsgCallError, "err", err)
+		return &util.ErrUnknown
+	}
+	return
+}
+
+// Places an attending student record of the institution in a class. A student sits in a single class per academic
+// year.
+//
+//encore:api auth method=POST path=/institutions/:id/classes/:class/students tag:can_update_institution tag:institution_writable
+func PlaceStudent(ctx context.Context, id, class uint64, req dto.PlaceStudentRequest) (ans *dto.ClassPlacement, err error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+	defer tx.Rollback()
+
+	s, err := lockStudent(ctx, tx, id, req.Student)
+	if err != nil {
+		return
+	}
+
+	if !dto.StudentStatus(s.Status).Attending() {
+		err = &errs.Error{
+			Code:    errs.FailedPrecondition,
+			Message: "Only attending students can be placed in a class",
+		}
+		return
+	}
+
+	c, err := findClassForPlacement(ctx, tx, id, class)
+	if err != nil {
+		return
+	}
+
+	placement, err := createPlacement(ctx, tx, c, req.Student)
+	if err != nil {
+		return
+	}
+
+	if err = permissions.SetPermissions(ctx, dto.UpdatePermissionsRequest{
+		Updates: []dto.PermissionUpdate{
+			{Actor: classStudent(req.Student), Relation: dto.PNStudent, Target: dto.IdentifierString(dto.PTClass, class)},
+		},
+	}); err != nil {
+		rlog.Error(util.MsgCallError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = &placementsToDto(placement)[0]
+	return
+}
+
+// Lists the students of a class
+//
+//encore:api auth method=GET path=/institutions/:id/classes/:class/students tag:can_view_class
+func FindClassStudents(ctx context.Context, id, class uint64, req dto.FindClassStudentsRequest) (ans *dto.ClassPlacementsResponse, err error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM
+			class_placements p
+			JOIN classes c ON c.id = p.class
+		WHERE
+			p.class = $1 AND c.institution = $2 AND ($3 OR p.removed_at IS NULL)
+		ORDER BY
+			p.placed_at;
+	`, placementFields)
+	placements, err := queryPlacements(ctx, query, class, id, req.IncludeRemoved)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = &dto.ClassPlacementsResponse{
+		Placements: placementsToDto(placements...),
+	}
+	return
+}
+
+// Withdraws a student from a class
+//
+//encore:api auth method=DELETE path=/institutions/:id/classes/:class/students/:student tag:can_update_institution tag:institution_writable
+func RemoveStudent(ctx context.Context, id, class, student uint64) (err error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return &util.ErrUnknown
+	}
+	defer tx.Rollback()
+
+	if _, err = endPlacement(ctx, tx, id, class, student, dto.PRRWithdrawn, nil, nil); errors.Is(err, sqldb.ErrNoRows) {
+		return &util.ErrNotFound
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return &util.ErrUnknown
+	}
+
+	if err = permissions.DeletePermissions(ctx, dto.UpdatePermissionsRequest{
+		Updates: []dto.PermissionUpdate{
+			{Actor: classStudent(student), Relation: dto.PNStudent, Target: dto.IdentifierString(dto.PTClass, class)},
+		},
+	}); err != nil {
+		rlog.Error(util.MsgCallError, "err", err)
+		return &util.ErrUnknown
+	}
+
+	if err = tx.Commit(); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return &util.ErrUnknown
+	}
+	return
+}
+
+// Moves a student to another class of the same academic year
+//
+//encore:api auth method=POST path=/institutions/:id/classes/:class/students/:student/transfer tag:can_update_institution tag:institution_writable
+func TransferStudent(ctx context.Context, id, class, student uint64, req dto.TransferStudentRequest) (ans *dto.ClassPlacement, err error) {
+	if req.To == class {
+		err = &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: "The student is already in this class",
+		}
+		return
+	}
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+	defer tx.Rollback()
+
+	to, err := findClassForPlacement(ctx, tx, id, req.To)
+	if err != nil {
+		return
+	}
+
+	previous, err := endPlacement(ctx, tx, id, class, student, dto.PRRTransferred, req.Reason, &req.To)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		err = &util.ErrNotFound
+		return
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if previous.AcademicYear != to.AcademicYear {
+		err = &errs.Error{
+			Code:    errs.FailedPrecondition,
+			Message: "Students can only be transferred between classes of the same academic year",
+		}
+		return
+	}
+
+	placement, err := createPlacement(ctx, tx, to, student)
+	if err != nil {
+		return
+	}
+
+	actor := classStudent(student)
+	if err = permissions.ReplacePermissions(ctx, dto.ReplacePermissionsRequest{
+		Writes:  []dto.PermissionUpdate{{Actor: actor, Relation: dto.PNStudent, Target: dto.IdentifierString(dto.PTClass, req.To)}},
+		Deletes: []dto.PermissionUpdate{{Actor: actor, Relation: dto.PNStudent, Target: dto.IdentifierString(dto.PTClass, class)}},
+	}); err != nil {
+		rlog.Error(util.MsgCallError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = &placementsToDto(placement)[0]
+	return
+}
+
+// Private section
+
+// Ensures the level and the academic year of a class belong to the institution and that the level is active
+func assertClassPlacement(ctx context.Context, tx *sqldb.Tx, institution, level, academicYear uint64) error {
+	var levelOk, yearOk bool
+	if err := tx.QueryRow(ctx, `
+		SELECT
+			EXISTS(SELECT 1 FROM levels WHERE id = $2 AND institution = $1 AND archived_at IS NULL),
+			EXISTS(SELECT 1 FROM academic_years WHERE id = $3 AND institution = $1);
+	`, institution, level, academicYear).Scan(&levelOk, &yearOk); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return &util.ErrUnknown
+	}
+
+	if !levelOk {
+		return &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: "The level does not exist or is archived",
+		}
+	}
+	if !yearOk {
+		return &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: "The academic year does not exist",
+		}
+	}
+	return nil
+}
+
+// The student of a class placed with a student record. The class is granted to the record's account, so that whichever
+// account is linked to the record sits in the class.
+func classStudent(student uint64) string {
+	return fmt.Sprintf("%s#%s", dto.IdentifierString(dto.PTStudentRecord, student), dto.PNAccount)
+}
+
+func assertClassName(ctx context.Context, tx *sqldb.Tx, class, academicYear, level uint64, name string) error {
+	var taken bool
+	if err := tx.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM classes WHERE id <> $1 AND academic_year = $2 AND level = $3 AND LOWER(name) = LOWER($4));", class, academicYear, level, name).Scan(&taken); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return &util.ErrUnknown
+	}
+
+	if taken {
+		return &errs.Error{
+			Code:    errs.AlreadyExists,
+			Message: fmt.Sprintf("A class named %q already exists in this level for the academic year", name),
+		}
+	}
+	return nil
+}
+
+// Ensures a user holds a role in the institution
+func assertInstitutionRole(ctx context.Context, institution, user uint64, role dto.PermissionName) error {
+	res, err := permissions.CheckPermissionInternal(ctx, dto.InternalRelationCheckRequest{
+		Actor:    dto.IdentifierString(dto.PTUser, user),
+		Relation: role,
+		Target:   dto.IdentifierString(dto.PTInstitution, institution),
+	})
+	if err != nil {
+		rlog.Error(util.MsgCallError, "err", err)
+		return &util.ErrUnknown
+	}
+
+	if !res.Allowed {
+		return &errs.Error{
+			Code:    errs.FailedPrecondition,
+			Message: fmt.Sprintf("The user is not a %s of this institution", role),
+		}
+	}
+	return nil
+}
+
+// Locks a class for a placement and ensures it has room left
+func findClassForPlacement(ctx context.Context, tx *sqldb.Tx, institution, class uint64) (*models.Class, error) {
+	if _, err := tx.Exec(ctx, "SELECT 1 FROM classes WHERE id = $1 FOR UPDATE;", class); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return nil, &util.ErrUnknown
+	}
+
+	c, err := findClass(ctx, tx, institution, class)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		return nil, &util.ErrNotFound
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return nil, &util.ErrUnknown
+	}
+
+	if c.Capacity.Valid && c.Students >= uint(c.Capacity.Int32) {
+		return nil, &errs.Error{
+			Code:    errs.ResourceExhausted,
+			Message: "The class is full",
+		}
+	}
+	return c, nil
+}
+
+func createPlacement(ctx context.Context, tx *sqldb.Tx, class *models.Class, student uint64) (*models.ClassPlacement, error) {
+	uid, _ := auth.UserID()
+	placedBy, _ := strconv.ParseUint(string(uid), 10, 64)
+
+	query := fmt.Sprintf(`
+		INSERT INTO class_placements AS p(class, academic_year, student, placed_by)
+		VALUES ($1,$2,$3,$4)
+		ON CONFLICT (academic_year, student) WHERE removed_at IS NULL DO NOTHING
+		RETURNING %s;
+	`, placementFields)
+	placement, err := scanPlacement(tx.QueryRow(ctx, query, class.Id, class.AcademicYear, student, placedBy))
+	if errors.Is(err, sqldb.ErrNoRows) {
+		return nil, &errs.Error{
+			Code:    errs.AlreadyExists,
+			Message: "The student is already placed in a class for this academic year",
+		}
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return nil, &util.ErrUnknown
+	}
+	return placement, nil
+}
+
+func endPlacement(ctx context.Context, tx *sqldb.Tx, institution, class, student uint64, reason dto.PlacementRemovalReason, note *string, transferredTo *uint64) (*models.ClassPlacement, error) {
+	uid, _ := auth.UserID()
+	removedBy, _ := strconv.ParseUint(string(uid), 10, 64)
+
+	query := fmt.Sprintf(`
+		UPDATE class_placements p SET
+			removed_at = CURRENT_TIMESTAMP,
+			removed_by = $4,
+			removal_reason = $5,
+			removal_note = $6,
+			transferred_to = $7
+		FROM
+			classes c
+		WHERE
+			c.id = p.class AND p.class = $1 AND c.institution = $2 AND p.student = $3 AND p.removed_at IS NULL
+		RETURNING %s;
+	`, placementFields)
+	return scanPlacement(tx.QueryRow(ctx, query, class, institution, student, removedBy, reason, note, transferredTo))
+}
+
+const classFields = "c.id,c.institution,c.level,c.academic_year,c.name,c.stream,c.capacity,c.homeroom_teacher,(SELECT COUNT(*) FROM class_placements cp WHERE cp.class = c.id AND cp.removed_at IS NULL),c.created_at,c.updated_at"
+
+// Finds a class of an institution, within the transaction when one is given
+func findClass(ctx context.Context, tx *sqldb.Tx, institution, class uint64) (*models.Class, error) {
+	query := fmt.Sprintf("SELECT %s FROM classes c WHERE c.id = $1 AND c.institution = $2;", classFields)
+	if tx != nil {
+		return scanClass(tx.QueryRow(ctx, query, class, institution))
+	}
+	return scanClass(db.QueryRow(ctx, query, class, institution))
+}
+
+func queryClasses(ctx context.Context, query string, args ...any) (ans []*models.Class, err error) {
+	rows, err := db.Query(ctx, query, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c *models.Class
+		if c, err = scanClass(rows); err != nil {
+			return
+		}
+		ans = append(ans, c)
+	}
+	err = rows.Err()
+	return
+}
+
+func scanClass(row rowScanner) (*models.Class, error) {
+	c := new(models.Class)
+	if err := row.Scan(&c.Id, &c.Institution, &c.Level, &c.AcademicYear, &c.Name, &c.Stream, &c.Capacity, &c.HomeroomTeacher, &c.Students, &c.CreatedAt, &c.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func classesToDto(classes ...*models.Class) (ans []dto.Class) {
+	ans = make([]dto.Class, 0, len(classes))
+	for _, c := range classes {
+		v := dto.Class{
+			Id:           c.Id,
+			Institution:  c.Institution,
+			Level:        c.Level,
+			AcademicYear: c.AcademicYear,
+			Name:         c.Name,
+			Students:     c.Students,
+			CreatedAt:    c.CreatedAt,
+			UpdatedAt:    c.UpdatedAt,
+		}
+		if c.Stream.Valid {
+			v.Stream = &c.Stream.String
+		}
+		if c.Capacity.Valid {
+			capacity := int(c.Capacity.Int32)
+			v.Capacity = &capacity
+		}
+		if c.HomeroomTeacher.Valid {
+			teacher := uint64(c.HomeroomTeacher.Int64)
+			v.HomeroomTeacher = &teacher
+		}
+		ans = append(ans, v)
+	}
+	return
+}
+
+const placementFields = "p.id,p.class,p.academic_year,p.student,p.placed_by,p.placed_at,p.removed_at,p.removed_by,p.removal_reason,p.removal_note,p.transferred_to"
+
+func queryPlacements(ctx context.Context, query string, args ...any) (ans []*models.ClassPlacement, err error) {
+	rows, err := db.Query(ctx, query, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p *models.ClassPlacement
+		if p, err = scanPlacement(rows); err != nil {
+			return
+		}
+		ans = append(ans, p)
+	}
+	err = rows.Err()
+	return
+}
+
+func scanPlacement(row rowScanner) (*models.ClassPlacement, error) {
+	p := new(models.ClassPlacement)
+	if err := row.Scan(&p.Id, &p.Class, &p.AcademicYear, &p.Student, &p.PlacedBy, &p.PlacedAt, &p.RemovedAt, &p.RemovedBy, &p.RemovalReason, &p.RemovalNote, &p.TransferredTo); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func placementsToDto(placements ...*models.ClassPlacement) (ans []dto.ClassPlacement) {
+	ans = make([]dto.ClassPlacement, 0, len(placements))
+	for _, p := range placements {
+		v := dto.ClassPlacement{
+			Id:           p.Id,
+			Class:        p.Class,
+			AcademicYear: p.AcademicYear,
+			Student:      p.Student,
+			PlacedBy:     p.PlacedBy,
+			PlacedAt:     p.PlacedAt,
+		}
+		if p.RemovedAt.Valid {
+			v.RemovedAt = &p.RemovedAt.Time
+		}
+		if p.RemovedBy.Valid {
+			removedBy := uint64(p.RemovedBy.Int64)
+			v.RemovedBy = &removedBy
+		}
+		if p.RemovalReason.Valid {
+			reason := dto.PlacementRemovalReason(p.RemovalReason.String)
+			v.RemovalReason = &reason
+		}
+		if p.RemovalNote.Valid {
+			v.RemovalNote = &p.RemovalNote.String
+		}
+		if p.TransferredTo.Valid {
+			to := uint64(p.TransferredTo.Int64)
+			v.TransferredTo = &to
+		}
+		ans = append(ans, v)
+	}
+	return
+}
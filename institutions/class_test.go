@@ -0,0 +1,141 @@
+package institutions_test
+
+import (
+	"testing"
+	"time"
+
+	"encore.dev/beta/errs"
+	"github.com/brinestone/scholaris/dto"
+	"github.com/brinestone/scholaris/institutions"
+	"github.com/stretchr/testify/assert"
+)
+
+func makeAcademicYear(institution uint64) (*dto.AcademicYear, error) {
+	err := institutions.CreateAcademicYear(mainContext, dto.NewAcademicYearRequest{
+		Institution:   institution,
+		StartOffset:   time.Hour * 2,
+		TermDurations: []time.Duration{time.Hour * 2190, time.Hour * 2190, time.Hour * 2190},
+		Vacations:     []time.Duration{time.Hour * 336, time.Hour * 336},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := institutions.GetAcademicYears(mainContext, dto.GetAcademicYearsRequest{Institution: institution, Size: 1})
+	if err != nil {
+		return nil, err
+	}
+	return &res.AcademicYears[0], nil
+}
+
+func TestClasses(t *testing.T) {
+	i, err := makeInstitution()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	year, err := makeAcademicYear(i.Id)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	level, err := institutions.CreateLevel(mainContext, i.Id, dto.NewLevelRequest{Name: "Form 2"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	capacity := 1
+	a, err := institutions.CreateClass(mainContext, i.Id, dto.NewClassRequest{Level: level.Id, AcademicYear: year.Id, Name: "A", Capacity: &capacity})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	b, err := institutions.CreateClass(mainContext, i.Id, dto.NewClassRequest{Level: level.Id, AcademicYear: year.Id, Name: "B"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	_, err = institutions.CreateClass(mainContext, i.Id, dto.NewClassRequest{Level: level.Id, AcademicYear: year.Id, Name: "a"})
+	assert.NotNil(t, err)
+
+	jane, err := institutions.CreateStudent(mainContext, i.Id, dto.NewStudentRequest{FirstName: "Jane", LastName: "Doe"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	john, err := institutions.CreateStudent(mainContext, i.Id, dto.NewStudentRequest{FirstName: "John", LastName: "Doe"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	_, err = institutions.PlaceStudent(mainContext, i.Id, a.Id, dto.PlaceStudentRequest{Student: jane.Id})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	_, err = institutions.PlaceStudent(mainContext, i.Id, a.Id, dto.PlaceStudentRequest{Student: john.Id})
+	assert.NotNil(t, err, "the class is full")
+
+	_, err = institutions.PlaceStudent(mainContext, i.Id, b.Id, dto.PlaceStudentRequest{Student: jane.Id})
+	assert.NotNil(t, err, "the student already has a class this year")
+
+	if _, err = institutions.ChangeStudentStatus(mainContext, i.Id, john.Id, dto.StudentStatusRequest{Status: dto.SSWithdrawn}); err != nil {
+		t.Error(err)
+		return
+	}
+	_, err = institutions.PlaceStudent(mainContext, i.Id, b.Id, dto.PlaceStudentRequest{Student: john.Id})
+	assert.Equal(t, errs.FailedPrecondition, errs.Code(err), "withdrawn students cannot be placed")
+
+	placement, err := institutions.TransferStudent(mainContext, i.Id, a.Id, jane.Id, dto.TransferStudentRequest{To: b.Id})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.Equal(t, b.Id, placement.Class)
+	assert.Equal(t, jane.Id, placement.Student)
+
+	history, err := institutions.FindClassStudents(mainContext, i.Id, a.Id, dto.FindClassStudentsRequest{IncludeRemoved: true})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.Len(t, history.Placements, 1)
+	assert.Equal(t, dto.PRRTransferred, *history.Placements[0].RemovalReason)
+
+	err = institutions.DeleteClass(mainContext, i.Id, a.Id)
+	assert.NotNil(t, err)
+}
+
+func TestDeleteAcademicYearWithClasses(t *testing.T) {
+	i, err := makeInstitution()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	year, err := makeAcademicYear(i.Id)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	level, err := institutions.CreateLevel(mainContext, i.Id, dto.NewLevelRequest{Name: "Form 1"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if _, err = institutions.CreateClass(mainContext, i.Id, dto.NewClassRequest{Level: level.Id, AcademicYear: year.Id, Name: "A"}); err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = institutions.DeleteAcademicYear(mainContext, i.Id, year.Id)
+	assert.Equal(t, errs.FailedPrecondition, errs.Code(err))
+}
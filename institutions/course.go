@@ -0,0 +1,817 @@
+package institutions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"encore.dev/beta/auth"
+	"encore.dev/beta/errs"
+	"encore.dev/rlog"
+	"encore.dev/storage/sqldb"
+	"github.com/brinestone/scholaris/core/permissions"
+	"github.com/brinestone/scholaris/dto"
+	"github.com/brinestone/scholaris/models"
+	"github.com/brinestone/scholaris/util"
+	"github.com/lib/pq"
+)
+
+// Starts teaching a subject of the class's level in a class
+//
+//encore:api auth method=POST path=/institutions/:id/classes/:class/courses tag:can_update_institution tag:institution_writable
+func CreateCourse(ctx context.Context, id, class uint64, req dto.NewCourseRequest) (ans *dto.Course, err error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+	defer tx.Rollback()
+
+	c, err := findClass(ctx, tx, id, class)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		err = &util.ErrNotFound
+		return
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	var subjectOk bool
+	if err = tx.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM subjects WHERE id = $1 AND level = $2);", req.Subject, c.Level).Scan(&subjectOk); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if !subjectOk {
+		err = &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: "The subject is not taught in the class's level",
+		}
+		return
+	}
+
+	if req.Teacher != nil {
+		if err = assertInstitutionRole(ctx, id, *req.Teacher, dto.PNTeacher); err != nil {
+			return
+		}
+	}
+
+	var course uint64
+	err = tx.QueryRow(ctx, `
+		INSERT INTO courses(class, subject, teacher)
+		VALUES ($1,$2,$3)
+		ON CONFLICT (class, subject) DO NOTHING
+		RETURNING id;
+	`, class, req.Subject, req.Teacher).Scan(&course)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		err = &errs.Error{
+			Code:    errs.AlreadyExists,
+			Message: "The subject is already taught in this class",
+		}
+		return
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	target := dto.IdentifierString(dto.PTCourse, course)
+	updates := []dto.PermissionUpdate{
+		{Actor: dto.IdentifierString(dto.PTClass, class), Relation: dto.PNOwner, Target: target},
+	}
+	if req.Teacher != nil {
+		updates = append(updates, dto.PermissionUpdate{Actor: dto.IdentifierString(dto.PTUser, *req.Teacher), Relation: dto.PNTeacher, Target: target})
+	}
+	if err = permissions.SetPermissions(ctx, dto.UpdatePermissionsRequest{Updates: updates}); err != nil {
+		rlog.Error(util.MsgCallError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	created, err := findCourse(ctx, tx, id, class, course)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = &coursesToDto(created)[0]
+	return
+}
+
+// Lists the subjects taught in a class
+//
+//encore:api auth method=GET path=/institutions/:id/classes/:class/courses tag:can_view_class
+func FindCourses(ctx context.Context, id, class uint64) (ans *dto.CoursesResponse, err error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM
+			courses co
+			JOIN subjects s ON s.id = co.subject
+			JOIN classes c ON c.id = co.class
+		WHERE
+			co.class = $1 AND c.institution = $2
+		ORDER BY
+			s.name;
+	`, courseFields)
+	courses, err := queryCourses(ctx, query, class, id)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = &dto.CoursesResponse{
+		Courses: coursesToDto(courses...),
+	}
+	return
+}
+
+// Changes the teacher of a course, who enters the scores of its assessments
+//
+//encore:api auth method=PUT path=/institutions/:id/classes/:class/courses/:course/teacher tag:can_update_institution tag:institution_writable
+func SetCourseTeacher(ctx context.Context, id, class, course uint64, req dto.CourseTeacherRequest) (ans *dto.Course, err error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+	defer tx.Rollback()
+
+	current, err := lockCourse(ctx, tx, id, class, course)
+	if err != nil {
+		return
+	}
+
+	if req.Teacher != 0 {
+		if err = assertInstitutionRole(ctx, id, req.Teacher, dto.PNTeacher); err != nil {
+			return
+		}
+	}
+
+	if _, err = tx.Exec(ctx, "UPDATE courses SET teacher = NULLIF($2::BIGINT, 0), updated_at = CURRENT_TIMESTAMP WHERE id = $1;", course, req.Teacher); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if !current.Teacher.Valid || uint64(current.Teacher.Int64) != req.Teacher {
+		target := dto.IdentifierString(dto.PTCourse, course)
+		change := dto.ReplacePermissionsRequest{}
+		if current.Teacher.Valid {
+			change.Deletes = append(change.Deletes, dto.PermissionUpdate{Actor: dto.IdentifierString(dto.PTUser, uint64(current.Teacher.Int64)), Relation: dto.PNTeacher, Target: target})
+		}
+		if req.Teacher != 0 {
+			change.Writes = append(change.Writes, dto.PermissionUpdate{Actor: dto.IdentifierString(dto.PTUser, req.Teacher), Relation: dto.PNTeacher, Target: target})
+		}
+		if len(change.Writes) > 0 || len(change.Deletes) > 0 {
+			if err = permissions.ReplacePermissions(ctx, change); err != nil {
+				rlog.Error(util.MsgCallError, "err", err)
+				err = &util.ErrUnknown
+				return
+			}
+		}
+	}
+
+	updated, err := findCourse(ctx, tx, id, class, course)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = &coursesToDto(updated)[0]
+	return
+}
+
+// Stops teaching a subject in a class. Courses which have assessments are kept for their scores.
+//
+//encore:api auth method=DELETE path=/institutions/:id/classes/:class/courses/:course tag:can_update_institution tag:institution_writable
+func DeleteCourse(ctx context.Context, id, class, course uint64) (err error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return &util.ErrUnknown
+	}
+	defer tx.Rollback()
+
+	if _, err = lockCourse(ctx, tx, id, class, course); err != nil {
+		return
+	}
+
+	var assessed bool
+	if err = tx.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM assessments WHERE course = $1);", course).Scan(&assessed); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return &util.ErrUnknown
+	}
+
+	if assessed {
+		return &errs.Error{
+			Code:    errs.FailedPrecondition,
+			Message: "Courses which have assessments cannot be deleted",
+		}
+	}
+
+	if _, err = tx.Exec(ctx, "DELETE FROM courses WHERE id = $1;", course); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return &util.ErrUnknown
+	}
+
+	if _, err = permissions.PurgeObjectTuples(ctx, dto.PurgeObjectTuplesRequest{
+		Objects: []string{dto.IdentifierString(dto.PTCourse, course)},
+	}); err != nil {
+		rlog.Error(util.MsgCallError, "err", err)
+		return &util.ErrUnknown
+	}
+
+	if err = tx.Commit(); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return &util.ErrUnknown
+	}
+	return
+}
+
+// Creates an assessment of a course for a term of the class's academic year
+//
+//encore:api auth method=POST path=/institutions/:id/classes/:class/courses/:course/assessments tag:can_grade_course tag:institution_writable
+func CreateAssessment(ctx context.Context, id, class, course uint64, req dto.NewAssessmentRequest) (ans *dto.Assessment, err error) {
+	uid, _ := auth.UserID()
+	createdBy, _ := strconv.ParseUint(string(uid), 10, 64)
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err = lockCourse(ctx, tx, id, class, course); err != nil {
+		return
+	}
+
+	if err = assertClassTerm(ctx, tx, class, req.AcademicTerm); err != nil {
+		return
+	}
+
+	kind := dto.AKTest
+	if req.Kind != nil {
+		kind = *req.Kind
+	}
+	weight := 1.0
+	if req.Weight != nil {
+		weight = *req.Weight
+	}
+
+	query := fmt.Sprintf(`
+		INSERT INTO assessments AS a(course, academic_term, title, kind, max_score, weight, held_on, created_by)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8)
+		RETURNING %s;
+	`, assessmentFields)
+	assessment, err := scanAssessment(tx.QueryRow(ctx, query, course, req.AcademicTerm, req.Title, kind, req.MaxScore, weight, req.HeldOn, createdBy))
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = &assessmentsToDto(assessment)[0]
+	return
+}
+
+// Lists the assessments of a course, optionally narrowed down to a term
+//
+//encore:api auth method=GET path=/institutions/:id/classes/:class/courses/:course/assessments tag:can_view_course
+func FindAssessments(ctx context.Context, id, class, course uint64, req dto.FindAssessmentsRequest) (ans *dto.AssessmentsResponse, err error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM
+			assessments a
+			JOIN courses co ON co.id = a.course
+			JOIN classes c ON c.id = co.class
+		WHERE
+			a.course = $1 AND co.class = $2 AND c.institution = $3 AND ($4 = 0 OR a.academic_term = $4)
+		ORDER BY
+			a.held_on NULLS LAST, a.id;
+	`, assessmentFields)
+	assessments, err := queryAssessments(ctx, query, course, class, id, req.AcademicTerm)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = &dto.AssessmentsResponse{
+		Assessments: assessmentsToDto(assessments...),
+	}
+	return
+}
+
+// Updates an assessment
+//
+//encore:api auth method=PATCH path=/institutions/:id/classes/:class/courses/:course/assessments/:assessment tag:can_grade_course tag:institution_writable
+func UpdateAssessment(ctx context.Context, id, class, course, assessment uint64, req dto.UpdateAssessmentRequest) (ans *dto.Assessment, err error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err = lockAssessment(ctx, tx, id, class, course, assessment); err != nil {
+		return
+	}
+
+	if req.MaxScore != nil {
+		var highest float64
+		if err = tx.QueryRow(ctx, "SELECT COALESCE(MAX(score), 0) FROM assessment_scores WHERE assessment = $1;", assessment).Scan(&highest); err != nil {
+			rlog.Error(util.MsgDbAccessError, "err", err)
+			err = &util.ErrUnknown
+			return
+		}
+
+		if *req.MaxScore < highest {
+			err = &errs.Error{
+				Code:    errs.FailedPrecondition,
+				Message: fmt.Sprintf("A score of %v has already been recorded", highest),
+			}
+			return
+		}
+	}
+
+	query := fmt.Sprintf(`
+		UPDATE assessments a SET
+			title = COALESCE($2, title),
+			kind = COALESCE($3, kind),
+			max_score = COALESCE($4, max_score),
+			weight = COALESCE($5, weight),
+			held_on = COALESCE($6, held_on),
+			updated_at = CURRENT_TIMESTAMP
+		WHERE
+			a.id = $1
+		RETURNING %s;
+	`, assessmentFields)
+	updated, err := scanAssessment(tx.QueryRow(ctx, query, assessment, req.Title, req.Kind, req.MaxScore, req.Weight, req.HeldOn))
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = &assessmentsToDto(updated)[0]
+	return
+}
+
+// Deletes an assessment along with its scores
+//
+//encore:api auth method=DELETE path=/institutions/:id/classes/:class/courses/:course/assessments/:assessment tag:can_grade_course tag:institution_writable
+func DeleteAssessment(ctx context.Context, id, class, course, assessment uint64) error {
+	res, err := db.Exec(ctx, `
+		DELETE FROM assessments a
+		USING
+			courses co
+			JOIN classes c ON c.id = co.class
+		WHERE
+			co.id = a.course AND a.id = $1 AND a.course = $2 AND co.class = $3 AND c.institution = $4;
+	`, assessment, course, class, id)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return &util.ErrUnknown
+	}
+
+	if res.RowsAffected() == 0 {
+		return &util.ErrNotFound
+	}
+	return nil
+}
+
+// Records the scores of students of the class for an assessment
+//
+//encore:api auth method=PUT path=/institutions/:id/classes/:class/courses/:course/assessments/:assessment/scores tag:can_grade_course tag:institution_writable
+func RecordScores(ctx context.Context, id, class, course, assessment uint64, req dto.RecordScoresRequest) (ans *dto.ScoresResponse, err error) {
+	uid, _ := auth.UserID()
+	recordedBy, _ := strconv.ParseUint(string(uid), 10, 64)
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+	defer tx.Rollback()
+
+	a, err := lockAssessment(ctx, tx, id, class, course, assessment)
+	if err != nil {
+		return
+	}
+
+	msgs := make([]string, 0)
+	students := make([]int64, 0, len(req.Scores))
+	for i, s := range req.Scores {
+		if s.Score != nil && *s.Score > a.MaxScore {
+			msgs = append(msgs, fmt.Sprintf("The score field of score %d cannot be greater than %v", i+1, a.MaxScore))
+		}
+		students = append(students, int64(s.Student))
+	}
+
+	placed, err := findPlacedStudents(ctx, tx, class, students)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	for i, s := range req.Scores {
+		if !placed[s.Student] {
+			msgs = append(msgs, fmt.Sprintf("The student of score %d is not in the class", i+1))
+		}
+	}
+
+	if len(msgs) > 0 {
+		err = &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: strings.Join(msgs, "\n"),
+		}
+		return
+	}
+
+	for _, s := range req.Scores {
+		if s.Score == nil && !s.Absent {
+			_, err = tx.Exec(ctx, "DELETE FROM assessment_scores WHERE assessment = $1 AND student = $2;", assessment, s.Student)
+		} else {
+			_, err = tx.Exec(ctx, `
+				INSERT INTO assessment_scores(assessment, student, score, absent, comment, recorded_by)
+				VALUES ($1,$2,$3,$4,$5,$6)
+				ON CONFLICT (assessment, student) DO UPDATE SET
+					score = EXCLUDED.score,
+					absent = EXCLUDED.absent,
+					comment = EXCLUDED.comment,
+					recorded_by = EXCLUDED.recorded_by,
+					recorded_at = CURRENT_TIMESTAMP;
+			`, assessment, s.Student, s.Score, s.Absent, s.Comment, recordedBy)
+		}
+		if err != nil {
+			rlog.Error(util.MsgDbAccessError, "err", err)
+			err = &util.ErrUnknown
+			return
+		}
+	}
+
+	scores, err := queryScores(ctx, tx, assessment)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = &dto.ScoresResponse{
+		Scores: scoresToDto(scores...),
+	}
+	return
+}
+
+// Lists the scores recorded for an assessment
+//
+//encore:api auth method=GET path=/institutions/:id/classes/:class/courses/:course/assessments/:assessment/scores tag:can_view_course
+func FindScores(ctx context.Context, id, class, course, assessment uint64) (ans *dto.ScoresResponse, err error) {
+	var exists bool
+	if err = db.QueryRow(ctx, `
+		SELECT EXISTS(
+			SELECT 1
+			FROM
+				assessments a
+				JOIN courses co ON co.id = a.course
+				JOIN classes c ON c.id = co.class
+			WHERE
+				a.id = $1 AND a.course = $2 AND co.class = $3 AND c.institution = $4
+		);
+	`, assessment, course, class, id).Scan(&exists); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if !exists {
+		err = &util.ErrNotFound
+		return
+	}
+
+	scores, err := queryScores(ctx, nil, assessment)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = &dto.ScoresResponse{
+		Scores: scoresToDto(scores...),
+	}
+	return
+}
+
+// Private section
+
+// Ensures an academic term is part of the academic year of a class, within the transaction when one is given
+func assertClassTerm(ctx context.Context, tx *sqldb.Tx, class, term uint64) error {
+	query := "SELECT EXISTS(SELECT 1 FROM academic_terms t JOIN classes c ON c.academic_year = t.year_id WHERE t.id = $1 AND c.id = $2);"
+	var row *sqldb.Row
+	if tx != nil {
+		row = tx.QueryRow(ctx, query, term, class)
+	} else {
+		row = db.QueryRow(ctx, query, term, class)
+	}
+
+	var ok bool
+	if err := row.Scan(&ok); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return &util.ErrUnknown
+	}
+
+	if !ok {
+		return &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: "The academic term is not part of the class's academic year",
+		}
+	}
+	return nil
+}
+
+// Finds which of the given student records are currently placed in a class
+func findPlacedStudents(ctx context.Context, tx *sqldb.Tx, class uint64, students []int64) (ans map[uint64]bool, err error) {
+	rows, err := tx.Query(ctx, `
+		SELECT
+			s.id
+		FROM
+			students s
+			JOIN classes c ON c.institution = s.institution
+		WHERE
+			c.id = $1 AND s.id = ANY($2)
+			AND EXISTS(SELECT 1 FROM class_placements p WHERE p.class = c.id AND p.student = s.id AND p.removed_at IS NULL);
+	`, class, pq.Array(students))
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	ans = make(map[uint64]bool)
+	for rows.Next() {
+		var student uint64
+		if err = rows.Scan(&student); err != nil {
+			return
+		}
+		ans[student] = true
+	}
+	err = rows.Err()
+	return
+}
+
+const courseFields = "co.id,co.class,co.subject,s.name,s.coefficient,co.teacher,co.created_at,co.updated_at"
+
+// Finds a course of a class of an institution, within the transaction when one is given
+func findCourse(ctx context.Context, tx *sqldb.Tx, institution, class, course uint64) (*models.Course, error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM
+			courses co
+			JOIN subjects s ON s.id = co.subject
+			JOIN classes c ON c.id = co.class
+		WHERE
+			co.id = $1 AND co.class = $2 AND c.institution = $3;
+	`, courseFields)
+	if tx != nil {
+		return scanCourse(tx.QueryRow(ctx, query, course, class, institution))
+	}
+	return scanCourse(db.QueryRow(ctx, query, course, class, institution))
+}
+
+// Locks a course of a class of an institution for an update
+func lockCourse(ctx context.Context, tx *sqldb.Tx, institution, class, course uint64) (*models.Course, error) {
+	if _, err := tx.Exec(ctx, "SELECT 1 FROM courses WHERE id = $1 FOR UPDATE;", course); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return nil, &util.ErrUnknown
+	}
+
+	c, err := findCourse(ctx, tx, institution, class, course)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		return nil, &util.ErrNotFound
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return nil, &util.ErrUnknown
+	}
+	return c, nil
+}
+
+func queryCourses(ctx context.Context, query string, args ...any) (ans []*models.Course, err error) {
+	rows, err := db.Query(ctx, query, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c *models.Course
+		if c, err = scanCourse(rows); err != nil {
+			return
+		}
+		ans = append(ans, c)
+	}
+	err = rows.Err()
+	return
+}
+
+func scanCourse(row rowScanner) (*models.Course, error) {
+	c := new(models.Course)
+	if err := row.Scan(&c.Id, &c.Class, &c.Subject, &c.SubjectName, &c.Coefficient, &c.Teacher, &c.CreatedAt, &c.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func coursesToDto(courses ...*models.Course) (ans []dto.Course) {
+	ans = make([]dto.Course, 0, len(courses))
+	for _, c := range courses {
+		v := dto.Course{
+			Id:          c.Id,
+			Class:       c.Class,
+			Subject:     c.Subject,
+			SubjectName: c.SubjectName,
+			Coefficient: c.Coefficient,
+			CreatedAt:   c.CreatedAt,
+			UpdatedAt:   c.UpdatedAt,
+		}
+		if c.Teacher.Valid {
+			teacher := uint64(c.Teacher.Int64)
+			v.Teacher = &teacher
+		}
+		ans = append(ans, v)
+	}
+	return
+}
+
+const assessmentFields = "a.id,a.course,a.academic_term,a.title,a.kind,a.max_score,a.weight,a.held_on,(SELECT COUNT(*) FROM assessment_scores sc WHERE sc.assessment = a.id),a.created_by,a.created_at,a.updated_at"
+
+// Locks an assessment of a course for an update
+func lockAssessment(ctx context.Context, tx *sqldb.Tx, institution, class, course, assessment uint64) (*models.Assessment, error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM
+			assessments a
+			JOIN courses co ON co.id = a.course
+			JOIN classes c ON c.id = co.class
+		WHERE
+			a.id = $1 AND a.course = $2 AND co.class = $3 AND c.institution = $4
+		FOR UPDATE OF a;
+	`, assessmentFields)
+	a, err := scanAssessment(tx.QueryRow(ctx, query, assessment, course, class, institution))
+	if errors.Is(err, sqldb.ErrNoRows) {
+		return nil, &util.ErrNotFound
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return nil, &util.ErrUnknown
+	}
+	return a, nil
+}
+
+func queryAssessments(ctx context.Context, query string, args ...any) (ans []*models.Assessment, err error) {
+	rows, err := db.Query(ctx, query, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var a *models.Assessment
+		if a, err = scanAssessment(rows); err != nil {
+			return
+		}
+		ans = append(ans, a)
+	}
+	err = rows.Err()
+	return
+}
+
+func scanAssessment(row rowScanner) (*models.Assessment, error) {
+	a := new(models.Assessment)
+	if err := row.Scan(&a.Id, &a.Course, &a.AcademicTerm, &a.Title, &a.Kind, &a.MaxScore, &a.Weight, &a.HeldOn, &a.Scores, &a.CreatedBy, &a.CreatedAt, &a.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func assessmentsToDto(assessments ...*models.Assessment) (ans []dto.Assessment) {
+	ans = make([]dto.Assessment, 0, len(assessments))
+	for _, a := range assessments {
+		v := dto.Assessment{
+			Id:           a.Id,
+			Course:       a.Course,
+			AcademicTerm: a.AcademicTerm,
+			Title:        a.Title,
+			Kind:         dto.AssessmentKind(a.Kind),
+			MaxScore:     a.MaxScore,
+			Weight:       a.Weight,
+			Scores:       a.Scores,
+			CreatedBy:    a.CreatedBy,
+			CreatedAt:    a.CreatedAt,
+			UpdatedAt:    a.UpdatedAt,
+		}
+		if a.HeldOn.Valid {
+			v.HeldOn = &a.HeldOn.Time
+		}
+		ans = append(ans, v)
+	}
+	return
+}
+
+const scoreFields = "sc.assessment,sc.student,sc.score,sc.absent,sc.comment,sc.recorded_by,sc.recorded_at"
+
+// Lists the scores of an assessment, within the transaction when one is given
+func queryScores(ctx context.Context, tx *sqldb.Tx, assessment uint64) (ans []*models.AssessmentScore, err error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM
+			assessment_scores sc
+			JOIN students s ON s.id = sc.student
+		WHERE
+			sc.assessment = $1
+		ORDER BY
+			s.last_name, s.first_name;
+	`, scoreFields)
+	var rows *sqldb.Rows
+	if tx != nil {
+		rows, err = tx.Query(ctx, query, assessment)
+	} else {
+		rows, err = db.Query(ctx, query, assessment)
+	}
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		s := new(models.AssessmentScore)
+		if err = rows.Scan(&s.Assessment, &s.Student, &s.Score, &s.Absent, &s.Comment, &s.RecordedBy, &s.RecordedAt); err != nil {
+			return
+		}
+		ans = append(ans, s)
+	}
+	err = rows.Err()
+	return
+}
+
+func scoresToDto(scores ...*models.AssessmentScore) (ans []dto.Score) {
+	ans = make([]dto.Score, 0, len(scores))
+	for _, s := range scores {
+		v := dto.Score{
+			Assessment: s.Assessment,
+			Student:    s.Student,
+			Absent:     s.Absent,
+			RecordedBy: s.RecordedBy,
+			RecordedAt: s.RecordedAt,
+		}
+		if s.Score.Valid {
+			v.Score = &s.Score.Float64
+		}
+		if s.Comment.Valid {
+			v.Comment = &s.Comment.String
+		}
+		ans = append(ans, v)
+	}
+	return
+}
@@ -3,7 +3,25 @@ package institutions
 import "encore.dev/cron"
 
 var _ = cron.NewJob("academic-year-creation", cron.JobConfig{
-	Title:    "Create Academic Years",
-	Schedule: "0 0 * * *", // ! Every midnight
+	Title:    "Create due academic years",
+	Schedule: "0 * * * *", // ! Every hour
 	Endpoint: AutoCreateAcademicYears,
 })
+
+var _ = cron.NewJob("backfill-students", cron.JobConfig{
+	Title:    "Create the records of legacy students from the authorization store",
+	Schedule: "*/10 * * * *", // ! Every 10 minutes
+	Endpoint: BackfillStudents,
+})
+
+var _ = cron.NewJob("expire-report-card-jobs", cron.JobConfig{
+	Title:    "Fail report card jobs which stopped making progress",
+	Schedule: "*/15 * * * *", // ! Every 15 minutes
+	Endpoint: ExpireReportCardJobs,
+})
+
+var _ = cron.NewJob("notify-absence-alerts", cron.JobConfig{
+	Title:    "Notify the guardians of absence alerts which were missed",
+	Schedule: "*/15 * * * *", // ! Every 15 minutes
+	Endpoint: NotifyPendingAbsenceAlerts,
+})
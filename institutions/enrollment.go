@@ -2,11 +2,13 @@ package institutions
 
 import (
 	"context"
+	"errors"
 	"strconv"
 	"strings"
 	"time"
 
 	"encore.dev/beta/auth"
+	"encore.dev/beta/errs"
 	"encore.dev/rlog"
 	"encore.dev/storage/sqldb"
 	"github.com/brinestone/scholaris/dto"
@@ -18,7 +20,7 @@ import (
 
 // Creates an enrollment
 //
-//encore:api auth method=POST path=/institutions/enroll tag:can_enroll
+//encore:api auth method=POST path=/institutions/enroll tag:can_enroll tag:institution_writable
 func NewEnrollment(ctx context.Context, req dto.NewEnrollmentRequest) (err error) {
 	userId, _ := auth.UserID()
 	uid, _ := strconv.ParseUint(string(userId), 10, 64)
@@ -30,10 +32,16 @@ func NewEnrollment(ctx context.Context, req dto.NewEnrollmentRequest) (err error
 		return
 	}
 
+	if err = assertLevelOpen(ctx, tx, req.GetOwner(), req.GetLevelRef()); err != nil {
+		tx.Rollback()
+		return
+	}
+
 	formInfo, _ := findLevelEnrollmentForm(ctx, req.GetLevelRef(), req.GetOwner())
 
 	res, err := forms.CreateFormResponseInternal(ctx, formInfo.Id)
 	if err != nil {
+		tx.Rollback()
 		return
 	}
 
@@ -43,14 +51,31 @@ func NewEnrollment(ctx context.Context, req dto.NewEnrollmentRequest) (err error
 		err = &util.ErrUnknown
 		return
 	}
-	tx.Commit()
 
+	if err = tx.Commit(); err != nil {
+		rlog.Error(util.MsgDbAccessError, "msg", err.Error())
+		err = &util.ErrUnknown
+	}
 	return
 }
 
+// Accepts a pending enrollment. The student record of the enrollment is created in the background.
+//
+//encore:api auth method=POST path=/institutions/:id/enrollments/:enrollment/accept tag:can_manage_students tag:institution_writable
+func AcceptEnrollment(ctx context.Context, id, enrollment uint64, req dto.EnrollmentDecisionRequest) (*dto.Enrollment, error) {
+	return decideEnrollment(ctx, id, enrollment, dto.ESAccepted, req.Reason)
+}
+
+// Rejects a pending enrollment
+//
+//encore:api auth method=POST path=/institutions/:id/enrollments/:enrollment/reject tag:can_manage_students tag:institution_writable
+func RejectEnrollment(ctx context.Context, id, enrollment uint64, req dto.EnrollmentRejectionRequest) (*dto.Enrollment, error) {
+	return decideEnrollment(ctx, id, enrollment, dto.ESRejected, &req.Reason)
+}
+
 // Creates an enrollment form
 //
-//encore:api auth method=POST path=/institutions/enrollment-forms tag:can_create_enrollment_form tag:needs_captcha_ver
+//encore:api auth method=POST path=/institutions/enrollment-forms tag:can_create_enrollment_form tag:institution_writable tag:needs_captcha_ver
 func NewEnrollmentForm(ctx context.Context, req dto.NewEnrollmentFormRequest) (err error) {
 	settings, err := settings.FindSettings(ctx, dto.GetSettingsRequest{
 		Owner:     req.GetOwner(),
@@ -109,6 +134,68 @@ func NewEnrollmentForm(ctx context.Context, req dto.NewEnrollmentFormRequest) (e
 	return
 }
 
+// Records the decision on a pending enrollment, announcing the enrollments which are accepted
+func decideEnrollment(ctx context.Context, institution, enrollment uint64, status dto.EnrollmentStatus, reason *string) (ans *dto.Enrollment, err error) {
+	uid, _ := auth.UserID()
+	decidedBy, _ := strconv.ParseUint(string(uid), 10, 64)
+
+	var e models.Enrollment
+	err = db.QueryRow(ctx, `
+		UPDATE enrollments SET
+			status = $3,
+			decided_by = $4,
+			decision_reason = $5,
+			decided_at = CURRENT_TIMESTAMP,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE
+			id = $1 AND institution = $2 AND status = $6
+		RETURNING id, responder, institution, status, decided_by, decision_reason, decided_at, created_at, updated_at;
+	`, enrollment, institution, status, decidedBy, reason, dto.ESPending).Scan(&e.Id, &e.Owner, &e.Destination, &e.Status, &e.Approver, &e.DecisionReason, &e.ApprovedAt, &e.CreatedAt, &e.UpdatedAt)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		err = &errs.Error{
+			Code:    errs.NotFound,
+			Message: "No pending enrollment was found",
+		}
+		return
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if status == dto.ESAccepted {
+		if _, err := AcceptedEnrollments.Publish(ctx, &EnrollmentAccepted{
+			Id:          e.Id,
+			Institution: e.Destination,
+			Responder:   e.Owner,
+			AcceptedBy:  uid,
+			Timestamp:   time.Now(),
+		}); err != nil {
+			rlog.Error("could not publish enrollment acceptance", "enrollment", e.Id, "err", err)
+		}
+	}
+
+	ans = &dto.Enrollment{
+		Id:          e.Id,
+		Institution: e.Destination,
+		Responder:   e.Owner,
+		Status:      dto.EnrollmentStatus(e.Status),
+		CreatedAt:   e.CreatedAt,
+		UpdatedAt:   e.UpdatedAt,
+	}
+	if e.Approver.Valid {
+		approver := uint64(e.Approver.Int64)
+		ans.DecidedBy = &approver
+	}
+	if e.DecisionReason.Valid {
+		ans.DecisionReason = &e.DecisionReason.String
+	}
+	if e.ApprovedAt.Valid {
+		ans.DecidedAt = &e.ApprovedAt.Time
+	}
+	return
+}
+
 func registerEnrollmentForm(ctx context.Context, tx *sqldb.Tx, form, institution uint64) (err error) {
 	query := `
 		INSERT INTO
@@ -145,7 +232,7 @@ func createEnrollment(ctx context.Context, tx *sqldb.Tx, response, form, user, i
 		INSERT INTO
 			enrollments(id,form,institution,responder)
 		VALUES
-			($1,$2,$3);
+			($1,$2,$3,$4);
 	`
 
 	_, err = tx.Exec(ctx, query, response, form, institution, user)
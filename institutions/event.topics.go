@@ -26,3 +26,87 @@ var NewInstitutions = pubsub.NewTopic[*InstitutionCreated]("institution-created"
 var PublishedEnrollments = pubsub.NewTopic[*EnrollmentPublished]("enrollment-published", pubsub.TopicConfig{
 	DeliveryGuarantee: pubsub.AtLeastOnce,
 })
+
+// Published whenever a verification request is decided or an institution's verification is revoked
+type InstitutionVerificationChanged struct {
+	Institution uint64
+	// The verification request concerned, 0 when revoking a verification which predates requests
+	Request   uint64
+	Status    string
+	Reason    *string
+	ChangedBy auth.UID
+	Timestamp time.Time
+}
+
+var VerificationChanges = pubsub.NewTopic[*InstitutionVerificationChanged]("institution-verification-changed", pubsub.TopicConfig{
+	DeliveryGuarantee: pubsub.AtLeastOnce,
+})
+
+// Published whenever the terms of an academic year change or the year is deleted, so that the schedules depending on
+// them can adjust
+type AcademicYearChanged struct {
+	Institution uint64
+	Year        uint64
+	// The term concerned, 0 when the change concerns the whole year
+	Term   uint64
+	Change string
+	// The span of the year after the change, zero when the year was deleted
+	StartDate time.Time
+	EndDate   time.Time
+	ChangedBy auth.UID
+	Timestamp time.Time
+}
+
+var AcademicYearChanges = pubsub.NewTopic[*AcademicYearChanged]("academic-year-changed", pubsub.TopicConfig{
+	DeliveryGuarantee: pubsub.AtLeastOnce,
+})
+
+// Published when the automatic creation of an institution's academic year fails because of its settings
+type AcademicYearCreationFailed struct {
+	Institution uint64
+	Run         uint64
+	Reason      string
+	Timestamp   time.Time
+}
+
+var AcademicYearCreationFailures = pubsub.NewTopic[*AcademicYearCreationFailed]("academic-year-creation-failed", pubsub.TopicConfig{
+	DeliveryGuarantee: pubsub.AtLeastOnce,
+})
+
+// Published when an enrollment is accepted, so that a student record can be created for it
+type EnrollmentAccepted struct {
+	Id          uint64
+	Institution uint64
+	// The user who responded to the enrollment form
+	Responder  uint64
+	AcceptedBy auth.UID
+	Timestamp  time.Time
+}
+
+var AcceptedEnrollments = pubsub.NewTopic[*EnrollmentAccepted]("enrollment-accepted", pubsub.TopicConfig{
+	DeliveryGuarantee: pubsub.AtLeastOnce,
+})
+
+// Published when the report cards of a class are requested, so that they are generated in the background
+type ReportCardJobRequested struct {
+	Job         uint64
+	Institution uint64
+	Timestamp   time.Time
+}
+
+var RequestedReportCardJobs = pubsub.NewTopic[*ReportCardJobRequested]("report-card-job-requested", pubsub.TopicConfig{
+	DeliveryGuarantee: pubsub.AtLeastOnce,
+})
+
+// Published when a student reaches an absence threshold of their institution in a term, so that their guardians are
+// notified
+type AbsenceThresholdReached struct {
+	Alert       uint64
+	Institution uint64
+	Student     uint64
+	Timestamp   time.Time
+}
+
+var ReachedAbsenceThresholds = pubsub.NewTopic[*AbsenceThresholdReached]("absence-threshold-reached", pubsub.TopicConfig{
+	DeliveryGuarantee: pubsub.AtLeastOnce,
+})
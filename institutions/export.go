@@ -0,0 +1,116 @@
+package institutions
+
+import (
+	"context"
+
+	"encore.dev/beta/errs"
+	"encore.dev/rlog"
+	"encore.dev/storage/sqldb"
+	"github.com/brinestone/scholaris/blob"
+	"github.com/brinestone/scholaris/dto"
+	"github.com/brinestone/scholaris/forms"
+	"github.com/brinestone/scholaris/helpers"
+	"github.com/brinestone/scholaris/settings"
+	"github.com/brinestone/scholaris/util"
+	"github.com/lib/pq"
+)
+
+// Exports the institutions of the given tenants along with everything they own, in this and the other services
+//
+//encore:api private method=POST path=/institutions/owned/export
+func ExportOwnedInstitutions(ctx context.Context, req dto.ExportOwnedRequest) (ans *dto.ExportResponse, err error) {
+	if req.OwnerType != dto.PTTenant {
+		err = &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: "Institutions can only be owned by tenants",
+		}
+		return
+	}
+
+	ans, err = exportTenantInstitutions(ctx, req)
+	if err != nil {
+		rlog.Error("could not export institutions", "tenants", req.Owners, "err", err)
+		ans, err = nil, &util.ErrUnknown
+	}
+	return
+}
+
+func exportTenantInstitutions(ctx context.Context, req dto.ExportOwnedRequest) (ans *dto.ExportResponse, err error) {
+	ans = new(dto.ExportResponse)
+	queries := []struct{ path, query string }{
+		{"institutions.json", "SELECT i.id, i.name, i.description, i.logo, i.visible, i.slug, i.tenant, i.created_at, i.updated_at, i.verified, i.archived_at FROM institutions i WHERE i.tenant = ANY($1) ORDER BY i.id"},
+		{"academic-years.json", "SELECT y.id, y.institution, y.duration, y.start_offset, y.created_at, y.updated_at FROM academic_years y JOIN institutions i ON i.id = y.institution WHERE i.tenant = ANY($1) ORDER BY y.id"},
+		{"academic-terms.json", "SELECT t.id, t.year_id, t.institution, t.label, t.created_at, t.updated_at, t.duration, t.start_offset FROM academic_terms t JOIN institutions i ON i.id = t.institution WHERE i.tenant = ANY($1) ORDER BY t.id"},
+		{"levels.json", "SELECT l.id, l.institution, l.name, l.code, l.description, l.position, l.capacity, l.prerequisite, l.archived_at, l.created_at, l.updated_at, l.grading_scale FROM levels l JOIN institutions i ON i.id = l.institution WHERE i.tenant = ANY($1) ORDER BY l.id"},
+		{"enrollment-forms.json", "SELECT ef.form, ef.institution, ef.level FROM enrollment_forms ef JOIN institutions i ON i.id = ef.institution WHERE i.tenant = ANY($1)"},
+		{"enrollments.json", "SELECT e.id, e.form, e.institution, e.responder, e.created_at, e.updated_at, e.status, e.decided_by, e.decision_reason, e.decided_at FROM enrollments e JOIN institutions i ON i.id = e.institution WHERE i.tenant = ANY($1) ORDER BY e.id"},
+		{"verification-requests.json", "SELECT v.id, v.institution, v.submitted_by, v.documents, v.notes, v.status, v.reviewed_by, v.review_reason, v.reviewed_at, v.revoked_by, v.revoke_reason, v.revoked_at, v.created_at FROM verification_requests v JOIN institutions i ON i.id = v.institution WHERE i.tenant = ANY($1) ORDER BY v.id"},
+		{"classes.json", "SELECT c.id, c.institution, c.level, c.academic_year, c.name, c.stream, c.capacity, c.homeroom_teacher, c.created_at, c.updated_at FROM classes c JOIN institutions i ON i.id = c.institution WHERE i.tenant = ANY($1) ORDER BY c.id"},
+		{"class-placements.json", "SELECT p.id, p.class, p.academic_year, p.student, p.placed_by, p.placed_at, p.removed_at, p.removed_by, p.removal_reason, p.removal_note, p.transferred_to FROM class_placements p JOIN classes c ON c.id = p.class JOIN institutions i ON i.id = c.institution WHERE i.tenant = ANY($1) ORDER BY p.id"},
+		{"students.json", "SELECT s.id, s.institution, s.matricule, s.enrollment, s.user_account, s.first_name, s.last_name, s.gender, s.date_of_birth, s.place_of_birth, s.nationality, s.address, s.phone, s.email, s.status, s.created_by, s.created_at, s.updated_at FROM students s JOIN institutions i ON i.id = s.institution WHERE i.tenant = ANY($1) ORDER BY s.id"},
+		{"student-status-changes.json", "SELECT h.id, h.student, h.status, h.previous_status, h.reason, h.changed_by, h.changed_at FROM student_status_changes h JOIN students s ON s.id = h.student JOIN institutions i ON i.id = s.institution WHERE i.tenant = ANY($1) ORDER BY h.id"},
+		{"student-guardians.json", "SELECT g.id, g.student, g.name, g.relationship, g.phone, g.email, g.address, g.is_primary, g.created_at, g.updated_at, g.user_account, g.linked_at FROM student_guardians g JOIN students s ON s.id = g.student JOIN institutions i ON i.id = s.institution WHERE i.tenant = ANY($1) ORDER BY g.id"},
+		{"guardian-invitations.json", "SELECT v.id, v.guardian, v.email, v.invited_by, v.expires_at, v.created_at, v.accepted_at, v.accepted_by, v.revoked_at FROM guardian_invitations v JOIN student_guardians g ON g.id = v.guardian JOIN students s ON s.id = g.student JOIN institutions i ON i.id = s.institution WHERE i.tenant = ANY($1) ORDER BY v.id"},
+		{"student-medical-notes.json", "SELECT n.id, n.student, n.category, n.note, n.recorded_by, n.recorded_at FROM student_medical_notes n JOIN students s ON s.id = n.student JOIN institutions i ON i.id = s.institution WHERE i.tenant = ANY($1) ORDER BY n.id"},
+		{"grading-scales.json", "SELECT g.id, g.institution, g.name, g.min_score, g.max_score, g.passing_score, g.decimals, g.created_at, g.updated_at FROM grading_scales g JOIN institutions i ON i.id = g.institution WHERE i.tenant = ANY($1) ORDER BY g.id"},
+		{"subjects.json", "SELECT s.id, s.institution, s.level, s.name, s.code, s.coefficient, s.created_at, s.updated_at, s.weekly_periods FROM subjects s JOIN institutions i ON i.id = s.institution WHERE i.tenant = ANY($1) ORDER BY s.id"},
+		{"courses.json", "SELECT co.id, co.class, co.subject, co.teacher, co.created_at, co.updated_at FROM courses co JOIN classes c ON c.id = co.class JOIN institutions i ON i.id = c.institution WHERE i.tenant = ANY($1) ORDER BY co.id"},
+		{"assessments.json", "SELECT a.id, a.course, a.academic_term, a.title, a.kind, a.max_score, a.weight, a.held_on, a.created_by, a.created_at, a.updated_at FROM assessments a JOIN courses co ON co.id = a.course JOIN classes c ON c.id = co.class JOIN institutions i ON i.id = c.institution WHERE i.tenant = ANY($1) ORDER BY a.id"},
+		{"assessment-scores.json", "SELECT sc.assessment, sc.student, sc.score, sc.absent, sc.comment, sc.recorded_by, sc.recorded_at FROM assessment_scores sc JOIN assessments a ON a.id = sc.assessment JOIN courses co ON co.id = a.course JOIN classes c ON c.id = co.class JOIN institutions i ON i.id = c.institution WHERE i.tenant = ANY($1) ORDER BY sc.assessment, sc.student"},
+		{"report-card-remarks.json", "SELECT r.id, r.class, r.academic_term, r.student, r.course, r.remark, r.written_by, r.created_at, r.updated_at FROM report_card_remarks r JOIN classes c ON c.id = r.class JOIN institutions i ON i.id = c.institution WHERE i.tenant = ANY($1) ORDER BY r.id"},
+		{"report-card-jobs.json", "SELECT j.id, j.class, j.academic_term, j.students, j.status, j.total, j.generated, j.failed, j.error, j.requested_by, j.created_at, j.started_at, j.completed_at FROM report_card_jobs j JOIN classes c ON c.id = j.class JOIN institutions i ON i.id = c.institution WHERE i.tenant = ANY($1) ORDER BY j.id"},
+		{"report-cards.json", "SELECT rc.id, rc.class, rc.academic_term, rc.student, rc.job, rc.file_key, rc.average, rc.rank, rc.generated_by, rc.generated_at FROM report_cards rc JOIN classes c ON c.id = rc.class JOIN institutions i ON i.id = c.institution WHERE i.tenant = ANY($1) ORDER BY rc.id"},
+		{"attendance-sessions.json", "SELECT a.id, a.class, a.academic_term, a.date, a.period, a.course, a.taken_by, a.created_at, a.updated_at FROM attendance_sessions a JOIN classes c ON c.id = a.class JOIN institutions i ON i.id = c.institution WHERE i.tenant = ANY($1) ORDER BY a.id"},
+		{"attendance-records.json", "SELECT r.session, r.student, r.status, r.note, r.recorded_by, r.recorded_at FROM attendance_records r JOIN attendance_sessions a ON a.id = r.session JOIN classes c ON c.id = a.class JOIN institutions i ON i.id = c.institution WHERE i.tenant = ANY($1) ORDER BY r.session, r.student"},
+		{"attendance-alerts.json", "SELECT al.id, al.student, al.academic_term, al.threshold, al.absences, al.created_at, al.notified_at FROM attendance_alerts al JOIN students s ON s.id = al.student JOIN institutions i ON i.id = s.institution WHERE i.tenant = ANY($1) ORDER BY al.id"},
+		{"rooms.json", "SELECT r.id, r.institution, r.name, r.capacity, r.created_at, r.updated_at FROM rooms r JOIN institutions i ON i.id = r.institution WHERE i.tenant = ANY($1) ORDER BY r.id"},
+		{"timetables.json", "SELECT t.id, t.institution, t.academic_term, t.days, t.created_by, t.created_at, t.updated_at FROM timetables t JOIN institutions i ON i.id = t.institution WHERE i.tenant = ANY($1) ORDER BY t.id"},
+		{"timetable-periods.json", "SELECT p.timetable, p.number, p.label, p.starts_at, p.ends_at FROM timetable_periods p JOIN timetables t ON t.id = p.timetable JOIN institutions i ON i.id = t.institution WHERE i.tenant = ANY($1) ORDER BY p.timetable, p.number"},
+		{"timetable-slots.json", "SELECT s.id, s.timetable, s.class, s.day, s.period, s.course, s.teacher, s.room, s.created_at, s.updated_at FROM timetable_slots s JOIN timetables t ON t.id = s.timetable JOIN institutions i ON i.id = t.institution WHERE i.tenant = ANY($1) ORDER BY s.id"},
+		{"calendar-events.json", "SELECT e.id, e.institution, e.academic_year, e.academic_term, e.title, e.description, e.location, e.category, e.starts_at, e.ends_at, e.all_day, e.recurrence_frequency, e.recurrence_interval, e.recurrence_count, e.recurrence_until, e.audience, e.audience_ref, e.visibility, e.created_by, e.created_at, e.updated_at FROM calendar_events e JOIN institutions i ON i.id = e.institution WHERE i.tenant = ANY($1) ORDER BY e.id"},
+	}
+
+	for _, q := range queries {
+		var rows *sqldb.Rows
+		if rows, err = db.Query(ctx, helpers.JsonRowsQuery(q.query), pq.Array(req.Owners)); err != nil {
+			return
+		}
+		if err = helpers.StageJsonRows(ctx, exportBucket, req.StagingKey(q.path), rows); err != nil {
+			return
+		}
+		ans.Stage(req.StagingKey(q.path), q.path)
+	}
+
+	var ids []uint64
+	for _, tenant := range req.Owners {
+		var tenantIds []uint64
+		if tenantIds, err = findTenantInstitutionIds(ctx, tenant); err != nil {
+			return
+		}
+		ids = append(ids, tenantIds...)
+	}
+	if len(ids) == 0 {
+		return
+	}
+
+	owned := func(dir string) dto.ExportOwnedRequest {
+		return dto.ExportOwnedRequest{OwnerType: dto.PTInstitution, Owners: ids, Prefix: req.StagingKey(dir)}
+	}
+	formsData, err := forms.ExportOwnedForms(ctx, owned("forms"))
+	if err != nil {
+		return
+	}
+	settingsData, err := settings.ExportOwnedSettings(ctx, owned("settings"))
+	if err != nil {
+		return
+	}
+	uploads, err := blob.ExportOwnedUploads(ctx, owned("uploads"))
+	if err != nil {
+		return
+	}
+
+	ans.Include("forms", formsData)
+	ans.Include("settings", settingsData)
+	ans.Include("uploads", uploads)
+	return
+}
@@ -0,0 +1,87 @@
+package institutions
+
+import (
+	"context"
+	"time"
+
+	"github.com/brinestone/scholaris/dto"
+	"github.com/brinestone/scholaris/models"
+)
+
+// EmailInstitutionMaintainers sends a notification to the maintainers of an institution who have not received it yet.
+func EmailInstitutionMaintainers(ctx context.Context, notification string, institution uint64, subject, body string) error {
+	return emailInstitutionMaintainers(ctx, notification, institution, subject, body)
+}
+
+// AssertLevelOpen checks whether a level can be enrolled into.
+func AssertLevelOpen(ctx context.Context, institution, level uint64) error {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	return assertLevelOpen(ctx, tx, institution, level)
+}
+
+// AddLevelEnrollment records an enrollment into a level, through an enrollment form of its own.
+func AddLevelEnrollment(ctx context.Context, institution, level uint64, status dto.EnrollmentStatus, createdAt time.Time) (id uint64, err error) {
+	var form uint64
+	if err = db.QueryRow(ctx, "INSERT INTO enrollment_forms(form, institution, level) SELECT COALESCE(MAX(form), 0) + 1, $1, $2 FROM enrollment_forms RETURNING form;", institution, level).Scan(&form); err != nil {
+		return
+	}
+	err = db.QueryRow(ctx, "INSERT INTO enrollments(id, form, institution, responder, status, created_at) SELECT COALESCE(MAX(id), 0) + 1, $1, $2, 1, $3, $4 FROM enrollments RETURNING id;", form, institution, status, createdAt).Scan(&id)
+	return
+}
+
+// CreateEnrollmentStudent handles the acceptance of an enrollment answered by the user 1.
+func CreateEnrollmentStudent(ctx context.Context, institution, enrollment uint64) error {
+	return createEnrollmentStudent(ctx, &EnrollmentAccepted{Id: enrollment, Institution: institution, Responder: 1, AcceptedBy: "1", Timestamp: time.Now()})
+}
+
+// AwaitStudentBackfill queues an institution for the student record backfill.
+func AwaitStudentBackfill(ctx context.Context, institution uint64) (err error) {
+	_, err = db.Exec(ctx, "UPDATE institutions SET students_backfilled = false WHERE id = $1;", institution)
+	return
+}
+
+// MoveAcademicYear moves an academic year along with its terms.
+func MoveAcademicYear(ctx context.Context, year uint64, by time.Duration) (err error) {
+	if _, err = db.Exec(ctx, "UPDATE academic_years SET created_at = created_at + $2 * INTERVAL '1 second' WHERE id = $1;", year, by.Seconds()); err != nil {
+		return
+	}
+	_, err = db.Exec(ctx, "UPDATE academic_terms SET created_at = created_at + $2 * INTERVAL '1 second' WHERE year_id = $1;", year, by.Seconds())
+	return
+}
+
+// ExpandOccurrences lists the occurrences of an event overlapping a range.
+func ExpandOccurrences(e *models.CalendarEvent, from, to time.Time) []dto.CalendarOccurrence {
+	return expandOccurrences(e, from, to)
+}
+
+// IcsRecurrenceRule renders the RRULE of an event.
+func IcsRecurrenceRule(e *models.CalendarEvent) string {
+	return icsRecurrenceRule(e)
+}
+
+// AgeReportCardJob moves the creation of a report card job back in time.
+func AgeReportCardJob(ctx context.Context, job uint64, by time.Duration) (err error) {
+	_, err = db.Exec(ctx, "UPDATE report_card_jobs SET created_at = created_at - $2 * INTERVAL '1 second' WHERE id = $1;", job, by.Seconds())
+	return
+}
+
+// FindAbsenceThresholds reads the absence notification thresholds of an institution.
+func FindAbsenceThresholds(ctx context.Context, institution uint64) ([]int, error) {
+	return findAbsenceThresholds(ctx, institution)
+}
+
+// AgeAbsenceAlerts moves the creation of the absence alerts of a student back in time.
+func AgeAbsenceAlerts(ctx context.Context, student uint64, by time.Duration) (err error) {
+	_, err = db.Exec(ctx, "UPDATE attendance_alerts SET created_at = created_at - $2 * INTERVAL '1 second' WHERE student = $1;", student, by.Seconds())
+	return
+}
+
+// DeleteAcademicTermRow deletes an academic term directly, bypassing the checks of the API.
+func DeleteAcademicTermRow(ctx context.Context, term uint64) (err error) {
+	_, err = db.Exec(ctx, "DELETE FROM academic_terms WHERE id = $1;", term)
+	return
+}
@@ -0,0 +1,188 @@
+package institutions_test
+
+import (
+	"context"
+	"testing"
+
+	"encore.dev/et"
+	"github.com/brinestone/scholaris/core/permissions"
+	"github.com/brinestone/scholaris/core/users"
+	"github.com/brinestone/scholaris/dto"
+	"github.com/brinestone/scholaris/institutions"
+	"github.com/brinestone/scholaris/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGradebook(t *testing.T) {
+	et.MockEndpoint(users.FindUserById, func(ctx context.Context, id uint64) (*models.User, error) {
+		return &models.User{Id: id}, nil
+	})
+
+	i, err := makeInstitution()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	year, err := makeAcademicYear(i.Id)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	term := year.Terms[0].Id
+
+	level, err := institutions.CreateLevel(mainContext, i.Id, dto.NewLevelRequest{Name: "Form 1"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	class, err := institutions.CreateClass(mainContext, i.Id, dto.NewClassRequest{Level: level.Id, AcademicYear: year.Id, Name: "A"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	four, two := 4.0, 2.0
+	maths, err := institutions.CreateSubject(mainContext, i.Id, level.Id, dto.NewSubjectRequest{Name: "Mathematics", Coefficient: &four})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	english, err := institutions.CreateSubject(mainContext, i.Id, level.Id, dto.NewSubjectRequest{Name: "English", Coefficient: &two})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	mathsCourse, err := institutions.CreateCourse(mainContext, i.Id, class.Id, dto.NewCourseRequest{Subject: maths.Id})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	englishCourse, err := institutions.CreateCourse(mainContext, i.Id, class.Id, dto.NewCourseRequest{Subject: english.Id})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	_, err = institutions.CreateCourse(mainContext, i.Id, class.Id, dto.NewCourseRequest{Subject: maths.Id})
+	assert.NotNil(t, err, "the subject is already taught in the class")
+
+	var students []uint64
+	// Neither record has an account, which placements, scores and results do not depend on.
+	for _, name := range []string{"Jane", "John"} {
+		s, err := institutions.CreateStudent(mainContext, i.Id, dto.NewStudentRequest{FirstName: name, LastName: "Doe"})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if _, err = institutions.PlaceStudent(mainContext, i.Id, class.Id, dto.PlaceStudentRequest{Student: s.Id}); err != nil {
+			t.Error(err)
+			return
+		}
+		students = append(students, s.Id)
+	}
+	jane, john := students[0], students[1]
+
+	test, err := institutions.CreateAssessment(mainContext, i.Id, class.Id, mathsCourse.Id, dto.NewAssessmentRequest{AcademicTerm: term, Title: "Test 1", MaxScore: 20})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	exam, err := institutions.CreateAssessment(mainContext, i.Id, class.Id, mathsCourse.Id, dto.NewAssessmentRequest{AcademicTerm: term, Title: "Exam", MaxScore: 40, Weight: &two})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	essay, err := institutions.CreateAssessment(mainContext, i.Id, class.Id, englishCourse.Id, dto.NewAssessmentRequest{AcademicTerm: term, Title: "Essay", MaxScore: 20})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	tooHigh := 25.0
+	_, err = institutions.RecordScores(mainContext, i.Id, class.Id, mathsCourse.Id, test.Id, dto.RecordScoresRequest{Scores: []dto.ScoreEntry{{Student: jane, Score: &tooHigh}}})
+	assert.NotNil(t, err, "the score is above the maximum")
+
+	score := func(v float64) *float64 { return &v }
+	entries := []struct {
+		course, assessment uint64
+		scores             []dto.ScoreEntry
+	}{
+		{mathsCourse.Id, test.Id, []dto.ScoreEntry{{Student: jane, Score: score(12)}, {Student: john, Score: score(16)}}},
+		{mathsCourse.Id, exam.Id, []dto.ScoreEntry{{Student: jane, Score: score(30)}, {Student: john, Absent: true}}},
+		{englishCourse.Id, essay.Id, []dto.ScoreEntry{{Student: jane, Score: score(14)}, {Student: john, Score: score(14)}}},
+	}
+	for _, e := range entries {
+		if _, err = institutions.RecordScores(mainContext, i.Id, class.Id, e.course, e.assessment, dto.RecordScoresRequest{Scores: e.scores}); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	results, err := institutions.FindClassResults(mainContext, i.Id, class.Id, dto.ClassResultsRequest{AcademicTerm: term})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.True(t, results.Scale.Default)
+	assert.Len(t, results.Results, 2)
+	assert.Equal(t, john, results.Results[0].Student, "absences are left out of the averages")
+	assert.Equal(t, 15.33, *results.Results[0].Average)
+	assert.Equal(t, 14.0, *results.Results[1].Average)
+	assert.Equal(t, 2, *results.Results[1].Rank)
+	assert.Equal(t, 1, *results.Results[1].Subjects[0].Rank, "tied students share their rank")
+
+	mine, err := institutions.FindStudentResults(mainContext, i.Id, jane, dto.StudentResultsRequest{AcademicYear: year.Id})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.Equal(t, uint(2), mine.ClassSize)
+	assert.Equal(t, 2, *mine.Result.Rank)
+}
+
+func TestDeleteInstitutionWithAssessments(t *testing.T) {
+	t.Cleanup(mockEndpoints)
+	et.MockEndpoint(permissions.PurgeObjectTuples, func(ctx context.Context, req dto.PurgeObjectTuplesRequest) (*dto.PurgeResponse, error) {
+		return &dto.PurgeResponse{Deleted: uint(len(req.Objects))}, nil
+	})
+
+	i, err := makeInstitution()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	year, err := makeAcademicYear(i.Id)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	level, err := institutions.CreateLevel(mainContext, i.Id, dto.NewLevelRequest{Name: "Form 1"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	class, err := institutions.CreateClass(mainContext, i.Id, dto.NewClassRequest{Level: level.Id, AcademicYear: year.Id, Name: "A"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	subject, err := institutions.CreateSubject(mainContext, i.Id, level.Id, dto.NewSubjectRequest{Name: "Mathematics"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	course, err := institutions.CreateCourse(mainContext, i.Id, class.Id, dto.NewCourseRequest{Subject: subject.Id})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err = institutions.CreateAssessment(mainContext, i.Id, class.Id, course.Id, dto.NewAssessmentRequest{AcademicTerm: year.Terms[0].Id, Title: "Test 1", MaxScore: 20}); err != nil {
+		t.Error(err)
+		return
+	}
+
+	assert.Nil(t, institutions.DeleteInstitution(mainContext, i.Id), "the assessments of the institution's terms go along")
+}
@@ -0,0 +1,442 @@
+package institutions
+
+import (
+	"context"
+	"crypto/hmac"
+	"errors"
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+	"time"
+
+	"encore.dev/beta/auth"
+	"encore.dev/beta/errs"
+	"encore.dev/rlog"
+	"encore.dev/storage/sqldb"
+	"github.com/brinestone/scholaris/core/notifier"
+	"github.com/brinestone/scholaris/core/permissions"
+	"github.com/brinestone/scholaris/core/users"
+	"github.com/brinestone/scholaris/dto"
+	"github.com/brinestone/scholaris/helpers"
+	"github.com/brinestone/scholaris/models"
+	"github.com/brinestone/scholaris/util"
+)
+
+const guardianInvitationValidity = time.Hour * 24 * 7
+
+const tokenPurposeGuardianInvitation = "guardian-invitation"
+
+var errInvalidGuardianInvitation = errs.Error{
+	Code:    errs.InvalidArgument,
+	Message: "The invitation is invalid or has expired",
+}
+
+// Invites a guardian to link their user account to a student. A new invitation replaces the pending one.
+//
+//encore:api auth method=POST path=/institutions/:id/students/:student/guardians/:guardian/invitation tag:can_manage_students tag:institution_writable
+func InviteStudentGuardian(ctx context.Context, id, student, guardian uint64, req dto.NewGuardianInvitationRequest) (ans *dto.GuardianInvitation, err error) {
+	uid, _ := auth.UserID()
+	invitedBy, _ := strconv.ParseUint(string(uid), 10, 64)
+
+	institution, err := findInstitutionByIdFromDb(ctx, id)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+	defer tx.Rollback()
+
+	g, err := lockGuardian(ctx, tx, id, student, guardian)
+	if err != nil {
+		return
+	}
+
+	if g.Account.Valid {
+		err = &errs.Error{
+			Code:    errs.FailedPrecondition,
+			Message: "The guardian's account is already linked",
+		}
+		return
+	}
+
+	email := req.Email
+	if email == nil && g.Email.Valid {
+		email = &g.Email.String
+	}
+	if email == nil {
+		err = &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: "The guardian has no email address. Provide the address to send the invitation to",
+		}
+		return
+	}
+
+	s, err := findStudent(ctx, tx, id, student)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	invitation, err := createGuardianInvitation(ctx, tx, guardian, *email, invitedBy, time.Now().Add(guardianInvitationValidity))
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	token, hash := helpers.SignToken(secrets.TokenSigningKey, tokenPurposeGuardianInvitation, invitation.Id)
+	if _, err = tx.Exec(ctx, "UPDATE guardian_invitations SET token_hash = $1 WHERE id = $2;", hash, invitation.Id); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if err = notifier.SendEmail(ctx, guardianInvitationEmail(institution, s, invitation, token)); err != nil {
+		rlog.Error(util.MsgCallError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = guardianInvitationToDto(invitation, student)
+	return
+}
+
+// Finds the pending invitation of a guardian
+//
+//encore:api auth method=GET path=/institutions/:id/students/:student/guardians/:guardian/invitation tag:can_manage_students
+func FindGuardianInvitation(ctx context.Context, id, student, guardian uint64) (ans *dto.GuardianInvitation, err error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM
+			guardian_invitations i
+			JOIN student_guardians g ON g.id = i.guardian
+			JOIN students s ON s.id = g.student
+		WHERE
+			i.guardian = $1 AND g.student = $2 AND s.institution = $3
+			AND i.accepted_at IS NULL AND i.revoked_at IS NULL AND i.expires_at > CURRENT_TIMESTAMP;
+	`, guardianInvitationFields)
+	invitation, err := scanGuardianInvitation(db.QueryRow(ctx, query, guardian, student, id))
+	if errors.Is(err, sqldb.ErrNoRows) {
+		err = &util.ErrNotFound
+		return
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = guardianInvitationToDto(invitation, student)
+	return
+}
+
+// Revokes the pending invitation of a guardian
+//
+//encore:api auth method=DELETE path=/institutions/:id/students/:student/guardians/:guardian/invitation tag:can_manage_students tag:institution_writable
+func RevokeGuardianInvitation(ctx context.Context, id, student, guardian uint64) error {
+	res, err := db.Exec(ctx, `
+		UPDATE guardian_invitations i SET
+			revoked_at = CURRENT_TIMESTAMP
+		FROM
+			student_guardians g
+			JOIN students s ON s.id = g.student
+		WHERE
+			g.id = i.guardian AND i.guardian = $1 AND g.student = $2 AND s.institution = $3
+			AND i.accepted_at IS NULL AND i.revoked_at IS NULL;
+	`, guardian, student, id)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return &util.ErrUnknown
+	}
+
+	if res.RowsAffected() == 0 {
+		return &util.ErrNotFound
+	}
+	return nil
+}
+
+// Accepts an invitation to be linked to a student as their guardian. The invitation must have been sent to one of
+// the current user's email addresses.
+//
+//encore:api auth method=POST path=/guardian-invitations/accept
+func AcceptGuardianInvitation(ctx context.Context, req dto.AcceptGuardianInvitationRequest) (ans *dto.StudentGuardian, err error) {
+	uid, _ := auth.UserID()
+	userId, _ := strconv.ParseUint(string(uid), 10, 64)
+
+	id, hash, ok := helpers.ParseToken(secrets.TokenSigningKey, tokenPurposeGuardianInvitation, req.Token)
+	if !ok {
+		err = &errInvalidGuardianInvitation
+		return
+	}
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+	defer tx.Rollback()
+
+	query := fmt.Sprintf("SELECT %s FROM guardian_invitations i WHERE i.id = $1 AND i.accepted_at IS NULL AND i.revoked_at IS NULL FOR UPDATE;", guardianInvitationFields)
+	invitation, err := scanGuardianInvitation(tx.QueryRow(ctx, query, id))
+	if errors.Is(err, sqldb.ErrNoRows) {
+		err = &errInvalidGuardianInvitation
+		return
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if !hmac.Equal([]byte(hash), []byte(invitation.TokenHash)) || time.Now().After(invitation.ExpiresAt) {
+		err = &errInvalidGuardianInvitation
+		return
+	}
+
+	user, err := users.FindUserById(ctx, userId)
+	if err != nil {
+		rlog.Error(util.MsgCallError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if _, owned := helpers.Find(user.Emails, func(e models.UserEmailAddress) bool {
+		return e.Verified && strings.EqualFold(e.Email, invitation.Email)
+	}); !owned {
+		err = &errs.Error{
+			Code:    errs.PermissionDenied,
+			Message: "This invitation was sent to an email address you have not verified",
+		}
+		return
+	}
+
+	query = fmt.Sprintf(`
+		UPDATE student_guardians g SET
+			user_account = $2,
+			linked_at = CURRENT_TIMESTAMP,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE
+			g.id = $1
+			AND g.user_account IS NULL
+			AND NOT EXISTS(SELECT 1 FROM student_guardians o WHERE o.student = g.student AND o.user_account = $2)
+		RETURNING %s;
+	`, guardianFields)
+	linked, err := scanGuardian(tx.QueryRow(ctx, query, invitation.Guardian, userId))
+	if errors.Is(err, sqldb.ErrNoRows) {
+		err = &errs.Error{
+			Code:    errs.FailedPrecondition,
+			Message: "This guardian or your account is already linked to the student",
+		}
+		return
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if _, err = tx.Exec(ctx, "UPDATE guardian_invitations SET accepted_at = CURRENT_TIMESTAMP, accepted_by = $1 WHERE id = $2;", userId, invitation.Id); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if err = permissions.SetPermissions(ctx, dto.UpdatePermissionsRequest{
+		Updates: []dto.PermissionUpdate{guardianPermission(linked)},
+	}); err != nil {
+		rlog.Error(util.MsgCallError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = &guardiansToDto(linked)[0]
+	return
+}
+
+// Unlinks the user account of a guardian, who then loses access to the student's records
+//
+//encore:api auth method=DELETE path=/institutions/:id/students/:student/guardians/:guardian/account tag:can_manage_students tag:institution_writable
+func UnlinkGuardianAccount(ctx context.Context, id, student, guardian uint64) (ans *dto.StudentGuardian, err error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+	defer tx.Rollback()
+
+	current, err := lockGuardian(ctx, tx, id, student, guardian)
+	if err != nil {
+		return
+	}
+
+	if !current.Account.Valid {
+		err = &errs.Error{
+			Code:    errs.FailedPrecondition,
+			Message: "The guardian has no linked account",
+		}
+		return
+	}
+
+	query := fmt.Sprintf(`
+		UPDATE student_guardians g SET
+			user_account = NULL,
+			linked_at = NULL,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE
+			g.id = $1
+		RETURNING %s;
+	`, guardianFields)
+	updated, err := scanGuardian(tx.QueryRow(ctx, query, guardian))
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if err = permissions.DeletePermissions(ctx, dto.UpdatePermissionsRequest{
+		Updates: []dto.PermissionUpdate{guardianPermission(current)},
+	}); err != nil {
+		rlog.Error(util.MsgCallError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = &guardiansToDto(updated)[0]
+	return
+}
+
+// Lists the students the current user is a guardian of, across institutions
+//
+//encore:api auth method=GET path=/students/guarded
+func FindGuardedStudents(ctx context.Context) (ans *dto.StudentsResponse, err error) {
+	uid, _ := auth.UserID()
+	userId, _ := strconv.ParseUint(string(uid), 10, 64)
+
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM
+			students s
+		WHERE
+			s.id IN (SELECT student FROM student_guardians WHERE user_account = $1)
+		ORDER BY
+			s.institution, s.last_name, s.first_name;
+	`, studentFields)
+	students, err := queryStudents(ctx, query, userId)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = &dto.StudentsResponse{
+		Students: studentsToDto(students...),
+	}
+	return
+}
+
+// Private section
+
+// The relation giving a guardian's account access to the student's records
+func guardianPermission(g *models.StudentGuardian) dto.PermissionUpdate {
+	return dto.PermissionUpdate{
+		Actor:    dto.IdentifierString(dto.PTUser, uint64(g.Account.Int64)),
+		Relation: dto.PNGuardian,
+		Target:   dto.IdentifierString(dto.PTStudentRecord, g.Student),
+	}
+}
+
+// Locks a guardian of a student of an institution for an update
+func lockGuardian(ctx context.Context, tx *sqldb.Tx, institution, student, guardian uint64) (*models.StudentGuardian, error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM
+			student_guardians g
+			JOIN students s ON s.id = g.student
+		WHERE
+			g.id = $1 AND g.student = $2 AND s.institution = $3
+		FOR UPDATE OF g;
+	`, guardianFields)
+	g, err := scanGuardian(tx.QueryRow(ctx, query, guardian, student, institution))
+	if errors.Is(err, sqldb.ErrNoRows) {
+		return nil, &util.ErrNotFound
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return nil, &util.ErrUnknown
+	}
+	return g, nil
+}
+
+func guardianInvitationEmail(institution *models.Institution, student *models.Student, invitation *models.GuardianInvitation, token string) dto.SendEmailRequest {
+	link := fmt.Sprintf("%s/guardian-invitations/accept?token=%s", strings.TrimSuffix(secrets.FrontendUrl, "/"), token)
+	name := html.EscapeString(strings.TrimSpace(student.FirstName + " " + student.LastName))
+	return dto.SendEmailRequest{
+		To:      invitation.Email,
+		Subject: fmt.Sprintf("Follow %s at %s", strings.TrimSpace(student.FirstName+" "+student.LastName), institution.Name),
+		Body: fmt.Sprintf(
+			"<p><strong>%s</strong> has added you as a guardian of <strong>%s</strong>.</p><p><a href=\"%s\">Link your account</a> to follow their records.</p><p>This invitation expires on %s.</p>",
+			html.EscapeString(institution.Name), name, link, invitation.ExpiresAt.Format(time.RFC1123),
+		),
+		IsContentHtml: true,
+	}
+}
+
+const guardianInvitationFields = "i.id,i.guardian,i.email,i.token_hash,i.invited_by,i.expires_at,i.created_at,i.accepted_at,i.accepted_by,i.revoked_at"
+
+func createGuardianInvitation(ctx context.Context, tx *sqldb.Tx, guardian uint64, email string, invitedBy uint64, expiresAt time.Time) (*models.GuardianInvitation, error) {
+	if _, err := tx.Exec(ctx, "UPDATE guardian_invitations SET revoked_at = CURRENT_TIMESTAMP WHERE guardian = $1 AND accepted_at IS NULL AND revoked_at IS NULL;", guardian); err != nil {
+		return nil, err
+	}
+
+	query := fmt.Sprintf(`
+		INSERT INTO guardian_invitations AS i(guardian, email, token_hash, invited_by, expires_at)
+		VALUES ($1,$2,'',$3,$4)
+		RETURNING %s;
+	`, guardianInvitationFields)
+	return scanGuardianInvitation(tx.QueryRow(ctx, query, guardian, email, invitedBy, expiresAt))
+}
+
+func scanGuardianInvitation(row rowScanner) (*models.GuardianInvitation, error) {
+	i := new(models.GuardianInvitation)
+	if err := row.Scan(&i.Id, &i.Guardian, &i.Email, &i.TokenHash, &i.InvitedBy, &i.ExpiresAt, &i.CreatedAt, &i.AcceptedAt, &i.AcceptedBy, &i.RevokedAt); err != nil {
+		return nil, err
+	}
+	return i, nil
+}
+
+func guardianInvitationToDto(i *models.GuardianInvitation, student uint64) *dto.GuardianInvitation {
+	return &dto.GuardianInvitation{
+		Id:        i.Id,
+		Guardian:  i.Guardian,
+		Student:   student,
+		Email:     i.Email,
+		InvitedBy: i.InvitedBy,
+		ExpiresAt: i.ExpiresAt,
+		CreatedAt: i.CreatedAt,
+	}
+}
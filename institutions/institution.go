@@ -18,7 +18,9 @@ import (
 	"encore.dev/storage/cache"
 	"encore.dev/storage/sqldb"
 	"github.com/brinestone/scholaris/core/permissions"
+	"github.com/brinestone/scholaris/core/pkg"
 	"github.com/brinestone/scholaris/dto"
+	"github.com/brinestone/scholaris/helpers"
 	"github.com/brinestone/scholaris/models"
 	"github.com/brinestone/scholaris/settings"
 	"github.com/brinestone/scholaris/tenants"
@@ -41,25 +43,20 @@ func GetInstitution(ctx context.Context, identifier string) (*dto.Institution, e
 //encore:api public method=GET path=/institutions
 func Lookup(ctx context.Context, req dto.LookupInstitutionsRequest) (*dto.LookupInstitutionsResponse, error) {
 	uid, authed := auth.UserID()
-	var memberedRefs []uint64
-
-	if authed {
-		memberedInstitutions, err := permissions.ListObjectsInternal(ctx, dto.ListObjectsRequest{
-			Actor:    dto.IdentifierString(dto.PTUser, uid),
-			Relation: dto.PNMember,
-			Type:     string(dto.PTInstitution),
-		})
-		if err != nil {
-			return nil, err
-		}
-		memberedRefs = memberedInstitutions.Relations[dto.PTInstitution]
+	actor := dto.IdentifierString(dto.PTUser, uid)
+	size := req.Size
+	if size == 0 {
+		size = dto.DefaultPageSize
 	}
+
 	var ans []*models.Institution
+	var total uint
+	var next uint64
 	var err error
 	if req.SubscribedOnly {
-		ans, err = lookupSubscribedInstitutions(ctx, req.Page, req.Size, memberedRefs)
+		ans, total, next, err = lookupMemberedInstitutions(ctx, authed, actor, req.Page, req.After, size)
 	} else {
-		ans, err = lookupInstitutions(ctx, req.Page, req.Size, memberedRefs)
+		ans, total, next, err = lookupViewableInstitutions(ctx, authed, actor, req.Page, req.After, size)
 	}
 	if err != nil {
 		rlog.Error(err.Error())
@@ -68,6 +65,9 @@ func Lookup(ctx context.Context, req dto.LookupInstitutionsRequest) (*dto.Lookup
 
 	return &dto.LookupInstitutionsResponse{
 			Institutions: toInstitutionDtos(ans...),
+			Total:        total,
+			HasMore:      next != 0,
+			Next:         next,
 		},
 		nil
 }
@@ -166,9 +166,133 @@ func NewInstitution(ctx context.Context, req dto.NewInstitutionRequest) (*dto.In
 	return ans, nil
 }
 
+// Updates an institution's details
+//
+//encore:api auth method=PATCH path=/institutions/:id tag:can_update_institution tag:institution_writable
+func UpdateInstitution(ctx context.Context, id uint64, req dto.UpdateInstitutionRequest) (*dto.Institution, error) {
+	var slug string
+	err := db.QueryRow(ctx, `
+		UPDATE institutions SET
+			name = COALESCE($2, name),
+			description = CASE WHEN $3::TEXT IS NULL THEN description ELSE NULLIF($3, '') END,
+			logo = CASE WHEN $4::TEXT IS NULL THEN logo ELSE NULLIF($4, '') END,
+			visible = COALESCE($5, visible),
+			updated_at = CURRENT_TIMESTAMP
+		WHERE
+			id = $1
+		RETURNING slug;
+	`, id, req.Name, req.Description, req.Logo, req.Visible).Scan(&slug)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		return nil, &util.ErrNotFound
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return nil, &util.ErrUnknown
+	}
+
+	evictCachedInstitution(ctx, id, slug)
+	return findInstitutionByGenericIdentifier(ctx, strconv.FormatUint(id, 10))
+}
+
+// Archives an institution. Archived institutions are read-only and hidden from lookups until they are restored.
+//
+//encore:api auth method=POST path=/institutions/:id/archive tag:can_delete_institution
+func ArchiveInstitution(ctx context.Context, id uint64) (*dto.Institution, error) {
+	return setInstitutionArchived(ctx, id, true)
+}
+
+// Restores an archived institution
+//
+//encore:api auth method=DELETE path=/institutions/:id/archive tag:can_delete_institution
+func RestoreInstitution(ctx context.Context, id uint64) (*dto.Institution, error) {
+	return setInstitutionArchived(ctx, id, false)
+}
+
+// Permanently deletes an institution. The data it owns in other services is cleaned up in the background.
+//
+//encore:api auth method=DELETE path=/institutions/:id tag:can_delete_institution
+func DeleteInstitution(ctx context.Context, id uint64) error {
+	institution, err := findInstitutionByIdFromDb(ctx, id)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		return &util.ErrNotFound
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return &util.ErrUnknown
+	}
+
+	if _, err = deleteInstitutions(ctx, id); err != nil {
+		rlog.Error("could not delete institution", "institution", id, "err", err)
+		return &util.ErrUnknown
+	}
+
+	uid, _ := auth.UserID()
+	if _, err = pkg.DeletedInstitutions.Publish(ctx, &pkg.InstitutionDeleted{
+		Id:        institution.Id,
+		Tenant:    institution.TenantId,
+		Slug:      institution.Slug,
+		DeletedBy: uid,
+		Timestamp: time.Now(),
+	}); err != nil {
+		rlog.Error("could not publish institution deletion", "institution", id, "err", err)
+		return &util.ErrUnknown
+	}
+
+	return nil
+}
+
 // Private section
 
-const institutionFields = "id,name,description,logo,visible,slug,tenant,created_at,updated_at,verified"
+func setInstitutionArchived(ctx context.Context, id uint64, archived bool) (*dto.Institution, error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return nil, &util.ErrUnknown
+	}
+	defer tx.Rollback()
+
+	var slug string
+	err = tx.QueryRow(ctx, `
+		UPDATE institutions SET
+			archived_at = CASE WHEN $2 THEN COALESCE(archived_at, CURRENT_TIMESTAMP) ELSE NULL END,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE
+			id = $1
+		RETURNING slug;
+	`, id, archived).Scan(&slug)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		return nil, &util.ErrNotFound
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return nil, &util.ErrUnknown
+	}
+
+	// The other services owning data on behalf of the institution reject changes through this tuple
+	if err = permissions.ReplacePermissions(ctx, archivedInstitutionPermissions(id, archived)); err != nil {
+		rlog.Error(util.MsgCallError, "err", err)
+		return nil, &util.ErrUnknown
+	}
+
+	if err = tx.Commit(); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return nil, &util.ErrUnknown
+	}
+
+	evictCachedInstitution(ctx, id, slug)
+	return findInstitutionByGenericIdentifier(ctx, strconv.FormatUint(id, 10))
+}
+
+func archivedInstitutionPermissions(id uint64, archived bool) (ans dto.ReplacePermissionsRequest) {
+	tuple := []dto.PermissionUpdate{
+		dto.NewPermissionUpdate[string](dto.IdentifierString(dto.PTUser, "*"), dto.PNArchived, dto.IdentifierString(dto.PTInstitution, id)),
+	}
+	if archived {
+		ans.Writes = tuple
+	} else {
+		ans.Deletes = tuple
+	}
+	return
+}
+
+const institutionFields = "id,name,description,logo,visible,slug,tenant,created_at,updated_at,verified,archived_at"
 
 func institutionExists(ctx context.Context, slug string, tenant uint64) (ans bool, err error) {
 	// Check whether the institution already exists under the same tenant.
@@ -224,9 +348,18 @@ func findInstitutionByIdFromCache(ctx context.Context, id uint64) (*dto.Institut
 	return findInstitutionByKeyFromCache(ctx, "id", id)
 }
 
-func findInstitutionByKeyFromCache(ctx context.Context, key string, value any) (*dto.Institution, error) {
+func institutionCacheKey(key string, value any) string {
 	sum := md5.Sum([]byte(fmt.Sprintf("%s=%v", key, value)))
-	ans, err := institutionCache.Get(ctx, hex.EncodeToString(sum[:]))
+	return hex.EncodeToString(sum[:])
+}
+
+// Removes an institution from the cache under every key it is cached with
+func evictCachedInstitution(ctx context.Context, id uint64, slug string) {
+	_, _ = institutionCache.Delete(ctx, institutionCacheKey("id", id), institutionCacheKey("slug", slug))
+}
+
+func findInstitutionByKeyFromCache(ctx context.Context, key string, value any) (*dto.Institution, error) {
+	ans, err := institutionCache.Get(ctx, institutionCacheKey(key, value))
 	if err != nil {
 		return nil, err
 	}
@@ -243,7 +376,7 @@ func findInstitutionByKeyFromDbTrx(ctx context.Context, trx *sqldb.Tx, key strin
 		WHERE
 			%s = $1;
 	`, institutionFields, key)
-	if err := trx.QueryRow(ctx, query, value).Scan(&i.Id, &i.Name, &i.Description, &i.Logo, &i.Visible, &i.Slug, &i.TenantId, &i.CreatedAt, &i.UpdatedAt, &i.Verified); err != nil {
+	if err := trx.QueryRow(ctx, query, value).Scan(&i.Id, &i.Name, &i.Description, &i.Logo, &i.Visible, &i.Slug, &i.TenantId, &i.CreatedAt, &i.UpdatedAt, &i.Verified, &i.ArchivedAt); err != nil {
 		return nil, err
 	}
 
@@ -273,12 +406,11 @@ func findInstitutionByKeyFromDb(ctx context.Context, key string, value any) (*mo
 	query := fmt.Sprintf("SELECT %s FROM institutions WHERE %s = $1;", institutionFields, key)
 	row := db.QueryRow(ctx, query, value)
 
-	if err := row.Scan(&i.Id, &i.Name, &i.Description, &i.Logo, &i.Visible, &i.Slug, &i.TenantId, &i.CreatedAt, &i.UpdatedAt, &i.Verified); err != nil {
+	if err := row.Scan(&i.Id, &i.Name, &i.Description, &i.Logo, &i.Visible, &i.Slug, &i.TenantId, &i.CreatedAt, &i.UpdatedAt, &i.Verified, &i.ArchivedAt); err != nil {
 		return nil, err
 	}
 
-	sum := md5.Sum([]byte(fmt.Sprintf("%s=%v", key, value)))
-	_ = institutionCache.Set(ctx, hex.EncodeToString(sum[:]), toInstitutionDto(i)[0])
+	_ = institutionCache.Set(ctx, institutionCacheKey(key, value), toInstitutionDto(i)[0])
 	return i, nil
 }
 
@@ -333,6 +465,11 @@ func toInstitutionDto(in ...*models.Institution) (res []dto.Institution) {
 			u.CurrentTerm = &tmp
 		}
 
+		if v.ArchivedAt.Valid {
+			u.Archived = true
+			u.ArchivedAt = &v.ArchivedAt.Time
+		}
+
 		if v.Logo.Valid {
 			u.Logo = &v.Logo.String
 		}
@@ -347,34 +484,120 @@ func toInstitutionDto(in ...*models.Institution) (res []dto.Institution) {
 	return
 }
 
-func lookupSubscribedInstitutions(ctx context.Context, page, size uint, ids []uint64) (ans []*models.Institution, err error) {
-	query := "SELECT id,name,description,logo,visible,slug,tenant,verified,created_at,updated_at,current_year,current_term FROM vw_AllInstitutions WHERE id=ANY($1) OFFSET $2 LIMIT $3;"
+const institutionLookupFields = "id,name,description,logo,visible,slug,tenant,verified,created_at,updated_at,current_year,current_term"
 
-	rows, err := db.Query(ctx, query, pq.Array(ids), page*size, size)
+// Pages through the institutions the actor is a member of. Memberships are few per user, so they are resolved up front
+// and every page is an offset into them when no cursor is given.
+func lookupMemberedInstitutions(ctx context.Context, authed bool, actor string, page uint, after uint64, size uint) (ans []*models.Institution, total uint, next uint64, err error) {
+	if !authed {
+		return
+	}
+
+	res, err := permissions.ListObjectsInternal(ctx, dto.ListObjectsRequest{
+		Actor:    actor,
+		Relation: dto.PNMember,
+		Type:     string(dto.PTInstitution),
+	})
 	if err != nil {
 		return
 	}
-	defer rows.Close()
+	ids := res.Relations[dto.PTInstitution]
 
-	for rows.Next() {
-		var i = new(models.Institution)
-		if err = rows.Scan(&i.Id, &i.Name, &i.Description, &i.Logo, &i.Visible, &i.Slug, &i.TenantId, &i.Verified, &i.CreatedAt, &i.UpdatedAt, &i.CurrentYear, &i.CurrentTerm); err != nil {
+	if err = db.QueryRow(ctx, "SELECT COUNT(id) FROM vw_AllInstitutions WHERE id=ANY($1);", pq.Array(ids)).Scan(&total); err != nil {
+		return
+	}
+
+	var offset uint
+	if after == 0 {
+		offset = page * size
+	}
+
+	// One extra row tells whether another page follows.
+	query := fmt.Sprintf("SELECT %s FROM vw_AllInstitutions WHERE id=ANY($1) AND ($2 = 0 OR id < $2) ORDER BY id DESC OFFSET $3 LIMIT $4;", institutionLookupFields)
+	if ans, err = queryInstitutions(ctx, query, pq.Array(ids), after, offset, size+1); err != nil {
+		return
+	}
+
+	if uint(len(ans)) > size {
+		ans = ans[:size]
+		next = ans[len(ans)-1].Id
+	}
+	return
+}
+
+// Pages through verified institutions and the unverified ones the actor is a member of. Verified institutions are
+// counted directly, while only the unverified ones go through the permission filter to be counted. A page given
+// without a cursor is resolved into one by skipping the authorized institutions before it.
+func lookupViewableInstitutions(ctx context.Context, authed bool, actor string, page uint, after uint64, size uint) (ans []*models.Institution, total uint, next uint64, err error) {
+	filter := func(ctx context.Context, rows []*models.Institution) (ans []*models.Institution, err error) {
+		var unverified []uint64
+		for _, v := range rows {
+			if !v.Verified {
+				unverified = append(unverified, v.Id)
+			}
+		}
+
+		allowed := make(map[uint64]bool)
+		if authed && len(unverified) > 0 {
+			var res *dto.FilterObjectsResponse
+			if res, err = permissions.FilterObjectsInternal(ctx, dto.FilterObjectsRequest{
+				Actor:    actor,
+				Relation: dto.PNMember,
+				Type:     dto.PTInstitution,
+				Ids:      unverified,
+			}); err != nil {
+				return
+			}
+			for _, id := range res.Allowed {
+				allowed[id] = true
+			}
+		}
+
+		for _, v := range rows {
+			if v.Verified || allowed[v.Id] {
+				ans = append(ans, v)
+			}
+		}
+		return
+	}
+
+	cursorOf := func(i *models.Institution) uint64 { return i.Id }
+
+	if after == 0 && page > 0 {
+		if after, err = helpers.AuthorizedOffset(ctx, page*size, helpers.ScanBatchSize, institutionsAfter(false), filter, cursorOf); err != nil {
 			return
 		}
-		ans = append(ans, i)
 	}
+
+	if ans, next, err = helpers.AuthorizedPage(ctx, after, size, institutionsAfter(false), filter, cursorOf); err != nil {
+		return
+	}
+
+	if err = db.QueryRow(ctx, "SELECT COUNT(id) FROM vw_AllInstitutions WHERE verified=true;").Scan(&total); err != nil {
+		return
+	}
+
+	if !authed {
+		return
+	}
+
+	unverified, err := helpers.CountAuthorized(ctx, helpers.ScanBatchSize, institutionsAfter(true), filter, cursorOf)
+	total += unverified
 	return
 }
 
-func lookupInstitutions(ctx context.Context, page, size uint, ids []uint64) ([]*models.Institution, error) {
-	ans := make([]*models.Institution, 0)
-	query := "SELECT id,name,description,logo,visible,slug,tenant,verified,created_at,updated_at,current_year,current_term FROM vw_AllInstitutions WHERE id=ANY($1) OR verified=true OFFSET $2 LIMIT $3;"
+func institutionsAfter(unverifiedOnly bool) helpers.CursorFetcher[*models.Institution] {
+	return func(ctx context.Context, after uint64, limit uint) ([]*models.Institution, error) {
+		query := fmt.Sprintf("SELECT %s FROM vw_AllInstitutions WHERE ($1 = 0 OR id < $1) AND ($2 = false OR verified = false) ORDER BY id DESC LIMIT $3;", institutionLookupFields)
+		return queryInstitutions(ctx, query, after, unverifiedOnly, limit)
+	}
+}
 
-	rows, err := db.Query(ctx, query, pq.Array(ids), page*size, size)
+func queryInstitutions(ctx context.Context, query string, args ...any) ([]*models.Institution, error) {
+	ans := make([]*models.Institution, 0)
+	rows, err := db.Query(ctx, query, args...)
 	if err != nil {
-		if !errors.Is(err, sqldb.ErrNoRows) {
-			return ans, err
-		}
+		return ans, err
 	}
 	defer rows.Close()
 
@@ -386,7 +609,7 @@ func lookupInstitutions(ctx context.Context, page, size uint, ids []uint64) ([]*
 		ans = append(ans, i)
 	}
 
-	return ans, nil
+	return ans, rows.Err()
 }
 
 func findInstitutionByGenericIdentifier(ctx context.Context, identifier string) (*dto.Institution, error) {
@@ -443,6 +666,15 @@ type DefaultSettings struct {
 	Settings map[string]DefaultSetting `yaml:"settings"`
 }
 
+// The default value of an institution setting
+func defaultSettingValue(key string) ([]string, error) {
+	var sMap DefaultSettings
+	if err := yaml.Unmarshal(defSettings, &sMap); err != nil {
+		return nil, err
+	}
+	return sMap.Settings[key].Value, nil
+}
+
 func defineInstitutionDefaultSettings(ctx context.Context, id uint64) error {
 	var sMap = DefaultSettings{
 		Settings: make(map[string]DefaultSetting),
@@ -2,14 +2,19 @@ package institutions_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"testing"
 
 	"encore.dev/et"
 	"github.com/brianvoe/gofakeit/v6"
+	"github.com/brinestone/scholaris/blob"
+	"github.com/brinestone/scholaris/core/notifier"
 	"github.com/brinestone/scholaris/core/permissions"
+	"github.com/brinestone/scholaris/core/users"
 	"github.com/brinestone/scholaris/dto"
 	"github.com/brinestone/scholaris/institutions"
+	"github.com/brinestone/scholaris/models"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -37,7 +42,6 @@ func TestLookup(t *testing.T) {
 
 	t.Run("all", func(t *testing.T) {
 		res, err := institutions.Lookup(mainContext, dto.LookupInstitutionsRequest{
-			Page: 0,
 			Size: 10,
 		})
 
@@ -52,7 +56,6 @@ func TestLookup(t *testing.T) {
 
 	t.Run("subscribedOnly", func(t *testing.T) {
 		res, err := institutions.Lookup(mainContext, dto.LookupInstitutionsRequest{
-			Page:           0,
 			Size:           10,
 			SubscribedOnly: true,
 		})
@@ -64,6 +67,27 @@ func TestLookup(t *testing.T) {
 
 		assert.NotNil(t, res)
 		assert.GreaterOrEqual(t, uint(len(res.Institutions)), cnt)
+		assert.GreaterOrEqual(t, res.Total, cnt)
+	})
+
+	t.Run("page", func(t *testing.T) {
+		first, err := institutions.Lookup(mainContext, dto.LookupInstitutionsRequest{Size: 2, SubscribedOnly: true})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		second, err := institutions.Lookup(mainContext, dto.LookupInstitutionsRequest{Size: 1, Page: 1, SubscribedOnly: true})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if len(first.Institutions) < 2 {
+			assert.Empty(t, second.Institutions)
+			return
+		}
+		assert.Equal(t, first.Institutions[1].Id, second.Institutions[0].Id)
+		assert.Equal(t, first.Total, second.Total)
 	})
 }
 
@@ -107,3 +131,180 @@ func TestGetInstitution(t *testing.T) {
 		assert.Equal(t, i.Slug, res.Slug)
 	})
 }
+
+func TestUpdateInstitution(t *testing.T) {
+	i, err := makeInstitution()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	name := gofakeit.Company()
+	visible := true
+	res, err := institutions.UpdateInstitution(mainContext, i.Id, dto.UpdateInstitutionRequest{
+		Name:    &name,
+		Visible: &visible,
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	assert.Equal(t, name, res.Name)
+	assert.True(t, res.Visible)
+	assert.Equal(t, i.Slug, res.Slug)
+}
+
+func TestArchiveInstitution(t *testing.T) {
+	var replaced []dto.ReplacePermissionsRequest
+	t.Cleanup(mockEndpoints)
+	et.MockEndpoint(permissions.ReplacePermissions, func(ctx context.Context, req dto.ReplacePermissionsRequest) error {
+		replaced = append(replaced, req)
+		return nil
+	})
+
+	i, err := makeInstitution()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	res, err := institutions.ArchiveInstitution(mainContext, i.Id)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.True(t, res.Archived)
+
+	archived := dto.PermissionUpdate{Actor: "user:*", Relation: dto.PNArchived, Target: dto.IdentifierString(dto.PTInstitution, i.Id)}
+	if assert.Len(t, replaced, 1) {
+		assert.Equal(t, []dto.PermissionUpdate{archived}, replaced[0].Writes)
+	}
+
+	name := gofakeit.Company()
+	_, err = institutions.UpdateInstitution(mainContext, i.Id, dto.UpdateInstitutionRequest{Name: &name})
+	assert.NotNil(t, err)
+
+	res, err = institutions.RestoreInstitution(mainContext, i.Id)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.False(t, res.Archived)
+	if assert.Len(t, replaced, 2) {
+		assert.Equal(t, []dto.PermissionUpdate{archived}, replaced[1].Deletes)
+	}
+}
+
+func TestDeleteInstitution(t *testing.T) {
+	t.Cleanup(mockEndpoints)
+	et.MockEndpoint(permissions.PurgeObjectTuples, func(ctx context.Context, req dto.PurgeObjectTuplesRequest) (*dto.PurgeResponse, error) {
+		return &dto.PurgeResponse{Deleted: uint(len(req.Objects))}, nil
+	})
+
+	i, err := makeInstitution()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = institutions.DeleteInstitution(mainContext, i.Id)
+	assert.Nil(t, err)
+
+	_, err = institutions.GetInstitution(mainContext, fmt.Sprintf("%d", i.Id))
+	assert.NotNil(t, err)
+}
+
+func TestVerificationWorkflow(t *testing.T) {
+	i, err := makeInstitution()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	var revoked []dto.PermissionUpdate
+	t.Cleanup(mockEndpoints)
+	et.MockEndpoint(permissions.ReplacePermissions, func(ctx context.Context, req dto.ReplacePermissionsRequest) error {
+		revoked = append(revoked, req.Deletes...)
+		return nil
+	})
+	ownerType := string(dto.PTInstitution)
+	et.MockEndpoint(blob.FindUploadsInternal, func(ctx context.Context, req dto.FindUploadsRequest) (*dto.FindUploadsResponse, error) {
+		ans := &dto.FindUploadsResponse{}
+		for _, key := range req.Keys {
+			ans.Uploads = append(ans.Uploads, dto.UploadInfo{Key: key, Owner: &i.Id, OwnerType: &ownerType})
+		}
+		return ans, nil
+	})
+
+	req := dto.NewVerificationRequest{Documents: []string{fmt.Sprintf("sh_%s", randomString(8))}}
+	request, err := institutions.SubmitVerificationRequest(mainContext, i.Id, req)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.Equal(t, dto.VRSPending, request.Status)
+
+	_, err = institutions.SubmitVerificationRequest(mainContext, i.Id, req)
+	assert.NotNil(t, err)
+
+	approved, err := institutions.ApproveVerificationRequest(mainContext, request.Id, dto.VerificationDecisionRequest{})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.Equal(t, dto.VRSApproved, approved.Status)
+	if assert.Len(t, revoked, 1, "reviewers lose access to the documents once the request is decided") {
+		assert.Equal(t, dto.IdentifierString(dto.PTSharedFile, req.Documents[0]), revoked[0].Target)
+	}
+
+	res, err := institutions.GetInstitution(mainContext, fmt.Sprintf("%d", i.Id))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.True(t, res.Verified)
+
+	res, err = institutions.RevokeInstitutionVerification(mainContext, i.Id, dto.VerificationReasonRequest{Reason: "Expired accreditation"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.False(t, res.Verified)
+
+	history, err := institutions.FindVerificationRequests(mainContext, i.Id)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.Equal(t, dto.VRSRevoked, history.Requests[0].Status)
+}
+
+func TestEmailInstitutionMaintainersSkipsNotifiedRecipients(t *testing.T) {
+	sent := make(map[string]int)
+	failing := "b@example.com"
+	t.Cleanup(mockEndpoints)
+	et.MockEndpoint(permissions.ListUsersInternal, func(ctx context.Context, req dto.ListUsersRequest) (*dto.ListUsersResponse, error) {
+		return &dto.ListUsersResponse{Users: []uint64{1, 2}}, nil
+	})
+	et.MockEndpoint(users.FindUserById, func(ctx context.Context, id uint64) (*models.User, error) {
+		email := map[uint64]string{1: "a@example.com", 2: failing}[id]
+		return &models.User{Id: id, Emails: []models.UserEmailAddress{{Email: email, IsPrimary: true}}}, nil
+	})
+	et.MockEndpoint(notifier.SendEmail, func(ctx context.Context, req dto.SendEmailRequest) error {
+		if req.To == failing {
+			return errors.New("mailbox unavailable")
+		}
+		sent[req.To]++
+		return nil
+	})
+
+	notification := fmt.Sprintf("test:%s", randomString(8))
+	err := institutions.EmailInstitutionMaintainers(context.TODO(), notification, 1, "Subject", "<p>Body</p>")
+	assert.NotNil(t, err)
+
+	failing = ""
+	err = institutions.EmailInstitutionMaintainers(context.TODO(), notification, 1, "Subject", "<p>Body</p>")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]int{"a@example.com": 1, "b@example.com": 1}, sent)
+}
@@ -0,0 +1,516 @@
+package institutions
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"encore.dev/beta/errs"
+	"encore.dev/rlog"
+	"encore.dev/storage/sqldb"
+	"github.com/brinestone/scholaris/dto"
+	"github.com/brinestone/scholaris/models"
+	"github.com/brinestone/scholaris/util"
+	"github.com/lib/pq"
+)
+
+// Creates a level in an institution
+//
+//encore:api auth method=POST path=/institutions/:id/levels tag:can_update_institution tag:institution_writable
+func CreateLevel(ctx context.Context, id uint64, req dto.NewLevelRequest) (ans *dto.Level, err error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+	defer tx.Rollback()
+
+	if err = assertLevelName(ctx, tx, id, 0, req.Name); err != nil {
+		return
+	}
+
+	if req.Prerequisite != nil {
+		if err = assertLevelPrerequisite(ctx, tx, id, 0, *req.Prerequisite); err != nil {
+			return
+		}
+	}
+
+	if req.GradingScale != nil {
+		if err = assertGradingScale(ctx, tx, id, *req.GradingScale); err != nil {
+			return
+		}
+	}
+
+	var position int
+	if err = tx.QueryRow(ctx, "SELECT COALESCE(MAX(position), 0) + 1 FROM levels WHERE institution = $1 AND archived_at IS NULL;", id).Scan(&position); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if req.Position != nil && *req.Position < position {
+		position = *req.Position
+		if _, err = tx.Exec(ctx, "UPDATE levels SET position = position + 1 WHERE institution = $1 AND archived_at IS NULL AND position >= $2;", id, position); err != nil {
+			rlog.Error(util.MsgDbAccessError, "err", err)
+			err = &util.ErrUnknown
+			return
+		}
+	}
+
+	query := fmt.Sprintf(`
+		INSERT INTO levels(institution, name, code, description, position, capacity, prerequisite, grading_scale)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8)
+		RETURNING %s;
+	`, levelFields)
+	level, err := scanLevel(tx.QueryRow(ctx, query, id, req.Name, req.Code, req.Description, position, req.Capacity, req.Prerequisite, req.GradingScale))
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = &levelsToDto(level)[0]
+	return
+}
+
+// Lists the levels of an institution in order
+//
+//encore:api public method=GET path=/institutions/:id/levels
+func FindLevels(ctx context.Context, id uint64, req dto.FindLevelsRequest) (ans *dto.LevelsResponse, err error) {
+	query := fmt.Sprintf("SELECT %s FROM levels WHERE institution = $1 AND ($2 OR archived_at IS NULL) ORDER BY archived_at IS NOT NULL, position, id;", levelFields)
+	levels, err := queryLevels(ctx, query, id, req.IncludeArchived)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = &dto.LevelsResponse{
+		Levels: levelsToDto(levels...),
+	}
+	return
+}
+
+// Updates a level. Archived levels can no longer be enrolled into and are kept out of the ordering.
+//
+//encore:api auth method=PATCH path=/institutions/:id/levels/:level tag:can_update_institution tag:institution_writable
+func UpdateLevel(ctx context.Context, id, level uint64, req dto.UpdateLevelRequest) (ans *dto.Level, err error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+	defer tx.Rollback()
+
+	current, err := findLevelForUpdate(ctx, tx, id, level)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		err = &util.ErrNotFound
+		return
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	archived := current.ArchivedAt.Valid
+	if req.Archived != nil {
+		archived = *req.Archived
+	}
+
+	if req.Name != nil && !archived {
+		if err = assertLevelName(ctx, tx, id, level, *req.Name); err != nil {
+			return
+		}
+	} else if current.ArchivedAt.Valid && !archived {
+		// Restored levels must not clash with the levels created while they were archived
+		if err = assertLevelName(ctx, tx, id, level, current.Name); err != nil {
+			return
+		}
+	}
+
+	if req.Prerequisite != nil && *req.Prerequisite != 0 {
+		if err = assertLevelPrerequisite(ctx, tx, id, level, *req.Prerequisite); err != nil {
+			return
+		}
+	}
+
+	if req.GradingScale != nil && *req.GradingScale != 0 {
+		if err = assertGradingScale(ctx, tx, id, *req.GradingScale); err != nil {
+			return
+		}
+	}
+
+	if _, err = tx.Exec(ctx, `
+		UPDATE levels SET
+			name = COALESCE($3, name),
+			code = CASE WHEN $4::TEXT IS NULL THEN code ELSE NULLIF($4, '') END,
+			description = CASE WHEN $5::TEXT IS NULL THEN description ELSE NULLIF($5, '') END,
+			capacity = CASE WHEN $6::INT IS NULL THEN capacity ELSE NULLIF($6, 0) END,
+			prerequisite = CASE WHEN $7::BIGINT IS NULL THEN prerequisite ELSE NULLIF($7, 0) END,
+			grading_scale = CASE WHEN $8::BIGINT IS NULL THEN grading_scale ELSE NULLIF($8, 0) END,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE
+			id = $1 AND institution = $2;
+	`, level, id, req.Name, req.Code, req.Description, req.Capacity, req.Prerequisite, req.GradingScale); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if archived != current.ArchivedAt.Valid {
+		if err = setLevelArchived(ctx, tx, id, level, archived); err != nil {
+			rlog.Error(util.MsgDbAccessError, "err", err)
+			err = &util.ErrUnknown
+			return
+		}
+	}
+
+	updated, err := findLevelForUpdate(ctx, tx, id, level)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = &levelsToDto(updated)[0]
+	return
+}
+
+// Reorders the levels of an institution. Every level which is not archived must be listed, from the lowest to the
+// highest.
+//
+//encore:api auth method=PUT path=/institutions/:id/levels tag:can_update_institution tag:institution_writable
+func ReorderLevels(ctx context.Context, id uint64, req dto.ReorderLevelsRequest) (ans *dto.LevelsResponse, err error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+	defer tx.Rollback()
+
+	var matching, total int
+	if err = tx.QueryRow(ctx, `
+		SELECT
+			COUNT(*) FILTER (WHERE id = ANY($2)),
+			COUNT(*)
+		FROM
+			levels
+		WHERE
+			institution = $1 AND archived_at IS NULL;
+	`, id, pq.Array(req.Levels)).Scan(&matching, &total); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if matching != len(req.Levels) || matching != total {
+		err = &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: "Every level of the institution which is not archived must be listed exactly once",
+		}
+		return
+	}
+
+	if _, err = tx.Exec(ctx, `
+		UPDATE levels l SET
+			position = o.position,
+			updated_at = CURRENT_TIMESTAMP
+		FROM
+			UNNEST($2::BIGINT[]) WITH ORDINALITY AS o(id, position)
+		WHERE
+			l.id = o.id AND l.institution = $1;
+	`, id, pq.Array(req.Levels)); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	return FindLevels(ctx, id, dto.FindLevelsRequest{})
+}
+
+// Deletes a level. Levels which are in use by enrollments or other levels are archived instead, to preserve the
+// enrollment history.
+//
+//encore:api auth method=DELETE path=/institutions/:id/levels/:level tag:can_update_institution tag:institution_writable
+func DeleteLevel(ctx context.Context, id, level uint64) (ans *dto.DeleteLevelResponse, err error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err = findLevelForUpdate(ctx, tx, id, level); errors.Is(err, sqldb.ErrNoRows) {
+		err = &util.ErrNotFound
+		return
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = new(dto.DeleteLevelResponse)
+	if ans.Archived, err = levelInUse(ctx, tx, level); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if ans.Archived {
+		err = setLevelArchived(ctx, tx, id, level, true)
+	} else if _, err = tx.Exec(ctx, "DELETE FROM levels WHERE id = $1 AND institution = $2;", level, id); err == nil {
+		err = compactLevelPositions(ctx, tx, id)
+	}
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+	}
+	return
+}
+
+// Private section
+
+// Ensures a level can be enrolled into: it must belong to the institution, be active and have room left. Capacity
+// applies to the enrollments which were not rejected since the institution's last academic year ended, i.e. those of
+// its current or upcoming year. The level is locked until the transaction ends so that concurrent enrollments cannot
+// overfill it.
+func assertLevelOpen(ctx context.Context, tx *sqldb.Tx, institution, level uint64) error {
+	var archived, full bool
+	var capacity sql.NullInt32
+	err := tx.QueryRow(ctx, "SELECT archived_at IS NOT NULL, capacity FROM levels WHERE id = $1 AND institution = $2 FOR UPDATE;", level, institution).Scan(&archived, &capacity)
+	if err == nil && !archived && capacity.Valid {
+		var enrolled int32
+		err = tx.QueryRow(ctx, `
+			SELECT
+				COUNT(*)
+			FROM
+				enrollments e
+				JOIN enrollment_forms ef ON ef.form = e.form AND ef.institution = e.institution
+			WHERE
+				ef.level = $1
+				AND e.status <> $3
+				AND e.created_at > COALESCE(
+					(
+						SELECT
+							MAX(end_date)
+						FROM
+							vw_AllAcademicYears
+						WHERE
+							institution_id = $2 AND end_date <= CURRENT_TIMESTAMP
+					),
+					'-infinity'::TIMESTAMP
+				);
+		`, level, institution, dto.ESRejected).Scan(&enrolled)
+		full = enrolled >= capacity.Int32
+	}
+	if errors.Is(err, sqldb.ErrNoRows) {
+		return &errs.Error{
+			Code:    errs.NotFound,
+			Message: "The level does not exist",
+		}
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return &util.ErrUnknown
+	}
+
+	if archived {
+		return &errs.Error{
+			Code:    errs.FailedPrecondition,
+			Message: "The level is no longer open for enrollment",
+		}
+	}
+	if full {
+		return &errs.Error{
+			Code:    errs.ResourceExhausted,
+			Message: "The level is full",
+		}
+	}
+	return nil
+}
+
+func assertLevelName(ctx context.Context, tx *sqldb.Tx, institution, level uint64, name string) error {
+	var taken bool
+	if err := tx.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM levels WHERE institution = $1 AND id <> $2 AND LOWER(name) = LOWER($3) AND archived_at IS NULL);", institution, level, name).Scan(&taken); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return &util.ErrUnknown
+	}
+
+	if taken {
+		return &errs.Error{
+			Code:    errs.AlreadyExists,
+			Message: fmt.Sprintf("A level named %q already exists", name),
+		}
+	}
+	return nil
+}
+
+// Ensures the prerequisite belongs to the institution and that it does not, directly or not, depend on the level
+func assertLevelPrerequisite(ctx context.Context, tx *sqldb.Tx, institution, level, prerequisite uint64) error {
+	var exists, cyclic bool
+	if err := tx.QueryRow(ctx, `
+		WITH RECURSIVE chain AS (
+			SELECT id, prerequisite FROM levels WHERE id = $2 AND institution = $1
+			UNION
+			SELECT l.id, l.prerequisite FROM levels l JOIN chain c ON l.id = c.prerequisite
+		)
+		SELECT
+			EXISTS(SELECT 1 FROM chain WHERE id = $2),
+			EXISTS(SELECT 1 FROM chain WHERE id = $3);
+	`, institution, prerequisite, level).Scan(&exists, &cyclic); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return &util.ErrUnknown
+	}
+
+	if !exists {
+		return &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: "The prerequisite level does not exist",
+		}
+	}
+	if cyclic {
+		return &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: "A level cannot be its own prerequisite",
+		}
+	}
+	return nil
+}
+
+func levelInUse(ctx context.Context, tx *sqldb.Tx, level uint64) (ans bool, err error) {
+	err = tx.QueryRow(ctx, `
+		SELECT
+			EXISTS(SELECT 1 FROM enrollment_forms WHERE level = $1)
+			OR EXISTS(SELECT 1 FROM enrollment_sessions WHERE level = $1)
+			OR EXISTS(SELECT 1 FROM classes WHERE level = $1)
+			OR EXISTS(SELECT 1 FROM levels WHERE prerequisite = $1);
+	`, level).Scan(&ans)
+	return
+}
+
+// Archives or restores a level. Restored levels are placed after the existing levels.
+func setLevelArchived(ctx context.Context, tx *sqldb.Tx, institution, level uint64, archived bool) (err error) {
+	if _, err = tx.Exec(ctx, `
+		UPDATE levels SET
+			archived_at = CASE WHEN $3 THEN CURRENT_TIMESTAMP ELSE NULL END,
+			position = CASE WHEN $3 THEN 0 ELSE (SELECT COALESCE(MAX(position), 0) + 1 FROM levels WHERE institution = $2 AND archived_at IS NULL) END,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE
+			id = $1 AND institution = $2;
+	`, level, institution, archived); err != nil {
+		return
+	}
+	return compactLevelPositions(ctx, tx, institution)
+}
+
+// Renumbers the active levels of an institution so that their positions run from 1 without gaps
+func compactLevelPositions(ctx context.Context, tx *sqldb.Tx, institution uint64) (err error) {
+	_, err = tx.Exec(ctx, `
+		UPDATE levels l SET
+			position = o.position
+		FROM
+			(SELECT id, ROW_NUMBER() OVER (ORDER BY position, id) AS position FROM levels WHERE institution = $1 AND archived_at IS NULL) o
+		WHERE
+			l.id = o.id AND l.position <> o.position;
+	`, institution)
+	return
+}
+
+const levelFields = "id,institution,name,code,description,position,capacity,prerequisite,grading_scale,archived_at,created_at,updated_at"
+
+func findLevelForUpdate(ctx context.Context, tx *sqldb.Tx, institution, level uint64) (*models.Level, error) {
+	query := fmt.Sprintf("SELECT %s FROM levels WHERE id = $1 AND institution = $2 FOR UPDATE;", levelFields)
+	return scanLevel(tx.QueryRow(ctx, query, level, institution))
+}
+
+func queryLevels(ctx context.Context, query string, args ...any) (ans []*models.Level, err error) {
+	rows, err := db.Query(ctx, query, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var l *models.Level
+		if l, err = scanLevel(rows); err != nil {
+			return
+		}
+		ans = append(ans, l)
+	}
+	err = rows.Err()
+	return
+}
+
+func scanLevel(row rowScanner) (*models.Level, error) {
+	l := new(models.Level)
+	if err := row.Scan(&l.Id, &l.Institution, &l.Name, &l.Code, &l.Description, &l.Position, &l.Capacity, &l.Prerequisite, &l.GradingScale, &l.ArchivedAt, &l.CreatedAt, &l.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func levelsToDto(levels ...*models.Level) (ans []dto.Level) {
+	ans = make([]dto.Level, 0, len(levels))
+	for _, l := range levels {
+		v := dto.Level{
+			Id:          l.Id,
+			Institution: l.Institution,
+			Name:        l.Name,
+			Position:    l.Position,
+			Archived:    l.ArchivedAt.Valid,
+			CreatedAt:   l.CreatedAt,
+			UpdatedAt:   l.UpdatedAt,
+		}
+		if l.Code.Valid {
+			v.Code = &l.Code.String
+		}
+		if l.Description.Valid {
+			v.Description = &l.Description.String
+		}
+		if l.Capacity.Valid {
+			capacity := int(l.Capacity.Int32)
+			v.Capacity = &capacity
+		}
+		if l.Prerequisite.Valid {
+			prerequisite := uint64(l.Prerequisite.Int64)
+			v.Prerequisite = &prerequisite
+		}
+		if l.GradingScale.Valid {
+			scale := uint64(l.GradingScale.Int64)
+			v.GradingScale = &scale
+		}
+		if l.ArchivedAt.Valid {
+			v.ArchivedAt = &l.ArchivedAt.Time
+		}
+		ans = append(ans, v)
+	}
+	return
+}
@@ -0,0 +1,116 @@
+package institutions_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"encore.dev/beta/errs"
+
+	"github.com/brinestone/scholaris/dto"
+	"github.com/brinestone/scholaris/institutions"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLevels(t *testing.T) {
+	i, err := makeInstitution()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	names := []string{"Form 1", "Form 2", "Form 3"}
+	ids := make([]uint64, 0, len(names))
+	for _, name := range names {
+		req := dto.NewLevelRequest{Name: name}
+		if len(ids) > 0 {
+			req.Prerequisite = &ids[len(ids)-1]
+		}
+		level, err := institutions.CreateLevel(mainContext, i.Id, req)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		assert.Equal(t, len(ids)+1, level.Position)
+		ids = append(ids, level.Id)
+	}
+
+	_, err = institutions.CreateLevel(mainContext, i.Id, dto.NewLevelRequest{Name: "form 1"})
+	assert.NotNil(t, err)
+
+	_, err = institutions.UpdateLevel(mainContext, i.Id, ids[0], dto.UpdateLevelRequest{Prerequisite: &ids[2]})
+	assert.NotNil(t, err)
+
+	res, err := institutions.ReorderLevels(mainContext, i.Id, dto.ReorderLevelsRequest{Levels: []uint64{ids[2], ids[1], ids[0]}})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.Equal(t, ids[2], res.Levels[0].Id)
+
+	// Form 2 is the prerequisite of Form 3
+	deletion, err := institutions.DeleteLevel(mainContext, i.Id, ids[1])
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.True(t, deletion.Archived)
+
+	deletion, err = institutions.DeleteLevel(mainContext, i.Id, ids[2])
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.False(t, deletion.Archived)
+
+	res, err = institutions.FindLevels(mainContext, i.Id, dto.FindLevelsRequest{})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.Len(t, res.Levels, 1)
+	assert.Equal(t, 1, res.Levels[0].Position)
+}
+
+func TestLevelCapacity(t *testing.T) {
+	i, err := makeInstitution()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	capacity := 1
+	level, err := institutions.CreateLevel(mainContext, i.Id, dto.NewLevelRequest{Name: "Form 1", Capacity: &capacity})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	// The year ended about a year ago, so enrollments made before it no longer count
+	year, err := makeAcademicYear(i.Id)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if err = institutions.MoveAcademicYear(context.TODO(), year.Id, -2*365*24*time.Hour); err != nil {
+		t.Error(err)
+		return
+	}
+
+	now := time.Now()
+	if _, err = institutions.AddLevelEnrollment(context.TODO(), i.Id, level.Id, dto.ESAccepted, now.AddDate(-3, 0, 0)); err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err = institutions.AddLevelEnrollment(context.TODO(), i.Id, level.Id, dto.ESRejected, now); err != nil {
+		t.Error(err)
+		return
+	}
+	assert.Nil(t, institutions.AssertLevelOpen(context.TODO(), i.Id, level.Id))
+
+	if _, err = institutions.AddLevelEnrollment(context.TODO(), i.Id, level.Id, dto.ESPending, now); err != nil {
+		t.Error(err)
+		return
+	}
+	assert.Equal(t, errs.ResourceExhausted, errs.Code(institutions.AssertLevelOpen(context.TODO(), i.Id, level.Id)))
+}
@@ -238,3 +238,234 @@ func AllowedToCreateInstitutionMiddleware(req middleware.Request, next middlewar
 
 	return next(req)
 }
+
+// Validates a user's permission to update an institution
+//
+//encore:middleware target=tag:can_update_institution
+func AllowedToUpdateInstitution(req middleware.Request, next middleware.Next) middleware.Response {
+	return checkInstitutionPermission(req, next, dto.PNCanUpdate)
+}
+
+// Validates a user's permission to archive or delete an institution
+//
+//encore:middleware target=tag:can_delete_institution
+func AllowedToDeleteInstitution(req middleware.Request, next middleware.Next) middleware.Response {
+	return checkInstitutionPermission(req, next, dto.PNCanDelete)
+}
+
+// Rejects changes to archived institutions
+//
+//encore:middleware target=tag:institution_writable
+func InstitutionWritable(req middleware.Request, next middleware.Next) middleware.Response {
+	identifier := req.Data().PathParams.Get("id")
+	if ownerInfo, ok := req.Data().Payload.(models.OwnerInfo); ok {
+		identifier = fmt.Sprintf("%d", ownerInfo.GetOwner())
+	}
+
+	institution, err := findInstitutionByGenericIdentifier(req.Context(), identifier)
+	if err != nil {
+		return middleware.Response{
+			Err: err,
+		}
+	}
+
+	if institution.Archived {
+		return middleware.Response{
+			Err: &errs.Error{
+				Code:    errs.FailedPrecondition,
+				Message: "This institution is archived and cannot be changed",
+			},
+		}
+	}
+
+	return next(req)
+}
+
+// Validates that a user is a member of an institution
+//
+//encore:middleware target=tag:institution_member
+func InstitutionMember(req middleware.Request, next middleware.Next) middleware.Response {
+	return checkInstitutionPermission(req, next, dto.PNMember)
+}
+
+// Validates a user's permission to view a class and its members
+//
+//encore:middleware target=tag:can_view_class
+func AllowedToViewClass(req middleware.Request, next middleware.Next) middleware.Response {
+	return checkObjectPermission(req, next, dto.PTClass, "class", dto.PNCanView)
+}
+
+// Validates a user's permission to change an academic year and insert terms into it
+//
+//encore:middleware target=tag:can_edit_academic_year
+func AllowedToEditAcademicYear(req middleware.Request, next middleware.Next) middleware.Response {
+	return checkObjectPermission(req, next, dto.PTAcademicYear, "year", dto.PNCanEdit)
+}
+
+// Validates a user's permission to delete an academic year
+//
+//encore:middleware target=tag:can_delete_academic_year
+func AllowedToDeleteAcademicYear(req middleware.Request, next middleware.Next) middleware.Response {
+	return checkObjectPermission(req, next, dto.PTAcademicYear, "year", dto.PNCanDelete)
+}
+
+// Validates a user's permission to change an academic term
+//
+//encore:middleware target=tag:can_edit_academic_term
+func AllowedToEditAcademicTerm(req middleware.Request, next middleware.Next) middleware.Response {
+	return checkObjectPermission(req, next, dto.PTAcademicTerm, "term", dto.PNCanEdit)
+}
+
+// Validates a user's permission to delete an academic term
+//
+//encore:middleware target=tag:can_delete_academic_term
+func AllowedToDeleteAcademicTerm(req middleware.Request, next middleware.Next) middleware.Response {
+	return checkObjectPermission(req, next, dto.PTAcademicTerm, "term", dto.PNCanDelete)
+}
+
+// Validates a user's permission to manage the student records of an institution
+//
+//encore:middleware target=tag:can_manage_students
+func AllowedToManageStudents(req middleware.Request, next middleware.Next) middleware.Response {
+	return checkInstitutionPermission(req, next, dto.PNCanManageStudents)
+}
+
+// Validates a user's permission to manage the rooms and timetables of an institution
+//
+//encore:middleware target=tag:can_manage_timetables
+func AllowedToManageTimetables(req middleware.Request, next middleware.Next) middleware.Response {
+	return checkInstitutionPermission(req, next, dto.PNCanManageTimetables)
+}
+
+// Validates a user's permission to view a student record
+//
+//encore:middleware target=tag:can_view_student
+func AllowedToViewStudent(req middleware.Request, next middleware.Next) middleware.Response {
+	return checkObjectPermission(req, next, dto.PTStudentRecord, "student", dto.PNCanView)
+}
+
+// Validates a user's permission to view the medical notes of a student
+//
+//encore:middleware target=tag:can_view_student_medical
+func AllowedToViewStudentMedical(req middleware.Request, next middleware.Next) middleware.Response {
+	return checkObjectPermission(req, next, dto.PTStudentRecord, "student", dto.PNCanViewMedical)
+}
+
+// Validates a user's permission to record and delete the medical notes of a student
+//
+//encore:middleware target=tag:can_edit_student_medical
+func AllowedToEditStudentMedical(req middleware.Request, next middleware.Next) middleware.Response {
+	return checkObjectPermission(req, next, dto.PTStudentRecord, "student", dto.PNCanEditMedical)
+}
+
+// Validates a user's permission to create assessments and record scores for a course
+//
+//encore:middleware target=tag:can_grade_course
+func AllowedToGradeCourse(req middleware.Request, next middleware.Next) middleware.Response {
+	return checkObjectPermission(req, next, dto.PTCourse, "course", dto.PNCanGrade)
+}
+
+// Validates a user's permission to view the assessments and scores of a course
+//
+//encore:middleware target=tag:can_view_course
+func AllowedToViewCourse(req middleware.Request, next middleware.Next) middleware.Response {
+	return checkObjectPermission(req, next, dto.PTCourse, "course", dto.PNCanView)
+}
+
+// Validates a user's permission to view the averages and rankings of a class
+//
+//encore:middleware target=tag:can_view_class_results
+func AllowedToViewClassResults(req middleware.Request, next middleware.Next) middleware.Response {
+	return checkObjectPermission(req, next, dto.PTClass, "class", dto.PNCanViewResults)
+}
+
+// Validates a user's permission to write the remarks on the students of a class
+//
+//encore:middleware target=tag:can_write_class_remarks
+func AllowedToWriteClassRemarks(req middleware.Request, next middleware.Next) middleware.Response {
+	return checkObjectPermission(req, next, dto.PTClass, "class", dto.PNCanWriteRemarks)
+}
+
+// Validates a user's permission to manage the grades of a class, such as issuing its report cards
+//
+//encore:middleware target=tag:can_manage_class_grades
+func AllowedToManageClassGrades(req middleware.Request, next middleware.Next) middleware.Response {
+	return checkObjectPermission(req, next, dto.PTClass, "class", dto.PNCanManageGrades)
+}
+
+// Validates a user's permission to take and view the attendance of a class
+//
+//encore:middleware target=tag:can_take_attendance
+func AllowedToTakeAttendance(req middleware.Request, next middleware.Next) middleware.Response {
+	return checkObjectPermission(req, next, dto.PTClass, "class", dto.PNCanTakeAttendance)
+}
+
+// Checks a user's relation to the object identified by a path parameter
+func checkObjectPermission(req middleware.Request, next middleware.Next, objectType dto.PermissionType, param string, relation dto.PermissionName) middleware.Response {
+	uid, _ := auth.UserID()
+	res, err := permissions.CheckPermissionInternal(req.Context(), dto.InternalRelationCheckRequest{
+		Actor:    dto.IdentifierString(dto.PTUser, uid),
+		Relation: relation,
+		Target:   dto.IdentifierString(objectType, req.Data().PathParams.Get(param)),
+	})
+	if err != nil {
+		rlog.Error(util.MsgCallError, "err", err)
+		return middleware.Response{
+			Err: &util.ErrUnknown,
+		}
+	}
+	if !res.Allowed {
+		return middleware.Response{
+			Err: &util.ErrForbidden,
+		}
+	}
+
+	return next(req)
+}
+
+func checkInstitutionPermission(req middleware.Request, next middleware.Next, relation dto.PermissionName) middleware.Response {
+	uid, _ := auth.UserID()
+	res, err := permissions.CheckPermissionInternal(req.Context(), dto.InternalRelationCheckRequest{
+		Actor:    dto.IdentifierString(dto.PTUser, uid),
+		Relation: relation,
+		Target:   dto.IdentifierString(dto.PTInstitution, req.Data().PathParams.Get("id")),
+	})
+	if err != nil {
+		rlog.Error(util.MsgCallError, "err", err)
+		return middleware.Response{
+			Err: &util.ErrUnknown,
+		}
+	}
+	if !res.Allowed {
+		return middleware.Response{
+			Err: &util.ErrForbidden,
+		}
+	}
+
+	return next(req)
+}
+
+// Validates a user's permission to review institution verification requests
+//
+//encore:middleware target=tag:can_review_institutions
+func AllowedToReviewInstitutions(req middleware.Request, next middleware.Next) middleware.Response {
+	uid, _ := auth.UserID()
+	res, err := permissions.CheckPermissionInternal(req.Context(), dto.InternalRelationCheckRequest{
+		Actor:    dto.IdentifierString(dto.PTUser, uid),
+		Relation: dto.PNCanReviewInstitutions,
+		Target:   dto.IdentifierString(dto.PTPlatform, dto.PlatformId),
+	})
+	if err != nil {
+		rlog.Error(util.MsgCallError, "err", err)
+		return middleware.Response{
+			Err: &util.ErrUnknown,
+		}
+	}
+	if !res.Allowed {
+		return middleware.Response{
+			Err: &util.ErrForbidden,
+		}
+	}
+
+	return next(req)
+}
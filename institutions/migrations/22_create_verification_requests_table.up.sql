@@ -0,0 +1,21 @@
+CREATE TABLE
+    verification_requests (
+        id BIGSERIAL PRIMARY KEY,
+        institution BIGINT NOT NULL,
+        submitted_by BIGINT NOT NULL,
+        documents TEXT[] NOT NULL DEFAULT '{}',
+        notes TEXT,
+        status TEXT NOT NULL DEFAULT 'pending',
+        reviewed_by BIGINT,
+        review_reason TEXT,
+        reviewed_at TIMESTAMP,
+        revoked_by BIGINT,
+        revoke_reason TEXT,
+        revoked_at TIMESTAMP,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        FOREIGN KEY (institution) REFERENCES institutions (id) ON DELETE CASCADE
+    );
+
+CREATE UNIQUE INDEX IDX_UQ_verification_requests_pending ON verification_requests (institution)
+WHERE
+    status = 'pending';
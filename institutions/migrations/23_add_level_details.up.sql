@@ -0,0 +1,19 @@
+ALTER TABLE levels
+ADD COLUMN code TEXT,
+ADD COLUMN description TEXT,
+ADD COLUMN position INT NOT NULL DEFAULT 0,
+ADD COLUMN capacity INT,
+ADD COLUMN prerequisite BIGINT,
+ADD COLUMN archived_at TIMESTAMP DEFAULT NULL,
+ADD COLUMN created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+ADD COLUMN updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+ADD CONSTRAINT levels_prerequisite_fkey FOREIGN KEY (prerequisite) REFERENCES levels (id) ON DELETE SET NULL;
+
+CREATE UNIQUE INDEX IDX_UQ_levels_name ON levels (institution, LOWER(name))
+WHERE
+    archived_at IS NULL;
+
+-- Levels in use are archived, they must not take their enrollment forms with them
+ALTER TABLE enrollment_forms
+DROP CONSTRAINT enrollment_forms_level_fkey,
+ADD CONSTRAINT enrollment_forms_level_fkey FOREIGN KEY (level) REFERENCES levels (id) ON DELETE RESTRICT;
@@ -0,0 +1,42 @@
+CREATE TABLE
+    classes (
+        id BIGSERIAL PRIMARY KEY,
+        institution BIGINT NOT NULL,
+        level BIGINT NOT NULL,
+        academic_year BIGINT NOT NULL,
+        name TEXT NOT NULL,
+        stream TEXT,
+        capacity INT,
+        homeroom_teacher BIGINT,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        FOREIGN KEY (institution) REFERENCES institutions (id) ON DELETE CASCADE,
+        FOREIGN KEY (level) REFERENCES levels (id),
+        -- Deleting an academic year must not silently take its classes and their placements with it. NO ACTION rather
+        -- than RESTRICT lets an institution's deletion still cascade to both in the same statement.
+        FOREIGN KEY (academic_year) REFERENCES academic_years (id) ON DELETE NO ACTION
+    );
+
+CREATE UNIQUE INDEX IDX_UQ_classes_name ON classes (academic_year, level, LOWER(name));
+
+CREATE TABLE
+    class_placements (
+        id BIGSERIAL PRIMARY KEY,
+        class BIGINT NOT NULL,
+        academic_year BIGINT NOT NULL,
+        student BIGINT NOT NULL,
+        placed_by BIGINT NOT NULL,
+        placed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        removed_at TIMESTAMP,
+        removed_by BIGINT,
+        removal_reason TEXT,
+        removal_note TEXT,
+        transferred_to BIGINT,
+        FOREIGN KEY (class) REFERENCES classes (id) ON DELETE CASCADE,
+        FOREIGN KEY (transferred_to) REFERENCES classes (id) ON DELETE SET NULL
+    );
+
+-- A student sits in a single class per academic year
+CREATE UNIQUE INDEX IDX_UQ_class_placements_active ON class_placements (academic_year, student)
+WHERE
+    removed_at IS NULL;
@@ -0,0 +1,39 @@
+CREATE TABLE
+    calendar_events (
+        id BIGSERIAL PRIMARY KEY,
+        institution BIGINT NOT NULL,
+        academic_year BIGINT,
+        academic_term BIGINT,
+        title TEXT NOT NULL,
+        description TEXT,
+        location TEXT,
+        category TEXT NOT NULL DEFAULT 'other',
+        starts_at TIMESTAMP NOT NULL,
+        ends_at TIMESTAMP NOT NULL,
+        all_day BOOLEAN NOT NULL DEFAULT FALSE,
+        recurrence_frequency TEXT,
+        recurrence_interval INT NOT NULL DEFAULT 1,
+        recurrence_count INT,
+        recurrence_until TIMESTAMP,
+        audience TEXT NOT NULL DEFAULT 'all',
+        audience_ref BIGINT,
+        visibility TEXT NOT NULL DEFAULT 'members',
+        created_by BIGINT NOT NULL,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        FOREIGN KEY (institution) REFERENCES institutions (id) ON DELETE CASCADE,
+        FOREIGN KEY (academic_year) REFERENCES academic_years (id) ON DELETE CASCADE,
+        FOREIGN KEY (academic_term) REFERENCES academic_terms (id) ON DELETE CASCADE
+    );
+
+CREATE INDEX IDX_calendar_events_range ON calendar_events (institution, starts_at);
+
+-- Bumping the version of a feed invalidates the URLs signed for the previous one
+CREATE TABLE
+    calendar_feeds (
+        owner_type TEXT NOT NULL,
+        owner BIGINT NOT NULL,
+        version INT NOT NULL DEFAULT 1,
+        rotated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        PRIMARY KEY (owner_type, owner)
+    );
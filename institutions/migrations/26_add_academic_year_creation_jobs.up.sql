@@ -0,0 +1,48 @@
+-- The previous version compared the column with itself and returned the last academic year of any institution
+CREATE OR REPLACE FUNCTION func_get_last_academic_year (IN institution BIGINT) RETURNS SETOF vw_AllAcademicYears LANGUAGE plpgsql AS $$
+BEGIN
+    RETURN QUERY SELECT
+        *
+    FROM
+        vw_AllAcademicYears a
+    WHERE
+        a.institution_id=$1
+    ORDER BY
+        end_date DESC
+    LIMIT 1
+    ;
+END
+$$;
+
+-- Superseded by the per-institution creation schedules
+DROP FUNCTION IF EXISTS func_auto_create_academic_year;
+
+CREATE TABLE
+    academic_year_creation_schedules (
+        institution BIGINT NOT NULL,
+        enabled BOOLEAN NOT NULL DEFAULT FALSE,
+        next_run_at TIMESTAMP,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        PRIMARY KEY (institution),
+        FOREIGN KEY (institution) REFERENCES institutions (id) ON DELETE CASCADE
+    );
+
+CREATE INDEX IDX_academic_year_creation_schedules_due ON academic_year_creation_schedules (next_run_at)
+WHERE
+    enabled;
+
+CREATE TABLE
+    academic_year_creation_runs (
+        id BIGSERIAL,
+        institution BIGINT NOT NULL,
+        status TEXT NOT NULL,
+        reason TEXT,
+        academic_year BIGINT,
+        ran_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        PRIMARY KEY (id),
+        FOREIGN KEY (institution) REFERENCES institutions (id) ON DELETE CASCADE,
+        FOREIGN KEY (academic_year) REFERENCES academic_years (id) ON DELETE SET NULL
+    );
+
+CREATE INDEX IDX_academic_year_creation_runs_institution ON academic_year_creation_runs (institution, id DESC);
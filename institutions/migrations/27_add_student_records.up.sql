@@ -0,0 +1,84 @@
+ALTER TABLE enrollments
+ADD COLUMN status VARCHAR(20) NOT NULL DEFAULT 'pending',
+ADD COLUMN decided_by BIGINT,
+ADD COLUMN decision_reason TEXT,
+ADD COLUMN decided_at TIMESTAMP;
+
+-- The last matricule number handed out per institution and calendar year
+CREATE TABLE
+    student_matricule_sequences (
+        institution BIGINT NOT NULL,
+        year INT NOT NULL,
+        last_value INT NOT NULL DEFAULT 0,
+        PRIMARY KEY (institution, year),
+        FOREIGN KEY (institution) REFERENCES institutions (id) ON DELETE CASCADE
+    );
+
+CREATE TABLE
+    students (
+        id BIGSERIAL PRIMARY KEY,
+        institution BIGINT NOT NULL,
+        matricule TEXT NOT NULL,
+        enrollment BIGINT UNIQUE,
+        user_account BIGINT,
+        first_name TEXT NOT NULL,
+        last_name TEXT NOT NULL,
+        gender VARCHAR(10),
+        date_of_birth DATE,
+        place_of_birth TEXT,
+        nationality TEXT,
+        address TEXT,
+        phone TEXT,
+        email TEXT,
+        status VARCHAR(20) NOT NULL DEFAULT 'active',
+        created_by BIGINT,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        FOREIGN KEY (institution) REFERENCES institutions (id) ON DELETE CASCADE,
+        FOREIGN KEY (enrollment) REFERENCES enrollments (id) ON DELETE SET NULL
+    );
+
+CREATE UNIQUE INDEX IDX_UQ_students_matricule ON students (institution, matricule);
+
+-- An account is linked to a single record per institution
+CREATE UNIQUE INDEX IDX_UQ_students_account ON students (institution, user_account)
+WHERE
+    user_account IS NOT NULL;
+
+CREATE TABLE
+    student_status_changes (
+        id BIGSERIAL PRIMARY KEY,
+        student BIGINT NOT NULL,
+        status VARCHAR(20) NOT NULL,
+        previous_status VARCHAR(20),
+        reason TEXT,
+        changed_by BIGINT,
+        changed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        FOREIGN KEY (student) REFERENCES students (id) ON DELETE CASCADE
+    );
+
+CREATE TABLE
+    student_guardians (
+        id BIGSERIAL PRIMARY KEY,
+        student BIGINT NOT NULL,
+        name TEXT NOT NULL,
+        relationship VARCHAR(30) NOT NULL,
+        phone TEXT,
+        email TEXT,
+        address TEXT,
+        is_primary BOOLEAN NOT NULL DEFAULT FALSE,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        FOREIGN KEY (student) REFERENCES students (id) ON DELETE CASCADE
+    );
+
+CREATE TABLE
+    student_medical_notes (
+        id BIGSERIAL PRIMARY KEY,
+        student BIGINT NOT NULL,
+        category VARCHAR(20) NOT NULL,
+        note TEXT NOT NULL,
+        recorded_by BIGINT NOT NULL,
+        recorded_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        FOREIGN KEY (student) REFERENCES students (id) ON DELETE CASCADE
+    );
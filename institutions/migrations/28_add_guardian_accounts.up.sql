@@ -0,0 +1,36 @@
+UPDATE student_guardians
+SET
+    relationship = CASE
+        WHEN LOWER(relationship) IN ('mother', 'father', 'legal_guardian') THEN LOWER(relationship)
+        ELSE 'other'
+    END;
+
+ALTER TABLE student_guardians
+ADD COLUMN user_account BIGINT,
+ADD COLUMN linked_at TIMESTAMP;
+
+-- An account is linked to a student through a single guardian
+CREATE UNIQUE INDEX IDX_UQ_student_guardians_account ON student_guardians (student, user_account)
+WHERE
+    user_account IS NOT NULL;
+
+CREATE TABLE
+    guardian_invitations (
+        id BIGSERIAL PRIMARY KEY,
+        guardian BIGINT NOT NULL,
+        email TEXT NOT NULL,
+        token_hash TEXT NOT NULL,
+        invited_by BIGINT NOT NULL,
+        expires_at TIMESTAMP NOT NULL,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        accepted_at TIMESTAMP,
+        accepted_by BIGINT,
+        revoked_at TIMESTAMP,
+        FOREIGN KEY (guardian) REFERENCES student_guardians (id) ON DELETE CASCADE
+    );
+
+-- A guardian has a single pending invitation
+CREATE UNIQUE INDEX IDX_UQ_guardian_invitations_pending ON guardian_invitations (guardian)
+WHERE
+    accepted_at IS NULL
+    AND revoked_at IS NULL;
@@ -0,0 +1,98 @@
+CREATE TABLE
+    grading_scales (
+        id BIGSERIAL PRIMARY KEY,
+        institution BIGINT NOT NULL,
+        name TEXT NOT NULL,
+        min_score NUMERIC(7, 2) NOT NULL DEFAULT 0,
+        max_score NUMERIC(7, 2) NOT NULL,
+        passing_score NUMERIC(7, 2) NOT NULL,
+        decimals INT NOT NULL DEFAULT 2,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        FOREIGN KEY (institution) REFERENCES institutions (id) ON DELETE CASCADE,
+        CHECK (
+            min_score < max_score
+            AND passing_score BETWEEN min_score AND max_score
+        )
+    );
+
+CREATE UNIQUE INDEX IDX_UQ_grading_scales_name ON grading_scales (institution, LOWER(name));
+
+-- Levels without a scale are graded out of 20
+ALTER TABLE levels
+ADD COLUMN grading_scale BIGINT,
+ADD CONSTRAINT levels_grading_scale_fkey FOREIGN KEY (grading_scale) REFERENCES grading_scales (id) ON DELETE RESTRICT;
+
+CREATE TABLE
+    subjects (
+        id BIGSERIAL PRIMARY KEY,
+        institution BIGINT NOT NULL,
+        level BIGINT NOT NULL,
+        name TEXT NOT NULL,
+        code TEXT,
+        coefficient NUMERIC(5, 2) NOT NULL DEFAULT 1,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        FOREIGN KEY (institution) REFERENCES institutions (id) ON DELETE CASCADE,
+        FOREIGN KEY (level) REFERENCES levels (id) ON DELETE CASCADE,
+        CHECK (coefficient > 0)
+    );
+
+CREATE UNIQUE INDEX IDX_UQ_subjects_name ON subjects (level, LOWER(name));
+
+-- A subject taught in a class
+CREATE TABLE
+    courses (
+        id BIGSERIAL PRIMARY KEY,
+        class BIGINT NOT NULL,
+        subject BIGINT NOT NULL,
+        teacher BIGINT,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        UNIQUE (class, subject),
+        FOREIGN KEY (class) REFERENCES classes (id) ON DELETE CASCADE,
+        FOREIGN KEY (subject) REFERENCES subjects (id) ON DELETE RESTRICT
+    );
+
+CREATE TABLE
+    assessments (
+        id BIGSERIAL PRIMARY KEY,
+        course BIGINT NOT NULL,
+        academic_term BIGINT NOT NULL,
+        title TEXT NOT NULL,
+        kind VARCHAR(20) NOT NULL DEFAULT 'test',
+        max_score NUMERIC(7, 2) NOT NULL,
+        weight NUMERIC(5, 2) NOT NULL DEFAULT 1,
+        held_on DATE,
+        created_by BIGINT NOT NULL,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        FOREIGN KEY (course) REFERENCES courses (id) ON DELETE CASCADE,
+        -- Deleting an academic term must not silently take its assessments and their scores with it
+        FOREIGN KEY (academic_term) REFERENCES academic_terms (id) ON DELETE NO ACTION,
+        CHECK (
+            max_score > 0
+            AND weight > 0
+        )
+    );
+
+CREATE INDEX IDX_assessments_course ON assessments (course, academic_term);
+
+-- Students marked absent without a score are left out of their averages
+CREATE TABLE
+    assessment_scores (
+        assessment BIGINT NOT NULL,
+        student BIGINT NOT NULL,
+        score NUMERIC(7, 2),
+        absent BOOLEAN NOT NULL DEFAULT FALSE,
+        comment TEXT,
+        recorded_by BIGINT NOT NULL,
+        recorded_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        PRIMARY KEY (assessment, student),
+        FOREIGN KEY (assessment) REFERENCES assessments (id) ON DELETE CASCADE,
+        FOREIGN KEY (student) REFERENCES students (id) ON DELETE CASCADE,
+        CHECK (
+            score IS NOT NULL
+            OR absent
+        )
+    );
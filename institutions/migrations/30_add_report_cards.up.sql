@@ -0,0 +1,68 @@
+-- Remarks on a student's term, written on a course by its teacher or, without a course, on the whole class
+CREATE TABLE
+    report_card_remarks (
+        id BIGSERIAL PRIMARY KEY,
+        class BIGINT NOT NULL,
+        academic_term BIGINT NOT NULL,
+        student BIGINT NOT NULL,
+        course BIGINT,
+        remark TEXT NOT NULL,
+        written_by BIGINT NOT NULL,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        FOREIGN KEY (class) REFERENCES classes (id) ON DELETE CASCADE,
+        FOREIGN KEY (academic_term) REFERENCES academic_terms (id) ON DELETE CASCADE,
+        FOREIGN KEY (student) REFERENCES students (id) ON DELETE CASCADE,
+        FOREIGN KEY (course) REFERENCES courses (id) ON DELETE CASCADE
+    );
+
+CREATE UNIQUE INDEX IDX_UQ_report_card_remarks ON report_card_remarks (class, academic_term, student, COALESCE(course, 0));
+
+CREATE TABLE
+    report_card_jobs (
+        id BIGSERIAL PRIMARY KEY,
+        class BIGINT NOT NULL,
+        academic_term BIGINT NOT NULL,
+        -- The students whose report cards are generated, the whole class when absent
+        students BIGINT[],
+        status VARCHAR(20) NOT NULL DEFAULT 'pending',
+        total INT NOT NULL DEFAULT 0,
+        generated INT NOT NULL DEFAULT 0,
+        failed INT NOT NULL DEFAULT 0,
+        error TEXT,
+        requested_by BIGINT NOT NULL,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        started_at TIMESTAMP,
+        completed_at TIMESTAMP,
+        FOREIGN KEY (class) REFERENCES classes (id) ON DELETE CASCADE,
+        FOREIGN KEY (academic_term) REFERENCES academic_terms (id) ON DELETE CASCADE
+    );
+
+CREATE UNIQUE INDEX IDX_UQ_report_card_jobs_active ON report_card_jobs (class, academic_term)
+WHERE
+    status IN ('pending', 'in_progress');
+
+-- The latest report card of a student for a term, its document being a shared file in the blob service
+CREATE TABLE
+    report_cards (
+        id BIGSERIAL PRIMARY KEY,
+        class BIGINT NOT NULL,
+        academic_term BIGINT NOT NULL,
+        student BIGINT NOT NULL,
+        job BIGINT,
+        file_key TEXT NOT NULL,
+        average NUMERIC(7, 2),
+        rank INT,
+        generated_by BIGINT NOT NULL,
+        generated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        UNIQUE (academic_term, student),
+        -- The documents are shared through the authorization store, so deleting their term, class or student must not
+        -- silently drop the rows pointing at them. NO ACTION rather than RESTRICT lets an institution's deletion remove
+        -- them along with the rest of its records.
+        FOREIGN KEY (class) REFERENCES classes (id) ON DELETE NO ACTION,
+        FOREIGN KEY (academic_term) REFERENCES academic_terms (id) ON DELETE NO ACTION,
+        FOREIGN KEY (student) REFERENCES students (id) ON DELETE NO ACTION,
+        FOREIGN KEY (job) REFERENCES report_card_jobs (id) ON DELETE SET NULL
+    );
+
+CREATE INDEX IDX_report_cards_class ON report_cards (class, academic_term);
@@ -0,0 +1,56 @@
+-- A roll call of a class, for the whole day when it has no period or for a single period of the day
+CREATE TABLE
+    attendance_sessions (
+        id BIGSERIAL PRIMARY KEY,
+        class BIGINT NOT NULL,
+        academic_term BIGINT NOT NULL,
+        date DATE NOT NULL,
+        period INT,
+        course BIGINT,
+        taken_by BIGINT NOT NULL,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        FOREIGN KEY (class) REFERENCES classes (id) ON DELETE CASCADE,
+        -- Deleting an academic term must not silently take its attendance with it
+        FOREIGN KEY (academic_term) REFERENCES academic_terms (id) ON DELETE NO ACTION,
+        FOREIGN KEY (course) REFERENCES courses (id) ON DELETE SET NULL,
+        CHECK (
+            period IS NULL
+            OR period > 0
+        )
+    );
+
+CREATE UNIQUE INDEX IDX_UQ_attendance_sessions ON attendance_sessions (class, date, COALESCE(period, 0));
+
+CREATE INDEX IDX_attendance_sessions_term ON attendance_sessions (academic_term, class);
+
+CREATE TABLE
+    attendance_records (
+        session BIGINT NOT NULL,
+        student BIGINT NOT NULL,
+        status VARCHAR(10) NOT NULL,
+        note TEXT,
+        recorded_by BIGINT NOT NULL,
+        recorded_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        PRIMARY KEY (session, student),
+        FOREIGN KEY (session) REFERENCES attendance_sessions (id) ON DELETE CASCADE,
+        FOREIGN KEY (student) REFERENCES students (id) ON DELETE CASCADE,
+        CHECK (status IN ('present', 'absent', 'late', 'excused'))
+    );
+
+CREATE INDEX IDX_attendance_records_student ON attendance_records (student);
+
+-- The absence thresholds a student reached in a term, so that their guardians are notified once per threshold
+CREATE TABLE
+    attendance_alerts (
+        id BIGSERIAL PRIMARY KEY,
+        student BIGINT NOT NULL,
+        academic_term BIGINT NOT NULL,
+        threshold INT NOT NULL,
+        absences INT NOT NULL,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        notified_at TIMESTAMP,
+        UNIQUE (student, academic_term, threshold),
+        FOREIGN KEY (student) REFERENCES students (id) ON DELETE CASCADE,
+        FOREIGN KEY (academic_term) REFERENCES academic_terms (id) ON DELETE NO ACTION
+    );
@@ -0,0 +1,82 @@
+ALTER TABLE subjects
+ADD COLUMN weekly_periods INT NOT NULL DEFAULT 0,
+ADD CONSTRAINT subjects_weekly_periods_check CHECK (weekly_periods >= 0);
+
+CREATE TABLE
+    rooms (
+        id BIGSERIAL PRIMARY KEY,
+        institution BIGINT NOT NULL,
+        name TEXT NOT NULL,
+        capacity INT,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        FOREIGN KEY (institution) REFERENCES institutions (id) ON DELETE CASCADE,
+        CHECK (
+            capacity IS NULL
+            OR capacity > 0
+        )
+    );
+
+CREATE UNIQUE INDEX IDX_UQ_rooms_name ON rooms (institution, LOWER(name));
+
+-- The weekly timetable of an institution for a term
+CREATE TABLE
+    timetables (
+        id BIGSERIAL PRIMARY KEY,
+        institution BIGINT NOT NULL,
+        academic_term BIGINT NOT NULL UNIQUE,
+        -- The ISO days of the week classes are held on, 1 being Monday
+        days INT[] NOT NULL,
+        created_by BIGINT NOT NULL,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        FOREIGN KEY (institution) REFERENCES institutions (id) ON DELETE CASCADE,
+        -- Deleting an academic term must not silently take its timetable and slots with it
+        FOREIGN KEY (academic_term) REFERENCES academic_terms (id) ON DELETE NO ACTION
+    );
+
+CREATE TABLE
+    timetable_periods (
+        timetable BIGINT NOT NULL,
+        number INT NOT NULL,
+        label TEXT,
+        starts_at TIME NOT NULL,
+        ends_at TIME NOT NULL,
+        PRIMARY KEY (timetable, number),
+        FOREIGN KEY (timetable) REFERENCES timetables (id) ON DELETE CASCADE,
+        CHECK (
+            number > 0
+            AND starts_at < ends_at
+        )
+    );
+
+-- A course taught to a class during a period of a day of the week
+CREATE TABLE
+    timetable_slots (
+        id BIGSERIAL PRIMARY KEY,
+        timetable BIGINT NOT NULL,
+        class BIGINT NOT NULL,
+        day INT NOT NULL,
+        period INT NOT NULL,
+        course BIGINT NOT NULL,
+        teacher BIGINT,
+        room BIGINT,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        FOREIGN KEY (timetable, period) REFERENCES timetable_periods (timetable, number) ON DELETE CASCADE,
+        FOREIGN KEY (class) REFERENCES classes (id) ON DELETE CASCADE,
+        FOREIGN KEY (course) REFERENCES courses (id) ON DELETE CASCADE,
+        FOREIGN KEY (room) REFERENCES rooms (id) ON DELETE RESTRICT,
+        CHECK (day BETWEEN 1 AND 7)
+    );
+
+-- A class, a teacher and a room are in a single place at a time
+CREATE UNIQUE INDEX IDX_UQ_timetable_slots_class ON timetable_slots (timetable, class, day, period);
+
+CREATE UNIQUE INDEX IDX_UQ_timetable_slots_teacher ON timetable_slots (timetable, teacher, day, period)
+WHERE
+    teacher IS NOT NULL;
+
+CREATE UNIQUE INDEX IDX_UQ_timetable_slots_room ON timetable_slots (timetable, room, day, period)
+WHERE
+    room IS NOT NULL;
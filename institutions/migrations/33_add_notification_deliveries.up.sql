@@ -0,0 +1,8 @@
+-- The recipients a notification was emailed to, so that a redelivered event only emails those who were missed
+CREATE TABLE
+    notification_deliveries (
+        notification TEXT NOT NULL,
+        recipient BIGINT NOT NULL,
+        sent_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        PRIMARY KEY (notification, recipient)
+    );
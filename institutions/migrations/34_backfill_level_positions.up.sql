@@ -0,0 +1,32 @@
+-- Levels created before they could be ordered were all left at position 0. Number the active levels of their
+-- institutions from 1, keeping the levels which were already ordered after them.
+UPDATE levels l
+SET
+    position = o.position
+FROM
+    (
+        SELECT
+            id,
+            ROW_NUMBER() OVER (
+                PARTITION BY
+                    institution
+                ORDER BY
+                    position,
+                    id
+            ) AS position
+        FROM
+            levels
+        WHERE
+            archived_at IS NULL
+            AND institution IN (
+                SELECT
+                    institution
+                FROM
+                    levels
+                WHERE
+                    position = 0
+                    AND archived_at IS NULL
+            )
+    ) o
+WHERE
+    l.id = o.id;
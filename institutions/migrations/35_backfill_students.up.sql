@@ -0,0 +1,28 @@
+-- Enrollments placed in an academic year were admitted before enrollments could be decided on
+UPDATE enrollments e
+SET
+    status = 'accepted',
+    decided_at = e.updated_at
+WHERE
+    e.status = 'pending'
+    AND EXISTS (
+        SELECT
+            1
+        FROM
+            enrollment_sessions s
+        WHERE
+            s.enrollment = e.id
+    );
+
+-- Students admitted before student records existed only have their role in the
+-- authorization store. Their records are created by the backfill-students job.
+ALTER TABLE institutions
+ADD COLUMN students_backfilled BOOLEAN NOT NULL DEFAULT true;
+
+UPDATE institutions
+SET
+    students_backfilled = false;
+
+CREATE INDEX idx_institutions_students_backfill ON institutions (id)
+WHERE
+    NOT students_backfilled;
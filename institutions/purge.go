@@ -0,0 +1,158 @@
+package institutions
+
+import (
+	"context"
+
+	"encore.dev/storage/sqldb"
+	"github.com/brinestone/scholaris/blob"
+	"github.com/brinestone/scholaris/core/permissions"
+	"github.com/brinestone/scholaris/dto"
+	"github.com/brinestone/scholaris/forms"
+	"github.com/brinestone/scholaris/settings"
+	"github.com/lib/pq"
+)
+
+// Deletes institutions along with everything they own, in this and the other services
+func purgeInstitutions(ctx context.Context, ids ...uint64) (err error) {
+	if len(ids) == 0 {
+		return
+	}
+
+	if err = purgeInstitutionOwnedData(ctx, ids...); err != nil {
+		return
+	}
+
+	_, err = deleteInstitutions(ctx, ids...)
+	return
+}
+
+// Deletes the forms, settings and uploads owned by institutions in the other services
+func purgeInstitutionOwnedData(ctx context.Context, ids ...uint64) (err error) {
+	owned := dto.PurgeOwnedRequest{OwnerType: dto.PTInstitution, Owners: ids}
+	if _, err = forms.PurgeOwnedForms(ctx, owned); err != nil {
+		return
+	}
+	if _, err = settings.PurgeOwnedSettings(ctx, owned); err != nil {
+		return
+	}
+	_, err = blob.PurgeOwnedUploads(ctx, owned)
+	return
+}
+
+// Deletes institutions along with their enrollments, academic years and terms, returning the slugs of the deleted
+// institutions
+func deleteInstitutions(ctx context.Context, ids ...uint64) (slugs map[uint64]string, err error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	objects, err := institutionObjects(ctx, tx, ids)
+	if err != nil {
+		return
+	}
+
+	// Enrollment records, terms and the records held by terms do not cascade with their institution
+	statements := []string{
+		"DELETE FROM session_transactions WHERE session IN (SELECT es.id FROM enrollment_sessions es JOIN enrollments e ON e.id = es.enrollment WHERE e.institution = ANY($1));",
+		"DELETE FROM enrollment_sessions WHERE enrollment IN (SELECT id FROM enrollments WHERE institution = ANY($1));",
+		"DELETE FROM enrollments WHERE institution = ANY($1);",
+		"DELETE FROM enrollment_forms WHERE institution = ANY($1);",
+		"DELETE FROM assessments WHERE academic_term IN (SELECT id FROM academic_terms WHERE institution = ANY($1));",
+		// Their documents are shared files of the institution, purged by the blob service
+		"DELETE FROM report_cards WHERE student IN (SELECT id FROM students WHERE institution = ANY($1));",
+		"DELETE FROM attendance_sessions WHERE academic_term IN (SELECT id FROM academic_terms WHERE institution = ANY($1));",
+		"DELETE FROM attendance_alerts WHERE academic_term IN (SELECT id FROM academic_terms WHERE institution = ANY($1));",
+		"DELETE FROM timetables WHERE institution = ANY($1);",
+		"DELETE FROM academic_terms WHERE institution = ANY($1);",
+	}
+	for _, statement := range statements {
+		if _, err = tx.Exec(ctx, statement, pq.Array(ids)); err != nil {
+			return
+		}
+	}
+
+	rows, err := tx.Query(ctx, "DELETE FROM institutions WHERE id = ANY($1) RETURNING id, slug;", pq.Array(ids))
+	if err != nil {
+		return
+	}
+
+	slugs = make(map[uint64]string)
+	for rows.Next() {
+		var id uint64
+		var slug string
+		if err = rows.Scan(&id, &slug); err != nil {
+			rows.Close()
+			return
+		}
+		slugs[id] = slug
+	}
+	rows.Close()
+
+	if err = tx.Commit(); err != nil {
+		return
+	}
+
+	if _, err = permissions.PurgeObjectTuples(ctx, dto.PurgeObjectTuplesRequest{Objects: objects}); err != nil {
+		return
+	}
+
+	for id, slug := range slugs {
+		evictCachedInstitution(ctx, id, slug)
+		evictCachedAcademicYears(ctx, id)
+	}
+	return
+}
+
+// Lists the authorization objects belonging to the institutions
+func institutionObjects(ctx context.Context, tx *sqldb.Tx, ids []uint64) (ans []string, err error) {
+	rows, err := tx.Query(ctx, `
+		SELECT 'institution', id FROM institutions WHERE id = ANY($1)
+		UNION ALL
+		SELECT 'academicYear', id FROM academic_years WHERE institution = ANY($1)
+		UNION ALL
+		SELECT 'academicTerm', id FROM academic_terms WHERE institution = ANY($1)
+		UNION ALL
+		SELECT 'enrollment', id FROM enrollments WHERE institution = ANY($1)
+		UNION ALL
+		SELECT 'class', id FROM classes WHERE institution = ANY($1)
+		UNION ALL
+		SELECT 'studentRecord', id FROM students WHERE institution = ANY($1)
+		UNION ALL
+		SELECT 'course', co.id FROM courses co JOIN classes c ON c.id = co.class WHERE c.institution = ANY($1);
+	`, pq.Array(ids))
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var objectType string
+		var id uint64
+		if err = rows.Scan(&objectType, &id); err != nil {
+			return
+		}
+		ans = append(ans, dto.IdentifierString(dto.PermissionType(objectType), id))
+	}
+	err = rows.Err()
+	return
+}
+
+func findTenantInstitutionIds(ctx context.Context, tenant uint64) (ans []uint64, err error) {
+	rows, err := db.Query(ctx, "SELECT id FROM institutions WHERE tenant = $1;", tenant)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id uint64
+		if err = rows.Scan(&id); err != nil {
+			return
+		}
+		ans = append(ans, id)
+	}
+	err = rows.Err()
+	return
+}
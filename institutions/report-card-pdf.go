@@ -0,0 +1,392 @@
+package institutions
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"encore.dev/rlog"
+	"github.com/brinestone/scholaris/blob"
+	"github.com/brinestone/scholaris/dto"
+	"github.com/brinestone/scholaris/helpers"
+	"github.com/brinestone/scholaris/models"
+	"github.com/brinestone/scholaris/tenants"
+)
+
+// The colors of report cards whose tenant has no branding
+var (
+	defaultReportCardColor = helpers.PdfColor{R: 31, G: 58, B: 95}
+	reportCardTextColor    = helpers.PdfColor{R: 33, G: 37, B: 41}
+	reportCardMutedColor   = helpers.PdfColor{R: 108, G: 117, B: 125}
+)
+
+// What the report cards of a class for a term have in common
+type reportCardSheet struct {
+	institution uint64
+	name        string
+	description string
+	// The institution's logo, when it was uploaded to the blob service
+	logo    image.Image
+	contact []string
+	primary helpers.PdfColor
+	accent  helpers.PdfColor
+	class   string
+	year    string
+	term    string
+	results *dto.ClassResultsResponse
+	// The number of ranked students
+	classSize int
+	// The remarks on each student, by subject or 0 for the remarks on the whole class
+	remarks map[uint64]map[uint64]string
+	// The attendance of the students over the term, for those with records
+	attendance map[uint64]dto.AttendanceSummary
+}
+
+// Gathers the branding of the institution along with the results, remarks and attendance of a class for a term
+func prepareReportCardSheet(ctx context.Context, class *models.Class, term uint64) (*reportCardSheet, error) {
+	institution, err := findInstitutionByIdFromDb(ctx, class.Institution)
+	if err != nil {
+		return nil, err
+	}
+
+	sheet := &reportCardSheet{
+		institution: institution.Id,
+		name:        institution.Name,
+		description: institution.Description.String,
+		logo:        loadLogo(ctx, institution.Logo),
+		primary:     defaultReportCardColor,
+		accent:      defaultReportCardColor.Tint(0.12),
+		remarks:     make(map[uint64]map[uint64]string),
+		attendance:  make(map[uint64]dto.AttendanceSummary),
+	}
+
+	// Report cards are still issued when the branding of the tenant is unavailable
+	if profile, err := tenants.FindTenantProfileInternal(ctx, institution.TenantId); err != nil {
+		rlog.Warn("could not find tenant branding", "tenant", institution.TenantId, "err", err)
+	} else {
+		if profile.PrimaryColor != nil {
+			if c, ok := helpers.ParsePdfColor(*profile.PrimaryColor); ok {
+				sheet.primary, sheet.accent = c, c.Tint(0.12)
+			}
+		}
+		if profile.SecondaryColor != nil {
+			if c, ok := helpers.ParsePdfColor(*profile.SecondaryColor); ok {
+				sheet.accent = c.Tint(0.25)
+			}
+		}
+		for _, v := range []*string{profile.Website, profile.ContactEmail, profile.ContactPhone} {
+			if v != nil && len(*v) > 0 {
+				sheet.contact = append(sheet.contact, *v)
+			}
+		}
+	}
+
+	year, err := findAcademicYear(ctx, class.Institution, class.AcademicYear)
+	if err != nil {
+		return nil, err
+	}
+	sheet.year = year.Label
+	for _, t := range year.Terms {
+		if t.Id == term {
+			sheet.term = t.Label
+		}
+	}
+
+	var level string
+	if err = db.QueryRow(ctx, "SELECT name FROM levels WHERE id = $1;", class.Level).Scan(&level); err != nil {
+		return nil, err
+	}
+	sheet.class = fmt.Sprintf("%s %s", level, class.Name)
+	if class.Stream.Valid {
+		sheet.class = fmt.Sprintf("%s (%s)", sheet.class, class.Stream.String)
+	}
+
+	if sheet.results, err = computeClassResults(ctx, class, term); err != nil {
+		return nil, err
+	}
+	students := make([]int64, 0, len(sheet.results.Results))
+	for _, r := range sheet.results.Results {
+		if r.Rank != nil {
+			sheet.classSize++
+		}
+		students = append(students, int64(r.Student))
+	}
+
+	// Absences are counted over the whole term, including those from another class the student was in
+	summaries, err := findAttendanceSummaries(ctx, nil, term, 0, students)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range summaries {
+		sheet.attendance[s.Student] = s
+	}
+
+	rows, err := db.Query(ctx, `
+		SELECT
+			r.student, COALESCE(co.subject, 0), r.remark
+		FROM
+			report_card_remarks r
+			LEFT JOIN courses co ON co.id = r.course
+		WHERE
+			r.class = $1 AND r.academic_term = $2;
+	`, class.Id, term)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var student, subject uint64
+		var remark string
+		if err = rows.Scan(&student, &subject, &remark); err != nil {
+			return nil, err
+		}
+		if sheet.remarks[student] == nil {
+			sheet.remarks[student] = make(map[uint64]string)
+		}
+		sheet.remarks[student][subject] = remark
+	}
+	return sheet, rows.Err()
+}
+
+// Reads a logo from the uploads bucket when its URL points to the blob service. Logos hosted elsewhere are left out.
+func loadLogo(ctx context.Context, logo sql.NullString) image.Image {
+	if !logo.Valid {
+		return nil
+	}
+
+	u, err := url.Parse(logo.String)
+	if err != nil {
+		return nil
+	}
+
+	key := path.Base(u.Path)
+	if !strings.HasPrefix(key, blob.FTShared+"_") && !strings.HasPrefix(key, blob.FTUser+"_") {
+		return nil
+	}
+
+	reader := uploads.Download(ctx, key)
+	if reader.Err() != nil {
+		rlog.Warn("could not read logo", "key", key, "err", reader.Err())
+		return nil
+	}
+	defer reader.Close()
+
+	img, _, err := image.Decode(reader)
+	if err != nil {
+		rlog.Warn("could not decode logo", "key", key, "err", err)
+		return nil
+	}
+	return img
+}
+
+// Lays out the report card of a student on an A4 page
+func renderReportCard(sheet *reportCardSheet, result dto.StudentResult, generatedAt time.Time) ([]byte, error) {
+	const margin = 40.0
+	const width = helpers.PdfPageWidth - 2*margin
+	scale := sheet.results.Scale
+	mark := func(v *float64) string {
+		if v == nil {
+			return "-"
+		}
+		return strconv.FormatFloat(*v, 'f', scale.Decimals, 64)
+	}
+
+	doc := helpers.NewPdfDocument(fmt.Sprintf("Report card - %s %s - %s", result.LastName, result.FirstName, sheet.term))
+
+	// Header
+	doc.Rect(0, 0, helpers.PdfPageWidth, 100, sheet.primary)
+	x := margin
+	if sheet.logo != nil {
+		bounds := sheet.logo.Bounds()
+		w, h := 60.0, 60.0
+		if bounds.Dx() > bounds.Dy() {
+			h = 60 * float64(bounds.Dy()) / float64(bounds.Dx())
+		} else if bounds.Dy() > bounds.Dx() {
+			w = 60 * float64(bounds.Dx()) / float64(bounds.Dy())
+		}
+		doc.Image(sheet.logo, margin, 20+(60-h)/2, w, h)
+		x += 72
+	}
+	titleWidth := helpers.PdfPageWidth - margin - x - 170
+	doc.Text(x, 46, helpers.PdfBold, 18, helpers.PdfWhite, helpers.PdfFitText(sheet.name, helpers.PdfBold, 18, titleWidth))
+	if len(sheet.description) > 0 {
+		doc.Text(x, 64, helpers.PdfRegular, 10, helpers.PdfWhite, helpers.PdfFitText(sheet.description, helpers.PdfRegular, 10, titleWidth))
+	}
+	if len(sheet.contact) > 0 {
+		doc.Text(x, 80, helpers.PdfRegular, 8, helpers.PdfWhite, helpers.PdfFitText(strings.Join(sheet.contact, "  |  "), helpers.PdfRegular, 8, titleWidth))
+	}
+	doc.TextRight(helpers.PdfPageWidth-margin, 46, helpers.PdfBold, 14, helpers.PdfWhite, "REPORT CARD")
+	doc.TextRight(helpers.PdfPageWidth-margin, 64, helpers.PdfRegular, 10, helpers.PdfWhite, sheet.term)
+	doc.TextRight(helpers.PdfPageWidth-margin, 80, helpers.PdfRegular, 10, helpers.PdfWhite, sheet.year)
+
+	// Student
+	field := func(x, y float64, label, value string) {
+		doc.Text(x, y, helpers.PdfRegular, 8, reportCardMutedColor, strings.ToUpper(label))
+		doc.Text(x, y+14, helpers.PdfBold, 11, reportCardTextColor, helpers.PdfFitText(value, helpers.PdfBold, 11, width/2-10))
+	}
+	field(margin, 128, "Student", fmt.Sprintf("%s %s", result.LastName, result.FirstName))
+	field(margin+width/2, 128, "Matricule", result.Matricule)
+	field(margin, 162, "Class", sheet.class)
+	field(margin+width/2, 162, "Class size", strconv.Itoa(sheet.classSize))
+
+	// Subjects
+	columns := []struct {
+		title string
+		width float64
+		right bool
+	}{
+		{"Subject", 140, false},
+		{"Coef.", 40, true},
+		{fmt.Sprintf("Avg. /%s", strconv.FormatFloat(scale.MaxScore, 'f', -1, 64)), 60, true},
+		{"Total", 55, true},
+		{"Rank", 40, true},
+		{"Teacher's remark", width - 335, false},
+	}
+	row := func(y float64, font helpers.PdfFont, values ...string) {
+		cx := margin
+		for i, c := range columns {
+			text := helpers.PdfFitText(values[i], font, 9, c.width-12)
+			if c.right {
+				doc.TextRight(cx+c.width-6, y+13, font, 9, reportCardTextColor, text)
+			} else {
+				doc.Text(cx+6, y+13, font, 9, reportCardTextColor, text)
+			}
+			cx += c.width
+		}
+	}
+	header := func(y float64) {
+		doc.Rect(margin, y, width, 20, sheet.accent)
+		titles := make([]string, 0, len(columns))
+		for _, c := range columns {
+			titles = append(titles, c.title)
+		}
+		row(y, helpers.PdfBold, titles...)
+	}
+
+	y := 196.0
+	header(y)
+	y += 20
+
+	var coefficients, points float64
+	for i, s := range result.Subjects {
+		if y > helpers.PdfPageHeight-margin-20 {
+			doc.AddPage()
+			y = margin
+			header(y)
+			y += 20
+		}
+
+		if i%2 == 1 {
+			doc.Rect(margin, y, width, 18, sheet.accent.Tint(0.4))
+		}
+
+		total, rank := "-", "-"
+		if s.Average != nil {
+			weighted := scale.Round(*s.Average * s.Coefficient)
+			total = mark(&weighted)
+			coefficients += s.Coefficient
+			points += weighted
+		}
+		if s.Rank != nil {
+			rank = strconv.Itoa(*s.Rank)
+		}
+		row(y, helpers.PdfRegular, s.Name, strconv.FormatFloat(s.Coefficient, 'f', -1, 64), mark(s.Average), total, rank, sheet.remarks[result.Student][s.Subject])
+		y += 18
+	}
+	doc.Line(margin, y, margin+width, y, 0.8, sheet.primary)
+	points = scale.Round(points)
+	row(y, helpers.PdfBold, "Total", strconv.FormatFloat(coefficients, 'f', -1, 64), "", mark(&points), "", "")
+	y += 20
+
+	// Everything below the subjects is kept together
+	if y > helpers.PdfPageHeight-320 {
+		doc.AddPage()
+		y = margin
+	}
+
+	// Summary
+	y += 14
+	doc.Rect(margin, y, width, 52, sheet.accent)
+	rank, decision := "-", "-"
+	if result.Rank != nil {
+		rank = fmt.Sprintf("%d of %d", *result.Rank, sheet.classSize)
+	}
+	if result.Average != nil {
+		decision = "Not passed"
+		if result.Passed {
+			decision = "Passed"
+		}
+	}
+	summary := []struct{ label, value string }{
+		{"General average", mark(result.Average)},
+		{"Rank", rank},
+		{"Class average", mark(sheet.results.Average)},
+		{"Decision", decision},
+	}
+	for i, s := range summary {
+		cx := margin + 12 + float64(i)*width/4
+		doc.Text(cx, y+20, helpers.PdfRegular, 8, reportCardMutedColor, strings.ToUpper(s.label))
+		doc.Text(cx, y+38, helpers.PdfBold, 13, reportCardTextColor, s.value)
+	}
+	y += 52
+
+	// Attendance
+	y += 28
+	doc.Text(margin, y, helpers.PdfBold, 11, sheet.primary, "Attendance")
+	doc.Line(margin, y+5, margin+width, y+5, 0.5, sheet.accent)
+	if attendance, ok := sheet.attendance[result.Student]; ok {
+		counts := []struct {
+			label string
+			value uint
+		}{
+			{"Days absent", attendance.DaysAbsent},
+			{"Absences", attendance.Absent},
+			{"Excused absences", attendance.Excused},
+			{"Late arrivals", attendance.Late},
+		}
+		for i, c := range counts {
+			cx := margin + float64(i)*width/4
+			doc.Text(cx, y+20, helpers.PdfRegular, 8, reportCardMutedColor, strings.ToUpper(c.label))
+			doc.Text(cx, y+34, helpers.PdfBold, 11, reportCardTextColor, strconv.FormatUint(uint64(c.value), 10))
+		}
+		y += 34
+	} else {
+		doc.Text(margin, y+22, helpers.PdfRegular, 9, reportCardMutedColor, "No attendance was recorded for this term.")
+		y += 22
+	}
+
+	// Remarks on the whole class
+	y += 28
+	doc.Text(margin, y, helpers.PdfBold, 11, sheet.primary, "Class teacher's remark")
+	doc.Line(margin, y+5, margin+width, y+5, 0.5, sheet.accent)
+	lines, color := helpers.PdfWrapText(sheet.remarks[result.Student][0], helpers.PdfRegular, 9, width), reportCardTextColor
+	if len(lines) == 0 {
+		lines, color = []string{"No remark."}, reportCardMutedColor
+	}
+	y += 8
+	for _, line := range lines[:min(len(lines), 4)] {
+		y += 14
+		doc.Text(margin, y, helpers.PdfRegular, 9, color, line)
+	}
+
+	// Signatures
+	y = max(y+40, helpers.PdfPageHeight-100)
+	for i, label := range []string{"Class teacher", "Head of institution", "Parent / Guardian"} {
+		cx := margin + float64(i)*(width/3)
+		doc.Line(cx, y, cx+width/3-20, y, 0.5, reportCardMutedColor)
+		doc.Text(cx, y+12, helpers.PdfRegular, 8, reportCardMutedColor, label)
+	}
+
+	doc.Text(margin, helpers.PdfPageHeight-24, helpers.PdfRegular, 7, reportCardMutedColor, fmt.Sprintf("Generated on %s", generatedAt.Format("2 January 2006")))
+	doc.TextRight(helpers.PdfPageWidth-margin, helpers.PdfPageHeight-24, helpers.PdfRegular, 7, reportCardMutedColor, sheet.name)
+	return doc.Bytes()
+}
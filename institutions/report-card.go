@@ -0,0 +1,688 @@
+package institutions
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"encore.dev"
+	"encore.dev/beta/auth"
+	"encore.dev/beta/errs"
+	"encore.dev/rlog"
+	"encore.dev/storage/sqldb"
+	"github.com/brinestone/scholaris/blob"
+	"github.com/brinestone/scholaris/core/permissions"
+	"github.com/brinestone/scholaris/dto"
+	"github.com/brinestone/scholaris/helpers"
+	"github.com/brinestone/scholaris/models"
+	"github.com/brinestone/scholaris/util"
+	"github.com/lib/pq"
+)
+
+// Records the remarks of a course's teacher on the students of its class for a term
+//
+//encore:api auth method=PUT path=/institutions/:id/classes/:class/courses/:course/remarks tag:can_grade_course tag:institution_writable
+func RecordCourseRemarks(ctx context.Context, id, class, course uint64, req dto.RecordRemarksRequest) (ans *dto.RemarksResponse, err error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err = lockCourse(ctx, tx, id, class, course); err != nil {
+		return
+	}
+
+	if ans, err = recordRemarks(ctx, tx, class, course, req); err != nil {
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		ans, err = nil, &util.ErrUnknown
+	}
+	return
+}
+
+// Lists the remarks of a course's teacher on the students of its class for a term
+//
+//encore:api auth method=GET path=/institutions/:id/classes/:class/courses/:course/remarks tag:can_view_course
+func FindCourseRemarks(ctx context.Context, id, class, course uint64, req dto.FindRemarksRequest) (ans *dto.RemarksResponse, err error) {
+	if _, err = findCourse(ctx, nil, id, class, course); errors.Is(err, sqldb.ErrNoRows) {
+		err = &util.ErrNotFound
+		return
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	remarks, err := queryRemarks(ctx, nil, class, req.AcademicTerm, course)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = &dto.RemarksResponse{
+		Remarks: remarksToDto(remarks...),
+	}
+	return
+}
+
+// Records the general remarks on the students of a class for a term, such as those of its homeroom teacher
+//
+//encore:api auth method=PUT path=/institutions/:id/classes/:class/remarks tag:can_write_class_remarks tag:institution_writable
+func RecordClassRemarks(ctx context.Context, id, class uint64, req dto.RecordRemarksRequest) (ans *dto.RemarksResponse, err error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err = findClass(ctx, tx, id, class); errors.Is(err, sqldb.ErrNoRows) {
+		err = &util.ErrNotFound
+		return
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if ans, err = recordRemarks(ctx, tx, class, 0, req); err != nil {
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		ans, err = nil, &util.ErrUnknown
+	}
+	return
+}
+
+// Lists the general remarks on the students of a class for a term
+//
+//encore:api auth method=GET path=/institutions/:id/classes/:class/remarks tag:can_view_class_results
+func FindClassRemarks(ctx context.Context, id, class uint64, req dto.FindRemarksRequest) (ans *dto.RemarksResponse, err error) {
+	if _, err = findClass(ctx, nil, id, class); errors.Is(err, sqldb.ErrNoRows) {
+		err = &util.ErrNotFound
+		return
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	remarks, err := queryRemarks(ctx, nil, class, req.AcademicTerm, 0)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = &dto.RemarksResponse{
+		Remarks: remarksToDto(remarks...),
+	}
+	return
+}
+
+// Starts generating the report cards of a class for a term in the background. The report cards previously generated
+// for the same students and term are replaced.
+//
+//encore:api auth method=POST path=/institutions/:id/classes/:class/report-cards tag:can_manage_class_grades tag:institution_writable
+func NewReportCardJob(ctx context.Context, id, class uint64, req dto.NewReportCardJobRequest) (ans *dto.ReportCardJob, err error) {
+	uid, _ := auth.UserID()
+	requestedBy, _ := strconv.ParseUint(string(uid), 10, 64)
+
+	if _, err = findClass(ctx, nil, id, class); errors.Is(err, sqldb.ErrNoRows) {
+		err = &util.ErrNotFound
+		return
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if err = assertClassTerm(ctx, nil, class, req.AcademicTerm); err != nil {
+		return
+	}
+
+	var students []int64
+	if len(req.Students) > 0 {
+		students = helpers.SliceMap(req.Students, func(s uint64) int64 { return int64(s) })
+
+		var count int
+		if err = db.QueryRow(ctx, `
+			SELECT
+				COUNT(*)
+			FROM
+				students s
+			WHERE
+				s.id = ANY($1) AND s.institution = $2
+				AND EXISTS(SELECT 1 FROM class_placements p WHERE p.class = $3 AND p.student = s.id);
+		`, pq.Array(students), id, class).Scan(&count); err != nil {
+			rlog.Error(util.MsgDbAccessError, "err", err)
+			err = &util.ErrUnknown
+			return
+		}
+
+		if count != len(students) {
+			err = &errs.Error{
+				Code:    errs.InvalidArgument,
+				Message: "Some of the students were never placed in the class",
+			}
+			return
+		}
+	}
+
+	query := fmt.Sprintf(`
+		INSERT INTO report_card_jobs(class, academic_term, students, requested_by)
+		VALUES ($1,$2,$3,$4)
+		ON CONFLICT (class, academic_term) WHERE status IN ('pending', 'in_progress') DO NOTHING
+		RETURNING %s;
+	`, reportCardJobFields)
+	job, err := scanReportCardJob(db.QueryRow(ctx, query, class, req.AcademicTerm, pq.Array(students), requestedBy))
+	if errors.Is(err, sqldb.ErrNoRows) {
+		err = &errs.Error{
+			Code:    errs.AlreadyExists,
+			Message: "The report cards of this class are already being generated for this term",
+		}
+		return
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if _, err = RequestedReportCardJobs.Publish(ctx, &ReportCardJobRequested{
+		Job:         job.Id,
+		Institution: id,
+		Timestamp:   time.Now(),
+	}); err != nil {
+		rlog.Error("could not request report card generation", "job", job.Id, "err", err)
+		// The job would never start and would block new ones for the class and term
+		if _, err := db.Exec(ctx, "DELETE FROM report_card_jobs WHERE id = $1;", job.Id); err != nil {
+			rlog.Error(util.MsgDbAccessError, "job", job.Id, "err", err)
+		}
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = reportCardJobToDto(job)
+	return
+}
+
+// Finds a report card generation job of a class along with its progress
+//
+//encore:api auth method=GET path=/institutions/:id/classes/:class/report-card-jobs/:job tag:can_view_class_results
+func FindReportCardJob(ctx context.Context, id, class, job uint64) (ans *dto.ReportCardJob, err error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM
+			report_card_jobs j
+			JOIN classes c ON c.id = j.class
+		WHERE
+			j.id = $1 AND j.class = $2 AND c.institution = $3;
+	`, reportCardJobFields)
+	j, err := scanReportCardJob(db.QueryRow(ctx, query, job, class, id))
+	if errors.Is(err, sqldb.ErrNoRows) {
+		err = &util.ErrNotFound
+		return
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = reportCardJobToDto(j)
+	return
+}
+
+// Lists the report cards issued to the students of a class, optionally for a single term
+//
+//encore:api auth method=GET path=/institutions/:id/classes/:class/report-cards tag:can_view_class_results
+func FindClassReportCards(ctx context.Context, id, class uint64, req dto.FindReportCardsRequest) (ans *dto.ReportCardsResponse, err error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM
+			report_cards rc
+			JOIN classes c ON c.id = rc.class
+		WHERE
+			rc.class = $1 AND c.institution = $2 AND ($3 = 0 OR rc.academic_term = $3)
+		ORDER BY
+			rc.academic_term, rc.rank NULLS LAST, rc.id;
+	`, reportCardFields)
+	cards, err := queryReportCards(ctx, query, class, id, req.AcademicTerm)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = &dto.ReportCardsResponse{
+		ReportCards: reportCardsToDto(cards...),
+	}
+	return
+}
+
+// Lists the report cards issued to a student, the latest first
+//
+//encore:api auth method=GET path=/institutions/:id/students/:student/report-cards tag:can_view_student
+func FindStudentReportCards(ctx context.Context, id, student uint64, req dto.FindReportCardsRequest) (ans *dto.ReportCardsResponse, err error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM
+			report_cards rc
+			JOIN students s ON s.id = rc.student
+		WHERE
+			rc.student = $1 AND s.institution = $2 AND ($3 = 0 OR rc.academic_term = $3)
+		ORDER BY
+			rc.generated_at DESC;
+	`, reportCardFields)
+	cards, err := queryReportCards(ctx, query, student, id, req.AcademicTerm)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = &dto.ReportCardsResponse{
+		ReportCards: reportCardsToDto(cards...),
+	}
+	return
+}
+
+// Private section
+
+// Records remarks on the students of a class, on one of its courses or on the whole class when course is 0
+func recordRemarks(ctx context.Context, tx *sqldb.Tx, class, course uint64, req dto.RecordRemarksRequest) (*dto.RemarksResponse, error) {
+	uid, _ := auth.UserID()
+	writtenBy, _ := strconv.ParseUint(string(uid), 10, 64)
+
+	if err := assertClassTerm(ctx, tx, class, req.AcademicTerm); err != nil {
+		return nil, err
+	}
+
+	students := helpers.SliceMap(req.Remarks, func(r dto.RemarkEntry) int64 { return int64(r.Student) })
+	placed, err := findPlacedStudents(ctx, tx, class, students)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return nil, &util.ErrUnknown
+	}
+
+	msgs := make([]string, 0)
+	for i, r := range req.Remarks {
+		if !placed[r.Student] {
+			msgs = append(msgs, fmt.Sprintf("The student of remark %d is not in the class", i+1))
+		}
+	}
+
+	if len(msgs) > 0 {
+		return nil, &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: strings.Join(msgs, "\n"),
+		}
+	}
+
+	for _, r := range req.Remarks {
+		if remark := strings.TrimSpace(r.Remark); len(remark) == 0 {
+			_, err = tx.Exec(ctx, "DELETE FROM report_card_remarks WHERE class = $1 AND academic_term = $2 AND student = $3 AND COALESCE(course, 0) = $4;", class, req.AcademicTerm, r.Student, course)
+		} else {
+			_, err = tx.Exec(ctx, `
+				INSERT INTO report_card_remarks(class, academic_term, student, course, remark, written_by)
+				VALUES ($1,$2,$3,NULLIF($4::BIGINT, 0),$5,$6)
+				ON CONFLICT (class, academic_term, student, COALESCE(course, 0)) DO UPDATE SET
+					remark = EXCLUDED.remark,
+					written_by = EXCLUDED.written_by,
+					updated_at = CURRENT_TIMESTAMP;
+			`, class, req.AcademicTerm, r.Student, course, remark, writtenBy)
+		}
+		if err != nil {
+			rlog.Error(util.MsgDbAccessError, "err", err)
+			return nil, &util.ErrUnknown
+		}
+	}
+
+	remarks, err := queryRemarks(ctx, tx, class, req.AcademicTerm, course)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return nil, &util.ErrUnknown
+	}
+
+	return &dto.RemarksResponse{
+		Remarks: remarksToDto(remarks...),
+	}, nil
+}
+
+// Generates the report cards requested by a job. Report cards which cannot be generated are counted as failed
+// without stopping the others.
+func generateReportCards(ctx context.Context, msg *ReportCardJobRequested) (err error) {
+	job, err := findReportCardJob(ctx, msg.Job)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		// The class or the term was deleted in the meantime
+		return nil
+	} else if err != nil {
+		return
+	}
+
+	// A redelivered message restarts an interrupted job but leaves finished ones alone
+	if job.Status != string(dto.RJSPending) && job.Status != string(dto.RJSInProgress) {
+		return nil
+	}
+
+	if _, err = db.Exec(ctx, "UPDATE report_card_jobs SET status = $1, started_at = CURRENT_TIMESTAMP, generated = 0, failed = 0, error = NULL WHERE id = $2;", dto.RJSInProgress, job.Id); err != nil {
+		return
+	}
+
+	class, err := findClass(ctx, nil, msg.Institution, job.Class)
+	if err != nil {
+		return
+	}
+
+	sheet, err := prepareReportCardSheet(ctx, class, job.AcademicTerm)
+	if err != nil {
+		rlog.Error("could not prepare report cards", "job", job.Id, "err", err)
+		return failReportCardJob(ctx, job.Id, "The results of the class could not be computed")
+	}
+
+	results := sheet.results.Results
+	if len(job.Students) > 0 {
+		results = make([]dto.StudentResult, 0, len(job.Students))
+		for _, r := range sheet.results.Results {
+			for _, s := range job.Students {
+				if uint64(s) == r.Student {
+					results = append(results, r)
+				}
+			}
+		}
+	}
+
+	if _, err = db.Exec(ctx, "UPDATE report_card_jobs SET total = $1 WHERE id = $2;", len(results), job.Id); err != nil {
+		return
+	}
+
+	var generated, failed int
+	for _, r := range results {
+		if err := issueReportCard(ctx, sheet, job, r); err != nil {
+			rlog.Error("could not generate report card", "job", job.Id, "student", r.Student, "err", err)
+			failed++
+		} else {
+			generated++
+		}
+
+		if _, err = db.Exec(ctx, "UPDATE report_card_jobs SET generated = $1, failed = $2 WHERE id = $3;", generated, failed, job.Id); err != nil {
+			return
+		}
+	}
+
+	status := dto.RJSCompleted
+	var reason sql.NullString
+	if failed > 0 {
+		reason = sql.NullString{String: fmt.Sprintf("%d of the report cards could not be generated", failed), Valid: true}
+		if generated == 0 {
+			status = dto.RJSFailed
+		}
+	}
+
+	_, err = db.Exec(ctx, "UPDATE report_card_jobs SET status = $1, error = $2, completed_at = CURRENT_TIMESTAMP WHERE id = $3;", status, reason, job.Id)
+	return
+}
+
+// How long a job may stay pending or in progress before it is considered lost
+const reportCardJobTimeout = 2 * time.Hour
+
+// Fails the jobs which have been pending or in progress for too long, e.g. when their message was lost or their
+// worker stopped, so that new ones can be requested for their class and term
+//
+//encore:api private method=POST path=/institutions/report-card-jobs/expire
+func ExpireReportCardJobs(ctx context.Context) error {
+	res, err := db.Exec(ctx, `
+		UPDATE report_card_jobs SET
+			status = $1,
+			error = $2,
+			completed_at = CURRENT_TIMESTAMP
+		WHERE
+			status IN ($3, $4)
+			AND COALESCE(started_at, created_at) < CURRENT_TIMESTAMP - $5 * INTERVAL '1 second';
+	`, dto.RJSFailed, "The report cards took too long to generate", dto.RJSPending, dto.RJSInProgress, reportCardJobTimeout.Seconds())
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return err
+	}
+
+	if expired := res.RowsAffected(); expired > 0 {
+		rlog.Warn("expired report card jobs", "count", expired)
+	}
+	return nil
+}
+
+// Marks a job as failed. The error is not returned so that the job is not retried; a new one can be requested.
+func failReportCardJob(ctx context.Context, id uint64, reason string) (err error) {
+	_, err = db.Exec(ctx, "UPDATE report_card_jobs SET status = $1, error = $2, completed_at = CURRENT_TIMESTAMP WHERE id = $3;", dto.RJSFailed, reason, id)
+	return
+}
+
+// Renders the report card of a student and stores it as a shared file the student and their guardians can view,
+// replacing the one previously generated for the term
+func issueReportCard(ctx context.Context, sheet *reportCardSheet, job *models.ReportCardJob, result dto.StudentResult) (err error) {
+	content, err := renderReportCard(sheet, result, time.Now())
+	if err != nil {
+		return
+	}
+
+	file, err := blob.StoreSharedFileInternal(ctx, dto.StoreSharedFileRequest{
+		Owner:      sheet.institution,
+		OwnerType:  dto.PTInstitution,
+		Name:       fmt.Sprintf("Report card - %s %s - %s.pdf", result.LastName, result.FirstName, sheet.term),
+		MimeType:   "application/pdf",
+		Content:    content,
+		UploadedBy: job.RequestedBy,
+	})
+	if err != nil {
+		return
+	}
+
+	defer func() {
+		if err == nil {
+			return
+		}
+		if _, err := blob.DeleteSharedFilesInternal(ctx, dto.DeleteUploadsRequest{Keys: []string{file.Key}}); err != nil {
+			rlog.Error("could not delete report card", "key", file.Key, "err", err)
+		}
+	}()
+
+	if err = permissions.SetPermissions(ctx, dto.UpdatePermissionsRequest{
+		Updates: []dto.PermissionUpdate{
+			{
+				Actor:    dto.IdentifierString(dto.PTStudentRecord, result.Student),
+				Relation: dto.PNSubject,
+				Target:   dto.IdentifierString(dto.PTSharedFile, file.Key),
+			},
+		},
+	}); err != nil {
+		return
+	}
+
+	var previous sql.NullString
+	if err = db.QueryRow(ctx, `
+		WITH previous AS (
+			SELECT file_key FROM report_cards WHERE academic_term = $2 AND student = $3
+		)
+		INSERT INTO report_cards(class, academic_term, student, job, file_key, average, rank, generated_by)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8)
+		ON CONFLICT (academic_term, student) DO UPDATE SET
+			class = EXCLUDED.class,
+			job = EXCLUDED.job,
+			file_key = EXCLUDED.file_key,
+			average = EXCLUDED.average,
+			rank = EXCLUDED.rank,
+			generated_by = EXCLUDED.generated_by,
+			generated_at = CURRENT_TIMESTAMP
+		RETURNING (SELECT file_key FROM previous);
+	`, job.Class, job.AcademicTerm, result.Student, job.Id, file.Key, result.Average, result.Rank, job.RequestedBy).Scan(&previous); err != nil {
+		return
+	}
+
+	if previous.Valid {
+		if _, err := blob.DeleteSharedFilesInternal(ctx, dto.DeleteUploadsRequest{Keys: []string{previous.String}}); err != nil {
+			rlog.Error("could not delete replaced report card", "key", previous.String, "err", err)
+		}
+	}
+	return
+}
+
+const remarkFields = "r.id,r.class,r.academic_term,r.student,r.course,r.remark,r.written_by,r.created_at,r.updated_at"
+
+// Lists the remarks on the students of a class for a term, on a course or on the whole class when course is 0, within
+// the transaction when one is given
+func queryRemarks(ctx context.Context, tx *sqldb.Tx, class, term, course uint64) (ans []*models.ReportCardRemark, err error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM
+			report_card_remarks r
+		WHERE
+			r.class = $1 AND r.academic_term = $2 AND COALESCE(r.course, 0) = $3
+		ORDER BY
+			r.student;
+	`, remarkFields)
+
+	var rows *sqldb.Rows
+	if tx != nil {
+		rows, err = tx.Query(ctx, query, class, term, course)
+	} else {
+		rows, err = db.Query(ctx, query, class, term, course)
+	}
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		r := new(models.ReportCardRemark)
+		if err = rows.Scan(&r.Id, &r.Class, &r.AcademicTerm, &r.Student, &r.Course, &r.Remark, &r.WrittenBy, &r.CreatedAt, &r.UpdatedAt); err != nil {
+			return
+		}
+		ans = append(ans, r)
+	}
+	err = rows.Err()
+	return
+}
+
+func remarksToDto(remarks ...*models.ReportCardRemark) (ans []dto.Remark) {
+	ans = make([]dto.Remark, 0, len(remarks))
+	for _, r := range remarks {
+		v := dto.Remark{
+			Id:           r.Id,
+			Class:        r.Class,
+			AcademicTerm: r.AcademicTerm,
+			Student:      r.Student,
+			Remark:       r.Remark,
+			WrittenBy:    r.WrittenBy,
+			UpdatedAt:    r.UpdatedAt,
+		}
+		if r.Course.Valid {
+			course := uint64(r.Course.Int64)
+			v.Course = &course
+		}
+		ans = append(ans, v)
+	}
+	return
+}
+
+const reportCardJobFields = "id,class,academic_term,students,status,total,generated,failed,error,requested_by,created_at,started_at,completed_at"
+
+func findReportCardJob(ctx context.Context, id uint64) (*models.ReportCardJob, error) {
+	query := fmt.Sprintf("SELECT %s FROM report_card_jobs WHERE id = $1;", reportCardJobFields)
+	return scanReportCardJob(db.QueryRow(ctx, query, id))
+}
+
+func scanReportCardJob(row rowScanner) (*models.ReportCardJob, error) {
+	j := new(models.ReportCardJob)
+	if err := row.Scan(&j.Id, &j.Class, &j.AcademicTerm, (*pq.Int64Array)(&j.Students), &j.Status, &j.Total, &j.Generated, &j.Failed, &j.Error, &j.RequestedBy, &j.CreatedAt, &j.StartedAt, &j.CompletedAt); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+func reportCardJobToDto(j *models.ReportCardJob) *dto.ReportCardJob {
+	ans := &dto.ReportCardJob{
+		Id:           j.Id,
+		Class:        j.Class,
+		AcademicTerm: j.AcademicTerm,
+		Status:       dto.ReportCardJobStatus(j.Status),
+		Total:        j.Total,
+		Generated:    j.Generated,
+		Failed:       j.Failed,
+		RequestedBy:  j.RequestedBy,
+		CreatedAt:    j.CreatedAt,
+	}
+	for _, s := range j.Students {
+		ans.Students = append(ans.Students, uint64(s))
+	}
+	if j.Total > 0 {
+		ans.Progress = (j.Generated + j.Failed) * 100 / j.Total
+	}
+	if j.Error.Valid {
+		ans.Error = &j.Error.String
+	}
+	if j.StartedAt.Valid {
+		ans.StartedAt = &j.StartedAt.Time
+	}
+	if j.CompletedAt.Valid {
+		ans.CompletedAt = &j.CompletedAt.Time
+	}
+	return ans
+}
+
+const reportCardFields = "rc.id,rc.class,rc.academic_term,rc.student,rc.job,rc.file_key,rc.average,rc.rank,rc.generated_by,rc.generated_at"
+
+func queryReportCards(ctx context.Context, query string, args ...any) (ans []*models.ReportCard, err error) {
+	rows, err := db.Query(ctx, query, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		c := new(models.ReportCard)
+		if err = rows.Scan(&c.Id, &c.Class, &c.AcademicTerm, &c.Student, &c.Job, &c.FileKey, &c.Average, &c.Rank, &c.GeneratedBy, &c.GeneratedAt); err != nil {
+			return
+		}
+		ans = append(ans, c)
+	}
+	err = rows.Err()
+	return
+}
+
+func reportCardsToDto(cards ...*models.ReportCard) (ans []dto.ReportCard) {
+	ans = make([]dto.ReportCard, 0, len(cards))
+	for _, c := range cards {
+		v := dto.ReportCard{
+			Id:           c.Id,
+			Class:        c.Class,
+			AcademicTerm: c.AcademicTerm,
+			Student:      c.Student,
+			File:         c.FileKey,
+			DownloadUrl:  encore.Meta().APIBaseURL.JoinPath("blob", c.FileKey).String(),
+			GeneratedBy:  c.GeneratedBy,
+			GeneratedAt:  c.GeneratedAt,
+		}
+		if c.Average.Valid {
+			v.Average = &c.Average.Float64
+		}
+		if c.Rank.Valid {
+			rank := int(c.Rank.Int32)
+			v.Rank = &rank
+		}
+		ans = append(ans, v)
+	}
+	return
+}
@@ -0,0 +1,155 @@
+package institutions_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"encore.dev/et"
+	"github.com/brinestone/scholaris/core/users"
+	"github.com/brinestone/scholaris/dto"
+	"github.com/brinestone/scholaris/institutions"
+	"github.com/brinestone/scholaris/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReportCards(t *testing.T) {
+	et.MockEndpoint(users.FindUserById, func(ctx context.Context, id uint64) (*models.User, error) {
+		return &models.User{Id: id}, nil
+	})
+
+	i, err := makeInstitution()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	year, err := makeAcademicYear(i.Id)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	term := year.Terms[0].Id
+
+	level, err := institutions.CreateLevel(mainContext, i.Id, dto.NewLevelRequest{Name: "Form 2"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	class, err := institutions.CreateClass(mainContext, i.Id, dto.NewClassRequest{Level: level.Id, AcademicYear: year.Id, Name: "B"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	subject, err := institutions.CreateSubject(mainContext, i.Id, level.Id, dto.NewSubjectRequest{Name: "History"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	course, err := institutions.CreateCourse(mainContext, i.Id, class.Id, dto.NewCourseRequest{Subject: subject.Id})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	student, err := institutions.CreateStudent(mainContext, i.Id, dto.NewStudentRequest{FirstName: "Jane", LastName: "Roe"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	outsider, err := institutions.CreateStudent(mainContext, i.Id, dto.NewStudentRequest{FirstName: "John", LastName: "Roe"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if _, err = institutions.LinkStudentAccount(mainContext, i.Id, student.Id, dto.StudentAccountRequest{User: 3}); err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err = institutions.PlaceStudent(mainContext, i.Id, class.Id, dto.PlaceStudentRequest{Student: student.Id}); err != nil {
+		t.Error(err)
+		return
+	}
+
+	_, err = institutions.RecordCourseRemarks(mainContext, i.Id, class.Id, course.Id, dto.RecordRemarksRequest{
+		AcademicTerm: term,
+		Remarks:      []dto.RemarkEntry{{Student: outsider.Id, Remark: "Good work"}},
+	})
+	assert.NotNil(t, err, "the student is not in the class")
+
+	remarks, err := institutions.RecordCourseRemarks(mainContext, i.Id, class.Id, course.Id, dto.RecordRemarksRequest{
+		AcademicTerm: term,
+		Remarks:      []dto.RemarkEntry{{Student: student.Id, Remark: "Good work"}},
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.Len(t, remarks.Remarks, 1)
+	assert.Equal(t, course.Id, *remarks.Remarks[0].Course)
+
+	remarks, err = institutions.RecordClassRemarks(mainContext, i.Id, class.Id, dto.RecordRemarksRequest{
+		AcademicTerm: term,
+		Remarks:      []dto.RemarkEntry{{Student: student.Id, Remark: "A promising term"}},
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.Len(t, remarks.Remarks, 1)
+	assert.Nil(t, remarks.Remarks[0].Course, "course remarks are kept apart from the class's")
+
+	remarks, err = institutions.RecordCourseRemarks(mainContext, i.Id, class.Id, course.Id, dto.RecordRemarksRequest{
+		AcademicTerm: term,
+		Remarks:      []dto.RemarkEntry{{Student: student.Id}},
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.Empty(t, remarks.Remarks, "empty remarks are cleared")
+
+	_, err = institutions.NewReportCardJob(mainContext, i.Id, class.Id, dto.NewReportCardJobRequest{AcademicTerm: term, Students: []uint64{outsider.Id}})
+	assert.NotNil(t, err, "the student was never placed in the class")
+
+	job, err := institutions.NewReportCardJob(mainContext, i.Id, class.Id, dto.NewReportCardJobRequest{AcademicTerm: term})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.Equal(t, dto.RJSPending, job.Status)
+
+	_, err = institutions.NewReportCardJob(mainContext, i.Id, class.Id, dto.NewReportCardJobRequest{AcademicTerm: term})
+	assert.NotNil(t, err, "report cards are already being generated")
+
+	found, err := institutions.FindReportCardJob(mainContext, i.Id, class.Id, job.Id)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.Equal(t, job.Id, found.Id)
+
+	// A job which never started stops blocking new ones once it expires
+	if err = institutions.AgeReportCardJob(context.TODO(), job.Id, 3*time.Hour); err != nil {
+		t.Error(err)
+		return
+	}
+	if err = institutions.ExpireReportCardJobs(context.TODO()); err != nil {
+		t.Error(err)
+		return
+	}
+	found, err = institutions.FindReportCardJob(mainContext, i.Id, class.Id, job.Id)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.Equal(t, dto.RJSFailed, found.Status)
+
+	_, err = institutions.NewReportCardJob(mainContext, i.Id, class.Id, dto.NewReportCardJobRequest{AcademicTerm: term})
+	assert.Nil(t, err)
+}
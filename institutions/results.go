@@ -0,0 +1,355 @@
+package institutions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"encore.dev/beta/errs"
+	"encore.dev/rlog"
+	"encore.dev/storage/sqldb"
+	"github.com/brinestone/scholaris/dto"
+	"github.com/brinestone/scholaris/models"
+	"github.com/brinestone/scholaris/util"
+)
+
+// Computes the averages and rankings of the students of a class for a term, or for the whole academic year
+//
+//encore:api auth method=GET path=/institutions/:id/classes/:class/results tag:can_view_class_results
+func FindClassResults(ctx context.Context, id, class uint64, req dto.ClassResultsRequest) (ans *dto.ClassResultsResponse, err error) {
+	c, err := findClass(ctx, nil, id, class)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		err = &util.ErrNotFound
+		return
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans, err = computeClassResults(ctx, c, req.AcademicTerm)
+	return
+}
+
+// Computes the averages and rankings of a student within the class they sat in during an academic year
+//
+//encore:api auth method=GET path=/institutions/:id/students/:student/results tag:can_view_student
+func FindStudentResults(ctx context.Context, id, student uint64, req dto.StudentResultsRequest) (ans *dto.StudentResultsResponse, err error) {
+	notPlaced := &errs.Error{
+		Code:    errs.NotFound,
+		Message: "The student was not placed in a class during this academic year",
+	}
+
+	if _, err = findStudent(ctx, nil, id, student); errors.Is(err, sqldb.ErrNoRows) {
+		err = &util.ErrNotFound
+		return
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	var class uint64
+	err = db.QueryRow(ctx, `
+		SELECT
+			p.class
+		FROM
+			class_placements p
+			JOIN classes c ON c.id = p.class
+		WHERE
+			c.institution = $1 AND p.academic_year = $2 AND p.student = $3
+		ORDER BY
+			p.removed_at IS NULL DESC, p.placed_at DESC
+		LIMIT 1;
+	`, id, req.AcademicYear, student).Scan(&class)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		err = notPlaced
+		return
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	c, err := findClass(ctx, nil, id, class)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	results, err := computeClassResults(ctx, c, req.AcademicTerm)
+	if err != nil {
+		return
+	}
+
+	ans = &dto.StudentResultsResponse{
+		Class:        results.Class,
+		AcademicYear: results.AcademicYear,
+		AcademicTerm: results.AcademicTerm,
+		Scale:        results.Scale,
+		ClassAverage: results.Average,
+	}
+
+	found := false
+	for _, r := range results.Results {
+		if r.Average != nil {
+			ans.ClassSize++
+		}
+		if r.Student == student {
+			ans.Result = r
+			found = true
+		}
+	}
+
+	if !found {
+		ans = nil
+		err = notPlaced
+	}
+	return
+}
+
+// Private section
+
+// A score along with what it weighs in its subject's term average
+type gradedScore struct {
+	student  uint64
+	course   uint64
+	term     uint64
+	score    float64
+	maxScore float64
+	weight   float64
+}
+
+func computeClassResults(ctx context.Context, class *models.Class, term uint64) (*dto.ClassResultsResponse, error) {
+	if term != 0 {
+		if err := assertClassTerm(ctx, nil, class.Id, term); err != nil {
+			return nil, err
+		}
+	}
+
+	scale, err := findLevelGradingScale(ctx, class.Level)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return nil, &util.ErrUnknown
+	}
+
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM
+			courses co
+			JOIN subjects s ON s.id = co.subject
+		WHERE
+			co.class = $1
+		ORDER BY
+			s.name;
+	`, courseFields)
+	courses, err := queryCourses(ctx, query, class.Id)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return nil, &util.ErrUnknown
+	}
+
+	// Students who left the class keep their place in the results they have scores in
+	query = fmt.Sprintf(`
+		SELECT %s
+		FROM
+			students s
+			JOIN classes c ON c.institution = s.institution
+		WHERE
+			c.id = $1
+			AND (
+				EXISTS(SELECT 1 FROM class_placements p WHERE p.class = c.id AND p.student = s.id AND p.removed_at IS NULL)
+				OR EXISTS(
+					SELECT 1
+					FROM
+						assessment_scores sc
+						JOIN assessments a ON a.id = sc.assessment
+						JOIN courses co ON co.id = a.course
+					WHERE
+						co.class = c.id AND sc.student = s.id AND ($2 = 0 OR a.academic_term = $2)
+				)
+			)
+		ORDER BY
+			s.last_name, s.first_name;
+	`, studentFields)
+	students, err := queryStudents(ctx, query, class.Id, term)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return nil, &util.ErrUnknown
+	}
+
+	scores, err := findClassScores(ctx, class.Id, term)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return nil, &util.ErrUnknown
+	}
+
+	ans := &dto.ClassResultsResponse{
+		Class:        class.Id,
+		AcademicYear: class.AcademicYear,
+		Scale:        scale,
+		Results:      computeResults(scale, students, courses, scores),
+	}
+	if term != 0 {
+		ans.AcademicTerm = &term
+	}
+
+	var total float64
+	var ranked int
+	for _, r := range ans.Results {
+		if r.Average != nil {
+			total += *r.Average
+			ranked++
+		}
+	}
+	if ranked > 0 {
+		average := scale.Round(total / float64(ranked))
+		ans.Average = &average
+	}
+	return ans, nil
+}
+
+func findClassScores(ctx context.Context, class, term uint64) (ans []gradedScore, err error) {
+	rows, err := db.Query(ctx, `
+		SELECT
+			sc.student, a.course, a.academic_term, sc.score, a.max_score, a.weight
+		FROM
+			assessment_scores sc
+			JOIN assessments a ON a.id = sc.assessment
+			JOIN courses co ON co.id = a.course
+		WHERE
+			co.class = $1 AND ($2 = 0 OR a.academic_term = $2) AND sc.score IS NOT NULL
+		ORDER BY
+			a.academic_term, a.id;
+	`, class, term)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var s gradedScore
+		if err = rows.Scan(&s.student, &s.course, &s.term, &s.score, &s.maxScore, &s.weight); err != nil {
+			return
+		}
+		ans = append(ans, s)
+	}
+	err = rows.Err()
+	return
+}
+
+// Computes the results of students from their scores. The average of a subject is the mean of its term averages,
+// each being the mean of the term's scores weighted by their assessments. The general average weighs the subject
+// averages by their coefficients. Students tied on an average share its rank.
+func computeResults(scale dto.GradingScale, students []*models.Student, courses []*models.Course, scores []gradedScore) []dto.StudentResult {
+	type termKey struct{ student, course, term uint64 }
+	type subjectKey struct{ student, course uint64 }
+
+	// The weighted sums of the fractions of the full marks obtained per term
+	points := make(map[termKey]float64)
+	weights := make(map[termKey]float64)
+	var terms []termKey
+	for _, s := range scores {
+		k := termKey{s.student, s.course, s.term}
+		if _, ok := weights[k]; !ok {
+			terms = append(terms, k)
+		}
+		points[k] += s.weight * s.score / s.maxScore
+		weights[k] += s.weight
+	}
+
+	termAverages := make(map[subjectKey][]float64)
+	for _, k := range terms {
+		sk := subjectKey{k.student, k.course}
+		termAverages[sk] = append(termAverages[sk], points[k]/weights[k])
+	}
+
+	results := make([]dto.StudentResult, 0, len(students))
+	general := make(map[uint64]float64)
+	bySubject := make([]map[uint64]float64, len(courses))
+	for i := range courses {
+		bySubject[i] = make(map[uint64]float64)
+	}
+
+	for _, s := range students {
+		r := dto.StudentResult{
+			Student:   s.Id,
+			Matricule: s.Matricule,
+			FirstName: s.FirstName,
+			LastName:  s.LastName,
+			Subjects:  make([]dto.SubjectResult, 0, len(courses)),
+		}
+
+		var total, coefficients float64
+		for i, c := range courses {
+			sr := dto.SubjectResult{
+				Subject:     c.Subject,
+				Name:        c.SubjectName,
+				Coefficient: c.Coefficient,
+			}
+			if averages, ok := termAverages[subjectKey{s.Id, c.Id}]; ok {
+				var sum float64
+				for _, a := range averages {
+					sum += a
+				}
+				ratio := sum / float64(len(averages))
+				mark := scale.Mark(ratio)
+				sr.Average = &mark
+				bySubject[i][s.Id] = mark
+				total += c.Coefficient * ratio
+				coefficients += c.Coefficient
+			}
+			r.Subjects = append(r.Subjects, sr)
+		}
+
+		if coefficients > 0 {
+			mark := scale.Mark(total / coefficients)
+			r.Average = &mark
+			r.Passed = scale.Passed(mark)
+			general[s.Id] = mark
+		}
+		results = append(results, r)
+	}
+
+	ranks := rankMarks(general)
+	subjectRanks := make([]map[uint64]int, len(courses))
+	for i := range courses {
+		subjectRanks[i] = rankMarks(bySubject[i])
+	}
+	for i := range results {
+		if rank, ok := ranks[results[i].Student]; ok {
+			results[i].Rank = &rank
+		}
+		for j := range results[i].Subjects {
+			if rank, ok := subjectRanks[j][results[i].Student]; ok {
+				results[i].Subjects[j].Rank = &rank
+			}
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := results[i].Rank, results[j].Rank
+		if a == nil || b == nil {
+			return a != nil
+		}
+		return *a < *b
+	})
+	return results
+}
+
+// Ranks marks from the highest, equal marks sharing the same rank
+func rankMarks(marks map[uint64]float64) map[uint64]int {
+	ans := make(map[uint64]int, len(marks))
+	for student, mark := range marks {
+		rank := 1
+		for _, other := range marks {
+			if other > mark {
+				rank++
+			}
+		}
+		ans[student] = rank
+	}
+	return ans
+}
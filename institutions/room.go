@@ -0,0 +1,183 @@
+package institutions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"encore.dev/beta/errs"
+	"encore.dev/rlog"
+	"encore.dev/storage/sqldb"
+	"github.com/brinestone/scholaris/dto"
+	"github.com/brinestone/scholaris/models"
+	"github.com/brinestone/scholaris/util"
+)
+
+// Creates a room classes can be scheduled in
+//
+//encore:api auth method=POST path=/institutions/:id/rooms tag:can_manage_timetables tag:institution_writable
+func CreateRoom(ctx context.Context, id uint64, req dto.NewRoomRequest) (ans *dto.Room, err error) {
+	query := fmt.Sprintf(`
+		INSERT INTO rooms AS r(institution, name, capacity)
+		SELECT $1,$2,$3
+		WHERE NOT EXISTS(SELECT 1 FROM rooms WHERE institution = $1 AND LOWER(name) = LOWER($2))
+		RETURNING %s;
+	`, roomFields)
+	room, err := scanRoom(db.QueryRow(ctx, query, id, req.Name, req.Capacity))
+	if errors.Is(err, sqldb.ErrNoRows) {
+		err = &errs.Error{
+			Code:    errs.AlreadyExists,
+			Message: fmt.Sprintf("A room named %q already exists", req.Name),
+		}
+		return
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = &roomsToDto(room)[0]
+	return
+}
+
+// Lists the rooms of an institution
+//
+//encore:api auth method=GET path=/institutions/:id/rooms tag:institution_member
+func FindRooms(ctx context.Context, id uint64) (ans *dto.RoomsResponse, err error) {
+	query := fmt.Sprintf("SELECT %s FROM rooms r WHERE r.institution = $1 ORDER BY r.name;", roomFields)
+	rooms, err := queryRooms(ctx, query, id)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = &dto.RoomsResponse{
+		Rooms: roomsToDto(rooms...),
+	}
+	return
+}
+
+// Updates a room. Slots already scheduled in the room are kept when its capacity shrinks.
+//
+//encore:api auth method=PATCH path=/institutions/:id/rooms/:room tag:can_manage_timetables tag:institution_writable
+func UpdateRoom(ctx context.Context, id, room uint64, req dto.UpdateRoomRequest) (ans *dto.Room, err error) {
+	if req.Name != nil {
+		var taken bool
+		if err = db.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM rooms WHERE id <> $1 AND institution = $2 AND LOWER(name) = LOWER($3));", room, id, *req.Name).Scan(&taken); err != nil {
+			rlog.Error(util.MsgDbAccessError, "err", err)
+			err = &util.ErrUnknown
+			return
+		}
+
+		if taken {
+			err = &errs.Error{
+				Code:    errs.AlreadyExists,
+				Message: fmt.Sprintf("A room named %q already exists", *req.Name),
+			}
+			return
+		}
+	}
+
+	query := fmt.Sprintf(`
+		UPDATE rooms r SET
+			name = COALESCE($3, name),
+			capacity = CASE WHEN $4::INT IS NULL THEN capacity ELSE NULLIF($4, 0) END,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE
+			r.id = $1 AND r.institution = $2
+		RETURNING %s;
+	`, roomFields)
+	updated, err := scanRoom(db.QueryRow(ctx, query, room, id, req.Name, req.Capacity))
+	if errors.Is(err, sqldb.ErrNoRows) {
+		err = &util.ErrNotFound
+		return
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = &roomsToDto(updated)[0]
+	return
+}
+
+// Deletes a room which no class is scheduled in
+//
+//encore:api auth method=DELETE path=/institutions/:id/rooms/:room tag:can_manage_timetables tag:institution_writable
+func DeleteRoom(ctx context.Context, id, room uint64) error {
+	var exists, inUse bool
+	if err := db.QueryRow(ctx, `
+		SELECT
+			EXISTS(SELECT 1 FROM rooms WHERE id = $1 AND institution = $2),
+			EXISTS(SELECT 1 FROM timetable_slots WHERE room = $1);
+	`, room, id).Scan(&exists, &inUse); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return &util.ErrUnknown
+	}
+
+	if !exists {
+		return &util.ErrNotFound
+	}
+	if inUse {
+		return &errs.Error{
+			Code:    errs.FailedPrecondition,
+			Message: "Rooms which classes are scheduled in cannot be deleted",
+		}
+	}
+
+	if _, err := db.Exec(ctx, "DELETE FROM rooms WHERE id = $1;", room); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return &util.ErrUnknown
+	}
+	return nil
+}
+
+// Private section
+
+const roomFields = "r.id,r.institution,r.name,r.capacity,r.created_at,r.updated_at"
+
+func queryRooms(ctx context.Context, query string, args ...any) (ans []*models.Room, err error) {
+	rows, err := db.Query(ctx, query, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r *models.Room
+		if r, err = scanRoom(rows); err != nil {
+			return
+		}
+		ans = append(ans, r)
+	}
+	err = rows.Err()
+	return
+}
+
+func scanRoom(row rowScanner) (*models.Room, error) {
+	r := new(models.Room)
+	if err := row.Scan(&r.Id, &r.Institution, &r.Name, &r.Capacity, &r.CreatedAt, &r.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func roomsToDto(rooms ...*models.Room) (ans []dto.Room) {
+	ans = make([]dto.Room, 0, len(rooms))
+	for _, r := range rooms {
+		v := dto.Room{
+			Id:          r.Id,
+			Institution: r.Institution,
+			Name:        r.Name,
+			CreatedAt:   r.CreatedAt,
+			UpdatedAt:   r.UpdatedAt,
+		}
+		if r.Capacity.Valid {
+			capacity := uint(r.Capacity.Int32)
+			v.Capacity = &capacity
+		}
+		ans = append(ans, v)
+	}
+	return
+}
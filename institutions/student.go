@@ -0,0 +1,1121 @@
+package institutions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"encore.dev/beta/auth"
+	"encore.dev/beta/errs"
+	"encore.dev/rlog"
+	"encore.dev/storage/sqldb"
+	"github.com/brinestone/scholaris/core/permissions"
+	"github.com/brinestone/scholaris/core/users"
+	"github.com/brinestone/scholaris/dto"
+	"github.com/brinestone/scholaris/models"
+	"github.com/brinestone/scholaris/util"
+)
+
+// Creates a student record with a new matricule
+//
+//encore:api auth method=POST path=/institutions/:id/students tag:can_manage_students tag:institution_writable
+func CreateStudent(ctx context.Context, id uint64, req dto.NewStudentRequest) (ans *dto.Student, err error) {
+	uid, _ := auth.UserID()
+	createdBy, _ := strconv.ParseUint(string(uid), 10, 64)
+
+	if req.Account != nil {
+		if err = assertStudentAccount(ctx, id, 0, *req.Account); err != nil {
+			return
+		}
+	}
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+	defer tx.Rollback()
+
+	student, err := insertStudent(ctx, tx, id, nil, &createdBy, req)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if err = permissions.SetPermissions(ctx, dto.UpdatePermissionsRequest{Updates: studentPermissions(student)}); err != nil {
+		rlog.Error(util.MsgCallError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = &studentsToDto(student)[0]
+	return
+}
+
+// Lists the student records of an institution, optionally narrowed down to a status or a search term
+//
+//encore:api auth method=GET path=/institutions/:id/students tag:can_manage_students
+func FindStudents(ctx context.Context, id uint64, req dto.FindStudentsRequest) (ans *dto.StudentsResponse, err error) {
+	size := req.PageSize()
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM
+			students s
+		WHERE
+			s.institution = $1
+			AND s.id > $2
+			AND ($3 = '' OR s.status = $3)
+			AND ($4 = '' OR s.matricule ILIKE $4 || '%%' OR s.first_name ILIKE $4 || '%%' OR s.last_name ILIKE $4 || '%%')
+		ORDER BY
+			s.id
+		LIMIT $5;
+	`, studentFields)
+	students, err := queryStudents(ctx, query, id, req.After, req.Status, strings.TrimSpace(req.Search), size+1)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = &dto.StudentsResponse{}
+	if uint(len(students)) > size {
+		students = students[:size]
+		ans.Next = students[size-1].Id
+	}
+	ans.Students = studentsToDto(students...)
+	return
+}
+
+// Finds a student record
+//
+//encore:api auth method=GET path=/institutions/:id/students/:student tag:can_view_student
+func FindStudent(ctx context.Context, id, student uint64) (ans *dto.Student, err error) {
+	s, err := findStudent(ctx, nil, id, student)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		err = &util.ErrNotFound
+		return
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = &studentsToDto(s)[0]
+	return
+}
+
+// Updates the personal details of a student
+//
+//encore:api auth method=PATCH path=/institutions/:id/students/:student tag:can_manage_students tag:institution_writable
+func UpdateStudent(ctx context.Context, id, student uint64, req dto.UpdateStudentRequest) (ans *dto.Student, err error) {
+	query := fmt.Sprintf(`
+		UPDATE students s SET
+			first_name = COALESCE($3, first_name),
+			last_name = COALESCE($4, last_name),
+			gender = CASE WHEN $5::TEXT IS NULL THEN gender ELSE NULLIF($5, '') END,
+			date_of_birth = COALESCE($6::DATE, date_of_birth),
+			place_of_birth = CASE WHEN $7::TEXT IS NULL THEN place_of_birth ELSE NULLIF($7, '') END,
+			nationality = CASE WHEN $8::TEXT IS NULL THEN nationality ELSE NULLIF($8, '') END,
+			address = CASE WHEN $9::TEXT IS NULL THEN address ELSE NULLIF($9, '') END,
+			phone = CASE WHEN $10::TEXT IS NULL THEN phone ELSE NULLIF($10, '') END,
+			email = CASE WHEN $11::TEXT IS NULL THEN email ELSE NULLIF($11, '') END,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE
+			s.id = $1 AND s.institution = $2
+		RETURNING %s;
+	`, studentFields)
+	updated, err := scanStudent(db.QueryRow(ctx, query, student, id, req.FirstName, req.LastName, req.Gender, req.DateOfBirth, req.PlaceOfBirth, req.Nationality, req.Address, req.Phone, req.Email))
+	if errors.Is(err, sqldb.ErrNoRows) {
+		err = &util.ErrNotFound
+		return
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = &studentsToDto(updated)[0]
+	return
+}
+
+// Changes the status of a student. Students who graduate or are withdrawn leave their classes and lose their
+// student role in the institution.
+//
+//encore:api auth method=POST path=/institutions/:id/students/:student/status tag:can_manage_students tag:institution_writable
+func ChangeStudentStatus(ctx context.Context, id, student uint64, req dto.StudentStatusRequest) (ans *dto.Student, err error) {
+	uid, _ := auth.UserID()
+	changedBy, _ := strconv.ParseUint(string(uid), 10, 64)
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+	defer tx.Rollback()
+
+	current, err := lockStudent(ctx, tx, id, student)
+	if err != nil {
+		return
+	}
+
+	previous := dto.StudentStatus(current.Status)
+	if previous == req.Status {
+		err = &errs.Error{
+			Code:    errs.FailedPrecondition,
+			Message: fmt.Sprintf("The student is already %s", req.Status),
+		}
+		return
+	}
+
+	query := fmt.Sprintf(`
+		UPDATE students s SET
+			status = $2,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE
+			s.id = $1
+		RETURNING %s;
+	`, studentFields)
+	updated, err := scanStudent(tx.QueryRow(ctx, query, student, req.Status))
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if err = recordStudentStatusChange(ctx, tx, student, req.Status, &previous, req.Reason, &changedBy); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if previous.Attending() != req.Status.Attending() {
+		change := dto.ReplacePermissionsRequest{}
+		var memberships []dto.PermissionUpdate
+		if updated.Account.Valid {
+			memberships = append(memberships, dto.PermissionUpdate{Actor: dto.IdentifierString(dto.PTUser, uint64(updated.Account.Int64)), Relation: dto.PNStudent, Target: dto.IdentifierString(dto.PTInstitution, id)})
+		}
+
+		if req.Status.Attending() {
+			change.Writes = append(change.Writes, memberships...)
+		} else {
+			reason := dto.PRRWithdrawn
+			if req.Status == dto.SSGraduated {
+				reason = dto.PRRGraduated
+			}
+
+			var classes []uint64
+			if classes, err = endStudentPlacements(ctx, tx, id, student, changedBy, reason, req.Reason); err != nil {
+				rlog.Error(util.MsgDbAccessError, "err", err)
+				err = &util.ErrUnknown
+				return
+			}
+
+			change.Deletes = append(change.Deletes, memberships...)
+			for _, class := range classes {
+				change.Deletes = append(change.Deletes, dto.PermissionUpdate{Actor: classStudent(student), Relation: dto.PNStudent, Target: dto.IdentifierString(dto.PTClass, class)})
+			}
+		}
+
+		if len(change.Writes) > 0 || len(change.Deletes) > 0 {
+			if err = permissions.ReplacePermissions(ctx, change); err != nil {
+				rlog.Error(util.MsgCallError, "err", err)
+				err = &util.ErrUnknown
+				return
+			}
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = &studentsToDto(updated)[0]
+	return
+}
+
+// Lists the status changes of a student, newest first
+//
+//encore:api auth method=GET path=/institutions/:id/students/:student/status-history tag:can_view_student
+func FindStudentStatusHistory(ctx context.Context, id, student uint64) (ans *dto.StudentStatusHistoryResponse, err error) {
+	rows, err := db.Query(ctx, `
+		SELECT
+			h.id, h.student, h.status, h.previous_status, h.reason, h.changed_by, h.changed_at
+		FROM
+			student_status_changes h
+			JOIN students s ON s.id = h.student
+		WHERE
+			h.student = $1 AND s.institution = $2
+		ORDER BY
+			h.changed_at DESC, h.id DESC;
+	`, student, id)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+	defer rows.Close()
+
+	ans = &dto.StudentStatusHistoryResponse{
+		Changes: make([]dto.StudentStatusChange, 0),
+	}
+	for rows.Next() {
+		var c models.StudentStatusChange
+		if err = rows.Scan(&c.Id, &c.Student, &c.Status, &c.PreviousStatus, &c.Reason, &c.ChangedBy, &c.ChangedAt); err != nil {
+			rlog.Error(util.MsgDbAccessError, "err", err)
+			err = &util.ErrUnknown
+			return
+		}
+		ans.Changes = append(ans.Changes, statusChangeToDto(&c))
+	}
+	if err = rows.Err(); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+	}
+	return
+}
+
+// Links a user account to a student record, replacing the account linked before
+//
+//encore:api auth method=PUT path=/institutions/:id/students/:student/account tag:can_manage_students tag:institution_writable
+func LinkStudentAccount(ctx context.Context, id, student uint64, req dto.StudentAccountRequest) (ans *dto.Student, err error) {
+	if _, err = users.FindUserById(ctx, req.User); errs.Code(err) == errs.NotFound {
+		err = &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: "The user does not exist",
+		}
+		return
+	} else if err != nil {
+		rlog.Error(util.MsgCallError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if err = assertStudentAccount(ctx, id, student, req.User); err != nil {
+		return
+	}
+
+	return setStudentAccount(ctx, id, student, &req.User)
+}
+
+// Unlinks the user account of a student record
+//
+//encore:api auth method=DELETE path=/institutions/:id/students/:student/account tag:can_manage_students tag:institution_writable
+func UnlinkStudentAccount(ctx context.Context, id, student uint64) (*dto.Student, error) {
+	return setStudentAccount(ctx, id, student, nil)
+}
+
+// Adds a guardian to the contacts of a student
+//
+//encore:api auth method=POST path=/institutions/:id/students/:student/guardians tag:can_manage_students tag:institution_writable
+func AddStudentGuardian(ctx context.Context, id, student uint64, req dto.NewStudentGuardianRequest) (ans *dto.StudentGuardian, err error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err = lockStudent(ctx, tx, id, student); err != nil {
+		return
+	}
+
+	if req.IsPrimary {
+		if _, err = tx.Exec(ctx, "UPDATE student_guardians SET is_primary = FALSE, updated_at = CURRENT_TIMESTAMP WHERE student = $1 AND is_primary;", student); err != nil {
+			rlog.Error(util.MsgDbAccessError, "err", err)
+			err = &util.ErrUnknown
+			return
+		}
+	}
+
+	query := fmt.Sprintf(`
+		INSERT INTO student_guardians AS g(student, name, relationship, phone, email, address, is_primary)
+		VALUES ($1,$2,$3,$4,$5,$6,$7)
+		RETURNING %s;
+	`, guardianFields)
+	guardian, err := scanGuardian(tx.QueryRow(ctx, query, student, strings.TrimSpace(req.Name), req.Relationship, req.Phone, req.Email, req.Address, req.IsPrimary))
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = &guardiansToDto(guardian)[0]
+	return
+}
+
+// Lists the guardians of a student, primary guardian first
+//
+//encore:api auth method=GET path=/institutions/:id/students/:student/guardians tag:can_view_student
+func FindStudentGuardians(ctx context.Context, id, student uint64) (ans *dto.StudentGuardiansResponse, err error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM
+			student_guardians g
+			JOIN students s ON s.id = g.student
+		WHERE
+			g.student = $1 AND s.institution = $2
+		ORDER BY
+			g.is_primary DESC, g.id;
+	`, guardianFields)
+	guardians, err := queryGuardians(ctx, query, student, id)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = &dto.StudentGuardiansResponse{
+		Guardians: guardiansToDto(guardians...),
+	}
+	return
+}
+
+// Removes a guardian from the contacts of a student. The guardian's account loses access to the student's records.
+//
+//encore:api auth method=DELETE path=/institutions/:id/students/:student/guardians/:guardian tag:can_manage_students tag:institution_writable
+func RemoveStudentGuardian(ctx context.Context, id, student, guardian uint64) (err error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return &util.ErrUnknown
+	}
+	defer tx.Rollback()
+
+	query := fmt.Sprintf(`
+		DELETE FROM student_guardians g
+		USING students s
+		WHERE
+			s.id = g.student AND g.id = $1 AND g.student = $2 AND s.institution = $3
+		RETURNING %s;
+	`, guardianFields)
+	removed, err := scanGuardian(tx.QueryRow(ctx, query, guardian, student, id))
+	if errors.Is(err, sqldb.ErrNoRows) {
+		return &util.ErrNotFound
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return &util.ErrUnknown
+	}
+
+	if removed.Account.Valid {
+		if err = permissions.DeletePermissions(ctx, dto.UpdatePermissionsRequest{
+			Updates: []dto.PermissionUpdate{guardianPermission(removed)},
+		}); err != nil {
+			rlog.Error(util.MsgCallError, "err", err)
+			return &util.ErrUnknown
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return &util.ErrUnknown
+	}
+	return
+}
+
+// Records a medical note about a student. Medical notes are only visible to the student, the maintainers of the
+// institution and the users granted access to them.
+//
+//encore:api auth method=POST path=/institutions/:id/students/:student/medical-notes tag:can_edit_student_medical tag:institution_writable
+func AddStudentMedicalNote(ctx context.Context, id, student uint64, req dto.NewStudentMedicalNoteRequest) (ans *dto.StudentMedicalNote, err error) {
+	uid, _ := auth.UserID()
+	recordedBy, _ := strconv.ParseUint(string(uid), 10, 64)
+
+	query := fmt.Sprintf(`
+		INSERT INTO student_medical_notes AS n(student, category, note, recorded_by)
+		SELECT
+			s.id, $3, $4, $5
+		FROM
+			students s
+		WHERE
+			s.id = $1 AND s.institution = $2
+		RETURNING %s;
+	`, medicalNoteFields)
+	note, err := scanMedicalNote(db.QueryRow(ctx, query, student, id, req.Category, strings.TrimSpace(req.Note), recordedBy))
+	if errors.Is(err, sqldb.ErrNoRows) {
+		err = &util.ErrNotFound
+		return
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = &medicalNotesToDto(note)[0]
+	return
+}
+
+// Lists the medical notes of a student, newest first
+//
+//encore:api auth method=GET path=/institutions/:id/students/:student/medical-notes tag:can_view_student_medical
+func FindStudentMedicalNotes(ctx context.Context, id, student uint64) (ans *dto.StudentMedicalNotesResponse, err error) {
+	rows, err := db.Query(ctx, fmt.Sprintf(`
+		SELECT %s
+		FROM
+			student_medical_notes n
+			JOIN students s ON s.id = n.student
+		WHERE
+			n.student = $1 AND s.institution = $2
+		ORDER BY
+			n.recorded_at DESC, n.id DESC;
+	`, medicalNoteFields), student, id)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+	defer rows.Close()
+
+	var notes []*models.StudentMedicalNote
+	for rows.Next() {
+		var n *models.StudentMedicalNote
+		if n, err = scanMedicalNote(rows); err != nil {
+			rlog.Error(util.MsgDbAccessError, "err", err)
+			err = &util.ErrUnknown
+			return
+		}
+		notes = append(notes, n)
+	}
+	if err = rows.Err(); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = &dto.StudentMedicalNotesResponse{
+		Notes: medicalNotesToDto(notes...),
+	}
+	return
+}
+
+// Deletes a medical note of a student
+//
+//encore:api auth method=DELETE path=/institutions/:id/students/:student/medical-notes/:note tag:can_edit_student_medical tag:institution_writable
+func DeleteStudentMedicalNote(ctx context.Context, id, student, note uint64) error {
+	res, err := db.Exec(ctx, `
+		DELETE FROM student_medical_notes n
+		USING students s
+		WHERE
+			s.id = n.student AND n.id = $1 AND n.student = $2 AND s.institution = $3;
+	`, note, student, id)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return &util.ErrUnknown
+	}
+
+	if res.RowsAffected() == 0 {
+		return &util.ErrNotFound
+	}
+	return nil
+}
+
+// Private section
+
+// Creates the student record of an accepted enrollment, linking the account of its responder to it. Enrollments which
+// already have a record are skipped.
+func createEnrollmentStudent(ctx context.Context, msg *EnrollmentAccepted) error {
+	var exists bool
+	if err := db.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM students WHERE enrollment = $1);", msg.Id).Scan(&exists); err != nil {
+		return err
+	} else if exists {
+		return nil
+	}
+
+	// The account may already be linked to a record of the institution, e.g. from an earlier enrollment. That record
+	// is kept, and takes the enrollment when it has none.
+	if err := assertStudentAccount(ctx, msg.Institution, 0, msg.Responder); errs.Code(err) == errs.AlreadyExists {
+		_, err = db.Exec(ctx, "UPDATE students SET enrollment = $1, updated_at = CURRENT_TIMESTAMP WHERE institution = $2 AND user_account = $3 AND enrollment IS NULL;", msg.Id, msg.Institution, msg.Responder)
+		return err
+	} else if err != nil {
+		return err
+	}
+
+	user, err := users.FindUserById(ctx, msg.Responder)
+	if err != nil {
+		return err
+	}
+
+	req := studentRequestFromUser(user)
+	req.Account = &msg.Responder
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	acceptedBy, _ := strconv.ParseUint(string(msg.AcceptedBy), 10, 64)
+	student, err := insertStudent(ctx, tx, msg.Institution, &msg.Id, &acceptedBy, req)
+	if err != nil {
+		return err
+	}
+
+	if err = permissions.SetPermissions(ctx, dto.UpdatePermissionsRequest{Updates: studentPermissions(student)}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+const studentBackfillBatchSize = 20
+
+// Creates the records of students admitted before student records existed from the authorization store
+//
+//encore:api private method=POST path=/institutions/students/backfill
+func BackfillStudents(ctx context.Context) error {
+	rows, err := db.Query(ctx, "SELECT id FROM institutions WHERE NOT students_backfilled ORDER BY id LIMIT $1;", studentBackfillBatchSize)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return err
+	}
+	defer rows.Close()
+
+	var institutions []uint64
+	for rows.Next() {
+		var id uint64
+		if err = rows.Scan(&id); err != nil {
+			rlog.Error(util.MsgDbAccessError, "err", err)
+			return err
+		}
+		institutions = append(institutions, id)
+	}
+	if err = rows.Err(); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return err
+	}
+
+	for _, institution := range institutions {
+		if err = backfillStudents(ctx, institution); err != nil {
+			rlog.Error("could not backfill students", "institution", institution, "err", err)
+			return err
+		}
+	}
+	return nil
+}
+
+func backfillStudents(ctx context.Context, institution uint64) error {
+	res, err := permissions.ListUsersInternal(ctx, dto.ListUsersRequest{
+		Target:   dto.IdentifierString(dto.PTInstitution, institution),
+		Relation: dto.PNStudent,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, account := range res.Users {
+		if err = backfillStudent(ctx, institution, account); err != nil {
+			return err
+		}
+	}
+
+	_, err = db.Exec(ctx, "UPDATE institutions SET students_backfilled = true WHERE id = $1;", institution)
+	return err
+}
+
+// Creates the record of a legacy student unless their account is already linked to one. The record takes the latest
+// enrollment of the account which has none, accepting it.
+func backfillStudent(ctx context.Context, institution, account uint64) error {
+	var linked bool
+	if err := db.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM students WHERE institution = $1 AND user_account = $2);", institution, account).Scan(&linked); err != nil {
+		return err
+	} else if linked {
+		return nil
+	}
+
+	user, err := users.FindUserById(ctx, account)
+	if errs.Code(err) == errs.NotFound {
+		rlog.Warn("skipping the student record of a missing account", "institution", institution, "account", account)
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	req := studentRequestFromUser(user)
+	req.Account = &account
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var enrollment *uint64
+	err = tx.QueryRow(ctx, `
+		SELECT
+			e.id
+		FROM
+			enrollments e
+		WHERE
+			e.institution = $1 AND e.responder = $2 AND e.status <> 'rejected'
+			AND NOT EXISTS (SELECT 1 FROM students s WHERE s.enrollment = e.id)
+		ORDER BY e.created_at DESC
+		LIMIT 1;
+	`, institution, account).Scan(&enrollment)
+	if err != nil && !errors.Is(err, sqldb.ErrNoRows) {
+		return err
+	}
+
+	if enrollment != nil {
+		if _, err = tx.Exec(ctx, "UPDATE enrollments SET status = $2, decided_at = CURRENT_TIMESTAMP WHERE id = $1 AND status = $3;", *enrollment, dto.ESAccepted, dto.ESPending); err != nil {
+			return err
+		}
+	}
+
+	student, err := insertStudent(ctx, tx, institution, enrollment, nil, req)
+	if err != nil {
+		return err
+	}
+
+	// The account already is a student of the institution, which ReplacePermissions leaves as is
+	if err = permissions.ReplacePermissions(ctx, dto.ReplacePermissionsRequest{Writes: studentPermissions(student)}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Fills the personal details of a student record from the profile of their user account
+func studentRequestFromUser(user *models.User) (req dto.NewStudentRequest) {
+	for _, a := range user.ProvidedAccounts {
+		if a.FirstName == nil || len(strings.TrimSpace(*a.FirstName)) == 0 {
+			continue
+		}
+
+		req.FirstName = strings.TrimSpace(*a.FirstName)
+		if a.LastName != nil {
+			req.LastName = strings.TrimSpace(*a.LastName)
+		}
+		if a.Gender != nil && dto.Gender(*a.Gender).Validate() == nil {
+			gender := dto.Gender(*a.Gender)
+			req.Gender = &gender
+		}
+		if a.Dob != nil && a.Dob.Valid {
+			req.DateOfBirth = &a.Dob.Time
+		}
+		break
+	}
+
+	if email, ok := primaryEmailOf(user); ok {
+		req.Email = &email
+	}
+	return
+}
+
+// Inserts a student record along with its first status change
+func insertStudent(ctx context.Context, tx *sqldb.Tx, institution uint64, enrollment, createdBy *uint64, req dto.NewStudentRequest) (*models.Student, error) {
+	matricule, err := nextMatricule(ctx, tx, institution)
+	if err != nil {
+		return nil, err
+	}
+
+	query := fmt.Sprintf(`
+		INSERT INTO students AS s(institution, matricule, enrollment, user_account, first_name, last_name, gender, date_of_birth, place_of_birth, nationality, address, phone, email, created_by)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8::DATE,$9,$10,$11,$12,$13,$14)
+		RETURNING %s;
+	`, studentFields)
+	student, err := scanStudent(tx.QueryRow(ctx, query, institution, matricule, enrollment, req.Account, strings.TrimSpace(req.FirstName), strings.TrimSpace(req.LastName), req.Gender, req.DateOfBirth, req.PlaceOfBirth, req.Nationality, req.Address, req.Phone, req.Email, createdBy))
+	if err != nil {
+		return nil, err
+	}
+
+	if err = recordStudentStatusChange(ctx, tx, student.Id, dto.SSActive, nil, nil, createdBy); err != nil {
+		return nil, err
+	}
+	return student, nil
+}
+
+// Hands out the next matricule of an institution. Matricules look like "SMC-2026-00042": the initials of the
+// institution's slug, the current year and a number counting up from 1 every year.
+func nextMatricule(ctx context.Context, tx *sqldb.Tx, institution uint64) (string, error) {
+	year := time.Now().Year()
+
+	var number int
+	var slug string
+	if err := tx.QueryRow(ctx, `
+		INSERT INTO student_matricule_sequences(institution, year, last_value)
+		VALUES ($1,$2,1)
+		ON CONFLICT (institution, year) DO UPDATE SET
+			last_value = student_matricule_sequences.last_value + 1
+		RETURNING last_value, (SELECT slug FROM institutions WHERE id = $1);
+	`, institution, year).Scan(&number, &slug); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s-%d-%05d", matriculePrefix(slug), year, number), nil
+}
+
+func matriculePrefix(slug string) string {
+	words := strings.FieldsFunc(strings.ToUpper(slug), func(r rune) bool {
+		return (r < 'A' || r > 'Z') && (r < '0' || r > '9')
+	})
+
+	switch {
+	case len(words) == 0:
+		return "STU"
+	case len(words) == 1:
+		return words[0][:min(3, len(words[0]))]
+	}
+
+	var prefix strings.Builder
+	for _, w := range words[:min(4, len(words))] {
+		prefix.WriteByte(w[0])
+	}
+	return prefix.String()
+}
+
+func recordStudentStatusChange(ctx context.Context, tx *sqldb.Tx, student uint64, status dto.StudentStatus, previous *dto.StudentStatus, reason *string, changedBy *uint64) (err error) {
+	_, err = tx.Exec(ctx, `
+		INSERT INTO student_status_changes(student, status, previous_status, reason, changed_by)
+		VALUES ($1,$2,$3,$4,$5);
+	`, student, status, previous, reason, changedBy)
+	return
+}
+
+// Ensures an account is not linked to another student record of the institution
+func assertStudentAccount(ctx context.Context, institution, student, account uint64) error {
+	var taken bool
+	if err := db.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM students WHERE institution = $1 AND user_account = $2 AND id <> $3);", institution, account, student).Scan(&taken); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return &util.ErrUnknown
+	}
+
+	if taken {
+		return &errs.Error{
+			Code:    errs.AlreadyExists,
+			Message: "The account is already linked to another student of this institution",
+		}
+	}
+	return nil
+}
+
+// Changes the account linked to a student record, moving its relations along
+func setStudentAccount(ctx context.Context, institution, student uint64, account *uint64) (ans *dto.Student, err error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+	defer tx.Rollback()
+
+	current, err := lockStudent(ctx, tx, institution, student)
+	if err != nil {
+		return
+	}
+
+	query := fmt.Sprintf(`
+		UPDATE students s SET
+			user_account = $2,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE
+			s.id = $1
+		RETURNING %s;
+	`, studentFields)
+	updated, err := scanStudent(tx.QueryRow(ctx, query, student, account))
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	change := dto.ReplacePermissionsRequest{}
+	if current.Account.Valid && (account == nil || uint64(current.Account.Int64) != *account) {
+		change.Deletes = studentAccountPermissions(current)
+	}
+	if account != nil && (!current.Account.Valid || uint64(current.Account.Int64) != *account) {
+		change.Writes = studentAccountPermissions(updated)
+	}
+	if len(change.Writes) > 0 || len(change.Deletes) > 0 {
+		if err = permissions.ReplacePermissions(ctx, change); err != nil {
+			rlog.Error(util.MsgCallError, "err", err)
+			err = &util.ErrUnknown
+			return
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = &studentsToDto(updated)[0]
+	return
+}
+
+func studentPermissions(s *models.Student) []dto.PermissionUpdate {
+	return append([]dto.PermissionUpdate{
+		{Actor: dto.IdentifierString(dto.PTInstitution, s.Institution), Relation: dto.PNOwner, Target: dto.IdentifierString(dto.PTStudentRecord, s.Id)},
+	}, studentAccountPermissions(s)...)
+}
+
+// The relations of the account linked to a student record. Accounts of attending students are students of the
+// institution.
+func studentAccountPermissions(s *models.Student) (ans []dto.PermissionUpdate) {
+	if !s.Account.Valid {
+		return
+	}
+
+	actor := dto.IdentifierString(dto.PTUser, uint64(s.Account.Int64))
+	ans = append(ans, dto.PermissionUpdate{Actor: actor, Relation: dto.PNAccount, Target: dto.IdentifierString(dto.PTStudentRecord, s.Id)})
+	if dto.StudentStatus(s.Status).Attending() {
+		ans = append(ans, dto.PermissionUpdate{Actor: actor, Relation: dto.PNStudent, Target: dto.IdentifierString(dto.PTInstitution, s.Institution)})
+	}
+	return
+}
+
+// Ends the active class placements of a student, returning the classes they left
+func endStudentPlacements(ctx context.Context, tx *sqldb.Tx, institution, student, removedBy uint64, reason dto.PlacementRemovalReason, note *string) (ans []uint64, err error) {
+	rows, err := tx.Query(ctx, `
+		UPDATE class_placements p SET
+			removed_at = CURRENT_TIMESTAMP,
+			removed_by = $3,
+			removal_reason = $4,
+			removal_note = $5
+		FROM
+			classes c
+		WHERE
+			c.id = p.class AND c.institution = $1 AND p.student = $2 AND p.removed_at IS NULL
+		RETURNING p.class;
+	`, institution, student, removedBy, reason, note)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var class uint64
+		if err = rows.Scan(&class); err != nil {
+			return
+		}
+		ans = append(ans, class)
+	}
+	err = rows.Err()
+	return
+}
+
+// Locks a student record of an institution for an update
+func lockStudent(ctx context.Context, tx *sqldb.Tx, institution, student uint64) (*models.Student, error) {
+	s, err := scanStudent(tx.QueryRow(ctx, fmt.Sprintf("SELECT %s FROM students s WHERE s.id = $1 AND s.institution = $2 FOR UPDATE;", studentFields), student, institution))
+	if errors.Is(err, sqldb.ErrNoRows) {
+		return nil, &util.ErrNotFound
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return nil, &util.ErrUnknown
+	}
+	return s, nil
+}
+
+const studentFields = "s.id,s.institution,s.matricule,s.enrollment,s.user_account,s.first_name,s.last_name,s.gender,s.date_of_birth,s.place_of_birth,s.nationality,s.address,s.phone,s.email,s.status,s.created_by,s.created_at,s.updated_at"
+
+// Finds a student record of an institution, within the transaction when one is given
+func findStudent(ctx context.Context, tx *sqldb.Tx, institution, student uint64) (*models.Student, error) {
+	query := fmt.Sprintf("SELECT %s FROM students s WHERE s.id = $1 AND s.institution = $2;", studentFields)
+	if tx != nil {
+		return scanStudent(tx.QueryRow(ctx, query, student, institution))
+	}
+	return scanStudent(db.QueryRow(ctx, query, student, institution))
+}
+
+func queryStudents(ctx context.Context, query string, args ...any) (ans []*models.Student, err error) {
+	rows, err := db.Query(ctx, query, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var s *models.Student
+		if s, err = scanStudent(rows); err != nil {
+			return
+		}
+		ans = append(ans, s)
+	}
+	err = rows.Err()
+	return
+}
+
+func scanStudent(row rowScanner) (*models.Student, error) {
+	s := new(models.Student)
+	if err := row.Scan(&s.Id, &s.Institution, &s.Matricule, &s.Enrollment, &s.Account, &s.FirstName, &s.LastName, &s.Gender, &s.DateOfBirth, &s.PlaceOfBirth, &s.Nationality, &s.Address, &s.Phone, &s.Email, &s.Status, &s.CreatedBy, &s.CreatedAt, &s.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func studentsToDto(students ...*models.Student) (ans []dto.Student) {
+	ans = make([]dto.Student, 0, len(students))
+	for _, s := range students {
+		v := dto.Student{
+			Id:          s.Id,
+			Institution: s.Institution,
+			Matricule:   s.Matricule,
+			FirstName:   s.FirstName,
+			LastName:    s.LastName,
+			Status:      dto.StudentStatus(s.Status),
+			CreatedAt:   s.CreatedAt,
+			UpdatedAt:   s.UpdatedAt,
+		}
+		if s.Enrollment.Valid {
+			enrollment := uint64(s.Enrollment.Int64)
+			v.Enrollment = &enrollment
+		}
+		if s.Account.Valid {
+			account := uint64(s.Account.Int64)
+			v.Account = &account
+		}
+		if s.Gender.Valid {
+			gender := dto.Gender(s.Gender.String)
+			v.Gender = &gender
+		}
+		if s.DateOfBirth.Valid {
+			v.DateOfBirth = &s.DateOfBirth.Time
+		}
+		if s.PlaceOfBirth.Valid {
+			v.PlaceOfBirth = &s.PlaceOfBirth.String
+		}
+		if s.Nationality.Valid {
+			v.Nationality = &s.Nationality.String
+		}
+		if s.Address.Valid {
+			v.Address = &s.Address.String
+		}
+		if s.Phone.Valid {
+			v.Phone = &s.Phone.String
+		}
+		if s.Email.Valid {
+			v.Email = &s.Email.String
+		}
+		if s.CreatedBy.Valid {
+			createdBy := uint64(s.CreatedBy.Int64)
+			v.CreatedBy = &createdBy
+		}
+		ans = append(ans, v)
+	}
+	return
+}
+
+func statusChangeToDto(c *models.StudentStatusChange) dto.StudentStatusChange {
+	ans := dto.StudentStatusChange{
+		Id:        c.Id,
+		Student:   c.Student,
+		Status:    dto.StudentStatus(c.Status),
+		ChangedAt: c.ChangedAt,
+	}
+	if c.PreviousStatus.Valid {
+		previous := dto.StudentStatus(c.PreviousStatus.String)
+		ans.PreviousStatus = &previous
+	}
+	if c.Reason.Valid {
+		ans.Reason = &c.Reason.String
+	}
+	if c.ChangedBy.Valid {
+		changedBy := uint64(c.ChangedBy.Int64)
+		ans.ChangedBy = &changedBy
+	}
+	return ans
+}
+
+const guardianFields = "g.id,g.student,g.name,g.relationship,g.phone,g.email,g.address,g.is_primary,g.user_account,g.linked_at,g.created_at,g.updated_at"
+
+func queryGuardians(ctx context.Context, query string, args ...any) (ans []*models.StudentGuardian, err error) {
+	rows, err := db.Query(ctx, query, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var g *models.StudentGuardian
+		if g, err = scanGuardian(rows); err != nil {
+			return
+		}
+		ans = append(ans, g)
+	}
+	err = rows.Err()
+	return
+}
+
+func scanGuardian(row rowScanner) (*models.StudentGuardian, error) {
+	g := new(models.StudentGuardian)
+	if err := row.Scan(&g.Id, &g.Student, &g.Name, &g.Relationship, &g.Phone, &g.Email, &g.Address, &g.IsPrimary, &g.Account, &g.LinkedAt, &g.CreatedAt, &g.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+func guardiansToDto(guardians ...*models.StudentGuardian) (ans []dto.StudentGuardian) {
+	ans = make([]dto.StudentGuardian, 0, len(guardians))
+	for _, g := range guardians {
+		v := dto.StudentGuardian{
+			Id:           g.Id,
+			Student:      g.Student,
+			Name:         g.Name,
+			Relationship: dto.GuardianRelationship(g.Relationship),
+			IsPrimary:    g.IsPrimary,
+			CreatedAt:    g.CreatedAt,
+			UpdatedAt:    g.UpdatedAt,
+		}
+		if g.Phone.Valid {
+			v.Phone = &g.Phone.String
+		}
+		if g.Email.Valid {
+			v.Email = &g.Email.String
+		}
+		if g.Address.Valid {
+			v.Address = &g.Address.String
+		}
+		if g.Account.Valid {
+			account := uint64(g.Account.Int64)
+			v.Account = &account
+		}
+		if g.LinkedAt.Valid {
+			v.LinkedAt = &g.LinkedAt.Time
+		}
+		ans = append(ans, v)
+	}
+	return
+}
+
+const medicalNoteFields = "n.id,n.student,n.category,n.note,n.recorded_by,n.recorded_at"
+
+func scanMedicalNote(row rowScanner) (*models.StudentMedicalNote, error) {
+	n := new(models.StudentMedicalNote)
+	if err := row.Scan(&n.Id, &n.Student, &n.Category, &n.Note, &n.RecordedBy, &n.RecordedAt); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+func medicalNotesToDto(notes ...*models.StudentMedicalNote) (ans []dto.StudentMedicalNote) {
+	ans = make([]dto.StudentMedicalNote, 0, len(notes))
+	for _, n := range notes {
+		ans = append(ans, dto.StudentMedicalNote{
+			Id:         n.Id,
+			Student:    n.Student,
+			Category:   dto.MedicalNoteCategory(n.Category),
+			Note:       n.Note,
+			RecordedBy: n.RecordedBy,
+			RecordedAt: n.RecordedAt,
+		})
+	}
+	return
+}
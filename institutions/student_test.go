@@ -0,0 +1,251 @@
+package institutions_test
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"encore.dev/beta/errs"
+	"encore.dev/et"
+	"github.com/brinestone/scholaris/core/notifier"
+	"github.com/brinestone/scholaris/core/permissions"
+	"github.com/brinestone/scholaris/core/users"
+	"github.com/brinestone/scholaris/dto"
+	"github.com/brinestone/scholaris/institutions"
+	"github.com/brinestone/scholaris/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStudents(t *testing.T) {
+	i, err := makeInstitution()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	a, err := institutions.CreateStudent(mainContext, i.Id, dto.NewStudentRequest{FirstName: "Jane", LastName: "Doe"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	b, err := institutions.CreateStudent(mainContext, i.Id, dto.NewStudentRequest{FirstName: "John", LastName: "Doe"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.NotEqual(t, a.Matricule, b.Matricule)
+	assert.True(t, strings.HasSuffix(a.Matricule, "-00001"))
+	assert.Equal(t, dto.SSActive, a.Status)
+
+	found, err := institutions.FindStudents(mainContext, i.Id, dto.FindStudentsRequest{Search: "jo"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.Len(t, found.Students, 1)
+
+	phone := "+237600000000"
+	if _, err = institutions.AddStudentGuardian(mainContext, i.Id, a.Id, dto.NewStudentGuardianRequest{Name: "Mary Doe", Relationship: dto.GRMother, Phone: &phone, IsPrimary: true}); err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err = institutions.AddStudentGuardian(mainContext, i.Id, a.Id, dto.NewStudentGuardianRequest{Name: "Paul Doe", Relationship: dto.GRFather, Phone: &phone, IsPrimary: true}); err != nil {
+		t.Error(err)
+		return
+	}
+
+	guardians, err := institutions.FindStudentGuardians(mainContext, i.Id, a.Id)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.Len(t, guardians.Guardians, 2)
+	assert.Equal(t, "Paul Doe", guardians.Guardians[0].Name, "the latest primary guardian comes first")
+	assert.False(t, guardians.Guardians[1].IsPrimary)
+
+	email := "mary.doe@example.com"
+	invitation, err := institutions.InviteStudentGuardian(mainContext, i.Id, a.Id, guardians.Guardians[1].Id, dto.NewGuardianInvitationRequest{Email: &email})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.Equal(t, email, invitation.Email)
+	assert.Equal(t, a.Id, invitation.Student)
+
+	if err = institutions.RevokeGuardianInvitation(mainContext, i.Id, a.Id, guardians.Guardians[1].Id); err != nil {
+		t.Error(err)
+		return
+	}
+	_, err = institutions.FindGuardianInvitation(mainContext, i.Id, a.Id, guardians.Guardians[1].Id)
+	assert.NotNil(t, err)
+
+	if _, err = institutions.AddStudentMedicalNote(mainContext, i.Id, a.Id, dto.NewStudentMedicalNoteRequest{Category: dto.MNCAllergy, Note: "Peanuts"}); err != nil {
+		t.Error(err)
+		return
+	}
+
+	reason := "Moved abroad"
+	if _, err = institutions.ChangeStudentStatus(mainContext, i.Id, a.Id, dto.StudentStatusRequest{Status: dto.SSWithdrawn, Reason: &reason}); err != nil {
+		t.Error(err)
+		return
+	}
+
+	_, err = institutions.ChangeStudentStatus(mainContext, i.Id, a.Id, dto.StudentStatusRequest{Status: dto.SSWithdrawn})
+	assert.NotNil(t, err)
+
+	history, err := institutions.FindStudentStatusHistory(mainContext, i.Id, a.Id)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.Len(t, history.Changes, 2)
+	assert.Equal(t, dto.SSWithdrawn, history.Changes[0].Status)
+	assert.Equal(t, dto.SSActive, *history.Changes[0].PreviousStatus)
+}
+
+func TestAcceptedEnrollmentOfLinkedAccount(t *testing.T) {
+	t.Cleanup(mockEndpoints)
+	et.MockEndpoint(users.FindUserById, func(ctx context.Context, id uint64) (*models.User, error) {
+		return &models.User{Id: id}, nil
+	})
+
+	i, err := makeInstitution()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	level, err := institutions.CreateLevel(mainContext, i.Id, dto.NewLevelRequest{Name: "Form 1"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	account := uint64(1)
+	student, err := institutions.CreateStudent(mainContext, i.Id, dto.NewStudentRequest{FirstName: "Jane", LastName: "Doe", Account: &account})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	enrollment, err := institutions.AddLevelEnrollment(context.TODO(), i.Id, level.Id, dto.ESAccepted, time.Now())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if err = institutions.CreateEnrollmentStudent(context.TODO(), i.Id, enrollment); err != nil {
+		t.Error(err)
+		return
+	}
+
+	found, err := institutions.FindStudents(mainContext, i.Id, dto.FindStudentsRequest{})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if assert.Len(t, found.Students, 1, "the linked record is reused") {
+		assert.Equal(t, student.Id, found.Students[0].Id)
+		assert.Equal(t, enrollment, *found.Students[0].Enrollment)
+	}
+}
+
+func TestBackfillStudents(t *testing.T) {
+	t.Cleanup(mockEndpoints)
+	first := "Legacy"
+	et.MockEndpoint(users.FindUserById, func(ctx context.Context, id uint64) (*models.User, error) {
+		return &models.User{Id: id, ProvidedAccounts: []models.UserAccount{{FirstName: &first}}}, nil
+	})
+
+	i, err := makeInstitution()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	linked := uint64(7001)
+	if _, err = institutions.CreateStudent(mainContext, i.Id, dto.NewStudentRequest{FirstName: "Jane", LastName: "Doe", Account: &linked}); err != nil {
+		t.Error(err)
+		return
+	}
+
+	et.MockEndpoint(permissions.ListUsersInternal, func(ctx context.Context, req dto.ListUsersRequest) (*dto.ListUsersResponse, error) {
+		return &dto.ListUsersResponse{Users: []uint64{linked, 7002}}, nil
+	})
+	if err = institutions.AwaitStudentBackfill(context.TODO(), i.Id); err != nil {
+		t.Error(err)
+		return
+	}
+
+	for range 2 {
+		if err = institutions.BackfillStudents(context.TODO()); err != nil {
+			t.Error(err)
+			return
+		}
+		if err = institutions.AwaitStudentBackfill(context.TODO(), i.Id); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	found, err := institutions.FindStudents(mainContext, i.Id, dto.FindStudentsRequest{})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.Len(t, found.Students, 2, "accounts are backfilled once")
+
+	backfilled, err := institutions.FindStudents(mainContext, i.Id, dto.FindStudentsRequest{Search: first})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if assert.Len(t, backfilled.Students, 1) {
+		assert.Equal(t, uint64(7002), *backfilled.Students[0].Account)
+	}
+}
+
+func TestAcceptGuardianInvitationRequiresVerifiedEmail(t *testing.T) {
+	t.Cleanup(mockEndpoints)
+	email := "guardian@example.com"
+	verified := false
+	var token string
+	et.MockEndpoint(notifier.SendEmail, func(ctx context.Context, req dto.SendEmailRequest) error {
+		token = regexp.MustCompile(`token=([^"]+)`).FindStringSubmatch(req.Body)[1]
+		return nil
+	})
+	et.MockEndpoint(users.FindUserById, func(ctx context.Context, id uint64) (*models.User, error) {
+		return &models.User{Id: id, Emails: []models.UserEmailAddress{{Email: email, IsPrimary: true, Verified: verified}}}, nil
+	})
+
+	i, err := makeInstitution()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	student, err := institutions.CreateStudent(mainContext, i.Id, dto.NewStudentRequest{FirstName: "Jane", LastName: "Doe"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	guardian, err := institutions.AddStudentGuardian(mainContext, i.Id, student.Id, dto.NewStudentGuardianRequest{Name: "Mary Doe", Relationship: dto.GRMother})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err = institutions.InviteStudentGuardian(mainContext, i.Id, student.Id, guardian.Id, dto.NewGuardianInvitationRequest{Email: &email}); err != nil {
+		t.Error(err)
+		return
+	}
+
+	_, err = institutions.AcceptGuardianInvitation(mainContext, dto.AcceptGuardianInvitationRequest{Token: token})
+	assert.Equal(t, errs.PermissionDenied, errs.Code(err))
+
+	verified = true
+	linked, err := institutions.AcceptGuardianInvitation(mainContext, dto.AcceptGuardianInvitationRequest{Token: token})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.NotNil(t, linked.Account)
+}
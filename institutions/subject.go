@@ -0,0 +1,391 @@
+package institutions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"encore.dev/beta/errs"
+	"encore.dev/rlog"
+	"encore.dev/storage/sqldb"
+	"github.com/brinestone/scholaris/dto"
+	"github.com/brinestone/scholaris/models"
+	"github.com/brinestone/scholaris/util"
+)
+
+// Creates a grading scale which levels of the institution can be graded on
+//
+//encore:api auth method=POST path=/institutions/:id/grading-scales tag:can_update_institution tag:institution_writable
+func CreateGradingScale(ctx context.Context, id uint64, req dto.NewGradingScaleRequest) (ans *dto.GradingScale, err error) {
+	decimals := dto.DefaultGradingScale.Decimals
+	if req.Decimals != nil {
+		decimals = *req.Decimals
+	}
+
+	query := fmt.Sprintf(`
+		INSERT INTO grading_scales(institution, name, min_score, max_score, passing_score, decimals)
+		SELECT $1,$2,$3,$4,$5,$6
+		WHERE NOT EXISTS(SELECT 1 FROM grading_scales WHERE institution = $1 AND LOWER(name) = LOWER($2))
+		RETURNING %s;
+	`, gradingScaleFields)
+	scale, err := scanGradingScale(db.QueryRow(ctx, query, id, req.Name, req.MinScore, req.MaxScore, req.PassingScore, decimals))
+	if errors.Is(err, sqldb.ErrNoRows) {
+		err = &errs.Error{
+			Code:    errs.AlreadyExists,
+			Message: fmt.Sprintf("A grading scale named %q already exists", req.Name),
+		}
+		return
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = &gradingScalesToDto(scale)[0]
+	return
+}
+
+// Lists the grading scales of an institution, starting with the default one
+//
+//encore:api auth method=GET path=/institutions/:id/grading-scales tag:institution_member
+func FindGradingScales(ctx context.Context, id uint64) (ans *dto.GradingScalesResponse, err error) {
+	query := fmt.Sprintf("SELECT %s FROM grading_scales WHERE institution = $1 ORDER BY name;", gradingScaleFields)
+	scales, err := queryGradingScales(ctx, query, id)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = &dto.GradingScalesResponse{
+		Scales: append([]dto.GradingScale{dto.DefaultGradingScale}, gradingScalesToDto(scales...)...),
+	}
+	return
+}
+
+// Deletes a grading scale which no level is graded on
+//
+//encore:api auth method=DELETE path=/institutions/:id/grading-scales/:scale tag:can_update_institution tag:institution_writable
+func DeleteGradingScale(ctx context.Context, id, scale uint64) error {
+	var exists, inUse bool
+	if err := db.QueryRow(ctx, `
+		SELECT
+			EXISTS(SELECT 1 FROM grading_scales WHERE id = $1 AND institution = $2),
+			EXISTS(SELECT 1 FROM levels WHERE grading_scale = $1);
+	`, scale, id).Scan(&exists, &inUse); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return &util.ErrUnknown
+	}
+
+	if !exists {
+		return &util.ErrNotFound
+	}
+	if inUse {
+		return &errs.Error{
+			Code:    errs.FailedPrecondition,
+			Message: "Grading scales used by levels cannot be deleted",
+		}
+	}
+
+	if _, err := db.Exec(ctx, "DELETE FROM grading_scales WHERE id = $1;", scale); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return &util.ErrUnknown
+	}
+	return nil
+}
+
+// Creates a subject taught in a level
+//
+//encore:api auth method=POST path=/institutions/:id/levels/:level/subjects tag:can_update_institution tag:institution_writable
+func CreateSubject(ctx context.Context, id, level uint64, req dto.NewSubjectRequest) (ans *dto.Subject, err error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err = findLevelForUpdate(ctx, tx, id, level); errors.Is(err, sqldb.ErrNoRows) {
+		err = &util.ErrNotFound
+		return
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if err = assertSubjectName(ctx, tx, 0, level, req.Name); err != nil {
+		return
+	}
+
+	coefficient := 1.0
+	if req.Coefficient != nil {
+		coefficient = *req.Coefficient
+	}
+
+	var weeklyPeriods uint
+	if req.WeeklyPeriods != nil {
+		weeklyPeriods = *req.WeeklyPeriods
+	}
+
+	query := fmt.Sprintf(`
+		INSERT INTO subjects AS s(institution, level, name, code, coefficient, weekly_periods)
+		VALUES ($1,$2,$3,$4,$5,$6)
+		RETURNING %s;
+	`, subjectFields)
+	subject, err := scanSubject(tx.QueryRow(ctx, query, id, level, req.Name, req.Code, coefficient, weeklyPeriods))
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = &subjectsToDto(subject)[0]
+	return
+}
+
+// Lists the subjects taught in a level
+//
+//encore:api auth method=GET path=/institutions/:id/levels/:level/subjects tag:institution_member
+func FindSubjects(ctx context.Context, id, level uint64) (ans *dto.SubjectsResponse, err error) {
+	query := fmt.Sprintf("SELECT %s FROM subjects s WHERE s.level = $1 AND s.institution = $2 ORDER BY s.name;", subjectFields)
+	subjects, err := querySubjects(ctx, query, level, id)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = &dto.SubjectsResponse{
+		Subjects: subjectsToDto(subjects...),
+	}
+	return
+}
+
+// Updates a subject. Changing the coefficient affects the averages of every class the subject is taught in.
+//
+//encore:api auth method=PATCH path=/institutions/:id/levels/:level/subjects/:subject tag:can_update_institution tag:institution_writable
+func UpdateSubject(ctx context.Context, id, level, subject uint64, req dto.UpdateSubjectRequest) (ans *dto.Subject, err error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+	defer tx.Rollback()
+
+	if req.Name != nil {
+		if err = assertSubjectName(ctx, tx, subject, level, *req.Name); err != nil {
+			return
+		}
+	}
+
+	query := fmt.Sprintf(`
+		UPDATE subjects s SET
+			name = COALESCE($4, name),
+			code = CASE WHEN $5::TEXT IS NULL THEN code ELSE NULLIF($5, '') END,
+			coefficient = COALESCE($6, coefficient),
+			weekly_periods = COALESCE($7, weekly_periods),
+			updated_at = CURRENT_TIMESTAMP
+		WHERE
+			s.id = $1 AND s.level = $2 AND s.institution = $3
+		RETURNING %s;
+	`, subjectFields)
+	updated, err := scanSubject(tx.QueryRow(ctx, query, subject, level, id, req.Name, req.Code, req.Coefficient, req.WeeklyPeriods))
+	if errors.Is(err, sqldb.ErrNoRows) {
+		err = &util.ErrNotFound
+		return
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = &subjectsToDto(updated)[0]
+	return
+}
+
+// Deletes a subject which is not taught in any class
+//
+//encore:api auth method=DELETE path=/institutions/:id/levels/:level/subjects/:subject tag:can_update_institution tag:institution_writable
+func DeleteSubject(ctx context.Context, id, level, subject uint64) error {
+	var exists, taught bool
+	if err := db.QueryRow(ctx, `
+		SELECT
+			EXISTS(SELECT 1 FROM subjects WHERE id = $1 AND level = $2 AND institution = $3),
+			EXISTS(SELECT 1 FROM courses WHERE subject = $1);
+	`, subject, level, id).Scan(&exists, &taught); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return &util.ErrUnknown
+	}
+
+	if !exists {
+		return &util.ErrNotFound
+	}
+	if taught {
+		return &errs.Error{
+			Code:    errs.FailedPrecondition,
+			Message: "Subjects taught in classes cannot be deleted",
+		}
+	}
+
+	if _, err := db.Exec(ctx, "DELETE FROM subjects WHERE id = $1;", subject); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return &util.ErrUnknown
+	}
+	return nil
+}
+
+// Private section
+
+// Ensures a grading scale belongs to the institution
+func assertGradingScale(ctx context.Context, tx *sqldb.Tx, institution, scale uint64) error {
+	var exists bool
+	if err := tx.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM grading_scales WHERE id = $1 AND institution = $2);", scale, institution).Scan(&exists); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return &util.ErrUnknown
+	}
+
+	if !exists {
+		return &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: "The grading scale does not exist",
+		}
+	}
+	return nil
+}
+
+func assertSubjectName(ctx context.Context, tx *sqldb.Tx, subject, level uint64, name string) error {
+	var taken bool
+	if err := tx.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM subjects WHERE id <> $1 AND level = $2 AND LOWER(name) = LOWER($3));", subject, level, name).Scan(&taken); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return &util.ErrUnknown
+	}
+
+	if taken {
+		return &errs.Error{
+			Code:    errs.AlreadyExists,
+			Message: fmt.Sprintf("A subject named %q already exists in this level", name),
+		}
+	}
+	return nil
+}
+
+// Finds the scale a level is graded on
+func findLevelGradingScale(ctx context.Context, level uint64) (dto.GradingScale, error) {
+	query := fmt.Sprintf("SELECT %s FROM grading_scales WHERE id = (SELECT grading_scale FROM levels WHERE id = $1);", gradingScaleFields)
+	scale, err := scanGradingScale(db.QueryRow(ctx, query, level))
+	if errors.Is(err, sqldb.ErrNoRows) {
+		return dto.DefaultGradingScale, nil
+	} else if err != nil {
+		return dto.GradingScale{}, err
+	}
+	return gradingScalesToDto(scale)[0], nil
+}
+
+const gradingScaleFields = "id,institution,name,min_score,max_score,passing_score,decimals,created_at,updated_at"
+
+func queryGradingScales(ctx context.Context, query string, args ...any) (ans []*models.GradingScale, err error) {
+	rows, err := db.Query(ctx, query, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var g *models.GradingScale
+		if g, err = scanGradingScale(rows); err != nil {
+			return
+		}
+		ans = append(ans, g)
+	}
+	err = rows.Err()
+	return
+}
+
+func scanGradingScale(row rowScanner) (*models.GradingScale, error) {
+	g := new(models.GradingScale)
+	if err := row.Scan(&g.Id, &g.Institution, &g.Name, &g.MinScore, &g.MaxScore, &g.PassingScore, &g.Decimals, &g.CreatedAt, &g.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+func gradingScalesToDto(scales ...*models.GradingScale) (ans []dto.GradingScale) {
+	ans = make([]dto.GradingScale, 0, len(scales))
+	for _, g := range scales {
+		ans = append(ans, dto.GradingScale{
+			Id:           &g.Id,
+			Name:         g.Name,
+			MinScore:     g.MinScore,
+			MaxScore:     g.MaxScore,
+			PassingScore: g.PassingScore,
+			Decimals:     g.Decimals,
+			CreatedAt:    &g.CreatedAt,
+			UpdatedAt:    &g.UpdatedAt,
+		})
+	}
+	return
+}
+
+const subjectFields = "s.id,s.institution,s.level,s.name,s.code,s.coefficient,s.weekly_periods,s.created_at,s.updated_at"
+
+func querySubjects(ctx context.Context, query string, args ...any) (ans []*models.Subject, err error) {
+	rows, err := db.Query(ctx, query, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var s *models.Subject
+		if s, err = scanSubject(rows); err != nil {
+			return
+		}
+		ans = append(ans, s)
+	}
+	err = rows.Err()
+	return
+}
+
+func scanSubject(row rowScanner) (*models.Subject, error) {
+	s := new(models.Subject)
+	if err := row.Scan(&s.Id, &s.Institution, &s.Level, &s.Name, &s.Code, &s.Coefficient, &s.WeeklyPeriods, &s.CreatedAt, &s.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func subjectsToDto(subjects ...*models.Subject) (ans []dto.Subject) {
+	ans = make([]dto.Subject, 0, len(subjects))
+	for _, s := range subjects {
+		v := dto.Subject{
+			Id:            s.Id,
+			Institution:   s.Institution,
+			Level:         s.Level,
+			Name:          s.Name,
+			Coefficient:   s.Coefficient,
+			WeeklyPeriods: s.WeeklyPeriods,
+			CreatedAt:     s.CreatedAt,
+			UpdatedAt:     s.UpdatedAt,
+		}
+		if s.Code.Valid {
+			v.Code = &s.Code.String
+		}
+		ans = append(ans, v)
+	}
+	return
+}
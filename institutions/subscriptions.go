@@ -2,11 +2,13 @@ package institutions
 
 import (
 	"context"
+	"time"
 
 	"encore.dev/pubsub"
 	"github.com/brinestone/scholaris/dto"
 	"github.com/brinestone/scholaris/forms"
 	"github.com/brinestone/scholaris/settings"
+	"github.com/brinestone/scholaris/tenants"
 )
 
 var _ = pubsub.NewSubscription(NewInstitutions, "create-default-institution-settings", pubsub.SubscriptionConfig[*InstitutionCreated]{
@@ -21,6 +23,30 @@ var _ = pubsub.NewSubscription(forms.DeletedForms, "update-enrollment-forms", pu
 	Handler: updateEnrollmentFormsOnFormDeleted,
 })
 
+var _ = pubsub.NewSubscription(tenants.DeletedTenants, "purge-tenant-institutions", pubsub.SubscriptionConfig[*tenants.TenantDeleted]{
+	Handler: purgeInstitutionsOnTenantDeleted,
+})
+
+var _ = pubsub.NewSubscription(tenants.RetriedDeletionSteps, "retry-purge-tenant-institutions", pubsub.SubscriptionConfig[*tenants.TenantDeleted]{
+	Handler: purgeInstitutionsOnTenantDeleted,
+})
+
+var _ = pubsub.NewSubscription(AcceptedEnrollments, "create-student-record-on-enrollment-accepted", pubsub.SubscriptionConfig[*EnrollmentAccepted]{
+	Handler: createEnrollmentStudent,
+})
+
+func purgeInstitutionsOnTenantDeleted(ctx context.Context, msg *tenants.TenantDeleted) error {
+	if !msg.Includes(tenants.DeletionStepInstitutions) {
+		return nil
+	}
+
+	ids, err := findTenantInstitutionIds(ctx, msg.Id)
+	if err == nil {
+		err = purgeInstitutions(ctx, ids...)
+	}
+	return msg.Acknowledge(ctx, tenants.DeletionStepInstitutions, err)
+}
+
 func updateEnrollmentFormsOnFormDeleted(ctx context.Context, msg forms.FormDeleted) (err error) {
 	if msg.OwnerType != string(dto.PTInstitution) {
 		return
@@ -37,7 +63,13 @@ func updateEnrollmentFormsOnFormDeleted(ctx context.Context, msg forms.FormDelet
 	return
 }
 
+// Schedules or cancels the automatic academic year creation of an institution when its related settings change.
+// Newly enabled creations run right away.
 func assertAutoAcademicYearCreationCronJobs(ctx context.Context, msg settings.SettingUpdatedEvent) error {
+	if msg.OwnerType != string(dto.PTInstitution) {
+		return nil
+	}
+
 	res, err := settings.FindSettingsInternal(ctx, dto.GetSettingsInternalRequest{
 		Owner:     msg.Owner,
 		OwnerType: msg.OwnerType,
@@ -47,15 +79,45 @@ func assertAutoAcademicYearCreationCronJobs(ctx context.Context, msg settings.Se
 		return err
 	}
 
+	relevant := false
 	for _, v := range res.Settings {
-		switch v.Key {
-		case dto.SKAcademicYearAutoCreation:
+		relevant = relevant || isAcademicYearCreationSetting(v.Key)
+	}
+	if !relevant {
+		return nil
+	}
 
-		}
+	enabled, err := scheduleAcademicYearCreation(ctx, msg.Owner)
+	if err != nil || !enabled {
+		return err
 	}
-	return nil
+
+	_, err = runAcademicYearCreation(ctx, msg.Owner)
+	return err
 }
 
 func createDefaultSettingsOnNewInstitution(ctx context.Context, msg *InstitutionCreated) error {
 	return defineInstitutionDefaultSettings(ctx, msg.Id)
 }
+
+var _ = pubsub.NewSubscription(VerificationChanges, "notify-maintainers-of-verification-change", pubsub.SubscriptionConfig[*InstitutionVerificationChanged]{
+	Handler: notifyMaintainersOnVerificationChanged,
+})
+
+func notifyMaintainersOnVerificationChanged(ctx context.Context, msg *InstitutionVerificationChanged) error {
+	return notifyMaintainersOfVerification(ctx, msg)
+}
+
+var _ = pubsub.NewSubscription(AcademicYearCreationFailures, "notify-maintainers-of-academic-year-creation-failure", pubsub.SubscriptionConfig[*AcademicYearCreationFailed]{
+	Handler: notifyMaintainersOfAcademicYearCreationFailure,
+})
+
+var _ = pubsub.NewSubscription(RequestedReportCardJobs, "generate-report-cards", pubsub.SubscriptionConfig[*ReportCardJobRequested]{
+	Handler:        generateReportCards,
+	AckDeadline:    30 * time.Minute,
+	MaxConcurrency: 2,
+})
+
+var _ = pubsub.NewSubscription(ReachedAbsenceThresholds, "notify-guardians-of-absences", pubsub.SubscriptionConfig[*AbsenceThresholdReached]{
+	Handler: notifyGuardiansOfAbsences,
+})
@@ -0,0 +1,430 @@
+package institutions
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+
+	"encore.dev/beta/errs"
+	"encore.dev/rlog"
+	"encore.dev/storage/sqldb"
+	"github.com/brinestone/scholaris/dto"
+	"github.com/brinestone/scholaris/helpers"
+	"github.com/brinestone/scholaris/models"
+	"github.com/brinestone/scholaris/util"
+	"github.com/lib/pq"
+)
+
+// Proposes the slots of classes from the weekly periods of their subjects. The slots of the other classes are kept as
+// they are and the proposal never double-books a teacher or a room. Applying the proposal replaces the slots of the
+// classes.
+//
+//encore:api auth method=POST path=/institutions/:id/timetables/:timetable/proposal tag:can_manage_timetables tag:institution_writable
+func ProposeTimetable(ctx context.Context, id, timetable uint64, req dto.ProposeTimetableRequest) (ans *dto.TimetableProposal, err error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+	defer tx.Rollback()
+
+	t, err := lockTimetable(ctx, tx, id, timetable)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		err = &util.ErrNotFound
+		return
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	s, err := loadTimetableScheduler(ctx, tx, t, req.Classes)
+	if err != nil {
+		return
+	}
+
+	ans = s.propose()
+	if !req.Apply {
+		return
+	}
+
+	if _, err = tx.Exec(ctx, "DELETE FROM timetable_slots WHERE timetable = $1 AND class = ANY($2);", timetable, pq.Array(s.classIds())); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		ans, err = nil, &util.ErrUnknown
+		return
+	}
+
+	for i, slot := range ans.Slots {
+		if err = tx.QueryRow(ctx, `
+			INSERT INTO timetable_slots(timetable, class, day, period, course, teacher, room)
+			VALUES ($1,$2,$3,$4,$5,$6,$7)
+			RETURNING id;
+		`, timetable, slot.Class, slot.Day, slot.Period, slot.Course, slot.Teacher, slot.Room).Scan(&ans.Slots[i].Id); err != nil {
+			rlog.Error(util.MsgDbAccessError, "err", err)
+			ans, err = nil, &util.ErrUnknown
+			return
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		ans, err = nil, &util.ErrUnknown
+		return
+	}
+
+	ans.Applied = true
+	return
+}
+
+// Private section
+
+type scheduledClass struct {
+	id       uint64
+	name     string
+	students uint
+	// The rooms which seat the class, the one it was mostly scheduled in first and then from the smallest
+	rooms []*models.Room
+}
+
+type scheduledLesson struct {
+	class       *scheduledClass
+	course      uint64
+	subject     uint64
+	subjectName string
+	periods     uint
+	teacher     sql.NullInt64
+}
+
+// A day and period of the week taken by a class, a teacher or a room
+type timetableCell struct {
+	owner  uint64
+	day    int
+	period int
+}
+
+type classRoom struct {
+	class, room uint64
+}
+
+// Places lessons greedily, the lessons of the busiest teachers first, in the free period which spreads the lessons of
+// a course and the load of a class the most evenly over the week.
+type timetableScheduler struct {
+	timetable *models.Timetable
+	periods   []*models.TimetablePeriod
+	classes   []*scheduledClass
+	lessons   []*scheduledLesson
+	hasRooms  bool
+
+	classBusy   map[timetableCell]bool
+	teacherBusy map[timetableCell]bool
+	roomBusy    map[timetableCell]bool
+}
+
+func loadTimetableScheduler(ctx context.Context, tx *sqldb.Tx, timetable *models.Timetable, classes []uint64) (*timetableScheduler, error) {
+	s := &timetableScheduler{
+		timetable:   timetable,
+		classBusy:   make(map[timetableCell]bool),
+		teacherBusy: make(map[timetableCell]bool),
+		roomBusy:    make(map[timetableCell]bool),
+	}
+
+	var err error
+	if s.periods, err = queryTimetablePeriods(ctx, tx, timetable.Id); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return nil, &util.ErrUnknown
+	}
+
+	var filter []int64
+	if len(classes) > 0 {
+		filter = helpers.SliceMap(classes, func(c uint64) int64 { return int64(c) })
+	}
+
+	rows, err := tx.Query(ctx, `
+		SELECT
+			c.id,
+			CONCAT_WS(' ', l.name, c.name),
+			(SELECT COUNT(*) FROM class_placements cp WHERE cp.class = c.id AND cp.removed_at IS NULL)
+		FROM
+			classes c
+			JOIN levels l ON l.id = c.level
+			JOIN academic_terms t ON t.year_id = c.academic_year
+		WHERE
+			c.institution = $1 AND t.id = $2 AND ($3::BIGINT[] IS NULL OR c.id = ANY($3))
+		ORDER BY
+			l.position, c.name;
+	`, timetable.Institution, timetable.AcademicTerm, pq.Array(filter))
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return nil, &util.ErrUnknown
+	}
+	defer rows.Close()
+
+	byId := make(map[uint64]*scheduledClass)
+	for rows.Next() {
+		c := new(scheduledClass)
+		if err = rows.Scan(&c.id, &c.name, &c.students); err != nil {
+			rlog.Error(util.MsgDbAccessError, "err", err)
+			return nil, &util.ErrUnknown
+		}
+		s.classes = append(s.classes, c)
+		byId[c.id] = c
+	}
+	if err = rows.Err(); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return nil, &util.ErrUnknown
+	}
+
+	if len(classes) > 0 && len(s.classes) != len(classes) {
+		return nil, &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: "Some classes are not part of the timetable's academic year",
+		}
+	}
+
+	if err = s.loadLessons(ctx, tx, byId); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return nil, &util.ErrUnknown
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM rooms r WHERE r.institution = $1 ORDER BY r.capacity NULLS LAST, r.name;", roomFields)
+	rooms, err := queryRooms(ctx, query, timetable.Institution)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return nil, &util.ErrUnknown
+	}
+	s.hasRooms = len(rooms) > 0
+
+	usage, err := s.loadOccupancy(ctx, tx, byId)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return nil, &util.ErrUnknown
+	}
+
+	for _, c := range s.classes {
+		for _, r := range rooms {
+			if !r.Capacity.Valid || uint(r.Capacity.Int32) >= c.students {
+				c.rooms = append(c.rooms, r)
+			}
+		}
+		// Classes keep the room they were mostly scheduled in
+		slices.SortStableFunc(c.rooms, func(a, b *models.Room) int {
+			return cmp.Compare(usage[classRoom{c.id, b.Id}], usage[classRoom{c.id, a.Id}])
+		})
+	}
+	return s, nil
+}
+
+func (s *timetableScheduler) loadLessons(ctx context.Context, tx *sqldb.Tx, classes map[uint64]*scheduledClass) error {
+	rows, err := tx.Query(ctx, `
+		SELECT
+			co.id, co.class, co.subject, sj.name, sj.weekly_periods, co.teacher
+		FROM
+			courses co
+			JOIN subjects sj ON sj.id = co.subject
+		WHERE
+			co.class = ANY($1) AND sj.weekly_periods > 0;
+	`, pq.Array(s.classIds()))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var class uint64
+		l := new(scheduledLesson)
+		if err = rows.Scan(&l.course, &class, &l.subject, &l.subjectName, &l.periods, &l.teacher); err != nil {
+			return err
+		}
+		l.class = classes[class]
+		s.lessons = append(s.lessons, l)
+	}
+	return rows.Err()
+}
+
+// Books the periods taken by the slots of the other classes and counts how often each scheduled class was held in each
+// room, keyed by class and room.
+func (s *timetableScheduler) loadOccupancy(ctx context.Context, tx *sqldb.Tx, classes map[uint64]*scheduledClass) (map[classRoom]int, error) {
+	rows, err := tx.Query(ctx, "SELECT class, day, period, teacher, room FROM timetable_slots WHERE timetable = $1;", s.timetable.Id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	usage := make(map[classRoom]int)
+	for rows.Next() {
+		var class uint64
+		var day, period int
+		var teacher, room sql.NullInt64
+		if err = rows.Scan(&class, &day, &period, &teacher, &room); err != nil {
+			return nil, err
+		}
+
+		if _, scheduled := classes[class]; scheduled {
+			if room.Valid {
+				usage[classRoom{class, uint64(room.Int64)}]++
+			}
+			continue
+		}
+
+		if teacher.Valid {
+			s.teacherBusy[timetableCell{uint64(teacher.Int64), day, period}] = true
+		}
+		if room.Valid {
+			s.roomBusy[timetableCell{uint64(room.Int64), day, period}] = true
+		}
+	}
+	return usage, rows.Err()
+}
+
+func (s *timetableScheduler) classIds() []int64 {
+	ans := make([]int64, 0, len(s.classes))
+	for _, c := range s.classes {
+		ans = append(ans, int64(c.id))
+	}
+	return ans
+}
+
+func (s *timetableScheduler) propose() *dto.TimetableProposal {
+	ans := &dto.TimetableProposal{
+		Slots:       make([]dto.TimetableSlot, 0),
+		Unscheduled: make([]dto.UnscheduledLesson, 0),
+	}
+
+	// The teachers with the most periods to teach have the fewest options
+	demand := make(map[int64]uint)
+	for _, l := range s.lessons {
+		if l.teacher.Valid {
+			demand[l.teacher.Int64] += l.periods
+		}
+	}
+	slices.SortFunc(s.lessons, func(a, b *scheduledLesson) int {
+		return cmp.Or(
+			cmp.Compare(demand[b.teacher.Int64], demand[a.teacher.Int64]),
+			cmp.Compare(b.periods, a.periods),
+			cmp.Compare(a.course, b.course),
+		)
+	})
+
+	courseLoad := make(map[timetableCell]int)
+	classLoad := make(map[timetableCell]int)
+	for _, l := range s.lessons {
+		placed := uint(0)
+		for ; placed < l.periods; placed++ {
+			best, bestScore, room := timetableCell{}, -1, (*models.Room)(nil)
+			for _, d := range s.timetable.Days {
+				day := int(d)
+				for i, p := range s.periods {
+					r, ok := s.available(l, day, p.Number)
+					if !ok {
+						continue
+					}
+
+					score := 100*courseLoad[timetableCell{l.course, day, 0}] + 10*classLoad[timetableCell{l.class.id, day, 0}] + i
+					if bestScore < 0 || score < bestScore {
+						best, bestScore, room = timetableCell{day: day, period: p.Number}, score, r
+					}
+				}
+			}
+			if bestScore < 0 {
+				break
+			}
+
+			s.classBusy[timetableCell{l.class.id, best.day, best.period}] = true
+			if l.teacher.Valid {
+				s.teacherBusy[timetableCell{uint64(l.teacher.Int64), best.day, best.period}] = true
+			}
+			courseLoad[timetableCell{l.course, best.day, 0}]++
+			classLoad[timetableCell{l.class.id, best.day, 0}]++
+
+			slot := dto.TimetableSlot{
+				Timetable:   s.timetable.Id,
+				Class:       l.class.id,
+				ClassName:   l.class.name,
+				Day:         best.day,
+				Period:      best.period,
+				Course:      l.course,
+				Subject:     l.subject,
+				SubjectName: l.subjectName,
+				StartsAt:    s.periods[best.period-1].StartsAt,
+				EndsAt:      s.periods[best.period-1].EndsAt,
+			}
+			if l.teacher.Valid {
+				teacher := uint64(l.teacher.Int64)
+				slot.Teacher = &teacher
+			}
+			if room != nil {
+				s.roomBusy[timetableCell{room.Id, best.day, best.period}] = true
+				slot.Room, slot.RoomName = &room.Id, &room.Name
+			}
+			ans.Slots = append(ans.Slots, slot)
+		}
+
+		if placed < l.periods {
+			ans.Unscheduled = append(ans.Unscheduled, dto.UnscheduledLesson{
+				Class:       l.class.id,
+				Course:      l.course,
+				SubjectName: l.subjectName,
+				Periods:     l.periods - placed,
+				Reason:      s.unscheduledReason(l),
+			})
+		}
+	}
+
+	slices.SortFunc(ans.Slots, func(a, b dto.TimetableSlot) int {
+		return cmp.Or(cmp.Compare(a.Day, b.Day), cmp.Compare(a.Period, b.Period), cmp.Compare(a.ClassName, b.ClassName))
+	})
+	return ans
+}
+
+// Tells whether a lesson can be held during a period, along with the room it would be held in when the institution
+// has rooms
+func (s *timetableScheduler) available(l *scheduledLesson, day, period int) (*models.Room, bool) {
+	if s.classBusy[timetableCell{l.class.id, day, period}] {
+		return nil, false
+	}
+	if l.teacher.Valid && s.teacherBusy[timetableCell{uint64(l.teacher.Int64), day, period}] {
+		return nil, false
+	}
+	if !s.hasRooms {
+		return nil, true
+	}
+
+	for _, r := range l.class.rooms {
+		if !s.roomBusy[timetableCell{r.Id, day, period}] {
+			return r, true
+		}
+	}
+	return nil, false
+}
+
+func (s *timetableScheduler) unscheduledReason(l *scheduledLesson) string {
+	if s.hasRooms && len(l.class.rooms) == 0 {
+		return "No room seats the class"
+	}
+
+	classFree, teacherFree := false, false
+	for _, d := range s.timetable.Days {
+		for _, p := range s.periods {
+			if s.classBusy[timetableCell{l.class.id, int(d), p.Number}] {
+				continue
+			}
+			classFree = true
+			if !l.teacher.Valid || !s.teacherBusy[timetableCell{uint64(l.teacher.Int64), int(d), p.Number}] {
+				teacherFree = true
+			}
+		}
+	}
+
+	switch {
+	case !classFree:
+		return "The class has no free period left"
+	case !teacherFree:
+		return "The teacher has no free period left when the class is free"
+	default:
+		return "No room is free when the class and the teacher are"
+	}
+}
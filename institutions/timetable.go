@@ -0,0 +1,883 @@
+package institutions
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"encore.dev"
+	"encore.dev/beta/auth"
+	"encore.dev/beta/errs"
+	"encore.dev/rlog"
+	"encore.dev/storage/sqldb"
+	"github.com/brinestone/scholaris/core/permissions"
+	"github.com/brinestone/scholaris/dto"
+	"github.com/brinestone/scholaris/models"
+	"github.com/brinestone/scholaris/util"
+	"github.com/lib/pq"
+)
+
+// Creates the weekly timetable of a term. A term has a single timetable.
+//
+//encore:api auth method=POST path=/institutions/:id/timetables tag:can_manage_timetables tag:institution_writable
+func CreateTimetable(ctx context.Context, id uint64, req dto.NewTimetableRequest) (ans *dto.Timetable, err error) {
+	uid, _ := auth.UserID()
+	createdBy, _ := strconv.ParseUint(string(uid), 10, 64)
+
+	days := req.Days
+	if len(days) == 0 {
+		days = dto.DefaultTimetableDays
+	}
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	if err = tx.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM academic_terms WHERE id = $1 AND institution = $2);", req.AcademicTerm, id).Scan(&exists); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if !exists {
+		err = &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: "The academic term does not exist",
+		}
+		return
+	}
+
+	query := fmt.Sprintf(`
+		INSERT INTO timetables AS t(institution, academic_term, days, created_by)
+		VALUES ($1,$2,$3,$4)
+		ON CONFLICT (academic_term) DO NOTHING
+		RETURNING %s;
+	`, timetableFields)
+	timetable, err := scanTimetable(tx.QueryRow(ctx, query, id, req.AcademicTerm, pq.Array(days), createdBy))
+	if errors.Is(err, sqldb.ErrNoRows) {
+		err = &errs.Error{
+			Code:    errs.AlreadyExists,
+			Message: "The academic term already has a timetable",
+		}
+		return
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if err = replaceTimetablePeriods(ctx, tx, timetable.Id, req.Periods); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	periods, err := queryTimetablePeriods(ctx, tx, timetable.Id)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = timetableToDto(timetable, periods)
+	return
+}
+
+// Lists the timetables of an institution, the latest term first
+//
+//encore:api auth method=GET path=/institutions/:id/timetables tag:institution_member
+func FindTimetables(ctx context.Context, id uint64, req dto.FindTimetablesRequest) (ans *dto.TimetablesResponse, err error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM
+			timetables t
+		WHERE
+			t.institution = $1 AND ($2 = 0 OR t.academic_term = $2)
+		ORDER BY
+			t.academic_term DESC;
+	`, timetableFields)
+	rows, err := db.Query(ctx, query, id, req.AcademicTerm)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+	defer rows.Close()
+
+	timetables := make([]*models.Timetable, 0)
+	for rows.Next() {
+		var t *models.Timetable
+		if t, err = scanTimetable(rows); err != nil {
+			rlog.Error(util.MsgDbAccessError, "err", err)
+			err = &util.ErrUnknown
+			return
+		}
+		timetables = append(timetables, t)
+	}
+	if err = rows.Err(); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = &dto.TimetablesResponse{
+		Timetables: make([]dto.Timetable, 0, len(timetables)),
+	}
+	for _, t := range timetables {
+		var periods []*models.TimetablePeriod
+		if periods, err = queryTimetablePeriods(ctx, nil, t.Id); err != nil {
+			rlog.Error(util.MsgDbAccessError, "err", err)
+			ans, err = nil, &util.ErrUnknown
+			return
+		}
+		ans.Timetables = append(ans.Timetables, *timetableToDto(t, periods))
+	}
+	return
+}
+
+// Finds a timetable along with its periods
+//
+//encore:api auth method=GET path=/institutions/:id/timetables/:timetable tag:institution_member
+func FindTimetable(ctx context.Context, id, timetable uint64) (ans *dto.Timetable, err error) {
+	t, periods, err := findTimetableWithPeriods(ctx, nil, id, timetable)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		err = &util.ErrNotFound
+		return
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = timetableToDto(t, periods)
+	return
+}
+
+// Changes the days and periods of a timetable. The slots on the days and periods which are removed are deleted.
+//
+//encore:api auth method=PATCH path=/institutions/:id/timetables/:timetable tag:can_manage_timetables tag:institution_writable
+func UpdateTimetable(ctx context.Context, id, timetable uint64, req dto.UpdateTimetableRequest) (ans *dto.Timetable, err error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err = lockTimetable(ctx, tx, id, timetable); errors.Is(err, sqldb.ErrNoRows) {
+		err = &util.ErrNotFound
+		return
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if len(req.Days) > 0 {
+		if _, err = tx.Exec(ctx, "UPDATE timetables SET days = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2;", pq.Array(req.Days), timetable); err != nil {
+			rlog.Error(util.MsgDbAccessError, "err", err)
+			err = &util.ErrUnknown
+			return
+		}
+		if _, err = tx.Exec(ctx, "DELETE FROM timetable_slots WHERE timetable = $1 AND NOT (day = ANY($2));", timetable, pq.Array(req.Days)); err != nil {
+			rlog.Error(util.MsgDbAccessError, "err", err)
+			err = &util.ErrUnknown
+			return
+		}
+	}
+
+	if len(req.Periods) > 0 {
+		if err = replaceTimetablePeriods(ctx, tx, timetable, req.Periods); err != nil {
+			rlog.Error(util.MsgDbAccessError, "err", err)
+			err = &util.ErrUnknown
+			return
+		}
+		if _, err = tx.Exec(ctx, "UPDATE timetables SET updated_at = CURRENT_TIMESTAMP WHERE id = $1;", timetable); err != nil {
+			rlog.Error(util.MsgDbAccessError, "err", err)
+			err = &util.ErrUnknown
+			return
+		}
+	}
+
+	t, periods, err := findTimetableWithPeriods(ctx, tx, id, timetable)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = timetableToDto(t, periods)
+	return
+}
+
+// Deletes a timetable along with its slots
+//
+//encore:api auth method=DELETE path=/institutions/:id/timetables/:timetable tag:can_manage_timetables tag:institution_writable
+func DeleteTimetable(ctx context.Context, id, timetable uint64) error {
+	res, err := db.Exec(ctx, "DELETE FROM timetables WHERE id = $1 AND institution = $2;", timetable, id)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return &util.ErrUnknown
+	}
+
+	if res.RowsAffected() == 0 {
+		return &util.ErrNotFound
+	}
+	return nil
+}
+
+// Schedules a course of a class during a period of a day of the week. Teachers and rooms cannot be booked twice at the
+// same time.
+//
+//encore:api auth method=POST path=/institutions/:id/timetables/:timetable/slots tag:can_manage_timetables tag:institution_writable
+func CreateTimetableSlot(ctx context.Context, id, timetable uint64, req dto.NewTimetableSlotRequest) (ans *dto.TimetableSlot, err error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+	defer tx.Rollback()
+
+	t, err := lockTimetable(ctx, tx, id, timetable)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		err = &util.ErrNotFound
+		return
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	slot := &models.TimetableSlot{Timetable: timetable, Class: req.Class, Day: req.Day, Period: req.Period, Course: req.Course}
+	if req.Teacher != nil {
+		slot.Teacher = sql.NullInt64{Int64: int64(*req.Teacher), Valid: true}
+	}
+	if req.Room != nil {
+		slot.Room = sql.NullInt64{Int64: int64(*req.Room), Valid: true}
+	}
+
+	if err = assertTimetableSlot(ctx, tx, t, slot, req.Teacher == nil); err != nil {
+		return
+	}
+
+	var slotId uint64
+	if err = tx.QueryRow(ctx, `
+		INSERT INTO timetable_slots(timetable, class, day, period, course, teacher, room)
+		VALUES ($1,$2,$3,$4,$5,$6,$7)
+		RETURNING id;
+	`, timetable, slot.Class, slot.Day, slot.Period, slot.Course, slot.Teacher, slot.Room).Scan(&slotId); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if slot, err = findTimetableSlot(ctx, tx, timetable, slotId); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = &timetableSlotsToDto(slot)[0]
+	return
+}
+
+// Updates a slot of a timetable. Changing the course assigns its teacher unless a teacher is given.
+//
+//encore:api auth method=PATCH path=/institutions/:id/timetables/:timetable/slots/:slot tag:can_manage_timetables tag:institution_writable
+func UpdateTimetableSlot(ctx context.Context, id, timetable, slot uint64, req dto.UpdateTimetableSlotRequest) (ans *dto.TimetableSlot, err error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+	defer tx.Rollback()
+
+	t, err := lockTimetable(ctx, tx, id, timetable)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		err = &util.ErrNotFound
+		return
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	current, err := findTimetableSlot(ctx, tx, timetable, slot)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		err = &util.ErrNotFound
+		return
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if req.Day != nil {
+		current.Day = *req.Day
+	}
+	if req.Period != nil {
+		current.Period = *req.Period
+	}
+	if req.Course != nil {
+		current.Course = *req.Course
+	}
+	if req.Teacher != nil {
+		current.Teacher = sql.NullInt64{Int64: int64(*req.Teacher), Valid: *req.Teacher != 0}
+	}
+	if req.Room != nil {
+		current.Room = sql.NullInt64{Int64: int64(*req.Room), Valid: *req.Room != 0}
+	}
+
+	if err = assertTimetableSlot(ctx, tx, t, current, req.Course != nil && req.Teacher == nil); err != nil {
+		return
+	}
+
+	if _, err = tx.Exec(ctx, `
+		UPDATE timetable_slots SET
+			day = $2,
+			period = $3,
+			course = $4,
+			teacher = $5,
+			room = $6,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE
+			id = $1;
+	`, slot, current.Day, current.Period, current.Course, current.Teacher, current.Room); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	updated, err := findTimetableSlot(ctx, tx, timetable, slot)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = &timetableSlotsToDto(updated)[0]
+	return
+}
+
+// Removes a slot from a timetable
+//
+//encore:api auth method=DELETE path=/institutions/:id/timetables/:timetable/slots/:slot tag:can_manage_timetables tag:institution_writable
+func DeleteTimetableSlot(ctx context.Context, id, timetable, slot uint64) error {
+	res, err := db.Exec(ctx, `
+		DELETE FROM timetable_slots s
+		USING timetables t
+		WHERE
+			t.id = s.timetable AND s.id = $1 AND s.timetable = $2 AND t.institution = $3;
+	`, slot, timetable, id)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return &util.ErrUnknown
+	}
+
+	if res.RowsAffected() == 0 {
+		return &util.ErrNotFound
+	}
+	return nil
+}
+
+// Lists the weekly slots of a class
+//
+//encore:api auth method=GET path=/institutions/:id/timetables/:timetable/classes/:class tag:institution_member
+func FindClassTimetable(ctx context.Context, id, timetable, class uint64) (*dto.TimetableViewResponse, error) {
+	return timetableView(ctx, id, timetable, "s.class = $2", class)
+}
+
+// Lists the weekly slots of a teacher
+//
+//encore:api auth method=GET path=/institutions/:id/timetables/:timetable/teachers/:teacher tag:institution_member
+func FindTeacherTimetable(ctx context.Context, id, timetable, teacher uint64) (*dto.TimetableViewResponse, error) {
+	return timetableView(ctx, id, timetable, "s.teacher = $2", teacher)
+}
+
+// Lists the weekly slots held in a room
+//
+//encore:api auth method=GET path=/institutions/:id/timetables/:timetable/rooms/:room tag:institution_member
+func FindRoomTimetable(ctx context.Context, id, timetable, room uint64) (*dto.TimetableViewResponse, error) {
+	return timetableView(ctx, id, timetable, "s.room = $2", room)
+}
+
+// Exports the slots of a timetable as weekly iCalendar events recurring until the end of its term. The class, teacher
+// or room query parameters narrow the export down to one of their views.
+//
+//encore:api raw auth method=GET path=/institutions/:id/timetables/:timetable/ics
+func ExportTimetable(w http.ResponseWriter, req *http.Request) {
+	params := encore.CurrentRequest().PathParams
+	id, err := strconv.ParseUint(params.Get("id"), 10, 64)
+	if err != nil {
+		errs.HTTPError(w, &util.ErrNotFound)
+		return
+	}
+	timetable, err := strconv.ParseUint(params.Get("timetable"), 10, 64)
+	if err != nil {
+		errs.HTTPError(w, &util.ErrNotFound)
+		return
+	}
+
+	uid, _ := auth.UserID()
+	perm, err := permissions.CheckPermissionInternal(req.Context(), dto.InternalRelationCheckRequest{
+		Actor:    dto.IdentifierString(dto.PTUser, uid),
+		Relation: dto.PNMember,
+		Target:   dto.IdentifierString(dto.PTInstitution, id),
+	})
+	if err != nil {
+		rlog.Error(util.MsgCallError, "err", err)
+		errs.HTTPError(w, &util.ErrUnknown)
+		return
+	} else if !perm.Allowed {
+		errs.HTTPError(w, &util.ErrForbidden)
+		return
+	}
+
+	condition, filter := "TRUE", uint64(0)
+	for _, f := range []struct{ param, condition string }{{"class", "s.class = $2"}, {"teacher", "s.teacher = $2"}, {"room", "s.room = $2"}} {
+		if v := req.URL.Query().Get(f.param); len(v) > 0 {
+			if filter, err = strconv.ParseUint(v, 10, 64); err != nil {
+				errs.HTTPError(w, &errs.Error{
+					Code:    errs.InvalidArgument,
+					Message: fmt.Sprintf("Invalid value for the %s parameter", f.param),
+				})
+				return
+			}
+			condition = f.condition
+			break
+		}
+	}
+
+	var name string
+	var start, end time.Time
+	if err = db.QueryRow(req.Context(), `
+		SELECT
+			i.name || ' - ' || at.label, at.start_date, at.end_date
+		FROM
+			timetables t
+			JOIN institutions i ON i.id = t.institution
+			JOIN vw_AllAcademicTerms at ON at.id = t.academic_term
+		WHERE
+			t.id = $1 AND t.institution = $2;
+	`, timetable, id).Scan(&name, &start, &end); errors.Is(err, sqldb.ErrNoRows) {
+		errs.HTTPError(w, &util.ErrNotFound)
+		return
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		errs.HTTPError(w, &util.ErrUnknown)
+		return
+	}
+
+	slots, err := queryTimetableSlots(req.Context(), fmt.Sprintf("s.timetable = $1 AND (%s OR $2 = 0)", condition), timetable, filter)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		errs.HTTPError(w, &util.ErrUnknown)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="timetable-%d.ics"`, timetable))
+	writeTimetableICS(w, name, start, end, slots)
+}
+
+// Private section
+
+// Validates a slot against its timetable, class and course, then checks that its class, teacher and room are free
+// during its period. The teacher of the course is assigned when courseTeacher is set.
+func assertTimetableSlot(ctx context.Context, tx *sqldb.Tx, timetable *models.Timetable, slot *models.TimetableSlot, courseTeacher bool) error {
+	msgs := make([]string, 0)
+
+	covered := false
+	for _, d := range timetable.Days {
+		covered = covered || int(d) == slot.Day
+	}
+	if !covered {
+		msgs = append(msgs, "The timetable does not cover this day")
+	}
+
+	var periodExists, classInTerm, roomExists bool
+	if err := tx.QueryRow(ctx, `
+		SELECT
+			EXISTS(SELECT 1 FROM timetable_periods WHERE timetable = $1 AND number = $2),
+			EXISTS(SELECT 1 FROM classes c JOIN academic_terms t ON t.year_id = c.academic_year WHERE c.id = $3 AND c.institution = $4 AND t.id = $5),
+			$6::BIGINT IS NULL OR EXISTS(SELECT 1 FROM rooms WHERE id = $6 AND institution = $4);
+	`, timetable.Id, slot.Period, slot.Class, timetable.Institution, timetable.AcademicTerm, slot.Room).Scan(&periodExists, &classInTerm, &roomExists); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return &util.ErrUnknown
+	}
+
+	if !periodExists {
+		msgs = append(msgs, "The timetable has no such period")
+	}
+	if !classInTerm {
+		msgs = append(msgs, "The class is not part of the timetable's academic year")
+	}
+	if !roomExists {
+		msgs = append(msgs, "The room does not exist")
+	}
+
+	if classInTerm {
+		course, err := findCourse(ctx, tx, timetable.Institution, slot.Class, slot.Course)
+		if errors.Is(err, sqldb.ErrNoRows) {
+			msgs = append(msgs, "The course is not taught in the class")
+		} else if err != nil {
+			rlog.Error(util.MsgDbAccessError, "err", err)
+			return &util.ErrUnknown
+		} else if courseTeacher {
+			slot.Teacher = course.Teacher
+		}
+	}
+
+	if len(msgs) > 0 {
+		return &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: strings.Join(msgs, "\n"),
+		}
+	}
+
+	if slot.Teacher.Valid {
+		if err := assertInstitutionRole(ctx, timetable.Institution, uint64(slot.Teacher.Int64), dto.PNTeacher); err != nil {
+			return err
+		}
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE s.timetable = $1 AND s.id <> $2 AND s.day = $3 AND s.period = $4 AND (s.class = $5 OR s.teacher = $6 OR s.room = $7);", timetableSlotFields, timetableSlotSource)
+	rows, err := tx.Query(ctx, query, timetable.Id, slot.Id, slot.Day, slot.Period, slot.Class, slot.Teacher, slot.Room)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return &util.ErrUnknown
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var other *models.TimetableSlot
+		if other, err = scanTimetableSlot(rows); err != nil {
+			rlog.Error(util.MsgDbAccessError, "err", err)
+			return &util.ErrUnknown
+		}
+
+		if other.Class == slot.Class {
+			msgs = append(msgs, fmt.Sprintf("The class already has %s during this period", other.SubjectName))
+		}
+		if slot.Teacher.Valid && other.Teacher == slot.Teacher {
+			msgs = append(msgs, fmt.Sprintf("The teacher already teaches %s to %s during this period", other.SubjectName, other.ClassName))
+		}
+		if slot.Room.Valid && other.Room == slot.Room {
+			msgs = append(msgs, fmt.Sprintf("The room is already booked for %s during this period", other.ClassName))
+		}
+	}
+	if err = rows.Err(); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return &util.ErrUnknown
+	}
+
+	if len(msgs) > 0 {
+		return &errs.Error{
+			Code:    errs.AlreadyExists,
+			Message: strings.Join(msgs, "\n"),
+		}
+	}
+	return nil
+}
+
+func timetableView(ctx context.Context, institution, timetable uint64, condition string, filter uint64) (ans *dto.TimetableViewResponse, err error) {
+	t, periods, err := findTimetableWithPeriods(ctx, nil, institution, timetable)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		err = &util.ErrNotFound
+		return
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	slots, err := queryTimetableSlots(ctx, "s.timetable = $1 AND "+condition, timetable, filter)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = &dto.TimetableViewResponse{
+		Timetable: *timetableToDto(t, periods),
+		Slots:     timetableSlotsToDto(slots...),
+	}
+	return
+}
+
+// Replaces the periods of a timetable, numbering them in order. The slots of the periods beyond the new ones are deleted.
+func replaceTimetablePeriods(ctx context.Context, tx *sqldb.Tx, timetable uint64, periods []dto.TimetablePeriodEntry) error {
+	if _, err := tx.Exec(ctx, "DELETE FROM timetable_periods WHERE timetable = $1 AND number > $2;", timetable, len(periods)); err != nil {
+		return err
+	}
+
+	for i, p := range periods {
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO timetable_periods(timetable, number, label, starts_at, ends_at)
+			VALUES ($1,$2,$3,$4::TIME,$5::TIME)
+			ON CONFLICT (timetable, number) DO UPDATE SET
+				label = EXCLUDED.label,
+				starts_at = EXCLUDED.starts_at,
+				ends_at = EXCLUDED.ends_at;
+		`, timetable, i+1, p.Label, p.StartsAt, p.EndsAt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Writes the slots of a timetable as weekly iCalendar (RFC 5545) events. Times are floating, as periods are local to
+// the institution.
+func writeTimetableICS(w io.Writer, name string, start, end time.Time, slots []*models.TimetableSlot) {
+	const floating = "20060102T150405"
+	host := encore.Meta().APIBaseURL.Hostname()
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//Scholaris//Timetable//EN",
+		"CALSCALE:GREGORIAN",
+		"METHOD:PUBLISH",
+		"X-WR-CALNAME:" + icsText(name),
+	}
+
+	first := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
+	until := time.Date(end.Year(), end.Month(), end.Day(), 23, 59, 59, 0, time.UTC)
+	for _, s := range slots {
+		// The first occurrence is on the slot's day of the first week of the term
+		day := first.AddDate(0, 0, (s.Day-isoWeekday(first)+7)%7)
+		startsAt, _ := time.Parse("15:04", s.StartsAt)
+		endsAt, _ := time.Parse("15:04", s.EndsAt)
+
+		summary := fmt.Sprintf("%s - %s", s.SubjectName, s.ClassName)
+		lines = append(lines,
+			"BEGIN:VEVENT",
+			fmt.Sprintf("UID:timetable-slot-%d@%s", s.Id, host),
+			"DTSTAMP:"+icsTime(s.UpdatedAt),
+			"SUMMARY:"+icsText(summary),
+			"DTSTART:"+day.Add(startsAt.Sub(startsAt.Truncate(24*time.Hour))).Format(floating),
+			"DTEND:"+day.Add(endsAt.Sub(endsAt.Truncate(24*time.Hour))).Format(floating),
+			"RRULE:FREQ=WEEKLY;UNTIL="+until.Format(floating),
+		)
+		if s.RoomName.Valid {
+			lines = append(lines, "LOCATION:"+icsText(s.RoomName.String))
+		}
+		lines = append(lines, "END:VEVENT")
+	}
+	lines = append(lines, "END:VCALENDAR")
+
+	for _, line := range lines {
+		io.WriteString(w, foldICSLine(line))
+	}
+}
+
+// The ISO day of the week of a date, 1 being Monday
+func isoWeekday(t time.Time) int {
+	if t.Weekday() == time.Sunday {
+		return 7
+	}
+	return int(t.Weekday())
+}
+
+const timetableFields = "t.id,t.institution,t.academic_term,t.days,t.created_by,t.created_at,t.updated_at"
+
+func findTimetableWithPeriods(ctx context.Context, tx *sqldb.Tx, institution, timetable uint64) (t *models.Timetable, periods []*models.TimetablePeriod, err error) {
+	query := fmt.Sprintf("SELECT %s FROM timetables t WHERE t.id = $1 AND t.institution = $2;", timetableFields)
+	if tx != nil {
+		t, err = scanTimetable(tx.QueryRow(ctx, query, timetable, institution))
+	} else {
+		t, err = scanTimetable(db.QueryRow(ctx, query, timetable, institution))
+	}
+	if err != nil {
+		return
+	}
+
+	periods, err = queryTimetablePeriods(ctx, tx, timetable)
+	return
+}
+
+// Locks a timetable of an institution so that its slots can be changed without conflicting with concurrent changes
+func lockTimetable(ctx context.Context, tx *sqldb.Tx, institution, timetable uint64) (*models.Timetable, error) {
+	query := fmt.Sprintf("SELECT %s FROM timetables t WHERE t.id = $1 AND t.institution = $2 FOR UPDATE;", timetableFields)
+	return scanTimetable(tx.QueryRow(ctx, query, timetable, institution))
+}
+
+func scanTimetable(row rowScanner) (*models.Timetable, error) {
+	t := new(models.Timetable)
+	if err := row.Scan(&t.Id, &t.Institution, &t.AcademicTerm, (*pq.Int64Array)(&t.Days), &t.CreatedBy, &t.CreatedAt, &t.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Lists the periods of a timetable in order, within the transaction when one is given
+func queryTimetablePeriods(ctx context.Context, tx *sqldb.Tx, timetable uint64) (ans []*models.TimetablePeriod, err error) {
+	query := "SELECT timetable,number,label,TO_CHAR(starts_at, 'HH24:MI'),TO_CHAR(ends_at, 'HH24:MI') FROM timetable_periods WHERE timetable = $1 ORDER BY number;"
+
+	var rows *sqldb.Rows
+	if tx != nil {
+		rows, err = tx.Query(ctx, query, timetable)
+	} else {
+		rows, err = db.Query(ctx, query, timetable)
+	}
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		p := new(models.TimetablePeriod)
+		if err = rows.Scan(&p.Timetable, &p.Number, &p.Label, &p.StartsAt, &p.EndsAt); err != nil {
+			return
+		}
+		ans = append(ans, p)
+	}
+	err = rows.Err()
+	return
+}
+
+func timetableToDto(t *models.Timetable, periods []*models.TimetablePeriod) *dto.Timetable {
+	ans := &dto.Timetable{
+		Id:           t.Id,
+		Institution:  t.Institution,
+		AcademicTerm: t.AcademicTerm,
+		Days:         make([]int, 0, len(t.Days)),
+		Periods:      make([]dto.TimetablePeriod, 0, len(periods)),
+		CreatedBy:    t.CreatedBy,
+		CreatedAt:    t.CreatedAt,
+		UpdatedAt:    t.UpdatedAt,
+	}
+	for _, d := range t.Days {
+		ans.Days = append(ans.Days, int(d))
+	}
+	for _, p := range periods {
+		v := dto.TimetablePeriod{
+			Number:   p.Number,
+			StartsAt: p.StartsAt,
+			EndsAt:   p.EndsAt,
+		}
+		if p.Label.Valid {
+			v.Label = &p.Label.String
+		}
+		ans.Periods = append(ans.Periods, v)
+	}
+	return ans
+}
+
+const timetableSlotFields = "s.id,s.timetable,s.class,CONCAT_WS(' ', l.name, c.name),s.day,s.period,s.course,co.subject,sj.name,s.teacher,s.room,r.name,TO_CHAR(p.starts_at, 'HH24:MI'),TO_CHAR(p.ends_at, 'HH24:MI'),s.created_at,s.updated_at"
+
+const timetableSlotSource = `
+	timetable_slots s
+	JOIN classes c ON c.id = s.class
+	JOIN levels l ON l.id = c.level
+	JOIN courses co ON co.id = s.course
+	JOIN subjects sj ON sj.id = co.subject
+	JOIN timetable_periods p ON p.timetable = s.timetable AND p.number = s.period
+	LEFT JOIN rooms r ON r.id = s.room
+`
+
+// Finds a slot of a timetable, within the transaction when one is given
+func findTimetableSlot(ctx context.Context, tx *sqldb.Tx, timetable, slot uint64) (*models.TimetableSlot, error) {
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE s.id = $1 AND s.timetable = $2;", timetableSlotFields, timetableSlotSource)
+	if tx != nil {
+		return scanTimetableSlot(tx.QueryRow(ctx, query, slot, timetable))
+	}
+	return scanTimetableSlot(db.QueryRow(ctx, query, slot, timetable))
+}
+
+// Lists the slots matching a condition in the order of the week
+func queryTimetableSlots(ctx context.Context, condition string, args ...any) (ans []*models.TimetableSlot, err error) {
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE %s ORDER BY s.day, s.period, c.name;", timetableSlotFields, timetableSlotSource, condition)
+	rows, err := db.Query(ctx, query, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var s *models.TimetableSlot
+		if s, err = scanTimetableSlot(rows); err != nil {
+			return
+		}
+		ans = append(ans, s)
+	}
+	err = rows.Err()
+	return
+}
+
+func scanTimetableSlot(row rowScanner) (*models.TimetableSlot, error) {
+	s := new(models.TimetableSlot)
+	if err := row.Scan(&s.Id, &s.Timetable, &s.Class, &s.ClassName, &s.Day, &s.Period, &s.Course, &s.Subject, &s.SubjectName, &s.Teacher, &s.Room, &s.RoomName, &s.StartsAt, &s.EndsAt, &s.CreatedAt, &s.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func timetableSlotsToDto(slots ...*models.TimetableSlot) (ans []dto.TimetableSlot) {
+	ans = make([]dto.TimetableSlot, 0, len(slots))
+	for _, s := range slots {
+		v := dto.TimetableSlot{
+			Id:          s.Id,
+			Timetable:   s.Timetable,
+			Class:       s.Class,
+			ClassName:   s.ClassName,
+			Day:         s.Day,
+			Period:      s.Period,
+			Course:      s.Course,
+			Subject:     s.Subject,
+			SubjectName: s.SubjectName,
+			StartsAt:    s.StartsAt,
+			EndsAt:      s.EndsAt,
+		}
+		if s.Teacher.Valid {
+			teacher := uint64(s.Teacher.Int64)
+			v.Teacher = &teacher
+		}
+		if s.Room.Valid {
+			room := uint64(s.Room.Int64)
+			v.Room = &room
+		}
+		if s.RoomName.Valid {
+			v.RoomName = &s.RoomName.String
+		}
+		ans = append(ans, v)
+	}
+	return
+}
@@ -0,0 +1,220 @@
+package institutions_test
+
+import (
+	"context"
+	"testing"
+
+	"encore.dev/beta/errs"
+	"encore.dev/et"
+	"github.com/brinestone/scholaris/core/permissions"
+	"github.com/brinestone/scholaris/core/users"
+	"github.com/brinestone/scholaris/dto"
+	"github.com/brinestone/scholaris/institutions"
+	"github.com/brinestone/scholaris/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimetable(t *testing.T) {
+	et.MockEndpoint(users.FindUserById, func(ctx context.Context, id uint64) (*models.User, error) {
+		return &models.User{Id: id}, nil
+	})
+
+	i, err := makeInstitution()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	year, err := makeAcademicYear(i.Id)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	term := year.Terms[0]
+
+	level, err := institutions.CreateLevel(mainContext, i.Id, dto.NewLevelRequest{Name: "Form 4"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	classA, err := institutions.CreateClass(mainContext, i.Id, dto.NewClassRequest{Level: level.Id, AcademicYear: year.Id, Name: "A"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	classB, err := institutions.CreateClass(mainContext, i.Id, dto.NewClassRequest{Level: level.Id, AcademicYear: year.Id, Name: "B"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	three, two := uint(3), uint(2)
+	maths, err := institutions.CreateSubject(mainContext, i.Id, level.Id, dto.NewSubjectRequest{Name: "Mathematics", WeeklyPeriods: &three})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	english, err := institutions.CreateSubject(mainContext, i.Id, level.Id, dto.NewSubjectRequest{Name: "English", WeeklyPeriods: &two})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.Equal(t, uint(3), maths.WeeklyPeriods)
+
+	mathsA, err := institutions.CreateCourse(mainContext, i.Id, classA.Id, dto.NewCourseRequest{Subject: maths.Id})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	englishA, err := institutions.CreateCourse(mainContext, i.Id, classA.Id, dto.NewCourseRequest{Subject: english.Id})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	mathsB, err := institutions.CreateCourse(mainContext, i.Id, classB.Id, dto.NewCourseRequest{Subject: maths.Id})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	room, err := institutions.CreateRoom(mainContext, i.Id, dto.NewRoomRequest{Name: "Lab 1"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	_, err = institutions.CreateRoom(mainContext, i.Id, dto.NewRoomRequest{Name: "lab 1"})
+	assert.NotNil(t, err, "room names are unique")
+
+	assert.NotNil(t, dto.NewTimetableRequest{
+		AcademicTerm: term.Id,
+		Periods:      []dto.TimetablePeriodEntry{{StartsAt: "08:00", EndsAt: "09:00"}, {StartsAt: "08:30", EndsAt: "09:30"}},
+	}.Validate(), "periods cannot overlap")
+
+	timetable, err := institutions.CreateTimetable(mainContext, i.Id, dto.NewTimetableRequest{
+		AcademicTerm: term.Id,
+		Days:         []int{1, 2},
+		Periods:      []dto.TimetablePeriodEntry{{StartsAt: "08:00", EndsAt: "09:00"}, {StartsAt: "09:00", EndsAt: "10:00"}},
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.Len(t, timetable.Periods, 2)
+	assert.Equal(t, 2, timetable.Periods[1].Number)
+
+	_, err = institutions.CreateTimetable(mainContext, i.Id, dto.NewTimetableRequest{
+		AcademicTerm: term.Id,
+		Periods:      []dto.TimetablePeriodEntry{{StartsAt: "08:00", EndsAt: "09:00"}},
+	})
+	assert.NotNil(t, err, "a term has a single timetable")
+
+	slot, err := institutions.CreateTimetableSlot(mainContext, i.Id, timetable.Id, dto.NewTimetableSlotRequest{Class: classA.Id, Day: 1, Period: 1, Course: mathsA.Id, Room: &room.Id})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.Equal(t, "08:00", slot.StartsAt)
+	assert.Equal(t, room.Name, *slot.RoomName)
+
+	_, err = institutions.CreateTimetableSlot(mainContext, i.Id, timetable.Id, dto.NewTimetableSlotRequest{Class: classA.Id, Day: 1, Period: 1, Course: englishA.Id})
+	assert.NotNil(t, err, "a class has a single course per period")
+
+	_, err = institutions.CreateTimetableSlot(mainContext, i.Id, timetable.Id, dto.NewTimetableSlotRequest{Class: classB.Id, Day: 1, Period: 1, Course: mathsB.Id, Room: &room.Id})
+	assert.NotNil(t, err, "a room cannot be booked twice during a period")
+
+	_, err = institutions.CreateTimetableSlot(mainContext, i.Id, timetable.Id, dto.NewTimetableSlotRequest{Class: classB.Id, Day: 3, Period: 1, Course: mathsB.Id})
+	assert.NotNil(t, err, "the timetable does not cover Wednesdays")
+
+	_, err = institutions.CreateTimetableSlot(mainContext, i.Id, timetable.Id, dto.NewTimetableSlotRequest{Class: classB.Id, Day: 1, Period: 1, Course: mathsA.Id})
+	assert.NotNil(t, err, "the course is not taught in the class")
+
+	view, err := institutions.FindRoomTimetable(mainContext, i.Id, timetable.Id, room.Id)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.Len(t, view.Slots, 1)
+
+	proposal, err := institutions.ProposeTimetable(mainContext, i.Id, timetable.Id, dto.ProposeTimetableRequest{Classes: []uint64{classB.Id}})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.False(t, proposal.Applied)
+	assert.Len(t, proposal.Slots, 3)
+	for _, s := range proposal.Slots {
+		assert.NotEqual(t, dto.TimetableSlot{Day: 1, Period: 1}, dto.TimetableSlot{Day: s.Day, Period: s.Period}, "the room is taken by class A")
+	}
+
+	proposal, err = institutions.ProposeTimetable(mainContext, i.Id, timetable.Id, dto.ProposeTimetableRequest{Classes: []uint64{classA.Id}, Apply: true})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.True(t, proposal.Applied)
+	assert.Len(t, proposal.Slots, 4, "class A has 5 periods for 4 slots")
+	assert.Len(t, proposal.Unscheduled, 1)
+
+	view, err = institutions.FindClassTimetable(mainContext, i.Id, timetable.Id, classA.Id)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.Len(t, view.Slots, 4)
+
+	updated, err := institutions.UpdateTimetable(mainContext, i.Id, timetable.Id, dto.UpdateTimetableRequest{Days: []int{1}})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.Equal(t, []int{1}, updated.Days)
+
+	view, err = institutions.FindClassTimetable(mainContext, i.Id, timetable.Id, classA.Id)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.Len(t, view.Slots, 2, "the slots of removed days are deleted")
+
+	assert.NotNil(t, institutions.DeleteRoom(mainContext, i.Id, room.Id), "rooms in use cannot be deleted")
+}
+
+func TestDeleteAcademicTermWithTimetable(t *testing.T) {
+	t.Cleanup(mockEndpoints)
+	et.MockEndpoint(permissions.PurgeObjectTuples, func(ctx context.Context, req dto.PurgeObjectTuplesRequest) (*dto.PurgeResponse, error) {
+		return &dto.PurgeResponse{Deleted: uint(len(req.Objects))}, nil
+	})
+
+	i, err := makeInstitution()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	year, err := makeAcademicYear(i.Id)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	term := year.Terms[0]
+
+	created, err := institutions.CreateTimetable(mainContext, i.Id, dto.NewTimetableRequest{
+		AcademicTerm: term.Id,
+		Periods:      []dto.TimetablePeriodEntry{{StartsAt: "08:00", EndsAt: "09:00"}},
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	_, err = institutions.DeleteAcademicTerm(mainContext, i.Id, year.Id, term.Id)
+	assert.Equal(t, errs.FailedPrecondition, errs.Code(err))
+	assert.NotNil(t, institutions.DeleteAcademicTermRow(context.TODO(), term.Id), "the timetable keeps its term from being deleted")
+
+	timetable, err := institutions.FindTimetable(mainContext, i.Id, created.Id)
+	if assert.Nil(t, err) {
+		assert.Equal(t, term.Id, timetable.AcademicTerm)
+	}
+
+	assert.Nil(t, institutions.DeleteInstitution(mainContext, i.Id), "the timetables of the institution's terms go along")
+}
@@ -0,0 +1,519 @@
+package institutions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+	"time"
+
+	"encore.dev/beta/auth"
+	"encore.dev/beta/errs"
+	"encore.dev/rlog"
+	"encore.dev/storage/sqldb"
+	"github.com/brinestone/scholaris/blob"
+	"github.com/brinestone/scholaris/core/notifier"
+	"github.com/brinestone/scholaris/core/permissions"
+	"github.com/brinestone/scholaris/core/users"
+	"github.com/brinestone/scholaris/dto"
+	"github.com/brinestone/scholaris/helpers"
+	"github.com/brinestone/scholaris/models"
+	"github.com/brinestone/scholaris/util"
+	"github.com/lib/pq"
+)
+
+// Submits an institution's supporting documents for review by the platform
+//
+//encore:api auth method=POST path=/institutions/:id/verification-requests tag:can_update_institution tag:institution_writable
+func SubmitVerificationRequest(ctx context.Context, id uint64, req dto.NewVerificationRequest) (ans *dto.VerificationRequest, err error) {
+	institution, err := findInstitutionByIdFromDb(ctx, id)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		err = &util.ErrNotFound
+		return
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if institution.Verified {
+		err = &errs.Error{
+			Code:    errs.FailedPrecondition,
+			Message: "This institution is already verified",
+		}
+		return
+	}
+
+	if err = assertInstitutionDocuments(ctx, id, req.Documents); err != nil {
+		return
+	}
+
+	uid, _ := auth.UserID()
+	submittedBy, _ := strconv.ParseUint(string(uid), 10, 64)
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+	defer tx.Rollback()
+
+	query := fmt.Sprintf(`
+		INSERT INTO verification_requests(institution, submitted_by, documents, notes)
+		VALUES ($1,$2,$3,$4)
+		ON CONFLICT (institution) WHERE status = 'pending' DO NOTHING
+		RETURNING %s;
+	`, verificationRequestFields)
+	request, err := scanVerificationRequest(tx.QueryRow(ctx, query, id, submittedBy, pq.Array(req.Documents), req.Notes))
+	if errors.Is(err, sqldb.ErrNoRows) {
+		err = &errs.Error{
+			Code:    errs.AlreadyExists,
+			Message: "This institution already has a pending verification request",
+		}
+		return
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	// Reviewers need to be able to read the documents they are reviewing
+	if err = permissions.SetPermissions(ctx, dto.UpdatePermissionsRequest{
+		Updates: reviewerDocumentPermissions(req.Documents),
+	}); err != nil {
+		rlog.Error(util.MsgCallError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = &verificationRequestsToDto(request)[0]
+	return
+}
+
+// Lists the verification requests an institution has submitted, newest first
+//
+//encore:api auth method=GET path=/institutions/:id/verification-requests tag:can_update_institution
+func FindVerificationRequests(ctx context.Context, id uint64) (ans *dto.VerificationRequestsResponse, err error) {
+	query := fmt.Sprintf("SELECT %s FROM verification_requests WHERE institution = $1 ORDER BY id DESC;", verificationRequestFields)
+	requests, err := queryVerificationRequests(ctx, query, id)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = &dto.VerificationRequestsResponse{
+		Requests: verificationRequestsToDto(requests...),
+	}
+	return
+}
+
+// Lists the pending verification requests awaiting review, oldest first
+//
+//encore:api auth method=GET path=/verification-requests tag:can_review_institutions
+func FindPendingVerificationRequests(ctx context.Context, params dto.CursorBasedPaginationParams) (ans *dto.VerificationRequestsResponse, err error) {
+	size := params.PageSize()
+	query := fmt.Sprintf("SELECT %s FROM verification_requests WHERE status = $1 AND id > $2 ORDER BY id LIMIT $3;", verificationRequestFields)
+	requests, err := queryVerificationRequests(ctx, query, dto.VRSPending, params.After, size+1)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = &dto.VerificationRequestsResponse{}
+	if uint(len(requests)) > size {
+		requests = requests[:size]
+		ans.Next = requests[size-1].Id
+	}
+	ans.Requests = verificationRequestsToDto(requests...)
+	return
+}
+
+// Approves a pending verification request, marking its institution as verified
+//
+//encore:api auth method=POST path=/verification-requests/:id/approve tag:can_review_institutions
+func ApproveVerificationRequest(ctx context.Context, id uint64, req dto.VerificationDecisionRequest) (*dto.VerificationRequest, error) {
+	return decideVerificationRequest(ctx, id, dto.VRSApproved, req.Reason)
+}
+
+// Rejects a pending verification request. The institution may submit a new request afterwards.
+//
+//encore:api auth method=POST path=/verification-requests/:id/reject tag:can_review_institutions
+func RejectVerificationRequest(ctx context.Context, id uint64, req dto.VerificationReasonRequest) (*dto.VerificationRequest, error) {
+	return decideVerificationRequest(ctx, id, dto.VRSRejected, &req.Reason)
+}
+
+// Revokes the verification of an institution
+//
+//encore:api auth method=POST path=/institutions/:id/verification/revoke tag:can_review_institutions
+func RevokeInstitutionVerification(ctx context.Context, id uint64, req dto.VerificationReasonRequest) (ans *dto.Institution, err error) {
+	uid, _ := auth.UserID()
+	reviewer, _ := strconv.ParseUint(string(uid), 10, 64)
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+	defer tx.Rollback()
+
+	slug, err := setInstitutionVerified(ctx, tx, id, false)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		err = &errs.Error{
+			Code:    errs.FailedPrecondition,
+			Message: "This institution is not verified",
+		}
+		return
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	// Institutions verified before requests existed have nothing to mark
+	var request uint64
+	err = tx.QueryRow(ctx, `
+		UPDATE verification_requests SET
+			status = $2,
+			revoked_by = $3,
+			revoke_reason = $4,
+			revoked_at = CURRENT_TIMESTAMP
+		WHERE
+			id = (SELECT id FROM verification_requests WHERE institution = $1 AND status = $5 ORDER BY id DESC LIMIT 1)
+		RETURNING id;
+	`, id, dto.VRSRevoked, reviewer, req.Reason, dto.VRSApproved).Scan(&request)
+	if err != nil && !errors.Is(err, sqldb.ErrNoRows) {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	evictCachedInstitution(ctx, id, slug)
+	publishVerificationChange(ctx, id, request, dto.VRSRevoked, &req.Reason, uid)
+	return findInstitutionByGenericIdentifier(ctx, strconv.FormatUint(id, 10))
+}
+
+// Private section
+
+// Records a reviewer's decision on a pending request, verifying the institution when it is approved
+func decideVerificationRequest(ctx context.Context, id uint64, status dto.VerificationRequestStatus, reason *string) (ans *dto.VerificationRequest, err error) {
+	uid, _ := auth.UserID()
+	reviewer, _ := strconv.ParseUint(string(uid), 10, 64)
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+	defer tx.Rollback()
+
+	query := fmt.Sprintf(`
+		UPDATE verification_requests SET
+			status = $2,
+			reviewed_by = $3,
+			review_reason = $4,
+			reviewed_at = CURRENT_TIMESTAMP
+		WHERE
+			id = $1 AND status = $5
+		RETURNING %s;
+	`, verificationRequestFields)
+	request, err := scanVerificationRequest(tx.QueryRow(ctx, query, id, status, reviewer, reason, dto.VRSPending))
+	if errors.Is(err, sqldb.ErrNoRows) {
+		err = &errs.Error{
+			Code:    errs.NotFound,
+			Message: "No pending verification request was found",
+		}
+		return
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	// Reviewers only need the documents while the request is pending
+	if err = permissions.ReplacePermissions(ctx, dto.ReplacePermissionsRequest{
+		Deletes: reviewerDocumentPermissions(request.Documents),
+	}); err != nil {
+		rlog.Error(util.MsgCallError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	var slug string
+	if status == dto.VRSApproved {
+		if slug, err = setInstitutionVerified(ctx, tx, request.Institution, true); err != nil && !errors.Is(err, sqldb.ErrNoRows) {
+			rlog.Error(util.MsgDbAccessError, "err", err)
+			err = &util.ErrUnknown
+			return
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if len(slug) > 0 {
+		evictCachedInstitution(ctx, request.Institution, slug)
+	}
+	publishVerificationChange(ctx, request.Institution, request.Id, status, reason, uid)
+	ans = &verificationRequestsToDto(request)[0]
+	return
+}
+
+// The tuples letting platform reviewers read the documents of a verification request
+func reviewerDocumentPermissions(documents []string) []dto.PermissionUpdate {
+	reviewers := fmt.Sprintf("%s#%s", dto.IdentifierString(dto.PTPlatform, dto.PlatformId), dto.PNReviewer)
+	return helpers.SliceMap(documents, func(key string) dto.PermissionUpdate {
+		return dto.PermissionUpdate{
+			Actor:    reviewers,
+			Relation: dto.PNCanView,
+			Target:   dto.IdentifierString(dto.PTSharedFile, key),
+		}
+	})
+}
+
+// Flips the verified flag of an institution. Returns sqldb.ErrNoRows when the flag is already set to the value.
+func setInstitutionVerified(ctx context.Context, tx *sqldb.Tx, id uint64, verified bool) (slug string, err error) {
+	err = tx.QueryRow(ctx, `
+		UPDATE institutions SET
+			verified = $2,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE
+			id = $1 AND verified <> $2
+		RETURNING slug;
+	`, id, verified).Scan(&slug)
+	return
+}
+
+func publishVerificationChange(ctx context.Context, institution, request uint64, status dto.VerificationRequestStatus, reason *string, changedBy auth.UID) {
+	if _, err := VerificationChanges.Publish(ctx, &InstitutionVerificationChanged{
+		Institution: institution,
+		Request:     request,
+		Status:      string(status),
+		Reason:      reason,
+		ChangedBy:   changedBy,
+		Timestamp:   time.Now(),
+	}); err != nil {
+		rlog.Error("could not publish verification change", "institution", institution, "err", err)
+	}
+}
+
+// Ensures every document exists and was uploaded on behalf of the institution
+func assertInstitutionDocuments(ctx context.Context, institution uint64, keys []string) error {
+	res, err := blob.FindUploadsInternal(ctx, dto.FindUploadsRequest{Keys: keys})
+	if err != nil {
+		rlog.Error(util.MsgCallError, "err", err)
+		return &util.ErrUnknown
+	}
+
+	owned := make(map[string]bool)
+	for _, u := range res.Uploads {
+		if u.Owner != nil && *u.Owner == institution && u.OwnerType != nil && *u.OwnerType == string(dto.PTInstitution) {
+			owned[u.Key] = true
+		}
+	}
+
+	invalid := make([]string, 0)
+	for _, key := range keys {
+		if !owned[key] {
+			invalid = append(invalid, key)
+		}
+	}
+	if len(invalid) > 0 {
+		return &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: fmt.Sprintf("The following documents were not uploaded for this institution: %s", strings.Join(invalid, ", ")),
+		}
+	}
+	return nil
+}
+
+const verificationRequestFields = "id,institution,submitted_by,documents,notes,status,reviewed_by,review_reason,reviewed_at,revoked_by,revoke_reason,revoked_at,created_at"
+
+func queryVerificationRequests(ctx context.Context, query string, args ...any) (ans []*models.VerificationRequest, err error) {
+	rows, err := db.Query(ctx, query, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r *models.VerificationRequest
+		if r, err = scanVerificationRequest(rows); err != nil {
+			return
+		}
+		ans = append(ans, r)
+	}
+	err = rows.Err()
+	return
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanVerificationRequest(row rowScanner) (*models.VerificationRequest, error) {
+	r := new(models.VerificationRequest)
+	if err := row.Scan(&r.Id, &r.Institution, &r.SubmittedBy, pq.Array(&r.Documents), &r.Notes, &r.Status, &r.ReviewedBy, &r.ReviewReason, &r.ReviewedAt, &r.RevokedBy, &r.RevokeReason, &r.RevokedAt, &r.CreatedAt); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func verificationRequestsToDto(requests ...*models.VerificationRequest) (ans []dto.VerificationRequest) {
+	ans = make([]dto.VerificationRequest, 0, len(requests))
+	for _, r := range requests {
+		v := dto.VerificationRequest{
+			Id:          r.Id,
+			Institution: r.Institution,
+			SubmittedBy: r.SubmittedBy,
+			Documents:   r.Documents,
+			Status:      dto.VerificationRequestStatus(r.Status),
+			CreatedAt:   r.CreatedAt,
+		}
+		if r.Notes.Valid {
+			v.Notes = &r.Notes.String
+		}
+		if r.ReviewedBy.Valid {
+			reviewer := uint64(r.ReviewedBy.Int64)
+			v.ReviewedBy = &reviewer
+		}
+		if r.ReviewReason.Valid {
+			v.ReviewReason = &r.ReviewReason.String
+		}
+		if r.ReviewedAt.Valid {
+			v.ReviewedAt = &r.ReviewedAt.Time
+		}
+		if r.RevokedBy.Valid {
+			revoker := uint64(r.RevokedBy.Int64)
+			v.RevokedBy = &revoker
+		}
+		if r.RevokeReason.Valid {
+			v.RevokeReason = &r.RevokeReason.String
+		}
+		if r.RevokedAt.Valid {
+			v.RevokedAt = &r.RevokedAt.Time
+		}
+		ans = append(ans, v)
+	}
+	return
+}
+
+// Emails every maintainer of an institution about a change to its verification
+func notifyMaintainersOfVerification(ctx context.Context, msg *InstitutionVerificationChanged) error {
+	institution, err := findInstitutionByIdFromDb(ctx, msg.Institution)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	subject, body := verificationChangeEmail(institution, msg)
+	notification := fmt.Sprintf("verification:%d:%d:%s:%d", msg.Institution, msg.Request, msg.Status, msg.Timestamp.UnixNano())
+	return emailInstitutionMaintainers(ctx, notification, institution.Id, subject, body)
+}
+
+func verificationChangeEmail(institution *models.Institution, msg *InstitutionVerificationChanged) (subject, body string) {
+	switch dto.VerificationRequestStatus(msg.Status) {
+	case dto.VRSApproved:
+		subject = fmt.Sprintf("%s has been verified", institution.Name)
+		body = fmt.Sprintf("<p>The verification request of <strong>%s</strong> has been approved.</p>", institution.Name)
+	case dto.VRSRejected:
+		subject = fmt.Sprintf("The verification request of %s was rejected", institution.Name)
+		body = fmt.Sprintf("<p>The verification request of <strong>%s</strong> has been rejected. You may submit a new request.</p>", institution.Name)
+	default:
+		subject = fmt.Sprintf("The verification of %s has been revoked", institution.Name)
+		body = fmt.Sprintf("<p><strong>%s</strong> is no longer verified.</p>", institution.Name)
+	}
+	if msg.Reason != nil {
+		body += fmt.Sprintf("<p>Reason: %s</p>", html.EscapeString(*msg.Reason))
+	}
+	return
+}
+
+// Sends an HTML email to the maintainers of an institution. Maintainers who already received the notification are
+// skipped, and a failed send does not stop the others, so that a redelivery only emails those who were missed.
+func emailInstitutionMaintainers(ctx context.Context, notification string, institution uint64, subject, body string) error {
+	maintainers, err := permissions.ListUsersInternal(ctx, dto.ListUsersRequest{
+		Target:   dto.IdentifierString(dto.PTInstitution, institution),
+		Relation: dto.PNMaintainer,
+	})
+	if err != nil {
+		return err
+	}
+
+	var failed []error
+	for _, id := range maintainers.Users {
+		user, err := users.FindUserById(ctx, id)
+		if err != nil {
+			rlog.Warn("could not find maintainer to notify", "user", id, "err", err)
+			continue
+		}
+
+		email, ok := primaryEmailOf(user)
+		if !ok {
+			continue
+		}
+
+		if err = sendNotificationEmail(ctx, notification, id, dto.SendEmailRequest{
+			To:            email,
+			Subject:       subject,
+			Body:          body,
+			IsContentHtml: true,
+		}); err != nil {
+			rlog.Error("could not notify maintainer", "notification", notification, "user", id, "err", err)
+			failed = append(failed, err)
+		}
+	}
+	return errors.Join(failed...)
+}
+
+// Emails a recipient once per notification, recording the delivery once the email is sent
+func sendNotificationEmail(ctx context.Context, notification string, recipient uint64, email dto.SendEmailRequest) error {
+	var delivered bool
+	if err := db.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM notification_deliveries WHERE notification = $1 AND recipient = $2);", notification, recipient).Scan(&delivered); err != nil {
+		return err
+	} else if delivered {
+		return nil
+	}
+
+	if err := notifier.SendEmail(ctx, email); err != nil {
+		return err
+	}
+
+	_, err := db.Exec(ctx, "INSERT INTO notification_deliveries(notification, recipient) VALUES ($1,$2) ON CONFLICT DO NOTHING;", notification, recipient)
+	return err
+}
+
+func primaryEmailOf(user *models.User) (string, bool) {
+	if email, ok := helpers.Find(user.Emails, func(e models.UserEmailAddress) bool {
+		return e.IsPrimary
+	}); ok {
+		return email.Email, true
+	}
+
+	if len(user.Emails) > 0 {
+		return user.Emails[0].Email, true
+	}
+	return "", false
+}
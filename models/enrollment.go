@@ -36,6 +36,7 @@ type Enrollment struct {
 	Status             string
 	Approver           sql.NullInt64
 	ApprovedAt         sql.NullTime
+	DecisionReason     sql.NullString
 	PaymentTransaction sql.NullInt64
 	ServiceTransaction sql.NullInt64
 	CreatedAt          time.Time
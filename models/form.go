@@ -31,6 +31,14 @@ type Form struct {
 	SubmissionCount uint64
 }
 
+func (f Form) GetOwner() uint64 {
+	return f.Owner
+}
+
+func (f Form) GetOwnerType() string {
+	return f.OwnerType
+}
+
 type FormQuestionOption struct {
 	Id        uint64
 	Caption   string
@@ -48,4 +48,341 @@ type Institution struct {
 	Verified    bool
 	CurrentYear sql.NullInt64
 	CurrentTerm sql.NullInt64
+	ArchivedAt  sql.NullTime
+}
+
+type VerificationRequest struct {
+	Id           uint64
+	Institution  uint64
+	SubmittedBy  uint64
+	Documents    []string
+	Notes        sql.NullString
+	Status       string
+	ReviewedBy   sql.NullInt64
+	ReviewReason sql.NullString
+	ReviewedAt   sql.NullTime
+	RevokedBy    sql.NullInt64
+	RevokeReason sql.NullString
+	RevokedAt    sql.NullTime
+	CreatedAt    time.Time
+}
+
+type Level struct {
+	Id           uint64
+	Institution  uint64
+	Name         string
+	Code         sql.NullString
+	Description  sql.NullString
+	Position     int
+	Capacity     sql.NullInt32
+	Prerequisite sql.NullInt64
+	GradingScale sql.NullInt64
+	ArchivedAt   sql.NullTime
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+type Class struct {
+	Id              uint64
+	Institution     uint64
+	Level           uint64
+	AcademicYear    uint64
+	Name            string
+	Stream          sql.NullString
+	Capacity        sql.NullInt32
+	HomeroomTeacher sql.NullInt64
+	Students        uint
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+}
+
+type ClassPlacement struct {
+	Id            uint64
+	Class         uint64
+	AcademicYear  uint64
+	Student       uint64
+	PlacedBy      uint64
+	PlacedAt      time.Time
+	RemovedAt     sql.NullTime
+	RemovedBy     sql.NullInt64
+	RemovalReason sql.NullString
+	RemovalNote   sql.NullString
+	TransferredTo sql.NullInt64
+}
+
+type CalendarEvent struct {
+	Id                  uint64
+	Institution         uint64
+	AcademicYear        sql.NullInt64
+	AcademicTerm        sql.NullInt64
+	Title               string
+	Description         sql.NullString
+	Location            sql.NullString
+	Category            string
+	StartsAt            time.Time
+	EndsAt              time.Time
+	AllDay              bool
+	RecurrenceFrequency sql.NullString
+	RecurrenceInterval  int
+	RecurrenceCount     sql.NullInt32
+	RecurrenceUntil     sql.NullTime
+	Audience            string
+	AudienceRef         sql.NullInt64
+	Visibility          string
+	CreatedBy           uint64
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
+}
+
+type AcademicYearCreationSchedule struct {
+	Institution uint64
+	Enabled     bool
+	NextRunAt   sql.NullTime
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+type AcademicYearCreationRun struct {
+	Id           uint64
+	Institution  uint64
+	Status       string
+	Reason       sql.NullString
+	AcademicYear sql.NullInt64
+	RanAt        time.Time
+}
+
+type Student struct {
+	Id           uint64
+	Institution  uint64
+	Matricule    string
+	Enrollment   sql.NullInt64
+	Account      sql.NullInt64
+	FirstName    string
+	LastName     string
+	Gender       sql.NullString
+	DateOfBirth  sql.NullTime
+	PlaceOfBirth sql.NullString
+	Nationality  sql.NullString
+	Address      sql.NullString
+	Phone        sql.NullString
+	Email        sql.NullString
+	Status       string
+	CreatedBy    sql.NullInt64
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+type StudentStatusChange struct {
+	Id             uint64
+	Student        uint64
+	Status         string
+	PreviousStatus sql.NullString
+	Reason         sql.NullString
+	ChangedBy      sql.NullInt64
+	ChangedAt      time.Time
+}
+
+type StudentGuardian struct {
+	Id           uint64
+	Student      uint64
+	Name         string
+	Relationship string
+	Phone        sql.NullString
+	Email        sql.NullString
+	Address      sql.NullString
+	IsPrimary    bool
+	Account      sql.NullInt64
+	LinkedAt     sql.NullTime
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+type GuardianInvitation struct {
+	Id         uint64
+	Guardian   uint64
+	Email      string
+	TokenHash  string
+	InvitedBy  uint64
+	ExpiresAt  time.Time
+	CreatedAt  time.Time
+	AcceptedAt sql.NullTime
+	AcceptedBy sql.NullInt64
+	RevokedAt  sql.NullTime
+}
+
+type StudentMedicalNote struct {
+	Id         uint64
+	Student    uint64
+	Category   string
+	Note       string
+	RecordedBy uint64
+	RecordedAt time.Time
+}
+
+type GradingScale struct {
+	Id           uint64
+	Institution  uint64
+	Name         string
+	MinScore     float64
+	MaxScore     float64
+	PassingScore float64
+	Decimals     int
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+type Subject struct {
+	Id            uint64
+	Institution   uint64
+	Level         uint64
+	Name          string
+	Code          sql.NullString
+	Coefficient   float64
+	WeeklyPeriods uint
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+type Course struct {
+	Id          uint64
+	Class       uint64
+	Subject     uint64
+	SubjectName string
+	Coefficient float64
+	Teacher     sql.NullInt64
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+type Assessment struct {
+	Id           uint64
+	Course       uint64
+	AcademicTerm uint64
+	Title        string
+	Kind         string
+	MaxScore     float64
+	Weight       float64
+	HeldOn       sql.NullTime
+	Scores       uint
+	CreatedBy    uint64
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+type AssessmentScore struct {
+	Assessment uint64
+	Student    uint64
+	Score      sql.NullFloat64
+	Absent     bool
+	Comment    sql.NullString
+	RecordedBy uint64
+	RecordedAt time.Time
+}
+
+type ReportCardRemark struct {
+	Id           uint64
+	Class        uint64
+	AcademicTerm uint64
+	Student      uint64
+	Course       sql.NullInt64
+	Remark       string
+	WrittenBy    uint64
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+type ReportCardJob struct {
+	Id           uint64
+	Class        uint64
+	AcademicTerm uint64
+	Students     []int64
+	Status       string
+	Total        uint
+	Generated    uint
+	Failed       uint
+	Error        sql.NullString
+	RequestedBy  uint64
+	CreatedAt    time.Time
+	StartedAt    sql.NullTime
+	CompletedAt  sql.NullTime
+}
+
+type ReportCard struct {
+	Id           uint64
+	Class        uint64
+	AcademicTerm uint64
+	Student      uint64
+	Job          sql.NullInt64
+	FileKey      string
+	Average      sql.NullFloat64
+	Rank         sql.NullInt32
+	GeneratedBy  uint64
+	GeneratedAt  time.Time
+}
+
+type AttendanceSession struct {
+	Id           uint64
+	Class        uint64
+	AcademicTerm uint64
+	Date         time.Time
+	Period       sql.NullInt32
+	Course       sql.NullInt64
+	TakenBy      uint64
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+type AttendanceRecord struct {
+	Session    uint64
+	Student    uint64
+	Status     string
+	Note       sql.NullString
+	RecordedBy uint64
+	RecordedAt time.Time
+}
+
+type Room struct {
+	Id          uint64
+	Institution uint64
+	Name        string
+	Capacity    sql.NullInt32
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+type Timetable struct {
+	Id           uint64
+	Institution  uint64
+	AcademicTerm uint64
+	Days         []int64
+	CreatedBy    uint64
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+type TimetablePeriod struct {
+	Timetable uint64
+	Number    int
+	Label     sql.NullString
+	StartsAt  string
+	EndsAt    string
+}
+
+type TimetableSlot struct {
+	Id          uint64
+	Timetable   uint64
+	Class       uint64
+	ClassName   string
+	Day         int
+	Period      int
+	Course      uint64
+	Subject     uint64
+	SubjectName string
+	Teacher     sql.NullInt64
+	Room        sql.NullInt64
+	RoomName    sql.NullString
+	StartsAt    string
+	EndsAt      string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
 }
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+type Grant struct {
+	Id        uint64
+	UserId    uint64
+	Relation  string
+	Target    string
+	ExpiresAt time.Time
+	GrantedBy uint64
+	Delegated bool
+	Reason    sql.NullString
+	CreatedAt time.Time
+	RevokedAt sql.NullTime
+}
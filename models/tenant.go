@@ -12,6 +12,17 @@ type Tenant struct {
 	UpdatedAt        time.Time
 	Subscription     uint64
 	SubscriptionName string
+	Logo             sql.NullString
+	PrimaryColor     sql.NullString
+	SecondaryColor   sql.NullString
+	ContactEmail     sql.NullString
+	ContactPhone     sql.NullString
+	Website          sql.NullString
+	Street           sql.NullString
+	City             sql.NullString
+	Region           sql.NullString
+	PostalCode       sql.NullString
+	Country          sql.NullString
 }
 
 type SubscriptionPlanBenefit struct {
@@ -32,3 +43,86 @@ type SubscriptionPlan struct {
 	BillingCycle uint
 	Benefits     []SubscriptionPlanBenefit
 }
+
+type TenantMember struct {
+	Tenant   uint64
+	UserId   uint64
+	Role     string
+	JoinedAt time.Time
+}
+
+type TenantInvitation struct {
+	Id         uint64
+	Tenant     uint64
+	Email      string
+	Role       string
+	TokenHash  string
+	InvitedBy  uint64
+	ExpiresAt  time.Time
+	CreatedAt  time.Time
+	AcceptedAt sql.NullTime
+	AcceptedBy sql.NullInt64
+	RevokedAt  sql.NullTime
+}
+
+type OwnershipTransfer struct {
+	Id            uint64
+	Tenant        uint64
+	FromUser      uint64
+	ToUser        uint64
+	DemoteToAdmin bool
+	TokenHash     string
+	ExpiresAt     time.Time
+	CreatedAt     time.Time
+	ConfirmedAt   sql.NullTime
+	CancelledAt   sql.NullTime
+}
+
+type TenantDeletion struct {
+	Id           uint64
+	Tenant       uint64
+	Subscription uint64
+	RequestedBy  uint64
+	Reason       string
+	Status       string
+	RestoreUntil time.Time
+	CreatedAt    time.Time
+	StartedAt    sql.NullTime
+	CompletedAt  sql.NullTime
+}
+
+type TenantDeletionStep struct {
+	Deletion  uint64
+	Step      string
+	Status    string
+	Attempts  uint
+	LastError sql.NullString
+	UpdatedAt time.Time
+}
+
+type TenantDomain struct {
+	Id                uint64
+	Tenant            uint64
+	Hostname          string
+	VerificationToken string
+	VerifiedAt        sql.NullTime
+	LastCheckedAt     sql.NullTime
+	CreatedAt         time.Time
+}
+
+type TenantExport struct {
+	Id             uint64
+	Tenant         uint64
+	RequestedBy    uint64
+	Status         string
+	CurrentStep    sql.NullString
+	CompletedSteps uint
+	TotalSteps     uint
+	ObjectKey      sql.NullString
+	Size           sql.NullInt64
+	Error          sql.NullString
+	CreatedAt      time.Time
+	StartedAt      sql.NullTime
+	CompletedAt    sql.NullTime
+	ExpiresAt      sql.NullTime
+}
@@ -0,0 +1,52 @@
+package settings
+
+import (
+	"context"
+
+	"encore.dev/rlog"
+	"encore.dev/storage/objects"
+	"github.com/brinestone/scholaris/blob"
+	"github.com/brinestone/scholaris/dto"
+	"github.com/brinestone/scholaris/helpers"
+	"github.com/brinestone/scholaris/util"
+	"github.com/lib/pq"
+)
+
+// Exported settings are staged in the uploads bucket, where the export archive is assembled
+var exportBucket = objects.BucketRef[objects.Uploader](blob.UploadsBucket)
+
+// Exports the settings of the given owners along with their options and values
+//
+//encore:api private method=POST path=/settings/owned/export
+func ExportOwnedSettings(ctx context.Context, req dto.ExportOwnedRequest) (ans *dto.ExportResponse, err error) {
+	rows, err := db.Query(ctx, helpers.JsonRowsQuery(`
+		SELECT
+			s.id, s.key, s.label, s.description, s.multi_values, s.overridable, s.system_generated, s.parent,
+			s.owner, s.owner_type, s.created_by, s.created_at, s.updated_at,
+			COALESCE((
+				SELECT JSON_AGG(JSON_BUILD_OBJECT('id', o.id, 'label', o.label, 'value', o.value) ORDER BY o.id)
+				FROM setting_options o WHERE o.setting = s.id
+			), '[]'::JSON) AS options,
+			COALESCE((
+				SELECT JSON_AGG(JSON_BUILD_OBJECT('value', v.value, 'index', v.value_index, 'setBy', v.set_by, 'setAt', v.set_at) ORDER BY v.value_index)
+				FROM setting_values v WHERE v.setting = s.id
+			), '[]'::JSON) AS values
+		FROM
+			settings s
+		WHERE
+			s.owner_type = $1 AND s.owner = ANY($2)
+		ORDER BY
+			s.id`), req.OwnerType, pq.Array(req.Owners))
+	if err == nil {
+		err = helpers.StageJsonRows(ctx, exportBucket, req.StagingKey("settings.json"), rows)
+	}
+	if err != nil {
+		rlog.Error("could not export settings", "ownerType", req.OwnerType, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = new(dto.ExportResponse)
+	ans.Stage(req.StagingKey("settings.json"), "settings.json")
+	return
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 
 	eAuth "encore.dev/beta/auth"
+	"encore.dev/beta/errs"
 	"encore.dev/middleware"
 	"encore.dev/rlog"
 	"github.com/brinestone/scholaris/core/auth"
@@ -55,6 +56,40 @@ func UserCanViewSettings(req middleware.Request, next middleware.Next) middlewar
 	return next(req)
 }
 
+// Rejects changes to the settings of archived institutions
+//
+//encore:middleware target=tag:institution_writable
+func InstitutionWritable(req middleware.Request, next middleware.Next) middleware.Response {
+	var ownerInfo = req.Data().Payload.(models.OwnerInfo)
+	if ownerInfo.GetOwnerType() != string(dto.PTInstitution) {
+		return next(req)
+	}
+
+	uid, _ := eAuth.UserID()
+	res, err := permissions.CheckPermissionInternal(req.Context(), dto.InternalRelationCheckRequest{
+		Actor:    dto.IdentifierString(dto.PTUser, uid),
+		Relation: dto.PNArchived,
+		Target:   dto.IdentifierString(dto.PTInstitution, ownerInfo.GetOwner()),
+	})
+	if err != nil {
+		rlog.Error(util.MsgCallError, "err", err)
+		return middleware.Response{
+			Err: &util.ErrUnknown,
+		}
+	}
+
+	if res.Allowed {
+		return middleware.Response{
+			Err: &errs.Error{
+				Code:    errs.FailedPrecondition,
+				Message: "This institution is archived and cannot be changed",
+			},
+		}
+	}
+
+	return next(req)
+}
+
 //encore:middleware target=tag:needs_captcha_ver
 func VerifyCaptcha(req middleware.Request, next middleware.Next) middleware.Response {
 	p, ok := req.Data().Payload.(models.CaptchaVerifiable)
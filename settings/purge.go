@@ -0,0 +1,68 @@
+package settings
+
+import (
+	"context"
+
+	"encore.dev/rlog"
+	"github.com/brinestone/scholaris/core/permissions"
+	"github.com/brinestone/scholaris/dto"
+	"github.com/brinestone/scholaris/helpers"
+	"github.com/brinestone/scholaris/util"
+	"github.com/lib/pq"
+)
+
+// Deletes the settings of the given owners along with their values
+//
+//encore:api private method=POST path=/settings/owned/purge
+func PurgeOwnedSettings(ctx context.Context, req dto.PurgeOwnedRequest) (ans *dto.PurgeResponse, err error) {
+	deleted, err := purgeOwnedSettings(ctx, req.OwnerType, req.Owners...)
+	if err != nil {
+		rlog.Error("could not purge settings", "ownerType", req.OwnerType, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = &dto.PurgeResponse{Deleted: deleted}
+	return
+}
+
+func purgeOwnedSettings(ctx context.Context, ownerType dto.PermissionType, owners ...uint64) (deleted uint, err error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(ctx, "DELETE FROM settings WHERE owner_type = $1 AND owner = ANY($2) RETURNING id;", ownerType, pq.Array(owners))
+	if err != nil {
+		return
+	}
+
+	var ids []uint64
+	for rows.Next() {
+		var id uint64
+		if err = rows.Scan(&id); err != nil {
+			rows.Close()
+			return
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	if len(ids) == 0 {
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		return
+	}
+	deleted = uint(len(ids))
+
+	// The tuples only go once the settings are gone, so that a failed commit leaves the settings accessible
+	_, err = permissions.PurgeObjectTuples(ctx, dto.PurgeObjectTuplesRequest{
+		Objects: helpers.SliceMap(ids, func(id uint64) string {
+			return dto.IdentifierString(dto.PTSetting, id)
+		}),
+	})
+	return
+}
@@ -51,7 +51,7 @@ func SetSettingValuesInternal(ctx context.Context, req dto.SetSettingValueReques
 
 // Public API for updating setting values.
 //
-//encore:api auth method=PUT path=/settings/set tag:can_set_setting
+//encore:api auth method=PUT path=/settings/set tag:can_set_setting tag:institution_writable
 func SetSettingValues(ctx context.Context, req dto.SetSettingValueRequest) (err error) {
 	userId, _ := auth.UserID()
 	uid, _ := strconv.ParseUint(string(userId), 10, 64)
@@ -116,7 +116,7 @@ func UpdateSettingsInternal(ctx context.Context, req dto.UpdateSettingsInternalR
 
 // Updates settings (public API)
 //
-//encore:api auth method=POST path=/settings tag:can_update_settings tag:needs_captcha_ver
+//encore:api auth method=POST path=/settings tag:can_update_settings tag:institution_writable tag:needs_captcha_ver
 func UpdateSettings(ctx context.Context, req dto.UpdateSettingsRequest) error {
 	uid, _ := auth.UserID()
 	user, _ := strconv.ParseUint(string(uid), 10, 64)
@@ -12,6 +12,7 @@ import (
 	"testing"
 
 	"encore.dev/beta/auth"
+	"encore.dev/beta/errs"
 	"encore.dev/et"
 	"github.com/brianvoe/gofakeit/v6"
 	sAuth "github.com/brinestone/scholaris/core/auth"
@@ -26,7 +27,7 @@ var mainContext context.Context
 func mockEndpoints() {
 	et.MockEndpoint(permissions.CheckPermissionInternal, func(ctx context.Context, req dto.InternalRelationCheckRequest) (*dto.RelationCheckResponse, error) {
 		return &dto.RelationCheckResponse{
-			Allowed: true,
+			Allowed: req.Relation != dto.PNArchived,
 		}, nil
 	})
 	et.MockEndpoint(permissions.SetPermissions, func(ctx context.Context, req dto.UpdatePermissionsRequest) error {
@@ -129,6 +130,23 @@ func TestUpdateSettings(t *testing.T) {
 	}
 }
 
+func TestUpdateSettingsOfArchivedInstitution(t *testing.T) {
+	t.Cleanup(mockEndpoints)
+	et.MockEndpoint(permissions.CheckPermissionInternal, func(ctx context.Context, req dto.InternalRelationCheckRequest) (*dto.RelationCheckResponse, error) {
+		return &dto.RelationCheckResponse{
+			Allowed: true,
+		}, nil
+	})
+
+	err := settings.UpdateSettings(mainContext, dto.UpdateSettingsRequest{
+		Owner:        uint64(gofakeit.UintRange(1, 5000)),
+		OwnerType:    string(dto.PTInstitution),
+		CaptchaToken: randomString(30),
+		Updates:      makeUpdates(1),
+	})
+	assert.Equal(t, errs.FailedPrecondition, errs.Code(err))
+}
+
 func testUpdateUsingExistingSetting(t *testing.T, ctx context.Context, owner uint64, ownerType, key string) {
 	updates := makeUpdates(1)
 	updates[0].Key = key
@@ -4,6 +4,9 @@ import (
 	"context"
 
 	"encore.dev/pubsub"
+	"github.com/brinestone/scholaris/core/pkg"
+	"github.com/brinestone/scholaris/dto"
+	"github.com/brinestone/scholaris/tenants"
 )
 
 var _ = pubsub.NewSubscription(UpdatedSettings, "cache-purge", pubsub.SubscriptionConfig[SettingUpdatedEvent]{
@@ -12,3 +15,29 @@ var _ = pubsub.NewSubscription(UpdatedSettings, "cache-purge", pubsub.Subscripti
 		return nil
 	},
 })
+
+var _ = pubsub.NewSubscription(tenants.DeletedTenants, "purge-tenant-settings", pubsub.SubscriptionConfig[*tenants.TenantDeleted]{
+	Handler: purgeSettingsOnTenantDeleted,
+})
+
+var _ = pubsub.NewSubscription(tenants.RetriedDeletionSteps, "retry-purge-tenant-settings", pubsub.SubscriptionConfig[*tenants.TenantDeleted]{
+	Handler: purgeSettingsOnTenantDeleted,
+})
+
+func purgeSettingsOnTenantDeleted(ctx context.Context, msg *tenants.TenantDeleted) error {
+	if !msg.Includes(tenants.DeletionStepSettings) {
+		return nil
+	}
+
+	_, err := purgeOwnedSettings(ctx, dto.PTTenant, msg.Id)
+	return msg.Acknowledge(ctx, tenants.DeletionStepSettings, err)
+}
+
+var _ = pubsub.NewSubscription(pkg.DeletedInstitutions, "purge-institution-settings", pubsub.SubscriptionConfig[*pkg.InstitutionDeleted]{
+	Handler: purgeSettingsOnInstitutionDeleted,
+})
+
+func purgeSettingsOnInstitutionDeleted(ctx context.Context, msg *pkg.InstitutionDeleted) error {
+	_, err := purgeOwnedSettings(ctx, dto.PTInstitution, msg.Id)
+	return err
+}
@@ -5,6 +5,7 @@ import (
 
 	"encore.dev/storage/cache"
 	"github.com/brinestone/scholaris/core/pkg"
+	"github.com/brinestone/scholaris/dto"
 	"github.com/brinestone/scholaris/models"
 )
 
@@ -12,3 +13,8 @@ var tenantCache = cache.NewStructKeyspace[uint64, models.Tenant](pkg.CacheCluste
 	KeyPattern:    "tenants/:key",
 	DefaultExpiry: cache.ExpireIn(5 * time.Minute),
 })
+
+var hostnameCache = cache.NewStructKeyspace[string, dto.ResolveHostnameResponse](pkg.CacheCluster, cache.KeyspaceConfig{
+	KeyPattern:    "hostnames/:key",
+	DefaultExpiry: cache.ExpireIn(5 * time.Minute),
+})
@@ -0,0 +1,214 @@
+package tenants
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"encore.dev/storage/sqldb"
+	"github.com/brinestone/scholaris/core/permissions"
+	"github.com/brinestone/scholaris/dto"
+	"github.com/brinestone/scholaris/models"
+)
+
+// How long a tenant left without an owner is kept before it is deleted
+const tenantDeletionGracePeriod = time.Hour * 24 * 30
+
+// Hands the tenants owned by a deleted user over to their longest-standing member, preferring other owners, then
+// admins, then maintainers. Tenants where the user was the sole member are scheduled for deletion after a grace
+// period. The user's other memberships are removed.
+func cleanUpUserTenants(ctx context.Context, userId uint64, deletedAt time.Time) (summary *UserTenantsCleanedUp, err error) {
+	summary = &UserTenantsCleanedUp{
+		UserId:         userId,
+		PromotedOwners: make(map[uint64]uint64),
+		Timestamp:      time.Now(),
+	}
+
+	owned, err := permissions.ListObjectsInternal(ctx, dto.ListObjectsRequest{
+		Actor:    dto.IdentifierString(dto.PTUser, userId),
+		Relation: dto.PNOwner,
+		Type:     string(dto.PTTenant),
+	})
+	if err != nil {
+		return
+	}
+
+	for _, tenant := range owned.Relations[dto.PTTenant] {
+		if err = ensureTenantMembers(ctx, tenant); err != nil {
+			return
+		}
+
+		var successor *models.TenantMember
+		successor, err = findLongestStandingMember(ctx, tenant, userId)
+		if errors.Is(err, sqldb.ErrNoRows) {
+			if _, err = scheduleTenantDeletion(ctx, tenant, userId, deletedAt.Add(tenantDeletionGracePeriod), "owner account deleted"); err != nil {
+				return
+			}
+			summary.ScheduledForDeletion = append(summary.ScheduledForDeletion, tenant)
+			continue
+		} else if err != nil {
+			return
+		}
+
+		if err = promoteToOwner(ctx, tenant, userId, successor, deletedAt); err != nil {
+			return
+		}
+		summary.PromotedOwners[tenant] = successor.UserId
+	}
+
+	memberships, err := findMemberships(ctx, userId)
+	if err != nil {
+		return
+	}
+
+	for _, m := range memberships {
+		if m.Role == string(dto.PNOwner) {
+			continue
+		}
+
+		if err = removeTenantMember(ctx, m); err != nil {
+			return
+		}
+		summary.RemovedMemberships = append(summary.RemovedMemberships, m.Tenant)
+	}
+
+	return
+}
+
+// Makes a member the owner of a tenant in place of a deleted user
+func promoteToOwner(ctx context.Context, tenant, previousOwner uint64, successor *models.TenantMember, deletedAt time.Time) (err error) {
+	tx, err := tenantDb.Begin(ctx)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.Exec(ctx, "DELETE FROM tenant_members WHERE tenant = $1 AND user_id = $2;", tenant, previousOwner); err != nil {
+		return
+	}
+
+	if _, err = tx.Exec(ctx, "UPDATE tenant_members SET role = $1 WHERE tenant = $2 AND user_id = $3;", dto.PNOwner, tenant, successor.UserId); err != nil {
+		return
+	}
+
+	// Transfers started by the deleted owner can no longer be confirmed
+	if _, err = tx.Exec(ctx, "UPDATE tenant_ownership_transfers SET cancelled_at = CURRENT_TIMESTAMP WHERE tenant = $1 AND confirmed_at IS NULL AND cancelled_at IS NULL;", tenant); err != nil {
+		return
+	}
+
+	if err = permissions.ReplacePermissions(ctx, ownerPromotion(tenant, previousOwner, successor)); err != nil {
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		return
+	}
+
+	TransferredTenantOwnerships.Publish(ctx, &TenantOwnershipTransferred{
+		Tenant:        tenant,
+		PreviousOwner: previousOwner,
+		NewOwner:      successor.UserId,
+		Automatic:     true,
+		InitiatedAt:   deletedAt,
+		Timestamp:     time.Now(),
+	})
+	return
+}
+
+// Builds the tuple changes promoting a member in place of a deleted owner. A successor who already co-owns the tenant
+// keeps their tuple.
+func ownerPromotion(tenant, previousOwner uint64, successor *models.TenantMember) dto.ReplacePermissionsRequest {
+	target := dto.IdentifierString(dto.PTTenant, tenant)
+	ans := dto.ReplacePermissionsRequest{
+		Deletes: []dto.PermissionUpdate{
+			{Actor: dto.IdentifierString(dto.PTUser, previousOwner), Relation: dto.PNOwner, Target: target},
+		},
+	}
+
+	if successor.Role != string(dto.PNOwner) {
+		successorId := dto.IdentifierString(dto.PTUser, successor.UserId)
+		ans.Writes = append(ans.Writes, dto.PermissionUpdate{Actor: successorId, Relation: dto.PNOwner, Target: target})
+		ans.Deletes = append(ans.Deletes, dto.PermissionUpdate{Actor: successorId, Relation: dto.PermissionName(successor.Role), Target: target})
+	}
+	return ans
+}
+
+// Backfills the members of a tenant created before tenant_members existed, so that its successor can be found.
+func ensureTenantMembers(ctx context.Context, tenant uint64) (err error) {
+	var backfilled bool
+	var createdAt time.Time
+	if err = tenantDb.QueryRow(ctx, "SELECT members_backfilled, created_at FROM tenants WHERE id = $1;", tenant).Scan(&backfilled, &createdAt); err != nil || backfilled {
+		return
+	}
+	return backfillTenantMembers(ctx, tenant, createdAt)
+}
+
+func removeTenantMember(ctx context.Context, member *models.TenantMember) (err error) {
+	tx, err := tenantDb.Begin(ctx)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.Exec(ctx, "DELETE FROM tenant_members WHERE tenant = $1 AND user_id = $2;", member.Tenant, member.UserId); err != nil {
+		return
+	}
+
+	if err = permissions.DeletePermissions(ctx, dto.UpdatePermissionsRequest{
+		Updates: []dto.PermissionUpdate{
+			{
+				Actor:    dto.IdentifierString(dto.PTUser, member.UserId),
+				Relation: dto.PermissionName(member.Role),
+				Target:   dto.IdentifierString(dto.PTTenant, member.Tenant),
+			},
+		},
+	}); err != nil {
+		return
+	}
+
+	return tx.Commit()
+}
+
+const memberFields = "tenant,user_id,role,joined_at"
+
+// Finds the member who has held the highest role for the longest time
+func findLongestStandingMember(ctx context.Context, tenant, exclude uint64) (*models.TenantMember, error) {
+	query := fmt.Sprintf(`
+		SELECT %s FROM tenant_members
+		WHERE tenant = $1 AND user_id <> $2
+		ORDER BY CASE role WHEN $3 THEN 0 WHEN $4 THEN 1 ELSE 2 END, joined_at ASC, user_id ASC
+		LIMIT 1;
+	`, memberFields)
+	return scanTenantMember(tenantDb.QueryRow(ctx, query, tenant, exclude, dto.PNOwner, dto.PNAdmin))
+}
+
+func findMemberships(ctx context.Context, userId uint64) ([]*models.TenantMember, error) {
+	return queryTenantMembers(ctx, fmt.Sprintf("SELECT %s FROM tenant_members WHERE user_id = $1;", memberFields), userId)
+}
+
+func queryTenantMembers(ctx context.Context, query string, args ...any) (ans []*models.TenantMember, err error) {
+	rows, err := tenantDb.Query(ctx, query, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var m *models.TenantMember
+		if m, err = scanTenantMember(rows); err != nil {
+			return
+		}
+		ans = append(ans, m)
+	}
+	err = rows.Err()
+	return
+}
+
+func scanTenantMember(row rowScanner) (*models.TenantMember, error) {
+	m := new(models.TenantMember)
+	if err := row.Scan(&m.Tenant, &m.UserId, &m.Role, &m.JoinedAt); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
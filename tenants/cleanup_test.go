@@ -0,0 +1,80 @@
+package tenants_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"encore.dev/et"
+	"github.com/brinestone/scholaris/core/permissions"
+	"github.com/brinestone/scholaris/dto"
+	"github.com/brinestone/scholaris/tenants"
+	"github.com/stretchr/testify/assert"
+)
+
+// Makes the cleanup of mainUser find only the given tenant.
+func ownOnly(tenant uint64) {
+	et.MockEndpoint(permissions.ListObjectsInternal, func(ctx context.Context, req dto.ListObjectsRequest) (*dto.ListObjectsResponse, error) {
+		return &dto.ListObjectsResponse{Relations: map[dto.PermissionType][]uint64{dto.PTTenant: {tenant}}}, nil
+	})
+	et.MockEndpoint(permissions.ReplacePermissions, func(ctx context.Context, req dto.ReplacePermissionsRequest) error {
+		return nil
+	})
+}
+
+func TestCleanUpUserTenantsPromotesMaintainersWithoutAdmins(t *testing.T) {
+	t.Cleanup(mockEndpoints)
+	tenant := latestTenant(t)
+	now := time.Now()
+	if err := tenants.AddMember(context.TODO(), tenant, 7001, string(dto.PNMaintainer), now.Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := tenants.AddMember(context.TODO(), tenant, 7002, string(dto.PNMaintainer), now); err != nil {
+		t.Fatal(err)
+	}
+	ownOnly(tenant)
+
+	summary, err := tenants.CleanUpUserTenants(context.TODO(), mainUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, uint64(7001), summary.PromotedOwners[tenant])
+	assert.NotContains(t, summary.ScheduledForDeletion, tenant)
+
+	role, err := tenants.MemberRole(context.TODO(), tenant, 7001)
+	assert.Nil(t, err)
+	assert.Equal(t, string(dto.PNOwner), role)
+}
+
+func TestCleanUpUserTenantsPrefersAdmins(t *testing.T) {
+	t.Cleanup(mockEndpoints)
+	tenant := latestTenant(t)
+	now := time.Now()
+	if err := tenants.AddMember(context.TODO(), tenant, 7003, string(dto.PNMaintainer), now.Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := tenants.AddMember(context.TODO(), tenant, 7004, string(dto.PNAdmin), now); err != nil {
+		t.Fatal(err)
+	}
+	ownOnly(tenant)
+
+	summary, err := tenants.CleanUpUserTenants(context.TODO(), mainUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, uint64(7004), summary.PromotedOwners[tenant])
+}
+
+func TestCleanUpUserTenantsSchedulesDeletionOfSoleMemberTenants(t *testing.T) {
+	t.Cleanup(mockEndpoints)
+	tenant := latestTenant(t)
+	ownOnly(tenant)
+
+	summary, err := tenants.CleanUpUserTenants(context.TODO(), mainUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, summary.ScheduledForDeletion, tenant)
+	assert.Empty(t, summary.PromotedOwners)
+}
@@ -0,0 +1,15 @@
+package tenants
+
+import "encore.dev/cron"
+
+var _ = cron.NewJob("process-tenant-deletions", cron.JobConfig{
+	Title:    "Start, retry and finalize tenant deletions",
+	Schedule: "*/15 * * * *", // ! Every 15 minutes
+	Endpoint: ProcessTenantDeletions,
+})
+
+var _ = cron.NewJob("backfill-tenant-members", cron.JobConfig{
+	Title:    "Copy the members of legacy tenants from the authorization store",
+	Schedule: "*/10 * * * *", // ! Every 10 minutes
+	Endpoint: BackfillTenantMembers,
+})
@@ -0,0 +1,489 @@
+package tenants
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"encore.dev/beta/auth"
+	"encore.dev/beta/errs"
+	"encore.dev/rlog"
+	"encore.dev/storage/sqldb"
+	"github.com/brinestone/scholaris/core/permissions"
+	"github.com/brinestone/scholaris/dto"
+	"github.com/brinestone/scholaris/models"
+	"github.com/brinestone/scholaris/util"
+	"github.com/lib/pq"
+)
+
+const (
+	// How long a tenant deleted by its owner can be restored
+	tenantRestorePeriod = time.Hour * 24 * 7
+	// How long a deletion step may go unacknowledged before it is requested again
+	deletionStepRetryInterval = time.Minute * 30
+	maxDeletionStepAttempts   = 10
+)
+
+// Finds the progress of a tenant deletion
+//
+//encore:api auth method=GET path=/tenants/deletions/:id
+func FindTenantDeletion(ctx context.Context, id uint64) (ans *dto.TenantDeletion, err error) {
+	uid, _ := auth.UserID()
+
+	deletion, err := findTenantDeletionById(ctx, id)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		err = &util.ErrNotFound
+		return
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if strconv.FormatUint(deletion.RequestedBy, 10) != string(uid) {
+		var perm *dto.RelationCheckResponse
+		if perm, err = permissions.CheckPermissionInternal(ctx, dto.InternalRelationCheckRequest{
+			Actor:    dto.IdentifierString(dto.PTUser, uid),
+			Relation: dto.PNCanDelete,
+			Target:   dto.IdentifierString(dto.PTTenant, deletion.Tenant),
+		}); err != nil {
+			rlog.Error(util.MsgCallError, "err", err)
+			err = &util.ErrUnknown
+			return
+		} else if !perm.Allowed {
+			err = &util.ErrForbidden
+			return
+		}
+	}
+
+	steps, err := findTenantDeletionSteps(ctx, id)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = tenantDeletionToDto(deletion, steps)
+	return
+}
+
+// Restores a tenant awaiting deletion
+//
+//encore:api auth method=POST path=/tenants/:id/restore tag:perm_can_delete_tenant
+func RestoreTenant(ctx context.Context, id uint64) (err error) {
+	uid, _ := auth.UserID()
+	userId, _ := strconv.ParseUint(string(uid), 10, 64)
+
+	tx, err := tenantDb.Begin(ctx)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return &util.ErrUnknown
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(ctx, "UPDATE tenant_deletions SET status = $1, completed_at = CURRENT_TIMESTAMP WHERE tenant = $2 AND status = $3 AND restore_until > CURRENT_TIMESTAMP;", dto.TDSRestored, id, dto.TDSScheduled)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return &util.ErrUnknown
+	} else if res.RowsAffected() == 0 {
+		return &errs.Error{
+			Code:    errs.FailedPrecondition,
+			Message: "The tenant is not awaiting deletion or can no longer be restored",
+		}
+	}
+
+	if _, err = tx.Exec(ctx, "UPDATE tenants SET delete_after = NULL, deletion_reason = NULL WHERE id = $1;", id); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return &util.ErrUnknown
+	}
+
+	if err = tx.Commit(); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return &util.ErrUnknown
+	}
+
+	_, _ = tenantCache.Delete(ctx, id)
+	RestoredTenants.Publish(ctx, &TenantRestored{
+		Tenant:     id,
+		RestoredBy: userId,
+		Timestamp:  time.Now(),
+	})
+	return
+}
+
+// Starts the deletions whose restore period has elapsed, requests failed or unacknowledged steps again, fails the
+// deletions whose steps ran out of attempts and finalizes the deletions whose steps have all completed.
+//
+//encore:api private method=POST path=/tenants/deletions/process
+func ProcessTenantDeletions(ctx context.Context) (err error) {
+	due, err := queryTenantDeletions(ctx, fmt.Sprintf("SELECT %s FROM tenant_deletions WHERE status = $1 AND restore_until <= CURRENT_TIMESTAMP;", tenantDeletionFields), dto.TDSScheduled)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return &util.ErrUnknown
+	}
+
+	for _, d := range due {
+		if err = startTenantDeletion(ctx, d); err != nil {
+			rlog.Error("could not start tenant deletion", "deletion", d.Id, "err", err)
+			return &util.ErrUnknown
+		}
+	}
+
+	if err = failExhaustedDeletions(ctx); err != nil {
+		rlog.Error("could not fail exhausted tenant deletions", "err", err)
+		return &util.ErrUnknown
+	}
+
+	if err = retryStalledDeletionSteps(ctx); err != nil {
+		rlog.Error("could not retry tenant deletion steps", "err", err)
+		return &util.ErrUnknown
+	}
+
+	finished, err := queryTenantDeletions(ctx, fmt.Sprintf(`
+		SELECT %s FROM tenant_deletions d
+		WHERE
+			d.status = $1 AND NOT EXISTS (SELECT 1 FROM tenant_deletion_steps s WHERE s.deletion = d.id AND s.status <> $2);
+	`, tenantDeletionFields), dto.TDSInProgress, dto.TDSSDone)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return &util.ErrUnknown
+	}
+
+	for _, d := range finished {
+		if err = finalizeTenantDeletion(ctx, d.Id); err != nil {
+			rlog.Error("could not finalize tenant deletion", "deletion", d.Id, "err", err)
+			return &util.ErrUnknown
+		}
+	}
+	return
+}
+
+// Records the outcome of a deletion step, finalizing the deletion once every step is done
+func onDeletionStepAcknowledged(ctx context.Context, msg *TenantDeletionStepAcknowledged) (err error) {
+	status, lastError := dto.TDSSDone, sql.NullString{}
+	if len(msg.Error) > 0 {
+		status, lastError = dto.TDSSFailed, sql.NullString{String: msg.Error, Valid: true}
+		rlog.Warn("tenant deletion step failed", "deletion", msg.Deletion, "step", msg.Step, "err", msg.Error)
+	}
+
+	if _, err = tenantDb.Exec(ctx, "UPDATE tenant_deletion_steps SET status = $1, last_error = $2, updated_at = CURRENT_TIMESTAMP WHERE deletion = $3 AND step = $4 AND status <> $5;", status, lastError, msg.Deletion, msg.Step, dto.TDSSDone); err != nil {
+		return
+	}
+
+	var remaining uint
+	if err = tenantDb.QueryRow(ctx, "SELECT COUNT(step) FROM tenant_deletion_steps WHERE deletion = $1 AND status <> $2;", msg.Deletion, dto.TDSSDone).Scan(&remaining); err != nil || remaining > 0 {
+		return
+	}
+
+	return finalizeTenantDeletion(ctx, msg.Deletion)
+}
+
+// Marks a tenant for deletion. The tenant is hidden from listings and can be restored until deleteAfter, after
+// which its data is removed from every service. Scheduling the same tenant again keeps the earliest schedule.
+func scheduleTenantDeletion(ctx context.Context, tenant, requestedBy uint64, deleteAfter time.Time, reason string) (ans *models.TenantDeletion, err error) {
+	tx, err := tenantDb.Begin(ctx)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	var subscription uint64
+	if err = tx.QueryRow(ctx, `
+		UPDATE tenants SET
+			delete_after = COALESCE(delete_after, $2),
+			deletion_reason = COALESCE(deletion_reason, $3)
+		WHERE
+			id = $1
+		RETURNING subscription, delete_after;
+	`, tenant, deleteAfter, reason).Scan(&subscription, &deleteAfter); err != nil {
+		return
+	}
+
+	if _, err = tx.Exec(ctx, `
+		INSERT INTO tenant_deletions(tenant, subscription, requested_by, reason, restore_until)
+		VALUES ($1,$2,$3,$4,$5)
+		ON CONFLICT (tenant) WHERE status IN ('scheduled', 'in_progress') DO NOTHING;
+	`, tenant, subscription, requestedBy, reason, deleteAfter); err != nil {
+		return
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM tenant_deletions WHERE tenant = $1 AND status IN ($2, $3);", tenantDeletionFields)
+	if ans, err = scanTenantDeletion(tx.QueryRow(ctx, query, tenant, dto.TDSScheduled, dto.TDSInProgress)); err != nil {
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		return
+	}
+
+	_, _ = tenantCache.Delete(ctx, tenant)
+	evictTenantHostnames(ctx, tenant)
+	ScheduledTenantDeletions.Publish(ctx, &TenantDeletionScheduled{
+		Tenant:      tenant,
+		DeleteAfter: ans.RestoreUntil,
+		Reason:      ans.Reason,
+		Timestamp:   time.Now(),
+	})
+	return
+}
+
+func startTenantDeletion(ctx context.Context, deletion *models.TenantDeletion) (err error) {
+	tx, err := tenantDb.Begin(ctx)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(ctx, "UPDATE tenant_deletions SET status = $1, started_at = CURRENT_TIMESTAMP WHERE id = $2 AND status = $3;", dto.TDSInProgress, deletion.Id, dto.TDSScheduled)
+	if err != nil || res.RowsAffected() == 0 {
+		return
+	}
+
+	if _, err = tx.Exec(ctx, "INSERT INTO tenant_deletion_steps(deletion, step) SELECT $1, UNNEST($2::TEXT[]);", deletion.Id, pq.Array(deletionSteps)); err != nil {
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		return
+	}
+
+	_, err = DeletedTenants.Publish(ctx, &TenantDeleted{
+		Id:        deletion.Tenant,
+		Deletion:  deletion.Id,
+		DeletedAt: time.Now(),
+		Steps:     deletionSteps,
+	})
+	return
+}
+
+// Requests the steps that have failed, or gone unacknowledged for too long, again. Failed steps are retried on the
+// next run rather than after the retry interval.
+func retryStalledDeletionSteps(ctx context.Context) (err error) {
+	rows, err := tenantDb.Query(ctx, `
+		UPDATE tenant_deletion_steps s SET
+			attempts = s.attempts + 1,
+			status = $1,
+			updated_at = CURRENT_TIMESTAMP
+		FROM
+			tenant_deletions d
+		WHERE
+			d.id = s.deletion AND d.status = $2 AND s.attempts < $3 AND (s.status = $4 OR (s.status = $1 AND s.updated_at < $5))
+		RETURNING d.id, d.tenant, s.step;
+	`, dto.TDSSPending, dto.TDSInProgress, maxDeletionStepAttempts, dto.TDSSFailed, time.Now().Add(-deletionStepRetryInterval))
+	if err != nil {
+		return
+	}
+
+	retries := make(map[uint64]*TenantDeleted)
+	for rows.Next() {
+		var deletion, tenant uint64
+		var step string
+		if err = rows.Scan(&deletion, &tenant, &step); err != nil {
+			rows.Close()
+			return
+		}
+
+		msg, ok := retries[deletion]
+		if !ok {
+			msg = &TenantDeleted{Id: tenant, Deletion: deletion, DeletedAt: time.Now()}
+			retries[deletion] = msg
+		}
+		msg.Steps = append(msg.Steps, step)
+	}
+	rows.Close()
+
+	for _, msg := range retries {
+		rlog.Info("retrying tenant deletion steps", "deletion", msg.Deletion, "steps", msg.Steps)
+		if _, err = RetriedDeletionSteps.Publish(ctx, msg); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Marks the deletions with a step that failed, or went unacknowledged, on its last attempt as failed and raises an
+// alert for each of them
+func failExhaustedDeletions(ctx context.Context) (err error) {
+	rows, err := tenantDb.Query(ctx, `
+		UPDATE tenant_deletions d SET
+			status = $1,
+			completed_at = CURRENT_TIMESTAMP
+		WHERE
+			d.status = $2 AND EXISTS (
+				SELECT 1 FROM tenant_deletion_steps s
+				WHERE s.deletion = d.id AND s.attempts >= $3 AND (s.status = $4 OR (s.status = $5 AND s.updated_at < $6))
+			)
+		RETURNING d.id, d.tenant;
+	`, dto.TDSFailed, dto.TDSInProgress, maxDeletionStepAttempts, dto.TDSSFailed, dto.TDSSPending, time.Now().Add(-deletionStepRetryInterval))
+	if err != nil {
+		return
+	}
+
+	var failed []*TenantDeletionFailed
+	for rows.Next() {
+		msg := &TenantDeletionFailed{Steps: make(map[string]string), Timestamp: time.Now()}
+		if err = rows.Scan(&msg.Deletion, &msg.Tenant); err != nil {
+			rows.Close()
+			return
+		}
+		failed = append(failed, msg)
+	}
+	rows.Close()
+
+	for _, msg := range failed {
+		var steps []*models.TenantDeletionStep
+		if steps, err = findTenantDeletionSteps(ctx, msg.Deletion); err != nil {
+			return
+		}
+		for _, s := range steps {
+			if s.Status != string(dto.TDSSDone) {
+				msg.Steps[s.Step] = s.LastError.String
+			}
+		}
+
+		rlog.Error("tenant deletion failed", "deletion", msg.Deletion, "tenant", msg.Tenant, "steps", msg.Steps)
+		if _, err = FailedTenantDeletions.Publish(ctx, msg); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Removes the tenant itself once the other services have removed its data. A failed deletion is finalized as well
+// when its remaining steps complete late.
+func finalizeTenantDeletion(ctx context.Context, id uint64) (err error) {
+	tx, err := tenantDb.Begin(ctx)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	query := fmt.Sprintf("SELECT %s FROM tenant_deletions WHERE id = $1 AND status IN ($2, $3) FOR UPDATE;", tenantDeletionFields)
+	deletion, err := scanTenantDeletion(tx.QueryRow(ctx, query, id, dto.TDSInProgress, dto.TDSFailed))
+	if errors.Is(err, sqldb.ErrNoRows) {
+		// Already finalized
+		return nil
+	} else if err != nil {
+		return
+	}
+
+	if err = deleteTenantById(ctx, tx, deletion.Tenant); err != nil {
+		return
+	}
+
+	if _, err = tx.Exec(ctx, "DELETE FROM tenant_subscriptions WHERE id = $1;", deletion.Subscription); err != nil {
+		return
+	}
+
+	if _, err = tx.Exec(ctx, "UPDATE tenant_deletions SET status = $1, completed_at = CURRENT_TIMESTAMP WHERE id = $2;", dto.TDSCompleted, id); err != nil {
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		return
+	}
+
+	_, _ = tenantCache.Delete(ctx, deletion.Tenant)
+	if _, err = permissions.PurgeObjectTuples(ctx, dto.PurgeObjectTuplesRequest{
+		Objects: []string{
+			dto.IdentifierString(dto.PTTenant, deletion.Tenant),
+			dto.IdentifierString(dto.PTSubscription, deletion.Subscription),
+		},
+	}); err != nil {
+		rlog.Error("could not purge the tuples of a deleted tenant", "tenant", deletion.Tenant, "err", err)
+	}
+
+	CompletedTenantDeletions.Publish(ctx, &TenantDeletionCompleted{
+		Deletion:  deletion.Id,
+		Tenant:    deletion.Tenant,
+		Timestamp: time.Now(),
+	})
+	return
+}
+
+const tenantDeletionFields = "id,tenant,subscription,requested_by,reason,status,restore_until,created_at,started_at,completed_at"
+
+func findTenantDeletionById(ctx context.Context, id uint64) (*models.TenantDeletion, error) {
+	query := fmt.Sprintf("SELECT %s FROM tenant_deletions WHERE id = $1;", tenantDeletionFields)
+	return scanTenantDeletion(tenantDb.QueryRow(ctx, query, id))
+}
+
+func queryTenantDeletions(ctx context.Context, query string, args ...any) (ans []*models.TenantDeletion, err error) {
+	rows, err := tenantDb.Query(ctx, query, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var d *models.TenantDeletion
+		if d, err = scanTenantDeletion(rows); err != nil {
+			return
+		}
+		ans = append(ans, d)
+	}
+	err = rows.Err()
+	return
+}
+
+func findTenantDeletionSteps(ctx context.Context, deletion uint64) (ans []*models.TenantDeletionStep, err error) {
+	rows, err := tenantDb.Query(ctx, "SELECT deletion,step,status,attempts,last_error,updated_at FROM tenant_deletion_steps WHERE deletion = $1 ORDER BY step;", deletion)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		s := new(models.TenantDeletionStep)
+		if err = rows.Scan(&s.Deletion, &s.Step, &s.Status, &s.Attempts, &s.LastError, &s.UpdatedAt); err != nil {
+			return
+		}
+		ans = append(ans, s)
+	}
+	err = rows.Err()
+	return
+}
+
+func scanTenantDeletion(row rowScanner) (*models.TenantDeletion, error) {
+	d := new(models.TenantDeletion)
+	if err := row.Scan(&d.Id, &d.Tenant, &d.Subscription, &d.RequestedBy, &d.Reason, &d.Status, &d.RestoreUntil, &d.CreatedAt, &d.StartedAt, &d.CompletedAt); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func tenantDeletionToDto(d *models.TenantDeletion, steps []*models.TenantDeletionStep) *dto.TenantDeletion {
+	ans := &dto.TenantDeletion{
+		Id:           d.Id,
+		Tenant:       d.Tenant,
+		Status:       dto.TenantDeletionStatus(d.Status),
+		Reason:       d.Reason,
+		RequestedBy:  d.RequestedBy,
+		RestoreUntil: d.RestoreUntil,
+		CreatedAt:    d.CreatedAt,
+		Steps:        make([]dto.TenantDeletionStep, 0, len(steps)),
+	}
+	if d.StartedAt.Valid {
+		ans.StartedAt = &d.StartedAt.Time
+	}
+	if d.CompletedAt.Valid {
+		ans.CompletedAt = &d.CompletedAt.Time
+	}
+
+	for _, s := range steps {
+		step := dto.TenantDeletionStep{
+			Step:      s.Step,
+			Status:    dto.TenantDeletionStepStatus(s.Status),
+			Attempts:  s.Attempts,
+			UpdatedAt: s.UpdatedAt,
+		}
+		if s.LastError.Valid {
+			step.LastError = &s.LastError.String
+		}
+		ans.Steps = append(ans.Steps, step)
+	}
+	return ans
+}
@@ -0,0 +1,321 @@
+package tenants
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+
+	"encore.dev/beta/errs"
+	"encore.dev/rlog"
+	"encore.dev/storage/sqldb"
+	"encore.dev/storage/sqldb/sqlerr"
+	"github.com/brinestone/scholaris/dto"
+	"github.com/brinestone/scholaris/models"
+	"github.com/brinestone/scholaris/util"
+)
+
+// The label prepended to a hostname to form the name of its verification TXT record
+const domainVerificationLabel = "_scholaris-verification"
+
+// Looks up DNS TXT records. Satisfied by *net.Resolver.
+type TXTResolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+var dnsResolver TXTResolver = net.DefaultResolver
+
+// Resolves a custom hostname to the tenant which verified it
+//
+//encore:api public method=GET path=/tenants/hostnames/:hostname
+func ResolveHostname(ctx context.Context, hostname string) (ans *dto.ResolveHostnameResponse, err error) {
+	hostname = normalizeHostname(hostname)
+	if cached, err := hostnameCache.Get(ctx, hostname); err == nil {
+		return &cached, nil
+	}
+
+	ans = &dto.ResolveHostnameResponse{Hostname: hostname}
+	err = tenantDb.QueryRow(ctx, `
+		SELECT
+			t.id, t.name
+		FROM
+			tenant_domains d
+			JOIN tenants t ON t.id = d.tenant
+		WHERE
+			d.hostname = $1 AND d.verified_at IS NOT NULL AND t.delete_after IS NULL;
+	`, hostname).Scan(&ans.Tenant, &ans.Name)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		ans, err = nil, &util.ErrNotFound
+		return
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		ans, err = nil, &util.ErrUnknown
+		return
+	}
+
+	_ = hostnameCache.Set(ctx, hostname, *ans)
+	return
+}
+
+// Adds a custom domain to a tenant. The domain resolves to the tenant once verified.
+//
+//encore:api auth method=POST path=/tenants/:id/domains tag:can_update_tenant
+func AddTenantDomain(ctx context.Context, id uint64, req dto.NewTenantDomainRequest) (ans *dto.TenantDomain, err error) {
+	hostname := normalizeHostname(req.Hostname)
+
+	if claimed, err := hostnameVerifiedElsewhere(ctx, hostname, id); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return nil, &util.ErrUnknown
+	} else if claimed {
+		return nil, &errs.Error{
+			Code:    errs.AlreadyExists,
+			Message: "This domain is already in use",
+		}
+	}
+
+	token := make([]byte, 16)
+	_, _ = rand.Read(token)
+
+	query := fmt.Sprintf(`
+		INSERT INTO tenant_domains(tenant, hostname, verification_token)
+		VALUES ($1,$2,$3)
+		ON CONFLICT (tenant, hostname) DO NOTHING
+		RETURNING %s;
+	`, tenantDomainFields)
+	domain, err := scanTenantDomain(tenantDb.QueryRow(ctx, query, id, hostname, hex.EncodeToString(token)))
+	if errors.Is(err, sqldb.ErrNoRows) {
+		err = &errs.Error{
+			Code:    errs.AlreadyExists,
+			Message: "This domain has already been added",
+		}
+		return
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = &tenantDomainsToDto(domain)[0]
+	return
+}
+
+// Lists the custom domains of a tenant
+//
+//encore:api auth method=GET path=/tenants/:id/domains tag:can_update_tenant
+func FindTenantDomains(ctx context.Context, id uint64) (ans *dto.TenantDomainsResponse, err error) {
+	domains, err := findTenantDomains(ctx, id)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = &dto.TenantDomainsResponse{
+		Domains: tenantDomainsToDto(domains...),
+	}
+	return
+}
+
+// Verifies a custom domain by looking up its verification TXT record
+//
+//encore:api auth method=POST path=/tenants/:id/domains/:domain/verify tag:can_update_tenant
+func VerifyTenantDomain(ctx context.Context, id, domain uint64) (ans *dto.TenantDomain, err error) {
+	d, err := findTenantDomain(ctx, id, domain)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		err = &util.ErrNotFound
+		return
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if d.VerifiedAt.Valid {
+		ans = &tenantDomainsToDto(d)[0]
+		return
+	}
+
+	if claimed, err := hostnameVerifiedElsewhere(ctx, d.Hostname, id); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return nil, &util.ErrUnknown
+	} else if claimed {
+		return nil, &errs.Error{
+			Code:    errs.AlreadyExists,
+			Message: "This domain has been verified by another tenant",
+		}
+	}
+
+	verified, err := hasVerificationRecord(ctx, dnsResolver, d)
+	if err != nil {
+		rlog.Warn("domain verification lookup failed", "hostname", d.Hostname, "err", err)
+		err = &errs.Error{
+			Code:    errs.Unavailable,
+			Message: fmt.Sprintf("The TXT record %s could not be looked up. Please try again later", verificationRecordName(d.Hostname)),
+		}
+		return
+	}
+
+	query := fmt.Sprintf(`
+		UPDATE tenant_domains SET
+			last_checked_at = CURRENT_TIMESTAMP,
+			verified_at = CASE WHEN $3 THEN CURRENT_TIMESTAMP ELSE NULL END
+		WHERE
+			id = $1 AND tenant = $2
+		RETURNING %s;
+	`, tenantDomainFields)
+	if d, err = scanTenantDomain(tenantDb.QueryRow(ctx, query, domain, id, verified)); sqldb.ErrCode(err) == sqlerr.UniqueViolation {
+		// Another tenant verified the same hostname in the meantime
+		err = &errs.Error{
+			Code:    errs.AlreadyExists,
+			Message: "This domain has been verified by another tenant",
+		}
+		return
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if !verified {
+		err = &errs.Error{
+			Code:    errs.FailedPrecondition,
+			Message: fmt.Sprintf("The TXT record %s was not found. DNS changes can take a while to propagate", verificationRecordName(d.Hostname)),
+		}
+		return
+	}
+
+	_, _ = hostnameCache.Delete(ctx, d.Hostname)
+	ans = &tenantDomainsToDto(d)[0]
+	return
+}
+
+// Removes a custom domain from a tenant
+//
+//encore:api auth method=DELETE path=/tenants/:id/domains/:domain tag:can_update_tenant
+func RemoveTenantDomain(ctx context.Context, id, domain uint64) (err error) {
+	var hostname string
+	err = tenantDb.QueryRow(ctx, "DELETE FROM tenant_domains WHERE id = $1 AND tenant = $2 RETURNING hostname;", domain, id).Scan(&hostname)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		return &util.ErrNotFound
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return &util.ErrUnknown
+	}
+
+	_, _ = hostnameCache.Delete(ctx, hostname)
+	return
+}
+
+// Evicts the cached resolutions of a tenant's verified hostnames, after it was renamed or scheduled for deletion
+func evictTenantHostnames(ctx context.Context, tenant uint64) {
+	rows, err := tenantDb.Query(ctx, "SELECT hostname FROM tenant_domains WHERE tenant = $1 AND verified_at IS NOT NULL;", tenant)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var hostname string
+		if err = rows.Scan(&hostname); err != nil {
+			rlog.Error(util.MsgDbAccessError, "err", err)
+			return
+		}
+		_, _ = hostnameCache.Delete(ctx, hostname)
+	}
+}
+
+// Checks whether the domain's verification TXT record holds its token
+func hasVerificationRecord(ctx context.Context, resolver TXTResolver, domain *models.TenantDomain) (bool, error) {
+	records, err := resolver.LookupTXT(ctx, verificationRecordName(domain.Hostname))
+	if err != nil {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return slices.Contains(records, verificationRecordValue(domain.VerificationToken)), nil
+}
+
+func hostnameVerifiedElsewhere(ctx context.Context, hostname string, tenant uint64) (ans bool, err error) {
+	err = tenantDb.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM tenant_domains WHERE hostname = $1 AND tenant <> $2 AND verified_at IS NOT NULL);", hostname, tenant).Scan(&ans)
+	return
+}
+
+func verificationRecordName(hostname string) string {
+	return fmt.Sprintf("%s.%s", domainVerificationLabel, hostname)
+}
+
+func verificationRecordValue(token string) string {
+	return fmt.Sprintf("scholaris-verification=%s", token)
+}
+
+func normalizeHostname(hostname string) string {
+	return strings.ToLower(strings.TrimSuffix(strings.TrimSpace(hostname), "."))
+}
+
+const tenantDomainFields = "id,tenant,hostname,verification_token,verified_at,last_checked_at,created_at"
+
+func findTenantDomain(ctx context.Context, tenant, id uint64) (*models.TenantDomain, error) {
+	query := fmt.Sprintf("SELECT %s FROM tenant_domains WHERE id = $1 AND tenant = $2;", tenantDomainFields)
+	return scanTenantDomain(tenantDb.QueryRow(ctx, query, id, tenant))
+}
+
+func findTenantDomains(ctx context.Context, tenant uint64) (ans []*models.TenantDomain, err error) {
+	query := fmt.Sprintf("SELECT %s FROM tenant_domains WHERE tenant = $1 ORDER BY created_at;", tenantDomainFields)
+	rows, err := tenantDb.Query(ctx, query, tenant)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var d *models.TenantDomain
+		if d, err = scanTenantDomain(rows); err != nil {
+			return
+		}
+		ans = append(ans, d)
+	}
+	err = rows.Err()
+	return
+}
+
+func scanTenantDomain(row rowScanner) (*models.TenantDomain, error) {
+	d := new(models.TenantDomain)
+	if err := row.Scan(&d.Id, &d.Tenant, &d.Hostname, &d.VerificationToken, &d.VerifiedAt, &d.LastCheckedAt, &d.CreatedAt); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func tenantDomainsToDto(domains ...*models.TenantDomain) (ans []dto.TenantDomain) {
+	ans = make([]dto.TenantDomain, 0, len(domains))
+	for _, d := range domains {
+		v := dto.TenantDomain{
+			Id:        d.Id,
+			Hostname:  d.Hostname,
+			Verified:  d.VerifiedAt.Valid,
+			CreatedAt: d.CreatedAt,
+		}
+		if d.VerifiedAt.Valid {
+			v.VerifiedAt = &d.VerifiedAt.Time
+		} else {
+			v.Record = &dto.DomainVerificationRecord{
+				Type:  "TXT",
+				Name:  verificationRecordName(d.Hostname),
+				Value: verificationRecordValue(d.VerificationToken),
+			}
+		}
+		if d.LastCheckedAt.Valid {
+			v.LastCheckedAt = &d.LastCheckedAt.Time
+		}
+		ans = append(ans, v)
+	}
+	return
+}
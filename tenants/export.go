@@ -0,0 +1,45 @@
+package tenants
+
+import (
+	"context"
+
+	"encore.dev/rlog"
+	"github.com/brinestone/scholaris/dto"
+	"github.com/brinestone/scholaris/helpers"
+	"github.com/brinestone/scholaris/util"
+)
+
+// Exports a tenant's own records: its profile, subscription, members and custom domains. These are bounded, so they
+// are returned as files rather than staged.
+//
+//encore:api private method=GET path=/tenants/:id/export
+func ExportTenantData(ctx context.Context, id uint64) (ans *dto.ExportResponse, err error) {
+	ans = new(dto.ExportResponse)
+	queries := []struct{ path, query string }{
+		{"tenant.json", `
+			SELECT
+				t.id, t.name, t.logo, t.primary_color, t.secondary_color, t.contact_email, t.contact_phone, t.website,
+				t.address_street, t.address_city, t.address_region, t.address_postal_code, t.address_country,
+				t.created_at, t.updated_at,
+				p.name AS subscription_plan, s.next_billing_cycle, s.suspended, s.created_at AS subscribed_at
+			FROM
+				tenants t
+				JOIN tenant_subscriptions s ON s.id = t.subscription
+				LEFT JOIN subscription_plans p ON p.id = s.subscription_plan
+			WHERE
+				t.id = $1`},
+		{"members.json", "SELECT m.user_id, m.role, m.joined_at FROM tenant_members m WHERE m.tenant = $1 ORDER BY m.joined_at"},
+		{"domains.json", "SELECT d.hostname, d.verified_at, d.created_at FROM tenant_domains d WHERE d.tenant = $1 ORDER BY d.created_at"},
+	}
+
+	for _, q := range queries {
+		var content []byte
+		if err = tenantDb.QueryRow(ctx, helpers.JsonArrayQuery(q.query), id).Scan(&content); err != nil {
+			rlog.Error("could not export tenant", "tenant", id, "err", err)
+			ans, err = nil, &util.ErrUnknown
+			return
+		}
+		ans.Files = append(ans.Files, dto.ExportedFile{Path: q.path, Content: content})
+	}
+	return
+}
@@ -0,0 +1,56 @@
+package tenants
+
+import (
+	"context"
+	"time"
+)
+
+// UseResolver swaps the resolver used for domain verification and returns a function restoring the previous one.
+func UseResolver(r TXTResolver) (restore func()) {
+	prev := dnsResolver
+	dnsResolver = r
+	return func() { dnsResolver = prev }
+}
+
+// ResetMemberBackfill removes a tenant's members so that it looks like a tenant created before tenant_members existed.
+func ResetMemberBackfill(ctx context.Context, tenant uint64) (err error) {
+	if _, err = tenantDb.Exec(ctx, "DELETE FROM tenant_members WHERE tenant = $1;", tenant); err != nil {
+		return
+	}
+	_, err = tenantDb.Exec(ctx, "UPDATE tenants SET members_backfilled = false WHERE id = $1;", tenant)
+	return
+}
+
+// MemberRole returns the role of a tenant member, or an empty string when the user is not a member.
+func MemberRole(ctx context.Context, tenant, user uint64) (ans string, err error) {
+	err = tenantDb.QueryRow(ctx, "SELECT COALESCE((SELECT role FROM tenant_members WHERE tenant = $1 AND user_id = $2), '');", tenant, user).Scan(&ans)
+	return
+}
+
+// CleanUpUserTenants runs the clean up performed when a user account is deleted.
+func CleanUpUserTenants(ctx context.Context, user uint64) (*UserTenantsCleanedUp, error) {
+	return cleanUpUserTenants(ctx, user, time.Now())
+}
+
+// AddMember records a user as a member of a tenant with the given role and join date.
+func AddMember(ctx context.Context, tenant, user uint64, role string, joinedAt time.Time) (err error) {
+	_, err = tenantDb.Exec(ctx, "INSERT INTO tenant_members(tenant, user_id, role, joined_at) VALUES ($1,$2,$3,$4);", tenant, user, role, joinedAt)
+	return
+}
+
+// ExhaustDeletion makes a deletion look like it started and ran its steps out of attempts, the first step failing.
+func ExhaustDeletion(ctx context.Context, deletion uint64, lastError string) (err error) {
+	if _, err = tenantDb.Exec(ctx, "UPDATE tenant_deletions SET status = 'in_progress', started_at = CURRENT_TIMESTAMP WHERE id = $1;", deletion); err != nil {
+		return
+	}
+	for i, step := range deletionSteps {
+		status, stepError := "done", ""
+		if i == 0 {
+			status, stepError = "failed", lastError
+		}
+		if _, err = tenantDb.Exec(ctx, "INSERT INTO tenant_deletion_steps(deletion, step, status, attempts, last_error) VALUES ($1,$2,$3,$4,NULLIF($5, ''));", deletion, step, status, maxDeletionStepAttempts, stepError); err != nil {
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,429 @@
+package tenants
+
+import (
+	"context"
+	"crypto/hmac"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"encore.dev/beta/auth"
+	"encore.dev/beta/errs"
+	"encore.dev/rlog"
+	"encore.dev/storage/sqldb"
+	"github.com/brinestone/scholaris/core/notifier"
+	"github.com/brinestone/scholaris/core/permissions"
+	"github.com/brinestone/scholaris/core/users"
+	"github.com/brinestone/scholaris/dto"
+	"github.com/brinestone/scholaris/helpers"
+	"github.com/brinestone/scholaris/models"
+	"github.com/brinestone/scholaris/util"
+)
+
+const invitationValidity = time.Hour * 24 * 7
+
+var errInvalidInvitation = errs.Error{
+	Code:    errs.InvalidArgument,
+	Message: "The invitation is invalid or has expired",
+}
+
+// Invites a user to join a tenant
+//
+//encore:api auth method=POST path=/tenants/:id/invitations tag:can_modify_tenant_members
+func InviteMember(ctx context.Context, id uint64, req dto.NewTenantInvitationRequest) (ans *dto.TenantInvitation, err error) {
+	uid, _ := auth.UserID()
+	invitedBy, _ := strconv.ParseUint(string(uid), 10, 64)
+
+	tenant, err := findTenantById(ctx, id)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		err = &util.ErrNotFound
+		return
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if existing, err := users.FindUserByEmail(ctx, req.Email); err == nil {
+		var member bool
+		if member, err = tenantMemberExists(ctx, id, existing.Id); err != nil {
+			rlog.Error(util.MsgDbAccessError, "err", err)
+			return nil, &util.ErrUnknown
+		} else if member {
+			return nil, &errs.Error{
+				Code:    errs.AlreadyExists,
+				Message: "This user is already a member of the tenant",
+			}
+		}
+	} else if errs.Code(err) != errs.NotFound {
+		rlog.Error(util.MsgCallError, "err", err)
+		return nil, &util.ErrUnknown
+	}
+
+	pending, err := pendingInvitationExists(ctx, id, req.Email)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	} else if pending {
+		err = &errs.Error{
+			Code:    errs.AlreadyExists,
+			Message: "This email address already has a pending invitation",
+		}
+		return
+	}
+
+	tx, err := tenantDb.Begin(ctx)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+	defer tx.Rollback()
+
+	invitation, err := createInvitation(ctx, tx, id, req, invitedBy, time.Now().Add(invitationValidity))
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	token, hash := helpers.SignToken(secrets.TokenSigningKey, tokenPurposeInvitation, invitation.Id)
+	if _, err = tx.Exec(ctx, "UPDATE tenant_invitations SET token_hash = $1 WHERE id = $2;", hash, invitation.Id); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if err = notifier.SendEmail(ctx, invitationEmail(tenant, invitation, token)); err != nil {
+		rlog.Error(util.MsgCallError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = &invitationsToDto(invitation)[0]
+	return
+}
+
+// Lists the pending invitations of a tenant
+//
+//encore:api auth method=GET path=/tenants/:id/invitations tag:can_modify_tenant_members
+func FindPendingInvitations(ctx context.Context, id uint64) (ans *dto.TenantInvitationsResponse, err error) {
+	invitations, err := findPendingInvitations(ctx, id)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = &dto.TenantInvitationsResponse{
+		Invitations: invitationsToDto(invitations...),
+	}
+	return
+}
+
+// Revokes a pending invitation
+//
+//encore:api auth method=DELETE path=/tenants/:id/invitations/:invitation tag:can_modify_tenant_members
+func RevokeInvitation(ctx context.Context, id, invitation uint64) (err error) {
+	res, err := tenantDb.Exec(ctx, "UPDATE tenant_invitations SET revoked_at = CURRENT_TIMESTAMP WHERE id = $1 AND tenant = $2 AND accepted_at IS NULL AND revoked_at IS NULL;", invitation, id)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if res.RowsAffected() == 0 {
+		err = &util.ErrNotFound
+	}
+	return
+}
+
+// Accepts an invitation to join a tenant, creating the invitee's account if they do not have one
+//
+//encore:api public method=POST path=/tenants/invitations/accept tag:needs_captcha_ver
+func AcceptInvitation(ctx context.Context, req dto.AcceptTenantInvitationRequest) (ans *dto.AcceptTenantInvitationResponse, err error) {
+	id, hash, ok := helpers.ParseToken(secrets.TokenSigningKey, tokenPurposeInvitation, req.Token)
+	if !ok {
+		err = &errInvalidInvitation
+		return
+	}
+
+	tx, err := tenantDb.Begin(ctx)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+	defer tx.Rollback()
+
+	invitation, err := findPendingInvitationForUpdate(ctx, tx, id)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		err = &errInvalidInvitation
+		return
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if !hmac.Equal([]byte(hash), []byte(invitation.TokenHash)) || time.Now().After(invitation.ExpiresAt) {
+		err = &errInvalidInvitation
+		return
+	}
+
+	ans = &dto.AcceptTenantInvitationResponse{
+		Tenant: invitation.Tenant,
+		Role:   dto.PermissionName(invitation.Role),
+	}
+
+	userId, created, err := resolveInvitee(ctx, invitation, req)
+	if err != nil {
+		return
+	}
+	ans.AccountCreated = created
+
+	// Accounts belong to the users service and cannot join this transaction, so an account created for the invitee is
+	// removed again when the invitation cannot be accepted.
+	if created {
+		defer func() {
+			if err == nil {
+				return
+			}
+			ans = nil
+			if err := users.DeleteInternal(ctx, userId); err != nil {
+				rlog.Error(util.MsgCallError, "err", err)
+			}
+		}()
+	}
+
+	member, err := tenantMemberExists(ctx, invitation.Tenant, userId)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	} else if member {
+		err = &errs.Error{
+			Code:    errs.AlreadyExists,
+			Message: "You are already a member of this tenant",
+		}
+		return
+	}
+
+	if err = createTenantMember(ctx, tx, invitation.Tenant, userId, dto.PermissionName(invitation.Role)); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if _, err = tx.Exec(ctx, "UPDATE tenant_invitations SET accepted_at = CURRENT_TIMESTAMP, accepted_by = $1 WHERE id = $2;", userId, invitation.Id); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if err = permissions.SetPermissions(ctx, dto.UpdatePermissionsRequest{
+		Updates: []dto.PermissionUpdate{
+			dto.NewPermissionUpdate[uint64](dto.IdentifierString(dto.PTUser, userId), dto.PermissionName(invitation.Role), dto.IdentifierString(dto.PTTenant, invitation.Tenant)),
+		},
+	}); err != nil {
+		rlog.Error(util.MsgCallError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	JoinedTenantMembers.Publish(ctx, &TenantMemberJoined{
+		Tenant:    invitation.Tenant,
+		UserId:    userId,
+		Role:      invitation.Role,
+		InvitedBy: invitation.InvitedBy,
+		Timestamp: time.Now(),
+	})
+	return
+}
+
+// Finds the user accepting an invitation. Signed in users must have verified the invited email address while anonymous
+// invitees get an account created for them, unless one already exists.
+func resolveInvitee(ctx context.Context, invitation *models.TenantInvitation, req dto.AcceptTenantInvitationRequest) (userId uint64, created bool, err error) {
+	if uid, authed := auth.UserID(); authed {
+		userId, _ = strconv.ParseUint(string(uid), 10, 64)
+		var user *models.User
+		if user, err = users.FindUserById(ctx, userId); err != nil {
+			rlog.Error(util.MsgCallError, "err", err)
+			err = &util.ErrUnknown
+			return
+		}
+
+		if _, owned := helpers.Find(user.Emails, func(e models.UserEmailAddress) bool {
+			return e.Verified && strings.EqualFold(e.Email, invitation.Email)
+		}); !owned {
+			err = &errs.Error{
+				Code:    errs.PermissionDenied,
+				Message: "This invitation was sent to an email address not verified on your account",
+			}
+		}
+		return
+	}
+
+	if _, err = users.FindUserByEmail(ctx, invitation.Email); err == nil {
+		err = &errs.Error{
+			Code:    errs.FailedPrecondition,
+			Message: "An account already exists for this email address. Sign in to accept the invitation",
+		}
+		return
+	} else if errs.Code(err) != errs.NotFound {
+		rlog.Error(util.MsgCallError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if req.Account == nil {
+		err = &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: "The account field is required to create your account",
+		}
+		return
+	}
+
+	res, err := users.NewInternalUser(ctx, dto.NewInternalUserRequest{
+		FirstName:       req.Account.FirstName,
+		LastName:        req.Account.LastName,
+		Email:           invitation.Email,
+		Dob:             req.Account.Dob,
+		Password:        req.Account.Password,
+		ConfirmPassword: req.Account.ConfirmPassword,
+		Phone:           req.Account.Phone,
+		Gender:          req.Account.Gender,
+		CaptchaToken:    req.CaptchaToken,
+	})
+	if err != nil {
+		if errs.Code(err) == errs.Unknown {
+			rlog.Error(util.MsgCallError, "err", err)
+			err = &util.ErrUnknown
+		}
+		return
+	}
+
+	userId, created = res.UserId, true
+	return
+}
+
+func invitationEmail(tenant *models.Tenant, invitation *models.TenantInvitation, token string) dto.SendEmailRequest {
+	link := fmt.Sprintf("%s/invitations/accept?token=%s", strings.TrimSuffix(secrets.FrontendUrl, "/"), token)
+	return dto.SendEmailRequest{
+		To:      invitation.Email,
+		Subject: fmt.Sprintf("You have been invited to join %s", tenant.Name),
+		Body: fmt.Sprintf(
+			"<p>You have been invited to join <strong>%s</strong> as %s.</p><p><a href=\"%s\">Accept the invitation</a></p><p>This invitation expires on %s.</p>",
+			tenant.Name, invitation.Role, link, invitation.ExpiresAt.Format(time.RFC1123),
+		),
+		IsContentHtml: true,
+	}
+}
+
+const invitationFields = "id,tenant,email,role,token_hash,invited_by,expires_at,created_at,accepted_at,accepted_by,revoked_at"
+
+func createInvitation(ctx context.Context, tx *sqldb.Tx, tenant uint64, req dto.NewTenantInvitationRequest, invitedBy uint64, expiresAt time.Time) (*models.TenantInvitation, error) {
+	// Expired invitations still hold the pending slot for the email address
+	if _, err := tx.Exec(ctx, "UPDATE tenant_invitations SET revoked_at = CURRENT_TIMESTAMP WHERE tenant = $1 AND LOWER(email) = LOWER($2) AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at <= CURRENT_TIMESTAMP;", tenant, req.Email); err != nil {
+		return nil, err
+	}
+
+	query := fmt.Sprintf(`
+		INSERT INTO tenant_invitations(tenant, email, role, token_hash, invited_by, expires_at)
+		VALUES ($1,$2,$3,'',$4,$5)
+		RETURNING %s;
+	`, invitationFields)
+	return scanInvitation(tx.QueryRow(ctx, query, tenant, req.Email, req.Role, invitedBy, expiresAt))
+}
+
+func findPendingInvitationForUpdate(ctx context.Context, tx *sqldb.Tx, id uint64) (*models.TenantInvitation, error) {
+	query := fmt.Sprintf("SELECT %s FROM tenant_invitations WHERE id = $1 AND accepted_at IS NULL AND revoked_at IS NULL FOR UPDATE;", invitationFields)
+	return scanInvitation(tx.QueryRow(ctx, query, id))
+}
+
+func findPendingInvitations(ctx context.Context, tenant uint64) (ans []*models.TenantInvitation, err error) {
+	query := fmt.Sprintf(`
+		SELECT
+			%s
+		FROM
+			tenant_invitations
+		WHERE
+			tenant = $1 AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+		ORDER BY
+			created_at DESC;
+	`, invitationFields)
+
+	rows, err := tenantDb.Query(ctx, query, tenant)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var i *models.TenantInvitation
+		if i, err = scanInvitation(rows); err != nil {
+			return
+		}
+		ans = append(ans, i)
+	}
+	err = rows.Err()
+	return
+}
+
+func pendingInvitationExists(ctx context.Context, tenant uint64, email string) (ans bool, err error) {
+	err = tenantDb.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM tenant_invitations WHERE tenant = $1 AND LOWER(email) = LOWER($2) AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > CURRENT_TIMESTAMP);", tenant, email).Scan(&ans)
+	return
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanInvitation(row rowScanner) (*models.TenantInvitation, error) {
+	i := new(models.TenantInvitation)
+	if err := row.Scan(&i.Id, &i.Tenant, &i.Email, &i.Role, &i.TokenHash, &i.InvitedBy, &i.ExpiresAt, &i.CreatedAt, &i.AcceptedAt, &i.AcceptedBy, &i.RevokedAt); err != nil {
+		return nil, err
+	}
+	return i, nil
+}
+
+func invitationsToDto(invitations ...*models.TenantInvitation) (ans []dto.TenantInvitation) {
+	ans = make([]dto.TenantInvitation, 0, len(invitations))
+	for _, i := range invitations {
+		ans = append(ans, dto.TenantInvitation{
+			Id:        i.Id,
+			Tenant:    i.Tenant,
+			Email:     i.Email,
+			Role:      dto.PermissionName(i.Role),
+			InvitedBy: i.InvitedBy,
+			ExpiresAt: i.ExpiresAt,
+			CreatedAt: i.CreatedAt,
+		})
+	}
+	return
+}
+
+func createTenantMember(ctx context.Context, tx *sqldb.Tx, tenant, user uint64, role dto.PermissionName) (err error) {
+	_, err = tx.Exec(ctx, "INSERT INTO tenant_members(tenant, user_id, role) VALUES ($1,$2,$3);", tenant, user, role)
+	return
+}
+
+func tenantMemberExists(ctx context.Context, tenant, user uint64) (ans bool, err error) {
+	err = tenantDb.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM tenant_members WHERE tenant = $1 AND user_id = $2);", tenant, user).Scan(&ans)
+	return
+}
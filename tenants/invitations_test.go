@@ -0,0 +1,186 @@
+package tenants_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"testing"
+
+	"encore.dev/beta/auth"
+	"encore.dev/beta/errs"
+	"encore.dev/et"
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/brinestone/scholaris/core/notifier"
+	"github.com/brinestone/scholaris/core/permissions"
+	"github.com/brinestone/scholaris/core/users"
+	"github.com/brinestone/scholaris/dto"
+	"github.com/brinestone/scholaris/models"
+	"github.com/brinestone/scholaris/tenants"
+	"github.com/stretchr/testify/assert"
+)
+
+var invitationTokenPattern = regexp.MustCompile(`token=([^"]+)`)
+
+func latestTenant(t *testing.T) uint64 {
+	if err := makeTenant(); err != nil {
+		t.Fatal(err)
+	}
+	res, err := tenants.Lookup(mainContext, dto.CursorBasedPaginationParams{Size: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res.Tenants[0].Id
+}
+
+// Invites an email address to a tenant and returns the token sent to it.
+func invite(t *testing.T, tenant uint64, email string, role dto.PermissionName) (token string) {
+	et.MockEndpoint(users.FindUserByEmail, func(ctx context.Context, email string) (*models.User, error) {
+		return nil, &errs.Error{Code: errs.NotFound}
+	})
+	et.MockEndpoint(notifier.SendEmail, func(ctx context.Context, req dto.SendEmailRequest) error {
+		if m := invitationTokenPattern.FindStringSubmatch(req.Body); m != nil {
+			token = m[1]
+		}
+		return nil
+	})
+
+	_, err := tenants.InviteMember(mainContext, tenant, dto.NewTenantInvitationRequest{Email: email, Role: role})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(token) == 0 {
+		t.Fatal("no invitation token was sent")
+	}
+	return
+}
+
+func TestAcceptInvitation(t *testing.T) {
+	t.Cleanup(mockEndpoints)
+	tenant := latestTenant(t)
+	email := gofakeit.Email()
+	token := invite(t, tenant, email, dto.PNMaintainer)
+
+	invitee := uint64(gofakeit.UintRange(2000, 3000))
+	et.MockEndpoint(users.FindUserById, func(ctx context.Context, id uint64) (*models.User, error) {
+		return &models.User{Id: id, Emails: []models.UserEmailAddress{{Email: email, Verified: true}}}, nil
+	})
+	ctx := auth.WithContext(context.TODO(), auth.UID(fmt.Sprint(invitee)), &dto.AuthClaims{Sub: invitee})
+
+	res, err := tenants.AcceptInvitation(ctx, dto.AcceptTenantInvitationRequest{Token: token, CaptchaToken: randomString(30)})
+	if assert.Nil(t, err) {
+		assert.Equal(t, tenant, res.Tenant)
+		assert.Equal(t, dto.PNMaintainer, res.Role)
+		assert.False(t, res.AccountCreated)
+	}
+
+	role, err := tenants.MemberRole(mainContext, tenant, invitee)
+	assert.Nil(t, err)
+	assert.Equal(t, string(dto.PNMaintainer), role)
+
+	// Invitations are single-use.
+	_, err = tenants.AcceptInvitation(ctx, dto.AcceptTenantInvitationRequest{Token: token, CaptchaToken: randomString(30)})
+	assert.Equal(t, errs.InvalidArgument, errs.Code(err))
+}
+
+func TestAcceptInvitationRejectsTamperedTokens(t *testing.T) {
+	t.Cleanup(mockEndpoints)
+	token := invite(t, latestTenant(t), gofakeit.Email(), dto.PNAdmin)
+
+	_, err := tenants.AcceptInvitation(context.TODO(), dto.AcceptTenantInvitationRequest{Token: token + "x", CaptchaToken: randomString(30)})
+	assert.Equal(t, errs.InvalidArgument, errs.Code(err))
+}
+
+func TestAcceptInvitationRejectsOtherEmailAddresses(t *testing.T) {
+	t.Cleanup(mockEndpoints)
+	token := invite(t, latestTenant(t), gofakeit.Email(), dto.PNAdmin)
+
+	et.MockEndpoint(users.FindUserById, func(ctx context.Context, id uint64) (*models.User, error) {
+		return &models.User{Id: id, Emails: []models.UserEmailAddress{{Email: gofakeit.Email(), Verified: true}}}, nil
+	})
+	ctx := auth.WithContext(context.TODO(), "2999", &dto.AuthClaims{Sub: 2999})
+
+	_, err := tenants.AcceptInvitation(ctx, dto.AcceptTenantInvitationRequest{Token: token, CaptchaToken: randomString(30)})
+	assert.Equal(t, errs.PermissionDenied, errs.Code(err))
+}
+
+func TestAcceptInvitationRejectsUnverifiedEmailAddresses(t *testing.T) {
+	t.Cleanup(mockEndpoints)
+	email := gofakeit.Email()
+	token := invite(t, latestTenant(t), email, dto.PNAdmin)
+
+	et.MockEndpoint(users.FindUserById, func(ctx context.Context, id uint64) (*models.User, error) {
+		return &models.User{Id: id, Emails: []models.UserEmailAddress{{Email: email, Verified: false}}}, nil
+	})
+	ctx := auth.WithContext(context.TODO(), "2998", &dto.AuthClaims{Sub: 2998})
+
+	_, err := tenants.AcceptInvitation(ctx, dto.AcceptTenantInvitationRequest{Token: token, CaptchaToken: randomString(30)})
+	assert.Equal(t, errs.PermissionDenied, errs.Code(err))
+}
+
+func TestAcceptInvitationRemovesTheCreatedAccountOnFailure(t *testing.T) {
+	t.Cleanup(mockEndpoints)
+	tenant := latestTenant(t)
+	token := invite(t, tenant, gofakeit.Email(), dto.PNAdmin)
+
+	var deleted uint64
+	et.MockEndpoint(users.NewInternalUser, func(ctx context.Context, req dto.NewInternalUserRequest) (*dto.NewUserResponse, error) {
+		return &dto.NewUserResponse{UserId: 3001}, nil
+	})
+	et.MockEndpoint(users.DeleteInternal, func(ctx context.Context, id uint64) error {
+		deleted = id
+		return nil
+	})
+	et.MockEndpoint(permissions.SetPermissions, func(ctx context.Context, req dto.UpdatePermissionsRequest) error {
+		return errors.New("store unavailable")
+	})
+
+	_, err := tenants.AcceptInvitation(context.TODO(), dto.AcceptTenantInvitationRequest{
+		Token:        token,
+		CaptchaToken: randomString(30),
+		Account: &dto.InvitedAccount{
+			FirstName:       gofakeit.FirstName(),
+			Dob:             "2000/01/01",
+			Password:        "P@ssw0rd!",
+			ConfirmPassword: "P@ssw0rd!",
+		},
+	})
+	assert.NotNil(t, err)
+	assert.Equal(t, uint64(3001), deleted)
+
+	role, err := tenants.MemberRole(mainContext, tenant, 3001)
+	assert.Nil(t, err)
+	assert.Empty(t, role)
+}
+
+func TestBackfillTenantMembers(t *testing.T) {
+	t.Cleanup(mockEndpoints)
+	tenant := latestTenant(t)
+	if err := tenants.ResetMemberBackfill(mainContext, tenant); err != nil {
+		t.Fatal(err)
+	}
+
+	et.MockEndpoint(permissions.ListUsersInternal, func(ctx context.Context, req dto.ListUsersRequest) (*dto.ListUsersResponse, error) {
+		ans := &dto.ListUsersResponse{Users: []uint64{}}
+		if req.Target != dto.IdentifierString(dto.PTTenant, tenant) {
+			return ans, nil
+		}
+		switch req.Relation {
+		case dto.PNOwner:
+			ans.Users = []uint64{4001}
+		case dto.PNAdmin:
+			ans.Users = []uint64{4001, 4002}
+		case dto.PNMaintainer:
+			ans.Users = []uint64{4003}
+		}
+		return ans, nil
+	})
+
+	assert.Nil(t, tenants.BackfillTenantMembers(mainContext))
+
+	for user, expected := range map[uint64]dto.PermissionName{4001: dto.PNOwner, 4002: dto.PNAdmin, 4003: dto.PNMaintainer} {
+		role, err := tenants.MemberRole(mainContext, tenant, user)
+		assert.Nil(t, err)
+		assert.Equal(t, string(expected), role)
+	}
+}
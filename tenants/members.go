@@ -0,0 +1,109 @@
+package tenants
+
+import (
+	"context"
+	"time"
+
+	"encore.dev/rlog"
+	"github.com/brinestone/scholaris/core/permissions"
+	"github.com/brinestone/scholaris/dto"
+	"github.com/brinestone/scholaris/util"
+)
+
+const memberBackfillBatchSize = 50
+
+// The member roles of a tenant, from the highest to the lowest.
+var memberRoles = []dto.PermissionName{dto.PNOwner, dto.PNAdmin, dto.PNMaintainer}
+
+// Copies the roles of tenants created before tenant_members existed from the authorization store
+//
+//encore:api private method=POST path=/tenants/members/backfill
+func BackfillTenantMembers(ctx context.Context) (err error) {
+	tenants, err := findTenantsAwaitingMemberBackfill(ctx)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return
+	}
+
+	for _, t := range tenants {
+		if err = backfillTenantMembers(ctx, t.id, t.createdAt); err != nil {
+			rlog.Error("could not backfill tenant members", "tenant", t.id, "err", err)
+			return
+		}
+	}
+	return
+}
+
+type memberBackfill struct {
+	id        uint64
+	createdAt time.Time
+}
+
+func findTenantsAwaitingMemberBackfill(ctx context.Context) (ans []memberBackfill, err error) {
+	rows, err := tenantDb.Query(ctx, "SELECT id, created_at FROM tenants WHERE NOT members_backfilled ORDER BY id LIMIT $1;", memberBackfillBatchSize)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t memberBackfill
+		if err = rows.Scan(&t.id, &t.createdAt); err != nil {
+			return
+		}
+		ans = append(ans, t)
+	}
+	err = rows.Err()
+	return
+}
+
+func backfillTenantMembers(ctx context.Context, tenant uint64, createdAt time.Time) (err error) {
+	usersByRole := make(map[dto.PermissionName][]uint64)
+	for _, role := range memberRoles {
+		var res *dto.ListUsersResponse
+		if res, err = permissions.ListUsersInternal(ctx, dto.ListUsersRequest{
+			Target:   dto.IdentifierString(dto.PTTenant, tenant),
+			Relation: role,
+		}); err != nil {
+			return
+		}
+		usersByRole[role] = res.Users
+	}
+
+	tx, err := tenantDb.Begin(ctx)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	// Nothing tells when legacy members joined, so they all join with the tenant and the owner comes first.
+	for user, role := range highestMemberRoles(usersByRole) {
+		joinedAt := createdAt
+		if role != dto.PNOwner {
+			joinedAt = createdAt.Add(time.Second)
+		}
+		if _, err = tx.Exec(ctx, "INSERT INTO tenant_members(tenant, user_id, role, joined_at) VALUES ($1,$2,$3,$4) ON CONFLICT (tenant, user_id) DO NOTHING;", tenant, user, role, joinedAt); err != nil {
+			return
+		}
+	}
+
+	if _, err = tx.Exec(ctx, "UPDATE tenants SET members_backfilled = true WHERE id = $1;", tenant); err != nil {
+		return
+	}
+
+	err = tx.Commit()
+	return
+}
+
+// Keeps the highest role of every user holding several roles on a tenant.
+func highestMemberRoles(usersByRole map[dto.PermissionName][]uint64) map[uint64]dto.PermissionName {
+	ans := make(map[uint64]dto.PermissionName)
+	for _, role := range memberRoles {
+		for _, user := range usersByRole[role] {
+			if _, ok := ans[user]; !ok {
+				ans[user] = role
+			}
+		}
+	}
+	return ans
+}
@@ -48,6 +48,56 @@ func CanViewTenant(req middleware.Request, next middleware.Next) (res middleware
 	return
 }
 
+//encore:middleware target=tag:can_modify_tenant_members
+func CanModifyMembers(req middleware.Request, next middleware.Next) middleware.Response {
+	return checkTenantPermission(req, next, dto.PNCanModifyMembers)
+}
+
+//encore:middleware target=tag:can_update_tenant
+func CanUpdateTenant(req middleware.Request, next middleware.Next) middleware.Response {
+	return checkTenantPermission(req, next, dto.PNCanUpdate)
+}
+
+//encore:middleware target=tag:perm_can_delete_tenant
+func CanDeleteTenant(req middleware.Request, next middleware.Next) middleware.Response {
+	return checkTenantPermission(req, next, dto.PNCanDelete)
+}
+
+//encore:middleware target=tag:can_change_tenant_owner
+func CanChangeOwner(req middleware.Request, next middleware.Next) middleware.Response {
+	return checkTenantPermission(req, next, dto.PNCanChangeOwner)
+}
+
+// Checks that the caller holds the relation on the tenant identified by the "id" path parameter
+func checkTenantPermission(req middleware.Request, next middleware.Next, relation dto.PermissionName) middleware.Response {
+	uid, authed := eAuth.UserID()
+	if !authed {
+		return middleware.Response{
+			Err: &util.ErrUnauthorized,
+		}
+	}
+
+	perm, err := permissions.CheckPermissionInternal(req.Context(), dto.InternalRelationCheckRequest{
+		Actor:    dto.IdentifierString(dto.PTUser, uid),
+		Relation: relation,
+		Target:   dto.IdentifierString(dto.PTTenant, req.Data().PathParams.Get("id")),
+	})
+	if err != nil {
+		rlog.Error(util.MsgCallError, "err", err)
+		return middleware.Response{
+			Err: &util.ErrUnknown,
+		}
+	}
+
+	if !perm.Allowed {
+		return middleware.Response{
+			Err: &util.ErrForbidden,
+		}
+	}
+
+	return next(req)
+}
+
 //encore:middleware target=tag:needs_captcha_ver
 func VerifyCaptcha(req middleware.Request, next middleware.Next) middleware.Response {
 	p, ok := req.Data().Payload.(models.CaptchaVerifiable)
@@ -0,0 +1,30 @@
+ALTER TABLE tenants
+ADD COLUMN logo TEXT,
+ADD COLUMN primary_color VARCHAR(7),
+ADD COLUMN secondary_color VARCHAR(7),
+ADD COLUMN contact_email TEXT,
+ADD COLUMN contact_phone TEXT,
+ADD COLUMN website TEXT,
+ADD COLUMN address_street TEXT,
+ADD COLUMN address_city TEXT,
+ADD COLUMN address_region TEXT,
+ADD COLUMN address_postal_code TEXT,
+ADD COLUMN address_country VARCHAR(2);
+
+CREATE TABLE
+    tenant_domains (
+        id BIGSERIAL PRIMARY KEY,
+        tenant BIGINT REFERENCES tenants (id) ON DELETE CASCADE,
+        hostname TEXT NOT NULL,
+        verification_token VARCHAR(64) NOT NULL,
+        verified_at TIMESTAMP WITHOUT TIME ZONE,
+        last_checked_at TIMESTAMP WITHOUT TIME ZONE,
+        created_at TIMESTAMP WITHOUT TIME ZONE DEFAULT CURRENT_TIMESTAMP
+    );
+
+CREATE UNIQUE INDEX idx_tenant_domains_tenant_hostname ON tenant_domains (tenant, hostname);
+
+-- A hostname can be claimed by several tenants but only resolves to the one that verified it
+CREATE UNIQUE INDEX idx_tenant_domains_verified_hostname ON tenant_domains (hostname)
+WHERE
+    verified_at IS NOT NULL;
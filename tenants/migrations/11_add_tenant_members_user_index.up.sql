@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS idx_tenant_members_user ON tenant_members (user_id);
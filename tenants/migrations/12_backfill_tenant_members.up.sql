@@ -0,0 +1,21 @@
+-- Tenants created before tenant_members existed only have their roles in the
+-- authorization store. They are copied over by the backfill-tenant-members job.
+ALTER TABLE tenants
+ADD COLUMN members_backfilled BOOLEAN NOT NULL DEFAULT true;
+
+UPDATE tenants
+SET
+    members_backfilled = false
+WHERE
+    NOT EXISTS (
+        SELECT
+            1
+        FROM
+            tenant_members m
+        WHERE
+            m.tenant = tenants.id
+    );
+
+CREATE INDEX idx_tenants_members_backfill ON tenants (id)
+WHERE
+    NOT members_backfilled;
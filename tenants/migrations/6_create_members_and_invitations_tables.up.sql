@@ -0,0 +1,27 @@
+CREATE TABLE
+    tenant_members (
+        tenant BIGINT REFERENCES tenants (id) ON DELETE CASCADE,
+        user_id BIGINT NOT NULL,
+        role TEXT NOT NULL,
+        joined_at TIMESTAMP WITHOUT TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+        PRIMARY KEY (tenant, user_id)
+    );
+
+CREATE TABLE
+    tenant_invitations (
+        id BIGSERIAL PRIMARY KEY,
+        tenant BIGINT REFERENCES tenants (id) ON DELETE CASCADE,
+        email TEXT NOT NULL,
+        role TEXT NOT NULL,
+        token_hash VARCHAR(64) NOT NULL,
+        invited_by BIGINT NOT NULL,
+        expires_at TIMESTAMP WITHOUT TIME ZONE NOT NULL,
+        created_at TIMESTAMP WITHOUT TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+        accepted_at TIMESTAMP WITHOUT TIME ZONE,
+        accepted_by BIGINT,
+        revoked_at TIMESTAMP WITHOUT TIME ZONE
+    );
+
+CREATE UNIQUE INDEX idx_tenant_invitations_pending ON tenant_invitations (tenant, LOWER(email))
+WHERE
+    accepted_at IS NULL AND revoked_at IS NULL;
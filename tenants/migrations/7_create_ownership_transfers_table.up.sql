@@ -0,0 +1,17 @@
+CREATE TABLE
+    tenant_ownership_transfers (
+        id BIGSERIAL PRIMARY KEY,
+        tenant BIGINT REFERENCES tenants (id) ON DELETE CASCADE,
+        from_user BIGINT NOT NULL,
+        to_user BIGINT NOT NULL,
+        demote_to_admin BOOLEAN NOT NULL DEFAULT FALSE,
+        token_hash VARCHAR(64) NOT NULL,
+        expires_at TIMESTAMP WITHOUT TIME ZONE NOT NULL,
+        created_at TIMESTAMP WITHOUT TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+        confirmed_at TIMESTAMP WITHOUT TIME ZONE,
+        cancelled_at TIMESTAMP WITHOUT TIME ZONE
+    );
+
+CREATE UNIQUE INDEX idx_tenant_ownership_transfers_pending ON tenant_ownership_transfers (tenant)
+WHERE
+    confirmed_at IS NULL AND cancelled_at IS NULL;
@@ -0,0 +1,7 @@
+ALTER TABLE tenants
+ADD COLUMN delete_after TIMESTAMP WITHOUT TIME ZONE,
+ADD COLUMN deletion_reason TEXT;
+
+CREATE INDEX idx_tenants_delete_after ON tenants (delete_after)
+WHERE
+    delete_after IS NOT NULL;
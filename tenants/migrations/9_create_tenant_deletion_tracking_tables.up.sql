@@ -0,0 +1,50 @@
+CREATE TABLE
+    tenant_deletions (
+        id BIGSERIAL PRIMARY KEY,
+        tenant BIGINT NOT NULL,
+        subscription BIGINT NOT NULL,
+        requested_by BIGINT NOT NULL,
+        reason TEXT NOT NULL,
+        status TEXT NOT NULL DEFAULT 'scheduled',
+        restore_until TIMESTAMP WITHOUT TIME ZONE NOT NULL,
+        created_at TIMESTAMP WITHOUT TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+        started_at TIMESTAMP WITHOUT TIME ZONE,
+        completed_at TIMESTAMP WITHOUT TIME ZONE
+    );
+
+CREATE UNIQUE INDEX idx_tenant_deletions_active ON tenant_deletions (tenant)
+WHERE
+    status IN ('scheduled', 'in_progress');
+
+CREATE TABLE
+    tenant_deletion_steps (
+        deletion BIGINT REFERENCES tenant_deletions (id) ON DELETE CASCADE,
+        step TEXT NOT NULL,
+        status TEXT NOT NULL DEFAULT 'pending',
+        attempts INT NOT NULL DEFAULT 1,
+        last_error TEXT,
+        updated_at TIMESTAMP WITHOUT TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+        PRIMARY KEY (deletion, step)
+    );
+
+-- Tenants awaiting deletion are hidden from listings until they are restored
+CREATE OR REPLACE VIEW
+    vw_AllTenants AS
+SELECT
+    t.id,
+    t.name,
+    t.subscription,
+    t.created_at,
+    t.updated_at,
+    ts.suspended,
+    ts.subscription_plan,
+    ts.next_billing_cycle,
+    ts.created_at as subscribed_at,
+    ts.updated_at as subscription_updated_at,
+    sp.name as subscription_plan_name
+FROM
+    tenants t
+    JOIN tenant_subscriptions ts ON ts.id = t.subscription
+    JOIN subscription_plans sp ON ts.subscription_plan = sp.id
+WHERE
+    t.delete_after IS NULL;
@@ -0,0 +1,337 @@
+package tenants
+
+import (
+	"context"
+	"crypto/hmac"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"encore.dev/beta/auth"
+	"encore.dev/beta/errs"
+	"encore.dev/rlog"
+	"encore.dev/storage/sqldb"
+	"github.com/brinestone/scholaris/core/notifier"
+	"github.com/brinestone/scholaris/core/permissions"
+	"github.com/brinestone/scholaris/core/users"
+	"github.com/brinestone/scholaris/dto"
+	"github.com/brinestone/scholaris/helpers"
+	"github.com/brinestone/scholaris/models"
+	"github.com/brinestone/scholaris/util"
+)
+
+const ownershipTransferValidity = time.Hour * 48
+
+var errInvalidOwnershipTransfer = errs.Error{
+	Code:    errs.InvalidArgument,
+	Message: "The ownership transfer is invalid or has expired",
+}
+
+// Starts transferring the ownership of a tenant to another user. The transfer only takes effect once the new owner
+// confirms it using the token sent to their primary email address.
+//
+//encore:api auth method=POST path=/tenants/:id/ownership-transfers tag:can_change_tenant_owner
+func InitiateOwnershipTransfer(ctx context.Context, id uint64, req dto.NewOwnershipTransferRequest) (ans *dto.OwnershipTransfer, err error) {
+	uid, _ := auth.UserID()
+	fromUser, _ := strconv.ParseUint(string(uid), 10, 64)
+
+	if req.NewOwner == fromUser {
+		err = &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: "You already own this tenant",
+		}
+		return
+	}
+
+	tenant, err := findTenantById(ctx, id)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		err = &util.ErrNotFound
+		return
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	newOwner, err := users.FindUserById(ctx, req.NewOwner)
+	if errs.Code(err) == errs.NotFound || errors.Is(err, sqldb.ErrNoRows) || (err == nil && newOwner == nil) {
+		err = &errs.Error{
+			Code:    errs.NotFound,
+			Message: "The new owner does not exist",
+		}
+		return
+	} else if err != nil {
+		rlog.Error(util.MsgCallError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	email, ok := primaryEmailOf(newOwner)
+	if !ok {
+		err = &errs.Error{
+			Code:    errs.FailedPrecondition,
+			Message: "The new owner has no email address to confirm the transfer with",
+		}
+		return
+	}
+
+	tx, err := tenantDb.Begin(ctx)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+	defer tx.Rollback()
+
+	transfer, err := createOwnershipTransfer(ctx, tx, id, fromUser, req, time.Now().Add(ownershipTransferValidity))
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	token, hash := helpers.SignToken(secrets.TokenSigningKey, tokenPurposeOwnershipTransfer, transfer.Id)
+	if _, err = tx.Exec(ctx, "UPDATE tenant_ownership_transfers SET token_hash = $1 WHERE id = $2;", hash, transfer.Id); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if err = notifier.SendEmail(ctx, ownershipTransferEmail(tenant, transfer, email, token)); err != nil {
+		rlog.Error(util.MsgCallError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	ans = ownershipTransferToDto(transfer)
+	return
+}
+
+// Cancels a pending ownership transfer
+//
+//encore:api auth method=DELETE path=/tenants/:id/ownership-transfers/:transfer tag:can_change_tenant_owner
+func CancelOwnershipTransfer(ctx context.Context, id, transfer uint64) (err error) {
+	res, err := tenantDb.Exec(ctx, "UPDATE tenant_ownership_transfers SET cancelled_at = CURRENT_TIMESTAMP WHERE id = $1 AND tenant = $2 AND confirmed_at IS NULL AND cancelled_at IS NULL;", transfer, id)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if res.RowsAffected() == 0 {
+		err = &util.ErrNotFound
+	}
+	return
+}
+
+// Confirms a pending ownership transfer. The ownership tuples are swapped in a single write.
+//
+//encore:api auth method=POST path=/tenants/ownership-transfers/confirm
+func ConfirmOwnershipTransfer(ctx context.Context, req dto.ConfirmOwnershipTransferRequest) (err error) {
+	uid, _ := auth.UserID()
+	userId, _ := strconv.ParseUint(string(uid), 10, 64)
+
+	id, hash, ok := helpers.ParseToken(secrets.TokenSigningKey, tokenPurposeOwnershipTransfer, req.Token)
+	if !ok {
+		return &errInvalidOwnershipTransfer
+	}
+
+	tx, err := tenantDb.Begin(ctx)
+	if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return &util.ErrUnknown
+	}
+	defer tx.Rollback()
+
+	transfer, err := findPendingOwnershipTransferForUpdate(ctx, tx, id)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		return &errInvalidOwnershipTransfer
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return &util.ErrUnknown
+	}
+
+	if !hmac.Equal([]byte(hash), []byte(transfer.TokenHash)) || time.Now().After(transfer.ExpiresAt) {
+		return &errInvalidOwnershipTransfer
+	}
+
+	if transfer.ToUser != userId {
+		return &errs.Error{
+			Code:    errs.PermissionDenied,
+			Message: "This ownership transfer was addressed to another user",
+		}
+	}
+
+	stillOwner, err := permissions.CheckPermissionInternal(ctx, dto.InternalRelationCheckRequest{
+		Actor:    dto.IdentifierString(dto.PTUser, transfer.FromUser),
+		Relation: dto.PNOwner,
+		Target:   dto.IdentifierString(dto.PTTenant, transfer.Tenant),
+	})
+	if err != nil {
+		rlog.Error(util.MsgCallError, "err", err)
+		return &util.ErrUnknown
+	} else if !stillOwner.Allowed {
+		return &errs.Error{
+			Code:    errs.FailedPrecondition,
+			Message: "The user who initiated this transfer no longer owns the tenant",
+		}
+	}
+
+	if err = swapTenantOwnerMembers(ctx, tx, transfer); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return &util.ErrUnknown
+	}
+
+	if _, err = tx.Exec(ctx, "UPDATE tenant_ownership_transfers SET confirmed_at = CURRENT_TIMESTAMP WHERE id = $1;", transfer.Id); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return &util.ErrUnknown
+	}
+
+	if err = permissions.ReplacePermissions(ctx, ownershipTupleSwap(transfer)); err != nil {
+		rlog.Error(util.MsgCallError, "err", err)
+		return &util.ErrUnknown
+	}
+
+	if err = tx.Commit(); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return &util.ErrUnknown
+	}
+
+	TransferredTenantOwnerships.Publish(ctx, &TenantOwnershipTransferred{
+		Tenant:        transfer.Tenant,
+		PreviousOwner: transfer.FromUser,
+		NewOwner:      transfer.ToUser,
+		Demoted:       transfer.DemoteToAdmin,
+		InitiatedAt:   transfer.CreatedAt,
+		Timestamp:     time.Now(),
+	})
+	return
+}
+
+// Builds the tuple changes for a transfer. The new owner loses any other role they hold, and the previous owner is
+// either kept on as an admin or removed from the tenant. Tenants created before tenant_members existed may have no
+// member row for either user, so every role is listed and the permissions service skips the tuples which are already
+// in the requested state.
+func ownershipTupleSwap(transfer *models.OwnershipTransfer) dto.ReplacePermissionsRequest {
+	tenant := dto.IdentifierString(dto.PTTenant, transfer.Tenant)
+	from := dto.IdentifierString(dto.PTUser, transfer.FromUser)
+	to := dto.IdentifierString(dto.PTUser, transfer.ToUser)
+
+	ans := dto.ReplacePermissionsRequest{
+		Writes: []dto.PermissionUpdate{
+			{Actor: to, Relation: dto.PNOwner, Target: tenant},
+		},
+		Deletes: []dto.PermissionUpdate{
+			{Actor: from, Relation: dto.PNOwner, Target: tenant},
+		},
+	}
+
+	for _, role := range memberRoles {
+		if role != dto.PNOwner {
+			ans.Deletes = append(ans.Deletes, dto.PermissionUpdate{Actor: to, Relation: role, Target: tenant})
+		}
+	}
+
+	if transfer.DemoteToAdmin {
+		ans.Writes = append(ans.Writes, dto.PermissionUpdate{Actor: from, Relation: dto.PNAdmin, Target: tenant})
+	}
+	return ans
+}
+
+// Records the new owner and the demoted previous owner as members. Either row may be missing for tenants created
+// before tenant_members existed, hence the upserts.
+func swapTenantOwnerMembers(ctx context.Context, tx *sqldb.Tx, transfer *models.OwnershipTransfer) (err error) {
+	if transfer.DemoteToAdmin {
+		err = upsertTenantMember(ctx, tx, transfer.Tenant, transfer.FromUser, dto.PNAdmin)
+	} else {
+		_, err = tx.Exec(ctx, "DELETE FROM tenant_members WHERE tenant = $1 AND user_id = $2;", transfer.Tenant, transfer.FromUser)
+	}
+	if err != nil {
+		return
+	}
+	return upsertTenantMember(ctx, tx, transfer.Tenant, transfer.ToUser, dto.PNOwner)
+}
+
+func upsertTenantMember(ctx context.Context, tx *sqldb.Tx, tenant, user uint64, role dto.PermissionName) (err error) {
+	_, err = tx.Exec(ctx, `
+		INSERT INTO tenant_members(tenant, user_id, role)
+		VALUES ($1,$2,$3)
+		ON CONFLICT (tenant, user_id) DO UPDATE SET role = EXCLUDED.role;
+	`, tenant, user, role)
+	return
+}
+
+func primaryEmailOf(user *models.User) (string, bool) {
+	if email, ok := helpers.Find(user.Emails, func(e models.UserEmailAddress) bool {
+		return e.IsPrimary
+	}); ok {
+		return email.Email, true
+	}
+
+	if len(user.Emails) > 0 {
+		return user.Emails[0].Email, true
+	}
+	return "", false
+}
+
+func ownershipTransferEmail(tenant *models.Tenant, transfer *models.OwnershipTransfer, email, token string) dto.SendEmailRequest {
+	link := fmt.Sprintf("%s/tenants/ownership-transfers/confirm?token=%s", strings.TrimSuffix(secrets.FrontendUrl, "/"), token)
+	return dto.SendEmailRequest{
+		To:      email,
+		Subject: fmt.Sprintf("You have been asked to take over %s", tenant.Name),
+		Body: fmt.Sprintf(
+			"<p>You have been asked to become the owner of <strong>%s</strong>.</p><p><a href=\"%s\">Confirm the transfer</a></p><p>This request expires on %s.</p>",
+			tenant.Name, link, transfer.ExpiresAt.Format(time.RFC1123),
+		),
+		IsContentHtml: true,
+	}
+}
+
+const ownershipTransferFields = "id,tenant,from_user,to_user,demote_to_admin,token_hash,expires_at,created_at,confirmed_at,cancelled_at"
+
+// Creates a pending transfer, cancelling any transfer already pending for the tenant
+func createOwnershipTransfer(ctx context.Context, tx *sqldb.Tx, tenant, fromUser uint64, req dto.NewOwnershipTransferRequest, expiresAt time.Time) (*models.OwnershipTransfer, error) {
+	if _, err := tx.Exec(ctx, "UPDATE tenant_ownership_transfers SET cancelled_at = CURRENT_TIMESTAMP WHERE tenant = $1 AND confirmed_at IS NULL AND cancelled_at IS NULL;", tenant); err != nil {
+		return nil, err
+	}
+
+	query := fmt.Sprintf(`
+		INSERT INTO tenant_ownership_transfers(tenant, from_user, to_user, demote_to_admin, token_hash, expires_at)
+		VALUES ($1,$2,$3,$4,'',$5)
+		RETURNING %s;
+	`, ownershipTransferFields)
+	return scanOwnershipTransfer(tx.QueryRow(ctx, query, tenant, fromUser, req.NewOwner, req.DemoteToAdmin, expiresAt))
+}
+
+func findPendingOwnershipTransferForUpdate(ctx context.Context, tx *sqldb.Tx, id uint64) (*models.OwnershipTransfer, error) {
+	query := fmt.Sprintf("SELECT %s FROM tenant_ownership_transfers WHERE id = $1 AND confirmed_at IS NULL AND cancelled_at IS NULL FOR UPDATE;", ownershipTransferFields)
+	return scanOwnershipTransfer(tx.QueryRow(ctx, query, id))
+}
+
+func scanOwnershipTransfer(row rowScanner) (*models.OwnershipTransfer, error) {
+	t := new(models.OwnershipTransfer)
+	if err := row.Scan(&t.Id, &t.Tenant, &t.FromUser, &t.ToUser, &t.DemoteToAdmin, &t.TokenHash, &t.ExpiresAt, &t.CreatedAt, &t.ConfirmedAt, &t.CancelledAt); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func ownershipTransferToDto(t *models.OwnershipTransfer) *dto.OwnershipTransfer {
+	return &dto.OwnershipTransfer{
+		Id:            t.Id,
+		Tenant:        t.Tenant,
+		FromUser:      t.FromUser,
+		ToUser:        t.ToUser,
+		DemoteToAdmin: t.DemoteToAdmin,
+		ExpiresAt:     t.ExpiresAt,
+		CreatedAt:     t.CreatedAt,
+	}
+}
@@ -0,0 +1,103 @@
+package tenants_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"encore.dev/beta/auth"
+	"encore.dev/et"
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/brinestone/scholaris/core/notifier"
+	"github.com/brinestone/scholaris/core/permissions"
+	"github.com/brinestone/scholaris/core/users"
+	"github.com/brinestone/scholaris/dto"
+	"github.com/brinestone/scholaris/models"
+	"github.com/brinestone/scholaris/tenants"
+	"github.com/stretchr/testify/assert"
+)
+
+// Starts a transfer of a tenant to newOwner and returns the token sent to them.
+func initiateTransfer(t *testing.T, tenant, newOwner uint64, demote bool) (token string) {
+	et.MockEndpoint(users.FindUserById, func(ctx context.Context, id uint64) (*models.User, error) {
+		return &models.User{Id: id, Emails: []models.UserEmailAddress{{Email: gofakeit.Email(), IsPrimary: true, Verified: true}}}, nil
+	})
+	et.MockEndpoint(notifier.SendEmail, func(ctx context.Context, req dto.SendEmailRequest) error {
+		if m := invitationTokenPattern.FindStringSubmatch(req.Body); m != nil {
+			token = m[1]
+		}
+		return nil
+	})
+
+	if _, err := tenants.InitiateOwnershipTransfer(mainContext, tenant, dto.NewOwnershipTransferRequest{NewOwner: newOwner, DemoteToAdmin: demote}); err != nil {
+		t.Fatal(err)
+	}
+	if len(token) == 0 {
+		t.Fatal("no transfer token was sent")
+	}
+	return
+}
+
+func TestConfirmOwnershipTransferOfLegacyTenant(t *testing.T) {
+	t.Cleanup(mockEndpoints)
+	tenant := latestTenant(t)
+	if err := tenants.ResetMemberBackfill(context.TODO(), tenant); err != nil {
+		t.Fatal(err)
+	}
+
+	newOwner := uint64(gofakeit.UintRange(4000, 5000))
+	token := initiateTransfer(t, tenant, newOwner, true)
+
+	var swap dto.ReplacePermissionsRequest
+	et.MockEndpoint(permissions.ReplacePermissions, func(ctx context.Context, req dto.ReplacePermissionsRequest) error {
+		swap = req
+		return nil
+	})
+
+	ctx := auth.WithContext(context.TODO(), auth.UID(fmt.Sprint(newOwner)), &dto.AuthClaims{Sub: newOwner})
+	if err := tenants.ConfirmOwnershipTransfer(ctx, dto.ConfirmOwnershipTransferRequest{Token: token}); err != nil {
+		t.Fatal(err)
+	}
+
+	target := dto.IdentifierString(dto.PTTenant, tenant)
+	to := dto.IdentifierString(dto.PTUser, newOwner)
+	from := dto.IdentifierString(dto.PTUser, mainUser)
+	assert.ElementsMatch(t, []dto.PermissionUpdate{
+		{Actor: to, Relation: dto.PNOwner, Target: target},
+		{Actor: from, Relation: dto.PNAdmin, Target: target},
+	}, swap.Writes)
+	// The new owner had no member row, so every other role they may hold is removed.
+	assert.ElementsMatch(t, []dto.PermissionUpdate{
+		{Actor: from, Relation: dto.PNOwner, Target: target},
+		{Actor: to, Relation: dto.PNAdmin, Target: target},
+		{Actor: to, Relation: dto.PNMaintainer, Target: target},
+	}, swap.Deletes)
+
+	role, err := tenants.MemberRole(context.TODO(), tenant, mainUser)
+	assert.Nil(t, err)
+	assert.Equal(t, string(dto.PNAdmin), role)
+
+	role, err = tenants.MemberRole(context.TODO(), tenant, newOwner)
+	assert.Nil(t, err)
+	assert.Equal(t, string(dto.PNOwner), role)
+}
+
+func TestConfirmOwnershipTransferRemovesPreviousOwner(t *testing.T) {
+	t.Cleanup(mockEndpoints)
+	tenant := latestTenant(t)
+	newOwner := uint64(gofakeit.UintRange(5001, 6000))
+	token := initiateTransfer(t, tenant, newOwner, false)
+
+	et.MockEndpoint(permissions.ReplacePermissions, func(ctx context.Context, req dto.ReplacePermissionsRequest) error {
+		return nil
+	})
+
+	ctx := auth.WithContext(context.TODO(), auth.UID(fmt.Sprint(newOwner)), &dto.AuthClaims{Sub: newOwner})
+	if err := tenants.ConfirmOwnershipTransfer(ctx, dto.ConfirmOwnershipTransferRequest{Token: token}); err != nil {
+		t.Fatal(err)
+	}
+
+	role, err := tenants.MemberRole(context.TODO(), tenant, mainUser)
+	assert.Nil(t, err)
+	assert.Empty(t, role)
+}
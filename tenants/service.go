@@ -7,6 +7,8 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"encore.dev/beta/auth"
@@ -16,9 +18,9 @@ import (
 	"encore.dev/storage/sqldb"
 	"github.com/brinestone/scholaris/core/permissions"
 	"github.com/brinestone/scholaris/dto"
+	"github.com/brinestone/scholaris/helpers"
 	"github.com/brinestone/scholaris/models"
 	"github.com/brinestone/scholaris/util"
-	"github.com/lib/pq"
 )
 
 // Checks whether a tenant name exists or not
@@ -67,49 +69,85 @@ func FindTenant(ctx context.Context, id uint64) (*dto.TenantLookup, error) {
 		return nil, &util.ErrUnknown
 	}
 
-	return &tenantsToDto(t)[0], err
+	ans := tenantsToDto(t)[0]
+	ans.Profile = tenantProfileToDto(t)
+	return &ans, err
 }
 
-// Deletes a Tenant
+// Finds the branding and contact details of a tenant
 //
-//encore:api auth method=DELETE path=/tenants/:id tag:perm_can_delete_tenant
-func DeleteTenant(ctx context.Context, id uint64) error {
-	tx, err := tenantDb.Begin(ctx)
-	if err != nil {
-		return err
+//encore:api private method=GET path=/tenants/:id/profile/internal
+func FindTenantProfileInternal(ctx context.Context, id uint64) (*dto.TenantProfile, error) {
+	t, err := findTenantById(ctx, id)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		return nil, &util.ErrNotFound
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		return nil, &util.ErrUnknown
 	}
 
-	err = deleteTenantById(ctx, tx, id)
-	if err != nil {
-		rlog.Error(err.Error())
-		_ = tx.Rollback()
-		return &util.ErrUnknown
+	return tenantProfileToDto(t), nil
+}
+
+// Updates a tenant's name, branding and contact details
+//
+//encore:api auth method=PUT path=/tenants/:id tag:can_update_tenant
+func UpdateTenant(ctx context.Context, id uint64, req dto.UpdateTenantRequest) (ans *dto.TenantLookup, err error) {
+	t, err := findTenantByIdFromDb(ctx, id)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		err = &util.ErrNotFound
+		return
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
+	if !strings.EqualFold(t.Name, req.Name) {
+		var nameUnavailable bool
+		if nameUnavailable, err = tenantNameExists(ctx, req.Name); err != nil {
+			rlog.Error(util.MsgDbAccessError, "err", err)
+			err = &util.ErrUnknown
+			return
+		} else if nameUnavailable {
+			err = &errs.Error{
+				Code:    errs.AlreadyExists,
+				Message: fmt.Sprintf("The name: \"%s\" is not available. Please use another", req.Name),
+			}
+			return
+		}
 	}
 
-	userId, _ := auth.UserID()
+	if err = updateTenant(ctx, id, req); err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
 
-	timeout, cancel := context.WithTimeout(ctx, time.Second*10)
-	defer cancel()
+	_, _ = tenantCache.Delete(ctx, id)
+	evictTenantHostnames(ctx, id)
+	return FindTenant(ctx, id)
+}
 
-	if err = permissions.DeletePermissions(timeout, dto.UpdatePermissionsRequest{
-		Updates: []dto.PermissionUpdate{
-			{
-				Actor:    fmt.Sprintf("user:%s", userId),
-				Relation: "owner",
-				Target:   fmt.Sprintf("tenant:%d", id),
-			},
-		},
-	}); err != nil {
-		rlog.Error(err.Error())
-		_ = tx.Rollback()
-		return &util.ErrUnknown
+// Deletes a Tenant. The tenant can be restored for a while before its data is removed from every service.
+//
+//encore:api auth method=DELETE path=/tenants/:id tag:perm_can_delete_tenant
+func DeleteTenant(ctx context.Context, id uint64) (ans *dto.TenantDeletion, err error) {
+	uid, _ := auth.UserID()
+	userId, _ := strconv.ParseUint(string(uid), 10, 64)
+
+	deletion, err := scheduleTenantDeletion(ctx, id, userId, time.Now().Add(tenantRestorePeriod), "deleted by owner")
+	if errors.Is(err, sqldb.ErrNoRows) {
+		err = &util.ErrNotFound
+		return
+	} else if err != nil {
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
 	}
 
-	DeletedTenants.Publish(ctx, &TenantDeleted{
-		Id:        id,
-		DeletedAt: time.Now(),
-	})
-	return nil
+	ans = tenantDeletionToDto(deletion, nil)
+	return
 }
 
 // Creates a new Tenant
@@ -155,6 +193,14 @@ func NewTenant(ctx context.Context, req dto.NewTenantRequest) (err error) {
 		return
 	}
 
+	userId, _ := strconv.ParseUint(string(user), 10, 64)
+	if err = createTenantMember(ctx, tx, tenant, userId, dto.PNOwner); err != nil {
+		tx.Rollback()
+		rlog.Error(util.MsgDbAccessError, "err", err)
+		err = &util.ErrUnknown
+		return
+	}
+
 	if err = permissions.SetPermissions(ctx, dto.UpdatePermissionsRequest{
 		Updates: []dto.PermissionUpdate{
 			{
@@ -187,26 +233,54 @@ func NewTenant(ctx context.Context, req dto.NewTenantRequest) (err error) {
 // Find all Tenants
 //
 //encore:api auth method=GET path=/tenants
-func Lookup(ctx context.Context) (ans *dto.FindTenantResponse, err error) {
+func Lookup(ctx context.Context, req dto.CursorBasedPaginationParams) (ans *dto.FindTenantResponse, err error) {
 	uid, _ := auth.UserID()
+	actor := dto.IdentifierString(dto.PTUser, uid)
+
+	// Tenants can be viewed through grants and inherited roles as well as membership, so every tenant is a candidate
+	// and the authorization store decides which ones the user may view.
+	filter := func(ctx context.Context, rows []*models.Tenant) (ans []*models.Tenant, err error) {
+		if len(rows) == 0 {
+			return
+		}
+
+		res, err := permissions.FilterObjectsInternal(ctx, dto.FilterObjectsRequest{
+			Actor:    actor,
+			Relation: dto.PNCanView,
+			Type:     dto.PTTenant,
+			Ids:      helpers.SliceMap(rows, func(t *models.Tenant) uint64 { return t.Id }),
+		})
+		if err != nil {
+			return
+		}
 
-	viewable, err := lookupViewableTenantIds(ctx, uid)
+		allowed := make(map[uint64]bool)
+		for _, id := range res.Allowed {
+			allowed[id] = true
+		}
+		for _, t := range rows {
+			if allowed[t.Id] {
+				ans = append(ans, t)
+			}
+		}
+		return
+	}
+	cursorOf := func(t *models.Tenant) uint64 { return t.Id }
+
+	found, next, err := helpers.AuthorizedPage(ctx, req.After, req.PageSize(), findTenantsAfter, filter, cursorOf)
 	if err != nil {
-		rlog.Error(util.MsgCallError, "msg", err.Error())
+		rlog.Error(util.MsgDbAccessError, "msg", err.Error())
 		err = &util.ErrUnknown
 		return
 	}
 
-	if len(viewable) == 0 {
+	if len(found) == 0 && req.After == 0 {
 		err = &util.ErrNotFound
 		return
 	}
 
-	found, err := findViewableTenants(ctx, viewable)
-	if errors.Is(err, sql.ErrNoRows) {
-		err = &util.ErrNotFound
-		return
-	} else if err != nil {
+	total, err := helpers.CountAuthorized(ctx, helpers.ScanBatchSize, findTenantsAfter, filter, cursorOf)
+	if err != nil {
 		rlog.Error(util.MsgDbAccessError, "msg", err.Error())
 		err = &util.ErrUnknown
 		return
@@ -214,39 +288,27 @@ func Lookup(ctx context.Context) (ans *dto.FindTenantResponse, err error) {
 
 	ans = &dto.FindTenantResponse{
 		Tenants: tenantsToDto(found...),
+		Total:   total,
+		HasMore: next != 0,
+		Next:    next,
 	}
-
-	return
-}
-
-func lookupViewableTenantIds(ctx context.Context, uid auth.UID) (ans []uint64, err error) {
-	response, err := permissions.ListObjectsInternal(ctx, dto.ListObjectsRequest{
-		Actor:    dto.IdentifierString(dto.PTUser, uid),
-		Relation: dto.PNCanView,
-		Type:     string(dto.PTTenant),
-	})
-	if err != nil {
-		return
-	}
-
-	ans = response.Relations[dto.PTTenant]
 	return
 }
 
-func findViewableTenants(ctx context.Context, ids []uint64) (ans []*models.Tenant, err error) {
+func findTenantsAfter(ctx context.Context, after uint64, limit uint) (ans []*models.Tenant, err error) {
 	query := `
 		SELECT 
-			id, name, created_at, updated_at, subscription_plan_name
+			t.id, t.name, t.created_at, t.updated_at, t.subscription_plan_name
 		FROM 
-			vw_AllTenants
+			vw_AllTenants t
 		WHERE 
-			id = ANY(SELECT * FROM UNNEST($1::BIGINT[]))
+			$1 = 0 OR t.id < $1
 		ORDER BY 
-			created_at DESC
-		;
+			t.id DESC
+		LIMIT $2;
 	`
 
-	rows, err := tenantDb.Query(ctx, query, pq.Array(ids))
+	rows, err := tenantDb.Query(ctx, query, after, limit)
 	if err != nil {
 		return
 	}
@@ -260,10 +322,11 @@ func findViewableTenants(ctx context.Context, ids []uint64) (ans []*models.Tenan
 		ans = append(ans, mod)
 	}
 
+	err = rows.Err()
 	return
 }
 
-const tenantFields = "id,name,created_at,updated_at,subscription"
+const tenantFields = "id,name,created_at,updated_at,subscription,logo,primary_color,secondary_color,contact_email,contact_phone,website,address_street,address_city,address_region,address_postal_code,address_country"
 
 func tenantNameExists(ctx context.Context, name string) (ans bool, err error) {
 	query := "SELECT COUNT(id) FROM tenants WHERE LOWER(name) = LOWER($1);"
@@ -282,6 +345,34 @@ func createTenant(ctx context.Context, tx *sqldb.Tx, req dto.NewTenantRequest, s
 	return
 }
 
+func updateTenant(ctx context.Context, id uint64, req dto.UpdateTenantRequest) (err error) {
+	p := req.Profile
+	address := p.Address
+	if address == nil {
+		address = new(dto.TenantAddress)
+	}
+
+	_, err = tenantDb.Exec(ctx, `
+		UPDATE tenants SET
+			name = $2,
+			logo = $3,
+			primary_color = $4,
+			secondary_color = $5,
+			contact_email = $6,
+			contact_phone = $7,
+			website = $8,
+			address_street = NULLIF($9, ''),
+			address_city = NULLIF($10, ''),
+			address_region = NULLIF($11, ''),
+			address_postal_code = NULLIF($12, ''),
+			address_country = NULLIF($13, ''),
+			updated_at = CURRENT_TIMESTAMP
+		WHERE
+			id = $1;
+	`, id, strings.TrimSpace(req.Name), p.Logo, p.PrimaryColor, p.SecondaryColor, p.ContactEmail, p.ContactPhone, p.Website, address.Street, address.City, address.Region, address.PostalCode, address.Country)
+	return
+}
+
 func createTenantSubscription(ctx context.Context, tx *sqldb.Tx, planId uint64) (id uint64, err error) {
 	// Check whether the subscription plan exists
 	row := tx.QueryRow(ctx, `
@@ -347,7 +438,7 @@ func findTenantByIdFromDb(ctx context.Context, id uint64) (*models.Tenant, error
 	row := tenantDb.QueryRow(ctx, query, id)
 	var t = new(models.Tenant)
 
-	if err := row.Scan(&t.Id, &t.Name, &t.CreatedAt, &t.UpdatedAt, &t.Subscription); err != nil {
+	if err := row.Scan(&t.Id, &t.Name, &t.CreatedAt, &t.UpdatedAt, &t.Subscription, &t.Logo, &t.PrimaryColor, &t.SecondaryColor, &t.ContactEmail, &t.ContactPhone, &t.Website, &t.Street, &t.City, &t.Region, &t.PostalCode, &t.Country); err != nil {
 		return nil, err
 	}
 
@@ -438,6 +529,35 @@ func subscriptionPlansToDto(plans ...*models.SubscriptionPlan) (ans []dto.Subscr
 	return
 }
 
+func tenantProfileToDto(t *models.Tenant) *dto.TenantProfile {
+	nullable := func(v sql.NullString) *string {
+		if !v.Valid {
+			return nil
+		}
+		return &v.String
+	}
+
+	ans := &dto.TenantProfile{
+		Logo:           nullable(t.Logo),
+		PrimaryColor:   nullable(t.PrimaryColor),
+		SecondaryColor: nullable(t.SecondaryColor),
+		ContactEmail:   nullable(t.ContactEmail),
+		ContactPhone:   nullable(t.ContactPhone),
+		Website:        nullable(t.Website),
+	}
+
+	if t.Street.Valid || t.City.Valid || t.Region.Valid || t.PostalCode.Valid || t.Country.Valid {
+		ans.Address = &dto.TenantAddress{
+			Street:     t.Street.String,
+			City:       t.City.String,
+			Region:     t.Region.String,
+			PostalCode: t.PostalCode.String,
+			Country:    t.Country.String,
+		}
+	}
+	return ans
+}
+
 func tenantsToDto(t ...*models.Tenant) (ans []dto.TenantLookup) {
 	ans = make([]dto.TenantLookup, len(t))
 
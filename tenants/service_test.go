@@ -7,9 +7,11 @@ import (
 	"fmt"
 	"io"
 	"math/rand"
+	"net"
 	"testing"
 
 	"encore.dev/beta/auth"
+	"encore.dev/beta/errs"
 	"encore.dev/et"
 	"github.com/brianvoe/gofakeit/v6"
 	sAuth "github.com/brinestone/scholaris/core/auth"
@@ -41,6 +43,9 @@ func mockEndpoints() {
 	et.MockEndpoint(permissions.DeletePermissions, func(ctx context.Context, req dto.UpdatePermissionsRequest) error {
 		return nil
 	})
+	et.MockEndpoint(permissions.FilterObjectsInternal, func(ctx context.Context, req dto.FilterObjectsRequest) (*dto.FilterObjectsResponse, error) {
+		return &dto.FilterObjectsResponse{Allowed: req.Ids}, nil
+	})
 }
 
 func randomString(len int) string {
@@ -72,10 +77,12 @@ func makeTenant() (err error) {
 }
 
 var mainContext context.Context
+var mainUser uint64
 
 func TestMain(m *testing.M) {
 	mockEndpoints()
 	uid, data := makeUser()
+	mainUser = data.Sub
 	mainContext = auth.WithContext(context.TODO(), uid, &data)
 	m.Run()
 }
@@ -132,25 +139,40 @@ func TestDeleteTenant(t *testing.T) {
 		return
 	}
 
-	err := tenants.DeleteTenant(mainContext, 1)
+	deletion, err := tenants.DeleteTenant(mainContext, 1)
 	assert.Nil(t, err)
+	assert.Equal(t, dto.TDSScheduled, deletion.Status)
+}
+
+func TestProcessTenantDeletionsFailsExhaustedDeletions(t *testing.T) {
+	tenant := latestTenant(t)
+	deletion, err := tenants.DeleteTenant(mainContext, tenant)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = tenants.ExhaustDeletion(context.TODO(), deletion.Id, "database unavailable"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = tenants.ProcessTenantDeletions(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := tenants.FindTenantDeletion(mainContext, deletion.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, dto.TDSFailed, res.Status)
+	assert.NotNil(t, res.CompletedAt)
 }
 
 func TestLookup(t *testing.T) {
-	t.Cleanup(mockEndpoints)
-	et.MockEndpoint(permissions.ListObjectsInternal, func(ctx context.Context, p dto.ListObjectsRequest) (*dto.ListObjectsResponse, error) {
-		return &dto.ListObjectsResponse{
-			Relations: map[dto.PermissionType][]uint64{
-				dto.PTTenant: {1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11},
-			},
-		}, nil
-	})
 	if err := makeTenant(); err != nil {
 		t.Error(err)
 		return
 	}
 
-	res, err := tenants.Lookup(mainContext)
+	res, err := tenants.Lookup(mainContext, dto.CursorBasedPaginationParams{Size: 100})
 
 	if err != nil {
 		t.Error(err)
@@ -159,4 +181,147 @@ func TestLookup(t *testing.T) {
 
 	assert.NotNil(t, res)
 	assert.LessOrEqual(t, len(res.Tenants), 100)
+	assert.GreaterOrEqual(t, res.Total, uint(1))
+}
+
+func TestLookupPages(t *testing.T) {
+	for i := 0; i < 3; i++ {
+		if err := makeTenant(); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	var seen []uint64
+	var after uint64
+	var total uint
+	for {
+		res, err := tenants.Lookup(mainContext, dto.CursorBasedPaginationParams{After: after, Size: 2})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		total = res.Total
+		for _, v := range res.Tenants {
+			seen = append(seen, v.Id)
+		}
+		if !res.HasMore {
+			assert.Zero(t, res.Next)
+			break
+		}
+		assert.Len(t, res.Tenants, 2)
+		after = res.Next
+	}
+
+	assert.Equal(t, int(total), len(seen))
+}
+
+func TestLookupListsTenantsTheStoreAllows(t *testing.T) {
+	for i := 0; i < 4; i++ {
+		if err := makeTenant(); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	// Viewability is decided by the authorization store, whatever the membership rows say.
+	et.MockEndpoint(permissions.FilterObjectsInternal, func(ctx context.Context, req dto.FilterObjectsRequest) (*dto.FilterObjectsResponse, error) {
+		assert.Equal(t, dto.PNCanView, req.Relation)
+		ans := &dto.FilterObjectsResponse{Allowed: make([]uint64, 0)}
+		for _, id := range req.Ids {
+			if id%2 == 1 {
+				ans.Allowed = append(ans.Allowed, id)
+			}
+		}
+		return ans, nil
+	})
+	defer mockEndpoints()
+
+	res, err := tenants.Lookup(mainContext, dto.CursorBasedPaginationParams{Size: 100})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	assert.NotEmpty(t, res.Tenants)
+	assert.GreaterOrEqual(t, int(res.Total), len(res.Tenants))
+	for _, v := range res.Tenants {
+		assert.Equal(t, uint64(1), v.Id%2)
+	}
+}
+
+func TestLookupWithoutViewableTenants(t *testing.T) {
+	if err := makeTenant(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	et.MockEndpoint(permissions.FilterObjectsInternal, func(ctx context.Context, req dto.FilterObjectsRequest) (*dto.FilterObjectsResponse, error) {
+		return &dto.FilterObjectsResponse{Allowed: make([]uint64, 0)}, nil
+	})
+	defer mockEndpoints()
+
+	_, err := tenants.Lookup(mainContext, dto.CursorBasedPaginationParams{Size: 10})
+	assert.Equal(t, errs.NotFound, errs.Code(err))
+}
+
+type fakeResolver map[string][]string
+
+func (f fakeResolver) LookupTXT(_ context.Context, name string) ([]string, error) {
+	return f[name], nil
+}
+
+type failingResolver struct{}
+
+func (failingResolver) LookupTXT(_ context.Context, name string) ([]string, error) {
+	return nil, &net.DNSError{Err: "server misbehaving", Name: name, IsTemporary: true}
+}
+
+func TestVerifyTenantDomainReportsLookupFailures(t *testing.T) {
+	if err := makeTenant(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	domain, err := tenants.AddTenantDomain(mainContext, 1, dto.NewTenantDomainRequest{Hostname: fmt.Sprintf("%s.example.com", randomString(4))})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	restore := tenants.UseResolver(failingResolver{})
+	defer restore()
+	_, err = tenants.VerifyTenantDomain(mainContext, 1, domain.Id)
+	assert.Equal(t, errs.Unavailable, errs.Code(err))
+}
+
+func TestVerifyTenantDomain(t *testing.T) {
+	if err := makeTenant(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	hostname := fmt.Sprintf("%s.example.com", randomString(4))
+	domain, err := tenants.AddTenantDomain(mainContext, 1, dto.NewTenantDomainRequest{Hostname: hostname})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.False(t, domain.Verified)
+	assert.NotNil(t, domain.Record)
+
+	restore := tenants.UseResolver(fakeResolver{})
+	_, err = tenants.VerifyTenantDomain(mainContext, 1, domain.Id)
+	restore()
+	assert.NotNil(t, err)
+
+	restore = tenants.UseResolver(fakeResolver{domain.Record.Name: {"unrelated", domain.Record.Value}})
+	defer restore()
+	verified, err := tenants.VerifyTenantDomain(mainContext, 1, domain.Id)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.True(t, verified.Verified)
+	assert.Nil(t, verified.Record)
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"encore.dev/pubsub"
+	"encore.dev/rlog"
 	"github.com/brinestone/scholaris/core/users"
 )
 
@@ -11,8 +12,23 @@ var _ = pubsub.NewSubscription(users.DeletedUsers, "purge-owned-tenants", pubsub
 	Handler: onUserAccountDeleted,
 })
 
+var _ = pubsub.NewSubscription(AcknowledgedDeletionSteps, "track-tenant-deletion-steps", pubsub.SubscriptionConfig[*TenantDeletionStepAcknowledged]{
+	Handler: onDeletionStepAcknowledged,
+})
+
 func onUserAccountDeleted(ctx context.Context, msg users.UserDeleted) (err error) {
-	// TODO: Remove tenants owned by this user.
-	// TODO: Remove the tenants owned by this users if they're the only member.
+	summary, err := cleanUpUserTenants(ctx, msg.UserId, msg.Timestamp)
+	if err != nil {
+		rlog.Error("could not clean up the tenants of a deleted user", "user", msg.UserId, "err", err)
+		return
+	}
+
+	rlog.Info("cleaned up the tenants of a deleted user",
+		"user", msg.UserId,
+		"promoted", len(summary.PromotedOwners),
+		"scheduled", len(summary.ScheduledForDeletion),
+		"removed", len(summary.RemovedMemberships),
+	)
+	_, err = CleanedUpUserTenants.Publish(ctx, summary)
 	return
 }
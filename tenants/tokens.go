@@ -0,0 +1,12 @@
+package tenants
+
+var secrets struct {
+	TokenSigningKey string `encore:"sensitive"`
+	FrontendUrl     string
+}
+
+// The purposes tokens are signed for
+const (
+	tokenPurposeInvitation        = "invitation"
+	tokenPurposeOwnershipTransfer = "ownership-transfer"
+)
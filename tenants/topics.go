@@ -1,6 +1,8 @@
 package tenants
 
 import (
+	"context"
+	"slices"
 	"time"
 
 	"encore.dev/beta/auth"
@@ -12,9 +14,115 @@ type TenantCreated struct {
 	Id        uint64
 }
 
+// The steps of a tenant deletion carried out by other services. Each one acknowledges its step once the
+// tenant's data it holds is gone.
+const (
+	DeletionStepInstitutions = "institutions"
+	DeletionStepForms        = "forms"
+	DeletionStepSettings     = "settings"
+	DeletionStepUploads      = "uploads"
+)
+
+var deletionSteps = []string{DeletionStepInstitutions, DeletionStepForms, DeletionStepSettings, DeletionStepUploads}
+
 type TenantDeleted struct {
-	Id        uint64
+	Id uint64
+	// The deletion being carried out
+	Deletion  uint64
 	DeletedAt time.Time
+	// The steps expected to act on this message. Retries, published on RetriedDeletionSteps, only list the steps that
+	// have not completed.
+	Steps []string
+}
+
+// Reports whether the step should act on this message
+func (t *TenantDeleted) Includes(step string) bool {
+	return slices.Contains(t.Steps, step)
+}
+
+// Reports the outcome of a step back to the deletion tracker
+func (t *TenantDeleted) Acknowledge(ctx context.Context, step string, stepErr error) (err error) {
+	ack := &TenantDeletionStepAcknowledged{
+		Deletion:  t.Deletion,
+		Tenant:    t.Id,
+		Step:      step,
+		Timestamp: time.Now(),
+	}
+	if stepErr != nil {
+		ack.Error = stepErr.Error()
+	}
+
+	_, err = AcknowledgedDeletionSteps.Publish(ctx, ack)
+	return
+}
+
+type TenantDeletionStepAcknowledged struct {
+	Deletion uint64
+	Tenant   uint64
+	Step     string
+	// Set when the step failed
+	Error     string
+	Timestamp time.Time
+}
+
+// Raised when a deletion step still fails after its last retry
+type TenantDeletionFailed struct {
+	Deletion uint64
+	Tenant   uint64
+	// The steps which did not complete, with their last error when they reported one
+	Steps     map[string]string
+	Timestamp time.Time
+}
+
+type TenantDeletionCompleted struct {
+	Deletion  uint64
+	Tenant    uint64
+	Timestamp time.Time
+}
+
+type TenantRestored struct {
+	Tenant     uint64
+	RestoredBy uint64
+	Timestamp  time.Time
+}
+
+type TenantMemberJoined struct {
+	Tenant    uint64
+	UserId    uint64
+	Role      string
+	InvitedBy uint64
+	Timestamp time.Time
+}
+
+type TenantOwnershipTransferred struct {
+	Tenant        uint64
+	PreviousOwner uint64
+	NewOwner      uint64
+	// Whether the previous owner was kept on as an admin
+	Demoted bool
+	// Whether the new owner was promoted automatically after the previous owner's account was deleted
+	Automatic   bool
+	InitiatedAt time.Time
+	Timestamp   time.Time
+}
+
+type TenantDeletionScheduled struct {
+	Tenant      uint64
+	DeleteAfter time.Time
+	Reason      string
+	Timestamp   time.Time
+}
+
+// Summarizes what happened to the tenants of a deleted user account
+type UserTenantsCleanedUp struct {
+	UserId uint64
+	// Tenants whose ownership passed to another member, keyed by tenant ID with the new owner as value
+	PromotedOwners map[uint64]uint64
+	// Tenants scheduled for deletion
+	ScheduledForDeletion []uint64
+	// Tenants the user was removed from as a non-owning member
+	RemovedMemberships []uint64
+	Timestamp          time.Time
 }
 
 var NewTenants = pubsub.NewTopic[*TenantCreated]("new-tenant", pubsub.TopicConfig{
@@ -24,3 +132,41 @@ var NewTenants = pubsub.NewTopic[*TenantCreated]("new-tenant", pubsub.TopicConfi
 var DeletedTenants = pubsub.NewTopic[*TenantDeleted]("tenant-deleted", pubsub.TopicConfig{
 	DeliveryGuarantee: pubsub.ExactlyOnce,
 })
+
+// Requests the steps of a deletion which failed or went unacknowledged again. Services handle these messages the
+// same way as DeletedTenants, which is only published once per deletion.
+var RetriedDeletionSteps = pubsub.NewTopic[*TenantDeleted]("tenant-deletion-steps-retried", pubsub.TopicConfig{
+	DeliveryGuarantee: pubsub.AtLeastOnce,
+})
+
+var FailedTenantDeletions = pubsub.NewTopic[*TenantDeletionFailed]("tenant-deletion-failed", pubsub.TopicConfig{
+	DeliveryGuarantee: pubsub.AtLeastOnce,
+})
+
+var AcknowledgedDeletionSteps = pubsub.NewTopic[*TenantDeletionStepAcknowledged]("tenant-deletion-step-acknowledged", pubsub.TopicConfig{
+	DeliveryGuarantee: pubsub.AtLeastOnce,
+})
+
+var CompletedTenantDeletions = pubsub.NewTopic[*TenantDeletionCompleted]("tenant-deletion-completed", pubsub.TopicConfig{
+	DeliveryGuarantee: pubsub.AtLeastOnce,
+})
+
+var RestoredTenants = pubsub.NewTopic[*TenantRestored]("tenant-restored", pubsub.TopicConfig{
+	DeliveryGuarantee: pubsub.AtLeastOnce,
+})
+
+var JoinedTenantMembers = pubsub.NewTopic[*TenantMemberJoined]("tenant-member-joined", pubsub.TopicConfig{
+	DeliveryGuarantee: pubsub.AtLeastOnce,
+})
+
+var TransferredTenantOwnerships = pubsub.NewTopic[*TenantOwnershipTransferred]("tenant-ownership-transferred", pubsub.TopicConfig{
+	DeliveryGuarantee: pubsub.AtLeastOnce,
+})
+
+var ScheduledTenantDeletions = pubsub.NewTopic[*TenantDeletionScheduled]("tenant-deletion-scheduled", pubsub.TopicConfig{
+	DeliveryGuarantee: pubsub.AtLeastOnce,
+})
+
+var CleanedUpUserTenants = pubsub.NewTopic[*UserTenantsCleanedUp]("user-tenants-cleaned-up", pubsub.TopicConfig{
+	DeliveryGuarantee: pubsub.AtLeastOnce,
+})
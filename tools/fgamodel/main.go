@@ -0,0 +1,118 @@
+// Compiles the modular authorization model declared in fga.mod into the JSON
+// document embedded by the permissions service.
+//
+// Usage: go run . <repository root> <output file>
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/openfga/language/pkg/go/transformer"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+func main() {
+	if len(os.Args) != 3 {
+		fmt.Fprintln(os.Stderr, "usage: fgamodel <repository root> <output file>")
+		os.Exit(2)
+	}
+
+	if err := compile(os.Args[1], os.Args[2]); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func compile(root, output string) error {
+	data, err := os.ReadFile(filepath.Join(root, "fga.mod"))
+	if err != nil {
+		return err
+	}
+
+	modFile, err := transformer.TransformModFile(string(data))
+	if err != nil {
+		return err
+	}
+
+	var modules []transformer.ModuleFile
+	for _, v := range modFile.Contents.Value {
+		contents, err := os.ReadFile(filepath.Join(root, v.Value))
+		if err != nil {
+			return err
+		}
+		modules = append(modules, transformer.ModuleFile{
+			Name:     v.Value,
+			Contents: string(contents),
+		})
+	}
+
+	model, err := transformer.TransformModuleFilesToModel(modules, modFile.Schema.Value)
+	if err != nil {
+		return err
+	}
+
+	// Source metadata only matters to tooling and would make the hash depend on file layout.
+	for _, t := range model.TypeDefinitions {
+		if t.Metadata == nil {
+			continue
+		}
+		t.Metadata.Module = ""
+		t.Metadata.SourceInfo = nil
+		for _, r := range t.Metadata.Relations {
+			r.Module = ""
+			r.SourceInfo = nil
+		}
+	}
+	for _, c := range model.Conditions {
+		c.Metadata = nil
+	}
+
+	raw, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(model)
+	if err != nil {
+		return err
+	}
+
+	// protojson output is deliberately unstable, so the document is re-encoded to keep its hash deterministic.
+	var doc map[string]any
+	if err = json.Unmarshal(raw, &doc); err != nil {
+		return err
+	}
+	renameHTTPFields(doc)
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetIndent("", "  ")
+	if err = encoder.Encode(doc); err != nil {
+		return err
+	}
+
+	return os.WriteFile(output, buf.Bytes(), 0644)
+}
+
+// The HTTP API, and so the SDK the permissions service decodes the document with, names a few fields differently from
+// their proto names. Left as proto names they would be silently dropped when the document is decoded.
+var httpFieldNames = map[string]string{
+	"computed_userset": "computedUserset",
+	"tuple_to_userset": "tupleToUserset",
+}
+
+func renameHTTPFields(v any) {
+	switch v := v.(type) {
+	case map[string]any:
+		for name, child := range v {
+			renameHTTPFields(child)
+			if renamed, ok := httpFieldNames[name]; ok {
+				delete(v, name)
+				v[renamed] = child
+			}
+		}
+	case []any:
+		for _, child := range v {
+			renameHTTPFields(child)
+		}
+	}
+}
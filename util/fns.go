@@ -5,10 +5,13 @@ import (
 	"encoding/hex"
 )
 
+// Hashes the arguments as a sequence. Each argument is terminated by a NUL byte so that different splits of the same
+// characters (e.g. "1"+"23" and "12"+"3") never hash alike.
 func HashThese(args ...string) string {
 	hash := md5.New()
 	for _, arg := range args {
 		hash.Write([]byte(arg))
+		hash.Write([]byte{0})
 	}
 
 	return hex.EncodeToString(hash.Sum(nil))
@@ -0,0 +1,13 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHashTheseSeparatesArguments(t *testing.T) {
+	assert.NotEqual(t, HashThese("1", "23"), HashThese("12", "3"))
+	assert.NotEqual(t, HashThese("a", ""), HashThese("a"))
+	assert.Equal(t, HashThese("a", "b"), HashThese("a", "b"))
+}